@@ -0,0 +1,257 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package itokentransferrer
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TransferrerMessageType mirrors the TransferrerMessageType enum defined in ITokenTransferrer.sol
+type TransferrerMessageType uint8
+
+const (
+	RegisterRemote TransferrerMessageType = iota
+	SingleHopSend
+	SingleHopCall
+	MultiHopSend
+	MultiHopCall
+)
+
+func (t TransferrerMessageType) String() string {
+	switch t {
+	case RegisterRemote:
+		return "REGISTER_REMOTE"
+	case SingleHopSend:
+		return "SINGLE_HOP_SEND"
+	case SingleHopCall:
+		return "SINGLE_HOP_CALL"
+	case MultiHopSend:
+		return "MULTI_HOP_SEND"
+	case MultiHopCall:
+		return "MULTI_HOP_CALL"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", uint8(t))
+	}
+}
+
+// TransferrerMessage wraps the messages sent between token transferrer contracts.
+type TransferrerMessage struct {
+	MessageType uint8
+	Payload     []byte
+}
+
+type RegisterRemoteMessage struct {
+	InitialReserveImbalance *big.Int
+	HomeTokenDecimals       uint8
+	RemoteTokenDecimals     uint8
+}
+
+type SingleHopSendMessage struct {
+	Recipient common.Address
+	Amount    *big.Int
+}
+
+type SingleHopCallMessage struct {
+	SourceBlockchainID            [32]byte
+	OriginTokenTransferrerAddress common.Address
+	OriginSenderAddress           common.Address
+	RecipientContract             common.Address
+	Amount                        *big.Int
+	RecipientPayload              []byte
+	RecipientGasLimit             *big.Int
+	FallbackRecipient             common.Address
+}
+
+type MultiHopSendMessage struct {
+	DestinationBlockchainID            [32]byte
+	DestinationTokenTransferrerAddress common.Address
+	Recipient                          common.Address
+	Amount                             *big.Int
+	SecondaryFee                       *big.Int
+	SecondaryGasLimit                  *big.Int
+	MultiHopFallback                   common.Address
+}
+
+type MultiHopCallMessage struct {
+	OriginSenderAddress                common.Address
+	DestinationBlockchainID            [32]byte
+	DestinationTokenTransferrerAddress common.Address
+	RecipientContract                  common.Address
+	Amount                             *big.Int
+	RecipientPayload                   []byte
+	RecipientGasLimit                  *big.Int
+	FallbackRecipient                  common.Address
+	SecondaryRequiredGasLimit          *big.Int
+	MultiHopFallback                   common.Address
+	SecondaryFee                       *big.Int
+}
+
+var (
+	transferrerMessageType    abi.Type
+	registerRemoteMessageType abi.Type
+	singleHopSendMessageType  abi.Type
+	singleHopCallMessageType  abi.Type
+	multiHopSendMessageType   abi.Type
+	multiHopCallMessageType   abi.Type
+)
+
+func init() {
+	// abigen does not support ABI bindings for standalone structs, only methods and events,
+	// so we must manually keep these up-to-date with the structs defined in ITokenTransferrer.sol
+	transferrerMessageType = newTupleType([]abi.ArgumentMarshaling{
+		{Name: "messageType", Type: "uint8"},
+		{Name: "payload", Type: "bytes"},
+	})
+	registerRemoteMessageType = newTupleType([]abi.ArgumentMarshaling{
+		{Name: "initialReserveImbalance", Type: "uint256"},
+		{Name: "homeTokenDecimals", Type: "uint8"},
+		{Name: "remoteTokenDecimals", Type: "uint8"},
+	})
+	singleHopSendMessageType = newTupleType([]abi.ArgumentMarshaling{
+		{Name: "recipient", Type: "address"},
+		{Name: "amount", Type: "uint256"},
+	})
+	singleHopCallMessageType = newTupleType([]abi.ArgumentMarshaling{
+		{Name: "sourceBlockchainID", Type: "bytes32"},
+		{Name: "originTokenTransferrerAddress", Type: "address"},
+		{Name: "originSenderAddress", Type: "address"},
+		{Name: "recipientContract", Type: "address"},
+		{Name: "amount", Type: "uint256"},
+		{Name: "recipientPayload", Type: "bytes"},
+		{Name: "recipientGasLimit", Type: "uint256"},
+		{Name: "fallbackRecipient", Type: "address"},
+	})
+	multiHopSendMessageType = newTupleType([]abi.ArgumentMarshaling{
+		{Name: "destinationBlockchainID", Type: "bytes32"},
+		{Name: "destinationTokenTransferrerAddress", Type: "address"},
+		{Name: "recipient", Type: "address"},
+		{Name: "amount", Type: "uint256"},
+		{Name: "secondaryFee", Type: "uint256"},
+		{Name: "secondaryGasLimit", Type: "uint256"},
+		{Name: "multiHopFallback", Type: "address"},
+	})
+	multiHopCallMessageType = newTupleType([]abi.ArgumentMarshaling{
+		{Name: "originSenderAddress", Type: "address"},
+		{Name: "destinationBlockchainID", Type: "bytes32"},
+		{Name: "destinationTokenTransferrerAddress", Type: "address"},
+		{Name: "recipientContract", Type: "address"},
+		{Name: "amount", Type: "uint256"},
+		{Name: "recipientPayload", Type: "bytes"},
+		{Name: "recipientGasLimit", Type: "uint256"},
+		{Name: "fallbackRecipient", Type: "address"},
+		{Name: "secondaryRequiredGasLimit", Type: "uint256"},
+		{Name: "multiHopFallback", Type: "address"},
+		{Name: "secondaryFee", Type: "uint256"},
+	})
+}
+
+func newTupleType(components []abi.ArgumentMarshaling) abi.Type {
+	t, err := abi.NewType("tuple", "struct Overloader.F", components)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create ABI type: %v", err))
+	}
+	return t
+}
+
+func pack(t abi.Type, v interface{}) ([]byte, error) {
+	return abi.Arguments{{Type: t}}.Pack(v)
+}
+
+func unpack(t abi.Type, b []byte, v interface{}) error {
+	args := abi.Arguments{{Type: t}}
+	unpacked, err := args.Unpack(b)
+	if err != nil {
+		return err
+	}
+	return args.Copy(v, unpacked)
+}
+
+// Pack ABI encodes the message, matching abi.encode(message) in Solidity.
+func (m *TransferrerMessage) Pack() ([]byte, error) {
+	return pack(transferrerMessageType, m)
+}
+
+func (m *TransferrerMessage) Unpack(b []byte) error {
+	if err := unpack(transferrerMessageType, b, &m); err != nil {
+		return fmt.Errorf("failed to unpack transferrer message: %w", err)
+	}
+	return nil
+}
+
+func (m *RegisterRemoteMessage) Pack() ([]byte, error) {
+	return pack(registerRemoteMessageType, m)
+}
+
+func (m *RegisterRemoteMessage) Unpack(b []byte) error {
+	if err := unpack(registerRemoteMessageType, b, &m); err != nil {
+		return fmt.Errorf("failed to unpack register remote message: %w", err)
+	}
+	return nil
+}
+
+func (m *SingleHopSendMessage) Pack() ([]byte, error) {
+	return pack(singleHopSendMessageType, m)
+}
+
+func (m *SingleHopSendMessage) Unpack(b []byte) error {
+	if err := unpack(singleHopSendMessageType, b, &m); err != nil {
+		return fmt.Errorf("failed to unpack single-hop send message: %w", err)
+	}
+	return nil
+}
+
+func (m *SingleHopCallMessage) Pack() ([]byte, error) {
+	return pack(singleHopCallMessageType, m)
+}
+
+func (m *SingleHopCallMessage) Unpack(b []byte) error {
+	if err := unpack(singleHopCallMessageType, b, &m); err != nil {
+		return fmt.Errorf("failed to unpack single-hop call message: %w", err)
+	}
+	return nil
+}
+
+func (m *MultiHopSendMessage) Pack() ([]byte, error) {
+	return pack(multiHopSendMessageType, m)
+}
+
+func (m *MultiHopSendMessage) Unpack(b []byte) error {
+	if err := unpack(multiHopSendMessageType, b, &m); err != nil {
+		return fmt.Errorf("failed to unpack multi-hop send message: %w", err)
+	}
+	return nil
+}
+
+func (m *MultiHopCallMessage) Pack() ([]byte, error) {
+	return pack(multiHopCallMessageType, m)
+}
+
+func (m *MultiHopCallMessage) Unpack(b []byte) error {
+	if err := unpack(multiHopCallMessageType, b, &m); err != nil {
+		return fmt.Errorf("failed to unpack multi-hop call message: %w", err)
+	}
+	return nil
+}
+
+// Packer is implemented by each of the transferrer message payload types.
+type Packer interface {
+	Pack() ([]byte, error)
+}
+
+// PackTransferrerMessage packs [payload] and wraps it in a TransferrerMessage of type [messageType].
+func PackTransferrerMessage(messageType TransferrerMessageType, payload Packer) ([]byte, error) {
+	payloadBytes, err := payload.Pack()
+	if err != nil {
+		return nil, err
+	}
+	message := TransferrerMessage{
+		MessageType: uint8(messageType),
+		Payload:     payloadBytes,
+	}
+	return message.Pack()
+}
@@ -0,0 +1,74 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package itokentransferrer
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+var testAddress = common.HexToAddress("0x0123456789abcdef0123456789abcdef01234567")
+
+func TestSingleHopSendMessagePacking(t *testing.T) {
+	message := SingleHopSendMessage{
+		Recipient: testAddress,
+		Amount:    big.NewInt(1_000),
+	}
+	b, err := message.Pack()
+	require.NoError(t, err)
+	// Static structs are encoded in place, without an offset.
+	require.Len(t, b, 64)
+
+	var unpacked SingleHopSendMessage
+	require.NoError(t, unpacked.Unpack(b))
+	require.Equal(t, message, unpacked)
+}
+
+func TestTransferrerMessagePacking(t *testing.T) {
+	callMessage := &MultiHopCallMessage{
+		OriginSenderAddress:                testAddress,
+		DestinationBlockchainID:            ids.ID{1, 2, 3},
+		DestinationTokenTransferrerAddress: testAddress,
+		RecipientContract:                  testAddress,
+		Amount:                             big.NewInt(5),
+		RecipientPayload:                   []byte{1, 2, 3, 4},
+		RecipientGasLimit:                  big.NewInt(100_000),
+		FallbackRecipient:                  testAddress,
+		SecondaryRequiredGasLimit:          big.NewInt(200_000),
+		MultiHopFallback:                   testAddress,
+		SecondaryFee:                       big.NewInt(1),
+	}
+	b, err := PackTransferrerMessage(MultiHopCall, callMessage)
+	require.NoError(t, err)
+
+	var message TransferrerMessage
+	require.NoError(t, message.Unpack(b))
+	require.Equal(t, MultiHopCall, TransferrerMessageType(message.MessageType))
+	require.Equal(t, "MULTI_HOP_CALL", TransferrerMessageType(message.MessageType).String())
+
+	var unpacked MultiHopCallMessage
+	require.NoError(t, unpacked.Unpack(message.Payload))
+	require.Equal(t, *callMessage, unpacked)
+
+	var wrongType SingleHopCallMessage
+	require.Error(t, wrongType.Unpack([]byte{1, 2, 3}))
+}
+
+func TestRegisterRemoteMessagePacking(t *testing.T) {
+	message := RegisterRemoteMessage{
+		InitialReserveImbalance: big.NewInt(42),
+		HomeTokenDecimals:       18,
+		RemoteTokenDecimals:     6,
+	}
+	b, err := message.Pack()
+	require.NoError(t, err)
+
+	var unpacked RegisterRemoteMessage
+	require.NoError(t, unpacked.Unpack(b))
+	require.Equal(t, message, unpacked)
+}
@@ -0,0 +1,215 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	topologyUtils "github.com/ava-labs/icm-contracts/utils/topology-utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	appsResources []string
+	appsForce     bool
+)
+
+var topologyAppsCmd = &cobra.Command{
+	Use:   "apps",
+	Short: "Manages the Teleporter versions accepted by the TeleporterRegistryApp contracts of a topology",
+	Long: `Manages the Teleporter versions accepted by the TeleporterRegistryApp contracts of a topology: the
+apps listed under apps in the spec, and the TokenHome and TokenRemote instances of the spec that are
+deployed. Apps are identified as app/NAME, ictt/NAME/home or ictt/NAME/remote/CHAIN, and --app
+restricts a command to some of them.
+
+Example spec entry:
+apps:
+  - name: bridge
+    chain: l1
+    address: "0x..."`,
+}
+
+var topologyAppsStatusCmd = &cobra.Command{
+	Use:   "status --spec FILE [--app APP...] [--state FILE] [--from-block BLOCK] [--max-block-range BLOCKS]",
+	Short: "Lists the minimum Teleporter version and paused Teleporter addresses of each app",
+	Long: `Lists the minimum Teleporter version of each app, and the Teleporter addresses it has paused,
+which are those of its TeleporterAddressPaused events that isTeleporterAddressPaused confirms. The
+events are scanned from --from-block, in queries of at most --max-block-range blocks if it is set.`,
+	Args:    cobra.NoArgs,
+	PreRunE: topologyPreRunE,
+	Run:     topologyAppsStatusRun,
+}
+
+var topologyAppsPauseCmd = &cobra.Command{
+	Use:   "pause --spec FILE --private-key KEY [--app APP...] [--state FILE] TELEPORTER_ADDRESS",
+	Short: "Pauses a Teleporter address on every app",
+	Long: `Calls pauseTeleporterAddress on every app that has not paused TELEPORTER_ADDRESS, such as a
+compromised TeleporterMessenger, and checks that it emitted TeleporterAddressPaused. Apps that have
+paused it already are skipped, so running the command again resumes where it stopped.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: topologyAppsPausePreRunE,
+	Run: func(cmd *cobra.Command, args []string) {
+		topologyAppsSetPausedRun(cmd, args, true)
+	},
+}
+
+var topologyAppsUnpauseCmd = &cobra.Command{
+	Use:   "unpause --spec FILE --private-key KEY [--app APP...] [--state FILE] TELEPORTER_ADDRESS",
+	Short: "Unpauses a Teleporter address on every app",
+	Long: `Calls unpauseTeleporterAddress on every app that has paused TELEPORTER_ADDRESS, and checks that it
+emitted TeleporterAddressUnpaused.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: topologyAppsPausePreRunE,
+	Run: func(cmd *cobra.Command, args []string) {
+		topologyAppsSetPausedRun(cmd, args, false)
+	},
+}
+
+var topologyAppsMinVersionCmd = &cobra.Command{
+	Use: "min-version --spec FILE --private-key KEY [--app APP...] [--force] [--state FILE] " +
+		"[--from-block BLOCK] [--max-block-range BLOCKS] VERSION",
+	Short: "Raises the minimum Teleporter version of every app",
+	Long: `Calls updateMinTeleporterVersion on every app whose minimum Teleporter version is below VERSION,
+and checks that it emitted MinTeleporterVersionUpdated. Apps reject messages from versions below
+their minimum, so the messages sent to the apps by the TeleporterMessenger versions below VERSION
+of every chain's registry, that the same version on the app's chain has not received, are listed
+first. Nothing is changed while such messages are in flight, unless --force is given. Events are
+scanned from --from-block on every chain, in queries of at most --max-block-range blocks if it is
+set.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: topologyAppsMinVersionPreRunE,
+	Run:     topologyAppsMinVersionRun,
+}
+
+func topologyAppsPausePreRunE(cmd *cobra.Command, args []string) error {
+	if err := topologyPreRunE(cmd, args); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(args[0]) {
+		return fmt.Errorf("invalid address %q", args[0])
+	}
+	return nil
+}
+
+func topologyAppsMinVersionPreRunE(cmd *cobra.Command, args []string) error {
+	if err := topologyPreRunE(cmd, args); err != nil {
+		return err
+	}
+	if version, err := strconv.ParseUint(args[0], 10, 64); err != nil || version == 0 {
+		return fmt.Errorf("invalid version %q", args[0])
+	}
+	return nil
+}
+
+// newAppsTopology creates the topology of newTopology, and returns its apps, restricted to --app if
+// it is given.
+func newAppsTopology(
+	ctx context.Context,
+	privateKey string,
+) (*topologyUtils.Topology, *topologyUtils.State, []*topologyUtils.App) {
+	topology, state, _ := newTopology(ctx, privateKey)
+	apps := topology.Apps(state)
+	if len(appsResources) == 0 {
+		return topology, state, apps
+	}
+	byResource := make(map[string]*topologyUtils.App)
+	for _, app := range apps {
+		byResource[app.Resource] = app
+	}
+	selected := make([]*topologyUtils.App, len(appsResources))
+	for i, resource := range appsResources {
+		app, ok := byResource[resource]
+		if !ok {
+			cobra.CheckErr(fmt.Errorf("unknown or undeployed app %q", resource))
+		}
+		selected[i] = app
+	}
+	return topology, state, selected
+}
+
+func topologyAppsStatusRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	topology, _, apps := newAppsTopology(ctx, "")
+	statuses, err := topology.AppStatuses(ctx, apps, topologyFromBlock, topologyMaxBlockRange)
+	cobra.CheckErr(err)
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APP\tCHAIN\tADDRESS\tMIN VERSION\tPAUSED")
+	for _, status := range statuses {
+		paused := make([]string, len(status.Paused))
+		for i, address := range status.Paused {
+			paused[i] = address.Hex()
+		}
+		if len(paused) == 0 {
+			paused = []string{"none"}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", status.Resource, status.Chain, status.Address.Hex(),
+			status.MinVersion, strings.Join(paused, ","))
+	}
+	cobra.CheckErr(w.Flush())
+}
+
+func topologyAppsSetPausedRun(cmd *cobra.Command, args []string, paused bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), topologyTimeout)
+	defer cancel()
+	topology, _, apps := newAppsTopology(ctx, topologyPrivateKey)
+	teleporterAddress := common.HexToAddress(args[0])
+	logger.Info("Setting Teleporter address paused",
+		zap.Stringer("teleporterAddress", teleporterAddress),
+		zap.Bool("paused", paused),
+		zap.Int("apps", len(apps)))
+	changed, err := topology.SetTeleporterAddressPaused(ctx, apps, teleporterAddress, paused)
+	for _, app := range changed {
+		cmd.Println("Changed " + app.Resource)
+	}
+	cobra.CheckErr(err)
+	cmd.Printf("Changed: %d of %d apps\n", len(changed), len(apps))
+}
+
+func topologyAppsMinVersionRun(cmd *cobra.Command, args []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), topologyTimeout)
+	defer cancel()
+	topology, state, apps := newAppsTopology(ctx, topologyPrivateKey)
+	version, err := strconv.ParseUint(args[0], 10, 64)
+	cobra.CheckErr(err)
+	changed, inFlight, err := topology.UpdateMinTeleporterVersion(ctx, state, apps, version, appsForce,
+		topologyFromBlock, topologyMaxBlockRange)
+	for _, message := range inFlight {
+		cmd.Printf("Warning: message %s from version %d on %s to %s is in flight\n",
+			message.MessageID, message.Version, message.SourceChain, message.App.Resource)
+	}
+	for _, app := range changed {
+		cmd.Println("Changed " + app.Resource)
+	}
+	cobra.CheckErr(err)
+	cmd.Printf("Changed: %d of %d apps\n", len(changed), len(apps))
+}
+
+func init() {
+	topologyCmd.AddCommand(topologyAppsCmd)
+	topologyAppsCmd.AddCommand(topologyAppsStatusCmd, topologyAppsPauseCmd, topologyAppsUnpauseCmd,
+		topologyAppsMinVersionCmd)
+	topologyAppsCmd.PersistentFlags().StringArrayVar(&appsResources, "app", nil,
+		"App to restrict the command to, as app/NAME, ictt/NAME/home or ictt/NAME/remote/CHAIN, may be repeated")
+	for _, c := range []*cobra.Command{topologyAppsPauseCmd, topologyAppsUnpauseCmd, topologyAppsMinVersionCmd} {
+		c.Flags().StringVar(&topologyPrivateKey, "private-key", "",
+			"Private key of the account that manages the apps on every chain")
+		c.Flags().DurationVar(&topologyTimeout, "timeout", 30*time.Minute,
+			"Maximum time to wait for the apps to be changed")
+		cobra.CheckErr(c.MarkFlagRequired("private-key"))
+	}
+	topologyAppsMinVersionCmd.Flags().BoolVar(&appsForce, "force", false,
+		"Raise the minimum version even if messages from lower versions are in flight")
+	for _, c := range []*cobra.Command{topologyAppsStatusCmd, topologyAppsMinVersionCmd} {
+		c.Flags().Uint64Var(&topologyFromBlock, "from-block", 0, "Block to start scanning for events from, on every chain")
+		c.Flags().Uint64Var(&topologyMaxBlockRange, "max-block-range", 0,
+			"Maximum number of blocks per log query. Unlimited if zero")
+	}
+}
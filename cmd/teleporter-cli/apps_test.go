@@ -0,0 +1,75 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyAppsCmd(t *testing.T) {
+	specPath := filepath.Join(t.TempDir(), "spec.yaml")
+	require.NoError(t, os.WriteFile(specPath,
+		[]byte("chains:\n  - name: c\n    rpc: http://127.0.0.1:9650/ext/bc/C/rpc\n"+
+			"apps:\n  - name: bridge\n    chain: l1\n    address: \"0x0123456789abcdef0123456789abcdef01234567\"\n"), 0o600))
+	validSpecPath := filepath.Join(t.TempDir(), "valid.yaml")
+	require.NoError(t, os.WriteFile(validSpecPath,
+		[]byte("chains:\n  - name: c\n    rpc: http://127.0.0.1:9650/ext/bc/C/rpc\n"), 0o600))
+	// --spec is a persistent flag of the topology commands, so it stays set for later tests.
+	t.Cleanup(func() {
+		topologySpecPath = ""
+		topologyCmd.PersistentFlags().Lookup("spec").Changed = false
+	})
+
+	var tests = []struct {
+		name string
+		args []string
+		err  error
+		out  string
+	}{
+		{
+			name: "status unknown chain",
+			args: []string{"topology", "apps", "status", "--spec", specPath},
+			err:  fmt.Errorf("invalid spec: app bridge: unknown chain \"l1\""),
+		},
+		{
+			name: "pause no private key",
+			args: []string{"topology", "apps", "pause", "--spec", validSpecPath,
+				"0x0123456789abcdef0123456789abcdef01234567"},
+			err: fmt.Errorf("required flag(s) \"private-key\" not set"),
+		},
+		{
+			name: "unpause invalid address",
+			args: []string{"topology", "apps", "unpause", "--spec", validSpecPath, "--private-key", "01", "invalid"},
+			err:  fmt.Errorf("invalid address \"invalid\""),
+		},
+		{
+			name: "min-version invalid version",
+			args: []string{"topology", "apps", "min-version", "--spec", validSpecPath, "--private-key", "01", "0"},
+			err:  fmt.Errorf("invalid version \"0\""),
+		},
+		{
+			name: "help",
+			args: []string{"topology", "apps", "min-version", "--help"},
+			err:  nil,
+			out:  "Nothing is changed while such messages are in flight, unless --force is given.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeTestCmd(t, rootCmd, tt.args...)
+			if tt.err != nil {
+				require.ErrorContains(t, err, tt.err.Error())
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, out, tt.out)
+			}
+		})
+	}
+}
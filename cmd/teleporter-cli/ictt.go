@@ -0,0 +1,1329 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/TokenRemote"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	icttUtils "github.com/ava-labs/icm-contracts/utils/ictt-utils"
+	tokenScalingUtils "github.com/ava-labs/icm-contracts/utils/token-scaling-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/ethclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	icttRPCEndpoint   string
+	icttFromBlock     uint64
+	icttMaxBlockRange uint64
+	icttRemoteRPCs    map[string]string
+	icttCheckInterval time.Duration
+	icttChainRPCs     map[string]string
+
+	icttSendPrivateKey                   string
+	icttSendDestinationBlockchainID      string
+	icttSendDestinationAddress           string
+	icttSendRecipient                    string
+	icttSendAmount                       string
+	icttSendHomeRPCEndpoint              string
+	icttSendDestinationRPCEndpoint       string
+	icttSendFeeTokenAddress              string
+	icttSendPrimaryFee                   string
+	icttSendSecondaryFee                 string
+	icttSendRequiredGasLimit             uint64
+	icttSendMultiHopFallback             string
+	icttSendCallSignature                string
+	icttSendCallArgs                     []string
+	icttSendRecipientPayload             []byte
+	icttSendRecipientGasLimit            uint64
+	icttSendFallbackRecipient            string
+	icttSendRecipientABIPath             string
+	icttSendDestinationKind              string
+	icttSendEstimateGas                  bool
+	icttSendDestinationTeleporterAddress string
+	icttSendGasMarginPercentage          uint64
+
+	icttDecodeCallSignature    string
+	icttDecodeRecipientABIPath string
+
+	icttDeployPrivateKey      string
+	icttDeployHomeRPCEndpoint string
+	icttDeploySpecPath        string
+	icttDeployStatePath       string
+	icttDeployTimeout         time.Duration
+
+	icttKeeperPrivateKey            string
+	icttKeeperHomeRPCEndpoint       string
+	icttKeeperHomeTeleporterAddress string
+	icttKeeperThreshold             string
+	icttKeeperInterval              time.Duration
+	icttKeeperPollInterval          time.Duration
+	icttKeeperDeliveryTimeout       time.Duration
+	icttKeeperGasMarginPercentage   uint64
+	icttKeeperStatePath             string
+)
+
+var icttCmd = &cobra.Command{
+	Use:   "ictt",
+	Short: "Inspects and sends through Interchain Token Transfer contracts",
+	Long: `Inspects and sends through Interchain Token Transfer (ICTT) contracts. Use the home
+subcommand to list the remotes registered with a TokenHome, the remote subcommand to show how a
+TokenRemote is configured, the check subcommand to check the accounting invariants between a
+TokenHome and its remotes, the send subcommand to send tokens, the track subcommand to follow a
+transfer to its recipient, the decode-call subcommand to decode the payload of a sendAndCall
+transfer, the deploy-remote subcommand to deploy and register a TokenRemote, and the
+report-burned-fees subcommand to keep a NativeTokenRemote's burned transaction fees reported.`,
+}
+
+var icttHomeCmd = &cobra.Command{
+	Use:   "home --rpc RPC_URL ADDRESS",
+	Short: "Lists a TokenHome's registered remotes and balances",
+	Long: `Lists every TokenRemote registered with the TokenHome at ADDRESS, found by scanning
+RemoteRegistered events. For each remote, prints its settings from getRemoteTokenTransferrerSettings
+and its transferred balance, denominated in the remote's token. Also prints the TokenHome's balance
+of the token it transfers. Use --from-block to skip blocks before the TokenHome was deployed, and
+--max-block-range if the RPC endpoint limits the block range of log queries.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: icttPreRunE,
+	Run:     icttHomeRun,
+}
+
+var icttRemoteCmd = &cobra.Command{
+	Use:   "remote --rpc RPC_URL ADDRESS",
+	Short: "Shows a TokenRemote's configuration",
+	Long: `Shows the token home, collateralization status, initial reserve imbalance and token
+scaling of the TokenRemote at ADDRESS.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: icttPreRunE,
+	Run:     icttRemoteRun,
+}
+
+var icttCheckCmd = &cobra.Command{
+	Use:   "check --rpc RPC_URL [--remote-rpc BLOCKCHAIN_ID=RPC_URL]... ADDRESS",
+	Short: "Checks the accounting invariants of a TokenHome and its remotes",
+	Long: `Checks that the TokenHome at ADDRESS holds enough tokens to back the transferred
+balances of its registered remotes and the collateral added for them. For each remote whose chain
+is given with --remote-rpc, also checks that its circulating supply (totalSupply for an
+ERC20TokenRemote, totalNativeAssetSupply for a NativeTokenRemote) does not exceed its initial
+reserve imbalance plus its transferred balance, and that its initial reserve imbalance, token
+scaling and collateralization match the TokenHome's record. A circulating supply below that bound
+is reported as pending drift, since it is expected while transfers are in flight or burned
+transaction fees are unreported.
+
+Violated invariants are reported as alerts with the exact drift. Without --interval, the check runs
+once and fails if there are any alerts. With --interval, the check runs periodically and alerts are
+logged until the command is stopped.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: icttCheckPreRunE,
+	Run:     icttCheckRun,
+}
+
+var icttTrackCmd = &cobra.Command{
+	Use:   "track --rpc RPC_URL [--chain-rpc BLOCKCHAIN_ID=RPC_URL]... TX_HASH",
+	Short: "Follows a token transfer to its recipient",
+	Long: `Follows the token transfer sent by transaction TX_HASH on the chain at --rpc, which
+must have emitted a TokensSent or TokensAndCallSent event. Each Teleporter message of the transfer
+is looked up on its destination chain, given with --chain-rpc. A multi-hop transfer is followed
+through the TokenHome, which routes it to its destination in a second message less the secondary
+fee. Prints each message, and either the recipient that received the tokens, or the message the
+transfer is stuck at because it has not been delivered or its execution failed.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: icttTrackPreRunE,
+	Run:     icttTrackRun,
+}
+
+var icttSendCmd = &cobra.Command{
+	Use: "send --rpc RPC_URL --private-key KEY --destination-blockchain-id ID --recipient ADDRESS " +
+		"--amount AMOUNT ADDRESS",
+	Short: "Sends tokens from a TokenHome or TokenRemote",
+	Long: `Sends AMOUNT tokens from the ERC20TokenHome, NativeTokenHome, ERC20TokenRemote or
+NativeTokenRemote at ADDRESS, which is detected from the contract. The amount is approved for an
+ERC20 transferrer, and sent as the transaction value for a native one. The primary fee is paid in
+--fee-token, which defaults to the transferred token. It is approved for the transferrer, and for
+a native transferrer, a fee in the wrapped native token is deposited first.
+
+A TokenHome sends to the TokenRemote given with --destination-address. A TokenRemote sends back to
+its TokenHome if --destination-blockchain-id is the TokenHome's chain, and otherwise through the
+TokenHome to another TokenRemote (multi-hop), with the secondary fee paid to the TokenHome's relayer
+out of the transferred amount. With --home-rpc, the route is checked against the TokenHome's
+registered remotes before sending, and the destination TokenRemote is found from them if
+--destination-address is not set.
+
+With --call, the tokens are sent to the --recipient contract and it is called with a payload
+encoded from the method signature and its --args, or with the hex encoded --recipient-payload. With
+--recipient-abi, the destination transferrer's receiveTokens call to the recipient contract is
+simulated on --destination-rpc first, and nothing is sent if it fails.
+
+The destination transferrer's kind is detected with --destination-rpc, or given with
+--destination-kind, one of which is required. With both, the detected kind must be the given one.
+The required gas limit defaults to the gas-utils limits for the destination's kind. With
+--estimate-gas, it is instead estimated on --destination-rpc for the destination transferrer
+receiving the transfer from the TeleporterMessenger at --destination-teleporter-address, plus
+--gas-margin percent. The second hop of a multi-hop transfer is estimated as routed by the
+TokenHome, which needs --home-rpc. Prints the Teleporter message ID of the transfer.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: icttSendPreRunE,
+	Run:     icttSendRun,
+}
+
+var icttDecodeCallCmd = &cobra.Command{
+	Use:   "decode-call --rpc RPC_URL [--call SIGNATURE | --recipient-abi FILE] TX_HASH",
+	Short: "Decodes the sendAndCall messages sent in a transaction",
+	Long: `Decodes the SingleHopCallMessage and MultiHopCallMessage Teleporter messages sent in the
+transaction TX_HASH, either by a sendAndCall transfer or by a TokenHome routing a multi-hop one.
+The recipient payload of each message is decoded as a call to the method with the --call signature,
+or to the matching method of the --recipient-abi contract ABI.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: icttDecodeCallPreRunE,
+	Run:     icttDecodeCallRun,
+}
+
+var icttDeployRemoteCmd = &cobra.Command{
+	Use:   "deploy-remote --rpc RPC_URL --home-rpc RPC_URL --private-key KEY --spec FILE [--state FILE]",
+	Short: "Deploys a TokenRemote and registers it with its TokenHome",
+	Long: `Deploys the ERC20TokenRemote or NativeTokenRemote described by the JSON spec FILE to the
+chain at --rpc, registers it with its TokenHome on the chain at --home-rpc, and adds the collateral
+the TokenHome needs for the remote's initial reserve imbalance. With "upgradeable": true in the spec,
+the upgradeable contract is deployed behind a TransparentUpgradeableProxy, which is initialized when
+it is deployed and creates a ProxyAdmin owned by "proxyAdminOwner".
+
+The registration message is sent with the spec's "registrationFee", and delivered by a relayer,
+which the command waits for. The TokenHome's registration is checked before the registration is
+sent, and the collateral is only added if the TokenHome still needs it.
+
+Progress is saved to the --state file after every transaction, which defaults to the spec file with
+a .state.json extension. Running the command again with the same spec and state resumes the
+deployment where it stopped, and does nothing if it is done.
+
+Example spec:
+{
+  "kind": "ERC20TokenRemote",
+  "teleporterRegistryAddress": "0x...",
+  "tokenHomeAddress": "0x...",
+  "tokenName": "Wrapped Token",
+  "tokenSymbol": "WTKN",
+  "tokenDecimals": 18,
+  "registrationFeeTokenAddress": "0x...",
+  "registrationFee": 1000000000000000000
+}`,
+	Args:    cobra.NoArgs,
+	PreRunE: icttDeployRemotePreRunE,
+	Run:     icttDeployRemoteRun,
+}
+
+var icttReportBurnedFeesCmd = &cobra.Command{
+	Use: "report-burned-fees --rpc RPC_URL --home-rpc RPC_URL --home-teleporter-address ADDRESS " +
+		"--private-key KEY [--threshold AMOUNT] [--interval DURATION] [--state FILE] ADDRESS",
+	Short: "Reports a NativeTokenRemote's burned transaction fees to its TokenHome",
+	Long: `Watches the transaction fees burned on the chain of the NativeTokenRemote at ADDRESS, and
+calls reportBurnedTxFees once the unreported fees reach --threshold, or --interval after the
+previous report. The interval of the first report starts when the command starts. Nothing is
+reported while the unreported fees would be zero in the TokenHome's token.
+
+The required gas limit of each report is estimated for the TokenHome on --home-rpc, as delivered
+by the TeleporterMessenger at --home-teleporter-address, plus --gas-margin percent. The Teleporter
+message ID of each report is logged, and its delivery to the TokenHome is followed. A report that
+the TokenHome has not executed --delivery-timeout after it was sent is logged as an error at every
+check until it is executed.
+
+With --state, the reports the TokenHome has not executed are saved to FILE, and followed again
+when the command is restarted with the same file.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: icttReportBurnedFeesPreRunE,
+	Run:     icttReportBurnedFeesRun,
+}
+
+func icttPreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(args[0]) {
+		return fmt.Errorf("invalid address %q", args[0])
+	}
+	return nil
+}
+
+func icttCheckPreRunE(cmd *cobra.Command, args []string) error {
+	if err := icttPreRunE(cmd, args); err != nil {
+		return err
+	}
+	for blockchainID := range icttRemoteRPCs {
+		if _, err := ids.FromString(blockchainID); err != nil {
+			return fmt.Errorf("invalid remote blockchain ID %q: %w", blockchainID, err)
+		}
+	}
+	return nil
+}
+
+func icttTrackPreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	if len(common.FromHex(args[0])) != common.HashLength {
+		return fmt.Errorf("invalid transaction hash %q", args[0])
+	}
+	for blockchainID := range icttChainRPCs {
+		if _, err := ids.FromString(blockchainID); err != nil {
+			return fmt.Errorf("invalid blockchain ID %q: %w", blockchainID, err)
+		}
+	}
+	return nil
+}
+
+func icttSendPreRunE(cmd *cobra.Command, args []string) error {
+	if err := icttPreRunE(cmd, args); err != nil {
+		return err
+	}
+	if _, err := ids.FromString(icttSendDestinationBlockchainID); err != nil {
+		return fmt.Errorf("invalid destination blockchain ID: %w", err)
+	}
+	for _, address := range []string{
+		icttSendRecipient, icttSendDestinationAddress, icttSendFeeTokenAddress, icttSendMultiHopFallback,
+		icttSendFallbackRecipient,
+	} {
+		if address != "" && !common.IsHexAddress(address) {
+			return fmt.Errorf("invalid address %q", address)
+		}
+	}
+	amount, err := parseBigInt(icttSendAmount)
+	if err != nil {
+		return err
+	}
+	if amount.Sign() <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	for _, fee := range []string{icttSendPrimaryFee, icttSendSecondaryFee} {
+		if _, err := parseBigInt(fee); err != nil {
+			return err
+		}
+	}
+	if icttSendDestinationKind != "" {
+		var kind icttUtils.TransferrerKind
+		if err := kind.UnmarshalText([]byte(icttSendDestinationKind)); err != nil {
+			return err
+		}
+	} else if icttSendDestinationRPCEndpoint == "" {
+		return fmt.Errorf("--destination-rpc or --destination-kind is required to know the destination transferrer")
+	}
+	if icttSendEstimateGas {
+		if icttSendRequiredGasLimit != 0 {
+			return fmt.Errorf("--required-gas-limit and --estimate-gas can't both be set")
+		}
+		if icttSendDestinationRPCEndpoint == "" || icttSendDestinationTeleporterAddress == "" {
+			return fmt.Errorf("--destination-rpc and --destination-teleporter-address are required with --estimate-gas")
+		}
+		if !common.IsHexAddress(icttSendDestinationTeleporterAddress) {
+			return fmt.Errorf("invalid address %q", icttSendDestinationTeleporterAddress)
+		}
+	}
+	if icttSendCallSignature != "" && cmd.Flags().Changed("recipient-payload") {
+		return fmt.Errorf("--call and --recipient-payload can't both be set")
+	}
+	if len(icttSendCallArgs) != 0 && icttSendCallSignature == "" {
+		return fmt.Errorf("--args requires --call")
+	}
+	if !icttSendIsCall(cmd) {
+		if icttSendRecipientABIPath != "" {
+			return fmt.Errorf("--recipient-abi requires --call or --recipient-payload")
+		}
+		return nil
+	}
+	if _, err := icttSendPayload(); err != nil {
+		return err
+	}
+	if icttSendRecipientGasLimit == 0 {
+		return fmt.Errorf("--recipient-gas-limit is required with --call or --recipient-payload")
+	}
+	if icttSendRecipientABIPath != "" && icttSendDestinationRPCEndpoint == "" {
+		return fmt.Errorf("--destination-rpc is required with --recipient-abi")
+	}
+	return nil
+}
+
+func icttDecodeCallPreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	if len(common.FromHex(args[0])) != common.HashLength {
+		return fmt.Errorf("invalid transaction hash %q", args[0])
+	}
+	if icttDecodeCallSignature != "" {
+		if _, err := icttUtils.ParseMethodSignature(icttDecodeCallSignature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func icttReportBurnedFeesPreRunE(cmd *cobra.Command, args []string) error {
+	if err := icttPreRunE(cmd, args); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(icttKeeperHomeTeleporterAddress) {
+		return fmt.Errorf("invalid address %q", icttKeeperHomeTeleporterAddress)
+	}
+	if icttKeeperThreshold == "" && icttKeeperInterval == 0 {
+		return fmt.Errorf("--threshold or --interval is required")
+	}
+	if icttKeeperThreshold != "" {
+		threshold, err := parseBigInt(icttKeeperThreshold)
+		if err != nil {
+			return err
+		}
+		if threshold.Sign() <= 0 {
+			return fmt.Errorf("threshold must be positive")
+		}
+	}
+	if icttKeeperPollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive")
+	}
+	return nil
+}
+
+func icttDeployRemotePreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	_, err := readRemoteSpec(icttDeploySpecPath)
+	return err
+}
+
+// readRemoteSpec reads and validates the JSON spec of a TokenRemote deployment.
+func readRemoteSpec(path string) (*icttUtils.RemoteSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	spec := &icttUtils.RemoteSpec{}
+	if err := decoder.Decode(spec); err != nil {
+		return nil, fmt.Errorf("failed to decode spec: %w", err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+	return spec, nil
+}
+
+func icttHomeRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	c, err := ethclient.Dial(icttRPCEndpoint)
+	cobra.CheckErr(err)
+
+	state, err := icttUtils.InspectTokenHome(ctx, c, common.HexToAddress(args[0]), icttFromBlock, icttMaxBlockRange)
+	cobra.CheckErr(err)
+
+	cmd.Println("TokenHome: " + state.Address.Hex())
+	cmd.Println("Blockchain ID: " + state.BlockchainID.String())
+	cmd.Println("Token: " + state.TokenAddress.Hex())
+	cmd.Println("Token balance: " + state.TokenBalance.String())
+	cmd.Printf("Registered remotes: %d\n", len(state.Remotes))
+	for _, remote := range state.Remotes {
+		cmd.Println()
+		cmd.Println("Remote: " + remote.Address.Hex())
+		cmd.Println("  Blockchain ID: " + remote.BlockchainID.String())
+		cmd.Printf("  Registered at block: %d\n", remote.RegistrationBlock)
+		cmd.Printf("  Token decimals: %d\n", remote.RemoteTokenDecimals)
+		cmd.Printf("  Registered: %t\n", remote.Settings.Registered)
+		cmd.Println("  Collateral needed: " + remote.Settings.CollateralNeeded.String())
+		cmd.Println("  Token multiplier: " + remote.Settings.TokenMultiplier.String())
+		cmd.Printf("  Multiply on remote: %t\n", remote.Settings.MultiplyOnRemote)
+		cmd.Println("  Transferred balance: " + remote.TransferredBalance.String())
+	}
+}
+
+func icttRemoteRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	c, err := ethclient.Dial(icttRPCEndpoint)
+	cobra.CheckErr(err)
+
+	state, err := icttUtils.InspectTokenRemote(ctx, c, common.HexToAddress(args[0]))
+	cobra.CheckErr(err)
+
+	cmd.Println("TokenRemote: " + state.Address.Hex())
+	cmd.Println("Blockchain ID: " + state.BlockchainID.String())
+	cmd.Println("Token home blockchain ID: " + state.TokenHomeBlockchainID.String())
+	cmd.Println("Token home address: " + state.TokenHomeAddress.Hex())
+	cmd.Printf("Collateralized: %t\n", state.IsCollateralized)
+	cmd.Println("Initial reserve imbalance: " + state.InitialReserveImbalance.String())
+	cmd.Println("Token multiplier: " + state.TokenMultiplier.String())
+	cmd.Printf("Multiply on remote: %t\n", state.MultiplyOnRemote)
+}
+
+func icttCheckRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	homeClient, err := ethclient.Dial(icttRPCEndpoint)
+	cobra.CheckErr(err)
+	remoteBackends := make(map[ids.ID]bind.ContractBackend, len(icttRemoteRPCs))
+	for blockchainIDStr, rpcEndpoint := range icttRemoteRPCs {
+		blockchainID, err := ids.FromString(blockchainIDStr)
+		cobra.CheckErr(err)
+		remoteBackends[blockchainID], err = ethclient.Dial(rpcEndpoint)
+		cobra.CheckErr(err)
+	}
+	homeAddress := common.HexToAddress(args[0])
+
+	if icttCheckInterval == 0 {
+		report, err := icttUtils.CheckInvariants(
+			ctx, homeClient, homeAddress, remoteBackends, icttFromBlock, icttMaxBlockRange,
+		)
+		cobra.CheckErr(err)
+		printInvariantReport(cmd, report)
+		if len(report.Alerts) > 0 {
+			cobra.CheckErr(fmt.Errorf("%d invariant(s) violated", len(report.Alerts)))
+		}
+		return
+	}
+
+	ticker := time.NewTicker(icttCheckInterval)
+	defer ticker.Stop()
+	for {
+		report, err := icttUtils.CheckInvariants(
+			ctx, homeClient, homeAddress, remoteBackends, icttFromBlock, icttMaxBlockRange,
+		)
+		if err != nil {
+			logger.Error("Failed to check ICTT invariants", zap.Error(err))
+		} else {
+			logInvariantReport(report)
+		}
+		<-ticker.C
+	}
+}
+
+func logInvariantReport(report *icttUtils.InvariantReport) {
+	for _, alert := range report.Alerts {
+		logger.Error(
+			"ICTT invariant violated",
+			zap.String("kind", string(alert.Kind)),
+			zap.Stringer("remoteBlockchainID", alert.RemoteBlockchainID),
+			zap.Stringer("remoteAddress", alert.RemoteAddress),
+			zap.Stringer("expected", alert.Expected),
+			zap.Stringer("actual", alert.Actual),
+			zap.Stringer("drift", alert.Drift),
+		)
+	}
+	logger.Info(
+		"Checked ICTT invariants",
+		zap.Stringer("tokenHome", report.Home.Address),
+		zap.Int("remotes", len(report.Remotes)),
+		zap.Int("alerts", len(report.Alerts)),
+	)
+}
+
+func icttTrackRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	sourceClient, err := ethclient.Dial(icttRPCEndpoint)
+	cobra.CheckErr(err)
+	backends := make(map[ids.ID]icttUtils.TrackerBackend, len(icttChainRPCs))
+	for blockchainIDStr, rpcEndpoint := range icttChainRPCs {
+		blockchainID, err := ids.FromString(blockchainIDStr)
+		cobra.CheckErr(err)
+		backends[blockchainID], err = ethclient.Dial(rpcEndpoint)
+		cobra.CheckErr(err)
+	}
+
+	trace, err := icttUtils.TrackTransfer(ctx, sourceClient, common.HexToHash(args[0]), backends, icttMaxBlockRange)
+	cobra.CheckErr(err)
+	cmd.Println("Sender: " + trace.Sender.Hex())
+	for i, hop := range trace.Hops {
+		cmd.Println()
+		cmd.Printf("Hop %d: %s\n", i+1, hop.MessageType)
+		cmd.Println("  Teleporter message ID: " + hop.TeleporterMessageID.String())
+		cmd.Println("  From: " + hop.SourceAddress.Hex() + " on " + hop.SourceBlockchainID.String())
+		cmd.Println("  To: " + hop.DestinationAddress.Hex() + " on " + hop.DestinationBlockchainID.String())
+		cmd.Println("  Amount: " + hop.Amount.String())
+		cmd.Println("  Send transaction: " + hop.SendTxHash.Hex())
+		if hop.Delivered {
+			cmd.Println("  Receive transaction: " + hop.ReceiveTxHash.Hex())
+		}
+		if hop.Executed && hop.ExecutionTxHash != hop.ReceiveTxHash {
+			cmd.Println("  Retried execution transaction: " + hop.ExecutionTxHash.Hex())
+		}
+	}
+	if trace.SecondaryFee != nil {
+		cmd.Println()
+		cmd.Println("Secondary fee: " + trace.SecondaryFee.String())
+	}
+	cmd.Println()
+	cmd.Println("Status: " + trace.String())
+}
+
+func icttSendRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	key, err := parsePrivateKey(icttSendPrivateKey)
+	cobra.CheckErr(err)
+	c, err := ethclient.Dial(icttRPCEndpoint)
+	cobra.CheckErr(err)
+	opts, err := newTransactor(ctx, c, key)
+	cobra.CheckErr(err)
+	transferrerAddress := common.HexToAddress(args[0])
+	amount, err := parseBigInt(icttSendAmount)
+	cobra.CheckErr(err)
+
+	kind, err := icttUtils.DetectTransferrerKind(ctx, c, transferrerAddress)
+	cobra.CheckErr(err)
+	plan := icttSendPlanTransfer(ctx, c, kind, transferrerAddress, amount)
+	input := plan.input
+	logger.Info(
+		"Sending tokens",
+		zap.Stringer("kind", kind),
+		zap.Stringer("destinationBlockchainID", ids.ID(input.DestinationBlockchainID)),
+		zap.Stringer("destinationAddress", input.DestinationTokenTransferrerAddress),
+		zap.Stringer("destinationKind", plan.destinationKind),
+		zap.Bool("multiHop", plan.multiHop),
+	)
+
+	sender := icttUtils.NewTokenSender(c, opts, func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+		return waitForSuccess(ctx, c, tx)
+	})
+	var result *icttUtils.SendResult
+	if icttSendIsCall(cmd) {
+		payload, err := icttSendPayload()
+		cobra.CheckErr(err)
+		callInput := tokenremote.SendAndCallInput{
+			DestinationBlockchainID:            input.DestinationBlockchainID,
+			DestinationTokenTransferrerAddress: input.DestinationTokenTransferrerAddress,
+			RecipientContract:                  input.Recipient,
+			RecipientPayload:                   payload,
+			RequiredGasLimit:                   new(big.Int).SetUint64(icttSendRequiredGasLimit),
+			RecipientGasLimit:                  new(big.Int).SetUint64(icttSendRecipientGasLimit),
+			MultiHopFallback:                   input.MultiHopFallback,
+			FallbackRecipient:                  crypto.PubkeyToAddress(key.PublicKey),
+			PrimaryFeeTokenAddress:             input.PrimaryFeeTokenAddress,
+			PrimaryFee:                         input.PrimaryFee,
+			SecondaryFee:                       input.SecondaryFee,
+		}
+		if icttSendFallbackRecipient != "" {
+			callInput.FallbackRecipient = common.HexToAddress(icttSendFallbackRecipient)
+		}
+		if icttSendEstimateGas {
+			callInput.RequiredGasLimit = icttSendEstimateRequiredGasLimit(
+				ctx, c, kind, transferrerAddress, plan, amount, &callInput, opts.From,
+			)
+		} else if icttSendRequiredGasLimit == 0 {
+			limits, err := gasUtils.SendAndCallGasLimits(
+				plan.destinationKind.TransferrerType(), len(payload), icttSendRecipientGasLimit, plan.multiHop,
+			)
+			cobra.CheckErr(err)
+			callInput.RequiredGasLimit = limits.RequiredGasLimit
+		}
+		if icttSendRecipientABIPath != "" {
+			icttSendSimulateCall(ctx, cmd, c, kind, transferrerAddress, opts.From, plan, &callInput)
+		}
+		result, err = sender.SendAndCall(ctx, transferrerAddress, callInput, amount)
+	} else {
+		switch {
+		case icttSendEstimateGas:
+			input.RequiredGasLimit = icttSendEstimateRequiredGasLimit(
+				ctx, c, kind, transferrerAddress, plan, amount, nil, opts.From,
+			)
+		case icttSendRequiredGasLimit == 0:
+			input.RequiredGasLimit = gasUtils.SendTokensGasLimits(
+				plan.destinationKind.TransferrerType(), plan.multiHop,
+			).RequiredGasLimit
+		default:
+			input.RequiredGasLimit = new(big.Int).SetUint64(icttSendRequiredGasLimit)
+		}
+		result, err = sender.Send(ctx, transferrerAddress, input, amount)
+	}
+	cobra.CheckErr(err)
+
+	cmd.Println("Transaction: " + result.Receipt.TxHash.Hex())
+	cmd.Println("Amount sent: " + result.Amount.String())
+	cmd.Println("Teleporter Message ID: " + result.TeleporterMessageID.String())
+}
+
+// icttSendIsCall returns whether the send command sends with sendAndCall.
+func icttSendIsCall(cmd *cobra.Command) bool {
+	return icttSendCallSignature != "" || cmd.Flags().Changed("recipient-payload")
+}
+
+// icttSendPayload returns the recipient payload given with --recipient-payload, or encoded from
+// --call and --args.
+func icttSendPayload() ([]byte, error) {
+	if icttSendCallSignature == "" {
+		return icttSendRecipientPayload, nil
+	}
+	return icttUtils.EncodeRecipientPayload(icttSendCallSignature, icttSendCallArgs)
+}
+
+// icttTransferPlan is how the send command sends a transfer.
+type icttTransferPlan struct {
+	input           tokenremote.SendTokensInput
+	multiHop        bool
+	destinationKind icttUtils.TransferrerKind
+	// destinationAmount is the amount the destination transferrer receives, in its token's scale.
+	// It is nil for a multi-hop transfer that is not planned with --home-rpc.
+	destinationAmount *big.Int
+	// destinationClient is nil if --destination-rpc is not set.
+	destinationClient ethclient.Client
+}
+
+// icttSendPlanTransfer returns the plan for sending [amount] from the transferrer at
+// [transferrerAddress]. The required gas limit of the input is left to the caller.
+func icttSendPlanTransfer(
+	ctx context.Context,
+	c ethclient.Client,
+	kind icttUtils.TransferrerKind,
+	transferrerAddress common.Address,
+	amount *big.Int,
+) *icttTransferPlan {
+	destinationBlockchainID, err := ids.FromString(icttSendDestinationBlockchainID)
+	cobra.CheckErr(err)
+	recipient := common.HexToAddress(icttSendRecipient)
+	primaryFee, err := parseBigInt(icttSendPrimaryFee)
+	cobra.CheckErr(err)
+	secondaryFee, err := parseBigInt(icttSendSecondaryFee)
+	cobra.CheckErr(err)
+	plan := &icttTransferPlan{}
+	if icttSendDestinationRPCEndpoint != "" {
+		plan.destinationClient, err = ethclient.Dial(icttSendDestinationRPCEndpoint)
+		cobra.CheckErr(err)
+	}
+
+	// A TokenRemote is the token it transfers.
+	feeTokenAddress := transferrerAddress
+	if kind.IsHome() {
+		home, err := tokenhome.NewTokenHome(transferrerAddress, c)
+		cobra.CheckErr(err)
+		feeTokenAddress, err = home.GetTokenAddress(&bind.CallOpts{Context: ctx})
+		cobra.CheckErr(err)
+	}
+	if icttSendFeeTokenAddress != "" {
+		feeTokenAddress = common.HexToAddress(icttSendFeeTokenAddress)
+	}
+
+	if !kind.IsHome() && icttSendHomeRPCEndpoint != "" {
+		homeClient, err := ethclient.Dial(icttSendHomeRPCEndpoint)
+		cobra.CheckErr(err)
+		planner := icttUtils.NewRoutePlanner(c, homeClient, defaultNumSigners)
+		if plan.destinationClient != nil {
+			planner.DestinationBackend = plan.destinationClient
+		}
+		route, err := planner.Plan(ctx, &icttUtils.RouteRequest{
+			SourceAddress:           transferrerAddress,
+			DestinationBlockchainID: destinationBlockchainID,
+			DestinationAddress:      common.HexToAddress(icttSendDestinationAddress),
+			Recipient:               recipient,
+			MultiHopFallback:        common.HexToAddress(icttSendMultiHopFallback),
+			PrimaryFeeTokenAddress:  feeTokenAddress,
+			PrimaryFee:              primaryFee,
+			SecondaryFee:            secondaryFee,
+			Amount:                  amount,
+		})
+		cobra.CheckErr(err)
+		logger.Info(
+			"Planned route",
+			zap.Stringer("homeAmount", route.HomeAmount),
+			zap.Stringer("homeFee", route.HomeFee),
+			zap.Stringer("destinationAmount", route.DestinationAmount),
+			zap.Stringer("sourceDust", route.SourceDust),
+			zap.Stringer("destinationDust", route.DestinationDust),
+		)
+		plan.input, plan.multiHop, plan.destinationKind = route.Input, route.MultiHop, route.DestinationKind
+		plan.destinationAmount = route.DestinationAmount
+		// The planner detects the TokenHome of a single-hop transfer on its own chain.
+		icttSendResolveDestinationKind(plan, !plan.multiHop || plan.destinationClient != nil)
+		return plan
+	}
+
+	plan.input = tokenremote.SendTokensInput{
+		DestinationBlockchainID:            destinationBlockchainID,
+		DestinationTokenTransferrerAddress: common.HexToAddress(icttSendDestinationAddress),
+		Recipient:                          recipient,
+		PrimaryFeeTokenAddress:             feeTokenAddress,
+		PrimaryFee:                         primaryFee,
+		SecondaryFee:                       new(big.Int),
+	}
+	if kind.IsHome() {
+		if icttSendDestinationAddress == "" {
+			cobra.CheckErr(fmt.Errorf("--destination-address is required to send from a TokenHome"))
+		}
+		home, err := tokenhome.NewTokenHome(transferrerAddress, c)
+		cobra.CheckErr(err)
+		settings, err := home.GetRemoteTokenTransferrerSettings(
+			&bind.CallOpts{Context: ctx}, destinationBlockchainID, plan.input.DestinationTokenTransferrerAddress,
+		)
+		cobra.CheckErr(err)
+		plan.destinationAmount, err = tokenScalingUtils.ApplyTokenScale(
+			settings.TokenMultiplier, settings.MultiplyOnRemote, amount,
+		)
+		cobra.CheckErr(err)
+	} else {
+		remote, err := icttUtils.InspectTokenRemote(ctx, c, transferrerAddress)
+		cobra.CheckErr(err)
+		plan.multiHop = destinationBlockchainID != remote.TokenHomeBlockchainID
+		if !plan.multiHop {
+			plan.input.DestinationTokenTransferrerAddress = remote.TokenHomeAddress
+			plan.destinationAmount, err = tokenScalingUtils.RemoveTokenScale(
+				remote.TokenMultiplier, remote.MultiplyOnRemote, amount,
+			)
+			cobra.CheckErr(err)
+		} else {
+			if icttSendDestinationAddress == "" {
+				cobra.CheckErr(fmt.Errorf("--destination-address or --home-rpc is required for multi-hop transfers"))
+			}
+			plan.input.SecondaryFee = secondaryFee
+			plan.input.MultiHopFallback = recipient
+			if icttSendMultiHopFallback != "" {
+				plan.input.MultiHopFallback = common.HexToAddress(icttSendMultiHopFallback)
+			}
+		}
+	}
+
+	if plan.destinationClient != nil {
+		plan.destinationKind, err = icttUtils.DetectTransferrerKind(
+			ctx, plan.destinationClient, plan.input.DestinationTokenTransferrerAddress,
+		)
+		cobra.CheckErr(err)
+	}
+	icttSendResolveDestinationKind(plan, plan.destinationClient != nil)
+	return plan
+}
+
+// icttSendResolveDestinationKind sets the destination kind of [plan] to --destination-kind if it was not
+// [detected], and otherwise checks that the detected kind is the one given. icttSendPreRunE requires
+// --destination-rpc without --destination-kind, so the kind is known either way.
+func icttSendResolveDestinationKind(plan *icttTransferPlan, detected bool) {
+	if icttSendDestinationKind == "" {
+		return
+	}
+	var kind icttUtils.TransferrerKind
+	cobra.CheckErr(kind.UnmarshalText([]byte(icttSendDestinationKind)))
+	if !detected {
+		plan.destinationKind = kind
+		return
+	}
+	if plan.destinationKind != kind {
+		cobra.CheckErr(fmt.Errorf("destination token transferrer %s is a %s, not a %s",
+			plan.input.DestinationTokenTransferrerAddress.Hex(), plan.destinationKind, kind))
+	}
+}
+
+// icttSendSimulateCall simulates the destination transferrer's call to the recipient contract with the
+// ABI given with --recipient-abi, and fails the command if it would fail.
+func icttSendSimulateCall(
+	ctx context.Context,
+	cmd *cobra.Command,
+	c ethclient.Client,
+	kind icttUtils.TransferrerKind,
+	transferrerAddress common.Address,
+	sender common.Address,
+	plan *icttTransferPlan,
+	input *tokenremote.SendAndCallInput,
+) {
+	if plan.destinationAmount == nil {
+		cobra.CheckErr(fmt.Errorf("--home-rpc is required to simulate the call of a multi-hop transfer"))
+	}
+	recipientABI, err := loadABI(icttSendRecipientABIPath)
+	cobra.CheckErr(err)
+
+	// The source transferrer's blockchain ID is the origin of both hops of a multi-hop transfer.
+	opts := &bind.CallOpts{Context: ctx}
+	sourceBlockchainID := icttTransferrerBlockchainID(ctx, c, kind, transferrerAddress)
+	simulation := &icttUtils.RecipientCallSimulation{
+		RecipientABI:                  recipientABI,
+		DestinationKind:               plan.destinationKind,
+		DestinationAddress:            input.DestinationTokenTransferrerAddress,
+		SourceBlockchainID:            sourceBlockchainID,
+		OriginTokenTransferrerAddress: transferrerAddress,
+		OriginSenderAddress:           sender,
+		RecipientContract:             input.RecipientContract,
+		RecipientPayload:              input.RecipientPayload,
+		RecipientGasLimit:             input.RecipientGasLimit.Uint64(),
+		Amount:                        plan.destinationAmount,
+	}
+	if plan.destinationKind == icttUtils.ERC20TokenHomeKind {
+		home, err := tokenhome.NewTokenHome(input.DestinationTokenTransferrerAddress, plan.destinationClient)
+		cobra.CheckErr(err)
+		simulation.TokenAddress, err = home.GetTokenAddress(opts)
+		cobra.CheckErr(err)
+	}
+	result, err := icttUtils.SimulateRecipientCall(ctx, plan.destinationClient.Client(), simulation)
+	cobra.CheckErr(err)
+	if result.Call != nil {
+		cmd.Println("Recipient payload: " + result.Call.String())
+	}
+	if !result.TokensProvided {
+		logger.Warn("Simulated the recipient call without the transferred tokens, since the token's storage was not found")
+	}
+	if !result.Success {
+		cobra.CheckErr(fmt.Errorf("simulated recipient call failed: %s", result.RevertReason))
+	}
+	logger.Info("Simulated recipient call succeeded")
+}
+
+// icttTransferrerBlockchainID returns the blockchain ID of the token transferrer at [transferrerAddress].
+func icttTransferrerBlockchainID(
+	ctx context.Context,
+	c ethclient.Client,
+	kind icttUtils.TransferrerKind,
+	transferrerAddress common.Address,
+) ids.ID {
+	opts := &bind.CallOpts{Context: ctx}
+	if kind.IsHome() {
+		home, err := tokenhome.NewTokenHome(transferrerAddress, c)
+		cobra.CheckErr(err)
+		blockchainID, err := home.GetBlockchainID(opts)
+		cobra.CheckErr(err)
+		return blockchainID
+	}
+	remote, err := tokenremote.NewTokenRemote(transferrerAddress, c)
+	cobra.CheckErr(err)
+	blockchainID, err := remote.GetBlockchainID(opts)
+	cobra.CheckErr(err)
+	return blockchainID
+}
+
+// icttSendEstimateRequiredGasLimit estimates the required gas limit of sending [amount] as planned by
+// [plan], with the sendAndCall [callInput] if it is not nil. The destination transferrer's receipt of
+// the message is estimated on --destination-rpc, as delivered by --destination-teleporter-address.
+// The required gas limit of a multi-hop transfer is for the second hop, which the TokenHome sends.
+func icttSendEstimateRequiredGasLimit(
+	ctx context.Context,
+	c ethclient.Client,
+	kind icttUtils.TransferrerKind,
+	transferrerAddress common.Address,
+	plan *icttTransferPlan,
+	amount *big.Int,
+	callInput *tokenremote.SendAndCallInput,
+	sender common.Address,
+) *big.Int {
+	sourceBlockchainID := icttTransferrerBlockchainID(ctx, c, kind, transferrerAddress)
+	messageBlockchainID, messageSender := sourceBlockchainID, transferrerAddress
+	messageAmount := plan.destinationAmount
+	switch {
+	case plan.multiHop:
+		if messageAmount == nil {
+			cobra.CheckErr(fmt.Errorf("--home-rpc is required to estimate the gas limit of a multi-hop transfer"))
+		}
+		remote, err := icttUtils.InspectTokenRemote(ctx, c, transferrerAddress)
+		cobra.CheckErr(err)
+		messageBlockchainID, messageSender = remote.TokenHomeBlockchainID, remote.TokenHomeAddress
+	case !kind.IsHome():
+		// A TokenRemote sends its TokenHome the amount in its own token's scale.
+		messageAmount = amount
+	}
+
+	var message []byte
+	var err error
+	if callInput == nil {
+		message, err = itokentransferrer.PackTransferrerMessage(
+			itokentransferrer.SingleHopSend,
+			&itokentransferrer.SingleHopSendMessage{Recipient: plan.input.Recipient, Amount: messageAmount},
+		)
+	} else {
+		message, err = itokentransferrer.PackTransferrerMessage(
+			itokentransferrer.SingleHopCall,
+			&itokentransferrer.SingleHopCallMessage{
+				SourceBlockchainID:            sourceBlockchainID,
+				OriginTokenTransferrerAddress: transferrerAddress,
+				OriginSenderAddress:           sender,
+				RecipientContract:             callInput.RecipientContract,
+				Amount:                        messageAmount,
+				RecipientPayload:              callInput.RecipientPayload,
+				RecipientGasLimit:             callInput.RecipientGasLimit,
+				FallbackRecipient:             callInput.FallbackRecipient,
+			},
+		)
+	}
+	cobra.CheckErr(err)
+	requiredGasLimit, err := gasUtils.EstimateRequiredGasLimit(
+		ctx,
+		plan.destinationClient,
+		common.HexToAddress(icttSendDestinationTeleporterAddress),
+		plan.input.DestinationTokenTransferrerAddress,
+		messageBlockchainID,
+		messageSender,
+		message,
+		icttSendGasMarginPercentage,
+	)
+	cobra.CheckErr(err)
+	logger.Info("Estimated required gas limit", zap.Stringer("requiredGasLimit", requiredGasLimit))
+	return requiredGasLimit
+}
+
+// loadABI reads a contract ABI from the JSON file at [path], which is either an ABI or a compiler
+// artifact with an "abi" field.
+func loadABI(path string) (*abi.ABI, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var artifact struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if json.Unmarshal(data, &artifact) == nil && len(artifact.ABI) != 0 {
+		data = artifact.ABI
+	}
+	contractABI, err := abi.JSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ABI in %s: %w", path, err)
+	}
+	return &contractABI, nil
+}
+
+func icttDecodeCallRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	c, err := ethclient.Dial(icttRPCEndpoint)
+	cobra.CheckErr(err)
+	var methods []abi.Method
+	if icttDecodeCallSignature != "" {
+		method, err := icttUtils.ParseMethodSignature(icttDecodeCallSignature)
+		cobra.CheckErr(err)
+		methods = append(methods, method)
+	}
+	if icttDecodeRecipientABIPath != "" {
+		recipientABI, err := loadABI(icttDecodeRecipientABIPath)
+		cobra.CheckErr(err)
+		methods = append(methods, icttUtils.ABIMethods(recipientABI)...)
+	}
+
+	receipt, err := c.TransactionReceipt(ctx, common.HexToHash(args[0]))
+	cobra.CheckErr(err)
+	messages := icttUtils.FindCallMessages(receipt)
+	if len(messages) == 0 {
+		cobra.CheckErr(fmt.Errorf("no sendAndCall messages in transaction %s", args[0]))
+	}
+	for i, message := range messages {
+		if i > 0 {
+			cmd.Println()
+		}
+		cmd.Println(message.MessageType.String() + ": " + message.TeleporterMessageID.String())
+		cmd.Println("  To: " + message.DestinationAddress.Hex() + " on " + message.DestinationBlockchainID.String())
+		if message.MultiHop != nil {
+			cmd.Println("  Final destination: " + message.MultiHop.DestinationTokenTransferrerAddress.Hex() +
+				" on " + ids.ID(message.MultiHop.DestinationBlockchainID).String())
+			cmd.Println("  Secondary fee: " + message.MultiHop.SecondaryFee.String())
+			cmd.Println("  Multi-hop fallback: " + message.MultiHop.MultiHopFallback.Hex())
+		}
+		cmd.Println("  Origin sender: " + message.OriginSenderAddress.Hex())
+		cmd.Println("  Recipient contract: " + message.RecipientContract.Hex())
+		cmd.Println("  Amount: " + message.Amount.String())
+		cmd.Println("  Recipient gas limit: " + message.RecipientGasLimit.String())
+		cmd.Println("  Fallback recipient: " + message.FallbackRecipient.Hex())
+		cmd.Println("  Recipient payload: " + hexutil.Encode(message.RecipientPayload))
+		if len(methods) == 0 {
+			continue
+		}
+		call, err := icttUtils.DecodeRecipientPayload(message.RecipientPayload, methods...)
+		if err != nil {
+			cmd.Println("  Decoded call: " + err.Error())
+			continue
+		}
+		cmd.Println("  Decoded call: " + call.String())
+	}
+}
+
+func icttDeployRemoteRun(cmd *cobra.Command, args []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), icttDeployTimeout)
+	defer cancel()
+	spec, err := readRemoteSpec(icttDeploySpecPath)
+	cobra.CheckErr(err)
+	statePath := icttDeployStatePath
+	if statePath == "" {
+		statePath = strings.TrimSuffix(icttDeploySpecPath, ".json") + ".state.json"
+	}
+	deployment := &icttUtils.RemoteDeployment{}
+	data, err := os.ReadFile(statePath)
+	switch {
+	case err == nil:
+		cobra.CheckErr(json.Unmarshal(data, deployment))
+		logger.Info("Resuming deployment", zap.String("state", statePath))
+	case !os.IsNotExist(err):
+		cobra.CheckErr(err)
+	}
+
+	key, err := parsePrivateKey(icttDeployPrivateKey)
+	cobra.CheckErr(err)
+	newSender := func(rpcURL string) *icttUtils.TokenSender {
+		c, err := ethclient.Dial(rpcURL)
+		cobra.CheckErr(err)
+		opts, err := newTransactor(ctx, c, key)
+		cobra.CheckErr(err)
+		return icttUtils.NewTokenSender(c, opts, func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+			return waitForSuccess(ctx, c, tx)
+		})
+	}
+	deployer := icttUtils.NewRemoteDeployer(newSender(icttRPCEndpoint), newSender(icttDeployHomeRPCEndpoint))
+	deployer.Save = func(deployment *icttUtils.RemoteDeployment) error {
+		data, err := json.MarshalIndent(deployment, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(statePath, data, 0o600)
+	}
+
+	logger.Info(
+		"Deploying TokenRemote",
+		zap.Stringer("kind", spec.Kind),
+		zap.Bool("upgradeable", spec.Upgradeable),
+		zap.Stringer("tokenHomeAddress", spec.TokenHomeAddress),
+	)
+	cobra.CheckErr(deployer.Deploy(ctx, spec, deployment))
+
+	cmd.Println("TokenRemote: " + deployment.RemoteAddress.Hex())
+	if spec.Upgradeable {
+		cmd.Println("Implementation: " + deployment.ImplementationAddress.Hex())
+		cmd.Println("ProxyAdmin: " + deployment.ProxyAdminAddress.Hex())
+	}
+	cmd.Println("Remote Blockchain ID: " + deployment.RemoteBlockchainID.String())
+	cmd.Printf("Registered: %t\n", deployment.Registered)
+	cmd.Printf("Collateralized: %t\n", deployment.Collateralized)
+}
+
+func icttReportBurnedFeesRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	remoteAddress := common.HexToAddress(args[0])
+	key, err := parsePrivateKey(icttKeeperPrivateKey)
+	cobra.CheckErr(err)
+	remoteClient, err := ethclient.Dial(icttRPCEndpoint)
+	cobra.CheckErr(err)
+	homeClient, err := ethclient.Dial(icttKeeperHomeRPCEndpoint)
+	cobra.CheckErr(err)
+	kind, err := icttUtils.DetectTransferrerKind(ctx, remoteClient, remoteAddress)
+	cobra.CheckErr(err)
+	if kind != icttUtils.NativeTokenRemoteKind {
+		cobra.CheckErr(fmt.Errorf("%s is a %s, not a NativeTokenRemote", remoteAddress.Hex(), kind))
+	}
+
+	opts, err := newTransactor(ctx, remoteClient, key)
+	cobra.CheckErr(err)
+	sender := icttUtils.NewTokenSender(remoteClient, opts,
+		func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+			return waitForSuccess(ctx, remoteClient, tx)
+		},
+	)
+	keeper := icttUtils.NewBurnedFeesKeeper(
+		remoteClient, sender, remoteAddress, homeClient, common.HexToAddress(icttKeeperHomeTeleporterAddress),
+	)
+	if icttKeeperThreshold != "" {
+		keeper.Threshold, err = parseBigInt(icttKeeperThreshold)
+		cobra.CheckErr(err)
+	}
+	keeper.Interval = icttKeeperInterval
+	keeper.DeliveryTimeout = icttKeeperDeliveryTimeout
+	keeper.GasMarginPercentage = icttKeeperGasMarginPercentage
+	keeper.MaxBlockRange = icttMaxBlockRange
+	if icttKeeperStatePath != "" {
+		data, err := os.ReadFile(icttKeeperStatePath)
+		switch {
+		case err == nil:
+			var pending []*icttUtils.BurnedFeesReport
+			cobra.CheckErr(json.Unmarshal(data, &pending))
+			keeper.Resume(pending)
+			logger.Info("Resuming pending reports", zap.String("state", icttKeeperStatePath), zap.Int("reports", len(pending)))
+		case !os.IsNotExist(err):
+			cobra.CheckErr(err)
+		}
+		keeper.Save = func(pending []*icttUtils.BurnedFeesReport) error {
+			data, err := json.MarshalIndent(pending, "", "  ")
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(icttKeeperStatePath, data, 0o600)
+		}
+	}
+
+	keeper.Run(ctx, icttKeeperPollInterval, func(check *icttUtils.BurnedFeesCheck, err error) {
+		if err != nil {
+			logger.Error("Failed to check burned transaction fees", zap.Error(err))
+			return
+		}
+		logBurnedFeesCheck(check)
+	})
+}
+
+func logBurnedFeesCheck(check *icttUtils.BurnedFeesCheck) {
+	for _, report := range check.Processed {
+		logger.Info(
+			"Burned transaction fees report executed",
+			zap.Stringer("teleporterMessageID", report.Hop.TeleporterMessageID),
+			zap.Stringer("executionTxHash", report.Hop.ExecutionTxHash),
+		)
+	}
+	if report := check.Report; report != nil {
+		logger.Info(
+			"Reported burned transaction fees",
+			zap.Stringer("teleporterMessageID", report.Hop.TeleporterMessageID),
+			zap.Stringer("txHash", report.Hop.SendTxHash),
+			zap.Stringer("feesBurned", report.FeesBurned),
+			zap.Stringer("reward", check.State.Reward),
+			zap.Stringer("requiredGasLimit", report.RequiredGasLimit),
+		)
+	}
+	for _, report := range check.Overdue {
+		logger.Error(
+			"Burned transaction fees report not executed by the TokenHome",
+			zap.Stringer("teleporterMessageID", report.Hop.TeleporterMessageID),
+			zap.Stringer("txHash", report.Hop.SendTxHash),
+			zap.Time("reportedAt", report.ReportedAt),
+			zap.Bool("delivered", report.Hop.Delivered),
+		)
+	}
+	logger.Info(
+		"Checked burned transaction fees",
+		zap.Stringer("unreported", check.State.Unreported),
+		zap.Int("pendingReports", len(check.Pending)),
+	)
+}
+
+func printInvariantReport(cmd *cobra.Command, report *icttUtils.InvariantReport) {
+	cmd.Println("TokenHome: " + report.Home.Address.Hex())
+	cmd.Println("Token balance: " + report.Home.TokenBalance.String())
+	cmd.Println("Required balance: " + report.RequiredBalance.String())
+	for _, supply := range report.Remotes {
+		cmd.Println()
+		cmd.Println("Remote: " + supply.Remote.Address.Hex())
+		cmd.Println("  Blockchain ID: " + supply.Remote.BlockchainID.String())
+		cmd.Println("  Transferred balance: " + supply.Remote.TransferredBalance.String())
+		if !supply.Checked() {
+			cmd.Println("  Not checked, no --remote-rpc for its blockchain ID")
+			continue
+		}
+		if supply.Native {
+			cmd.Println("  Total native asset supply: " + supply.Supply.String())
+			cmd.Println("  Total minted: " + supply.TotalMinted.String())
+		} else {
+			cmd.Println("  Total supply: " + supply.Supply.String())
+		}
+		cmd.Println("  Max supply: " + supply.MaxSupply.String())
+		cmd.Println("  Pending drift: " + supply.PendingDrift.String())
+	}
+	cmd.Println()
+	cmd.Printf("Alerts: %d\n", len(report.Alerts))
+	for _, alert := range report.Alerts {
+		cmd.Println("  " + alert.String())
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(icttCmd)
+	icttCmd.AddCommand(icttHomeCmd, icttRemoteCmd, icttCheckCmd, icttSendCmd, icttTrackCmd, icttDecodeCallCmd,
+		icttDeployRemoteCmd, icttReportBurnedFeesCmd)
+	icttCmd.PersistentFlags().StringVar(&icttRPCEndpoint, "rpc", "",
+		"RPC endpoint of the chain the contract is deployed on")
+	cobra.CheckErr(icttCmd.MarkPersistentFlagRequired("rpc"))
+	for _, cmd := range []*cobra.Command{icttHomeCmd, icttCheckCmd} {
+		cmd.Flags().Uint64Var(&icttFromBlock, "from-block", 0, "Block to start scanning for registered remotes from")
+		cmd.Flags().Uint64Var(&icttMaxBlockRange, "max-block-range", 0,
+			"Maximum number of blocks per log query. Unlimited if zero")
+	}
+	icttCheckCmd.Flags().StringToStringVar(&icttRemoteRPCs, "remote-rpc", nil,
+		"RPC endpoint of a remote's chain, as BLOCKCHAIN_ID=RPC_URL. May be repeated")
+	icttTrackCmd.Flags().StringToStringVar(&icttChainRPCs, "chain-rpc", nil,
+		"RPC endpoint of a chain the transfer passes through, as BLOCKCHAIN_ID=RPC_URL. May be repeated")
+	icttTrackCmd.Flags().Uint64Var(&icttMaxBlockRange, "max-block-range", 0,
+		"Maximum number of blocks per log query. Unlimited if zero")
+	icttCheckCmd.Flags().DurationVar(&icttCheckInterval, "interval", 0,
+		"Interval to check the invariants at. Checks once if zero")
+
+	icttSendCmd.Flags().StringVar(&icttSendPrivateKey, "private-key", "", "Hex encoded private key of the sender")
+	icttSendCmd.Flags().StringVar(&icttSendDestinationBlockchainID, "destination-blockchain-id", "",
+		"CB58 encoded blockchain ID of the destination chain")
+	icttSendCmd.Flags().StringVar(&icttSendRecipient, "recipient", "",
+		"Address of the recipient, or of the recipient contract with --call")
+	icttSendCmd.Flags().StringVar(&icttSendAmount, "amount", "", "Amount to send, in the sending transferrer's token")
+	icttSendCmd.Flags().StringVar(&icttSendDestinationAddress, "destination-address", "",
+		"Address of the destination token transferrer")
+	icttSendCmd.Flags().StringVar(&icttSendHomeRPCEndpoint, "home-rpc", "",
+		"RPC endpoint of the TokenHome's chain, used to check the route of a transfer from a TokenRemote")
+	icttSendCmd.Flags().StringVar(&icttSendDestinationRPCEndpoint, "destination-rpc", "",
+		"RPC endpoint of the destination chain, used to detect the destination token transferrer")
+	icttSendCmd.Flags().StringVar(&icttSendDestinationKind, "destination-kind", "",
+		"Kind of the destination token transferrer, such as NativeTokenRemote, if --destination-rpc is not set")
+	icttSendCmd.Flags().StringVar(&icttSendFeeTokenAddress, "fee-token", "",
+		"Address of the token the primary fee is paid in. Defaults to the transferred token")
+	icttSendCmd.Flags().StringVar(&icttSendPrimaryFee, "primary-fee", "0", "Fee paid to the relayer of the first hop")
+	icttSendCmd.Flags().StringVar(&icttSendSecondaryFee, "secondary-fee", "0",
+		"Fee paid to the relayer of the second hop of a multi-hop transfer, in the transferred token")
+	icttSendCmd.Flags().Uint64Var(&icttSendRequiredGasLimit, "required-gas-limit", 0,
+		"Gas limit required on the destination. Defaults to the gas-utils limit for the destination")
+	icttSendCmd.Flags().BoolVar(&icttSendEstimateGas, "estimate-gas", false,
+		"Estimate the required gas limit on --destination-rpc instead of using the gas-utils limit")
+	icttSendCmd.Flags().StringVar(&icttSendDestinationTeleporterAddress, "destination-teleporter-address", "",
+		"Address of the TeleporterMessenger that delivers the transfer, used with --estimate-gas")
+	icttSendCmd.Flags().Uint64Var(&icttSendGasMarginPercentage, "gas-margin",
+		gasUtils.DefaultRequiredGasLimitMarginPercentage, "Percentage added to the estimated required gas limit")
+	icttSendCmd.Flags().StringVar(&icttSendMultiHopFallback, "multi-hop-fallback", "",
+		"Address that receives the tokens on the TokenHome's chain if a multi-hop transfer fails. "+
+			"Defaults to the recipient")
+	icttSendCmd.Flags().StringVar(&icttSendCallSignature, "call", "",
+		"Signature of the method the recipient payload calls, such as \"swap(address,uint256)\". "+
+			"Sends the tokens to the recipient contract and calls it")
+	icttSendCmd.Flags().StringArrayVar(&icttSendCallArgs, "args", nil,
+		"Argument of the --call method, repeated for each argument. Arrays and tuples are JSON arrays")
+	icttSendCmd.Flags().BytesHexVar(&icttSendRecipientPayload, "recipient-payload", []byte{},
+		"Hex encoded payload to send the tokens to the recipient contract and call it with, instead of --call")
+	icttSendCmd.Flags().Uint64Var(&icttSendRecipientGasLimit, "recipient-gas-limit", 0,
+		"Gas limit of the call to the recipient contract")
+	icttSendCmd.Flags().StringVar(&icttSendRecipientABIPath, "recipient-abi", "",
+		"ABI file of the recipient contract. Simulates the call to it on --destination-rpc before sending")
+	icttSendCmd.Flags().StringVar(&icttSendFallbackRecipient, "fallback-recipient", "",
+		"Address that receives the tokens if the call to the recipient contract fails. Defaults to the sender")
+	for _, flag := range []string{"private-key", "destination-blockchain-id", "recipient", "amount"} {
+		cobra.CheckErr(icttSendCmd.MarkFlagRequired(flag))
+	}
+
+	icttDecodeCallCmd.Flags().StringVar(&icttDecodeCallSignature, "call", "",
+		"Signature of the method to decode the recipient payloads as, such as \"swap(address,uint256)\"")
+	icttDecodeCallCmd.Flags().StringVar(&icttDecodeRecipientABIPath, "recipient-abi", "",
+		"ABI file of the recipient contract, whose methods the recipient payloads are decoded as")
+
+	icttDeployRemoteCmd.Flags().StringVar(&icttDeployPrivateKey, "private-key", "",
+		"Hex encoded private key of the deployer, which is funded on both chains")
+	icttDeployRemoteCmd.Flags().StringVar(&icttDeployHomeRPCEndpoint, "home-rpc", "",
+		"RPC endpoint of the TokenHome's chain")
+	icttDeployRemoteCmd.Flags().StringVar(&icttDeploySpecPath, "spec", "", "JSON file describing the TokenRemote")
+	icttDeployRemoteCmd.Flags().StringVar(&icttDeployStatePath, "state", "",
+		"JSON file the deployment's progress is saved to and resumed from. Defaults to SPEC.state.json")
+	icttDeployRemoteCmd.Flags().DurationVar(&icttDeployTimeout, "timeout", 10*time.Minute,
+		"Time to wait for the deployment, including the delivery of the registration message")
+	for _, flag := range []string{"private-key", "home-rpc", "spec"} {
+		cobra.CheckErr(icttDeployRemoteCmd.MarkFlagRequired(flag))
+	}
+
+	icttReportBurnedFeesCmd.Flags().StringVar(&icttKeeperPrivateKey, "private-key", "",
+		"Hex encoded private key of the account that sends the reports")
+	icttReportBurnedFeesCmd.Flags().StringVar(&icttKeeperHomeRPCEndpoint, "home-rpc", "",
+		"RPC endpoint of the TokenHome's chain")
+	icttReportBurnedFeesCmd.Flags().StringVar(&icttKeeperHomeTeleporterAddress, "home-teleporter-address", "",
+		"Address of the TeleporterMessenger that delivers reports to the TokenHome")
+	icttReportBurnedFeesCmd.Flags().StringVar(&icttKeeperThreshold, "threshold", "",
+		"Unreported burned fees, in the native token, at which a report is sent")
+	icttReportBurnedFeesCmd.Flags().DurationVar(&icttKeeperInterval, "interval", 0,
+		"Time after the previous report at which a report is sent, if there are fees to report")
+	icttReportBurnedFeesCmd.Flags().DurationVar(&icttKeeperPollInterval, "poll-interval", time.Minute,
+		"Interval to check the burned fees and the delivery of reports at")
+	icttReportBurnedFeesCmd.Flags().DurationVar(&icttKeeperDeliveryTimeout, "delivery-timeout", 30*time.Minute,
+		"Time after which a report the TokenHome has not executed is logged as an error. Never if zero")
+	icttReportBurnedFeesCmd.Flags().Uint64Var(&icttKeeperGasMarginPercentage, "gas-margin",
+		gasUtils.DefaultRequiredGasLimitMarginPercentage, "Percentage added to the estimated required gas limit")
+	icttReportBurnedFeesCmd.Flags().Uint64Var(&icttMaxBlockRange, "max-block-range", 0,
+		"Maximum number of blocks per log query. Unlimited if zero")
+	icttReportBurnedFeesCmd.Flags().StringVar(&icttKeeperStatePath, "state", "",
+		"JSON file the pending reports are saved to and resumed from")
+	for _, flag := range []string{"private-key", "home-rpc", "home-teleporter-address"} {
+		cobra.CheckErr(icttReportBurnedFeesCmd.MarkFlagRequired(flag))
+	}
+}
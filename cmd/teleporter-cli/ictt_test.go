@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestICTTCmd(t *testing.T) {
+	specDir := t.TempDir()
+	writeSpec := func(name string, spec string) string {
+		path := filepath.Join(specDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(spec), 0o600))
+		return path
+	}
+	nativeSpecPath := writeSpec("native.json", `{"kind": "NativeTokenRemote", `+
+		`"teleporterRegistryAddress": "0x0123456789abcdef0123456789abcdef01234567", `+
+		`"tokenHomeAddress": "0x0123456789abcdef0123456789abcdef01234567"}`)
+	unknownFieldSpecPath := writeSpec("unknown.json", `{"kind": "ERC20TokenRemote", "tokenHome": "0x01"}`)
+
+	var tests = []struct {
+		name string
+		args []string
+		err  error
+		out  string
+	}{
+		{
+			name: "home no rpc",
+			args: []string{"ictt", "home", "0x0123456789abcdef0123456789abcdef01234567"},
+			err:  fmt.Errorf("required flag(s) \"rpc\" not set"),
+		},
+		{
+			name: "home no args",
+			args: []string{"ictt", "home", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc"},
+			err:  fmt.Errorf("accepts 1 arg(s), received 0"),
+		},
+		{
+			name: "remote invalid address",
+			args: []string{"ictt", "remote", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "invalid"},
+			err:  fmt.Errorf("invalid address \"invalid\""),
+		},
+		{
+			name: "check invalid remote blockchain ID",
+			args: []string{
+				"ictt", "check", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--remote-rpc", "invalid=http://127.0.0.1:9650/ext/bc/C/rpc",
+				"0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("invalid remote blockchain ID \"invalid\""),
+		},
+		{
+			name: "track invalid transaction hash",
+			args: []string{"ictt", "track", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "0x1234"},
+			err:  fmt.Errorf("invalid transaction hash \"0x1234\""),
+		},
+		{
+			name: "track invalid blockchain ID",
+			args: []string{
+				"ictt", "track", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--chain-rpc", "invalid=http://127.0.0.1:9650/ext/bc/C/rpc",
+				"0x" + strings.Repeat("ab", 32),
+			},
+			err: fmt.Errorf("invalid blockchain ID \"invalid\""),
+		},
+		{
+			name: "send missing flags",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("required flag(s) \"amount\", \"destination-blockchain-id\", \"private-key\""),
+		},
+		{
+			name: "send invalid destination blockchain ID",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--private-key", "0x1234", "--destination-blockchain-id", "invalid",
+				"--recipient", "0x0123456789abcdef0123456789abcdef01234567", "--amount", "1",
+				"0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("invalid destination blockchain ID"),
+		},
+		{
+			name: "send non-positive amount",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--destination-blockchain-id", "11111111111111111111111111111111LpoYY", "--amount", "0",
+				"0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("amount must be positive"),
+		},
+		{
+			name: "send without destination kind",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--amount", "1",
+				"0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("--destination-rpc or --destination-kind is required to know the destination transferrer"),
+		},
+		{
+			name: "send invalid destination kind",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--amount", "1",
+				"--destination-kind", "TokenRemote", "0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("invalid transferrer kind \"TokenRemote\""),
+		},
+		{
+			name: "send invalid call signature",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--amount", "1",
+				"--destination-kind", "NativeTokenRemote",
+				"--call", "swap(address", "0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("invalid method signature \"swap(address\""),
+		},
+		{
+			name: "send call without recipient gas limit",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--amount", "1",
+				"--call", "ping()", "0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("--recipient-gas-limit is required with --call or --recipient-payload"),
+		},
+		{
+			name: "send recipient ABI without destination RPC",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--amount", "1",
+				"--recipient-gas-limit", "100000", "--recipient-abi", "receiver.json",
+				"0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("--destination-rpc is required with --recipient-abi"),
+		},
+		{
+			name: "send call wrong number of arguments",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--amount", "1",
+				"--call", "swap(address,uint256)", "--args", "0x0123456789abcdef0123456789abcdef01234567",
+				"0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("swap(address,uint256) takes 2 arguments, got 1"),
+		},
+		{
+			name: "send call with recipient payload",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--amount", "1",
+				"--recipient-payload", "01", "0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("--call and --recipient-payload can't both be set"),
+		},
+		{
+			name: "send estimate gas with required gas limit",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--amount", "1",
+				"--estimate-gas", "--required-gas-limit", "100000", "0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("--required-gas-limit and --estimate-gas can't both be set"),
+		},
+		{
+			name: "send estimate gas without destination RPC",
+			args: []string{
+				"ictt", "send", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--amount", "1",
+				"--estimate-gas", "--required-gas-limit", "0", "0x0123456789abcdef0123456789abcdef01234567",
+			},
+			err: fmt.Errorf("--destination-rpc and --destination-teleporter-address are required with --estimate-gas"),
+		},
+		{
+			name: "decode-call invalid transaction hash",
+			args: []string{"ictt", "decode-call", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "0x1234"},
+			err:  fmt.Errorf("invalid transaction hash \"0x1234\""),
+		},
+		{
+			name: "decode-call invalid signature",
+			args: []string{
+				"ictt", "decode-call", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--call", "swap", "0x" + strings.Repeat("ab", 32),
+			},
+			err: fmt.Errorf("invalid method signature \"swap\""),
+		},
+		{
+			name: "deploy-remote missing flags",
+			args: []string{"ictt", "deploy-remote", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc"},
+			err:  fmt.Errorf("required flag(s) \"home-rpc\", \"private-key\", \"spec\" not set"),
+		},
+		{
+			name: "deploy-remote invalid spec",
+			args: []string{
+				"ictt", "deploy-remote", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--home-rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--private-key", "01", "--spec", nativeSpecPath,
+			},
+			err: fmt.Errorf("invalid spec: native asset symbol is required for a NativeTokenRemote"),
+		},
+		{
+			name: "deploy-remote unknown spec field",
+			args: []string{
+				"ictt", "deploy-remote", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--home-rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--private-key", "01",
+				"--spec", unknownFieldSpecPath,
+			},
+			err: fmt.Errorf("failed to decode spec: json: unknown field \"tokenHome\""),
+		},
+		{
+			name: "report-burned-fees missing flags",
+			args: []string{
+				"ictt", "report-burned-fees", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"0x0000000000000000000000000000000000000001",
+			},
+			err: fmt.Errorf("required flag(s) \"home-rpc\", \"home-teleporter-address\", \"private-key\" not set"),
+		},
+		{
+			name: "report-burned-fees no threshold or interval",
+			args: []string{
+				"ictt", "report-burned-fees", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--home-rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--private-key", "01",
+				"--home-teleporter-address", "0x0000000000000000000000000000000000000002",
+				"0x0000000000000000000000000000000000000001",
+			},
+			err: fmt.Errorf("--threshold or --interval is required"),
+		},
+		{
+			name: "report-burned-fees non-positive threshold",
+			args: []string{
+				"ictt", "report-burned-fees", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--home-rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--private-key", "01",
+				"--home-teleporter-address", "0x0000000000000000000000000000000000000002",
+				"--threshold", "0", "0x0000000000000000000000000000000000000001",
+			},
+			err: fmt.Errorf("threshold must be positive"),
+		},
+		{
+			name: "help",
+			args: []string{"ictt", "home", "--help"},
+			err:  nil,
+			out:  "Lists every TokenRemote registered with the TokenHome at ADDRESS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeTestCmd(t, rootCmd, tt.args...)
+			if tt.err != nil {
+				require.ErrorContains(t, err, tt.err.Error())
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, out, tt.out)
+			}
+		})
+	}
+}
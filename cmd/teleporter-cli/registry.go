@@ -0,0 +1,206 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	avalancheWarp "github.com/ava-labs/avalanchego/vms/platformvm/warp"
+	topologyUtils "github.com/ava-labs/icm-contracts/utils/topology-utils"
+	"github.com/ava-labs/subnet-evm/warp"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	registryNetworkID      uint32
+	registryChainConfigDir string
+	registryOutDir         string
+	registryQuorumNum      uint64
+)
+
+var topologyRegistryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Adds TeleporterRegistry versions with off-chain Warp messages",
+	Long: `Adds the TeleporterRegistry entries of a topology spec that are missing from the chains. A version
+is added by an addProtocolVersion transaction carrying an off-chain Warp message signed by the
+chain's validators, which only sign it once it is in their chain config:
+
+1. registry messages writes the chain config of every chain with its messages.
+2. The chain config is installed on the chain's validators, which are restarted.
+3. registry check confirms the chain's node serves the messages.
+4. registry add-versions submits the signed messages to the registries.
+
+The messages are derived from the spec, the --state file and --network-id, so every step rebuilds
+the same messages.`,
+}
+
+var topologyRegistryMessagesCmd = &cobra.Command{
+	Use:   "messages --spec FILE --network-id ID --out DIR [--chain-config-dir DIR] [--state FILE]",
+	Short: "Writes the chain configs carrying the off-chain registry messages",
+	Long: `Creates the off-chain Warp message of every TeleporterRegistry entry of the spec that is not
+registered on its chain, and writes the chain config that carries them to
+--out/BLOCKCHAIN_ID/config.json, the layout of a node's chain config directory. The config of each
+chain is read from --chain-config-dir/BLOCKCHAIN_ID/config.json if it is given, and the messages
+are added to its other fields and the off-chain messages it already has.`,
+	Args:    cobra.NoArgs,
+	PreRunE: topologyPreRunE,
+	Run:     topologyRegistryMessagesRun,
+}
+
+var topologyRegistryCheckCmd = &cobra.Command{
+	Use:   "check --spec FILE --network-id ID [--state FILE]",
+	Short: "Checks that the nodes serve the off-chain registry messages",
+	Long: `Checks that the node at the RPC endpoint of every chain serves the off-chain Warp message of
+every TeleporterRegistry entry of the spec that is not registered, which it does once its chain
+config has the message and it was restarted. Fails if a message is not served.`,
+	Args:    cobra.NoArgs,
+	PreRunE: topologyPreRunE,
+	Run:     topologyRegistryCheckRun,
+}
+
+var topologyRegistryAddVersionsCmd = &cobra.Command{
+	Use:   "add-versions --spec FILE --network-id ID --private-key KEY [--quorum PERCENT] [--state FILE]",
+	Short: "Registers the off-chain registry messages with addProtocolVersion",
+	Long: `Fetches the aggregate signature of the off-chain Warp message of every TeleporterRegistry entry of
+the spec that is not registered, and calls addProtocolVersion on the chain's registry with the
+signed message as the transaction's Warp predicate. The registry must emit AddProtocolVersion, and
+LatestVersionUpdated if the version is above its latest version. Entries that are registered are
+skipped, so running the command again resumes where it stopped.`,
+	Args:    cobra.NoArgs,
+	PreRunE: topologyRegistryAddVersionsPreRunE,
+	Run:     topologyRegistryAddVersionsRun,
+}
+
+func topologyRegistryAddVersionsPreRunE(cmd *cobra.Command, args []string) error {
+	if err := topologyPreRunE(cmd, args); err != nil {
+		return err
+	}
+	if registryQuorumNum == 0 || registryQuorumNum > 100 {
+		return fmt.Errorf("invalid quorum %d, expected a percentage from 1 to 100", registryQuorumNum)
+	}
+	return nil
+}
+
+// newRegistryTopology creates the topology of newTopology, with the Warp client of every chain's
+// node, and the registry messages of its spec.
+func newRegistryTopology(
+	ctx context.Context,
+	privateKey string,
+) (*topologyUtils.Topology, []*topologyUtils.RegistryMessage) {
+	topology, state, _ := newTopology(ctx, privateKey)
+	for _, chainSpec := range topology.Spec.Chains {
+		uri, chain, ok := strings.Cut(strings.TrimSuffix(chainSpec.RPC, "/rpc"), "/ext/bc/")
+		if !ok {
+			cobra.CheckErr(fmt.Errorf("rpc of chain %q is not a node's /ext/bc/CHAIN/rpc endpoint", chainSpec.Name))
+		}
+		client, err := warp.NewClient(uri, chain)
+		cobra.CheckErr(err)
+		topology.Chains[chainSpec.Name].Warp = client
+	}
+	messages, err := topology.RegistryMessages(ctx, state, registryNetworkID)
+	cobra.CheckErr(err)
+	return topology, messages
+}
+
+func topologyRegistryMessagesRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	_, messages := newRegistryTopology(ctx, "")
+	var chains []string
+	chainMessages := make(map[string][]*avalancheWarp.UnsignedMessage)
+	for _, message := range messages {
+		if message.Registered {
+			cmd.Printf("%s version %d: registered\n", message.Chain, message.Entry.Version)
+			continue
+		}
+		cmd.Printf("%s version %d: message %s\n", message.Chain, message.Entry.Version, message.Message.ID())
+		blockchainID := message.Message.SourceChainID.String()
+		if _, ok := chainMessages[blockchainID]; !ok {
+			chains = append(chains, blockchainID)
+		}
+		chainMessages[blockchainID] = append(chainMessages[blockchainID], message.Message)
+	}
+
+	for _, blockchainID := range chains {
+		var base []byte
+		if registryChainConfigDir != "" {
+			var err error
+			base, err = os.ReadFile(filepath.Join(registryChainConfigDir, blockchainID, "config.json"))
+			if err != nil && !os.IsNotExist(err) {
+				cobra.CheckErr(err)
+			}
+		}
+		config, err := topologyUtils.ChainConfigWithOffChainMessages(base, chainMessages[blockchainID])
+		cobra.CheckErr(err)
+		path := filepath.Join(registryOutDir, blockchainID, "config.json")
+		cobra.CheckErr(os.MkdirAll(filepath.Dir(path), 0o755))
+		cobra.CheckErr(os.WriteFile(path, config, 0o600))
+		cmd.Println("Wrote " + path)
+	}
+	cmd.Printf("Chain configs: %d\n", len(chains))
+}
+
+func topologyRegistryCheckRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	topology, messages := newRegistryTopology(ctx, "")
+	cobra.CheckErr(topology.CheckRegistryMessages(ctx, messages))
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAIN\tVERSION\tMESSAGE\tSTATUS")
+	notLive := 0
+	for _, message := range messages {
+		status := "registered"
+		switch {
+		case message.Registered:
+		case message.Live:
+			status = "live"
+		default:
+			status = "not live"
+			notLive++
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", message.Chain, message.Entry.Version, message.Message.ID(), status)
+	}
+	cobra.CheckErr(w.Flush())
+	if notLive > 0 {
+		cobra.CheckErr(fmt.Errorf("%d messages are not served by their chain's node", notLive))
+	}
+}
+
+func topologyRegistryAddVersionsRun(cmd *cobra.Command, args []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), topologyTimeout)
+	defer cancel()
+	topology, messages := newRegistryTopology(ctx, topologyPrivateKey)
+	logger.Info("Adding registry versions", zap.String("spec", topologySpecPath))
+	cobra.CheckErr(topology.AddProtocolVersions(ctx, messages, registryQuorumNum))
+	for _, message := range messages {
+		cmd.Printf("%s version %d: registered at %s\n", message.Chain, message.Entry.Version,
+			message.Entry.ProtocolAddress.Hex())
+	}
+}
+
+func init() {
+	topologyCmd.AddCommand(topologyRegistryCmd)
+	topologyRegistryCmd.AddCommand(topologyRegistryMessagesCmd, topologyRegistryCheckCmd,
+		topologyRegistryAddVersionsCmd)
+	topologyRegistryCmd.PersistentFlags().Uint32Var(&registryNetworkID, "network-id", 0,
+		"Network ID of the chains, such as 1 for Mainnet and 5 for Fuji")
+	cobra.CheckErr(topologyRegistryCmd.MarkPersistentFlagRequired("network-id"))
+	topologyRegistryMessagesCmd.Flags().StringVar(&registryOutDir, "out", "",
+		"Directory the chain configs are written to, as BLOCKCHAIN_ID/config.json")
+	topologyRegistryMessagesCmd.Flags().StringVar(&registryChainConfigDir, "chain-config-dir", "",
+		"Chain config directory of the chains' nodes, whose configs the messages are added to")
+	cobra.CheckErr(topologyRegistryMessagesCmd.MarkFlagRequired("out"))
+	topologyRegistryAddVersionsCmd.Flags().StringVar(&topologyPrivateKey, "private-key", "",
+		"Private key of the account that sends addProtocolVersion on every chain")
+	topologyRegistryAddVersionsCmd.Flags().Uint64Var(&registryQuorumNum, "quorum",
+		topologyUtils.DefaultRegistryQuorumNum, "Percentage of the chain's stake that must sign each message")
+	topologyRegistryAddVersionsCmd.Flags().DurationVar(&topologyTimeout, "timeout", 30*time.Minute,
+		"Maximum time to wait for the versions to be added")
+	cobra.CheckErr(topologyRegistryAddVersionsCmd.MarkFlagRequired("private-key"))
+}
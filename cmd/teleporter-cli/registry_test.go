@@ -0,0 +1,74 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyRegistryCmd(t *testing.T) {
+	specDir := t.TempDir()
+	specPath := filepath.Join(specDir, "spec.yaml")
+	require.NoError(t, os.WriteFile(specPath, []byte("chains:\n  - name: c\n"), 0o600))
+	rpcSpecPath := filepath.Join(specDir, "rpc.yaml")
+	require.NoError(t, os.WriteFile(rpcSpecPath,
+		[]byte("chains:\n  - name: c\n    rpc: http://127.0.0.1:9650/ext/bc/C/rpc\n"), 0o600))
+	// --spec is a persistent flag of the topology commands, so it stays set for later tests.
+	t.Cleanup(func() {
+		topologySpecPath = ""
+		topologyCmd.PersistentFlags().Lookup("spec").Changed = false
+	})
+
+	var tests = []struct {
+		name string
+		args []string
+		err  error
+		out  string
+	}{
+		{
+			name: "messages missing flags",
+			args: []string{"topology", "registry", "messages", "--spec", specPath},
+			err:  fmt.Errorf("required flag(s) \"network-id\", \"out\" not set"),
+		},
+		{
+			name: "check chain without rpc",
+			args: []string{"topology", "registry", "check", "--spec", specPath, "--network-id", "5"},
+			err:  fmt.Errorf("chain \"c\" has no rpc"),
+		},
+		{
+			name: "add-versions no private key",
+			args: []string{"topology", "registry", "add-versions", "--spec", specPath, "--network-id", "5"},
+			err:  fmt.Errorf("required flag(s) \"private-key\" not set"),
+		},
+		{
+			name: "add-versions invalid quorum",
+			args: []string{"topology", "registry", "add-versions", "--spec", rpcSpecPath, "--network-id", "5",
+				"--private-key", "01", "--quorum", "101"},
+			err: fmt.Errorf("invalid quorum 101, expected a percentage from 1 to 100"),
+		},
+		{
+			name: "help",
+			args: []string{"topology", "registry", "--help"},
+			err:  nil,
+			out:  "registry check confirms the chain's node serves the messages",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeTestCmd(t, rootCmd, tt.args...)
+			if tt.err != nil {
+				require.ErrorContains(t, err, tt.err.Error())
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, out, tt.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	validatorManagerUtils "github.com/ava-labs/icm-contracts/utils/validator-manager-utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rewardsBasisPoints         uint64
+	rewardsStakeAmount         string
+	rewardsStartTime           uint64
+	rewardsEndTime             uint64
+	rewardsUptimeSeconds       uint64
+	rewardsDelegationAmount    string
+	rewardsDelegationStartTime uint64
+	rewardsDelegationEndTime   uint64
+	rewardsDelegationFeeBips   uint16
+
+	// rewardsEstimateInput is the input read from the flags by rewardsEstimatePreRunE.
+	rewardsEstimateInput *validatorManagerUtils.RewardEstimateInput
+)
+
+var rewardsCmd = &cobra.Command{
+	Use:   "rewards",
+	Short: "Projects staking rewards",
+	Long:  `Projects the staking rewards of a NativeTokenStakingManager or ERC20TokenStakingManager.`,
+}
+
+var rewardsEstimateCmd = &cobra.Command{
+	Use: "estimate --reward-basis-points BIPS --stake-amount AMOUNT --start-time TIME --end-time TIME " +
+		"--uptime-seconds SECONDS",
+	Short: "Estimates the rewards of a validation and its delegation",
+	Long: `Estimates the rewards a PoS validator manager pays when a validation ends, as computed by an
+ExampleRewardCalculator deployed with --reward-basis-points, without connecting to a chain.
+
+The validation stakes --stake-amount, the value of its starting weight, from --start-time until
+--end-time, both Unix timestamps, with --uptime-seconds of uptime. Nothing is rewarded if the uptime
+is below 80% of the validation. With --delegation-amount, also estimates the reward of a delegation
+to the validation from --delegation-start-time (--start-time by default) until
+--delegation-end-time, capped at and by default --end-time, and splits it into the
+--delegation-fee-bips fee paid to the validator and the delegator's reward.`,
+	Args:    cobra.NoArgs,
+	PreRunE: rewardsEstimatePreRunE,
+	Run:     rewardsEstimateRun,
+}
+
+// parseStakeAmount parses an amount flag value, which can't be negative.
+func parseStakeAmount(s string) (*big.Int, error) {
+	amount, err := parseBigInt(s)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Sign() < 0 {
+		return nil, fmt.Errorf("amount %s must not be negative", s)
+	}
+	return amount, nil
+}
+
+func rewardsEstimatePreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	stakeAmount, err := parseStakeAmount(rewardsStakeAmount)
+	if err != nil {
+		return err
+	}
+	if rewardsEndTime < rewardsStartTime {
+		return fmt.Errorf("end time %d is before start time %d", rewardsEndTime, rewardsStartTime)
+	}
+	if rewardsDelegationFeeBips > validatorManagerUtils.BipsConversionFactor {
+		return fmt.Errorf("delegation fee must be at most %d bips", validatorManagerUtils.BipsConversionFactor)
+	}
+	rewardsEstimateInput = &validatorManagerUtils.RewardEstimateInput{
+		RewardBasisPoints:   rewardsBasisPoints,
+		ValidatorStake:      stakeAmount,
+		ValidatorStartTime:  rewardsStartTime,
+		ValidatorEndTime:    rewardsEndTime,
+		UptimeSeconds:       rewardsUptimeSeconds,
+		DelegationFeeBips:   rewardsDelegationFeeBips,
+		DelegationStartTime: rewardsStartTime,
+	}
+	if rewardsDelegationAmount == "" {
+		return nil
+	}
+	rewardsEstimateInput.DelegatorStake, err = parseStakeAmount(rewardsDelegationAmount)
+	if err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("delegation-start-time") {
+		if rewardsDelegationStartTime < rewardsStartTime {
+			return fmt.Errorf("delegation start time %d is before start time %d", rewardsDelegationStartTime,
+				rewardsStartTime)
+		}
+		rewardsEstimateInput.DelegationStartTime = rewardsDelegationStartTime
+	}
+	if cmd.Flags().Changed("delegation-end-time") {
+		if rewardsDelegationEndTime < rewardsEstimateInput.DelegationStartTime {
+			return fmt.Errorf("delegation end time %d is before delegation start time %d", rewardsDelegationEndTime,
+				rewardsEstimateInput.DelegationStartTime)
+		}
+		rewardsEstimateInput.DelegationEndTime = rewardsDelegationEndTime
+	}
+	return nil
+}
+
+func rewardsEstimateRun(cmd *cobra.Command, args []string) {
+	estimate, err := validatorManagerUtils.EstimateRewards(rewardsEstimateInput)
+	cobra.CheckErr(err)
+
+	cmd.Println("Validator reward: " + estimate.ValidatorReward.String())
+	if rewardsEstimateInput.DelegatorStake == nil {
+		return
+	}
+	cmd.Println("Delegation reward: " + estimate.DelegationReward.String())
+	cmd.Println("Delegation fee: " + estimate.DelegationFee.String())
+	cmd.Println("Delegator reward: " + estimate.DelegatorReward.String())
+	total := new(big.Int).Add(estimate.ValidatorReward, estimate.DelegationFee)
+	cmd.Println("Validator reward with delegation fee: " + total.String())
+}
+
+func init() {
+	rootCmd.AddCommand(rewardsCmd)
+	rewardsCmd.AddCommand(rewardsEstimateCmd)
+	rewardsEstimateCmd.Flags().Uint64Var(&rewardsBasisPoints, "reward-basis-points", 0,
+		"Reward basis points per year of the ExampleRewardCalculator")
+	rewardsEstimateCmd.Flags().StringVar(&rewardsStakeAmount, "stake-amount", "",
+		"Amount staked by the validator, in the staking token's smallest unit")
+	rewardsEstimateCmd.Flags().Uint64Var(&rewardsStartTime, "start-time", 0, "Unix timestamp the validation starts at")
+	rewardsEstimateCmd.Flags().Uint64Var(&rewardsEndTime, "end-time", 0, "Unix timestamp the validation ends at")
+	rewardsEstimateCmd.Flags().Uint64Var(&rewardsUptimeSeconds, "uptime-seconds", 0,
+		"Uptime of the validator during the validation")
+	rewardsEstimateCmd.Flags().StringVar(&rewardsDelegationAmount, "delegation-amount", "",
+		"Amount delegated to the validator, in the staking token's smallest unit")
+	rewardsEstimateCmd.Flags().Uint64Var(&rewardsDelegationStartTime, "delegation-start-time", 0,
+		"Unix timestamp the delegation starts at. Defaults to --start-time")
+	rewardsEstimateCmd.Flags().Uint64Var(&rewardsDelegationEndTime, "delegation-end-time", 0,
+		"Unix timestamp the delegation ends at, capped at --end-time. Defaults to --end-time")
+	rewardsEstimateCmd.Flags().Uint16Var(&rewardsDelegationFeeBips, "delegation-fee-bips", 0,
+		"Delegation fee of the validator, in basis points")
+	for _, flag := range []string{"reward-basis-points", "stake-amount", "start-time", "end-time", "uptime-seconds"} {
+		cobra.CheckErr(rewardsEstimateCmd.MarkFlagRequired(flag))
+	}
+}
@@ -0,0 +1,121 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewardsCmd(t *testing.T) {
+	// A year-long validation with full uptime, at 10% a year.
+	validation := []string{
+		"rewards", "estimate", "--reward-basis-points", "1000", "--stake-amount", "2000000000000000000",
+		"--start-time", "1700000000", "--end-time", "1731536000", "--uptime-seconds", "31536000",
+	}
+	var tests = []struct {
+		name string
+		args []string
+		err  error
+		out  string
+	}{
+		{
+			name: "estimate no stake amount",
+			args: []string{
+				"rewards", "estimate", "--reward-basis-points", "1000", "--start-time", "0", "--end-time", "1",
+				"--uptime-seconds", "1",
+			},
+			err: fmt.Errorf("required flag(s) \"stake-amount\" not set"),
+		},
+		{
+			name: "estimate invalid stake amount",
+			args: append(validation, "--stake-amount", "1e18"),
+			err:  fmt.Errorf("invalid integer \"1e18\""),
+		},
+		{
+			name: "estimate negative delegation amount",
+			args: append(validation, "--delegation-amount", "-1"),
+			err:  fmt.Errorf("amount -1 must not be negative"),
+		},
+		{
+			name: "estimate end before start",
+			args: append(validation, "--end-time", "1699999999"),
+			err:  fmt.Errorf("end time 1699999999 is before start time 1700000000"),
+		},
+		{
+			name: "estimate delegation fee too high",
+			args: append(validation, "--delegation-fee-bips", "10001"),
+			err:  fmt.Errorf("delegation fee must be at most 10000 bips"),
+		},
+		{
+			name: "estimate delegation before start",
+			args: append(validation, "--delegation-amount", "1", "--delegation-start-time", "1"),
+			err:  fmt.Errorf("delegation start time 1 is before start time 1700000000"),
+		},
+		{
+			name: "estimate delegation end before delegation start",
+			args: append(validation, "--delegation-amount", "1", "--delegation-start-time", "1715768000",
+				"--delegation-end-time", "1715767999"),
+			err: fmt.Errorf("delegation end time 1715767999 is before delegation start time 1715768000"),
+		},
+		{
+			name: "estimate validation",
+			args: validation,
+			out:  "Validator reward: 200000000000000000",
+		},
+		{
+			name: "estimate delegation",
+			args: append(validation, "--delegation-amount", "1000000000000000000",
+				"--delegation-start-time", "1715768000", "--delegation-fee-bips", "250"),
+			out: "Validator reward: 200000000000000000\n" +
+				"Delegation reward: 50000000000000000\n" +
+				"Delegation fee: 1250000000000000\n" +
+				"Delegator reward: 48750000000000000\n" +
+				"Validator reward with delegation fee: 201250000000000000",
+		},
+		{
+			name: "estimate delegation ending early",
+			args: append(validation, "--delegation-amount", "1000000000000000000",
+				"--delegation-start-time", "1715768000", "--delegation-end-time", "1723652000",
+				"--delegation-fee-bips", "250"),
+			out: "Validator reward: 200000000000000000\n" +
+				"Delegation reward: 25000000000000000\n" +
+				"Delegation fee: 625000000000000\n" +
+				"Delegator reward: 24375000000000000\n" +
+				"Validator reward with delegation fee: 200625000000000000",
+		},
+		{
+			name: "help",
+			args: []string{"rewards", "estimate", "--help"},
+			err:  nil,
+			out:  "Estimates the rewards a PoS validator manager pays when a validation ends",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The flags stay set for later commands, so each case starts from their defaults.
+			t.Cleanup(func() {
+				rewardsBasisPoints, rewardsStartTime, rewardsEndTime, rewardsUptimeSeconds = 0, 0, 0, 0
+				rewardsStakeAmount, rewardsDelegationAmount = "", ""
+				rewardsDelegationStartTime, rewardsDelegationEndTime, rewardsDelegationFeeBips = 0, 0, 0
+				for _, flag := range []string{
+					"reward-basis-points", "stake-amount", "start-time", "end-time", "uptime-seconds",
+					"delegation-amount", "delegation-start-time", "delegation-end-time", "delegation-fee-bips",
+				} {
+					rewardsEstimateCmd.Flags().Lookup(flag).Changed = false
+				}
+			})
+			out, err := executeTestCmd(t, rootCmd, tt.args...)
+			if tt.err != nil {
+				require.ErrorContains(t, err, tt.err.Error())
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, out, tt.out)
+			}
+		})
+	}
+}
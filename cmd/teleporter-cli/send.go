@@ -0,0 +1,284 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	feeUtils "github.com/ava-labs/icm-contracts/utils/fee-utils"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/ethclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	sendRPCEndpoint                  string
+	sendDestinationRPCEndpoint       string
+	sendTeleporterAddress            string
+	sendDestinationTeleporterAddress string
+	sendPrivateKey                   string
+	sendDestinationBlockchainID      string
+	sendDestinationAddress           string
+	sendMessage                      []byte
+	sendRequiredGasLimit             uint64
+	sendEstimateGas                  bool
+	sendGasMarginPercentage          uint64
+	sendFeeTokenAddress              string
+	sendFeeAmount                    string
+	sendAllowedRelayers              []string
+	sendEstimateFee                  bool
+	sendFeeTokenRate                 string
+	sendPriceOracleURL               string
+	sendNumSigners                   int
+)
+
+// defaultNumSigners is the number of validator signatures assumed when estimating the relayer fee.
+const defaultNumSigners = 10
+
+var sendCmd = &cobra.Command{
+	Use: "send --rpc RPC_URL --teleporter-address CONTRACT_ADDRESS --private-key KEY " +
+		"--destination-blockchain-id ID --destination-address ADDRESS " +
+		"(--required-gas-limit GAS | --estimate-gas --destination-rpc RPC_URL)",
+	Short: "Sends a Teleporter message",
+	Long: `Sends a Teleporter message by calling sendCrossChainMessage on the source chain's
+TeleporterMessenger. The required gas limit can either be set explicitly with
+--required-gas-limit, or estimated with --estimate-gas. Estimation runs eth_estimateGas on the
+destination chain for the receiveTeleporterMessage call that TeleporterMessenger will make to the
+destination address, and adds a safety margin. If a fee amount is set, the fee token is approved
+for the TeleporterMessenger before sending.
+
+With --estimate-fee, the relayer fee is estimated from the gas a relayer spends delivering the
+message, priced with the destination chain's recent base fees, and converted to the fee token with
+either a fixed --fee-token-rate or a local --price-oracle-url. The estimate is used as the fee
+amount unless --fee-amount is set explicitly.`,
+	Args:    cobra.NoArgs,
+	PreRunE: sendPreRunE,
+	Run:     sendRun,
+}
+
+func sendPreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	if _, err := ids.FromString(sendDestinationBlockchainID); err != nil {
+		return fmt.Errorf("invalid destination blockchain ID: %w", err)
+	}
+	if !sendEstimateGas && sendRequiredGasLimit == 0 {
+		return fmt.Errorf("either --required-gas-limit or --estimate-gas must be set")
+	}
+	if sendEstimateGas && sendDestinationRPCEndpoint == "" {
+		return fmt.Errorf("--destination-rpc is required with --estimate-gas")
+	}
+	if sendEstimateFee {
+		if sendDestinationRPCEndpoint == "" || sendFeeTokenAddress == "" {
+			return fmt.Errorf("--destination-rpc and --fee-token are required with --estimate-fee")
+		}
+		if (sendFeeTokenRate == "") == (sendPriceOracleURL == "") {
+			return fmt.Errorf("exactly one of --fee-token-rate or --price-oracle-url must be set with --estimate-fee")
+		}
+		if sendFeeTokenRate != "" {
+			if _, err := feeUtils.ParseRate(sendFeeTokenRate); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sendRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	key, err := parsePrivateKey(sendPrivateKey)
+	cobra.CheckErr(err)
+	senderAddress := crypto.PubkeyToAddress(key.PublicKey)
+
+	sourceClient, err := ethclient.Dial(sendRPCEndpoint)
+	cobra.CheckErr(err)
+	teleporterAddress := common.HexToAddress(sendTeleporterAddress)
+	messenger, err := teleportermessenger.NewTeleporterMessenger(teleporterAddress, sourceClient)
+	cobra.CheckErr(err)
+
+	destinationBlockchainID, err := ids.FromString(sendDestinationBlockchainID)
+	cobra.CheckErr(err)
+	destinationAddress := common.HexToAddress(sendDestinationAddress)
+
+	requiredGasLimit := new(big.Int).SetUint64(sendRequiredGasLimit)
+	if sendEstimateGas {
+		sourceBlockchainID, err := messenger.BlockchainID(&bind.CallOpts{Context: ctx})
+		cobra.CheckErr(err)
+		destinationClient, err := ethclient.Dial(sendDestinationRPCEndpoint)
+		cobra.CheckErr(err)
+		destinationTeleporterAddress := teleporterAddress
+		if sendDestinationTeleporterAddress != "" {
+			destinationTeleporterAddress = common.HexToAddress(sendDestinationTeleporterAddress)
+		}
+
+		// The message is sent directly from the sender's account, so it is also the origin sender.
+		requiredGasLimit, err = gasUtils.EstimateRequiredGasLimit(
+			ctx,
+			destinationClient,
+			destinationTeleporterAddress,
+			destinationAddress,
+			sourceBlockchainID,
+			senderAddress,
+			sendMessage,
+			sendGasMarginPercentage,
+		)
+		cobra.CheckErr(err)
+		logger.Info("Estimated required gas limit", zap.Stringer("requiredGasLimit", requiredGasLimit))
+	}
+
+	feeAmount, err := parseBigInt(sendFeeAmount)
+	cobra.CheckErr(err)
+	feeTokenAddress := common.HexToAddress(sendFeeTokenAddress)
+	if sendEstimateFee {
+		estimate := estimateSendFee(ctx, messenger, destinationBlockchainID, feeTokenAddress, requiredGasLimit)
+		cmd.Println("Suggested fee amount: " + estimate.FeeAmount.String())
+		if !cmd.Flags().Changed("fee-amount") {
+			feeAmount = estimate.FeeAmount
+		}
+	}
+	if feeAmount.Sign() > 0 {
+		feeToken, err := exampleerc20.NewExampleERC20(feeTokenAddress, sourceClient)
+		cobra.CheckErr(err)
+		opts, err := newTransactor(ctx, sourceClient, key)
+		cobra.CheckErr(err)
+		tx, err := feeToken.Approve(opts, teleporterAddress, feeAmount)
+		cobra.CheckErr(err)
+		_, err = waitForSuccess(ctx, sourceClient, tx)
+		cobra.CheckErr(err)
+	}
+
+	allowedRelayers := make([]common.Address, 0, len(sendAllowedRelayers))
+	for _, relayer := range sendAllowedRelayers {
+		allowedRelayers = append(allowedRelayers, common.HexToAddress(relayer))
+	}
+
+	opts, err := newTransactor(ctx, sourceClient, key)
+	cobra.CheckErr(err)
+	tx, err := messenger.SendCrossChainMessage(opts, teleportermessenger.TeleporterMessageInput{
+		DestinationBlockchainID: destinationBlockchainID,
+		DestinationAddress:      destinationAddress,
+		FeeInfo: teleportermessenger.TeleporterFeeInfo{
+			FeeTokenAddress: feeTokenAddress,
+			Amount:          feeAmount,
+		},
+		RequiredGasLimit:        requiredGasLimit,
+		AllowedRelayerAddresses: allowedRelayers,
+		Message:                 sendMessage,
+	})
+	cobra.CheckErr(err)
+	receipt, err := waitForSuccess(ctx, sourceClient, tx)
+	cobra.CheckErr(err)
+
+	for _, log := range receipt.Logs {
+		event, err := messenger.ParseSendCrossChainMessage(*log)
+		if err == nil {
+			cmd.Println("Teleporter Message ID: " + ids.ID(event.MessageID).String())
+		}
+	}
+	cmd.Println("Send command ran successfully")
+}
+
+// estimateSendFee estimates the relayer fee for the message being sent, including the receipts
+// TeleporterMessenger will attach to it.
+func estimateSendFee(
+	ctx context.Context,
+	messenger *teleportermessenger.TeleporterMessenger,
+	destinationBlockchainID ids.ID,
+	feeTokenAddress common.Address,
+	requiredGasLimit *big.Int,
+) *feeUtils.FeeEstimate {
+	destinationClient, err := ethclient.Dial(sendDestinationRPCEndpoint)
+	cobra.CheckErr(err)
+
+	var oracle feeUtils.PriceOracle
+	if sendPriceOracleURL != "" {
+		oracle = feeUtils.NewHTTPPriceOracle(sendPriceOracleURL)
+	} else {
+		rate, err := feeUtils.ParseRate(sendFeeTokenRate)
+		cobra.CheckErr(err)
+		staticOracle := feeUtils.NewStaticPriceOracle()
+		staticOracle.SetRate(destinationBlockchainID, feeTokenAddress, rate)
+		oracle = staticOracle
+	}
+
+	receiptQueueSize, err := messenger.GetReceiptQueueSize(&bind.CallOpts{Context: ctx}, destinationBlockchainID)
+	cobra.CheckErr(err)
+	numReceipts := feeUtils.MaxReceiptsPerMessage
+	if receiptQueueSize.IsInt64() && receiptQueueSize.Int64() < int64(numReceipts) {
+		numReceipts = int(receiptQueueSize.Int64())
+	}
+
+	estimate, err := feeUtils.NewFeeEstimator(destinationClient, oracle).EstimateFee(
+		ctx,
+		destinationBlockchainID,
+		feeTokenAddress,
+		feeUtils.DeliveryParams{
+			NumSigners:         sendNumSigners,
+			RequiredGasLimit:   requiredGasLimit,
+			MessageSize:        len(sendMessage),
+			NumReceipts:        numReceipts,
+			NumAllowedRelayers: len(sendAllowedRelayers),
+		},
+	)
+	cobra.CheckErr(err)
+	logger.Info(
+		"Estimated relayer fee",
+		zap.Uint64("deliveryGas", estimate.DeliveryGas),
+		zap.Stringer("gasPrice", estimate.GasPrice),
+		zap.Stringer("nativeCost", estimate.NativeCost),
+		zap.Stringer("feeAmount", estimate.FeeAmount),
+	)
+	return estimate
+}
+
+func init() {
+	rootCmd.AddCommand(sendCmd)
+	sendCmd.Flags().StringVar(&sendRPCEndpoint, "rpc", "", "RPC endpoint of the source chain")
+	sendCmd.Flags().StringVarP(&sendTeleporterAddress, "teleporter-address", "t", "",
+		"TeleporterMessenger address on the source chain")
+	sendCmd.Flags().StringVar(&sendPrivateKey, "private-key", "", "Hex encoded private key of the sender")
+	sendCmd.Flags().StringVar(&sendDestinationBlockchainID, "destination-blockchain-id", "",
+		"CB58 encoded blockchain ID of the destination chain")
+	sendCmd.Flags().StringVar(&sendDestinationAddress, "destination-address", "",
+		"Address of the Teleporter receiver on the destination chain")
+	sendCmd.Flags().BytesHexVar(&sendMessage, "message", []byte{}, "Hex encoded message payload")
+	sendCmd.Flags().Uint64Var(&sendRequiredGasLimit, "required-gas-limit", 0,
+		"Gas limit required to execute the message on the destination chain")
+	sendCmd.Flags().BoolVar(&sendEstimateGas, "estimate-gas", false,
+		"Estimate the required gas limit on the destination chain")
+	sendCmd.Flags().StringVar(&sendDestinationRPCEndpoint, "destination-rpc", "",
+		"RPC endpoint of the destination chain, used to estimate the required gas limit")
+	sendCmd.Flags().StringVar(&sendDestinationTeleporterAddress, "destination-teleporter-address", "",
+		"TeleporterMessenger address on the destination chain. Defaults to --teleporter-address")
+	sendCmd.Flags().Uint64Var(&sendGasMarginPercentage, "gas-margin", gasUtils.DefaultRequiredGasLimitMarginPercentage,
+		"Percentage added to the estimated required gas limit")
+	sendCmd.Flags().StringVar(&sendFeeTokenAddress, "fee-token", "", "Address of the ERC20 token used to pay the fee")
+	sendCmd.Flags().StringVar(&sendFeeAmount, "fee-amount", "0", "Fee amount paid to the relayer")
+	sendCmd.Flags().StringSliceVar(&sendAllowedRelayers, "allowed-relayers", []string{},
+		"Addresses allowed to relay the message. Any relayer is allowed if empty")
+	sendCmd.Flags().BoolVar(&sendEstimateFee, "estimate-fee", false,
+		"Estimate the relayer fee, and use it as the fee amount unless --fee-amount is set")
+	sendCmd.Flags().StringVar(&sendFeeTokenRate, "fee-token-rate", "",
+		"Fee token base units per wei of the destination native token, as a decimal or fraction")
+	sendCmd.Flags().StringVar(&sendPriceOracleURL, "price-oracle-url", "",
+		"URL of a local HTTP price source used to convert the delivery cost to the fee token")
+	sendCmd.Flags().IntVar(&sendNumSigners, "num-signers", defaultNumSigners,
+		"Expected number of validator signatures on the Warp message, used to estimate the relayer fee")
+
+	for _, flag := range []string{
+		"rpc", "teleporter-address", "private-key", "destination-blockchain-id", "destination-address",
+	} {
+		cobra.CheckErr(sendCmd.MarkFlagRequired(flag))
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendCmd(t *testing.T) {
+	requiredFlags := []string{
+		"send",
+		"--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+		"--teleporter-address", "0x253b2784c75e510dD0fF1da844684a1aC0aa5fcf",
+		"--private-key", "56289e99c94b6912bfc12adc093c9b51124f0dc54ac7a766b2bc5ccf558d8027",
+		"--destination-address", "0x0123456789abcdef0123456789abcdef01234567",
+	}
+	var tests = []struct {
+		name string
+		args []string
+		err  error
+		out  string
+	}{
+		{
+			name: "no args",
+			args: []string{"send"},
+			err:  fmt.Errorf("required flag(s)"),
+		},
+		{
+			name: "no gas limit",
+			args: append(requiredFlags, "--destination-blockchain-id", "yH8D7ThNJkxmtkuv2jgBa4P1Rn3Qpr4pPr7QYNfcdoS6k6HWp"),
+			err:  fmt.Errorf("either --required-gas-limit or --estimate-gas must be set"),
+		},
+		{
+			name: "estimate without destination rpc",
+			args: append(requiredFlags,
+				"--destination-blockchain-id", "yH8D7ThNJkxmtkuv2jgBa4P1Rn3Qpr4pPr7QYNfcdoS6k6HWp",
+				"--estimate-gas",
+			),
+			err: fmt.Errorf("--destination-rpc is required with --estimate-gas"),
+		},
+		{
+			name: "invalid destination blockchain ID",
+			args: append(requiredFlags,
+				"--destination-blockchain-id", "invalid",
+				"--required-gas-limit", "100000",
+			),
+			err: fmt.Errorf("invalid destination blockchain ID"),
+		},
+		{
+			name: "estimate fee without fee token",
+			args: append(requiredFlags,
+				"--destination-blockchain-id", "yH8D7ThNJkxmtkuv2jgBa4P1Rn3Qpr4pPr7QYNfcdoS6k6HWp",
+				"--required-gas-limit", "100000",
+				"--destination-rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--estimate-fee",
+			),
+			err: fmt.Errorf("--destination-rpc and --fee-token are required with --estimate-fee"),
+		},
+		{
+			name: "estimate fee without price source",
+			args: append(requiredFlags,
+				"--destination-blockchain-id", "yH8D7ThNJkxmtkuv2jgBa4P1Rn3Qpr4pPr7QYNfcdoS6k6HWp",
+				"--required-gas-limit", "100000",
+				"--destination-rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--estimate-fee",
+				"--fee-token", "0x0123456789abcdef0123456789abcdef01234567",
+			),
+			err: fmt.Errorf("exactly one of --fee-token-rate or --price-oracle-url must be set"),
+		},
+		{
+			name: "estimate fee with invalid rate",
+			args: append(requiredFlags,
+				"--destination-blockchain-id", "yH8D7ThNJkxmtkuv2jgBa4P1Rn3Qpr4pPr7QYNfcdoS6k6HWp",
+				"--required-gas-limit", "100000",
+				"--destination-rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--estimate-fee",
+				"--fee-token", "0x0123456789abcdef0123456789abcdef01234567",
+				"--fee-token-rate", "abc",
+			),
+			err: fmt.Errorf("invalid rate"),
+		},
+		{
+			name: "help",
+			args: []string{"send", "--help"},
+			err:  nil,
+			out:  "Sends a Teleporter message by calling sendCrossChainMessage",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeTestCmd(t, rootCmd, tt.args...)
+			if tt.err != nil {
+				require.ErrorContains(t, err, tt.err.Error())
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, out, tt.out)
+			}
+		})
+	}
+}
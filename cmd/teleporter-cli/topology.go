@@ -0,0 +1,272 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	icttUtils "github.com/ava-labs/icm-contracts/utils/ictt-utils"
+	topologyUtils "github.com/ava-labs/icm-contracts/utils/topology-utils"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/ethclient"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	topologySpecPath   string
+	topologyStatePath  string
+	topologyPrivateKey string
+	topologyTimeout    time.Duration
+
+	topologyFromBlock     uint64
+	topologyMaxBlockRange uint64
+)
+
+var topologyCmd = &cobra.Command{
+	Use:   "topology",
+	Short: "Plans and applies a declarative topology of ICM contracts",
+	Long: `Plans and applies a declarative topology of ICM contracts across chains. The spec FILE is
+YAML if its extension is .yaml or .yml, and JSON otherwise. It lists the chains by name with their
+RPC endpoints, the TeleporterMessenger version expected on every chain, the TeleporterRegistry of
+each chain and its entries, ICTT TokenHome instances with the TokenRemote instances registered
+with them, ValidatorSetSig contracts, validator managers, and deployed TeleporterRegistryApp
+contracts. Contracts given an address are checked against the spec, and contracts without one are
+deployed.
+
+Example spec:
+chains:
+  - name: c
+    rpc: http://127.0.0.1:9650/ext/bc/C/rpc
+  - name: l1
+    rpc: http://127.0.0.1:9650/ext/bc/L1_BLOCKCHAIN_ID/rpc
+teleporter:
+  messengerAddress: "0x253b2784c75e510dD0fF1da844684a1aC0aa5fcf"
+  version: 1
+  bytecodeFile: TeleporterMessenger_Bytecode_v1.0.0.txt
+registries:
+  - chain: c
+    address: "0x..."
+  - chain: l1
+ictt:
+  - name: usdc
+    home:
+      chain: c
+      kind: ERC20TokenHome
+      tokenAddress: "0x..."
+      tokenDecimals: 6
+    remotes:
+      - chain: l1
+        kind: NativeTokenRemote
+        nativeAssetSymbol: USDC
+        initialReserveImbalance: 1000000000000000000
+validatorSetSigs:
+  - name: governor
+    chain: l1
+    validatorBlockchainID: L1_BLOCKCHAIN_ID
+validatorManagers:
+  - name: poa
+    chain: l1
+    kind: PoAValidatorManager
+    l1ID: L1_ID
+    churnPeriodSeconds: 3600
+    maximumChurnPercentage: 20
+
+The addresses of deployed contracts are saved to the --state file, which defaults to the spec file
+with a .state.json extension.`,
+}
+
+var topologyPlanCmd = &cobra.Command{
+	Use:   "plan --spec FILE [--state FILE]",
+	Short: "Diffs the chains' contracts against a topology spec",
+	Long: `Reads the contracts of the topology spec FILE and its --state file from the chains, and lists
+what apply would do to each of them: nothing, deploy it, configure it (initialize a validator
+manager, or finish registering and collateralizing a TokenRemote), or leave it to be changed
+manually, such as a TeleporterRegistry version that needs a message signed by the chain's
+validators.`,
+	Args:    cobra.NoArgs,
+	PreRunE: topologyPreRunE,
+	Run:     topologyPlanRun,
+}
+
+var topologyApplyCmd = &cobra.Command{
+	Use:   "apply --spec FILE --private-key KEY [--state FILE]",
+	Short: "Deploys and configures the contracts missing from a topology",
+	Long: `Deploys, registers and configures the contracts of the topology spec FILE that are missing from
+the chains, in dependency order: TeleporterMessenger instances, registries, ValidatorSetSig
+contracts, validator managers, TokenHome instances, and then TokenRemote instances. A
+TeleporterMessenger is deployed with Nick's method from the spec's bytecode file, and the
+registration of each TokenRemote is delivered by a relayer, which the command waits for.
+
+The state is saved after every deployment, and running the command again resumes where it
+stopped. Changes that must be made manually are listed once everything else is applied.`,
+	Args:    cobra.NoArgs,
+	PreRunE: topologyPreRunE,
+	Run:     topologyApplyRun,
+}
+
+var topologyAuditCmd = &cobra.Command{
+	Use:   "audit --spec FILE [--state FILE] [--from-block BLOCK] [--max-block-range BLOCKS]",
+	Short: "Checks that the TeleporterMessenger and registries of a topology are consistent",
+	Long: `Checks that every chain of the topology spec FILE has the spec's TeleporterMessenger with the
+same code as most of the chains, that its initializeBlockchainID was called with the blockchain ID
+of the chain's Warp precompile, and that its BlockchainIDInitialized event has the same ID. The
+TeleporterRegistry of every chain, from the spec or the --state file, must map the same versions to
+the same addresses as most of the registries. BlockchainIDInitialized events are scanned from
+--from-block on every chain, in queries of at most --max-block-range blocks if it is set.
+
+Checks that fail are listed as a table of the chain, the check, and the expected and actual values.`,
+	Args:    cobra.NoArgs,
+	PreRunE: topologyAuditPreRunE,
+	Run:     topologyAuditRun,
+}
+
+func topologyAuditPreRunE(cmd *cobra.Command, args []string) error {
+	if err := topologyPreRunE(cmd, args); err != nil {
+		return err
+	}
+	spec, err := topologyUtils.ReadSpec(topologySpecPath)
+	if err != nil {
+		return err
+	}
+	if spec.Teleporter == nil {
+		return fmt.Errorf("spec has no teleporter to audit")
+	}
+	return nil
+}
+
+func topologyPreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	spec, err := topologyUtils.ReadSpec(topologySpecPath)
+	if err != nil {
+		return err
+	}
+	for _, chain := range spec.Chains {
+		if chain.RPC == "" {
+			return fmt.Errorf("chain %q has no rpc", chain.Name)
+		}
+	}
+	return nil
+}
+
+// newTopology reads the topology spec and state, and dials the spec's chains. The chains have
+// senders if a private key is given.
+func newTopology(
+	ctx context.Context,
+	privateKey string,
+) (*topologyUtils.Topology, *topologyUtils.State, string) {
+	spec, err := topologyUtils.ReadSpec(topologySpecPath)
+	cobra.CheckErr(err)
+	statePath := topologyStatePath
+	if statePath == "" {
+		statePath = strings.TrimSuffix(topologySpecPath, filepath.Ext(topologySpecPath)) + ".state.json"
+	}
+	state := topologyUtils.NewState()
+	data, err := os.ReadFile(statePath)
+	switch {
+	case err == nil:
+		cobra.CheckErr(json.Unmarshal(data, state))
+		logger.Info("Read topology state", zap.String("state", statePath))
+	case !os.IsNotExist(err):
+		cobra.CheckErr(err)
+	}
+
+	chains := make(map[string]*topologyUtils.Chain)
+	for _, chainSpec := range spec.Chains {
+		c, err := ethclient.Dial(chainSpec.RPC)
+		cobra.CheckErr(err)
+		chain := &topologyUtils.Chain{Backend: c}
+		if privateKey != "" {
+			key, err := parsePrivateKey(privateKey)
+			cobra.CheckErr(err)
+			opts, err := newTransactor(ctx, c, key)
+			cobra.CheckErr(err)
+			chain.Sender = icttUtils.NewTokenSender(c, opts,
+				func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+					return waitForSuccess(ctx, c, tx)
+				})
+		}
+		chains[chainSpec.Name] = chain
+	}
+	return topologyUtils.NewTopology(spec, chains), state, statePath
+}
+
+func topologyPlanRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	topology, state, _ := newTopology(ctx, "")
+	plan, err := topology.Plan(ctx, state)
+	cobra.CheckErr(err)
+	for _, action := range plan.Actions {
+		cmd.Println(action.String())
+	}
+	cmd.Printf("Changes: %d\n", len(plan.Changes()))
+}
+
+func topologyApplyRun(cmd *cobra.Command, args []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), topologyTimeout)
+	defer cancel()
+	topology, state, statePath := newTopology(ctx, topologyPrivateKey)
+	topology.Save = func(state *topologyUtils.State) error {
+		data, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(statePath, data, 0o600)
+	}
+
+	logger.Info("Applying topology", zap.String("spec", topologySpecPath), zap.String("state", statePath))
+	plan, err := topology.Apply(ctx, state)
+	cobra.CheckErr(err)
+	changes := plan.Changes()
+	cmd.Printf("Manual changes: %d\n", len(changes))
+	for _, action := range changes {
+		cmd.Println("  " + action.String())
+	}
+}
+
+func topologyAuditRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	topology, state, _ := newTopology(ctx, "")
+	audit, err := topology.Audit(ctx, state, topologyFromBlock, topologyMaxBlockRange)
+	cobra.CheckErr(err)
+	cmd.Println("TeleporterMessenger code hash: " + audit.CodeHash.Hex())
+	if len(audit.Drift) == 0 {
+		cmd.Printf("No drift across %d chains\n", len(topology.Spec.Chains))
+		return
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAIN\tCHECK\tEXPECTED\tACTUAL")
+	for _, drift := range audit.Drift {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", drift.Chain, drift.Check, drift.Expected, drift.Actual)
+	}
+	cobra.CheckErr(w.Flush())
+	cmd.Printf("Drift: %d\n", len(audit.Drift))
+}
+
+func init() {
+	rootCmd.AddCommand(topologyCmd)
+	topologyCmd.AddCommand(topologyPlanCmd, topologyApplyCmd, topologyAuditCmd)
+	topologyCmd.PersistentFlags().StringVar(&topologySpecPath, "spec", "", "YAML or JSON file describing the topology")
+	topologyCmd.PersistentFlags().StringVar(&topologyStatePath, "state", "",
+		"JSON file the addresses of deployed contracts are saved to. Defaults to SPEC.state.json")
+	cobra.CheckErr(topologyCmd.MarkPersistentFlagRequired("spec"))
+	topologyApplyCmd.Flags().StringVar(&topologyPrivateKey, "private-key", "",
+		"Private key of the account that deploys and configures the contracts on every chain")
+	topologyApplyCmd.Flags().DurationVar(&topologyTimeout, "timeout", 30*time.Minute,
+		"Maximum time to wait for the topology to be applied")
+	cobra.CheckErr(topologyApplyCmd.MarkFlagRequired("private-key"))
+	topologyAuditCmd.Flags().Uint64Var(&topologyFromBlock, "from-block", 0,
+		"Block to start scanning for BlockchainIDInitialized events from, on every chain")
+	topologyAuditCmd.Flags().Uint64Var(&topologyMaxBlockRange, "max-block-range", 0,
+		"Maximum number of blocks per log query. Unlimited if zero")
+}
@@ -0,0 +1,82 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyCmd(t *testing.T) {
+	specDir := t.TempDir()
+	writeSpec := func(name string, spec string) string {
+		path := filepath.Join(specDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(spec), 0o600))
+		return path
+	}
+	noRPCSpecPath := writeSpec("no-rpc.yaml", "chains:\n  - name: c\n")
+	noTeleporterSpecPath := writeSpec("no-teleporter.yaml", "chains:\n  - name: c\n    rpc: http://127.0.0.1:9650\n")
+	invalidSpecPath := writeSpec("invalid.json", `{"chains": [{"name": "c", "rpc": "http://127.0.0.1:9650"}], `+
+		`"registries": [{"chain": "l1"}]}`)
+
+	var tests = []struct {
+		name string
+		args []string
+		err  error
+		out  string
+	}{
+		{
+			name: "plan no spec",
+			args: []string{"topology", "plan"},
+			err:  fmt.Errorf("required flag(s) \"spec\" not set"),
+		},
+		{
+			name: "plan chain without rpc",
+			args: []string{"topology", "plan", "--spec", noRPCSpecPath},
+			err:  fmt.Errorf("chain \"c\" has no rpc"),
+		},
+		{
+			name: "apply no private key",
+			args: []string{"topology", "apply", "--spec", noRPCSpecPath},
+			err:  fmt.Errorf("required flag(s) \"private-key\" not set"),
+		},
+		{
+			name: "apply invalid spec",
+			args: []string{"topology", "apply", "--spec", invalidSpecPath, "--private-key", "01"},
+			err:  fmt.Errorf("invalid spec: registry: unknown chain \"l1\""),
+		},
+		{
+			name: "apply missing spec",
+			args: []string{"topology", "apply", "--spec", filepath.Join(specDir, "missing.yaml"), "--private-key", "01"},
+			err:  fmt.Errorf("failed to read spec"),
+		},
+		{
+			name: "audit without teleporter",
+			args: []string{"topology", "audit", "--spec", noTeleporterSpecPath},
+			err:  fmt.Errorf("spec has no teleporter to audit"),
+		},
+		{
+			name: "help",
+			args: []string{"topology", "plan", "--help"},
+			err:  nil,
+			out:  "lists\nwhat apply would do to each of them",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeTestCmd(t, rootCmd, tt.args...)
+			if tt.err != nil {
+				require.ErrorContains(t, err, tt.err.Error())
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, out, tt.out)
+			}
+		})
+	}
+}
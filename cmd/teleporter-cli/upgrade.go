@@ -0,0 +1,207 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	upgradeUtils "github.com/ava-labs/icm-contracts/utils/upgrade-utils"
+	verifyUtils "github.com/ava-labs/icm-contracts/utils/verify-utils"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/ethclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	upgradeRPCEndpoint       string
+	upgradePrivateKey        string
+	upgradeImplementation    string
+	upgradeCurrentLayoutPath string
+	upgradeNewLayoutPath     string
+	upgradeCallData          []byte
+	upgradeDryRun            bool
+	upgradeSkipCodeCheck     bool
+
+	// upgradeCurrentArtifact and upgradeNewArtifact are the bytecode of --current-layout and
+	// --new-layout, read by upgradePreRunE unless --skip-code-check is set.
+	upgradeCurrentArtifact *verifyUtils.Artifact
+	upgradeNewArtifact     *verifyUtils.Artifact
+)
+
+var upgradeCmd = &cobra.Command{
+	Use: "upgrade --rpc RPC_URL --private-key KEY --implementation ADDRESS " +
+		"--current-layout FILE --new-layout FILE [--call-data HEX] [--skip-code-check] PROXY_ADDRESS",
+	Short: "Upgrades a TransparentUpgradeableProxy after checking its storage layout",
+	Long: `Upgrades the TransparentUpgradeableProxy at PROXY_ADDRESS, such as an upgradeable ICTT
+contract, to the implementation at --implementation, by calling upgradeAndCall on the ProxyAdmin
+the proxy stores in its EIP-1967 admin slot. The proxy's current implementation is read from its
+EIP-1967 implementation slot.
+
+The storage layouts of the current and new implementations are read from the forge artifacts
+--current-layout and --new-layout, built with --ast and extra_output = ["storageLayout"]. The
+layouts of their ERC-7201 namespaces are built from the structs annotated with
+@custom:storage-location in the contract and its base contracts, whose artifacts must be in the
+same output directory. The upgrade is refused if the new layout removes, renames, moves or changes
+the type of a variable, or removes a namespace. Variables may only be added at the end of a
+namespace, and struct members at the end of a struct that is the value of a mapping or the last
+variable of its namespace.
+
+Before the layouts are trusted, the code of the current implementation is compared with the
+deployedBytecode of --current-layout, and the code of --implementation with --new-layout, ignoring
+immutable variables and metadata as verify-code does. A storage layout file, which may list the
+namespaces under "namespaces" as OpenZeppelin's upgrades-core extracts them, has no bytecode to
+compare, and is only accepted with --skip-code-check.
+
+--call-data is passed to upgradeAndCall, which calls the proxy with it after upgrading, such as to
+initialize a new version of the contract. With --dry-run, the layouts are checked and the proxy is
+read without upgrading it.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: upgradePreRunE,
+	Run:     upgradeRun,
+}
+
+func upgradePreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	for _, address := range []string{args[0], upgradeImplementation} {
+		if !common.IsHexAddress(address) {
+			return fmt.Errorf("invalid address %q", address)
+		}
+	}
+	if upgradePrivateKey == "" && !upgradeDryRun {
+		return fmt.Errorf("--private-key is required unless --dry-run is set")
+	}
+	if err := checkUpgradeLayouts(); err != nil {
+		return err
+	}
+	upgradeCurrentArtifact, upgradeNewArtifact = nil, nil
+	if upgradeSkipCodeCheck {
+		return nil
+	}
+	var err error
+	if upgradeCurrentArtifact, err = readUpgradeArtifact("current implementation", upgradeCurrentLayoutPath); err != nil {
+		return err
+	}
+	upgradeNewArtifact, err = readUpgradeArtifact("new implementation", upgradeNewLayoutPath)
+	return err
+}
+
+// readUpgradeArtifact reads the bytecode of the artifact [path] the layout of [name] is read from.
+func readUpgradeArtifact(name, path string) (*verifyUtils.Artifact, error) {
+	artifact, err := verifyUtils.ReadArtifact(name, path, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: the code of the %s can't be checked, use --skip-code-check to trust its layout",
+			err, name)
+	}
+	return artifact, nil
+}
+
+// checkUpgradeCode returns an error unless the code at [address] matches [artifact], the artifact of
+// the layout checked for the implementation [name].
+func checkUpgradeCode(
+	ctx context.Context,
+	c ethclient.Client,
+	name string,
+	address common.Address,
+	artifact *verifyUtils.Artifact,
+) error {
+	code, err := c.CodeAt(ctx, address, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get code of the %s %s: %w", name, address.Hex(), err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no contract at the %s %s", name, address.Hex())
+	}
+	if mismatch := artifact.Match(code); mismatch != "" {
+		return fmt.Errorf("code of the %s %s does not match %s: %s", name, address.Hex(), artifact.Path, mismatch)
+	}
+	return nil
+}
+
+// checkUpgradeLayouts returns an error listing the incompatibilities between the storage layouts
+// of the current and new implementations.
+func checkUpgradeLayouts() error {
+	currentLayout, err := upgradeUtils.ReadStorageLayout(upgradeCurrentLayoutPath)
+	if err != nil {
+		return err
+	}
+	newLayout, err := upgradeUtils.ReadStorageLayout(upgradeNewLayoutPath)
+	if err != nil {
+		return err
+	}
+	errs := upgradeUtils.CompareStorageLayouts(currentLayout, newLayout)
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.String()
+	}
+	return fmt.Errorf("storage layout of the new implementation is not compatible:\n  %s",
+		strings.Join(messages, "\n  "))
+}
+
+func upgradeRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	proxyAddress := common.HexToAddress(args[0])
+	implementationAddress := common.HexToAddress(upgradeImplementation)
+
+	// The storage layouts were checked by upgradePreRunE.
+	c, err := ethclient.Dial(upgradeRPCEndpoint)
+	cobra.CheckErr(err)
+	currentImplementation, err := upgradeUtils.GetImplementation(ctx, c, proxyAddress)
+	cobra.CheckErr(err)
+	proxyAdmin, err := upgradeUtils.GetProxyAdmin(ctx, c, proxyAddress)
+	cobra.CheckErr(err)
+	cmd.Println("Current implementation: " + currentImplementation.Hex())
+	cmd.Println("ProxyAdmin: " + proxyAdmin.Hex())
+	if !upgradeSkipCodeCheck {
+		cobra.CheckErr(checkUpgradeCode(ctx, c, "current implementation", currentImplementation, upgradeCurrentArtifact))
+		cobra.CheckErr(checkUpgradeCode(ctx, c, "new implementation", implementationAddress, upgradeNewArtifact))
+		cmd.Println("The code of both implementations matches their layouts' artifacts")
+	}
+	if upgradeDryRun {
+		return
+	}
+
+	key, err := parsePrivateKey(upgradePrivateKey)
+	cobra.CheckErr(err)
+	opts, err := newTransactor(ctx, c, key)
+	cobra.CheckErr(err)
+	upgrader := upgradeUtils.NewUpgrader(c, opts,
+		func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+			return waitForSuccess(ctx, c, tx)
+		})
+	upgrade, err := upgrader.Upgrade(ctx, proxyAddress, implementationAddress, upgradeCallData)
+	cobra.CheckErr(err)
+	logger.Info("Upgraded proxy", zap.Stringer("txHash", upgrade.Receipt.TxHash))
+	cmd.Println("Implementation: " + implementationAddress.Hex())
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+	upgradeCmd.Flags().StringVar(&upgradeRPCEndpoint, "rpc", "", "RPC endpoint of the proxy's chain")
+	upgradeCmd.Flags().StringVar(&upgradePrivateKey, "private-key", "",
+		"Hex encoded private key of the ProxyAdmin's owner")
+	upgradeCmd.Flags().StringVar(&upgradeImplementation, "implementation", "",
+		"Address of the deployed implementation to upgrade to")
+	upgradeCmd.Flags().StringVar(&upgradeCurrentLayoutPath, "current-layout", "",
+		"Forge artifact or storage layout JSON of the current implementation")
+	upgradeCmd.Flags().StringVar(&upgradeNewLayoutPath, "new-layout", "",
+		"Forge artifact or storage layout JSON of the new implementation")
+	upgradeCmd.Flags().BytesHexVar(&upgradeCallData, "call-data", []byte{},
+		"Hex encoded call to make to the proxy after upgrading it")
+	upgradeCmd.Flags().BoolVar(&upgradeDryRun, "dry-run", false,
+		"Check the storage layouts and read the proxy without upgrading it")
+	upgradeCmd.Flags().BoolVar(&upgradeSkipCodeCheck, "skip-code-check", false,
+		"Trust the storage layouts without comparing the implementations' code with their artifacts")
+	for _, flag := range []string{"rpc", "implementation", "current-layout", "new-layout"} {
+		cobra.CheckErr(upgradeCmd.MarkFlagRequired(flag))
+	}
+}
@@ -0,0 +1,100 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeCmd(t *testing.T) {
+	layoutDir := t.TempDir()
+	writeLayout := func(name string, layout string) string {
+		path := filepath.Join(layoutDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(layout), 0o600))
+		return path
+	}
+	currentLayoutPath := writeLayout("current.json", `{"storageLayout": {"storage": [], `+
+		`"types": {"t_uint256": {"encoding": "inplace", "label": "uint256", "numberOfBytes": "32"}}, `+
+		`"namespaces": {"erc7201:example": [{"label": "_total", "offset": 0, "slot": "0", "type": "t_uint256"}]}}}`)
+	newLayoutPath := writeLayout("new.json", `{"storageLayout": {"storage": [], `+
+		`"types": {"t_uint256": {"encoding": "inplace", "label": "uint256", "numberOfBytes": "32"}}, `+
+		`"namespaces": {"erc7201:example": [{"label": "_count", "offset": 0, "slot": "0", "type": "t_uint256"}]}}}`)
+	requiredFlags := []string{
+		"upgrade",
+		"--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+		"--implementation", "0x0123456789abcdef0123456789abcdef01234567",
+		"--current-layout", currentLayoutPath,
+	}
+
+	var tests = []struct {
+		name string
+		args []string
+		err  error
+		out  string
+	}{
+		{
+			name: "no args",
+			args: []string{"upgrade"},
+			err:  fmt.Errorf("accepts 1 arg(s), received 0"),
+		},
+		{
+			name: "missing flags",
+			args: []string{"upgrade", "0x0123456789abcdef0123456789abcdef01234567"},
+			err:  fmt.Errorf("required flag(s) \"current-layout\", \"implementation\", \"new-layout\", \"rpc\" not set"),
+		},
+		{
+			name: "invalid proxy address",
+			args: append(requiredFlags, "--new-layout", newLayoutPath, "invalid"),
+			err:  fmt.Errorf("invalid address \"invalid\""),
+		},
+		{
+			name: "no private key",
+			args: append(requiredFlags, "--new-layout", newLayoutPath, "0x0123456789abcdef0123456789abcdef01234567"),
+			err:  fmt.Errorf("--private-key is required unless --dry-run is set"),
+		},
+		{
+			name: "incompatible layout",
+			args: append(requiredFlags, "--new-layout", newLayoutPath, "--private-key", "01",
+				"0x0123456789abcdef0123456789abcdef01234567"),
+			err: fmt.Errorf("storage layout of the new implementation is not compatible:\n" +
+				"  erc7201:example: _total: was replaced by _count"),
+		},
+		{
+			name: "layout without bytecode",
+			args: append(requiredFlags, "--new-layout", currentLayoutPath, "--dry-run",
+				"0x0123456789abcdef0123456789abcdef01234567"),
+			err: fmt.Errorf("has no deployed bytecode: the code of the current implementation can't be checked, " +
+				"use --skip-code-check to trust its layout"),
+		},
+		{
+			name: "missing layout",
+			args: append(requiredFlags, "--new-layout", filepath.Join(layoutDir, "missing.json"),
+				"0x0123456789abcdef0123456789abcdef01234567"),
+			err: fmt.Errorf("failed to read storage layout"),
+		},
+		{
+			name: "help",
+			args: []string{"upgrade", "--help"},
+			err:  nil,
+			out:  "by calling upgradeAndCall on the ProxyAdmin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeTestCmd(t, rootCmd, tt.args...)
+			if tt.err != nil {
+				require.ErrorContains(t, err, tt.err.Error())
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, out, tt.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	validatorManagerUtils "github.com/ava-labs/icm-contracts/utils/validator-manager-utils"
+	"github.com/ava-labs/subnet-evm/ethclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/spf13/cobra"
+)
+
+var (
+	validatorsRPCEndpoint    string
+	validatorsManagerAddress string
+	validatorsFromBlock      uint64
+	validatorsMaxBlockRange  uint64
+)
+
+var validatorsCmd = &cobra.Command{
+	Use:   "validators",
+	Short: "Inspects the validations of a validator manager",
+	Long: `Inspects the validations of a PoAValidatorManager, NativeTokenStakingManager or
+ERC20TokenStakingManager.`,
+}
+
+var validatorsListCmd = &cobra.Command{
+	Use:   "list --rpc RPC_URL --manager ADDRESS",
+	Short: "Lists the validations of a validator manager",
+	Long: `Lists every validation of the validator manager at --manager, found by scanning its
+InitialValidatorCreated and ValidationPeriodCreated events. For each validation, prints its status,
+node ID, weight and start and end times from getValidator. For a staking manager, also prints the
+validation's owner, delegation fee, minimum stake duration, uptime and reward recipient, and the
+delegations that have not ended with their status. Events that the validator manager's state
+transitions do not allow are printed as warnings. Use --from-block to skip blocks before the
+validator manager was deployed, and --max-block-range if the RPC endpoint limits the block range
+of log queries.`,
+	Args:    cobra.NoArgs,
+	PreRunE: validatorsPreRunE,
+	Run:     validatorsListRun,
+}
+
+func validatorsPreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(validatorsManagerAddress) {
+		return fmt.Errorf("invalid address %q", validatorsManagerAddress)
+	}
+	return nil
+}
+
+// formatTimestamp formats a Unix timestamp of a validation or delegation, which is zero until the
+// validation or delegation starts or ends.
+func formatTimestamp(timestamp uint64) string {
+	if timestamp == 0 {
+		return "none"
+	}
+	return time.Unix(int64(timestamp), 0).UTC().Format(time.RFC3339)
+}
+
+// formatNodeID formats a node ID as a NodeID, or in hex if it is not 20 bytes long.
+func formatNodeID(nodeID []byte) string {
+	if id, err := ids.ToNodeID(nodeID); err == nil {
+		return id.String()
+	}
+	return hexutil.Encode(nodeID)
+}
+
+func validatorsListRun(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	c, err := ethclient.Dial(validatorsRPCEndpoint)
+	cobra.CheckErr(err)
+
+	state, err := validatorManagerUtils.InspectValidators(ctx, c, common.HexToAddress(validatorsManagerAddress),
+		validatorsFromBlock, validatorsMaxBlockRange)
+	cobra.CheckErr(err)
+
+	cmd.Println("Validator manager: " + state.Address.Hex())
+	cmd.Println("Kind: " + state.Kind.String())
+	for _, illegal := range state.Illegal {
+		cmd.Println("Warning: " + illegal.Error())
+	}
+	cmd.Printf("Validations: %d\n", len(state.Validations))
+	for _, validation := range state.Validations {
+		validator := validation.Validator
+		cmd.Println()
+		cmd.Println("Validation: " + validation.ValidationID.String())
+		cmd.Println("  Status: " + validatorManagerUtils.ValidatorStatus(validator.Status).String())
+		cmd.Println("  Node ID: " + formatNodeID(validator.NodeID))
+		cmd.Printf("  Weight: %d\n", validator.Weight)
+		cmd.Printf("  Starting weight: %d\n", validator.StartingWeight)
+		cmd.Println("  Started at: " + formatTimestamp(validator.StartedAt))
+		cmd.Println("  Ended at: " + formatTimestamp(validator.EndedAt))
+		if !state.Kind.IsPoS() {
+			continue
+		}
+		if validation.PoS == nil {
+			cmd.Println("  Owner: none, an initial validator has no stake")
+			continue
+		}
+		cmd.Println("  Owner: " + validation.PoS.Owner.Hex())
+		cmd.Printf("  Delegation fee: %d bips\n", validation.PoS.DelegationFeeBips)
+		cmd.Printf("  Min stake duration: %s\n", time.Duration(validation.PoS.MinStakeDuration)*time.Second)
+		cmd.Printf("  Uptime: %s\n", time.Duration(validation.PoS.UptimeSeconds)*time.Second)
+		if validation.PoS.RewardRecipient == (common.Address{}) {
+			cmd.Println("  Reward recipient: owner")
+		} else {
+			cmd.Println("  Reward recipient: " + validation.PoS.RewardRecipient.Hex())
+		}
+		cmd.Printf("  Delegations: %d\n", len(validation.Delegations))
+		for _, delegation := range validation.Delegations {
+			cmd.Println("  Delegation: " + delegation.DelegationID.String())
+			cmd.Println("    Status: " + delegation.Status.String())
+			cmd.Println("    Owner: " + delegation.Owner.Hex())
+			cmd.Printf("    Weight: %d\n", delegation.Weight)
+			cmd.Println("    Started at: " + formatTimestamp(delegation.StartedAt))
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(validatorsCmd)
+	validatorsCmd.AddCommand(validatorsListCmd)
+	validatorsCmd.PersistentFlags().StringVar(&validatorsRPCEndpoint, "rpc", "",
+		"RPC endpoint of the chain the validator manager is deployed on")
+	cobra.CheckErr(validatorsCmd.MarkPersistentFlagRequired("rpc"))
+	validatorsListCmd.Flags().StringVar(&validatorsManagerAddress, "manager", "", "Address of the validator manager")
+	validatorsListCmd.Flags().Uint64Var(&validatorsFromBlock, "from-block", 0,
+		"Block to start scanning for validations from")
+	validatorsListCmd.Flags().Uint64Var(&validatorsMaxBlockRange, "max-block-range", 0,
+		"Maximum number of blocks per log query. Unlimited if zero")
+	cobra.CheckErr(validatorsListCmd.MarkFlagRequired("manager"))
+}
@@ -0,0 +1,70 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatorsCmd(t *testing.T) {
+	var tests = []struct {
+		name string
+		args []string
+		err  error
+		out  string
+	}{
+		{
+			name: "list no manager",
+			args: []string{"validators", "list", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc"},
+			err:  fmt.Errorf("required flag(s) \"manager\" not set"),
+		},
+		{
+			name: "list no rpc",
+			args: []string{"validators", "list", "--manager", "0x0123456789abcdef0123456789abcdef01234567"},
+			err:  fmt.Errorf("required flag(s) \"rpc\" not set"),
+		},
+		{
+			name: "list invalid manager",
+			args: []string{
+				"validators", "list", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "--manager", "invalid",
+			},
+			err: fmt.Errorf("invalid address \"invalid\""),
+		},
+		{
+			name: "list unexpected args",
+			args: []string{
+				"validators", "list", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--manager", "0x0123456789abcdef0123456789abcdef01234567", "extra",
+			},
+			err: fmt.Errorf("unknown command \"extra\""),
+		},
+		{
+			name: "help",
+			args: []string{"validators", "list", "--help"},
+			err:  nil,
+			out:  "Lists every validation of the validator manager at --manager",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The flags stay set for later commands, so each case starts without them.
+			t.Cleanup(func() {
+				validatorsRPCEndpoint, validatorsManagerAddress = "", ""
+				validatorsCmd.PersistentFlags().Lookup("rpc").Changed = false
+				validatorsListCmd.Flags().Lookup("manager").Changed = false
+			})
+			out, err := executeTestCmd(t, rootCmd, tt.args...)
+			if tt.err != nil {
+				require.ErrorContains(t, err, tt.err.Error())
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, out, tt.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	verifyUtils "github.com/ava-labs/icm-contracts/utils/verify-utils"
+	"github.com/ava-labs/subnet-evm/ethclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyRPCEndpoint string
+	verifyArtifacts   []string
+	verifyContract    string
+	verifyVersions    string
+
+	// verifyReleaseArtifacts are the artifacts read from --artifact by verifyCodePreRunE.
+	verifyReleaseArtifacts []*verifyUtils.Artifact
+	// verifySolidityVersion is the SOLIDITY_VERSION of --versions, read by verifyCodePreRunE.
+	verifySolidityVersion string
+)
+
+var verifyCodeCmd = &cobra.Command{
+	Use:   "verify-code --rpc RPC_URL --artifact RELEASE=PATH... [--contract NAME] [--versions PATH] ADDRESS",
+	Short: "Checks which release the code of a contract was built from",
+	Long: `Fetches the code at ADDRESS, such as the universal TeleporterMessenger address or an ICTT
+contract, and compares it with the deployedBytecode of the forge artifact of each release given with
+--artifact RELEASE=PATH, where RELEASE is a release tag such as v1.0.0. PATH is either an artifact,
+or forge's out directory of the release, in which case the artifact of --contract is compared.
+
+The values of immutable variables and linked library addresses, which depend on the deployment,
+are ignored, as is the metadata solc appends to the code. If ADDRESS is an EIP-1967 proxy, such as
+an upgradeable ICTT contract, the code of its implementation is compared instead. The command fails
+if the code matches no release.
+
+With --versions PATH, such as scripts/versions.sh, the solc version in the metadata of each artifact
+is checked against the SOLIDITY_VERSION the script sets, and a mismatch is reported.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: verifyCodePreRunE,
+	Run:     verifyCodeRun,
+}
+
+func verifyCodePreRunE(cmd *cobra.Command, args []string) error {
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(args[0]) {
+		return fmt.Errorf("invalid address %q", args[0])
+	}
+	verifySolidityVersion = ""
+	if verifyVersions != "" {
+		version, err := verifyUtils.ReadSolidityVersion(verifyVersions)
+		if err != nil {
+			return err
+		}
+		verifySolidityVersion = version
+	}
+	verifyReleaseArtifacts = nil
+	for _, flag := range verifyArtifacts {
+		release, path, ok := strings.Cut(flag, "=")
+		if !ok || release == "" || path == "" {
+			return fmt.Errorf("invalid artifact %q, expected RELEASE=PATH", flag)
+		}
+		artifact, err := verifyUtils.ReadArtifact(release, path, verifyContract)
+		if err != nil {
+			return err
+		}
+		verifyReleaseArtifacts = append(verifyReleaseArtifacts, artifact)
+	}
+	return nil
+}
+
+func verifyCodeRun(cmd *cobra.Command, args []string) {
+	c, err := ethclient.Dial(verifyRPCEndpoint)
+	cobra.CheckErr(err)
+	report, err := verifyUtils.Verify(context.Background(), c, common.HexToAddress(args[0]), verifyReleaseArtifacts)
+	cobra.CheckErr(err)
+
+	cmd.Println("Address: " + report.Address.Hex())
+	if report.Implementation != (common.Address{}) {
+		cmd.Println("Implementation: " + report.Implementation.Hex())
+	}
+	cmd.Println("Code hash: " + report.CodeHash.Hex())
+	for i, result := range report.Results {
+		status := "matches"
+		if result.Mismatch != "" {
+			status = "does not match: " + result.Mismatch
+		}
+		if version := verifyReleaseArtifacts[i].CompilerVersion; version != "" {
+			status += " (solc " + version + ")"
+		}
+		if verifySolidityVersion != "" {
+			if mismatch := verifyReleaseArtifacts[i].CompilerMismatch(verifySolidityVersion); mismatch != "" {
+				status += ", SOLIDITY_VERSION mismatch: " + mismatch
+			}
+		}
+		cmd.Printf("%s: %s\n", result.Release, status)
+	}
+	matches := report.Matches()
+	if len(matches) == 0 {
+		cobra.CheckErr(fmt.Errorf("the code matches no release"))
+	}
+	cmd.Println("Release: " + strings.Join(matches, ", "))
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCodeCmd)
+	verifyCodeCmd.Flags().StringVar(&verifyRPCEndpoint, "rpc", "", "RPC endpoint of the contract's chain")
+	verifyCodeCmd.Flags().StringArrayVar(&verifyArtifacts, "artifact", nil,
+		"RELEASE=PATH of a release's forge artifact or out directory, may be repeated")
+	verifyCodeCmd.Flags().StringVar(&verifyContract, "contract", "",
+		"Name of the contract, to find its artifact in an out directory")
+	verifyCodeCmd.Flags().StringVar(&verifyVersions, "versions", "",
+		"Path of scripts/versions.sh, to check the solc version of each artifact against its SOLIDITY_VERSION")
+	for _, flag := range []string{"rpc", "artifact"} {
+		cobra.CheckErr(verifyCodeCmd.MarkFlagRequired(flag))
+	}
+}
@@ -0,0 +1,86 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCodeCmd(t *testing.T) {
+	outDir := t.TempDir()
+	var tests = []struct {
+		name string
+		args []string
+		err  error
+		out  string
+	}{
+		{
+			name: "no args",
+			args: []string{"verify-code"},
+			err:  fmt.Errorf("accepts 1 arg(s), received 0"),
+		},
+		{
+			name: "missing flags",
+			args: []string{"verify-code", "0x0123456789abcdef0123456789abcdef01234567"},
+			err:  fmt.Errorf("required flag(s) \"artifact\", \"rpc\" not set"),
+		},
+		{
+			name: "invalid address",
+			args: []string{"verify-code", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--artifact", "v1.0.0=" + outDir, "invalid"},
+			err: fmt.Errorf("invalid address \"invalid\""),
+		},
+		{
+			name: "invalid artifact",
+			args: []string{"verify-code", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--artifact", "v1.0.0", "0x0123456789abcdef0123456789abcdef01234567"},
+			err: fmt.Errorf("invalid artifact \"v1.0.0\", expected RELEASE=PATH"),
+		},
+		{
+			name: "missing artifact",
+			args: []string{"verify-code", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--artifact", "v1.0.0=" + filepath.Join(outDir, "missing.json"),
+				"0x0123456789abcdef0123456789abcdef01234567"},
+			err: fmt.Errorf("failed to read artifact of release v1.0.0"),
+		},
+		{
+			name: "out directory without contract",
+			args: []string{"verify-code", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--artifact", "v1.0.0=" + outDir, "0x0123456789abcdef0123456789abcdef01234567"},
+			err: fmt.Errorf("a contract name is needed to find its artifact in " + outDir),
+		},
+		{
+			name: "missing versions script",
+			args: []string{"verify-code", "--rpc", "http://127.0.0.1:9650/ext/bc/C/rpc",
+				"--artifact", "v1.0.0=" + outDir, "--versions", filepath.Join(outDir, "versions.sh"),
+				"0x0123456789abcdef0123456789abcdef01234567"},
+			err: fmt.Errorf("failed to read versions script"),
+		},
+		{
+			name: "help",
+			args: []string{"verify-code", "--help"},
+			err:  nil,
+			out:  "compares it with the deployedBytecode of the forge artifact",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// --artifact values accumulate across executions of the command.
+			verifyArtifacts = nil
+			verifyVersions = ""
+			out, err := executeTestCmd(t, rootCmd, tt.args...)
+			if tt.err != nil {
+				require.ErrorContains(t, err, tt.err.Error())
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, out, tt.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package ictt
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	erc20tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/ERC20TokenHome"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	"github.com/ava-labs/icm-contracts/tests/interfaces"
+	localnetwork "github.com/ava-labs/icm-contracts/tests/network"
+	"github.com/ava-labs/icm-contracts/tests/utils"
+	icttUtils "github.com/ava-labs/icm-contracts/utils/ictt-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	. "github.com/onsi/gomega"
+)
+
+/**
+ * Deploy a ERC20 token home on the primary network
+ * Deploys ERC20 token remote to L1 A and L1 B
+ * Transfers C-Chain example ERC20 tokens to L1 A
+ * Transfer tokens from L1 A to L1 B through multi-hop, tracking the transfer after each hop
+ */
+func ERC20TokenHomeERC20TokenRemoteMultiHopTracking(
+	network *localnetwork.LocalNetwork,
+	teleporter utils.TeleporterTestInfo,
+) {
+	cChainInfo := network.GetPrimaryNetworkInfo()
+	l1AInfo, l1BInfo := network.GetTwoL1s()
+	fundedAddress, fundedKey := network.GetFundedAccountInfo()
+
+	ctx := context.Background()
+
+	// Deploy an ExampleERC20 on the C-Chain as the token to be transferred
+	exampleERC20Address, exampleERC20 := utils.DeployExampleERC20Decimals(
+		ctx,
+		fundedKey,
+		cChainInfo,
+		erc20TokenHomeDecimals,
+	)
+
+	// Create an ERC20TokenHome for transferring the ERC20 token
+	erc20TokenHomeAddress, erc20TokenHome := utils.DeployERC20TokenHome(
+		ctx,
+		teleporter,
+		fundedKey,
+		cChainInfo,
+		fundedAddress,
+		exampleERC20Address,
+		erc20TokenHomeDecimals,
+	)
+
+	// Deploy an ERC20TokenRemote to each of L1 A and L1 B
+	erc20TokenRemoteAddressA, erc20TokenRemoteA := utils.DeployERC20TokenRemote(
+		ctx,
+		teleporter,
+		fundedKey,
+		l1AInfo,
+		fundedAddress,
+		cChainInfo.BlockchainID,
+		erc20TokenHomeAddress,
+		erc20TokenHomeDecimals,
+		"Token",
+		"TKN",
+		erc20TokenHomeDecimals,
+	)
+	erc20TokenRemoteAddressB, erc20TokenRemoteB := utils.DeployERC20TokenRemote(
+		ctx,
+		teleporter,
+		fundedKey,
+		l1BInfo,
+		fundedAddress,
+		cChainInfo.BlockchainID,
+		erc20TokenHomeAddress,
+		erc20TokenHomeDecimals,
+		"Token",
+		"TKN",
+		erc20TokenHomeDecimals,
+	)
+
+	aggregator := network.GetSignatureAggregator()
+	defer aggregator.Shutdown()
+
+	// Register both ERC20TokenRemote instances on the ERC20TokenHome
+	for _, remote := range []struct {
+		info    interfaces.L1TestInfo
+		address common.Address
+	}{{l1AInfo, erc20TokenRemoteAddressA}, {l1BInfo, erc20TokenRemoteAddressB}} {
+		utils.RegisterERC20TokenRemoteOnHome(
+			ctx,
+			teleporter,
+			cChainInfo,
+			erc20TokenHomeAddress,
+			remote.info,
+			remote.address,
+			fundedKey,
+			aggregator,
+		)
+	}
+
+	// Generate new recipient to receive transferred tokens
+	recipientKey, err := crypto.GenerateKey()
+	Expect(err).Should(BeNil())
+	recipientAddress := crypto.PubkeyToAddress(recipientKey.PublicKey)
+
+	// Send tokens from C-Chain to L1 A
+	input := erc20tokenhome.SendTokensInput{
+		DestinationBlockchainID:            l1AInfo.BlockchainID,
+		DestinationTokenTransferrerAddress: erc20TokenRemoteAddressA,
+		Recipient:                          recipientAddress,
+		PrimaryFeeTokenAddress:             exampleERC20Address,
+		PrimaryFee:                         big.NewInt(1e18),
+		SecondaryFee:                       big.NewInt(0),
+		RequiredGasLimit:                   utils.DefaultERC20RequiredGas,
+	}
+	receipt, transferredAmount := utils.SendERC20TokenHome(
+		ctx,
+		cChainInfo,
+		erc20TokenHome,
+		erc20TokenHomeAddress,
+		exampleERC20,
+		input,
+		new(big.Int).Mul(big.NewInt(1e18), big.NewInt(13)),
+		fundedKey,
+	)
+	teleporter.RelayTeleporterMessage(ctx, receipt, cChainInfo, l1AInfo, true, fundedKey, nil, aggregator)
+
+	// Send half of the tokens from L1 A to L1 B through the ERC20TokenHome
+	utils.SendNativeTransfer(ctx, l1AInfo, fundedKey, recipientAddress, big.NewInt(1e18))
+	transferredAmount = new(big.Int).Div(transferredAmount, big.NewInt(2))
+	secondaryFeeAmount := new(big.Int).Div(transferredAmount, big.NewInt(4))
+	originReceipt, transferredAmount := utils.SendERC20TokenRemote(
+		ctx,
+		l1AInfo,
+		erc20TokenRemoteA,
+		erc20TokenRemoteAddressA,
+		erc20tokenremote.SendTokensInput{
+			DestinationBlockchainID:            l1BInfo.BlockchainID,
+			DestinationTokenTransferrerAddress: erc20TokenRemoteAddressB,
+			Recipient:                          recipientAddress,
+			PrimaryFeeTokenAddress:             common.Address{},
+			PrimaryFee:                         big.NewInt(0),
+			SecondaryFee:                       secondaryFeeAmount,
+			RequiredGasLimit:                   utils.DefaultERC20RequiredGas,
+			MultiHopFallback:                   recipientAddress,
+		},
+		transferredAmount,
+		recipientKey,
+	)
+
+	// The transfer is pending at its first hop until the message is relayed to the C-Chain.
+	backends := map[ids.ID]icttUtils.TrackerBackend{
+		l1AInfo.BlockchainID:    l1AInfo.RPCClient,
+		cChainInfo.BlockchainID: cChainInfo.RPCClient,
+		l1BInfo.BlockchainID:    l1BInfo.RPCClient,
+	}
+	trace, err := icttUtils.TrackTransfer(ctx, l1AInfo.RPCClient, originReceipt.TxHash, backends, 0)
+	Expect(err).Should(BeNil())
+	Expect(trace.Status).Should(Equal(icttUtils.TransferPending))
+	Expect(trace.StuckAt().DestinationBlockchainID).Should(Equal(cChainInfo.BlockchainID))
+
+	// Once the ERC20TokenHome routes the transfer, it is pending at its second hop.
+	intermediateReceipt := teleporter.RelayTeleporterMessage(
+		ctx,
+		originReceipt,
+		l1AInfo,
+		cChainInfo,
+		true,
+		fundedKey,
+		nil,
+		aggregator,
+	)
+	trace, err = icttUtils.TrackTransfer(ctx, l1AInfo.RPCClient, originReceipt.TxHash, backends, 0)
+	Expect(err).Should(BeNil())
+	Expect(trace.Status).Should(Equal(icttUtils.TransferPending))
+	Expect(trace.Hops).Should(HaveLen(2))
+	Expect(trace.Hops[0].ExecutionTxHash).Should(Equal(intermediateReceipt.TxHash))
+	Expect(trace.StuckAt().DestinationBlockchainID).Should(Equal(l1BInfo.BlockchainID))
+	utils.ExpectBigEqual(trace.SecondaryFee, secondaryFeeAmount)
+
+	// Once relayed to L1 B, the transfer is withdrawn to the recipient.
+	remoteReceipt := teleporter.RelayTeleporterMessage(
+		ctx,
+		intermediateReceipt,
+		cChainInfo,
+		l1BInfo,
+		true,
+		fundedKey,
+		nil,
+		aggregator,
+	)
+	transferredAmount = new(big.Int).Sub(transferredAmount, secondaryFeeAmount)
+	utils.CheckERC20TokenRemoteWithdrawal(
+		ctx,
+		erc20TokenRemoteB,
+		remoteReceipt,
+		recipientAddress,
+		transferredAmount,
+	)
+
+	trace, err = icttUtils.TrackTransfer(ctx, l1AInfo.RPCClient, originReceipt.TxHash, backends, 0)
+	Expect(err).Should(BeNil())
+	Expect(trace.Status).Should(Equal(icttUtils.TransferWithdrawn))
+	Expect(trace.Hops).Should(HaveLen(2))
+	Expect(trace.Hops[1].ReceiveTxHash).Should(Equal(remoteReceipt.TxHash))
+	Expect(trace.Recipient).Should(Equal(recipientAddress))
+	utils.ExpectBigEqual(trace.Amount, transferredAmount)
+
+	balance, err := erc20TokenRemoteB.BalanceOf(&bind.CallOpts{}, recipientAddress)
+	Expect(err).Should(BeNil())
+	utils.ExpectBigEqual(balance, transferredAmount)
+}
@@ -0,0 +1,178 @@
+package teleporter
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	testmessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/tests/TestMessenger"
+	localnetwork "github.com/ava-labs/icm-contracts/tests/network"
+	"github.com/ava-labs/icm-contracts/tests/utils"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/warp"
+	predicateutils "github.com/ava-labs/subnet-evm/predicate"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	. "github.com/onsi/gomega"
+)
+
+// Overestimates beyond this percentage are reported, but do not fail the flow.
+const calibrationMaxDriftPercentage = 50
+
+// GasLimitCalibration delivers messages with varying payload sizes and receipt counts from L1 A
+// to L1 B, and compares the gas used by each receiveCrossChainMessage transaction with
+// CalculateReceiveMessageGasLimit and CalculateReceiveMessageGasLimitExact. The number of
+// signers is determined by the network's validator set, so other signer counts are calibrated by
+// TestCalibrationSignerCounts in gas-utils.
+func GasLimitCalibration(network *localnetwork.LocalNetwork, teleporter utils.TeleporterTestInfo) {
+	l1AInfo, l1BInfo := network.GetTwoL1s()
+	fundedAddress, fundedKey := network.GetFundedAccountInfo()
+	ctx := context.Background()
+
+	testMessengerAddressA, testMessengerA := utils.DeployTestMessenger(
+		ctx,
+		fundedKey,
+		fundedAddress,
+		teleporter.TeleporterRegistryAddress(l1AInfo),
+		l1AInfo,
+	)
+	testMessengerAddressB, testMessengerB := utils.DeployTestMessenger(
+		ctx,
+		fundedKey,
+		fundedAddress,
+		teleporter.TeleporterRegistryAddress(l1BInfo),
+		l1BInfo,
+	)
+
+	aggregator := network.GetSignatureAggregator()
+	defer aggregator.Shutdown()
+
+	stringType, err := abi.NewType("string", "", nil)
+	Expect(err).Should(BeNil())
+	// Durango rules with the Warp precompile enabled, matching the local network's chain config.
+	rules := simulatedUtils.ChainRules()
+
+	testCases := []struct {
+		messageSize int
+		numReceipts int
+	}{
+		{messageSize: 0, numReceipts: 0},
+		{messageSize: 32, numReceipts: 0},
+		{messageSize: 1_000, numReceipts: 0},
+		{messageSize: 10_000, numReceipts: 0},
+		{messageSize: 32, numReceipts: 1},
+		{messageSize: 32, numReceipts: 5},
+		{messageSize: 10_000, numReceipts: 5},
+	}
+
+	var samples []*gasUtils.CalibrationSample
+	for _, testCase := range testCases {
+		// Deliver messages from B to A, so that A attaches receipts for them to its next message to B.
+		for i := 0; i < testCase.numReceipts; i++ {
+			optsB, err := bind.NewKeyedTransactorWithChainID(fundedKey, l1BInfo.EVMChainID)
+			Expect(err).Should(BeNil())
+			tx, err := testMessengerB.SendMessage(
+				optsB, l1AInfo.BlockchainID, testMessengerAddressA, common.Address{}, big.NewInt(0),
+				testmessenger.SendMessageRequiredGas, "receipt",
+			)
+			Expect(err).Should(BeNil())
+			receipt := utils.WaitForTransactionSuccess(ctx, l1BInfo, tx.Hash())
+			teleporter.RelayTeleporterMessage(ctx, receipt, l1BInfo, l1AInfo, true, fundedKey, nil, aggregator)
+		}
+
+		message := strings.Repeat("a", testCase.messageSize)
+		encodedMessage, err := abi.Arguments{{Type: stringType}}.Pack(message)
+		Expect(err).Should(BeNil())
+		executionGas, err := gasUtils.EstimateRequiredGasLimit(
+			ctx,
+			l1BInfo.RPCClient,
+			teleporter.TeleporterMessengerAddress(l1BInfo),
+			testMessengerAddressB,
+			l1AInfo.BlockchainID,
+			testMessengerAddressA,
+			encodedMessage,
+			0,
+		)
+		Expect(err).Should(BeNil())
+		requiredGasLimit, err := gasUtils.AddGasMargin(
+			executionGas.Uint64(),
+			gasUtils.DefaultRequiredGasLimitMarginPercentage,
+		)
+		Expect(err).Should(BeNil())
+
+		optsA, err := bind.NewKeyedTransactorWithChainID(fundedKey, l1AInfo.EVMChainID)
+		Expect(err).Should(BeNil())
+		tx, err := testMessengerA.SendMessage(
+			optsA, l1BInfo.BlockchainID, testMessengerAddressB, common.Address{}, big.NewInt(0),
+			requiredGasLimit, message,
+		)
+		Expect(err).Should(BeNil())
+		sourceReceipt := utils.WaitForTransactionSuccess(ctx, l1AInfo, tx.Hash())
+
+		// Deliver with twice the estimated gas limit so that an underestimate shows up in the
+		// measured gas rather than as a failed delivery.
+		signedMessage := utils.ConstructSignedWarpMessage(ctx, sourceReceipt, l1AInfo, l1BInfo, nil, aggregator)
+		teleporterMessage := utils.ParseTeleporterMessage(signedMessage.UnsignedMessage)
+		Expect(teleporterMessage.Receipts).Should(HaveLen(testCase.numReceipts))
+		numSigners, err := signedMessage.Signature.NumSigners()
+		Expect(err).Should(BeNil())
+		gasLimit, err := gasUtils.CalculateReceiveMessageGasLimit(
+			numSigners,
+			requiredGasLimit,
+			len(signedMessage.Bytes()),
+			len(signedMessage.Payload),
+			len(teleporterMessage.Receipts),
+		)
+		Expect(err).Should(BeNil())
+
+		callData, err := teleportermessenger.PackReceiveCrossChainMessage(0, fundedAddress)
+		Expect(err).Should(BeNil())
+		gasFeeCap, gasTipCap, nonce := utils.CalculateTxParams(ctx, l1BInfo, fundedAddress)
+		teleporterAddress := teleporter.TeleporterMessengerAddress(l1BInfo)
+		deliveryTx := utils.SignTransaction(predicateutils.NewPredicateTx(
+			l1BInfo.EVMChainID,
+			nonce,
+			&teleporterAddress,
+			2*gasLimit,
+			gasFeeCap,
+			gasTipCap,
+			big.NewInt(0),
+			callData,
+			types.AccessList{},
+			warp.ContractAddress,
+			signedMessage.Bytes(),
+		), fundedKey, l1BInfo.EVMChainID)
+		deliveryReceipt := utils.SendTransactionAndWaitForSuccess(ctx, l1BInfo, deliveryTx)
+
+		sample, err := gasUtils.NewCalibrationSample(rules, deliveryTx, deliveryReceipt, executionGas, fundedAddress)
+		Expect(err).Should(BeNil())
+		samples = append(samples, sample)
+	}
+
+	report := &gasUtils.CalibrationReport{
+		Samples:            samples,
+		MaxDriftPercentage: calibrationMaxDriftPercentage,
+	}
+	log.Info("receiveCrossChainMessage gas calibration\n" + report.String())
+	for _, sample := range report.Samples {
+		// The exact estimate only differs from the gas used by how much the Teleporter execution
+		// costs are overestimated.
+		Expect(sample.ExactDrift()).Should(BeNumerically(">=", 0))
+		Expect(sample.ExactDrift()).Should(BeNumerically("<=", calibrationMaxDriftPercentage))
+	}
+	for _, sample := range report.Flagged() {
+		log.Warn(
+			"CalculateReceiveMessageGasLimit drift exceeds threshold",
+			"warpMessageSize", sample.WarpMessageSize,
+			"receipts", sample.NumReceipts,
+			"drift", sample.Drift(),
+		)
+		// Overestimates only cost relayers, but an underestimate causes deliveries to fail.
+		Expect(sample.Drift()).Should(BeNumerically(">=", 0))
+	}
+}
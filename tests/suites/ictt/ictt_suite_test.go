@@ -139,6 +139,11 @@ var _ = ginkgo.Describe("[Validator manager integration tests]", func() {
 		func() {
 			icttFlows.NativeTokenHomeERC20TokenRemoteMultiHop(LocalNetworkInstance, TeleporterInfo)
 		})
+	ginkgo.It("Track an ERC20 token multi-hop transfer",
+		ginkgo.Label(icttLabel, erc20TokenHomeLabel, erc20TokenRemoteLabel, multiHopLabel),
+		func() {
+			icttFlows.ERC20TokenHomeERC20TokenRemoteMultiHopTracking(LocalNetworkInstance, TeleporterInfo)
+		})
 	ginkgo.It("Transfer an ERC20 token to a native token",
 		ginkgo.Label(icttLabel, erc20TokenHomeLabel, nativeTokenRemoteLabel),
 		func() {
@@ -173,6 +173,11 @@ var _ = ginkgo.Describe("[Teleporter integration tests]", func() {
 		func() {
 			teleporterFlows.InsufficientGas(LocalNetworkInstance, TeleporterInfo)
 		})
+	ginkgo.It("Calibrate receive message gas limit",
+		ginkgo.Label(utilsLabel),
+		func() {
+			teleporterFlows.GasLimitCalibration(LocalNetworkInstance, TeleporterInfo)
+		})
 	ginkgo.It("Resubmit altered message",
 		ginkgo.Label(teleporterMessengerLabel),
 		func() {
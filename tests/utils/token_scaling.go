@@ -6,6 +6,7 @@ import (
 	"github.com/ava-labs/avalanchego/ids"
 	erc20tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/ERC20TokenHome"
 	nativetokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/NativeTokenHome"
+	tokenScalingUtils "github.com/ava-labs/icm-contracts/utils/token-scaling-utils"
 	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 
@@ -19,7 +20,9 @@ func ApplyTokenScaling(
 	multiplyOnRemote bool,
 	homeTokenAmount *big.Int,
 ) *big.Int {
-	return scaleTokens(tokenMultiplier, multiplyOnRemote, homeTokenAmount, true)
+	scaledAmount, err := tokenScalingUtils.ApplyTokenScale(tokenMultiplier, multiplyOnRemote, homeTokenAmount)
+	Expect(err).Should(BeNil())
+	return scaledAmount
 }
 
 // RemoveTokenScaling removes token scaling from the given amount of remote tokens.
@@ -29,22 +32,9 @@ func RemoveTokenScaling(
 	multiplyOnRemote bool,
 	remoteTokenAmount *big.Int,
 ) *big.Int {
-	return scaleTokens(tokenMultiplier, multiplyOnRemote, remoteTokenAmount, false)
-}
-
-func scaleTokens(
-	tokenMultiplier *big.Int,
-	multiplyOnRemote bool,
-	amount *big.Int,
-	isSendToRemote bool,
-) *big.Int {
-	// Multiply when multiplyOnRemote and isSendToRemote are
-	// both true or both false.
-	if multiplyOnRemote == isSendToRemote {
-		return big.NewInt(0).Mul(amount, tokenMultiplier)
-	}
-
-	return big.NewInt(0).Div(amount, tokenMultiplier)
+	scaledAmount, err := tokenScalingUtils.RemoveTokenScale(tokenMultiplier, multiplyOnRemote, remoteTokenAmount)
+	Expect(err).Should(BeNil())
+	return scaledAmount
 }
 
 // GetScaledAmountFromERC20TokenHome returns the scaled amount of remote tokens that
@@ -96,11 +86,11 @@ func calculateCollateralNeeded(
 	tokenMultiplier *big.Int,
 	multiplyOnRemote bool,
 ) *big.Int {
-	collateralNeeded := RemoveTokenScaling(tokenMultiplier, multiplyOnRemote, initialReserveImbalance)
-
-	remainder := big.NewInt(0).Mod(collateralNeeded, tokenMultiplier)
-	if multiplyOnRemote && (remainder.Cmp(big.NewInt(0)) != 0) {
-		collateralNeeded.Add(collateralNeeded, big.NewInt(1))
-	}
+	collateralNeeded, err := tokenScalingUtils.CollateralNeeded(
+		tokenMultiplier,
+		multiplyOnRemote,
+		initialReserveImbalance,
+	)
+	Expect(err).Should(BeNil())
 	return collateralNeeded
 }
@@ -4,10 +4,14 @@
 package main
 
 import (
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"log"
+	"math/big"
 	"os"
 	"strconv"
+	"strings"
 
 	deploymentUtils "github.com/ava-labs/icm-contracts/utils/deployment-utils"
 	"github.com/ethereum/go-ethereum/common"
@@ -34,6 +38,45 @@ func main() {
 		if err != nil {
 			log.Panic("Failed to construct keyless transaction.", err)
 		}
+	case "constructKeylessDeployment":
+		// Construct a keyless transaction for any contract, and write it to a JSON manifest.
+		flags := flag.NewFlagSet(commandType, flag.ExitOnError)
+		constructorArgs := flags.String("constructor-args", "", "Hex encoded ABI encoded constructor arguments")
+		gasLimit := flags.Uint64("gas-limit", 0, "Gas limit of the transaction, estimated if not set")
+		gasPrice := flags.String("gas-price", "", "Gas price of the transaction in wei")
+		minBaseFee := flags.String("min-base-fee", "", "Minimum base fee of the target chain in wei")
+		chainMinBaseFees := make(chainMinBaseFeesFlag)
+		flags.Var(chainMinBaseFees, "chain-min-base-fee",
+			"NAME=WEI minimum base fee of another chain to send the transaction on, may be repeated")
+		manifestFileName := flags.String("out", "KeylessDeployment.json", "File to write the manifest to")
+		if err := flags.Parse(os.Args[2:]); err != nil || flags.NArg() != 1 {
+			log.Panic("Invalid arguments. Must provide JSON file containing contract bytecode after any flags.")
+		}
+
+		config := deploymentUtils.KeylessConfig{GasLimit: *gasLimit, ChainMinBaseFees: chainMinBaseFees}
+		var err error
+		if config.ConstructorArgs, err = hex.DecodeString(strings.TrimPrefix(*constructorArgs, "0x")); err != nil {
+			log.Panic("Failed to decode constructor arguments.", err)
+		}
+		if config.GasPrice, err = parseWei(*gasPrice); err != nil {
+			log.Panic("Failed to parse gas price.", err)
+		}
+		if config.MinBaseFee, err = parseWei(*minBaseFee); err != nil {
+			log.Panic("Failed to parse minimum base fee.", err)
+		}
+		deployment, err := deploymentUtils.ConstructKeylessDeployment(flags.Arg(0), config)
+		if err != nil {
+			log.Panic("Failed to construct keyless deployment.", err)
+		}
+		for _, warning := range deployment.Warnings {
+			log.Println("Warning:", warning)
+		}
+		if err := deploymentUtils.WriteKeylessDeployment(*manifestFileName, deployment); err != nil {
+			log.Panic("Failed to write keyless deployment.", err)
+		}
+		log.Println("Keyless Deployer Address: ", deployment.Deployer.Hex())
+		log.Println("Universal Contract Address: ", deployment.ContractAddress.Hex())
+		log.Println("Required Funding: ", deployment.RequiredFunding)
 	case "deriveContractAddress":
 		// Get the byte code of the teleporter contract to be deployed.
 		if len(os.Args) != 4 {
@@ -48,7 +91,65 @@ func main() {
 
 		resultAddress := crypto.CreateAddress(deployerAddress, nonce)
 		fmt.Println(resultAddress.Hex())
+	case "deriveCreate2Address":
+		// Get the address the deterministic deployment proxy deploys the contract to with the salt.
+		if len(os.Args) != 4 && len(os.Args) != 5 {
+			log.Panic("Invalid argument count. Must provide salt, JSON file containing contract bytecode, " +
+				"and optionally hex encoded constructor arguments.")
+		}
+
+		salt, err := deploymentUtils.ParseSalt(os.Args[2])
+		if err != nil {
+			log.Panic("Failed to parse salt.", err)
+		}
+		var constructorArgs []byte
+		if len(os.Args) == 5 {
+			constructorArgs, err = hex.DecodeString(strings.TrimPrefix(os.Args[4], "0x"))
+			if err != nil {
+				log.Panic("Failed to decode constructor arguments.", err)
+			}
+		}
+		initCode, err := deploymentUtils.ReadInitCode(os.Args[3], constructorArgs)
+		if err != nil {
+			log.Panic("Failed to read init code.", err)
+		}
+
+		resultAddress := deploymentUtils.DeriveCreate2Address(salt, initCode)
+		fmt.Println(resultAddress.Hex())
 	default:
-		log.Panic("Invalid command type. Supported options are \"constructKeylessTx\" and \"deriveContractAddress\".")
+		log.Panic("Invalid command type. Supported options are \"constructKeylessTx\", " +
+			"\"constructKeylessDeployment\", \"deriveContractAddress\" and \"deriveCreate2Address\".")
+	}
+}
+
+// chainMinBaseFeesFlag is a repeated NAME=WEI flag.
+type chainMinBaseFeesFlag map[string]*big.Int
+
+func (f chainMinBaseFeesFlag) String() string {
+	return fmt.Sprint(map[string]*big.Int(f))
+}
+
+func (f chainMinBaseFeesFlag) Set(value string) error {
+	name, fee, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected NAME=WEI, got %q", value)
+	}
+	minBaseFee, err := parseWei(fee)
+	if err != nil || minBaseFee == nil {
+		return fmt.Errorf("invalid minimum base fee %q", fee)
+	}
+	f[name] = minBaseFee
+	return nil
+}
+
+// parseWei parses a decimal amount of wei, which is nil if [s] is empty.
+func parseWei(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	amount, ok := new(big.Int).SetString(s, 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount of wei %q", s)
 	}
+	return amount, nil
 }
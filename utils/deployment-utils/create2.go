@@ -0,0 +1,229 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// deterministicDeployerTxHex is the keyless transaction that deploys the deterministic deployment
+// proxy (https://github.com/Arachnid/deterministic-deployment-proxy) to the same address on every
+// chain. Its gas price is 100 gwei and its gas limit is 100,000.
+const deterministicDeployerTxHex = "0xf8a58085174876e800830186a08080b853604580600e600039806000f350fe7ffff" +
+	"fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe03601600081602082378035828234f58015156039578182fd5b" +
+	"8082525050506014600cf31ba02222222222222222222222222222222222222222222222222222222222222222a02222222222222222222" +
+	"222222222222222222222222222222222222222222222"
+
+var (
+	// DeterministicDeployerAddress is the address of the deterministic deployment proxy, which deploys
+	// the init code it is called with after a 32 byte salt with CREATE2.
+	DeterministicDeployerAddress = common.HexToAddress("0x4e59b44847b379578588920cA78FbF26c0B4956C")
+	// DeterministicDeployerSigner is the keyless account that sends the deterministic deployment
+	// proxy's deployment transaction, which must be funded first.
+	DeterministicDeployerSigner = common.HexToAddress("0x3fab184622dc19b6109349b94811493bf2a45362")
+)
+
+// Create2Backend is a chain to deploy contracts to with CREATE2.
+type Create2Backend interface {
+	bind.ContractBackend
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// TxWaiter waits for a transaction to be accepted, and returns its receipt.
+type TxWaiter func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error)
+
+// DeterministicDeployerTransaction returns the keyless transaction that deploys the deterministic
+// deployment proxy.
+func DeterministicDeployerTransaction() (*types.Transaction, error) {
+	txBytes, err := hex.DecodeString(strings.TrimPrefix(deterministicDeployerTxHex, "0x"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode deterministic deployer transaction")
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(txBytes); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal deterministic deployer transaction")
+	}
+	return tx, nil
+}
+
+// DeriveCreate2Address returns the address the deterministic deployment proxy deploys [initCode]
+// to with [salt].
+func DeriveCreate2Address(salt [32]byte, initCode []byte) common.Address {
+	return crypto.CreateAddress2(DeterministicDeployerAddress, salt, crypto.Keccak256(initCode))
+}
+
+// ParseSalt parses a hex encoded CREATE2 salt of at most 32 bytes, which is left padded with zeros.
+func ParseSalt(s string) ([32]byte, error) {
+	var salt [32]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return salt, errors.Wrapf(err, "invalid salt %q", s)
+	}
+	if len(b) > len(salt) {
+		return salt, errors.Errorf("salt %q is longer than 32 bytes", s)
+	}
+	copy(salt[len(salt)-len(b):], b)
+	return salt, nil
+}
+
+// ReadInitCode returns the creation bytecode of the forge artifact [byteCodeFileName], followed by the
+// ABI encoded [constructorArgs].
+func ReadInitCode(byteCodeFileName string, constructorArgs []byte) ([]byte, error) {
+	byteCodeFile, err := extractByteCode(byteCodeFileName)
+	if err != nil {
+		return nil, err
+	}
+	byteCode, err := hex.DecodeString(strings.TrimPrefix(byteCodeFile.ByteCode.Object, "0x"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode bytecode")
+	}
+	return append(byteCode, constructorArgs...), nil
+}
+
+// BindingInitCode returns the creation bytecode of the contract of a generated binding's [metaData],
+// followed by its constructor's ABI encoded [args].
+func BindingInitCode(metaData *bind.MetaData, args ...interface{}) ([]byte, error) {
+	contractABI, err := metaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	if metaData.Bin == "" || strings.Contains(metaData.Bin, "__$") {
+		return nil, errors.New("binding has no bytecode, or links libraries")
+	}
+	byteCode, err := hex.DecodeString(strings.TrimPrefix(metaData.Bin, "0x"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode bytecode")
+	}
+	constructorArgs, err := contractABI.Pack("", args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack constructor arguments")
+	}
+	return append(byteCode, constructorArgs...), nil
+}
+
+// EnsureDeterministicDeployer deploys the deterministic deployment proxy with its keyless transaction
+// if it is not deployed, funding the keyless signer from [opts] first, and returns whether it did.
+func EnsureDeterministicDeployer(
+	ctx context.Context,
+	backend Create2Backend,
+	opts *bind.TransactOpts,
+	wait TxWaiter,
+) (bool, error) {
+	code, err := backend.CodeAt(ctx, DeterministicDeployerAddress, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get deterministic deployer code")
+	}
+	if len(code) > 0 {
+		return false, nil
+	}
+	tx, err := DeterministicDeployerTransaction()
+	if err != nil {
+		return false, err
+	}
+
+	if err := FundKeylessSigner(ctx, backend, opts, wait, DeterministicDeployerSigner, tx); err != nil {
+		return false, err
+	}
+	if err := backend.SendTransaction(ctx, tx); err != nil {
+		return false, errors.Wrap(err, "failed to send deterministic deployer transaction")
+	}
+	if err := waitForSuccess(ctx, wait, tx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FundKeylessSigner transfers to [signer] from [opts] what it lacks to pay for its keyless
+// transaction [tx], if anything.
+func FundKeylessSigner(
+	ctx context.Context,
+	backend Create2Backend,
+	opts *bind.TransactOpts,
+	wait TxWaiter,
+	signer common.Address,
+	tx *types.Transaction,
+) error {
+	balance, err := backend.BalanceAt(ctx, signer, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get balance of keyless signer %s", signer.Hex())
+	}
+	if balance.Cmp(tx.Cost()) >= 0 {
+		return nil
+	}
+	fundOpts := *opts
+	fundOpts.Context = ctx
+	fundOpts.Value = new(big.Int).Sub(tx.Cost(), balance)
+	// Gas can't be estimated for a transfer to an account without code.
+	fundOpts.GasLimit = params.TxGas
+	fundTx, err := bind.NewBoundContract(signer, abi.ABI{}, nil, backend, nil).Transfer(&fundOpts)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fund keyless signer %s", signer.Hex())
+	}
+	return waitForSuccess(ctx, wait, fundTx)
+}
+
+// DeployCreate2 deploys [initCode] with [salt] through the deterministic deployment proxy, which
+// must be deployed, and returns its address. A contract already deployed to the address is reused,
+// in which case the receipt is nil.
+func DeployCreate2(
+	ctx context.Context,
+	backend Create2Backend,
+	opts *bind.TransactOpts,
+	wait TxWaiter,
+	salt [32]byte,
+	initCode []byte,
+) (common.Address, *types.Receipt, error) {
+	address := DeriveCreate2Address(salt, initCode)
+	code, err := backend.CodeAt(ctx, address, nil)
+	if err != nil {
+		return common.Address{}, nil, errors.Wrapf(err, "failed to get code at %s", address.Hex())
+	}
+	if len(code) > 0 {
+		return address, nil, nil
+	}
+
+	deployOpts := *opts
+	deployOpts.Context = ctx
+	deployer := bind.NewBoundContract(DeterministicDeployerAddress, abi.ABI{}, nil, backend, nil)
+	tx, err := deployer.RawTransact(&deployOpts, append(salt[:], initCode...))
+	if err != nil {
+		return common.Address{}, nil, errors.Wrap(err, "failed to deploy with CREATE2")
+	}
+	receipt, err := wait(ctx, tx)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return common.Address{}, nil, errors.Errorf("CREATE2 deployment %s reverted", tx.Hash().Hex())
+	}
+	if code, err = backend.CodeAt(ctx, address, nil); err != nil {
+		return common.Address{}, nil, errors.Wrapf(err, "failed to get code at %s", address.Hex())
+	}
+	if len(code) == 0 {
+		return common.Address{}, nil, errors.Errorf("no contract was deployed to %s", address.Hex())
+	}
+	return address, receipt, nil
+}
+
+func waitForSuccess(ctx context.Context, wait TxWaiter, tx *types.Transaction) error {
+	receipt, err := wait(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return errors.Errorf("transaction %s reverted", tx.Hash().Hex())
+	}
+	return nil
+}
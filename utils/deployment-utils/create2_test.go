@@ -0,0 +1,154 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	validatorsetsig "github.com/ava-labs/icm-contracts/abi-bindings/go/governance/ValidatorSetSig"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeterministicDeployerTransaction(t *testing.T) {
+	tx, err := DeterministicDeployerTransaction()
+	require.NoError(t, err)
+	require.False(t, tx.Protected())
+	sender, err := types.HomesteadSigner{}.Sender(tx)
+	require.NoError(t, err)
+	require.Equal(t, DeterministicDeployerSigner, sender)
+	require.Equal(t, DeterministicDeployerAddress, crypto.CreateAddress(sender, 0))
+}
+
+func TestParseSalt(t *testing.T) {
+	salt, err := ParseSalt("0x0102")
+	require.NoError(t, err)
+	require.Equal(t, common.HexToHash("0x0102"), common.Hash(salt))
+	salt, err = ParseSalt(common.HexToHash("0xff").Hex()[2:])
+	require.NoError(t, err)
+	require.Equal(t, common.HexToHash("0xff"), common.Hash(salt))
+	_, err = ParseSalt("0x" + common.Bytes2Hex(make([]byte, 33)))
+	require.ErrorContains(t, err, "is longer than 32 bytes")
+	_, err = ParseSalt("salt")
+	require.ErrorContains(t, err, "invalid salt")
+}
+
+func TestDeriveCreate2Address(t *testing.T) {
+	// Example 0 of EIP-1014: the zero deployer and salt, and init code 0x00.
+	initCode := common.FromHex("0x00")
+	require.Equal(t,
+		common.HexToAddress("0x4D1A2e2bB4F88F0250f26Ffff098B0b30B26BF38"),
+		crypto.CreateAddress2(common.Address{}, [32]byte{}, crypto.Keccak256(initCode)),
+	)
+	// The same salt and init code deployed by the deterministic deployment proxy.
+	require.Equal(t,
+		common.HexToAddress("0x24C4fD2Db1Cf4Cb1aEc651CC0E060A00D400e784"),
+		DeriveCreate2Address([32]byte{}, initCode),
+	)
+
+	path := filepath.Join(t.TempDir(), "Contract.json")
+	require.NoError(t, os.WriteFile(path,
+		[]byte(`{"bytecode": {"object": "0x6080"}, "deployedBytecode": {"object": "0x60"}}`), 0o600))
+	initCode, err := ReadInitCode(path, common.FromHex("0x01"))
+	require.NoError(t, err)
+	require.Equal(t, common.FromHex("0x608001"), initCode)
+}
+
+func TestFundKeylessSigner(t *testing.T) {
+	ctx := context.Background()
+	key, address, err := simulatedUtils.NewFundedKey()
+	require.NoError(t, err)
+	backend := simulatedUtils.NewSimulatedBackend(address)
+	defer backend.Close()
+	opts, err := simulatedUtils.NewTransactor(key)
+	require.NoError(t, err)
+	client := backend.Client()
+	wait := func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+		return simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+	}
+	tx, err := DeterministicDeployerTransaction()
+	require.NoError(t, err)
+
+	// A signer that holds part of the cost, which it was funded with for a cheaper transaction, is
+	// topped up to it.
+	signer := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	partialOpts := *opts
+	partialOpts.Value = new(big.Int).Div(tx.Cost(), big.NewInt(3))
+	require.NoError(t, FundKeylessSigner(ctx, client, &partialOpts, wait, signer,
+		types.NewTx(&types.LegacyTx{Gas: 1, GasPrice: partialOpts.Value})))
+	require.NoError(t, FundKeylessSigner(ctx, client, opts, wait, signer, tx))
+	balance, err := client.BalanceAt(ctx, signer, nil)
+	require.NoError(t, err)
+	require.Equal(t, tx.Cost(), balance)
+
+	// A funded signer is left as it is.
+	block, err := client.BlockNumber(ctx)
+	require.NoError(t, err)
+	require.NoError(t, FundKeylessSigner(ctx, client, opts, wait, signer, tx))
+	next, err := client.BlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, block, next)
+}
+
+func TestDeployCreate2(t *testing.T) {
+	ctx := context.Background()
+	key, address, err := simulatedUtils.NewFundedKey()
+	require.NoError(t, err)
+	backend := simulatedUtils.NewSimulatedBackend(address)
+	defer backend.Close()
+	opts, err := simulatedUtils.NewTransactor(key)
+	require.NoError(t, err)
+	client := backend.Client()
+	wait := func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+		return simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+	}
+
+	deployed, err := EnsureDeterministicDeployer(ctx, client, opts, wait)
+	require.NoError(t, err)
+	require.True(t, deployed)
+	deployed, err = EnsureDeterministicDeployer(ctx, client, opts, wait)
+	require.NoError(t, err)
+	require.False(t, deployed)
+
+	// The same registry is deployed to the same address on every chain.
+	salt, err := ParseSalt("0x01")
+	require.NoError(t, err)
+	initCode, err := BindingInitCode(teleporterregistry.TeleporterRegistryMetaData,
+		[]teleporterregistry.ProtocolRegistryEntry{{Version: big.NewInt(1), ProtocolAddress: common.Address{1}}})
+	require.NoError(t, err)
+	address, receipt, err := DeployCreate2(ctx, client, opts, wait, salt, initCode)
+	require.NoError(t, err)
+	require.NotNil(t, receipt)
+	require.Equal(t, DeriveCreate2Address(salt, initCode), address)
+	registry, err := teleporterregistry.NewTeleporterRegistry(address, client)
+	require.NoError(t, err)
+	protocolAddress, err := registry.GetAddressFromVersion(nil, big.NewInt(1))
+	require.NoError(t, err)
+	require.Equal(t, common.Address{1}, protocolAddress)
+
+	reused, receipt, err := DeployCreate2(ctx, client, opts, wait, salt, initCode)
+	require.NoError(t, err)
+	require.Nil(t, receipt)
+	require.Equal(t, address, reused)
+
+	// Constructor arguments are part of the init code, and so of the address.
+	initCode, err = BindingInitCode(validatorsetsig.ValidatorSetSigMetaData, [32]byte{1})
+	require.NoError(t, err)
+	sigAddress, _, err := DeployCreate2(ctx, client, opts, wait, salt, initCode)
+	require.NoError(t, err)
+	otherInitCode, err := BindingInitCode(validatorsetsig.ValidatorSetSigMetaData, [32]byte{2})
+	require.NoError(t, err)
+	require.NotEqual(t, sigAddress, DeriveCreate2Address(salt, otherInitCode))
+
+	_, err = BindingInitCode(validatorsetsig.ValidatorSetSigMetaData)
+	require.ErrorContains(t, err, "failed to pack constructor arguments")
+}
@@ -70,14 +70,6 @@ func ConstructKeylessTransaction(
 	writeFile bool,
 	contractCreationGasPrice *big.Int,
 ) ([]byte, string, common.Address, common.Address, error) {
-	// Convert the R and S values (which must be the same) from hex.
-	rsValue, ok := new(big.Int).SetString(rsValueHex, 16)
-	if !ok {
-		return nil, "", common.Address{}, common.Address{}, errors.New(
-			"Failed to convert R and S value to big.Int.",
-		)
-	}
-
 	byteCodeFile, err := extractByteCode(byteCodeFileName)
 	if err != nil {
 		return nil, "", common.Address{}, common.Address{}, err
@@ -89,26 +81,13 @@ func ConstructKeylessTransaction(
 		return nil, "", common.Address{}, common.Address{}, err
 	}
 
-	// Construct the legacy transaction with pre-determined signature values.
-	contractCreationTx := types.NewTx(&types.LegacyTx{
-		Nonce:    0,
-		Gas:      defaultContractCreationGasLimit,
-		GasPrice: contractCreationGasPrice,
-		To:       nil, // Contract creation transaction
-		Value:    big.NewInt(0),
-		Data:     byteCode,
-		V:        vValue,
-		R:        rsValue,
-		S:        rsValue,
-	})
-
-	// Recover the "sender" address of the transaction.
-	senderAddress, err := types.HomesteadSigner{}.Sender(contractCreationTx)
+	contractCreationTx, senderAddress, err := newKeylessTransaction(
+		byteCode,
+		defaultContractCreationGasLimit,
+		contractCreationGasPrice,
+	)
 	if err != nil {
-		return nil, "", common.Address{}, common.Address{}, errors.Wrap(
-			err,
-			"Failed to recover the sender address of transaction",
-		)
+		return nil, "", common.Address{}, common.Address{}, err
 	}
 
 	// Serialize the raw transaction and sender address.
@@ -165,6 +144,39 @@ func ConstructKeylessTransaction(
 	return contractCreationTxBytes, byteCodeFile.DeployedByteCode.Object, senderAddress, contractAddress, nil
 }
 
+// Constructs a legacy contract creation transaction with pre-determined signature values,
+// and recovers its "sender" address.
+func newKeylessTransaction(
+	byteCode []byte,
+	gasLimit uint64,
+	gasPrice *big.Int,
+) (*types.Transaction, common.Address, error) {
+	// Convert the R and S values (which must be the same) from hex.
+	rsValue, ok := new(big.Int).SetString(rsValueHex, 16)
+	if !ok {
+		return nil, common.Address{}, errors.New("Failed to convert R and S value to big.Int.")
+	}
+
+	contractCreationTx := types.NewTx(&types.LegacyTx{
+		Nonce:    0,
+		Gas:      gasLimit,
+		GasPrice: gasPrice,
+		To:       nil, // Contract creation transaction
+		Value:    big.NewInt(0),
+		Data:     byteCode,
+		V:        vValue,
+		R:        rsValue,
+		S:        rsValue,
+	})
+
+	// Recover the "sender" address of the transaction.
+	senderAddress, err := types.HomesteadSigner{}.Sender(contractCreationTx)
+	if err != nil {
+		return nil, common.Address{}, errors.Wrap(err, "Failed to recover the sender address of transaction")
+	}
+	return contractCreationTx, senderAddress, nil
+}
+
 func GetDefaultContractCreationGasPrice() *big.Int {
 	gasPrice := big.NewInt(0)
 	gasPrice.Set(defaultContractCreationGasPrice)
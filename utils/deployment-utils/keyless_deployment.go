@@ -0,0 +1,192 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// keylessGasPriceMultiplier is how many times a target chain's minimum base fee the gas price of a
+// keyless transaction is, so that it can still be sent when the base fee rises. The default gas price
+// is the same multiple of the C-Chain's minimum base fee of 25 nAVAX.
+const keylessGasPriceMultiplier = 100
+
+// KeylessConfig configures the keyless transaction constructed by ConstructKeylessDeployment.
+type KeylessConfig struct {
+	// ConstructorArgs are the ABI encoded constructor arguments appended to the bytecode.
+	ConstructorArgs []byte
+	// GasLimit is the gas limit of the transaction. If zero, the gas the init code uses is estimated,
+	// and padded by a quarter.
+	GasLimit uint64
+	// GasPrice is the gas price of the transaction. If nil, it is a multiple of MinBaseFee, or the
+	// default contract creation gas price if MinBaseFee is nil too.
+	GasPrice *big.Int
+	// MinBaseFee is the minimum base fee of the target chain, which the gas price must be above.
+	MinBaseFee *big.Int
+	// ChainMinBaseFees are the minimum base fees of the other chains, by name, the transaction is
+	// meant to be sent on. Chains whose minimum base fee is above the gas price are warned about.
+	ChainMinBaseFees map[string]*big.Int
+}
+
+// KeylessDeployment is a keyless transaction that deploys a contract to the same address on every
+// chain it is sent on, and what is needed to send it.
+type KeylessDeployment struct {
+	Transaction     hexutil.Bytes  `json:"transaction"`
+	Deployer        common.Address `json:"deployer"`
+	ContractAddress common.Address `json:"contractAddress"`
+	GasLimit        uint64         `json:"gasLimit"`
+	GasPrice        *big.Int       `json:"gasPrice"`
+	// RequiredFunding is the balance the deployer needs to pay for the transaction.
+	RequiredFunding *big.Int `json:"requiredFunding"`
+	// DeployedBytecodeHash is the hash of the code the init code deploys, as executed on a simulated
+	// chain, which the contract's code hash must match after the transaction is sent.
+	DeployedBytecodeHash common.Hash `json:"deployedBytecodeHash"`
+	Warnings             []string    `json:"warnings,omitempty"`
+}
+
+// ConstructKeylessDeployment constructs a keyless transaction using Nick's method that deploys the
+// forge artifact [byteCodeFileName] with the gas limit and gas price chosen by [config]. The init code
+// is executed on a simulated chain to estimate its gas and get the code it deploys.
+func ConstructKeylessDeployment(byteCodeFileName string, config KeylessConfig) (*KeylessDeployment, error) {
+	byteCodeFile, err := extractByteCode(byteCodeFileName)
+	if err != nil {
+		return nil, err
+	}
+	byteCode, err := hex.DecodeString(strings.TrimPrefix(byteCodeFile.ByteCode.Object, "0x"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode bytecode")
+	}
+	initCode := append(byteCode, config.ConstructorArgs...)
+
+	gasPrice, err := chooseKeylessGasPrice(config)
+	if err != nil {
+		return nil, err
+	}
+	gasUsed, deployedByteCodeHash, err := simulateDeployment(initCode)
+	if err != nil {
+		return nil, err
+	}
+	gasLimit := config.GasLimit
+	if gasLimit == 0 {
+		gasLimit = gasUsed + gasUsed/4
+	} else if gasLimit < gasUsed {
+		return nil, errors.Errorf("gas limit %d is below the %d gas the deployment uses", gasLimit, gasUsed)
+	}
+
+	contractCreationTx, senderAddress, err := newKeylessTransaction(initCode, gasLimit, gasPrice)
+	if err != nil {
+		return nil, err
+	}
+	contractCreationTxBytes, err := contractCreationTx.MarshalBinary()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to serialize raw transaction")
+	}
+	return &KeylessDeployment{
+		Transaction:          contractCreationTxBytes,
+		Deployer:             senderAddress,
+		ContractAddress:      crypto.CreateAddress(senderAddress, 0),
+		GasLimit:             gasLimit,
+		GasPrice:             gasPrice,
+		RequiredFunding:      contractCreationTx.Cost(),
+		DeployedBytecodeHash: deployedByteCodeHash,
+		Warnings:             keylessWarnings(gasPrice, config.ChainMinBaseFees),
+	}, nil
+}
+
+// WriteKeylessDeployment writes [deployment] to the JSON manifest [fileName].
+func WriteKeylessDeployment(fileName string, deployment *KeylessDeployment) error {
+	data, err := json.MarshalIndent(deployment, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal keyless deployment")
+	}
+	if err := os.WriteFile(fileName, append(data, '\n'), 0o644); err != nil {
+		return errors.Wrap(err, "Failed to write keyless deployment manifest")
+	}
+	return nil
+}
+
+func chooseKeylessGasPrice(config KeylessConfig) (*big.Int, error) {
+	if config.GasPrice == nil {
+		if config.MinBaseFee == nil {
+			return GetDefaultContractCreationGasPrice(), nil
+		}
+		return new(big.Int).Mul(config.MinBaseFee, big.NewInt(keylessGasPriceMultiplier)), nil
+	}
+	if config.MinBaseFee != nil && config.GasPrice.Cmp(config.MinBaseFee) <= 0 {
+		return nil, errors.Errorf("gas price %s is not above the target chain's minimum base fee %s",
+			config.GasPrice, config.MinBaseFee)
+	}
+	return new(big.Int).Set(config.GasPrice), nil
+}
+
+// keylessWarnings returns a warning for each chain the transaction would fail on, because its minimum
+// base fee is above [gasPrice]. A keyless transaction can't be re-signed with a higher gas price.
+func keylessWarnings(gasPrice *big.Int, chainMinBaseFees map[string]*big.Int) []string {
+	chains := make([]string, 0, len(chainMinBaseFees))
+	for chain := range chainMinBaseFees {
+		chains = append(chains, chain)
+	}
+	sort.Strings(chains)
+	var warnings []string
+	for _, chain := range chains {
+		minBaseFee := chainMinBaseFees[chain]
+		if minBaseFee.Cmp(gasPrice) > 0 {
+			warnings = append(warnings, fmt.Sprintf(
+				"the transaction would fail on %s, whose minimum base fee %s is above its gas price %s",
+				chain, minBaseFee, gasPrice))
+		}
+	}
+	return warnings
+}
+
+// simulateDeployment deploys [initCode] to a simulated chain, and returns the gas it needs and the hash
+// of the code it deploys.
+func simulateDeployment(initCode []byte) (uint64, common.Hash, error) {
+	ctx := context.Background()
+	key, address, err := simulatedUtils.NewFundedKey()
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	backend := simulatedUtils.NewSimulatedBackend(address)
+	defer backend.Close()
+	client := backend.Client()
+
+	gasUsed, err := client.EstimateGas(ctx, interfaces.CallMsg{From: address, Data: initCode})
+	if err != nil {
+		return 0, common.Hash{}, errors.Wrap(err, "Failed to estimate the deployment's gas")
+	}
+	opts, err := simulatedUtils.NewTransactor(key)
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	opts.GasLimit = gasUsed
+	contractAddress, tx, _, err := bind.DeployContract(opts, abi.ABI{}, initCode, client)
+	if err != nil {
+		return 0, common.Hash{}, errors.Wrap(err, "Failed to simulate the deployment")
+	}
+	if _, err := simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash()); err != nil {
+		return 0, common.Hash{}, errors.Wrap(err, "Failed to simulate the deployment")
+	}
+	code, err := client.CodeAt(ctx, contractAddress, nil)
+	if err != nil {
+		return 0, common.Hash{}, errors.Wrap(err, "Failed to get the deployed code")
+	}
+	return gasUsed, crypto.Keccak256Hash(code), nil
+}
@@ -0,0 +1,113 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	validatorsetsig "github.com/ava-labs/icm-contracts/abi-bindings/go/governance/ValidatorSetSig"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func writeArtifact(t *testing.T, metaData *bind.MetaData) string {
+	path := filepath.Join(t.TempDir(), "Contract.json")
+	data, err := json.Marshal(byteCodeFile{ByteCode: byteCodeObj{Object: metaData.Bin}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestConstructKeylessDeployment(t *testing.T) {
+	// With the gas limit and price of ConstructKeylessTransaction, the transaction is the same.
+	path := writeArtifact(t, teleportermessenger.TeleporterMessengerMetaData)
+	gasPrice := big.NewInt(2500e9)
+	txBytes, _, deployer, contractAddress, err := ConstructKeylessTransaction(path, false, gasPrice)
+	require.NoError(t, err)
+	deployment, err := ConstructKeylessDeployment(path, KeylessConfig{
+		GasLimit: defaultContractCreationGasLimit,
+		GasPrice: gasPrice,
+	})
+	require.NoError(t, err)
+	require.Equal(t, txBytes, []byte(deployment.Transaction))
+	require.Equal(t, deployer, deployment.Deployer)
+	require.Equal(t, contractAddress, deployment.ContractAddress)
+	require.Equal(t, new(big.Int).Mul(gasPrice, big.NewInt(4_000_000)), deployment.RequiredFunding)
+
+	_, err = ConstructKeylessDeployment(path, KeylessConfig{GasLimit: 100_000, GasPrice: gasPrice})
+	require.ErrorContains(t, err, "gas the deployment uses")
+	_, err = ConstructKeylessDeployment(path, KeylessConfig{GasPrice: big.NewInt(25e9), MinBaseFee: big.NewInt(25e9)})
+	require.ErrorContains(t, err, "is not above the target chain's minimum base fee")
+
+	// The gas limit is estimated, and the gas price chosen from the target chain's minimum base fee.
+	path = writeArtifact(t, validatorsetsig.ValidatorSetSigMetaData)
+	contractABI, err := validatorsetsig.ValidatorSetSigMetaData.GetAbi()
+	require.NoError(t, err)
+	constructorArgs, err := contractABI.Pack("", [32]byte{1})
+	require.NoError(t, err)
+	deployment, err = ConstructKeylessDeployment(path, KeylessConfig{
+		ConstructorArgs: constructorArgs,
+		MinBaseFee:      big.NewInt(1e9),
+		ChainMinBaseFees: map[string]*big.Int{
+			"expensive": big.NewInt(5000e9),
+			"cheap":     big.NewInt(1),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(100e9), deployment.GasPrice)
+	require.Less(t, deployment.GasLimit, defaultContractCreationGasLimit)
+	require.Equal(t, []string{
+		"the transaction would fail on expensive, whose minimum base fee 5000000000000 is above its gas price " +
+			"100000000000",
+	}, deployment.Warnings)
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, WriteKeylessDeployment(manifestPath, deployment))
+	data, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+	var manifest KeylessDeployment
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, *deployment, manifest)
+
+	// Sending the transaction deploys the code the manifest expects.
+	ctx := context.Background()
+	key, address, err := simulatedUtils.NewFundedKey()
+	require.NoError(t, err)
+	backend := simulatedUtils.NewSimulatedBackend(address)
+	defer backend.Close()
+	opts, err := simulatedUtils.NewTransactor(key)
+	require.NoError(t, err)
+	opts.Value = deployment.RequiredFunding
+	opts.GasLimit = params.TxGas
+	tx, err := bind.NewBoundContract(deployment.Deployer, abi.ABI{}, nil, backend.Client(), nil).Transfer(opts)
+	require.NoError(t, err)
+	_, err = simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+	require.NoError(t, err)
+	tx = new(types.Transaction)
+	require.NoError(t, tx.UnmarshalBinary(deployment.Transaction))
+	require.NoError(t, backend.Client().SendTransaction(ctx, tx))
+	_, err = simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+	require.NoError(t, err)
+	code, err := backend.Client().CodeAt(ctx, deployment.ContractAddress, nil)
+	require.NoError(t, err)
+	require.Equal(t, deployment.DeployedBytecodeHash, crypto.Keccak256Hash(code))
+	sig, err := validatorsetsig.NewValidatorSetSig(deployment.ContractAddress, backend.Client())
+	require.NoError(t, err)
+	blockchainID, err := sig.ValidatorBlockchainID(nil)
+	require.NoError(t, err)
+	require.Equal(t, [32]byte{1}, blockchainID)
+	require.NotEqual(t, common.Hash{}, deployment.DeployedBytecodeHash)
+}
@@ -0,0 +1,238 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/crypto/bls"
+	"github.com/ava-labs/avalanchego/utils/set"
+	avalancheWarp "github.com/ava-labs/avalanchego/vms/platformvm/warp"
+	"github.com/ava-labs/avalanchego/vms/platformvm/warp/payload"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxReceiptsPerMessage is the maximum number of receipts TeleporterMessenger
+	// attaches to a single message, defined in ReceiptQueue.sol.
+	MaxReceiptsPerMessage = 5
+
+	DefaultFeeHistoryBlockCount uint64  = 20
+	DefaultRewardPercentile     float64 = 50
+	DefaultMarkupPercentage     uint64  = 10
+)
+
+// DeliveryParams describes a Teleporter message whose delivery cost is being estimated.
+type DeliveryParams struct {
+	// NumSigners is the expected number of validator signatures in the aggregate signature.
+	NumSigners int
+	// RequiredGasLimit is the gas limit requested for message execution on the destination chain.
+	RequiredGasLimit *big.Int
+	// MessageSize is the size in bytes of the application message payload.
+	MessageSize int
+	// NumReceipts is the number of receipts attached to the message, at most MaxReceiptsPerMessage.
+	NumReceipts int
+	// NumAllowedRelayers is the length of the message's allowed relayer list.
+	NumAllowedRelayers int
+}
+
+// MessageSizes returns the size of the signed Warp message and of the ABI encoded Teleporter message
+// that a relayer would deliver for a message matching [params]. Both sizes depend only on the lengths
+// of the variable sized fields, so they are computed by encoding a zero valued message of the same shape.
+func MessageSizes(params DeliveryParams) (int, int, error) {
+	if params.NumSigners <= 0 {
+		return 0, 0, errors.New("number of signers must be positive")
+	}
+	if params.NumReceipts < 0 || params.NumReceipts > MaxReceiptsPerMessage {
+		return 0, 0, errors.Errorf("number of receipts must be between 0 and %d", MaxReceiptsPerMessage)
+	}
+	if params.MessageSize < 0 || params.NumAllowedRelayers < 0 {
+		return 0, 0, errors.New("message size and number of allowed relayers must not be negative")
+	}
+
+	teleporterMessage := teleportermessenger.TeleporterMessage{
+		MessageNonce:            big.NewInt(0),
+		RequiredGasLimit:        big.NewInt(0),
+		AllowedRelayerAddresses: make([]common.Address, params.NumAllowedRelayers),
+		Receipts:                make([]teleportermessenger.TeleporterMessageReceipt, params.NumReceipts),
+		Message:                 make([]byte, params.MessageSize),
+	}
+	for i := range teleporterMessage.Receipts {
+		teleporterMessage.Receipts[i].ReceivedMessageNonce = big.NewInt(0)
+	}
+	teleporterMessageBytes, err := teleporterMessage.Pack()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to pack Teleporter message")
+	}
+
+	addressedCall, err := payload.NewAddressedCall(common.Address{}.Bytes(), teleporterMessageBytes)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to create addressed call payload")
+	}
+	unsignedMessage, err := avalancheWarp.NewUnsignedMessage(0, ids.Empty, addressedCall.Bytes())
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to create unsigned Warp message")
+	}
+	signers := make([]int, params.NumSigners)
+	for i := range signers {
+		signers[i] = i
+	}
+	signedMessage, err := avalancheWarp.NewMessage(unsignedMessage, &avalancheWarp.BitSetSignature{
+		Signers:   set.NewBits(signers...).Bytes(),
+		Signature: [bls.SignatureLen]byte{},
+	})
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to create signed Warp message")
+	}
+
+	return len(signedMessage.Bytes()), len(teleporterMessageBytes), nil
+}
+
+// EstimateDeliveryGas returns the gas limit a relayer sets on the receiveCrossChainMessage
+// transaction that delivers a message matching [params].
+func EstimateDeliveryGas(params DeliveryParams) (uint64, error) {
+	warpMessageSize, teleporterMessageSize, err := MessageSizes(params)
+	if err != nil {
+		return 0, err
+	}
+	return gasUtils.CalculateReceiveMessageGasLimit(
+		params.NumSigners,
+		params.RequiredGasLimit,
+		warpMessageSize,
+		teleporterMessageSize,
+		params.NumReceipts,
+	)
+}
+
+// EstimateGasPrice returns the gas price a relayer can expect to pay on the destination chain.
+// It takes the highest base fee over the last [blockCount] blocks, including the base fee of the
+// next block, and adds the [rewardPercentile] priority fee of the most recent block that included
+// transactions. If no recent block has priority fee data, MaxPriorityFeePerGas is used.
+func EstimateGasPrice(
+	ctx context.Context,
+	client interfaces.FeeHistoryReader,
+	blockCount uint64,
+	rewardPercentile float64,
+) (*big.Int, error) {
+	feeHistory, err := client.FeeHistory(ctx, blockCount, nil, []float64{rewardPercentile})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get fee history")
+	}
+	if len(feeHistory.BaseFee) == 0 {
+		return nil, errors.New("fee history returned no base fees")
+	}
+
+	baseFee := new(big.Int)
+	for _, fee := range feeHistory.BaseFee {
+		if fee != nil && fee.Cmp(baseFee) > 0 {
+			baseFee.Set(fee)
+		}
+	}
+
+	tip := big.NewInt(gasUtils.MaxPriorityFeePerGas)
+	for i := len(feeHistory.Reward) - 1; i >= 0; i-- {
+		if len(feeHistory.Reward[i]) > 0 && feeHistory.Reward[i][0] != nil && feeHistory.Reward[i][0].Sign() > 0 {
+			tip = feeHistory.Reward[i][0]
+			break
+		}
+	}
+
+	return baseFee.Add(baseFee, tip), nil
+}
+
+// FeeEstimate is the result of a relayer fee estimation.
+type FeeEstimate struct {
+	// DeliveryGas is the gas limit of the receiveCrossChainMessage transaction.
+	DeliveryGas uint64
+	// GasPrice is the expected gas price on the destination chain, in wei.
+	GasPrice *big.Int
+	// NativeCost is DeliveryGas * GasPrice, in the destination chain's native token.
+	NativeCost *big.Int
+	// FeeAmount is NativeCost with the relayer markup applied, in fee token units.
+	FeeAmount *big.Int
+}
+
+// FeeEstimator estimates the fee to attach to a Teleporter message so that a relayer
+// delivering it to the destination chain is compensated for the delivery transaction.
+type FeeEstimator struct {
+	DestinationClient interfaces.FeeHistoryReader
+	PriceOracle       PriceOracle
+	// FeeHistoryBlockCount is the number of destination blocks considered when pricing gas.
+	FeeHistoryBlockCount uint64
+	// RewardPercentile is the priority fee percentile used when pricing gas.
+	RewardPercentile float64
+	// MarkupPercentage is added on top of the delivery cost as the relayer's margin.
+	MarkupPercentage uint64
+}
+
+// NewFeeEstimator creates a FeeEstimator with the default fee history window, reward
+// percentile and markup.
+func NewFeeEstimator(destinationClient interfaces.FeeHistoryReader, priceOracle PriceOracle) *FeeEstimator {
+	return &FeeEstimator{
+		DestinationClient:    destinationClient,
+		PriceOracle:          priceOracle,
+		FeeHistoryBlockCount: DefaultFeeHistoryBlockCount,
+		RewardPercentile:     DefaultRewardPercentile,
+		MarkupPercentage:     DefaultMarkupPercentage,
+	}
+}
+
+// EstimateFee estimates the fee, denominated in [feeTokenAddress], to attach to a message
+// matching [params] sent to [destinationBlockchainID].
+func (e *FeeEstimator) EstimateFee(
+	ctx context.Context,
+	destinationBlockchainID ids.ID,
+	feeTokenAddress common.Address,
+	params DeliveryParams,
+) (*FeeEstimate, error) {
+	deliveryGas, err := EstimateDeliveryGas(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to estimate delivery gas")
+	}
+	gasPrice, err := EstimateGasPrice(ctx, e.DestinationClient, e.FeeHistoryBlockCount, e.RewardPercentile)
+	if err != nil {
+		return nil, err
+	}
+	nativeCost := new(big.Int).Mul(new(big.Int).SetUint64(deliveryGas), gasPrice)
+
+	rate, err := e.PriceOracle.Rate(ctx, destinationBlockchainID, feeTokenAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get fee token price")
+	}
+	feeAmount := ConvertAmount(nativeCost, rate)
+	feeAmount = ApplyMarkup(feeAmount, e.MarkupPercentage)
+
+	return &FeeEstimate{
+		DeliveryGas: deliveryGas,
+		GasPrice:    gasPrice,
+		NativeCost:  nativeCost,
+		FeeAmount:   feeAmount,
+	}, nil
+}
+
+// ConvertAmount converts [amount] to another denomination using [rate], rounding up.
+func ConvertAmount(amount *big.Int, rate *big.Rat) *big.Int {
+	numerator := new(big.Int).Mul(amount, rate.Num())
+	return ceilDiv(numerator, rate.Denom())
+}
+
+// ApplyMarkup returns [amount] increased by [markupPercentage] percent, rounded up.
+func ApplyMarkup(amount *big.Int, markupPercentage uint64) *big.Int {
+	numerator := new(big.Int).Mul(amount, new(big.Int).SetUint64(100+markupPercentage))
+	return ceilDiv(numerator, big.NewInt(100))
+}
+
+func ceilDiv(x, y *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(x, y, new(big.Int))
+	if remainder.Sign() > 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	return quotient
+}
@@ -0,0 +1,207 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+type mockFeeHistoryReader struct {
+	feeHistory *interfaces.FeeHistory
+}
+
+func (m *mockFeeHistoryReader) FeeHistory(
+	context.Context,
+	uint64,
+	*big.Int,
+	[]float64,
+) (*interfaces.FeeHistory, error) {
+	return m.feeHistory, nil
+}
+
+func TestMessageSizes(t *testing.T) {
+	testCases := []struct {
+		name                          string
+		params                        DeliveryParams
+		expectedWarpMessageSize       int
+		expectedTeleporterMessageSize int
+		expectedError                 bool
+	}{
+		{
+			name:                          "empty message",
+			params:                        DeliveryParams{NumSigners: 1},
+			expectedWarpMessageSize:       565,
+			expectedTeleporterMessageSize: 384,
+		},
+		{
+			name: "message with receipts and relayers",
+			params: DeliveryParams{
+				NumSigners:         9,
+				MessageSize:        33,
+				NumReceipts:        2,
+				NumAllowedRelayers: 1,
+			},
+			// 384 + 64 message bytes + 2*64 receipts + 32 relayer
+			expectedTeleporterMessageSize: 608,
+			// 181 bytes of Warp overhead with a 2 byte signer bit set
+			expectedWarpMessageSize: 790,
+		},
+		{
+			name:          "no signers",
+			params:        DeliveryParams{},
+			expectedError: true,
+		},
+		{
+			name:          "too many receipts",
+			params:        DeliveryParams{NumSigners: 1, NumReceipts: MaxReceiptsPerMessage + 1},
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			warpMessageSize, teleporterMessageSize, err := MessageSizes(testCase.params)
+			if testCase.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedWarpMessageSize, warpMessageSize)
+			require.Equal(t, testCase.expectedTeleporterMessageSize, teleporterMessageSize)
+		})
+	}
+}
+
+func TestEstimateDeliveryGas(t *testing.T) {
+	params := DeliveryParams{
+		NumSigners:       5,
+		RequiredGasLimit: big.NewInt(100_000),
+		MessageSize:      100,
+		NumReceipts:      3,
+	}
+	warpMessageSize, teleporterMessageSize, err := MessageSizes(params)
+	require.NoError(t, err)
+	expected, err := gasUtils.CalculateReceiveMessageGasLimit(
+		5,
+		big.NewInt(100_000),
+		warpMessageSize,
+		teleporterMessageSize,
+		3,
+	)
+	require.NoError(t, err)
+
+	gas, err := EstimateDeliveryGas(params)
+	require.NoError(t, err)
+	require.Equal(t, expected, gas)
+}
+
+func TestEstimateGasPrice(t *testing.T) {
+	testCases := []struct {
+		name          string
+		feeHistory    *interfaces.FeeHistory
+		expected      *big.Int
+		expectedError bool
+	}{
+		{
+			name: "max base fee plus latest tip",
+			feeHistory: &interfaces.FeeHistory{
+				BaseFee: []*big.Int{big.NewInt(30), big.NewInt(50), big.NewInt(40)},
+				Reward:  [][]*big.Int{{big.NewInt(3)}, {big.NewInt(7)}},
+			},
+			expected: big.NewInt(57),
+		},
+		{
+			name: "default tip without rewards",
+			feeHistory: &interfaces.FeeHistory{
+				BaseFee: []*big.Int{big.NewInt(25)},
+				Reward:  [][]*big.Int{{big.NewInt(0)}},
+			},
+			expected: big.NewInt(25 + gasUtils.MaxPriorityFeePerGas),
+		},
+		{
+			name:          "no base fees",
+			feeHistory:    &interfaces.FeeHistory{},
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := &mockFeeHistoryReader{feeHistory: testCase.feeHistory}
+			gasPrice, err := EstimateGasPrice(context.Background(), client, DefaultFeeHistoryBlockCount, 50)
+			if testCase.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, gasPrice)
+		})
+	}
+}
+
+func TestEstimateFee(t *testing.T) {
+	destinationBlockchainID := ids.GenerateTestID()
+	feeTokenAddress := common.HexToAddress("0x1234")
+	oracle := NewStaticPriceOracle()
+	oracle.SetRate(destinationBlockchainID, feeTokenAddress, big.NewRat(1, 2))
+
+	client := &mockFeeHistoryReader{feeHistory: &interfaces.FeeHistory{
+		BaseFee: []*big.Int{big.NewInt(1_000)},
+		Reward:  [][]*big.Int{{big.NewInt(1_000)}},
+	}}
+	estimator := NewFeeEstimator(client, oracle)
+	params := DeliveryParams{NumSigners: 1, RequiredGasLimit: big.NewInt(100_000)}
+
+	estimate, err := estimator.EstimateFee(context.Background(), destinationBlockchainID, feeTokenAddress, params)
+	require.NoError(t, err)
+	deliveryGas, err := EstimateDeliveryGas(params)
+	require.NoError(t, err)
+	require.Equal(t, deliveryGas, estimate.DeliveryGas)
+	require.Equal(t, big.NewInt(2_000), estimate.GasPrice)
+
+	nativeCost := new(big.Int).SetUint64(deliveryGas * 2_000)
+	require.Equal(t, nativeCost, estimate.NativeCost)
+	// Half the native cost, plus the default 10% markup.
+	expectedFee := new(big.Int).Div(new(big.Int).Mul(nativeCost, big.NewInt(110)), big.NewInt(200))
+	require.Equal(t, expectedFee, estimate.FeeAmount)
+
+	_, err = estimator.EstimateFee(context.Background(), ids.GenerateTestID(), feeTokenAddress, params)
+	require.Error(t, err)
+}
+
+func TestConvertAmountRoundsUp(t *testing.T) {
+	require.Equal(t, big.NewInt(4), ConvertAmount(big.NewInt(10), big.NewRat(1, 3)))
+	require.Equal(t, big.NewInt(11), ApplyMarkup(big.NewInt(10), 1))
+	require.Equal(t, big.NewInt(0), ConvertAmount(big.NewInt(0), big.NewRat(5, 1)))
+}
+
+func TestHTTPPriceOracle(t *testing.T) {
+	destinationBlockchainID := ids.GenerateTestID()
+	feeTokenAddress := common.HexToAddress("0xabcd")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("destinationBlockchainID") != destinationBlockchainID.String() ||
+			r.URL.Query().Get("feeTokenAddress") != feeTokenAddress.Hex() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"rate": "0.25"}`))
+	}))
+	defer server.Close()
+
+	oracle := NewHTTPPriceOracle(server.URL)
+	rate, err := oracle.Rate(context.Background(), destinationBlockchainID, feeTokenAddress)
+	require.NoError(t, err)
+	require.Equal(t, big.NewRat(1, 4), rate)
+
+	_, err = oracle.Rate(context.Background(), destinationBlockchainID, common.Address{})
+	require.Error(t, err)
+}
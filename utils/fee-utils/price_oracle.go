@@ -0,0 +1,125 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// PriceOracle provides the exchange rate between a destination chain's native token and a fee token.
+type PriceOracle interface {
+	// Rate returns the number of fee token base units worth one base unit (wei) of the native
+	// token of [destinationBlockchainID].
+	Rate(ctx context.Context, destinationBlockchainID ids.ID, feeTokenAddress common.Address) (*big.Rat, error)
+}
+
+// PriceKey identifies a (destination chain, fee token) pair in a StaticPriceOracle.
+type PriceKey struct {
+	DestinationBlockchainID ids.ID
+	FeeTokenAddress         common.Address
+}
+
+// StaticPriceOracle is a PriceOracle backed by a fixed table of rates.
+type StaticPriceOracle struct {
+	Rates map[PriceKey]*big.Rat
+}
+
+// NewStaticPriceOracle creates an empty StaticPriceOracle.
+func NewStaticPriceOracle() *StaticPriceOracle {
+	return &StaticPriceOracle{
+		Rates: make(map[PriceKey]*big.Rat),
+	}
+}
+
+// SetRate sets the rate for [feeTokenAddress] on messages to [destinationBlockchainID].
+func (o *StaticPriceOracle) SetRate(destinationBlockchainID ids.ID, feeTokenAddress common.Address, rate *big.Rat) {
+	o.Rates[PriceKey{DestinationBlockchainID: destinationBlockchainID, FeeTokenAddress: feeTokenAddress}] = rate
+}
+
+func (o *StaticPriceOracle) Rate(
+	_ context.Context,
+	destinationBlockchainID ids.ID,
+	feeTokenAddress common.Address,
+) (*big.Rat, error) {
+	rate, ok := o.Rates[PriceKey{DestinationBlockchainID: destinationBlockchainID, FeeTokenAddress: feeTokenAddress}]
+	if !ok {
+		return nil, fmt.Errorf("no rate for fee token %s on blockchain %s", feeTokenAddress, destinationBlockchainID)
+	}
+	return rate, nil
+}
+
+// HTTPPriceOracle is a PriceOracle that queries a local HTTP price source. The source is called as
+// GET [URL]?destinationBlockchainID=<cb58 ID>&feeTokenAddress=<hex address> and must respond with a
+// JSON object of the form {"rate": "<decimal or fraction>"}, for example {"rate": "0.25"} or {"rate": "1/4"}.
+type HTTPPriceOracle struct {
+	URL    string
+	Client *http.Client
+}
+
+type httpPriceResponse struct {
+	Rate string `json:"rate"`
+}
+
+// NewHTTPPriceOracle creates an HTTPPriceOracle for the source at [sourceURL].
+func NewHTTPPriceOracle(sourceURL string) *HTTPPriceOracle {
+	return &HTTPPriceOracle{
+		URL:    sourceURL,
+		Client: http.DefaultClient,
+	}
+}
+
+func (o *HTTPPriceOracle) Rate(
+	ctx context.Context,
+	destinationBlockchainID ids.ID,
+	feeTokenAddress common.Address,
+) (*big.Rat, error) {
+	requestURL, err := url.Parse(o.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid price source URL")
+	}
+	query := requestURL.Query()
+	query.Set("destinationBlockchainID", destinationBlockchainID.String())
+	query.Set("feeTokenAddress", feeTokenAddress.Hex())
+	requestURL.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := o.Client.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query price source")
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("price source returned status %d", response.StatusCode)
+	}
+
+	var body httpPriceResponse
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, errors.Wrap(err, "failed to decode price source response")
+	}
+	return ParseRate(body.Rate)
+}
+
+// ParseRate parses a non-negative rate given as a decimal ("0.25") or a fraction ("1/4").
+func ParseRate(s string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid rate %q", s)
+	}
+	if rate.Sign() < 0 {
+		return nil, fmt.Errorf("rate must not be negative: %q", s)
+	}
+	return rate, nil
+}
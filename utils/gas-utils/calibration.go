@@ -0,0 +1,245 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ava-labs/avalanchego/utils/math"
+	avalancheWarp "github.com/ava-labs/avalanchego/vms/platformvm/warp"
+	"github.com/ava-labs/avalanchego/vms/platformvm/warp/payload"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	"github.com/ava-labs/subnet-evm/core"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/params"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/warp"
+	"github.com/ava-labs/subnet-evm/predicate"
+	subnetEvmUtils "github.com/ava-labs/subnet-evm/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// ReceiveCrossChainMessageExecutionBaseGasCost is the part of ReceiveCrossChainMessageBaseGasCost
+// that is not the intrinsic cost of the transaction. It is used by CalculateReceiveMessageGasLimitExact,
+// which computes the intrinsic cost exactly.
+const ReceiveCrossChainMessageExecutionBaseGasCost = ReceiveCrossChainMessageBaseGasCost - params.TxGas
+
+// ReceiveMessageTransaction is a decoded receiveCrossChainMessage transaction.
+type ReceiveMessageTransaction struct {
+	SignedMessage     *avalancheWarp.Message
+	TeleporterMessage *teleportermessenger.TeleporterMessage
+	NumSigners        int
+}
+
+// ParseReceiveMessageTransaction decodes the Warp message carried in the predicate of a
+// receiveCrossChainMessage transaction, and the Teleporter message it contains.
+func ParseReceiveMessageTransaction(tx *types.Transaction) (*ReceiveMessageTransaction, error) {
+	for _, tuple := range tx.AccessList() {
+		if tuple.Address != warp.ContractAddress {
+			continue
+		}
+		messageBytes, err := predicate.UnpackPredicate(subnetEvmUtils.HashSliceToBytes(tuple.StorageKeys))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to unpack Warp predicate")
+		}
+		signedMessage, err := avalancheWarp.ParseMessage(messageBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse Warp message")
+		}
+		numSigners, err := signedMessage.Signature.NumSigners()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get number of signers")
+		}
+		addressedCall, err := payload.ParseAddressedCall(signedMessage.Payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse addressed call payload")
+		}
+		teleporterMessage := teleportermessenger.TeleporterMessage{}
+		if err := teleporterMessage.Unpack(addressedCall.Payload); err != nil {
+			return nil, err
+		}
+		return &ReceiveMessageTransaction{
+			SignedMessage:     signedMessage,
+			TeleporterMessage: &teleporterMessage,
+			NumSigners:        numSigners,
+		}, nil
+	}
+	return nil, errors.New("transaction does not contain a Warp predicate")
+}
+
+// CalculateReceiveMessageGasLimitExact calculates the gas used by a receiveCrossChainMessage
+// transaction delivering [signedMessage], using the exact intrinsic gas of the transaction rather
+// than the approximations in CalculateReceiveMessageGasLimit. The intrinsic gas includes the calldata
+// and the Warp predicate in the access list, which is charged per padded predicate byte and per signer.
+// The read of the predicate in getVerifiedWarpMessage is also charged per padded predicate byte.
+// The remaining Teleporter execution costs are taken from CalculateReceiveMessageGasLimit.
+func CalculateReceiveMessageGasLimitExact(
+	rules params.Rules,
+	signedMessage *avalancheWarp.Message,
+	executionRequiredGasLimit *big.Int,
+	teleporterMessageSize int,
+	teleporterReceiptsCount int,
+	relayerRewardAddress common.Address,
+) (uint64, error) {
+	if !executionRequiredGasLimit.IsUint64() {
+		return 0, errors.New("required gas limit too high")
+	}
+	callData, err := teleportermessenger.PackReceiveCrossChainMessage(0, relayerRewardAddress)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to pack receiveCrossChainMessage call")
+	}
+	predicateBytes := predicate.PackPredicate(signedMessage.Bytes())
+	accessList := types.AccessList{{
+		Address:     warp.ContractAddress,
+		StorageKeys: subnetEvmUtils.BytesToHashSlice(predicateBytes),
+	}}
+	intrinsicGas, err := core.IntrinsicGas(callData, accessList, false, rules)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to calculate intrinsic gas")
+	}
+
+	return sumGas(
+		intrinsicGas,
+		warp.GetVerifiedWarpMessageBaseCost,
+		uint64(len(predicateBytes))*warp.GasCostPerWarpMessageBytes,
+		ReceiveCrossChainMessageExecutionBaseGasCost,
+		uint64(teleporterMessageSize)*DecodeMessageGasCostPerByte,
+		uint64(teleporterReceiptsCount)*MarkMessageReceiptGasCost,
+		executionRequiredGasLimit.Uint64(),
+	)
+}
+
+// CalibrationSample compares the gas used by a delivered receiveCrossChainMessage transaction
+// with the values predicted by CalculateReceiveMessageGasLimit and CalculateReceiveMessageGasLimitExact.
+type CalibrationSample struct {
+	TxHash                common.Hash
+	NumSigners            int
+	WarpMessageSize       int
+	TeleporterMessageSize int
+	NumReceipts           int
+	// ExecutionGas is the gas the receiver used to execute the message. Defaults to the
+	// message's requiredGasLimit, which is an upper bound, if not known.
+	ExecutionGas  *big.Int
+	GasUsed       uint64
+	Estimate      uint64
+	ExactEstimate uint64
+}
+
+// NewCalibrationSample creates a CalibrationSample from a receiveCrossChainMessage transaction
+// and its receipt. [executionGas] may be nil if the gas used by the receiver is unknown.
+func NewCalibrationSample(
+	rules params.Rules,
+	tx *types.Transaction,
+	receipt *types.Receipt,
+	executionGas *big.Int,
+	relayerRewardAddress common.Address,
+) (*CalibrationSample, error) {
+	receiveTx, err := ParseReceiveMessageTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	if executionGas == nil {
+		executionGas = receiveTx.TeleporterMessage.RequiredGasLimit
+	}
+	sample := &CalibrationSample{
+		TxHash:                tx.Hash(),
+		NumSigners:            receiveTx.NumSigners,
+		WarpMessageSize:       len(receiveTx.SignedMessage.Bytes()),
+		TeleporterMessageSize: len(receiveTx.SignedMessage.Payload),
+		NumReceipts:           len(receiveTx.TeleporterMessage.Receipts),
+		ExecutionGas:          executionGas,
+		GasUsed:               receipt.GasUsed,
+	}
+	sample.Estimate, err = CalculateReceiveMessageGasLimit(
+		sample.NumSigners,
+		executionGas,
+		sample.WarpMessageSize,
+		sample.TeleporterMessageSize,
+		sample.NumReceipts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	sample.ExactEstimate, err = CalculateReceiveMessageGasLimitExact(
+		rules,
+		receiveTx.SignedMessage,
+		executionGas,
+		sample.TeleporterMessageSize,
+		sample.NumReceipts,
+		relayerRewardAddress,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sample, nil
+}
+
+// Drift returns how far Estimate is above the gas actually used, as a percentage of the gas used.
+// A negative drift means the formula underestimates the delivery cost.
+func (s *CalibrationSample) Drift() float64 {
+	return driftPercentage(s.Estimate, s.GasUsed)
+}
+
+// ExactDrift is the Drift of ExactEstimate.
+func (s *CalibrationSample) ExactDrift() float64 {
+	return driftPercentage(s.ExactEstimate, s.GasUsed)
+}
+
+// CalibrationReport summarizes a set of CalibrationSamples.
+type CalibrationReport struct {
+	Samples []*CalibrationSample
+	// MaxDriftPercentage is the largest overestimate that is not flagged.
+	// Underestimates are always flagged.
+	MaxDriftPercentage float64
+}
+
+// Flagged returns the samples that CalculateReceiveMessageGasLimit underestimates,
+// or overestimates by more than MaxDriftPercentage.
+func (r *CalibrationReport) Flagged() []*CalibrationSample {
+	var flagged []*CalibrationSample
+	for _, sample := range r.Samples {
+		drift := sample.Drift()
+		if drift < 0 || drift > r.MaxDriftPercentage {
+			flagged = append(flagged, sample)
+		}
+	}
+	return flagged
+}
+
+// String formats the report as a table, one row per sample.
+func (r *CalibrationReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-8s %-10s %-10s %-8s %-10s %-10s %-10s %-8s %-10s %-8s\n",
+		"signers", "warpBytes", "tlpBytes", "receipts", "execution", "gasUsed",
+		"estimate", "drift%", "exact", "drift%")
+	for _, s := range r.Samples {
+		fmt.Fprintf(&b, "%-8d %-10d %-10d %-8d %-10s %-10d %-10d %-8.2f %-10d %-8.2f\n",
+			s.NumSigners, s.WarpMessageSize, s.TeleporterMessageSize, s.NumReceipts, s.ExecutionGas,
+			s.GasUsed, s.Estimate, s.Drift(), s.ExactEstimate, s.ExactDrift())
+	}
+	return b.String()
+}
+
+func driftPercentage(estimate uint64, gasUsed uint64) float64 {
+	if gasUsed == 0 {
+		return 0
+	}
+	diff := new(big.Float).Sub(new(big.Float).SetUint64(estimate), new(big.Float).SetUint64(gasUsed))
+	drift, _ := diff.Quo(diff, new(big.Float).SetUint64(gasUsed)).Float64()
+	return drift * 100
+}
+
+func sumGas(amounts ...uint64) (uint64, error) {
+	var res uint64
+	var err error
+	for _, amount := range amounts {
+		res, err = math.Add64(res, amount)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return res, nil
+}
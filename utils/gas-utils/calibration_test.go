@@ -0,0 +1,220 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/crypto/bls"
+	"github.com/ava-labs/avalanchego/utils/set"
+	avalancheWarp "github.com/ava-labs/avalanchego/vms/platformvm/warp"
+	"github.com/ava-labs/avalanchego/vms/platformvm/warp/payload"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	"github.com/ava-labs/subnet-evm/core"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/ethclient/simulated"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/warp"
+	"github.com/ava-labs/subnet-evm/predicate"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+var relayerRewardAddress = common.HexToAddress("0x0123456789abcdef0123456789abcdef01234567")
+
+func newReceiveMessageTransaction(t *testing.T, messageSize int, numReceipts int, numSigners int) *types.Transaction {
+	teleporterMessage := teleportermessenger.TeleporterMessage{
+		MessageNonce:            big.NewInt(1),
+		OriginSenderAddress:     common.HexToAddress("0x1"),
+		DestinationBlockchainID: ids.GenerateTestID(),
+		DestinationAddress:      common.HexToAddress("0x2"),
+		RequiredGasLimit:        big.NewInt(100_000),
+		AllowedRelayerAddresses: []common.Address{},
+		Receipts:                make([]teleportermessenger.TeleporterMessageReceipt, numReceipts),
+		Message:                 make([]byte, messageSize),
+	}
+	for i := range teleporterMessage.Receipts {
+		teleporterMessage.Receipts[i].ReceivedMessageNonce = big.NewInt(int64(i + 1))
+	}
+	teleporterMessageBytes, err := teleporterMessage.Pack()
+	require.NoError(t, err)
+	addressedCall, err := payload.NewAddressedCall(common.HexToAddress("0x3").Bytes(), teleporterMessageBytes)
+	require.NoError(t, err)
+	unsignedMessage, err := avalancheWarp.NewUnsignedMessage(1, ids.GenerateTestID(), addressedCall.Bytes())
+	require.NoError(t, err)
+	signers := make([]int, numSigners)
+	for i := range signers {
+		signers[i] = i
+	}
+	signedMessage, err := avalancheWarp.NewMessage(unsignedMessage, &avalancheWarp.BitSetSignature{
+		Signers:   set.NewBits(signers...).Bytes(),
+		Signature: [bls.SignatureLen]byte{},
+	})
+	require.NoError(t, err)
+
+	callData, err := teleportermessenger.PackReceiveCrossChainMessage(0, relayerRewardAddress)
+	require.NoError(t, err)
+	teleporterAddress := common.HexToAddress("0x4")
+	return predicate.NewPredicateTx(
+		simulatedUtils.SimulatedChainID,
+		0,
+		&teleporterAddress,
+		1_000_000,
+		big.NewInt(1),
+		big.NewInt(1),
+		big.NewInt(0),
+		callData,
+		types.AccessList{},
+		warp.ContractAddress,
+		signedMessage.Bytes(),
+	)
+}
+
+func TestParseReceiveMessageTransaction(t *testing.T) {
+	tx := newReceiveMessageTransaction(t, 100, 2, 3)
+	receiveTx, err := ParseReceiveMessageTransaction(tx)
+	require.NoError(t, err)
+	require.Equal(t, 3, receiveTx.NumSigners)
+	require.Len(t, receiveTx.TeleporterMessage.Message, 100)
+	require.Len(t, receiveTx.TeleporterMessage.Receipts, 2)
+	require.Equal(t, big.NewInt(100_000), receiveTx.TeleporterMessage.RequiredGasLimit)
+
+	_, err = ParseReceiveMessageTransaction(types.NewTx(&types.DynamicFeeTx{}))
+	require.ErrorContains(t, err, "does not contain a Warp predicate")
+}
+
+func TestCalculateReceiveMessageGasLimitExact(t *testing.T) {
+	rules := simulatedUtils.ChainRules()
+	for _, messageSize := range []int{0, 31, 32, 1000} {
+		tx := newReceiveMessageTransaction(t, messageSize, 1, 5)
+		receiveTx, err := ParseReceiveMessageTransaction(tx)
+		require.NoError(t, err)
+
+		teleporterMessageSize := len(receiveTx.SignedMessage.Payload)
+		exact, err := CalculateReceiveMessageGasLimitExact(
+			rules,
+			receiveTx.SignedMessage,
+			big.NewInt(100_000),
+			teleporterMessageSize,
+			1,
+			relayerRewardAddress,
+		)
+		require.NoError(t, err)
+
+		// The intrinsic gas of the delivery transaction itself, including the predicate.
+		intrinsicGas, err := core.IntrinsicGas(tx.Data(), tx.AccessList(), false, rules)
+		require.NoError(t, err)
+		predicateSize := uint64(len(tx.AccessList()[0].StorageKeys)) * common.HashLength
+		expected := intrinsicGas +
+			warp.GetVerifiedWarpMessageBaseCost +
+			predicateSize*warp.GasCostPerWarpMessageBytes +
+			ReceiveCrossChainMessageExecutionBaseGasCost +
+			uint64(teleporterMessageSize)*DecodeMessageGasCostPerByte +
+			MarkMessageReceiptGasCost +
+			100_000
+		require.Equal(t, expected, exact)
+	}
+}
+
+func TestCalibrationReport(t *testing.T) {
+	rules := simulatedUtils.ChainRules()
+	tx := newReceiveMessageTransaction(t, 200, 0, 4)
+
+	receipt := &types.Receipt{GasUsed: 400_000}
+	sample, err := NewCalibrationSample(rules, tx, receipt, big.NewInt(50_000), relayerRewardAddress)
+	require.NoError(t, err)
+	require.Equal(t, tx.Hash(), sample.TxHash)
+	require.Equal(t, 4, sample.NumSigners)
+	require.Equal(t, big.NewInt(50_000), sample.ExecutionGas)
+	require.Greater(t, sample.Estimate, uint64(0))
+	require.Greater(t, sample.ExactEstimate, uint64(0))
+
+	// Without the execution gas, the message's required gas limit is used.
+	upperBound, err := NewCalibrationSample(rules, tx, receipt, nil, relayerRewardAddress)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(100_000), upperBound.ExecutionGas)
+	require.Equal(t, sample.Estimate+50_000, upperBound.Estimate)
+
+	accurate := &CalibrationSample{GasUsed: 100, Estimate: 105}
+	underestimated := &CalibrationSample{GasUsed: 100, Estimate: 99}
+	overestimated := &CalibrationSample{GasUsed: 100, Estimate: 150}
+	require.InDelta(t, 5, accurate.Drift(), 1e-9)
+	require.InDelta(t, -1, underestimated.Drift(), 1e-9)
+
+	report := &CalibrationReport{
+		Samples:            []*CalibrationSample{accurate, underestimated, overestimated},
+		MaxDriftPercentage: 20,
+	}
+	require.Equal(t, []*CalibrationSample{underestimated, overestimated}, report.Flagged())
+	require.Contains(t, report.String(), "drift%")
+}
+
+// minimumCallGas returns the least gas that [msg] succeeds with, which eth_estimateGas only
+// approximates.
+func minimumCallGas(ctx context.Context, t *testing.T, client simulated.Client, msg interfaces.CallMsg) uint64 {
+	lo, hi := uint64(0), uint64(10_000_000)
+	for lo+1 < hi {
+		msg.Gas = (lo + hi) / 2
+		if _, err := client.CallContract(ctx, msg, nil); err != nil {
+			lo = msg.Gas
+		} else {
+			hi = msg.Gas
+		}
+	}
+	msg.Gas = hi
+	_, err := client.CallContract(ctx, msg, nil)
+	require.NoError(t, err)
+	return hi
+}
+
+func TestCalibrationSignerCounts(t *testing.T) {
+	ctx := context.Background()
+	backend := simulatedUtils.NewSimulatedBackend()
+	defer backend.Close()
+	rules := simulatedUtils.ChainRules()
+
+	const executionGas = 100_000
+	var gaps []int64
+	for _, numSigners := range []int{1, 10, 200} {
+		tx := newReceiveMessageTransaction(t, 500, 2, numSigners)
+		receiveTx, err := ParseReceiveMessageTransaction(tx)
+		require.NoError(t, err)
+
+		// The simulated chain can't verify Warp signatures, so the gas it charges for the delivery is
+		// measured on a call with the same calldata and predicate to an account without code, which
+		// costs the intrinsic gas of the transaction, including what the Warp predicate charges for
+		// the signers. The Teleporter execution costs, which don't depend on the signers, are added
+		// to it.
+		intrinsicGas := minimumCallGas(ctx, t, backend.Client(), interfaces.CallMsg{
+			To:         &common.Address{0xaa},
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+		predicateSize := uint64(len(tx.AccessList()[0].StorageKeys)) * common.HashLength
+		receipt := &types.Receipt{GasUsed: intrinsicGas +
+			warp.GetVerifiedWarpMessageBaseCost +
+			predicateSize*warp.GasCostPerWarpMessageBytes +
+			ReceiveCrossChainMessageExecutionBaseGasCost +
+			uint64(len(receiveTx.SignedMessage.Payload))*DecodeMessageGasCostPerByte +
+			2*MarkMessageReceiptGasCost +
+			executionGas,
+		}
+
+		sample, err := NewCalibrationSample(rules, tx, receipt, big.NewInt(executionGas), relayerRewardAddress)
+		require.NoError(t, err)
+		require.Equal(t, numSigners, sample.NumSigners)
+		// The exact estimate matches what the chain charges for the signers.
+		require.Zero(t, sample.ExactDrift(), "%d signers", numSigners)
+		gaps = append(gaps, int64(sample.Estimate)-int64(sample.GasUsed))
+	}
+	// The approximate estimate charges the signers as the chain does, so its gap to the gas used only
+	// changes with the padding of the predicate, which it leaves out of both Warp message byte costs.
+	for _, gap := range gaps[1:] {
+		require.InDelta(t, gaps[0], gap, float64(2*common.HashLength*warp.GasCostPerWarpMessageBytes))
+	}
+}
@@ -0,0 +1,128 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/utils/math"
+)
+
+// TransferrerType identifies how a token transferrer holds the token it transfers.
+type TransferrerType int
+
+const (
+	// ERC20Transferrer is an ERC20TokenHome or ERC20TokenRemote.
+	ERC20Transferrer TransferrerType = iota
+	// NativeTransferrer is a NativeTokenHome or NativeTokenRemote.
+	NativeTransferrer
+)
+
+func (t TransferrerType) String() string {
+	switch t {
+	case ERC20Transferrer:
+		return "ERC20"
+	case NativeTransferrer:
+		return "native"
+	default:
+		return "unknown"
+	}
+}
+
+// Gas limits for ICTT messages on the destination token transferrer. The values are
+// measured on single-hop deliveries to each kind of TokenHome and TokenRemote, with a margin of
+// at least 20%.
+const (
+	// Gas to process a single-hop send on the destination.
+	ERC20SendRequiredGas  uint64 = 100_000
+	NativeSendRequiredGas uint64 = 135_000
+
+	// Gas to process a single-hop call on the destination, excluding the recipient gas limit and the
+	// per word cost of the recipient payload. Covers the fallback path taken if the recipient call fails.
+	ERC20SendAndCallBaseGas  uint64 = 130_000
+	NativeSendAndCallBaseGas uint64 = 135_000
+	SendAndCallGasPerWord    uint64 = 450
+)
+
+// Gas limits set by TokenRemote on the first hop of a multi-hop transfer, back to the token home.
+// These mirror MULTI_HOP_SEND_REQUIRED_GAS, MULTI_HOP_CALL_REQUIRED_GAS and MULTI_HOP_CALL_GAS_PER_WORD.
+const (
+	MultiHopSendRequiredGas uint64 = 340_000
+	MultiHopCallRequiredGas uint64 = 350_000
+	MultiHopCallGasPerWord  uint64 = 1_500
+)
+
+// ICTTGasLimits are the gas limits to set on a SendTokensInput or SendAndCallInput.
+type ICTTGasLimits struct {
+	// RequiredGasLimit is the input's requiredGasLimit. For multi-hop transfers, this is the
+	// gas limit of the second hop, from the token home to the destination.
+	RequiredGasLimit *big.Int
+	// RecipientGasLimit is the input's recipientGasLimit. Only set for sendAndCall.
+	RecipientGasLimit *big.Int
+	// FirstHopRequiredGasLimit is the gas limit TokenRemote sets on the message to the token home
+	// for multi-hop transfers. It is not an input field, but determines the primary relayer fee.
+	// Only set for multi-hop transfers.
+	FirstHopRequiredGasLimit *big.Int
+}
+
+// CalculateNumWords returns the number of 32-byte words needed for a payload of [payloadSize] bytes,
+// matching TokenRemote.calculateNumWords.
+func CalculateNumWords(payloadSize int) uint64 {
+	return (uint64(payloadSize) + 31) >> 5
+}
+
+// SendTokensGasLimits returns the gas limits for sending tokens to a transferrer of type [destinationType].
+func SendTokensGasLimits(destinationType TransferrerType, multiHop bool) *ICTTGasLimits {
+	requiredGas := ERC20SendRequiredGas
+	if destinationType == NativeTransferrer {
+		requiredGas = NativeSendRequiredGas
+	}
+	limits := &ICTTGasLimits{
+		RequiredGasLimit: new(big.Int).SetUint64(requiredGas),
+	}
+	if multiHop {
+		limits.FirstHopRequiredGasLimit = new(big.Int).SetUint64(MultiHopSendRequiredGas)
+	}
+	return limits
+}
+
+// SendAndCallGasLimits returns the gas limits for sending tokens to a transferrer of type [destinationType]
+// and calling a recipient contract with a [payloadSize] byte payload and [recipientGasLimit] gas.
+func SendAndCallGasLimits(
+	destinationType TransferrerType,
+	payloadSize int,
+	recipientGasLimit uint64,
+	multiHop bool,
+) (*ICTTGasLimits, error) {
+	baseGas := ERC20SendAndCallBaseGas
+	if destinationType == NativeTransferrer {
+		baseGas = NativeSendAndCallBaseGas
+	}
+	numWords := CalculateNumWords(payloadSize)
+	payloadGas, err := math.Mul64(numWords, SendAndCallGasPerWord)
+	if err != nil {
+		return nil, err
+	}
+	requiredGas, err := sumGas(baseGas, payloadGas, recipientGasLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := &ICTTGasLimits{
+		RequiredGasLimit:  new(big.Int).SetUint64(requiredGas),
+		RecipientGasLimit: new(big.Int).SetUint64(recipientGasLimit),
+	}
+	if multiHop {
+		firstHopPayloadGas, err := math.Mul64(numWords, MultiHopCallGasPerWord)
+		if err != nil {
+			return nil, err
+		}
+		firstHopGas, err := math.Add64(MultiHopCallRequiredGas, firstHopPayloadGas)
+		if err != nil {
+			return nil, err
+		}
+		limits.FirstHopRequiredGasLimit = new(big.Int).SetUint64(firstHopGas)
+	}
+	return limits, nil
+}
@@ -0,0 +1,329 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	nativeMinter "github.com/ava-labs/icm-contracts/abi-bindings/go/INativeMinter"
+	nativetokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/NativeTokenHome"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	nativetokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemote"
+	wrappednativetoken "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/WrappedNativeToken"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	mockERC20SACR "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/mocks/MockERC20SendAndCallReceiver"
+	mockNSACR "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/mocks/MockNativeSendAndCallReceiver"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/nativeminter"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	tokenHomeBlockchainID = ids.ID{9}
+	tokenHomeAddress      = common.HexToAddress("0x1111111111111111111111111111111111111111")
+)
+
+func TestCalculateNumWords(t *testing.T) {
+	require.Equal(t, uint64(0), CalculateNumWords(0))
+	require.Equal(t, uint64(1), CalculateNumWords(1))
+	require.Equal(t, uint64(1), CalculateNumWords(32))
+	require.Equal(t, uint64(2), CalculateNumWords(33))
+	require.Equal(t, uint64(313), CalculateNumWords(10_000))
+}
+
+func TestSendTokensGasLimits(t *testing.T) {
+	limits := SendTokensGasLimits(ERC20Transferrer, false)
+	require.Equal(t, new(big.Int).SetUint64(ERC20SendRequiredGas), limits.RequiredGasLimit)
+	require.Nil(t, limits.RecipientGasLimit)
+	require.Nil(t, limits.FirstHopRequiredGasLimit)
+
+	limits = SendTokensGasLimits(NativeTransferrer, true)
+	require.Equal(t, new(big.Int).SetUint64(NativeSendRequiredGas), limits.RequiredGasLimit)
+	require.Equal(t, new(big.Int).SetUint64(MultiHopSendRequiredGas), limits.FirstHopRequiredGasLimit)
+}
+
+func TestSendAndCallGasLimits(t *testing.T) {
+	limits, err := SendAndCallGasLimits(ERC20Transferrer, 33, 200_000, true)
+	require.NoError(t, err)
+	require.Equal(t, new(big.Int).SetUint64(ERC20SendAndCallBaseGas+2*SendAndCallGasPerWord+200_000),
+		limits.RequiredGasLimit)
+	require.Equal(t, big.NewInt(200_000), limits.RecipientGasLimit)
+	require.Equal(t, new(big.Int).SetUint64(MultiHopCallRequiredGas+2*MultiHopCallGasPerWord),
+		limits.FirstHopRequiredGasLimit)
+	// TokenRemote requires the recipient gas limit to be less than the required gas limit.
+	require.Equal(t, -1, limits.RecipientGasLimit.Cmp(limits.RequiredGasLimit))
+
+	limits, err = SendAndCallGasLimits(NativeTransferrer, 0, 0, false)
+	require.NoError(t, err)
+	require.Equal(t, new(big.Int).SetUint64(NativeSendAndCallBaseGas), limits.RequiredGasLimit)
+	require.Nil(t, limits.FirstHopRequiredGasLimit)
+
+	_, err = SendAndCallGasLimits(ERC20Transferrer, 0, ^uint64(0), false)
+	require.Error(t, err)
+}
+
+type transferrerCase struct {
+	name            string
+	transferrerType TransferrerType
+	kit             *receiverTestUtils.ReceiverTestKit
+	address         common.Address
+	// sourceBlockchainID and sourceAddress are the transferrer messages are delivered from.
+	sourceBlockchainID ids.ID
+	sourceAddress      common.Address
+	// callSourceBlockchainID and callOriginAddress are the source of sendAndCall messages.
+	callSourceBlockchainID ids.ID
+	callOriginAddress      common.Address
+	receiverAddress        common.Address
+	// requireCallResult checks that a sendAndCall delivery emitted CallSucceeded or CallFailed.
+	requireCallResult func(t *testing.T, result *receiverTestUtils.DeliveryResult, succeeded bool)
+}
+
+// deployTokenRemotes deploys an ERC20TokenRemote and a NativeTokenRemote, each with a mock
+// sendAndCall receiver, to the kit's simulated backend.
+func deployTokenRemotes(t *testing.T, kit *receiverTestUtils.ReceiverTestKit) []transferrerCase {
+	ctx := context.Background()
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+
+	settings := erc20tokenremote.TokenRemoteSettings{
+		TeleporterRegistryAddress: kit.TeleporterRegistryAddress,
+		TeleporterManager:         kit.DeployerAddress,
+		MinTeleporterVersion:      big.NewInt(1),
+		TokenHomeBlockchainID:     tokenHomeBlockchainID,
+		TokenHomeAddress:          tokenHomeAddress,
+		TokenHomeDecimals:         18,
+	}
+	erc20RemoteAddress, tx, erc20Remote, err := erc20tokenremote.DeployERC20TokenRemote(
+		opts, kit.Client(), settings, "Token", "TKN", 18,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	nativeRemoteAddress, tx, nativeRemote, err := nativetokenremote.DeployNativeTokenRemote(
+		opts,
+		kit.Client(),
+		nativetokenremote.TokenRemoteSettings(settings),
+		"NTV",
+		big.NewInt(1e18),
+		big.NewInt(1),
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	// NativeTokenRemote mints the tokens it receives, so it must be allowed to use the NativeMinter.
+	minter, err := nativeMinter.NewINativeMinter(nativeminter.ContractAddress, kit.Client())
+	require.NoError(t, err)
+	tx, err = minter.SetEnabled(opts, nativeRemoteAddress)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	erc20ReceiverAddress, nativeReceiverAddress := deployReceivers(t, kit)
+	remoteCase := transferrerCase{
+		kit:                    kit,
+		sourceBlockchainID:     tokenHomeBlockchainID,
+		sourceAddress:          tokenHomeAddress,
+		callSourceBlockchainID: ids.ID{10},
+		callOriginAddress:      tokenHomeAddress,
+	}
+	erc20Case, nativeCase := remoteCase, remoteCase
+	erc20Case.name, erc20Case.transferrerType = "ERC20TokenRemote", ERC20Transferrer
+	erc20Case.address, erc20Case.receiverAddress = erc20RemoteAddress, erc20ReceiverAddress
+	erc20Case.requireCallResult = func(t *testing.T, result *receiverTestUtils.DeliveryResult, succeeded bool) {
+		if succeeded {
+			receiverTestUtils.RequireEvent(t, result, erc20Remote.ParseCallSucceeded)
+		} else {
+			receiverTestUtils.RequireEvent(t, result, erc20Remote.ParseCallFailed)
+		}
+	}
+	nativeCase.name, nativeCase.transferrerType = "NativeTokenRemote", NativeTransferrer
+	nativeCase.address, nativeCase.receiverAddress = nativeRemoteAddress, nativeReceiverAddress
+	nativeCase.requireCallResult = func(t *testing.T, result *receiverTestUtils.DeliveryResult, succeeded bool) {
+		if succeeded {
+			receiverTestUtils.RequireEvent(t, result, nativeRemote.ParseCallSucceeded)
+		} else {
+			receiverTestUtils.RequireEvent(t, result, nativeRemote.ParseCallFailed)
+		}
+	}
+	return []transferrerCase{erc20Case, nativeCase}
+}
+
+// deployTokenHomes deploys an ERC20TokenHome and a NativeTokenHome, each with a mock sendAndCall
+// receiver and a registered TokenRemote that the tokens they deliver were sent to.
+func deployTokenHomes(t *testing.T) []transferrerCase {
+	ctx := context.Background()
+	env := receiverTestUtils.NewTokenHomeTestEnv(t, 18)
+	kit := env.Kit
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	remoteID, remoteAddress := ids.ID{11}, common.HexToAddress("0x3333333333333333333333333333333333333333")
+	amount := big.NewInt(1e18)
+
+	env.RegisterRemote(t, remoteID, remoteAddress, 18, big.NewInt(0))
+	env.Send(t, remoteID, remoteAddress, amount)
+
+	wrappedAddress, tx, _, err := wrappednativetoken.DeployWrappedNativeToken(opts, kit.Client(), "WNTV")
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	nativeHomeAddress, tx, nativeHome, err := nativetokenhome.DeployNativeTokenHome(
+		opts, kit.Client(), env.RegistryAddress, kit.DeployerAddress, big.NewInt(1), wrappedAddress,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	message, err := itokentransferrer.PackTransferrerMessage(
+		itokentransferrer.RegisterRemote,
+		&itokentransferrer.RegisterRemoteMessage{
+			InitialReserveImbalance: big.NewInt(0),
+			HomeTokenDecimals:       18,
+			RemoteTokenDecimals:     18,
+		},
+	)
+	require.NoError(t, err)
+	result, err := kit.DeliverMessage(ctx, nativeHomeAddress, remoteID, remoteAddress, message, 500_000)
+	require.NoError(t, err)
+	receiverTestUtils.RequireDelivered(t, result)
+	opts.Value = amount
+	tx, err = nativeHome.Send(opts, nativetokenhome.SendTokensInput{
+		DestinationBlockchainID:            remoteID,
+		DestinationTokenTransferrerAddress: remoteAddress,
+		Recipient:                          kit.DeployerAddress,
+		PrimaryFee:                         big.NewInt(0),
+		SecondaryFee:                       big.NewInt(0),
+		RequiredGasLimit:                   big.NewInt(100_000),
+	})
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	erc20ReceiverAddress, nativeReceiverAddress := deployReceivers(t, kit)
+	homeCase := transferrerCase{
+		kit:                    kit,
+		sourceBlockchainID:     remoteID,
+		sourceAddress:          remoteAddress,
+		callSourceBlockchainID: remoteID,
+		callOriginAddress:      remoteAddress,
+	}
+	erc20Case, nativeCase := homeCase, homeCase
+	erc20Case.name, erc20Case.transferrerType = "ERC20TokenHome", ERC20Transferrer
+	erc20Case.address, erc20Case.receiverAddress = env.HomeAddress, erc20ReceiverAddress
+	erc20Case.requireCallResult = func(t *testing.T, result *receiverTestUtils.DeliveryResult, succeeded bool) {
+		if succeeded {
+			receiverTestUtils.RequireEvent(t, result, env.Home.ParseCallSucceeded)
+		} else {
+			receiverTestUtils.RequireEvent(t, result, env.Home.ParseCallFailed)
+		}
+	}
+	nativeCase.name, nativeCase.transferrerType = "NativeTokenHome", NativeTransferrer
+	nativeCase.address, nativeCase.receiverAddress = nativeHomeAddress, nativeReceiverAddress
+	nativeCase.requireCallResult = func(t *testing.T, result *receiverTestUtils.DeliveryResult, succeeded bool) {
+		if succeeded {
+			receiverTestUtils.RequireEvent(t, result, nativeHome.ParseCallSucceeded)
+		} else {
+			receiverTestUtils.RequireEvent(t, result, nativeHome.ParseCallFailed)
+		}
+	}
+	return []transferrerCase{erc20Case, nativeCase}
+}
+
+// deployReceivers deploys a mock ERC20 and native sendAndCall receiver to the kit's simulated backend.
+func deployReceivers(t *testing.T, kit *receiverTestUtils.ReceiverTestKit) (common.Address, common.Address) {
+	ctx := context.Background()
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	erc20ReceiverAddress, tx, _, err := mockERC20SACR.DeployMockERC20SendAndCallReceiver(opts, kit.Client())
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	nativeReceiverAddress, tx, _, err := mockNSACR.DeployMockNativeSendAndCallReceiver(opts, kit.Client())
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	return erc20ReceiverAddress, nativeReceiverAddress
+}
+
+// requireWithinMargin fails the test unless the delivery's execution gas with the default margin
+// fits within [limit].
+func requireWithinMargin(t *testing.T, result *receiverTestUtils.DeliveryResult, limit *big.Int) {
+	withMargin, err := AddGasMargin(result.ExecutionGasUsed, DefaultRequiredGasLimitMarginPercentage)
+	require.NoError(t, err)
+	require.LessOrEqual(t, withMargin.Uint64(), limit.Uint64(),
+		"execution used %d gas of %s", result.ExecutionGasUsed, limit)
+}
+
+// TestICTTGasLimitsSufficient delivers ICTT messages built with the gas limit helpers to each kind
+// of deployed token transferrer, and checks that each delivery fits within the computed
+// requiredGasLimit with the default margin.
+func TestICTTGasLimitsSufficient(t *testing.T) {
+	ctx := context.Background()
+	kit, err := receiverTestUtils.NewRegistryReceiverTestKit(ctx, 1)
+	require.NoError(t, err)
+	defer kit.Close()
+
+	recipient := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	for _, transferrer := range append(deployTokenRemotes(t, kit), deployTokenHomes(t)...) {
+		t.Run(transferrer.name, func(t *testing.T) {
+			limits := SendTokensGasLimits(transferrer.transferrerType, false)
+			message, err := itokentransferrer.PackTransferrerMessage(
+				itokentransferrer.SingleHopSend,
+				&itokentransferrer.SingleHopSendMessage{Recipient: recipient, Amount: big.NewInt(1_000)},
+			)
+			require.NoError(t, err)
+			result, err := transferrer.kit.DeliverMessage(
+				ctx, transferrer.address, transferrer.sourceBlockchainID, transferrer.sourceAddress,
+				message, limits.RequiredGasLimit.Uint64(),
+			)
+			require.NoError(t, err)
+			receiverTestUtils.RequireDelivered(t, result)
+			requireWithinMargin(t, result, limits.RequiredGasLimit)
+
+			testCases := []struct {
+				payloadSize       int
+				recipientGasLimit uint64
+				expectCallSuccess bool
+			}{
+				{payloadSize: 1, recipientGasLimit: 100_000, expectCallSuccess: true},
+				{payloadSize: 1_000, recipientGasLimit: 100_000, expectCallSuccess: true},
+				{payloadSize: 10_000, recipientGasLimit: 200_000, expectCallSuccess: true},
+				// The recipient runs out of gas, so the tokens are sent to the fallback recipient.
+				{payloadSize: 10_000, recipientGasLimit: 5_000, expectCallSuccess: false},
+			}
+			for _, testCase := range testCases {
+				limits, err := SendAndCallGasLimits(
+					transferrer.transferrerType, testCase.payloadSize, testCase.recipientGasLimit, false,
+				)
+				require.NoError(t, err)
+				message, err := itokentransferrer.PackTransferrerMessage(
+					itokentransferrer.SingleHopCall,
+					&itokentransferrer.SingleHopCallMessage{
+						SourceBlockchainID:            transferrer.callSourceBlockchainID,
+						OriginTokenTransferrerAddress: transferrer.callOriginAddress,
+						OriginSenderAddress:           recipient,
+						RecipientContract:             transferrer.receiverAddress,
+						Amount:                        big.NewInt(1_000),
+						RecipientPayload:              make([]byte, testCase.payloadSize),
+						RecipientGasLimit:             limits.RecipientGasLimit,
+						FallbackRecipient:             recipient,
+					},
+				)
+				require.NoError(t, err)
+				result, err := transferrer.kit.DeliverMessage(
+					ctx, transferrer.address, transferrer.sourceBlockchainID, transferrer.sourceAddress,
+					message, limits.RequiredGasLimit.Uint64(),
+				)
+				require.NoError(t, err)
+				receiverTestUtils.RequireDelivered(t, result)
+				transferrer.requireCallResult(t, result, testCase.expectCallSuccess)
+				requireWithinMargin(t, result, limits.RequiredGasLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/math"
+	teleporterUtils "github.com/ava-labs/icm-contracts/utils/teleporter-utils"
+	"github.com/ava-labs/subnet-evm/core"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ava-labs/subnet-evm/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// DefaultRequiredGasLimitMarginPercentage is the safety margin added on top of the estimated
+// gas used by a Teleporter receiver, to account for state changes between estimation and delivery.
+const DefaultRequiredGasLimitMarginPercentage uint64 = 20
+
+// CallRules are the EVM rules to compute the intrinsic gas of contract calls with, using core.IntrinsicGas.
+// Only the upgrades active matter to intrinsic gas, and these are the rules of a chain with all of them.
+var CallRules = params.TestChainConfig.Rules(common.Big0, 0)
+
+// EstimateRequiredGasLimit estimates the requiredGasLimit to set for a Teleporter message.
+// It runs eth_estimateGas on the destination chain for the receiveTeleporterMessage call that
+// TeleporterMessenger at [teleporterMessengerAddress] would make to [destinationAddress], removes the
+// intrinsic transaction gas that is not charged for internal calls, and adds [marginPercentage] percent.
+//
+// For ICTT transfers, [destinationAddress] is the destination token transferrer, [originSenderAddress]
+// is the source token transferrer, and [message] is the encoded TransferrerMessage.
+func EstimateRequiredGasLimit(
+	ctx context.Context,
+	destinationClient interfaces.GasEstimator,
+	teleporterMessengerAddress common.Address,
+	destinationAddress common.Address,
+	sourceBlockchainID ids.ID,
+	originSenderAddress common.Address,
+	message []byte,
+	marginPercentage uint64,
+) (*big.Int, error) {
+	callData, err := teleporterUtils.PackReceiveTeleporterMessage(sourceBlockchainID, originSenderAddress, message)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack receiveTeleporterMessage call")
+	}
+
+	estimate, err := destinationClient.EstimateGas(ctx, interfaces.CallMsg{
+		From: teleporterMessengerAddress,
+		To:   &destinationAddress,
+		Data: callData,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to estimate receiveTeleporterMessage gas")
+	}
+
+	intrinsicGas, err := core.IntrinsicGas(callData, nil, false, CallRules)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute receiveTeleporterMessage intrinsic gas")
+	}
+	executionGas := estimate - intrinsicGas
+	return AddGasMargin(executionGas, marginPercentage)
+}
+
+// AddGasMargin returns [gas] increased by [marginPercentage] percent, rounded up.
+func AddGasMargin(gas uint64, marginPercentage uint64) (*big.Int, error) {
+	margin, err := math.Mul64(gas, marginPercentage)
+	if err != nil {
+		return nil, err
+	}
+	margin = (margin + 99) / 100
+	total, err := math.Add64(gas, margin)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetUint64(total), nil
+}
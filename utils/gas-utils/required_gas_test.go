@@ -0,0 +1,108 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	testmessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/tests/TestMessenger"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddGasMargin(t *testing.T) {
+	testCases := []struct {
+		name             string
+		gas              uint64
+		marginPercentage uint64
+		expected         uint64
+		expectedError    bool
+	}{
+		{name: "no margin", gas: 100_000, marginPercentage: 0, expected: 100_000},
+		{name: "default margin", gas: 100_000, marginPercentage: 20, expected: 120_000},
+		{name: "rounds up", gas: 101, marginPercentage: 10, expected: 112},
+		{name: "overflow", gas: math.MaxUint64, marginPercentage: 20, expectedError: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := AddGasMargin(test.gas, test.marginPercentage)
+			if test.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, res.Uint64())
+		})
+	}
+}
+
+// estimateTolerance is the gas an estimate may differ by from the measured execution gas with the
+// margin, since eth_estimateGas runs the receiveTeleporterMessage call as a transaction rather than
+// as an internal call of the delivery.
+const estimateTolerance = 5_000
+
+func TestEstimateRequiredGasLimit(t *testing.T) {
+	ctx := context.Background()
+	kit, err := receiverTestUtils.NewRegistryReceiverTestKit(ctx, 1)
+	require.NoError(t, err)
+	defer kit.Close()
+
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	appAddress, tx, _, err := testmessenger.DeployTestMessenger(
+		opts, kit.Client(), kit.TeleporterRegistryAddress, kit.DeployerAddress, big.NewInt(1),
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	stringTy, err := abi.NewType("string", "", nil)
+	require.NoError(t, err)
+	message, err := abi.Arguments{{Type: stringTy}}.Pack("estimate me")
+	require.NoError(t, err)
+	sourceBlockchainID := ids.ID{1}
+	originSender := common.HexToAddress("0x0123456789abcdef0123456789abcdef01234567")
+
+	requiredGasLimit, err := EstimateRequiredGasLimit(
+		ctx,
+		kit.Client(),
+		kit.TeleporterMessengerAddress(),
+		appAddress,
+		sourceBlockchainID,
+		originSender,
+		message,
+		DefaultRequiredGasLimitMarginPercentage,
+	)
+	require.NoError(t, err)
+
+	// Delivering with the estimate succeeds, and the estimate lies between the measured execution gas
+	// and the measured execution gas with the margin.
+	result, err := kit.DeliverMessage(
+		ctx, appAddress, sourceBlockchainID, originSender, message, requiredGasLimit.Uint64(),
+	)
+	require.NoError(t, err)
+	receiverTestUtils.RequireDelivered(t, result)
+	withMargin, err := AddGasMargin(result.ExecutionGasUsed, DefaultRequiredGasLimitMarginPercentage)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, requiredGasLimit.Uint64(), result.ExecutionGasUsed)
+	require.InDelta(t, withMargin.Uint64(), requiredGasLimit.Uint64(), estimateTolerance)
+
+	// Delivering with half of the measured execution gas fails.
+	result, err = kit.DeliverMessage(ctx, appAddress, ids.ID{2}, originSender, message, result.ExecutionGasUsed/2)
+	require.NoError(t, err)
+	require.False(t, result.Succeeded())
+}
+
+func TestCallRules(t *testing.T) {
+	gas, err := core.IntrinsicGas([]byte{0, 1}, nil, false, CallRules)
+	require.NoError(t, err)
+	require.Equal(t, uint64(21_000+4+16), gas)
+}
@@ -0,0 +1,369 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	nativetokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemote"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	tokenScalingUtils "github.com/ava-labs/icm-contracts/utils/token-scaling-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// Offsets of the NativeTokenRemoteStorage fields from NATIVE_TOKEN_REMOTE_STORAGE_LOCATION. The reward
+// percentage and the last reported balance have no getters, so they are read from storage.
+const (
+	burnedFeesRewardPercentageSlot = 0
+	lastestBurnedFeesReportedSlot  = 2
+)
+
+// BurnedFeesBackend is the chain of a NativeTokenRemote.
+type BurnedFeesBackend interface {
+	TrackerBackend
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+}
+
+// BurnedFeesState is the transaction fees burned on a NativeTokenRemote's chain that have not been
+// reported to its TokenHome. All amounts are denominated in the remote's token, except HomeAmount.
+type BurnedFeesState struct {
+	BurnAddressBalance *big.Int
+	// LastReported is the balance of the burn address the last time burned fees were reported.
+	LastReported     *big.Int
+	RewardPercentage *big.Int
+	Unreported       *big.Int
+	// Reward is the part of Unreported that reportBurnedTxFees re-mints as the relayer fee, and
+	// Reportable is the rest, which is burned on the TokenHome.
+	Reward     *big.Int
+	Reportable *big.Int
+	// HomeAmount is Reportable in the TokenHome's token. reportBurnedTxFees reverts if it is zero.
+	HomeAmount *big.Int
+}
+
+// GetBurnedFeesState reads the unreported burned transaction fees of the NativeTokenRemote at [remoteAddress].
+func GetBurnedFeesState(
+	ctx context.Context,
+	backend BurnedFeesBackend,
+	remoteAddress common.Address,
+) (*BurnedFeesState, error) {
+	remote, err := nativetokenremote.NewNativeTokenRemote(remoteAddress, backend)
+	if err != nil {
+		return nil, err
+	}
+	callOpts := &bind.CallOpts{Context: ctx}
+	burnAddress, err := remote.BURNEDTXFEESADDRESS(callOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get burned transaction fees address")
+	}
+	storageLocation, err := remote.NATIVETOKENREMOTESTORAGELOCATION(callOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get NativeTokenRemote storage location")
+	}
+	multiplier, err := remote.GetTokenMultiplier(callOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get token multiplier")
+	}
+	multiplyOnRemote, err := remote.GetMultiplyOnRemote(callOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get multiplyOnRemote")
+	}
+
+	state := &BurnedFeesState{}
+	state.BurnAddressBalance, err = backend.BalanceAt(ctx, burnAddress, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get balance of %s", burnAddress.Hex())
+	}
+	readSlot := func(offset int64) (*big.Int, error) {
+		slot := new(big.Int).Add(new(big.Int).SetBytes(storageLocation[:]), big.NewInt(offset))
+		value, err := backend.StorageAt(ctx, remoteAddress, common.BigToHash(slot), nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read storage slot %s", common.BigToHash(slot).Hex())
+		}
+		return new(big.Int).SetBytes(value), nil
+	}
+	if state.RewardPercentage, err = readSlot(burnedFeesRewardPercentageSlot); err != nil {
+		return nil, err
+	}
+	if state.LastReported, err = readSlot(lastestBurnedFeesReportedSlot); err != nil {
+		return nil, err
+	}
+
+	state.Unreported = new(big.Int).Sub(state.BurnAddressBalance, state.LastReported)
+	if state.Unreported.Sign() < 0 {
+		state.Unreported.SetUint64(0)
+	}
+	state.Reward = new(big.Int).Mul(state.Unreported, state.RewardPercentage)
+	state.Reward.Div(state.Reward, big.NewInt(100))
+	state.Reportable = new(big.Int).Sub(state.Unreported, state.Reward)
+	state.HomeAmount, err = tokenScalingUtils.RemoveTokenScale(multiplier, multiplyOnRemote, state.Reportable)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// BurnedFeesReport is a reportBurnedTxFees call sent by a BurnedFeesKeeper.
+type BurnedFeesReport struct {
+	// Hop is the Teleporter message to the TokenHome, which burns FeesBurned once it is executed.
+	Hop              *TransferHop `json:"hop"`
+	FeesBurned       *big.Int     `json:"feesBurned"`
+	RequiredGasLimit *big.Int     `json:"requiredGasLimit"`
+	ReportedAt       time.Time    `json:"reportedAt"`
+	// HomeBlock is the latest block of the TokenHome's chain before the report was sent, from which
+	// its delivery is looked up.
+	HomeBlock uint64 `json:"homeBlock"`
+}
+
+// BurnedFeesCheck is the result of a BurnedFeesKeeper check.
+type BurnedFeesCheck struct {
+	State *BurnedFeesState
+	// Report is the report sent by the check, or nil if none was due.
+	Report *BurnedFeesReport
+	// Processed are the reports the TokenHome executed since the previous check, and Pending the
+	// reports it has not executed yet, including Report.
+	Processed []*BurnedFeesReport
+	Pending   []*BurnedFeesReport
+	// Overdue are the pending reports sent more than the keeper's DeliveryTimeout ago.
+	Overdue []*BurnedFeesReport
+}
+
+// BurnedFeesKeeper reports the transaction fees burned on a NativeTokenRemote's chain to its TokenHome
+// by calling reportBurnedTxFees, and follows each report until the TokenHome executes it.
+type BurnedFeesKeeper struct {
+	Remote        BurnedFeesBackend
+	Sender        *TokenSender
+	RemoteAddress common.Address
+	// Home is the TokenHome's chain, where the required gas limit of each report is estimated and
+	// its delivery is looked up. HomeTeleporterAddress is the TeleporterMessenger that delivers it.
+	Home                  TrackerBackend
+	HomeTeleporterAddress common.Address
+	// RemoteBlockchainID is the blockchain ID the TokenHome receives reports from. Defaults to the
+	// NativeTokenRemote's blockchain ID.
+	RemoteBlockchainID ids.ID
+
+	// A report is due once the unreported fees reach Threshold, or Interval after the previous report.
+	// Either may be unset, but not both. The interval of the first report starts at the first check.
+	Threshold *big.Int
+	Interval  time.Duration
+	// DeliveryTimeout is how long a report may be pending before it is overdue. Reports are never
+	// overdue if it is zero.
+	DeliveryTimeout     time.Duration
+	GasMarginPercentage uint64
+	MaxBlockRange       uint64
+	// Save is called with the pending reports whenever they change, if it is not nil. Passing them to
+	// Resume after a restart follows them until the TokenHome executes them.
+	Save func(pending []*BurnedFeesReport) error
+
+	pending    []*BurnedFeesReport
+	lastReport time.Time
+	now        func() time.Time
+}
+
+// NewBurnedFeesKeeper creates a BurnedFeesKeeper for the NativeTokenRemote at [remoteAddress] on
+// [remote], which sends reports with [sender].
+func NewBurnedFeesKeeper(
+	remote BurnedFeesBackend,
+	sender *TokenSender,
+	remoteAddress common.Address,
+	home TrackerBackend,
+	homeTeleporterAddress common.Address,
+) *BurnedFeesKeeper {
+	return &BurnedFeesKeeper{
+		Remote:                remote,
+		Sender:                sender,
+		RemoteAddress:         remoteAddress,
+		Home:                  home,
+		HomeTeleporterAddress: homeTeleporterAddress,
+		GasMarginPercentage:   gasUtils.DefaultRequiredGasLimitMarginPercentage,
+		now:                   time.Now,
+	}
+}
+
+// Pending returns the reports the TokenHome has not executed as of the last check.
+func (k *BurnedFeesKeeper) Pending() []*BurnedFeesReport {
+	return k.pending
+}
+
+// Resume follows [pending], saved by a previous keeper, as if this keeper had sent them. The interval
+// of the next report starts at the latest of them.
+func (k *BurnedFeesKeeper) Resume(pending []*BurnedFeesReport) {
+	k.pending = pending
+	for _, report := range pending {
+		if report.ReportedAt.After(k.lastReport) {
+			k.lastReport = report.ReportedAt
+		}
+	}
+}
+
+// Check looks up the delivery of the pending reports, and reports the unreported burned fees if a
+// report is due.
+func (k *BurnedFeesKeeper) Check(ctx context.Context) (*BurnedFeesCheck, error) {
+	if (k.Threshold == nil || k.Threshold.Sign() <= 0) && k.Interval <= 0 {
+		return nil, errors.New("a threshold or an interval is required")
+	}
+	now := k.now()
+	if k.lastReport.IsZero() {
+		k.lastReport = now
+	}
+
+	check := &BurnedFeesCheck{}
+	for _, report := range k.pending {
+		if err := trackDelivery(ctx, k.Home, report.Hop, report.HomeBlock, k.MaxBlockRange); err != nil {
+			return nil, errors.Wrapf(err, "failed to track report %s", report.Hop.TeleporterMessageID)
+		}
+		if report.Hop.Executed {
+			check.Processed = append(check.Processed, report)
+		} else {
+			check.Pending = append(check.Pending, report)
+		}
+	}
+	k.pending = check.Pending
+	if len(check.Processed) > 0 {
+		if err := k.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := GetBurnedFeesState(ctx, k.Remote, k.RemoteAddress)
+	if err != nil {
+		return nil, err
+	}
+	check.State = state
+	if k.due(state, now) {
+		report, err := k.report(ctx, state)
+		if err != nil {
+			return nil, err
+		}
+		report.ReportedAt = now
+		k.lastReport = now
+		k.pending = append(k.pending, report)
+		check.Report, check.Pending = report, k.pending
+		if err := k.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, report := range check.Pending {
+		if k.DeliveryTimeout > 0 && now.Sub(report.ReportedAt) > k.DeliveryTimeout {
+			check.Overdue = append(check.Overdue, report)
+		}
+	}
+	return check, nil
+}
+
+// Run checks every [pollInterval] until [ctx] is done, and passes the result of each check to [handle].
+func (k *BurnedFeesKeeper) Run(
+	ctx context.Context,
+	pollInterval time.Duration,
+	handle func(check *BurnedFeesCheck, err error),
+) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		handle(k.Check(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (k *BurnedFeesKeeper) save() error {
+	if k.Save == nil {
+		return nil
+	}
+	return errors.Wrap(k.Save(k.pending), "failed to save pending reports")
+}
+
+func (k *BurnedFeesKeeper) due(state *BurnedFeesState, now time.Time) bool {
+	if state.HomeAmount.Sign() == 0 {
+		return false
+	}
+	if k.Threshold != nil && k.Threshold.Sign() > 0 && state.Unreported.Cmp(k.Threshold) >= 0 {
+		return true
+	}
+	return k.Interval > 0 && now.Sub(k.lastReport) >= k.Interval
+}
+
+// report calls reportBurnedTxFees with the required gas limit estimated for the TokenHome to burn
+// the fees reportable in [state].
+func (k *BurnedFeesKeeper) report(ctx context.Context, state *BurnedFeesState) (*BurnedFeesReport, error) {
+	remote, err := nativetokenremote.NewNativeTokenRemote(k.RemoteAddress, k.Remote)
+	if err != nil {
+		return nil, err
+	}
+	callOpts := &bind.CallOpts{Context: ctx}
+	homeAddress, err := remote.GetTokenHomeAddress(callOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TokenHome address")
+	}
+	burnAddress, err := remote.HOMECHAINBURNADDRESS(callOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get home chain burn address")
+	}
+	remoteBlockchainID := k.RemoteBlockchainID
+	if remoteBlockchainID == (ids.ID{}) {
+		blockchainID, err := remote.GetBlockchainID(callOpts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get blockchain ID")
+		}
+		remoteBlockchainID = blockchainID
+	}
+
+	message, err := itokentransferrer.PackTransferrerMessage(
+		itokentransferrer.SingleHopSend,
+		&itokentransferrer.SingleHopSendMessage{Recipient: burnAddress, Amount: state.Reportable},
+	)
+	if err != nil {
+		return nil, err
+	}
+	requiredGasLimit, err := gasUtils.EstimateRequiredGasLimit(
+		ctx,
+		k.Home,
+		k.HomeTeleporterAddress,
+		homeAddress,
+		remoteBlockchainID,
+		k.RemoteAddress,
+		message,
+		k.GasMarginPercentage,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to estimate the TokenHome's gas to burn the reported fees")
+	}
+
+	// The report can't be delivered before it is sent.
+	homeHead, err := k.Home.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get latest block of the TokenHome's chain")
+	}
+	receipt, err := k.Sender.transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return remote.ReportBurnedTxFees(opts, requiredGasLimit)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to report burned transaction fees")
+	}
+	event, ok := findEvent(receipt, &k.RemoteAddress, remote.ParseReportBurnedTxFees)
+	if !ok {
+		return nil, errors.Errorf("no ReportBurnedTxFees event in transaction %s", receipt.TxHash.Hex())
+	}
+	hop, err := newTransferHop(receipt, event.TeleporterMessageID, remoteBlockchainID, k.RemoteAddress)
+	if err != nil {
+		return nil, err
+	}
+	return &BurnedFeesReport{
+		Hop:              hop,
+		FeesBurned:       event.FeesBurned,
+		RequiredGasLimit: requiredGasLimit,
+		HomeBlock:        homeHead.Number.Uint64(),
+	}, nil
+}
@@ -0,0 +1,227 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	nativeMinter "github.com/ava-labs/icm-contracts/abi-bindings/go/INativeMinter"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/ethclient/simulated"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/nativeminter"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/stretchr/testify/require"
+)
+
+// deliveryLogBackend adds the ReceiveCrossChainMessage and MessageExecuted events that a real
+// TeleporterMessenger emits to the messages delivered through the test kit, which emits neither.
+type deliveryLogBackend struct {
+	simulated.Client
+	deliveries map[ids.ID]*types.Receipt
+}
+
+func (b *deliveryLogBackend) FilterLogs(ctx context.Context, query interfaces.FilterQuery) ([]types.Log, error) {
+	logs, err := b.Client.FilterLogs(ctx, query)
+	if err != nil || len(query.Topics) < 2 {
+		return logs, err
+	}
+	for _, eventID := range query.Topics[0] {
+		if eventID != receiveEventID && eventID != executedEventID {
+			continue
+		}
+		for _, topic := range query.Topics[1] {
+			receipt, ok := b.deliveries[ids.ID(topic)]
+			if !ok || receipt.BlockNumber.Cmp(query.FromBlock) < 0 || receipt.BlockNumber.Cmp(query.ToBlock) > 0 {
+				continue
+			}
+			logs = append(logs, types.Log{
+				Topics:      []common.Hash{eventID, topic},
+				BlockNumber: receipt.BlockNumber.Uint64(),
+				TxHash:      receipt.TxHash,
+			})
+		}
+	}
+	return logs, nil
+}
+
+func TestBurnedFeesKeeper(t *testing.T) {
+	ctx := context.Background()
+	env := receiverTestUtils.NewTokenHomeTestEnv(t, 18)
+	kit := env.Kit
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	sender := NewTokenSender(kit.Client(), opts, kit.Commit)
+
+	// The NativeTokenRemote is deployed to the same chain as the TokenHome, and is registered under a
+	// placeholder blockchain ID, which its reports are delivered from.
+	remoteID := ids.ID{8}
+	deliver := func(receipt *types.Receipt, gasLimit uint64) *receiverTestUtils.DeliveryResult {
+		event, ok := findEvent(receipt, nil, teleporterFilterer.ParseSendCrossChainMessage)
+		require.True(t, ok)
+		if gasLimit == 0 {
+			gasLimit = event.Message.RequiredGasLimit.Uint64()
+		}
+		result, err := kit.DeliverMessage(ctx, event.Message.DestinationAddress, remoteID,
+			event.Message.OriginSenderAddress, event.Message.Message, gasLimit)
+		require.NoError(t, err)
+		return result
+	}
+	deployer := NewRemoteDeployer(sender, sender)
+	deployer.Relay = func(_ context.Context, receipt *types.Receipt) error {
+		receiverTestUtils.RequireDelivered(t, deliver(receipt, 0))
+		return nil
+	}
+	deployment := &RemoteDeployment{RemoteBlockchainID: remoteID}
+	require.NoError(t, deployer.Deploy(ctx, &RemoteSpec{
+		Kind:                                NativeTokenRemoteKind,
+		TeleporterRegistryAddress:           env.RegistryAddress,
+		TokenHomeBlockchainID:               ids.ID{9},
+		TokenHomeAddress:                    env.HomeAddress,
+		NativeAssetSymbol:                   "NTV",
+		InitialReserveImbalance:             big.NewInt(1_000),
+		BurnedFeesReportingRewardPercentage: big.NewInt(10),
+	}, deployment))
+	remoteAddress := deployment.RemoteAddress
+
+	// The reward is minted to the NativeTokenRemote, and the TokenHome burns the reported fees out of
+	// the balance it has transferred to the remote.
+	minter, err := nativeMinter.NewINativeMinter(nativeminter.ContractAddress, kit.Client())
+	require.NoError(t, err)
+	tx, err := minter.SetEnabled(opts, remoteAddress)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	// Adding collateral used up the TokenHome's allowance.
+	tokenAddress, err := env.Home.GetTokenAddress(nil)
+	require.NoError(t, err)
+	require.NoError(t, sender.approve(ctx, tokenAddress, env.HomeAddress, math.MaxBig256))
+	env.Send(t, remoteID, remoteAddress, big.NewInt(1e18))
+
+	home := &deliveryLogBackend{Client: kit.Client(), deliveries: make(map[ids.ID]*types.Receipt)}
+	keeper := NewBurnedFeesKeeper(kit.Client(), sender, remoteAddress, home, env.MessengerAddress)
+	keeper.RemoteBlockchainID = remoteID
+	var saved []byte
+	keeper.Save = func(pending []*BurnedFeesReport) error {
+		var err error
+		saved, err = json.Marshal(pending)
+		return err
+	}
+	keeper.Interval = time.Hour
+	keeper.DeliveryTimeout = 10 * time.Minute
+	clock := time.Unix(1_000_000, 0)
+	keeper.now = func() time.Time { return clock }
+
+	// The simulated chain burns the fees of every transaction, but the first check only starts the
+	// interval.
+	check, err := keeper.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, check.Report)
+	require.Positive(t, check.State.Unreported.Sign())
+	require.Zero(t, check.State.LastReported.Sign())
+	require.Equal(t, big.NewInt(10), check.State.RewardPercentage)
+	require.Equal(t, check.State.Unreported, new(big.Int).Add(check.State.Reward, check.State.Reportable))
+	require.Equal(t, check.State.Reportable, check.State.HomeAmount)
+
+	clock = clock.Add(time.Hour)
+	check, err = keeper.Check(ctx)
+	require.NoError(t, err)
+	report := check.Report
+	require.NotNil(t, report)
+	require.Equal(t, check.State.Reportable, report.FeesBurned)
+	require.Equal(t, clock, report.ReportedAt)
+	require.Equal(t, []*BurnedFeesReport{report}, check.Pending)
+	require.Equal(t, check.Pending, keeper.Pending())
+	require.Empty(t, check.Overdue)
+	hop := report.Hop
+	require.NotEqual(t, ids.ID{}, hop.TeleporterMessageID)
+	require.Equal(t, remoteID, hop.SourceBlockchainID)
+	require.Equal(t, env.HomeAddress, hop.DestinationAddress)
+	require.Equal(t, itokentransferrer.SingleHopSend, hop.MessageType)
+	require.Equal(t, report.FeesBurned, hop.Amount)
+	require.NotZero(t, report.HomeBlock)
+	require.NotEmpty(t, saved)
+
+	state, err := GetBurnedFeesState(ctx, kit.Client(), remoteAddress)
+	require.NoError(t, err)
+	require.Equal(t, check.State.BurnAddressBalance, state.LastReported)
+
+	// The report is delivered with the estimated gas limit, and the TokenHome burns the fees.
+	receipt, err := kit.Client().TransactionReceipt(ctx, hop.SendTxHash)
+	require.NoError(t, err)
+	result := deliver(receipt, 0)
+	receiverTestUtils.RequireDelivered(t, result)
+	withdrawn, ok := findEvent(result.Receipt, &env.HomeAddress, tokenTransferrerFilterer.ParseTokensWithdrawn)
+	require.True(t, ok)
+	require.Equal(t, report.FeesBurned, withdrawn.Amount)
+
+	// Until the TeleporterMessenger's events show the delivery, the report stays pending, and is
+	// overdue once the delivery timeout passes.
+	clock = clock.Add(20 * time.Minute)
+	check, err = keeper.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, check.Report)
+	require.Empty(t, check.Processed)
+	require.Equal(t, []*BurnedFeesReport{report}, check.Pending)
+	require.Equal(t, []*BurnedFeesReport{report}, check.Overdue)
+
+	// The fees burned since the report reach the threshold before the interval.
+	keeper.Threshold = big.NewInt(1)
+	check, err = keeper.Check(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, check.Report)
+	require.NotEqual(t, hop.TeleporterMessageID, check.Report.Hop.TeleporterMessageID)
+	require.Equal(t, []*BurnedFeesReport{report, check.Report}, check.Pending)
+	require.Equal(t, []*BurnedFeesReport{report}, check.Overdue)
+	second := check.Report
+
+	// Once the TokenHome executes the first report, the keeper clears it.
+	home.deliveries[hop.TeleporterMessageID] = result.Receipt
+	keeper.Threshold = nil
+	check, err = keeper.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, check.Report)
+	require.Equal(t, []*BurnedFeesReport{report}, check.Processed)
+	require.True(t, report.Hop.Delivered)
+	require.True(t, report.Hop.Executed)
+	require.Equal(t, result.Receipt.TxHash, report.Hop.ExecutionTxHash)
+	require.Equal(t, []*BurnedFeesReport{second}, check.Pending)
+	require.Equal(t, check.Pending, keeper.Pending())
+
+	// A keeper restarted from the saved reports follows the second report until it is executed.
+	var pending []*BurnedFeesReport
+	require.NoError(t, json.Unmarshal(saved, &pending))
+	require.Len(t, pending, 1)
+	require.Equal(t, second.Hop.TeleporterMessageID, pending[0].Hop.TeleporterMessageID)
+	restarted := NewBurnedFeesKeeper(kit.Client(), sender, remoteAddress, home, env.MessengerAddress)
+	restarted.RemoteBlockchainID = remoteID
+	restarted.Interval = time.Hour
+	restarted.now = keeper.now
+	restarted.Resume(pending)
+	receipt, err = kit.Client().TransactionReceipt(ctx, second.Hop.SendTxHash)
+	require.NoError(t, err)
+	result = deliver(receipt, 0)
+	receiverTestUtils.RequireDelivered(t, result)
+	home.deliveries[second.Hop.TeleporterMessageID] = result.Receipt
+	check, err = restarted.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, check.Report)
+	require.Len(t, check.Processed, 1)
+	require.Equal(t, second.Hop.TeleporterMessageID, check.Processed[0].Hop.TeleporterMessageID)
+	require.Empty(t, restarted.Pending())
+
+	keeper.Threshold, keeper.Interval = nil, 0
+	_, err = keeper.Check(ctx)
+	require.ErrorContains(t, err, "a threshold or an interval is required")
+	_, err = GetBurnedFeesState(ctx, kit.Client(), env.HomeAddress)
+	require.ErrorContains(t, err, "failed to get burned transaction fees address")
+}
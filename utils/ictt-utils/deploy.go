@@ -0,0 +1,663 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	transparentupgradeableproxy "github.com/ava-labs/icm-contracts/abi-bindings/go/TransparentUpgradeableProxy"
+	erc20tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/ERC20TokenHome"
+	nativetokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/NativeTokenHome"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	erc20tokenremoteupgradeable "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemoteUpgradeable"
+	nativetokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemote"
+	nativetokenremoteupgradeable "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemoteUpgradeable"
+	tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/TokenRemote"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// icmInitializableDisallowed is ICMInitializable.Disallowed, which disables the initializers of an
+// upgradeable implementation so that it can only be initialized through a proxy.
+const icmInitializableDisallowed uint8 = 1
+
+// DefaultRegistrationPollInterval is how often a RemoteDeployer without a relayer checks whether
+// the registration of a TokenRemote has been delivered to its TokenHome.
+const DefaultRegistrationPollInterval = 2 * time.Second
+
+// RemoteSpec describes a TokenRemote to deploy and register with its TokenHome. Optional fields left
+// unset are read from the chains when the remote is deployed.
+type RemoteSpec struct {
+	// Kind is ERC20TokenRemoteKind or NativeTokenRemoteKind.
+	Kind TransferrerKind `json:"kind"`
+	// Upgradeable deploys the upgradeable version of the contract behind a TransparentUpgradeableProxy,
+	// whose ProxyAdmin is owned by ProxyAdminOwner. The owner defaults to the deployer.
+	Upgradeable     bool           `json:"upgradeable"`
+	ProxyAdminOwner common.Address `json:"proxyAdminOwner"`
+
+	TeleporterRegistryAddress common.Address `json:"teleporterRegistryAddress"`
+	// TeleporterManager defaults to the deployer.
+	TeleporterManager common.Address `json:"teleporterManager"`
+	// MinTeleporterVersion defaults to the latest version of the TeleporterRegistry.
+	MinTeleporterVersion *big.Int `json:"minTeleporterVersion"`
+	// TokenHomeBlockchainID defaults to the blockchain ID of the TokenHome's chain.
+	TokenHomeBlockchainID ids.ID         `json:"tokenHomeBlockchainID"`
+	TokenHomeAddress      common.Address `json:"tokenHomeAddress"`
+
+	// TokenName, TokenSymbol and TokenDecimals configure an ERC20TokenRemote.
+	TokenName     string `json:"tokenName"`
+	TokenSymbol   string `json:"tokenSymbol"`
+	TokenDecimals uint8  `json:"tokenDecimals"`
+
+	// NativeAssetSymbol, InitialReserveImbalance and BurnedFeesReportingRewardPercentage configure a
+	// NativeTokenRemote. The amounts default to zero.
+	NativeAssetSymbol                   string   `json:"nativeAssetSymbol"`
+	InitialReserveImbalance             *big.Int `json:"initialReserveImbalance"`
+	BurnedFeesReportingRewardPercentage *big.Int `json:"burnedFeesReportingRewardPercentage"`
+
+	// RegistrationFee is the Teleporter fee paid in RegistrationFeeTokenAddress to relay the
+	// registration message. It defaults to zero.
+	RegistrationFeeTokenAddress common.Address `json:"registrationFeeTokenAddress"`
+	RegistrationFee             *big.Int       `json:"registrationFee"`
+}
+
+// RemoteDeployment is the progress of a RemoteDeployer. It is saved after every transaction is sent,
+// and passing it back to RemoteDeployer.Deploy resumes the deployment where it stopped.
+type RemoteDeployment struct {
+	// RemoteAddress is the TokenRemote, which is the proxy of an upgradeable deployment.
+	RemoteAddress common.Address `json:"remoteAddress"`
+	RemoteTxHash  common.Hash    `json:"remoteTxHash"`
+	// ImplementationAddress and ProxyAdminAddress are only set for an upgradeable deployment.
+	ImplementationAddress common.Address `json:"implementationAddress"`
+	ImplementationTxHash  common.Hash    `json:"implementationTxHash"`
+	ProxyAdminAddress     common.Address `json:"proxyAdminAddress"`
+	// RemoteBlockchainID is the blockchain ID the TokenHome registers the remote under. It defaults to
+	// the blockchain ID of the remote's chain.
+	RemoteBlockchainID ids.ID      `json:"remoteBlockchainID"`
+	RegistrationTxHash common.Hash `json:"registrationTxHash"`
+	Registered         bool        `json:"registered"`
+	Collateralized     bool        `json:"collateralized"`
+}
+
+// Done returns whether the remote is registered with its TokenHome and fully collateralized.
+func (d *RemoteDeployment) Done() bool {
+	return d.Registered && d.Collateralized
+}
+
+// MessageRelayer delivers the Teleporter messages sent by the transaction of [receipt].
+type MessageRelayer func(ctx context.Context, receipt *types.Receipt) error
+
+// RemoteDeployer deploys TokenRemote instances, registers them with their TokenHome and adds the
+// collateral their initial reserve imbalance requires. Every step checks the state of the chains
+// before sending a transaction, so that a deployment can be repeated or resumed after a failure.
+type RemoteDeployer struct {
+	// Remote sends transactions on the TokenRemote's chain, and Home on the TokenHome's chain. To resume
+	// a deployment, the remote backend must implement bind.DeployBackend.
+	Remote *TokenSender
+	Home   *TokenSender
+	// Relay delivers the registration message to the TokenHome. If it is nil, the deployer waits for
+	// a relayer to deliver it, checking every PollInterval.
+	Relay        MessageRelayer
+	PollInterval time.Duration
+	// Save is called with the deployment whenever it changes, if it is not nil.
+	Save func(deployment *RemoteDeployment) error
+}
+
+// NewRemoteDeployer creates a RemoteDeployer that waits for a relayer to deliver registrations.
+func NewRemoteDeployer(remote, home *TokenSender) *RemoteDeployer {
+	return &RemoteDeployer{
+		Remote:       remote,
+		Home:         home,
+		PollInterval: DefaultRegistrationPollInterval,
+	}
+}
+
+// Deploy deploys the TokenRemote described by [spec], registers it with its TokenHome and adds any
+// collateral it needs, skipping the steps that [deployment] shows are done. [deployment] is updated
+// as the steps complete.
+func (d *RemoteDeployer) Deploy(ctx context.Context, spec *RemoteSpec, deployment *RemoteDeployment) error {
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	if err := d.deployRemote(ctx, spec, deployment); err != nil {
+		return err
+	}
+	if err := d.checkRemote(ctx, spec, deployment); err != nil {
+		return err
+	}
+	settings, err := d.register(ctx, spec, deployment)
+	if err != nil {
+		return err
+	}
+	return d.collateralize(ctx, spec, deployment, settings)
+}
+
+// Validate checks that the spec describes a TokenRemote that can be deployed.
+func (s *RemoteSpec) Validate() error {
+	if s.Kind != ERC20TokenRemoteKind && s.Kind != NativeTokenRemoteKind {
+		return errors.Errorf("%s can't be deployed as a TokenRemote", s.Kind)
+	}
+	if s.TeleporterRegistryAddress == (common.Address{}) {
+		return errors.New("TeleporterRegistry address is required")
+	}
+	if s.TokenHomeAddress == (common.Address{}) {
+		return errors.New("TokenHome address is required")
+	}
+	if s.Kind == ERC20TokenRemoteKind && (s.TokenName == "" || s.TokenSymbol == "") {
+		return errors.New("token name and symbol are required for an ERC20TokenRemote")
+	}
+	if s.Kind == NativeTokenRemoteKind && s.NativeAssetSymbol == "" {
+		return errors.New("native asset symbol is required for a NativeTokenRemote")
+	}
+	if s.RegistrationFee != nil && s.RegistrationFee.Sign() > 0 && s.RegistrationFeeTokenAddress == (common.Address{}) {
+		return errors.New("registration fee token address is required for a non-zero registration fee")
+	}
+	return nil
+}
+
+// remoteSettings returns the TokenRemoteSettings of [spec], reading the settings it leaves unset from
+// the chains.
+func (d *RemoteDeployer) remoteSettings(
+	ctx context.Context,
+	spec *RemoteSpec,
+) (erc20tokenremote.TokenRemoteSettings, error) {
+	opts := &bind.CallOpts{Context: ctx}
+	settings := erc20tokenremote.TokenRemoteSettings{
+		TeleporterRegistryAddress: spec.TeleporterRegistryAddress,
+		TeleporterManager:         spec.TeleporterManager,
+		MinTeleporterVersion:      spec.MinTeleporterVersion,
+		TokenHomeBlockchainID:     spec.TokenHomeBlockchainID,
+		TokenHomeAddress:          spec.TokenHomeAddress,
+	}
+	if settings.TeleporterManager == (common.Address{}) {
+		settings.TeleporterManager = d.Remote.Opts.From
+	}
+	if settings.MinTeleporterVersion == nil {
+		registry, err := teleporterregistry.NewTeleporterRegistry(spec.TeleporterRegistryAddress, d.Remote.Backend)
+		if err != nil {
+			return settings, err
+		}
+		if settings.MinTeleporterVersion, err = registry.LatestVersion(opts); err != nil {
+			return settings, errors.Wrap(err, "failed to get latest Teleporter version")
+		}
+	}
+	home, err := tokenhome.NewTokenHome(spec.TokenHomeAddress, d.Home.Backend)
+	if err != nil {
+		return settings, err
+	}
+	if settings.TokenHomeBlockchainID == (ids.ID{}) {
+		if settings.TokenHomeBlockchainID, err = home.GetBlockchainID(opts); err != nil {
+			return settings, errors.Wrap(err, "failed to get TokenHome blockchain ID")
+		}
+	}
+	// The home token decimals are checked by the TokenHome when the remote registers, so they are
+	// always read from its token rather than specified.
+	tokenAddress, err := home.GetTokenAddress(opts)
+	if err != nil {
+		return settings, errors.Wrap(err, "failed to get TokenHome token address")
+	}
+	token, err := exampleerc20.NewExampleERC20(tokenAddress, d.Home.Backend)
+	if err != nil {
+		return settings, err
+	}
+	if settings.TokenHomeDecimals, err = token.Decimals(opts); err != nil {
+		return settings, errors.Wrap(err, "failed to get TokenHome token decimals")
+	}
+	return settings, nil
+}
+
+// deployRemote deploys the TokenRemote, and its implementation and proxy if it is upgradeable,
+// unless they are already deployed.
+func (d *RemoteDeployer) deployRemote(ctx context.Context, spec *RemoteSpec, deployment *RemoteDeployment) error {
+	if deployment.RemoteAddress != (common.Address{}) {
+		deployed, err := d.resumeDeployment(ctx, deployment.RemoteAddress, deployment.RemoteTxHash)
+		if err != nil {
+			return err
+		}
+		if deployed && spec.Upgradeable && deployment.ProxyAdminAddress == (common.Address{}) {
+			receipt, err := d.savedReceipt(ctx, deployment.RemoteTxHash)
+			if err != nil {
+				return err
+			}
+			return d.saveProxyAdmin(deployment, receipt)
+		}
+		if deployed {
+			return nil
+		}
+	}
+	settings, err := d.remoteSettings(ctx, spec)
+	if err != nil {
+		return err
+	}
+	reserveImbalance, rewardPercentage := spec.InitialReserveImbalance, spec.BurnedFeesReportingRewardPercentage
+	if reserveImbalance == nil {
+		reserveImbalance = big.NewInt(0)
+	}
+	if rewardPercentage == nil {
+		rewardPercentage = big.NewInt(0)
+	}
+
+	if spec.Upgradeable {
+		return d.deployUpgradeableRemote(ctx, spec, deployment, settings, reserveImbalance, rewardPercentage)
+	}
+	_, err = d.deployContract(ctx, deployment, spec.Kind.String(), &deployment.RemoteAddress,
+		&deployment.RemoteTxHash,
+		func(opts *bind.TransactOpts) (common.Address, *types.Transaction, error) {
+			if spec.Kind == ERC20TokenRemoteKind {
+				address, tx, _, err := erc20tokenremote.DeployERC20TokenRemote(
+					opts, d.Remote.Backend, settings,
+					spec.TokenName, spec.TokenSymbol, spec.TokenDecimals,
+				)
+				return address, tx, err
+			}
+			address, tx, _, err := nativetokenremote.DeployNativeTokenRemote(
+				opts, d.Remote.Backend, nativetokenremote.TokenRemoteSettings(settings),
+				spec.NativeAssetSymbol, reserveImbalance, rewardPercentage,
+			)
+			return address, tx, err
+		})
+	return err
+}
+
+// deployUpgradeableRemote deploys the implementation of the TokenRemote, unless it is already
+// deployed, and a TransparentUpgradeableProxy for it.
+func (d *RemoteDeployer) deployUpgradeableRemote(
+	ctx context.Context,
+	spec *RemoteSpec,
+	deployment *RemoteDeployment,
+	settings erc20tokenremote.TokenRemoteSettings,
+	reserveImbalance *big.Int,
+	rewardPercentage *big.Int,
+) error {
+	// The proxy is deployed with the initialize call, so that nobody else can initialize it first.
+	var initialize []byte
+	if spec.Kind == ERC20TokenRemoteKind {
+		remoteABI, err := erc20tokenremoteupgradeable.ERC20TokenRemoteUpgradeableMetaData.GetAbi()
+		if err != nil {
+			return err
+		}
+		initialize, err = remoteABI.Pack(
+			"initialize", erc20tokenremoteupgradeable.TokenRemoteSettings(settings),
+			spec.TokenName, spec.TokenSymbol, spec.TokenDecimals,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to pack initialize call")
+		}
+	} else {
+		remoteABI, err := nativetokenremoteupgradeable.NativeTokenRemoteUpgradeableMetaData.GetAbi()
+		if err != nil {
+			return err
+		}
+		initialize, err = remoteABI.Pack(
+			"initialize", nativetokenremoteupgradeable.TokenRemoteSettings(settings),
+			spec.NativeAssetSymbol, reserveImbalance, rewardPercentage,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to pack initialize call")
+		}
+	}
+	deployed := false
+	var err error
+	if deployment.ImplementationAddress != (common.Address{}) {
+		deployed, err = d.resumeDeployment(ctx, deployment.ImplementationAddress, deployment.ImplementationTxHash)
+		if err != nil {
+			return err
+		}
+	}
+	if !deployed {
+		_, err = d.deployContract(ctx, deployment, spec.Kind.String()+" implementation",
+			&deployment.ImplementationAddress, &deployment.ImplementationTxHash,
+			func(opts *bind.TransactOpts) (common.Address, *types.Transaction, error) {
+				if spec.Kind == ERC20TokenRemoteKind {
+					address, tx, _, err := erc20tokenremoteupgradeable.DeployERC20TokenRemoteUpgradeable(
+						opts, d.Remote.Backend, icmInitializableDisallowed,
+					)
+					return address, tx, err
+				}
+				address, tx, _, err := nativetokenremoteupgradeable.DeployNativeTokenRemoteUpgradeable(
+					opts, d.Remote.Backend, icmInitializableDisallowed,
+				)
+				return address, tx, err
+			})
+		if err != nil {
+			return err
+		}
+	}
+	proxyAdminOwner := spec.ProxyAdminOwner
+	if proxyAdminOwner == (common.Address{}) {
+		proxyAdminOwner = d.Remote.Opts.From
+	}
+	receipt, err := d.deployContract(ctx, deployment, "TransparentUpgradeableProxy", &deployment.RemoteAddress,
+		&deployment.RemoteTxHash,
+		func(opts *bind.TransactOpts) (common.Address, *types.Transaction, error) {
+			address, tx, _, err := transparentupgradeableproxy.DeployTransparentUpgradeableProxy(
+				opts, d.Remote.Backend, deployment.ImplementationAddress, proxyAdminOwner, initialize,
+			)
+			return address, tx, err
+		})
+	if err != nil {
+		return err
+	}
+	return d.saveProxyAdmin(deployment, receipt)
+}
+
+// saveProxyAdmin saves the ProxyAdmin that the proxy deployed by [receipt] deployed, whose address is
+// only emitted in its AdminChanged event.
+func (d *RemoteDeployer) saveProxyAdmin(deployment *RemoteDeployment, receipt *types.Receipt) error {
+	proxy, err := transparentupgradeableproxy.NewTransparentUpgradeableProxyFilterer(deployment.RemoteAddress, nil)
+	if err != nil {
+		return err
+	}
+	event, ok := findEvent(receipt, &deployment.RemoteAddress, proxy.ParseAdminChanged)
+	if !ok {
+		return errors.Errorf("no AdminChanged event in transaction %s", receipt.TxHash.Hex())
+	}
+	deployment.ProxyAdminAddress = event.NewAdmin
+	return d.save(deployment)
+}
+
+// checkRemote checks that the deployed TokenRemote is configured with the TokenHome of [spec], which
+// protects against resuming a deployment with the wrong spec.
+func (d *RemoteDeployer) checkRemote(ctx context.Context, spec *RemoteSpec, deployment *RemoteDeployment) error {
+	remote, err := tokenremote.NewTokenRemote(deployment.RemoteAddress, d.Remote.Backend)
+	if err != nil {
+		return err
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	homeAddress, err := remote.GetTokenHomeAddress(opts)
+	if err != nil {
+		return errors.Wrap(err, "failed to get token home address")
+	}
+	if homeAddress != spec.TokenHomeAddress {
+		return errors.Errorf("TokenRemote %s is configured with TokenHome %s, not %s",
+			deployment.RemoteAddress.Hex(), homeAddress.Hex(), spec.TokenHomeAddress.Hex())
+	}
+	homeBlockchainID, err := remote.GetTokenHomeBlockchainID(opts)
+	if err != nil {
+		return errors.Wrap(err, "failed to get token home blockchain ID")
+	}
+	if spec.TokenHomeBlockchainID != (ids.ID{}) && ids.ID(homeBlockchainID) != spec.TokenHomeBlockchainID {
+		return errors.Errorf("TokenRemote %s is configured with TokenHome blockchain ID %s, not %s",
+			deployment.RemoteAddress.Hex(), ids.ID(homeBlockchainID), spec.TokenHomeBlockchainID)
+	}
+	if deployment.RemoteBlockchainID == (ids.ID{}) {
+		blockchainID, err := remote.GetBlockchainID(opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to get TokenRemote blockchain ID")
+		}
+		deployment.RemoteBlockchainID = blockchainID
+		return d.save(deployment)
+	}
+	return nil
+}
+
+// register sends the registration message of the TokenRemote unless the TokenHome has registered it
+// or a registration message was already sent, waits for it to be delivered, and returns the
+// TokenHome's settings for the remote.
+func (d *RemoteDeployer) register(
+	ctx context.Context,
+	spec *RemoteSpec,
+	deployment *RemoteDeployment,
+) (tokenhome.RemoteTokenTransferrerSettings, error) {
+	home, err := tokenhome.NewTokenHome(spec.TokenHomeAddress, d.Home.Backend)
+	if err != nil {
+		return tokenhome.RemoteTokenTransferrerSettings{}, err
+	}
+	settings, err := d.remoteSettingsOnHome(ctx, home, deployment)
+	if err != nil || settings.Registered {
+		return settings, err
+	}
+
+	var receipt *types.Receipt
+	if deployment.RegistrationTxHash != (common.Hash{}) {
+		if receipt, err = d.savedReceipt(ctx, deployment.RegistrationTxHash); err != nil {
+			return settings, err
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			receipt = nil
+		}
+	}
+	if receipt == nil {
+		if receipt, err = d.sendRegistration(ctx, spec, deployment); err != nil {
+			return settings, err
+		}
+	}
+
+	if d.Relay != nil {
+		if err := d.Relay(ctx, receipt); err != nil {
+			return settings, errors.Wrap(err, "failed to relay registration message")
+		}
+		if settings, err = d.remoteSettingsOnHome(ctx, home, deployment); err != nil {
+			return settings, err
+		}
+		if !settings.Registered {
+			return settings, errors.Errorf("TokenHome %s did not register TokenRemote %s after the relay",
+				spec.TokenHomeAddress.Hex(), deployment.RemoteAddress.Hex())
+		}
+		return settings, nil
+	}
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return settings, errors.Wrap(ctx.Err(), "registration message was not delivered")
+		case <-ticker.C:
+		}
+		if settings, err = d.remoteSettingsOnHome(ctx, home, deployment); err != nil || settings.Registered {
+			return settings, err
+		}
+	}
+}
+
+// remoteSettingsOnHome returns the TokenHome's settings for the remote, and records whether it is
+// registered in [deployment].
+func (d *RemoteDeployer) remoteSettingsOnHome(
+	ctx context.Context,
+	home *tokenhome.TokenHome,
+	deployment *RemoteDeployment,
+) (tokenhome.RemoteTokenTransferrerSettings, error) {
+	settings, err := home.GetRemoteTokenTransferrerSettings(
+		&bind.CallOpts{Context: ctx}, deployment.RemoteBlockchainID, deployment.RemoteAddress,
+	)
+	if err != nil {
+		return settings, errors.Wrap(err, "failed to get remote token transferrer settings")
+	}
+	if settings.Registered != deployment.Registered {
+		deployment.Registered = settings.Registered
+		return settings, d.save(deployment)
+	}
+	return settings, nil
+}
+
+// sendRegistration approves the registration fee and calls registerWithHome on the TokenRemote.
+func (d *RemoteDeployer) sendRegistration(
+	ctx context.Context,
+	spec *RemoteSpec,
+	deployment *RemoteDeployment,
+) (*types.Receipt, error) {
+	remote, err := tokenremote.NewTokenRemote(deployment.RemoteAddress, d.Remote.Backend)
+	if err != nil {
+		return nil, err
+	}
+	fee := spec.RegistrationFee
+	if fee == nil {
+		fee = big.NewInt(0)
+	}
+	if fee.Sign() > 0 {
+		if err := d.Remote.approve(ctx, spec.RegistrationFeeTokenAddress, deployment.RemoteAddress, fee); err != nil {
+			return nil, err
+		}
+	}
+	receipt, err := d.sendAndSave(ctx, deployment, &deployment.RegistrationTxHash,
+		func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return remote.RegisterWithHome(opts, tokenremote.TeleporterFeeInfo{
+				FeeTokenAddress: spec.RegistrationFeeTokenAddress,
+				Amount:          fee,
+			})
+		})
+	return receipt, errors.Wrap(err, "failed to register with home")
+}
+
+// collateralize adds the collateral the TokenHome needs for the remote, if any.
+func (d *RemoteDeployer) collateralize(
+	ctx context.Context,
+	spec *RemoteSpec,
+	deployment *RemoteDeployment,
+	settings tokenhome.RemoteTokenTransferrerSettings,
+) error {
+	if settings.CollateralNeeded.Sign() > 0 {
+		kind, err := DetectTransferrerKind(ctx, d.Home.Backend, spec.TokenHomeAddress)
+		if err != nil {
+			return err
+		}
+		if kind == ERC20TokenHomeKind {
+			home, err := erc20tokenhome.NewERC20TokenHome(spec.TokenHomeAddress, d.Home.Backend)
+			if err != nil {
+				return err
+			}
+			tokenAddress, err := home.GetTokenAddress(&bind.CallOpts{Context: ctx})
+			if err != nil {
+				return errors.Wrap(err, "failed to get TokenHome token address")
+			}
+			if err := d.Home.approve(ctx, tokenAddress, spec.TokenHomeAddress, settings.CollateralNeeded); err != nil {
+				return err
+			}
+			_, err = d.Home.transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+				return home.AddCollateral(opts, deployment.RemoteBlockchainID, deployment.RemoteAddress,
+					settings.CollateralNeeded)
+			})
+			if err != nil {
+				return errors.Wrap(err, "failed to add collateral")
+			}
+		} else {
+			home, err := nativetokenhome.NewNativeTokenHome(spec.TokenHomeAddress, d.Home.Backend)
+			if err != nil {
+				return err
+			}
+			_, err = d.Home.transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+				opts.Value = settings.CollateralNeeded
+				return home.AddCollateral(opts, deployment.RemoteBlockchainID, deployment.RemoteAddress)
+			})
+			if err != nil {
+				return errors.Wrap(err, "failed to add collateral")
+			}
+		}
+		home, err := tokenhome.NewTokenHome(spec.TokenHomeAddress, d.Home.Backend)
+		if err != nil {
+			return err
+		}
+		if settings, err = d.remoteSettingsOnHome(ctx, home, deployment); err != nil {
+			return err
+		}
+		if settings.CollateralNeeded.Sign() > 0 {
+			return errors.Errorf("TokenHome %s still needs %s collateral for TokenRemote %s",
+				spec.TokenHomeAddress.Hex(), settings.CollateralNeeded, deployment.RemoteAddress.Hex())
+		}
+	}
+	if !deployment.Collateralized {
+		deployment.Collateralized = true
+		return d.save(deployment)
+	}
+	return nil
+}
+
+// deployContract deploys a contract with [deploy] and returns the deployment's receipt. The address
+// and transaction hash are saved before the deployment is waited for, so that an interrupted
+// deployment can be resumed rather than repeated.
+func (d *RemoteDeployer) deployContract(
+	ctx context.Context,
+	deployment *RemoteDeployment,
+	name string,
+	address *common.Address,
+	txHash *common.Hash,
+	deploy func(opts *bind.TransactOpts) (common.Address, *types.Transaction, error),
+) (*types.Receipt, error) {
+	receipt, err := d.sendAndSave(ctx, deployment, txHash, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		deployedAddress, tx, err := deploy(opts)
+		if err != nil {
+			return nil, err
+		}
+		*address = deployedAddress
+		return tx, nil
+	})
+	return receipt, errors.Wrapf(err, "failed to deploy %s", name)
+}
+
+// sendAndSave sends the transaction built by [build], saves [deployment] with its hash in [txHash],
+// and waits for it to succeed.
+func (d *RemoteDeployer) sendAndSave(
+	ctx context.Context,
+	deployment *RemoteDeployment,
+	txHash *common.Hash,
+	build func(opts *bind.TransactOpts) (*types.Transaction, error),
+) (*types.Receipt, error) {
+	var tx *types.Transaction
+	return d.Remote.transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		var err error
+		if tx, err = build(opts); err != nil {
+			return nil, err
+		}
+		*txHash = tx.Hash()
+		return tx, d.save(deployment)
+	})
+}
+
+// resumeDeployment returns whether a contract is deployed at [address] by the saved transaction
+// [txHash]. A failed deployment returns false so that it is repeated, and a deployment that has not
+// been accepted yet returns an error.
+func (d *RemoteDeployer) resumeDeployment(
+	ctx context.Context,
+	address common.Address,
+	txHash common.Hash,
+) (bool, error) {
+	code, err := d.Remote.Backend.CodeAt(ctx, address, nil)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get code of %s", address.Hex())
+	}
+	if len(code) > 0 {
+		return true, nil
+	}
+	if txHash == (common.Hash{}) {
+		return false, nil
+	}
+	receipt, err := d.savedReceipt(ctx, txHash)
+	if err != nil {
+		return false, err
+	}
+	return receipt.Status == types.ReceiptStatusSuccessful, nil
+}
+
+// savedReceipt returns the receipt of the saved remote chain transaction [txHash].
+func (d *RemoteDeployer) savedReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	backend, ok := d.Remote.Backend.(bind.DeployBackend)
+	if !ok {
+		return nil, errors.New("remote backend can't look up transaction receipts")
+	}
+	receipt, err := backend.TransactionReceipt(ctx, txHash)
+	if errors.Is(err, interfaces.NotFound) {
+		return nil, errors.Errorf("transaction %s is pending or was dropped; retry once it is accepted, "+
+			"or remove it from the deployment to send it again", txHash.Hex())
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get receipt of transaction %s", txHash.Hex())
+	}
+	return receipt, nil
+}
+
+func (d *RemoteDeployer) save(deployment *RemoteDeployment) error {
+	if d.Save == nil {
+		return nil
+	}
+	return errors.Wrap(d.Save(deployment), "failed to save deployment")
+}
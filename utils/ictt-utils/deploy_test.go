@@ -0,0 +1,195 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	proxyadmin "github.com/ava-labs/icm-contracts/abi-bindings/go/ProxyAdmin"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteDeployer(t *testing.T) {
+	ctx := context.Background()
+	env := receiverTestUtils.NewTokenHomeTestEnv(t, 18)
+	kit := env.Kit
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	feeTokenAddress, tx, _, err := exampleerc20.DeployExampleERC20(opts, kit.Client())
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	home, err := tokenhome.NewTokenHome(env.HomeAddress, kit.Client())
+	require.NoError(t, err)
+
+	// The remotes are deployed to the same chain as the TokenHome, so they are configured with a
+	// placeholder TokenHome blockchain ID, and registered under a placeholder remote blockchain ID.
+	remoteID := ids.ID{8}
+	relayed := 0
+	relay := func(ctx context.Context, receipt *types.Receipt) error {
+		for _, log := range receipt.Logs {
+			event, err := teleporterFilterer.ParseSendCrossChainMessage(*log)
+			if err != nil {
+				continue
+			}
+			result, err := kit.DeliverMessage(ctx, event.Message.DestinationAddress, remoteID,
+				event.Message.OriginSenderAddress, event.Message.Message, event.Message.RequiredGasLimit.Uint64())
+			if err != nil {
+				return err
+			}
+			receiverTestUtils.RequireDelivered(t, result)
+			relayed++
+		}
+		return nil
+	}
+	sender := NewTokenSender(kit.Client(), opts, kit.Commit)
+	newDeployer := func(relay MessageRelayer) (*RemoteDeployer, *RemoteDeployment, *RemoteDeployment) {
+		deployer := NewRemoteDeployer(sender, sender)
+		deployer.Relay = relay
+		deployment := &RemoteDeployment{RemoteBlockchainID: remoteID}
+		// The deployment is saved as JSON, as the CLI saves it to a file.
+		saved := &RemoteDeployment{}
+		deployer.Save = func(deployment *RemoteDeployment) error {
+			data, err := json.Marshal(deployment)
+			if err != nil {
+				return err
+			}
+			return json.Unmarshal(data, saved)
+		}
+		return deployer, deployment, saved
+	}
+	nonce := func() uint64 {
+		nonce, err := kit.Client().NonceAt(ctx, kit.DeployerAddress, nil)
+		require.NoError(t, err)
+		return nonce
+	}
+
+	t.Run("ERC20TokenRemote resumed after a failed relay", func(t *testing.T) {
+		spec := &RemoteSpec{
+			Kind:                        ERC20TokenRemoteKind,
+			TeleporterRegistryAddress:   env.RegistryAddress,
+			TokenHomeBlockchainID:       ids.ID{9},
+			TokenHomeAddress:            env.HomeAddress,
+			TokenName:                   "Token",
+			TokenSymbol:                 "TKN",
+			TokenDecimals:               6,
+			RegistrationFeeTokenAddress: feeTokenAddress,
+			RegistrationFee:             big.NewInt(10),
+		}
+		failing, deployment, saved := newDeployer(func(context.Context, *types.Receipt) error {
+			return errors.New("relayer unavailable")
+		})
+		err := failing.Deploy(ctx, spec, deployment)
+		require.ErrorContains(t, err, "failed to relay registration message: relayer unavailable")
+		require.NotEqual(t, common.Address{}, saved.RemoteAddress)
+		require.NotEqual(t, common.Hash{}, saved.RegistrationTxHash)
+		require.False(t, saved.Registered)
+		require.Equal(t, remoteID, saved.RemoteBlockchainID)
+
+		// Resuming from the saved deployment relays the registration that was sent, rather than
+		// deploying or registering again.
+		deployer, _, resumed := newDeployer(relay)
+		before := nonce()
+		require.NoError(t, deployer.Deploy(ctx, spec, saved))
+		require.Equal(t, before, nonce())
+		require.Equal(t, 1, relayed)
+		require.Equal(t, deployment.RemoteAddress, resumed.RemoteAddress)
+		require.Equal(t, deployment.RegistrationTxHash, resumed.RegistrationTxHash)
+		require.True(t, resumed.Done())
+
+		settings, err := home.GetRemoteTokenTransferrerSettings(nil, remoteID, saved.RemoteAddress)
+		require.NoError(t, err)
+		require.True(t, settings.Registered)
+		require.Equal(t, 0, settings.TokenMultiplier.Cmp(big.NewInt(1e12)))
+		require.False(t, settings.MultiplyOnRemote)
+
+		// Deploying a done deployment again sends nothing.
+		require.NoError(t, deployer.Deploy(ctx, spec, saved))
+		require.Equal(t, before, nonce())
+		require.Equal(t, 1, relayed)
+
+		wrongHome := *spec
+		wrongHome.TokenHomeAddress = feeTokenAddress
+		err = deployer.Deploy(ctx, &wrongHome, saved)
+		require.ErrorContains(t, err, "is configured with TokenHome "+env.HomeAddress.Hex())
+	})
+
+	t.Run("upgradeable NativeTokenRemote with collateral", func(t *testing.T) {
+		spec := &RemoteSpec{
+			Kind:                      NativeTokenRemoteKind,
+			Upgradeable:               true,
+			TeleporterRegistryAddress: env.RegistryAddress,
+			TokenHomeBlockchainID:     ids.ID{9},
+			TokenHomeAddress:          env.HomeAddress,
+			NativeAssetSymbol:         "NTV",
+			InitialReserveImbalance:   big.NewInt(1_000),
+		}
+		deployer, deployment, saved := newDeployer(relay)
+		require.NoError(t, deployer.Deploy(ctx, spec, deployment))
+		require.Equal(t, deployment, saved)
+		require.True(t, deployment.Done())
+		require.NotEqual(t, common.Address{}, deployment.ImplementationAddress)
+		require.NotEqual(t, deployment.ImplementationAddress, deployment.RemoteAddress)
+
+		proxyAdminAddress := deployment.ProxyAdminAddress
+		proxyAdmin, err := proxyadmin.NewProxyAdmin(proxyAdminAddress, kit.Client())
+		require.NoError(t, err)
+		owner, err := proxyAdmin.Owner(nil)
+		require.NoError(t, err)
+		require.Equal(t, kit.DeployerAddress, owner)
+
+		kind, err := DetectTransferrerKind(ctx, kit.Client(), deployment.RemoteAddress)
+		require.NoError(t, err)
+		require.Equal(t, NativeTokenRemoteKind, kind)
+		settings, err := home.GetRemoteTokenTransferrerSettings(nil, remoteID, deployment.RemoteAddress)
+		require.NoError(t, err)
+		require.True(t, settings.Registered)
+		require.Zero(t, settings.CollateralNeeded.Sign())
+
+		// A deployment that lost its ProxyAdmin address recovers it from the proxy deployment.
+		deployment.ProxyAdminAddress = common.Address{}
+		before := nonce()
+		require.NoError(t, deployer.Deploy(ctx, spec, deployment))
+		require.Equal(t, before, nonce())
+		require.Equal(t, proxyAdminAddress, deployment.ProxyAdminAddress)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		deployer, _, _ := newDeployer(relay)
+		spec := &RemoteSpec{
+			Kind:                      ERC20TokenRemoteKind,
+			TeleporterRegistryAddress: env.RegistryAddress,
+			TokenHomeAddress:          env.HomeAddress,
+			TokenName:                 "Token",
+			TokenSymbol:               "TKN",
+		}
+		err := deployer.Deploy(ctx, &RemoteSpec{Kind: ERC20TokenHomeKind}, &RemoteDeployment{})
+		require.ErrorContains(t, err, "ERC20TokenHome can't be deployed as a TokenRemote")
+		noSymbol := *spec
+		noSymbol.Kind = NativeTokenRemoteKind
+		err = deployer.Deploy(ctx, &noSymbol, &RemoteDeployment{})
+		require.ErrorContains(t, err, "native asset symbol is required")
+		noFeeToken := *spec
+		noFeeToken.RegistrationFee = big.NewInt(1)
+		err = deployer.Deploy(ctx, &noFeeToken, &RemoteDeployment{})
+		require.ErrorContains(t, err, "registration fee token address is required")
+
+		pendingTx := common.HexToHash("0x01")
+		err = deployer.Deploy(ctx, spec, &RemoteDeployment{
+			RemoteAddress: common.HexToAddress("0x01"),
+			RemoteTxHash:  pendingTx,
+		})
+		require.ErrorContains(t, err, "transaction "+pendingTx.Hex()+" is pending or was dropped")
+	})
+}
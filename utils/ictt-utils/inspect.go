@@ -0,0 +1,186 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/TokenRemote"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	logUtils "github.com/ava-labs/icm-contracts/utils/log-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// RegisteredRemote is a TokenRemote instance registered with a TokenHome, along with the
+// TokenHome's current accounting for it.
+type RegisteredRemote struct {
+	BlockchainID ids.ID
+	Address      common.Address
+	// RemoteTokenDecimals and InitialCollateralNeeded are taken from the RemoteRegistered event.
+	RemoteTokenDecimals     uint8
+	InitialCollateralNeeded *big.Int
+	// RegistrationBlock is the block in which the remote was registered.
+	RegistrationBlock uint64
+	Settings          tokenhome.RemoteTokenTransferrerSettings
+	// TransferredBalance is denominated in the remote's token scale.
+	TransferredBalance *big.Int
+}
+
+// TokenHomeState is a snapshot of a TokenHome and all of its registered remotes.
+type TokenHomeState struct {
+	Address      common.Address
+	BlockchainID ids.ID
+	TokenAddress common.Address
+	// TokenBalance is the TokenHome's balance of TokenAddress. For a NativeTokenHome, this
+	// is its balance of the wrapped native token.
+	TokenBalance *big.Int
+	Remotes      []*RegisteredRemote
+}
+
+// TokenRemoteState is a snapshot of a TokenRemote's configuration.
+type TokenRemoteState struct {
+	Address                 common.Address
+	BlockchainID            ids.ID
+	TokenHomeBlockchainID   ids.ID
+	TokenHomeAddress        common.Address
+	IsCollateralized        bool
+	InitialReserveImbalance *big.Int
+	TokenMultiplier         *big.Int
+	MultiplyOnRemote        bool
+}
+
+// GetRegisteredRemotes returns the remotes registered with the TokenHome at [homeAddress] by
+// scanning RemoteRegistered events from [fromBlock] to the latest block. See
+// logUtils.ForEachBlockRange for [maxBlockRange].
+func GetRegisteredRemotes(
+	ctx context.Context,
+	backend bind.ContractBackend,
+	homeAddress common.Address,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) ([]*RegisteredRemote, error) {
+	home, err := tokenhome.NewTokenHome(homeAddress, backend)
+	if err != nil {
+		return nil, err
+	}
+	var remotes []*RegisteredRemote
+	err = logUtils.ForEachBlockRange(ctx, backend, fromBlock, maxBlockRange, func(start, end uint64) error {
+		it, err := home.FilterRemoteRegistered(&bind.FilterOpts{Start: start, End: &end, Context: ctx}, nil, nil)
+		if err != nil {
+			return errors.Wrapf(err, "failed to filter RemoteRegistered events in blocks %d-%d", start, end)
+		}
+		defer it.Close()
+		for it.Next() {
+			remotes = append(remotes, &RegisteredRemote{
+				BlockchainID:            it.Event.RemoteBlockchainID,
+				Address:                 it.Event.RemoteTokenTransferrerAddress,
+				RemoteTokenDecimals:     it.Event.TokenDecimals,
+				InitialCollateralNeeded: it.Event.InitialCollateralNeeded,
+				RegistrationBlock:       it.Event.Raw.BlockNumber,
+			})
+		}
+		return errors.Wrap(it.Error(), "failed to iterate RemoteRegistered events")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &bind.CallOpts{Context: ctx}
+	for _, remote := range remotes {
+		remote.Settings, err = home.GetRemoteTokenTransferrerSettings(opts, remote.BlockchainID, remote.Address)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get remote token transferrer settings")
+		}
+		remote.TransferredBalance, err = home.GetTransferredBalance(opts, remote.BlockchainID, remote.Address)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get transferred balance")
+		}
+	}
+	return remotes, nil
+}
+
+// InspectTokenHome returns the state of the TokenHome at [homeAddress], including every remote
+// registered since [fromBlock]. See GetRegisteredRemotes for [maxBlockRange].
+func InspectTokenHome(
+	ctx context.Context,
+	backend bind.ContractBackend,
+	homeAddress common.Address,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) (*TokenHomeState, error) {
+	home, err := tokenhome.NewTokenHome(homeAddress, backend)
+	if err != nil {
+		return nil, err
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	blockchainID, err := home.GetBlockchainID(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TokenHome blockchain ID")
+	}
+	tokenAddress, err := home.GetTokenAddress(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TokenHome token address")
+	}
+	token, err := exampleerc20.NewExampleERC20(tokenAddress, backend)
+	if err != nil {
+		return nil, err
+	}
+	tokenBalance, err := token.BalanceOf(opts, homeAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TokenHome token balance")
+	}
+	remotes, err := GetRegisteredRemotes(ctx, backend, homeAddress, fromBlock, maxBlockRange)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenHomeState{
+		Address:      homeAddress,
+		BlockchainID: blockchainID,
+		TokenAddress: tokenAddress,
+		TokenBalance: tokenBalance,
+		Remotes:      remotes,
+	}, nil
+}
+
+// InspectTokenRemote returns the state of the TokenRemote at [remoteAddress].
+func InspectTokenRemote(
+	ctx context.Context,
+	backend bind.ContractBackend,
+	remoteAddress common.Address,
+) (*TokenRemoteState, error) {
+	remote, err := tokenremote.NewTokenRemote(remoteAddress, backend)
+	if err != nil {
+		return nil, err
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	state := &TokenRemoteState{Address: remoteAddress}
+
+	if state.BlockchainID, err = remote.GetBlockchainID(opts); err != nil {
+		return nil, errors.Wrap(err, "failed to get TokenRemote blockchain ID")
+	}
+	if state.TokenHomeBlockchainID, err = remote.GetTokenHomeBlockchainID(opts); err != nil {
+		return nil, errors.Wrap(err, "failed to get token home blockchain ID")
+	}
+	if state.TokenHomeAddress, err = remote.GetTokenHomeAddress(opts); err != nil {
+		return nil, errors.Wrap(err, "failed to get token home address")
+	}
+	if state.IsCollateralized, err = remote.GetIsCollateralized(opts); err != nil {
+		return nil, errors.Wrap(err, "failed to get collateralization status")
+	}
+	if state.InitialReserveImbalance, err = remote.GetInitialReserveImbalance(opts); err != nil {
+		return nil, errors.Wrap(err, "failed to get initial reserve imbalance")
+	}
+	if state.TokenMultiplier, err = remote.GetTokenMultiplier(opts); err != nil {
+		return nil, errors.Wrap(err, "failed to get token multiplier")
+	}
+	if state.MultiplyOnRemote, err = remote.GetMultiplyOnRemote(opts); err != nil {
+		return nil, errors.Wrap(err, "failed to get multiply on remote")
+	}
+	return state, nil
+}
@@ -0,0 +1,110 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectTokenHome(t *testing.T) {
+	ctx := context.Background()
+	env := receiverTestUtils.NewTokenHomeTestEnv(t, 18)
+
+	collateralizedID, collateralizedAddress := ids.ID{1}, common.HexToAddress("0x01")
+	env.RegisterRemote(t, collateralizedID, collateralizedAddress, 6, big.NewInt(0))
+	env.Send(t, collateralizedID, collateralizedAddress, big.NewInt(5e12))
+
+	imbalancedID, imbalancedAddress := ids.ID{2}, common.HexToAddress("0x02")
+	env.RegisterRemote(t, imbalancedID, imbalancedAddress, 18, big.NewInt(1_000))
+	opts, err := env.Kit.DeployerTransactor()
+	require.NoError(t, err)
+	tx, err := env.Home.AddCollateral(opts, imbalancedID, imbalancedAddress, big.NewInt(400))
+	require.NoError(t, err)
+	_, err = env.Kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	// A block range of one forces a query per block.
+	for _, maxBlockRange := range []uint64{0, 1} {
+		state, err := InspectTokenHome(ctx, env.Kit.Client(), env.HomeAddress, 0, maxBlockRange)
+		require.NoError(t, err)
+		require.Equal(t, env.HomeAddress, state.Address)
+		require.Equal(t, big.NewInt(5e12+400), state.TokenBalance)
+		require.Len(t, state.Remotes, 2)
+
+		collateralized := state.Remotes[0]
+		require.Equal(t, collateralizedID, collateralized.BlockchainID)
+		require.Equal(t, collateralizedAddress, collateralized.Address)
+		require.Equal(t, uint8(6), collateralized.RemoteTokenDecimals)
+		require.True(t, collateralized.Settings.Registered)
+		require.Zero(t, collateralized.Settings.CollateralNeeded.Sign())
+		require.Equal(t, big.NewInt(1e12), collateralized.Settings.TokenMultiplier)
+		require.False(t, collateralized.Settings.MultiplyOnRemote)
+		require.Equal(t, big.NewInt(5), collateralized.TransferredBalance)
+
+		imbalanced := state.Remotes[1]
+		require.Equal(t, imbalancedID, imbalanced.BlockchainID)
+		require.Equal(t, big.NewInt(1_000), imbalanced.InitialCollateralNeeded)
+		require.Equal(t, big.NewInt(600), imbalanced.Settings.CollateralNeeded)
+		require.Zero(t, imbalanced.TransferredBalance.Sign())
+		require.Greater(t, imbalanced.RegistrationBlock, collateralized.RegistrationBlock)
+	}
+
+	// Remotes registered before the start block are not found.
+	latest, err := env.Kit.Client().HeaderByNumber(ctx, nil)
+	require.NoError(t, err)
+	remotes, err := GetRegisteredRemotes(ctx, env.Kit.Client(), env.HomeAddress, latest.Number.Uint64()+1, 0)
+	require.NoError(t, err)
+	require.Empty(t, remotes)
+}
+
+func TestInspectTokenRemote(t *testing.T) {
+	ctx := context.Background()
+	kit, err := receiverTestUtils.NewRegistryReceiverTestKit(ctx, 1)
+	require.NoError(t, err)
+	defer kit.Close()
+
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	homeID, homeAddress := ids.ID{9}, common.HexToAddress("0x1111111111111111111111111111111111111111")
+	remoteAddress, tx, _, err := erc20tokenremote.DeployERC20TokenRemote(
+		opts,
+		kit.Client(),
+		erc20tokenremote.TokenRemoteSettings{
+			TeleporterRegistryAddress: kit.TeleporterRegistryAddress,
+			TeleporterManager:         kit.DeployerAddress,
+			MinTeleporterVersion:      big.NewInt(1),
+			TokenHomeBlockchainID:     homeID,
+			TokenHomeAddress:          homeAddress,
+			TokenHomeDecimals:         6,
+		},
+		"Token",
+		"TKN",
+		18,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	state, err := InspectTokenRemote(ctx, kit.Client(), remoteAddress)
+	require.NoError(t, err)
+	require.Equal(t, remoteAddress, state.Address)
+	require.Equal(t, homeID, state.TokenHomeBlockchainID)
+	require.Equal(t, homeAddress, state.TokenHomeAddress)
+	require.NotEqual(t, ids.Empty, state.BlockchainID)
+	require.True(t, state.IsCollateralized)
+	require.Zero(t, state.InitialReserveImbalance.Sign())
+	require.Equal(t, big.NewInt(1e12), state.TokenMultiplier)
+	require.True(t, state.MultiplyOnRemote)
+
+	_, err = InspectTokenRemote(ctx, kit.Client(), homeAddress)
+	require.Error(t, err)
+}
@@ -0,0 +1,244 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	nativetokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemote"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	tokenScalingUtils "github.com/ava-labs/icm-contracts/utils/token-scaling-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// InvariantKind identifies an accounting invariant between a TokenHome and its remotes.
+type InvariantKind string
+
+const (
+	// HomeUndercollateralized means the TokenHome holds fewer tokens than it needs to back every
+	// remote's transferred balance and the collateral added for it.
+	HomeUndercollateralized InvariantKind = "home-undercollateralized"
+	// UnbackedRemoteSupply means a remote's circulating supply exceeds its initial reserve imbalance
+	// plus the balance the TokenHome has transferred to it.
+	UnbackedRemoteSupply InvariantKind = "unbacked-remote-supply"
+	// InitialCollateralMismatch means the collateral the TokenHome required when registering a remote
+	// does not match the remote's initial reserve imbalance.
+	InitialCollateralMismatch InvariantKind = "initial-collateral-mismatch"
+	// TokenScalingMismatch means the TokenHome and the remote disagree on how amounts are scaled.
+	TokenScalingMismatch InvariantKind = "token-scaling-mismatch"
+	// CollateralizationMismatch means a remote considers itself collateralized while the TokenHome
+	// still needs collateral for it.
+	CollateralizationMismatch InvariantKind = "collateralization-mismatch"
+)
+
+// Alert is a violated invariant. Expected and Actual are in the token scale named by the invariant,
+// and Drift is Actual minus Expected.
+type Alert struct {
+	Kind InvariantKind
+	// RemoteBlockchainID and RemoteAddress are zero for invariants of the TokenHome as a whole.
+	RemoteBlockchainID ids.ID
+	RemoteAddress      common.Address
+	Expected           *big.Int
+	Actual             *big.Int
+	Drift              *big.Int
+}
+
+func newAlert(kind InvariantKind, remote *RegisteredRemote, expected, actual *big.Int) *Alert {
+	alert := &Alert{
+		Kind:     kind,
+		Expected: expected,
+		Actual:   actual,
+		Drift:    new(big.Int).Sub(actual, expected),
+	}
+	if remote != nil {
+		alert.RemoteBlockchainID = remote.BlockchainID
+		alert.RemoteAddress = remote.Address
+	}
+	return alert
+}
+
+func (a *Alert) String() string {
+	if a.RemoteAddress == (common.Address{}) {
+		return fmt.Sprintf("%s: expected %s, actual %s, drift %s", a.Kind, a.Expected, a.Actual, a.Drift)
+	}
+	return fmt.Sprintf(
+		"%s: remote %s on %s: expected %s, actual %s, drift %s",
+		a.Kind, a.RemoteAddress.Hex(), a.RemoteBlockchainID, a.Expected, a.Actual, a.Drift,
+	)
+}
+
+// RemoteSupply is the circulating supply of a registered remote, compared against the TokenHome's
+// record of it. All amounts are denominated in the remote's token scale.
+type RemoteSupply struct {
+	Remote *RegisteredRemote
+	// State is nil if no backend was provided for the remote's chain, in which case only the
+	// TokenHome's side of the remote is checked.
+	State *TokenRemoteState
+	// Native is true for a NativeTokenRemote, whose Supply is its totalNativeAssetSupply and whose
+	// TotalMinted is getTotalMinted. For an ERC20TokenRemote, Supply is its totalSupply.
+	Native      bool
+	Supply      *big.Int
+	TotalMinted *big.Int
+	// MaxSupply is the remote's initial reserve imbalance plus its transferred balance on the TokenHome.
+	MaxSupply *big.Int
+	// PendingDrift is MaxSupply minus Supply when it is positive. It accounts for transfers that are
+	// still in flight between the TokenHome and the remote, and for a NativeTokenRemote, transaction
+	// fees that have been burned but not yet reported to the TokenHome. It is not an alert.
+	PendingDrift *big.Int
+}
+
+// Checked returns whether the remote's supply was read from its chain.
+func (r *RemoteSupply) Checked() bool {
+	return r.State != nil
+}
+
+// InvariantReport is the result of checking a TokenHome and its remotes.
+type InvariantReport struct {
+	Home *TokenHomeState
+	// RequiredBalance is the amount of the TokenHome's token needed to back the transferred balances
+	// of every remote and the collateral added for them.
+	RequiredBalance *big.Int
+	Remotes         []*RemoteSupply
+	Alerts          []*Alert
+}
+
+// CheckInvariants checks the accounting invariants across the TokenHome at [homeAddress] and the
+// remotes registered with it since [fromBlock]:
+//   - the TokenHome's token balance is at least the sum of each remote's transferred balance,
+//     scaled to the home token, plus the collateral added for each remote
+//   - each remote's circulating supply is at most its initial reserve imbalance plus its
+//     transferred balance on the TokenHome
+//   - the collateral the TokenHome required for each remote matches the remote's initial reserve
+//     imbalance, and both sides agree on token scaling and whether the remote is collateralized
+//
+// Remotes are read using the backend in [remoteBackends] for their blockchain ID. Remotes without
+// a backend are reported unchecked. See GetRegisteredRemotes for [maxBlockRange].
+func CheckInvariants(
+	ctx context.Context,
+	homeBackend bind.ContractBackend,
+	homeAddress common.Address,
+	remoteBackends map[ids.ID]bind.ContractBackend,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) (*InvariantReport, error) {
+	home, err := InspectTokenHome(ctx, homeBackend, homeAddress, fromBlock, maxBlockRange)
+	if err != nil {
+		return nil, err
+	}
+	report, err := checkTokenHome(home)
+	if err != nil {
+		return nil, err
+	}
+	for _, supply := range report.Remotes {
+		backend, ok := remoteBackends[supply.Remote.BlockchainID]
+		if !ok {
+			continue
+		}
+		supply.State, err = InspectTokenRemote(ctx, backend, supply.Remote.Address)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to inspect remote %s", supply.Remote.Address.Hex())
+		}
+		if err := getRemoteSupply(ctx, backend, supply); err != nil {
+			return nil, err
+		}
+		alerts, err := checkTokenRemote(supply)
+		if err != nil {
+			return nil, err
+		}
+		report.Alerts = append(report.Alerts, alerts...)
+	}
+	return report, nil
+}
+
+// checkTokenHome checks the invariants that only depend on the TokenHome's state.
+func checkTokenHome(home *TokenHomeState) (*InvariantReport, error) {
+	report := &InvariantReport{Home: home, RequiredBalance: new(big.Int)}
+	for _, remote := range home.Remotes {
+		transferred, err := tokenScalingUtils.RemoveTokenScale(
+			remote.Settings.TokenMultiplier, remote.Settings.MultiplyOnRemote, remote.TransferredBalance,
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to scale transferred balance of remote %s", remote.Address.Hex())
+		}
+		collateralAdded := new(big.Int).Sub(remote.InitialCollateralNeeded, remote.Settings.CollateralNeeded)
+		report.RequiredBalance.Add(report.RequiredBalance, transferred)
+		report.RequiredBalance.Add(report.RequiredBalance, collateralAdded)
+		report.Remotes = append(report.Remotes, &RemoteSupply{Remote: remote})
+	}
+	if home.TokenBalance.Cmp(report.RequiredBalance) < 0 {
+		report.Alerts = append(report.Alerts,
+			newAlert(HomeUndercollateralized, nil, report.RequiredBalance, home.TokenBalance))
+	}
+	return report, nil
+}
+
+// getRemoteSupply reads the circulating supply of the remote, trying the NativeTokenRemote
+// interface first.
+func getRemoteSupply(ctx context.Context, backend bind.ContractBackend, supply *RemoteSupply) error {
+	opts := &bind.CallOpts{Context: ctx}
+	nativeRemote, err := nativetokenremote.NewNativeTokenRemote(supply.Remote.Address, backend)
+	if err != nil {
+		return err
+	}
+	// ERC20TokenRemote does not implement getTotalMinted, so the call reverts. totalNativeAssetSupply
+	// is not used to tell them apart since it also reverts if more fees were burned than minted.
+	if supply.TotalMinted, err = nativeRemote.GetTotalMinted(opts); err == nil {
+		supply.Native = true
+		supply.Supply, err = nativeRemote.TotalNativeAssetSupply(opts)
+		return errors.Wrap(err, "failed to get total native asset supply")
+	}
+
+	token, err := exampleerc20.NewExampleERC20(supply.Remote.Address, backend)
+	if err != nil {
+		return err
+	}
+	supply.Supply, err = token.TotalSupply(opts)
+	return errors.Wrap(err, "failed to get total supply")
+}
+
+// checkTokenRemote checks the invariants between the TokenHome's record of a remote and the
+// remote's own state.
+func checkTokenRemote(supply *RemoteSupply) ([]*Alert, error) {
+	remote, state := supply.Remote, supply.State
+	var alerts []*Alert
+
+	if remote.Settings.TokenMultiplier.Cmp(state.TokenMultiplier) != 0 ||
+		remote.Settings.MultiplyOnRemote != state.MultiplyOnRemote {
+		alerts = append(alerts, newAlert(TokenScalingMismatch, remote,
+			remote.Settings.TokenMultiplier, state.TokenMultiplier))
+	}
+
+	initialCollateralNeeded, err := tokenScalingUtils.CollateralNeeded(
+		state.TokenMultiplier, state.MultiplyOnRemote, state.InitialReserveImbalance,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to compute collateral needed for remote %s", remote.Address.Hex())
+	}
+	if initialCollateralNeeded.Cmp(remote.InitialCollateralNeeded) != 0 {
+		alerts = append(alerts, newAlert(InitialCollateralMismatch, remote,
+			initialCollateralNeeded, remote.InitialCollateralNeeded))
+	}
+
+	// The remote is only marked as collateralized once it receives a message from the TokenHome,
+	// which can not be sent until the TokenHome no longer needs collateral for it. The opposite case
+	// is expected while the first message is in flight.
+	if state.IsCollateralized && remote.Settings.CollateralNeeded.Sign() > 0 {
+		alerts = append(alerts, newAlert(CollateralizationMismatch, remote,
+			common.Big0, remote.Settings.CollateralNeeded))
+	}
+
+	supply.MaxSupply = new(big.Int).Add(state.InitialReserveImbalance, remote.TransferredBalance)
+	supply.PendingDrift = new(big.Int)
+	if supply.Supply.Cmp(supply.MaxSupply) > 0 {
+		alerts = append(alerts, newAlert(UnbackedRemoteSupply, remote, supply.MaxSupply, supply.Supply))
+	} else {
+		supply.PendingDrift.Sub(supply.MaxSupply, supply.Supply)
+	}
+	return alerts, nil
+}
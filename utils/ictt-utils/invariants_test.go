@@ -0,0 +1,251 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	nativeMinter "github.com/ava-labs/icm-contracts/abi-bindings/go/INativeMinter"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	nativetokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemote"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/nativeminter"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckInvariants(t *testing.T) {
+	ctx := context.Background()
+	env := receiverTestUtils.NewTokenHomeTestEnv(t, 18)
+
+	// The remotes are deployed to a second simulated chain. Both chains have the same blockchain ID,
+	// so the remotes are configured with a placeholder ID for their TokenHome, and are registered with
+	// the TokenHome under other placeholder IDs.
+	remoteKit, err := receiverTestUtils.NewRegistryReceiverTestKit(ctx, 1)
+	require.NoError(t, err)
+	defer remoteKit.Close()
+	opts, err := remoteKit.DeployerTransactor()
+	require.NoError(t, err)
+	homeID := ids.ID{9}
+	// The initial reserve imbalance must exceed the fees burned on the remote chain for its
+	// totalNativeAssetSupply not to underflow.
+	nativeImbalance := new(big.Int).Exp(big.NewInt(10), big.NewInt(24), nil)
+	settings := erc20tokenremote.TokenRemoteSettings{
+		TeleporterRegistryAddress: remoteKit.TeleporterRegistryAddress,
+		TeleporterManager:         remoteKit.DeployerAddress,
+		MinTeleporterVersion:      big.NewInt(1),
+		TokenHomeBlockchainID:     homeID,
+		TokenHomeAddress:          env.HomeAddress,
+		TokenHomeDecimals:         18,
+	}
+	erc20RemoteAddress, tx, _, err := erc20tokenremote.DeployERC20TokenRemote(
+		opts, remoteKit.Client(), settings, "Token", "TKN", 18,
+	)
+	require.NoError(t, err)
+	_, err = remoteKit.Commit(ctx, tx)
+	require.NoError(t, err)
+	nativeRemoteAddress, tx, _, err := nativetokenremote.DeployNativeTokenRemote(
+		opts,
+		remoteKit.Client(),
+		nativetokenremote.TokenRemoteSettings(settings),
+		"NTV",
+		nativeImbalance,
+		big.NewInt(1),
+	)
+	require.NoError(t, err)
+	_, err = remoteKit.Commit(ctx, tx)
+	require.NoError(t, err)
+	minter, err := nativeMinter.NewINativeMinter(nativeminter.ContractAddress, remoteKit.Client())
+	require.NoError(t, err)
+	tx, err = minter.SetEnabled(opts, nativeRemoteAddress)
+	require.NoError(t, err)
+	_, err = remoteKit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	erc20ID, nativeID := ids.ID{1}, ids.ID{2}
+	env.RegisterRemote(t, erc20ID, erc20RemoteAddress, 18, big.NewInt(0))
+	env.RegisterRemote(t, nativeID, nativeRemoteAddress, 18, nativeImbalance)
+	homeOpts, err := env.Kit.DeployerTransactor()
+	require.NoError(t, err)
+	tx, err = env.Home.AddCollateral(homeOpts, nativeID, nativeRemoteAddress, nativeImbalance)
+	require.NoError(t, err)
+	_, err = env.Kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	// deliverToRemote mints tokens on a remote as though they were sent by the TokenHome.
+	deliverToRemote := func(remoteAddress common.Address, amount int64) {
+		message, err := itokentransferrer.PackTransferrerMessage(
+			itokentransferrer.SingleHopSend,
+			&itokentransferrer.SingleHopSendMessage{Recipient: remoteKit.DeployerAddress, Amount: big.NewInt(amount)},
+		)
+		require.NoError(t, err)
+		result, err := remoteKit.DeliverMessage(ctx, remoteAddress, homeID, env.HomeAddress, message, 500_000)
+		require.NoError(t, err)
+		receiverTestUtils.RequireDelivered(t, result)
+	}
+	env.Send(t, erc20ID, erc20RemoteAddress, big.NewInt(500))
+	deliverToRemote(erc20RemoteAddress, 500)
+	env.Send(t, nativeID, nativeRemoteAddress, big.NewInt(300))
+	deliverToRemote(nativeRemoteAddress, 300)
+
+	remoteBackends := map[ids.ID]bind.ContractBackend{
+		erc20ID:  remoteKit.Client(),
+		nativeID: remoteKit.Client(),
+	}
+	report, err := CheckInvariants(ctx, env.Kit.Client(), env.HomeAddress, remoteBackends, 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, report.Alerts)
+	requiredBalance := new(big.Int).Add(nativeImbalance, big.NewInt(800))
+	require.Equal(t, requiredBalance, report.RequiredBalance)
+	require.Equal(t, requiredBalance, report.Home.TokenBalance)
+	require.Len(t, report.Remotes, 2)
+
+	erc20Supply := report.Remotes[0]
+	require.True(t, erc20Supply.Checked())
+	require.False(t, erc20Supply.Native)
+	require.Equal(t, big.NewInt(500), erc20Supply.Supply)
+	require.Equal(t, big.NewInt(500), erc20Supply.MaxSupply)
+	require.Zero(t, erc20Supply.PendingDrift.Sign())
+
+	// The native supply is reduced by the transaction fees burned on the remote chain, which have
+	// not been reported to the TokenHome.
+	nativeSupply := report.Remotes[1]
+	require.True(t, nativeSupply.Native)
+	require.Equal(t, big.NewInt(300), nativeSupply.TotalMinted)
+	require.Equal(t, new(big.Int).Add(nativeImbalance, big.NewInt(300)), nativeSupply.MaxSupply)
+	require.Positive(t, nativeSupply.PendingDrift.Sign())
+	require.Equal(t, nativeSupply.MaxSupply, new(big.Int).Add(nativeSupply.Supply, nativeSupply.PendingDrift))
+
+	// A transfer in flight to the remote is pending drift rather than an alert, and a remote without
+	// a backend is not checked.
+	env.Send(t, erc20ID, erc20RemoteAddress, big.NewInt(200))
+	report, err = CheckInvariants(ctx, env.Kit.Client(), env.HomeAddress,
+		map[ids.ID]bind.ContractBackend{erc20ID: remoteKit.Client()}, 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, report.Alerts)
+	require.Equal(t, big.NewInt(200), report.Remotes[0].PendingDrift)
+	require.False(t, report.Remotes[1].Checked())
+
+	// Tokens minted on the remote without being sent from the TokenHome are unbacked.
+	deliverToRemote(erc20RemoteAddress, 1_200)
+	report, err = CheckInvariants(ctx, env.Kit.Client(), env.HomeAddress, remoteBackends, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, report.Alerts, 1)
+	alert := report.Alerts[0]
+	require.Equal(t, UnbackedRemoteSupply, alert.Kind)
+	require.Equal(t, erc20ID, alert.RemoteBlockchainID)
+	require.Equal(t, erc20RemoteAddress, alert.RemoteAddress)
+	require.Equal(t, big.NewInt(700), alert.Expected)
+	require.Equal(t, big.NewInt(1_700), alert.Actual)
+	require.Equal(t, big.NewInt(1_000), alert.Drift)
+	require.Zero(t, report.Remotes[0].PendingDrift.Sign())
+}
+
+func TestCheckInvariantsAlerts(t *testing.T) {
+	newRemote := func() *RegisteredRemote {
+		return &RegisteredRemote{
+			BlockchainID:            ids.ID{1},
+			Address:                 common.HexToAddress("0x01"),
+			InitialCollateralNeeded: big.NewInt(10),
+			Settings: tokenhome.RemoteTokenTransferrerSettings{
+				Registered:       true,
+				CollateralNeeded: big.NewInt(0),
+				TokenMultiplier:  big.NewInt(100),
+				MultiplyOnRemote: true,
+			},
+			TransferredBalance: big.NewInt(5_000),
+		}
+	}
+	newState := func() *TokenRemoteState {
+		return &TokenRemoteState{
+			IsCollateralized: true,
+			// Rounded up to 10 home tokens of collateral.
+			InitialReserveImbalance: big.NewInt(950),
+			TokenMultiplier:         big.NewInt(100),
+			MultiplyOnRemote:        true,
+		}
+	}
+
+	// The TokenHome needs 50 tokens for the transferred balance and 10 for the collateral.
+	home := &TokenHomeState{TokenBalance: big.NewInt(59), Remotes: []*RegisteredRemote{newRemote()}}
+	report, err := checkTokenHome(home)
+	require.NoError(t, err)
+	require.Len(t, report.Alerts, 1)
+	require.Equal(t, HomeUndercollateralized, report.Alerts[0].Kind)
+	require.Equal(t, big.NewInt(60), report.Alerts[0].Expected)
+	require.Equal(t, big.NewInt(-1), report.Alerts[0].Drift)
+	require.Equal(t, "home-undercollateralized: expected 60, actual 59, drift -1", report.Alerts[0].String())
+
+	home.TokenBalance = big.NewInt(60)
+	report, err = checkTokenHome(home)
+	require.NoError(t, err)
+	require.Empty(t, report.Alerts)
+
+	tests := []struct {
+		name     string
+		modify   func(remote *RegisteredRemote, state *TokenRemoteState)
+		kind     InvariantKind
+		expected *big.Int
+		actual   *big.Int
+	}{
+		{
+			name: "healthy",
+		},
+		{
+			name: "initial collateral",
+			modify: func(_ *RegisteredRemote, state *TokenRemoteState) {
+				state.InitialReserveImbalance = big.NewInt(1_050)
+			},
+			kind:     InitialCollateralMismatch,
+			expected: big.NewInt(11),
+			actual:   big.NewInt(10),
+		},
+		{
+			name: "token scaling",
+			modify: func(_ *RegisteredRemote, state *TokenRemoteState) {
+				state.TokenMultiplier = big.NewInt(10)
+				state.InitialReserveImbalance = big.NewInt(95)
+			},
+			kind:     TokenScalingMismatch,
+			expected: big.NewInt(100),
+			actual:   big.NewInt(10),
+		},
+		{
+			name: "collateralization",
+			modify: func(remote *RegisteredRemote, _ *TokenRemoteState) {
+				remote.Settings.CollateralNeeded = big.NewInt(4)
+			},
+			kind:     CollateralizationMismatch,
+			expected: big.NewInt(0),
+			actual:   big.NewInt(4),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote, state := newRemote(), newState()
+			if tt.modify != nil {
+				tt.modify(remote, state)
+			}
+			supply := &RemoteSupply{Remote: remote, State: state, Supply: big.NewInt(5_000)}
+			alerts, err := checkTokenRemote(supply)
+			require.NoError(t, err)
+			require.Equal(t, new(big.Int).Add(state.InitialReserveImbalance, big.NewInt(5_000)), supply.MaxSupply)
+			if tt.kind == "" {
+				require.Empty(t, alerts)
+				require.Equal(t, big.NewInt(950), supply.PendingDrift)
+				return
+			}
+			require.Len(t, alerts, 1)
+			require.Equal(t, tt.kind, alerts[0].Kind)
+			require.Zero(t, tt.expected.Cmp(alerts[0].Expected))
+			require.Zero(t, tt.actual.Cmp(alerts[0].Actual))
+		})
+	}
+}
@@ -0,0 +1,461 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ava-labs/avalanchego/ids"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+)
+
+// RecipientCall is a sendAndCall recipient payload decoded as a call to a method.
+type RecipientCall struct {
+	Method abi.Method
+	Args   []interface{}
+}
+
+// String formats the call as the method name followed by its arguments.
+func (c *RecipientCall) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = formatABIValue(arg)
+		if name := c.Method.Inputs[i].Name; name != "" {
+			args[i] = name + ": " + args[i]
+		}
+	}
+	return fmt.Sprintf("%s(%s)", c.Method.RawName, strings.Join(args, ", "))
+}
+
+// CallMessage is the sendAndCall part of a SingleHopCallMessage or MultiHopCallMessage. Exactly one
+// of SingleHop and MultiHop is set.
+type CallMessage struct {
+	MessageType         itokentransferrer.TransferrerMessageType
+	OriginSenderAddress common.Address
+	RecipientContract   common.Address
+	Amount              *big.Int
+	RecipientPayload    []byte
+	RecipientGasLimit   *big.Int
+	FallbackRecipient   common.Address
+
+	SingleHop *itokentransferrer.SingleHopCallMessage
+	MultiHop  *itokentransferrer.MultiHopCallMessage
+}
+
+// SentCallMessage is a sendAndCall message sent through Teleporter.
+type SentCallMessage struct {
+	*CallMessage
+	TeleporterMessageID     ids.ID
+	DestinationBlockchainID ids.ID
+	DestinationAddress      common.Address
+}
+
+// ParseMethodSignature parses a method signature such as "swap(address,uint256)" into a method whose
+// ID is the signature's selector. Parameters may be named, as in "swap(address to, uint256 amount)",
+// and tuple parameters are written as parenthesized lists of types.
+func ParseMethodSignature(signature string) (abi.Method, error) {
+	signature = strings.TrimSpace(signature)
+	open := strings.Index(signature, "(")
+	if open <= 0 || !strings.HasSuffix(signature, ")") {
+		return abi.Method{}, errors.Errorf("invalid method signature %q", signature)
+	}
+	name := strings.TrimSpace(signature[:open])
+	params, err := splitTopLevel(signature[open+1 : len(signature)-1])
+	if err != nil {
+		return abi.Method{}, errors.Wrapf(err, "invalid method signature %q", signature)
+	}
+	inputs := make(abi.Arguments, len(params))
+	for i, param := range params {
+		marshaling, err := parseParameter(param)
+		if err != nil {
+			return abi.Method{}, errors.Wrapf(err, "invalid method signature %q", signature)
+		}
+		typ, err := abi.NewType(marshaling.Type, "", marshaling.Components)
+		if err == nil {
+			err = validateType(typ)
+		}
+		if err != nil {
+			return abi.Method{}, errors.Wrapf(err, "invalid method signature %q", signature)
+		}
+		inputs[i] = abi.Argument{Name: marshaling.Name, Type: typ}
+	}
+	return abi.NewMethod(name, name, abi.Function, "nonpayable", false, false, inputs, nil), nil
+}
+
+// EncodeRecipientPayload encodes a recipient payload calling the method with [signature] with [args].
+// Each argument is given as a string: addresses, integers (decimal, or hex with a 0x prefix), booleans,
+// strings and hex encoded bytes as is, and arrays and tuples as JSON arrays of arguments.
+func EncodeRecipientPayload(signature string, args []string) ([]byte, error) {
+	method, err := ParseMethodSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != len(method.Inputs) {
+		return nil, errors.Errorf("%s takes %d arguments, got %d", method.Sig, len(method.Inputs), len(args))
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if values[i], err = parseABIValue(method.Inputs[i].Type, arg); err != nil {
+			return nil, errors.Wrapf(err, "invalid argument %d of %s", i, method.Sig)
+		}
+	}
+	packed, err := method.Inputs.Pack(values...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to pack arguments of %s", method.Sig)
+	}
+	return append(method.ID, packed...), nil
+}
+
+// DecodeRecipientPayload decodes [payload] as a call to whichever of [methods] its selector matches.
+func DecodeRecipientPayload(payload []byte, methods ...abi.Method) (*RecipientCall, error) {
+	if len(payload) < 4 {
+		return nil, errors.Errorf("payload of %d bytes has no method selector", len(payload))
+	}
+	for _, method := range methods {
+		if !reflect.DeepEqual(method.ID, payload[:4]) {
+			continue
+		}
+		args, err := method.Inputs.Unpack(payload[4:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode payload as %s", method.Sig)
+		}
+		return &RecipientCall{Method: method, Args: args}, nil
+	}
+	return nil, errors.Errorf("no method with selector %s", hexutil.Encode(payload[:4]))
+}
+
+// ABIMethods returns the methods of [contractABI], for decoding payloads with DecodeRecipientPayload.
+func ABIMethods(contractABI *abi.ABI) []abi.Method {
+	methods := make([]abi.Method, 0, len(contractABI.Methods))
+	for _, method := range contractABI.Methods {
+		methods = append(methods, method)
+	}
+	return methods
+}
+
+// DecodeCallMessage decodes an encoded TransferrerMessage that is a SingleHopCallMessage or a
+// MultiHopCallMessage.
+func DecodeCallMessage(message []byte) (*CallMessage, error) {
+	var transferrerMessage itokentransferrer.TransferrerMessage
+	if err := transferrerMessage.Unpack(message); err != nil {
+		return nil, errors.Wrap(err, "failed to decode transferrer message")
+	}
+	messageType := itokentransferrer.TransferrerMessageType(transferrerMessage.MessageType)
+	switch messageType {
+	case itokentransferrer.SingleHopCall:
+		var payload itokentransferrer.SingleHopCallMessage
+		if err := payload.Unpack(transferrerMessage.Payload); err != nil {
+			return nil, errors.Wrap(err, "failed to decode SingleHopCallMessage")
+		}
+		return &CallMessage{
+			MessageType:         messageType,
+			OriginSenderAddress: payload.OriginSenderAddress,
+			RecipientContract:   payload.RecipientContract,
+			Amount:              payload.Amount,
+			RecipientPayload:    payload.RecipientPayload,
+			RecipientGasLimit:   payload.RecipientGasLimit,
+			FallbackRecipient:   payload.FallbackRecipient,
+			SingleHop:           &payload,
+		}, nil
+	case itokentransferrer.MultiHopCall:
+		var payload itokentransferrer.MultiHopCallMessage
+		if err := payload.Unpack(transferrerMessage.Payload); err != nil {
+			return nil, errors.Wrap(err, "failed to decode MultiHopCallMessage")
+		}
+		return &CallMessage{
+			MessageType:         messageType,
+			OriginSenderAddress: payload.OriginSenderAddress,
+			RecipientContract:   payload.RecipientContract,
+			Amount:              payload.Amount,
+			RecipientPayload:    payload.RecipientPayload,
+			RecipientGasLimit:   payload.RecipientGasLimit,
+			FallbackRecipient:   payload.FallbackRecipient,
+			MultiHop:            &payload,
+		}, nil
+	default:
+		return nil, errors.Errorf("message is not a sendAndCall message: %s", messageType)
+	}
+}
+
+// FindCallMessages returns the sendAndCall messages sent in [receipt], which are sent by a transfer from
+// a token transferrer, or routed by a TokenHome for a multi-hop transfer. Teleporter messages that are
+// not sendAndCall messages are skipped.
+func FindCallMessages(receipt *types.Receipt) []*SentCallMessage {
+	var messages []*SentCallMessage
+	for _, log := range receipt.Logs {
+		event, err := teleporterFilterer.ParseSendCrossChainMessage(*log)
+		if err != nil {
+			continue
+		}
+		message, err := DecodeCallMessage(event.Message.Message)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, &SentCallMessage{
+			CallMessage:             message,
+			TeleporterMessageID:     event.MessageID,
+			DestinationBlockchainID: event.DestinationBlockchainID,
+			DestinationAddress:      event.Message.DestinationAddress,
+		})
+	}
+	return messages
+}
+
+// splitTopLevel splits a comma separated list, ignoring the commas in nested parentheses and brackets.
+func splitTopLevel(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	var (
+		items []string
+		depth int
+		start int
+	)
+	for i, c := range list {
+		switch c {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				items = append(items, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses")
+	}
+	items = append(items, strings.TrimSpace(list[start:]))
+	for _, item := range items {
+		if item == "" {
+			return nil, errors.New("empty parameter")
+		}
+	}
+	return items, nil
+}
+
+// parseParameter parses a parameter type, optionally followed by a name. A tuple type is a
+// parenthesized list of parameters, optionally followed by array suffixes.
+func parseParameter(param string) (abi.ArgumentMarshaling, error) {
+	var marshaling abi.ArgumentMarshaling
+	typ := param
+	if space := strings.LastIndexAny(param, " \t"); space >= 0 && !strings.ContainsAny(param[space:], ")]") {
+		typ, marshaling.Name = strings.TrimSpace(param[:space]), param[space+1:]
+	}
+	if !strings.HasPrefix(typ, "(") {
+		if strings.ContainsAny(typ, " \t(),") {
+			return marshaling, errors.Errorf("invalid parameter %q", param)
+		}
+		marshaling.Type = typ
+		return marshaling, nil
+	}
+
+	close := strings.LastIndex(typ, ")")
+	components, err := splitTopLevel(typ[1:close])
+	if err != nil {
+		return marshaling, err
+	}
+	marshaling.Type = "tuple" + typ[close+1:]
+	for i, component := range components {
+		componentMarshaling, err := parseParameter(component)
+		if err != nil {
+			return marshaling, err
+		}
+		// Tuples are packed from Go structs, so every component needs a field name.
+		if componentMarshaling.Name == "" {
+			componentMarshaling.Name = "field" + strconv.Itoa(i)
+		}
+		marshaling.Components = append(marshaling.Components, componentMarshaling)
+	}
+	return marshaling, nil
+}
+
+// validateType checks the sizes of the integer and fixed bytes types in [typ], which abi.NewType
+// does not.
+func validateType(typ abi.Type) error {
+	switch typ.T {
+	case abi.IntTy, abi.UintTy:
+		if typ.Size < 8 || typ.Size > 256 || typ.Size%8 != 0 {
+			return errors.Errorf("invalid integer type %s", typ)
+		}
+	case abi.FixedBytesTy:
+		if typ.Size < 1 || typ.Size > 32 {
+			return errors.Errorf("invalid fixed bytes type %s", typ)
+		}
+	case abi.SliceTy, abi.ArrayTy:
+		return validateType(*typ.Elem)
+	case abi.TupleTy:
+		for _, elem := range typ.TupleElems {
+			if err := validateType(*elem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseABIValue parses [raw] as a Go value that packs as [typ].
+func parseABIValue(typ abi.Type, raw string) (interface{}, error) {
+	raw = strings.TrimSpace(raw)
+	switch typ.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(raw) {
+			return nil, errors.Errorf("invalid address %q", raw)
+		}
+		return common.HexToAddress(raw), nil
+	case abi.IntTy, abi.UintTy:
+		value, ok := new(big.Int).SetString(raw, 0)
+		if !ok {
+			return nil, errors.Errorf("invalid integer %q", raw)
+		}
+		return convertInteger(typ, value)
+	case abi.BoolTy:
+		return strconv.ParseBool(raw)
+	case abi.StringTy:
+		return raw, nil
+	case abi.BytesTy:
+		return hexutil.Decode(raw)
+	case abi.FixedBytesTy:
+		value, err := hexutil.Decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		if len(value) != typ.Size {
+			return nil, errors.Errorf("%s takes %d bytes, got %d", typ, typ.Size, len(value))
+		}
+		array := reflect.New(typ.GetType()).Elem()
+		reflect.Copy(array, reflect.ValueOf(value))
+		return array.Interface(), nil
+	case abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		var elems []json.RawMessage
+		if err := json.Unmarshal([]byte(raw), &elems); err != nil {
+			return nil, errors.Errorf("%s must be a JSON array, got %q", typ, raw)
+		}
+		return parseCompositeValue(typ, elems)
+	default:
+		return nil, errors.Errorf("unsupported type %s", typ)
+	}
+}
+
+// parseCompositeValue parses the JSON elements of an array, slice or tuple value of [typ].
+func parseCompositeValue(typ abi.Type, elems []json.RawMessage) (interface{}, error) {
+	var value reflect.Value
+	switch typ.T {
+	case abi.SliceTy:
+		value = reflect.MakeSlice(typ.GetType(), len(elems), len(elems))
+	case abi.ArrayTy:
+		if len(elems) != typ.Size {
+			return nil, errors.Errorf("%s takes %d elements, got %d", typ, typ.Size, len(elems))
+		}
+		value = reflect.New(typ.GetType()).Elem()
+	default:
+		if len(elems) != len(typ.TupleElems) {
+			return nil, errors.Errorf("%s takes %d elements, got %d", typ, len(typ.TupleElems), len(elems))
+		}
+		value = reflect.New(typ.GetType()).Elem()
+	}
+	for i, elem := range elems {
+		// String elements are unquoted, and others are parsed from their JSON text.
+		var raw string
+		if err := json.Unmarshal(elem, &raw); err != nil {
+			raw = string(elem)
+		}
+		elemType := typ.Elem
+		if typ.T == abi.TupleTy {
+			elemType = typ.TupleElems[i]
+		}
+		parsed, err := parseABIValue(*elemType, raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid element %d", i)
+		}
+		if typ.T == abi.TupleTy {
+			value.Field(i).Set(reflect.ValueOf(parsed))
+		} else {
+			value.Index(i).Set(reflect.ValueOf(parsed))
+		}
+	}
+	return value.Interface(), nil
+}
+
+// convertInteger checks that [value] fits in [typ], and converts it to the Go type it packs from.
+func convertInteger(typ abi.Type, value *big.Int) (interface{}, error) {
+	if typ.T == abi.UintTy && value.Sign() < 0 {
+		return nil, errors.Errorf("%s can't be negative", typ)
+	}
+	// A signed integer of n bits holds from -2^(n-1) to 2^(n-1)-1, and Not(x) is -x-1.
+	bits := value.BitLen()
+	if typ.T == abi.IntTy {
+		if value.Sign() < 0 {
+			bits = new(big.Int).Not(value).BitLen()
+		}
+		bits++
+	}
+	if bits > typ.Size {
+		return nil, errors.Errorf("%s does not fit in %s", value, typ)
+	}
+	// Integers other than 8, 16, 32 and 64 bits pack from *big.Int.
+	if typ.GetType() == reflect.TypeOf(value) {
+		return value, nil
+	}
+	converted := reflect.New(typ.GetType()).Elem()
+	if typ.T == abi.UintTy {
+		converted.SetUint(value.Uint64())
+	} else {
+		converted.SetInt(value.Int64())
+	}
+	return converted.Interface(), nil
+}
+
+// formatABIValue formats a value unpacked from ABI encoding for display.
+func formatABIValue(value interface{}) string {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex()
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return hexutil.Encode(v)
+	case string:
+		return strconv.Quote(v)
+	}
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Array:
+		if reflected.Type().Elem().Kind() == reflect.Uint8 {
+			bytes := make([]byte, reflected.Len())
+			reflect.Copy(reflect.ValueOf(bytes), reflected)
+			return hexutil.Encode(bytes)
+		}
+		fallthrough
+	case reflect.Slice:
+		elems := make([]string, reflected.Len())
+		for i := range elems {
+			elems[i] = formatABIValue(reflected.Index(i).Interface())
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case reflect.Struct:
+		fields := make([]string, reflected.NumField())
+		for i := range fields {
+			fields[i] = formatABIValue(reflected.Field(i).Interface())
+		}
+		return "(" + strings.Join(fields, ", ") + ")"
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,273 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMethodSignature(t *testing.T) {
+	tests := []struct {
+		signature string
+		sig       string
+		selector  string
+		names     []string
+		err       string
+	}{
+		{
+			signature: "transfer(address,uint256)",
+			sig:       "transfer(address,uint256)",
+			selector:  "0xa9059cbb",
+			names:     []string{"", ""},
+		},
+		{
+			signature: " swap( address to , uint256 amount ) ",
+			sig:       "swap(address,uint256)",
+			names:     []string{"to", "amount"},
+		},
+		{
+			signature: "route((address,uint24)[] hops,bytes)",
+			sig:       "route((address,uint24)[],bytes)",
+			names:     []string{"hops", ""},
+		},
+		{signature: "ping()", sig: "ping()", names: []string{}},
+		{signature: "swap", err: "invalid method signature"},
+		{signature: "(uint256)", err: "invalid method signature"},
+		{signature: "swap(uint256", err: "invalid method signature"},
+		{signature: "swap(uint256,)", err: "empty parameter"},
+		{signature: "swap(uint257)", err: "invalid method signature"},
+		{signature: "swap((uint256)", err: "unbalanced parentheses"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signature, func(t *testing.T) {
+			method, err := ParseMethodSignature(tt.signature)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.sig, method.Sig)
+			if tt.selector != "" {
+				require.Equal(t, tt.selector, hexutil.Encode(method.ID))
+			}
+			names := make([]string, len(method.Inputs))
+			for i, input := range method.Inputs {
+				names[i] = input.Name
+			}
+			require.Equal(t, tt.names, names)
+		})
+	}
+}
+
+func TestEncodeRecipientPayload(t *testing.T) {
+	recipient := common.HexToAddress("0x0123456789abcdef0123456789abcdef01234567")
+
+	tests := []struct {
+		name      string
+		signature string
+		args      []string
+		call      string
+		err       string
+	}{
+		{
+			name:      "address and uint256",
+			signature: "swap(address to,uint256 amount)",
+			args:      []string{recipient.Hex(), "1000000000000000000000"},
+			call:      "swap(to: " + recipient.Hex() + ", amount: 1000000000000000000000)",
+		},
+		{
+			name:      "hex integer and small integers",
+			signature: "set(uint8,int16,int64)",
+			args:      []string{"0xff", "-32768", "-1"},
+			call:      "set(255, -32768, -1)",
+		},
+		{
+			name:      "bool, string and bytes",
+			signature: "note(bool,string,bytes,bytes4)",
+			args:      []string{"true", "hello, world", "0x00ff", "0xdeadbeef"},
+			call:      `note(true, "hello, world", 0x00ff, 0xdeadbeef)`,
+		},
+		{
+			name:      "arrays",
+			signature: "batch(uint256[],address[2])",
+			args:      []string{`[1, "0x2", 3]`, `["` + recipient.Hex() + `", "0x0000000000000000000000000000000000000001"]`},
+			call: "batch([1, 2, 3], [" + recipient.Hex() +
+				", 0x0000000000000000000000000000000000000001])",
+		},
+		{
+			name:      "tuples",
+			signature: "route((address,uint24)[] hops,(bool,bytes))",
+			args:      []string{`[["` + recipient.Hex() + `", 3000]]`, `[false, "0x01"]`},
+			call:      "route(hops: [(" + recipient.Hex() + ", 3000)], (false, 0x01))",
+		},
+		{
+			name:      "wrong number of arguments",
+			signature: "swap(address,uint256)",
+			args:      []string{recipient.Hex()},
+			err:       "swap(address,uint256) takes 2 arguments, got 1",
+		},
+		{
+			name:      "invalid address",
+			signature: "swap(address)",
+			args:      []string{"0x1234"},
+			err:       "invalid address",
+		},
+		{
+			name:      "uint8 overflow",
+			signature: "set(uint8)",
+			args:      []string{"256"},
+			err:       "does not fit in uint8",
+		},
+		{
+			name:      "int8 overflow",
+			signature: "set(int8)",
+			args:      []string{"128"},
+			err:       "does not fit in int8",
+		},
+		{
+			name:      "int8 underflow",
+			signature: "set(int8)",
+			args:      []string{"-129"},
+			err:       "does not fit in int8",
+		},
+		{
+			name:      "negative unsigned",
+			signature: "set(uint256)",
+			args:      []string{"-1"},
+			err:       "can't be negative",
+		},
+		{
+			name:      "fixed bytes length",
+			signature: "set(bytes4)",
+			args:      []string{"0xdead"},
+			err:       "bytes4 takes 4 bytes, got 2",
+		},
+		{
+			name:      "fixed array length",
+			signature: "set(uint256[2])",
+			args:      []string{"[1]"},
+			err:       "takes 2 elements, got 1",
+		},
+		{
+			name:      "array not JSON",
+			signature: "set(uint256[])",
+			args:      []string{"1,2"},
+			err:       "must be a JSON array",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := EncodeRecipientPayload(tt.signature, tt.args)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			method, err := ParseMethodSignature(tt.signature)
+			require.NoError(t, err)
+			require.Equal(t, method.ID, payload[:4])
+			call, err := DecodeRecipientPayload(payload, method)
+			require.NoError(t, err)
+			require.Equal(t, tt.call, call.String())
+		})
+	}
+}
+
+func TestDecodeRecipientPayload(t *testing.T) {
+	transfer, err := ParseMethodSignature("transfer(address,uint256)")
+	require.NoError(t, err)
+	approve, err := ParseMethodSignature("approve(address,uint256)")
+	require.NoError(t, err)
+	payload, err := EncodeRecipientPayload(
+		"approve(address,uint256)", []string{"0x0000000000000000000000000000000000000001", "5"},
+	)
+	require.NoError(t, err)
+
+	call, err := DecodeRecipientPayload(payload, transfer, approve)
+	require.NoError(t, err)
+	require.Equal(t, "approve", call.Method.Name)
+	require.Equal(t, []interface{}{common.HexToAddress("0x01"), big.NewInt(5)}, call.Args)
+
+	_, err = DecodeRecipientPayload(payload, transfer)
+	require.ErrorContains(t, err, "no method with selector 0x095ea7b3")
+	_, err = DecodeRecipientPayload([]byte{0x09, 0x5e}, approve)
+	require.ErrorContains(t, err, "payload of 2 bytes has no method selector")
+	_, err = DecodeRecipientPayload(payload[:20], approve)
+	require.ErrorContains(t, err, "failed to decode payload as approve(address,uint256)")
+
+	erc20ABI, err := abi.JSON(strings.NewReader(`[{"type":"function","name":"approve","inputs":[` +
+		`{"name":"spender","type":"address"},{"name":"value","type":"uint256"}]}]`))
+	require.NoError(t, err)
+	call, err = DecodeRecipientPayload(payload, ABIMethods(&erc20ABI)...)
+	require.NoError(t, err)
+	require.Equal(t, "approve(spender: 0x0000000000000000000000000000000000000001, value: 5)", call.String())
+}
+
+func TestDecodeCallMessage(t *testing.T) {
+	payload := []byte{0xde, 0xad}
+	singleHop := &itokentransferrer.SingleHopCallMessage{
+		SourceBlockchainID:            ids.ID{1},
+		OriginTokenTransferrerAddress: common.HexToAddress("0x01"),
+		OriginSenderAddress:           common.HexToAddress("0x02"),
+		RecipientContract:             common.HexToAddress("0x03"),
+		Amount:                        big.NewInt(100),
+		RecipientPayload:              payload,
+		RecipientGasLimit:             big.NewInt(200_000),
+		FallbackRecipient:             common.HexToAddress("0x04"),
+	}
+	multiHop := &itokentransferrer.MultiHopCallMessage{
+		OriginSenderAddress:                common.HexToAddress("0x02"),
+		DestinationBlockchainID:            ids.ID{2},
+		DestinationTokenTransferrerAddress: common.HexToAddress("0x05"),
+		RecipientContract:                  common.HexToAddress("0x03"),
+		Amount:                             big.NewInt(100),
+		RecipientPayload:                   payload,
+		RecipientGasLimit:                  big.NewInt(200_000),
+		FallbackRecipient:                  common.HexToAddress("0x04"),
+		SecondaryRequiredGasLimit:          big.NewInt(300_000),
+		MultiHopFallback:                   common.HexToAddress("0x06"),
+		SecondaryFee:                       big.NewInt(1),
+	}
+
+	message, err := itokentransferrer.PackTransferrerMessage(itokentransferrer.SingleHopCall, singleHop)
+	require.NoError(t, err)
+	decoded, err := DecodeCallMessage(message)
+	require.NoError(t, err)
+	require.Equal(t, itokentransferrer.SingleHopCall, decoded.MessageType)
+	require.Equal(t, singleHop, decoded.SingleHop)
+	require.Nil(t, decoded.MultiHop)
+	require.Equal(t, payload, decoded.RecipientPayload)
+	require.Equal(t, singleHop.RecipientContract, decoded.RecipientContract)
+	require.Equal(t, singleHop.FallbackRecipient, decoded.FallbackRecipient)
+
+	message, err = itokentransferrer.PackTransferrerMessage(itokentransferrer.MultiHopCall, multiHop)
+	require.NoError(t, err)
+	decoded, err = DecodeCallMessage(message)
+	require.NoError(t, err)
+	require.Equal(t, itokentransferrer.MultiHopCall, decoded.MessageType)
+	require.Equal(t, multiHop, decoded.MultiHop)
+	require.Nil(t, decoded.SingleHop)
+	require.Equal(t, 0, decoded.RecipientGasLimit.Cmp(big.NewInt(200_000)))
+	require.Equal(t, multiHop.OriginSenderAddress, decoded.OriginSenderAddress)
+
+	message, err = itokentransferrer.PackTransferrerMessage(
+		itokentransferrer.SingleHopSend,
+		&itokentransferrer.SingleHopSendMessage{Recipient: common.HexToAddress("0x01"), Amount: big.NewInt(1)},
+	)
+	require.NoError(t, err)
+	_, err = DecodeCallMessage(message)
+	require.ErrorContains(t, err, "message is not a sendAndCall message")
+	_, err = DecodeCallMessage([]byte{0x01})
+	require.ErrorContains(t, err, "failed to decode transferrer message")
+}
@@ -0,0 +1,440 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/TokenRemote"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	feeUtils "github.com/ava-labs/icm-contracts/utils/fee-utils"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	tokenScalingUtils "github.com/ava-labs/icm-contracts/utils/token-scaling-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// RouteRequest describes a transfer from a TokenRemote to be planned by a RoutePlanner.
+type RouteRequest struct {
+	SourceAddress           common.Address
+	DestinationBlockchainID ids.ID
+	// DestinationAddress selects the destination TokenRemote. It is only needed if more than one
+	// remote is registered on the destination chain, and is ignored for transfers to the TokenHome.
+	DestinationAddress common.Address
+	Recipient          common.Address
+	// MultiHopFallback receives the tokens on the TokenHome's chain if a multi-hop transfer can not
+	// be routed to the destination. Defaults to Recipient.
+	MultiHopFallback common.Address
+	// PrimaryFeeTokenAddress is the token on the source chain used to pay the first hop's relayer.
+	// Defaults to the source TokenRemote itself, in which case the fee is paid on top of Amount.
+	PrimaryFeeTokenAddress common.Address
+	// PrimaryFee and SecondaryFee are used instead of the RoutePlanner's estimates if set. SecondaryFee
+	// is denominated in the source TokenRemote's token scale, and ignored for single-hop transfers.
+	PrimaryFee   *big.Int
+	SecondaryFee *big.Int
+	// Amount is denominated in the source TokenRemote's token scale.
+	Amount *big.Int
+}
+
+// Route is a planned transfer from a TokenRemote, either back to its TokenHome (single-hop) or
+// through the TokenHome to another TokenRemote (multi-hop).
+type Route struct {
+	// Input is ready to be passed to the source TokenRemote's send function along with Amount.
+	Input    tokenremote.SendTokensInput
+	Amount   *big.Int
+	MultiHop bool
+
+	HomeBlockchainID ids.ID
+	HomeAddress      common.Address
+	HomeTokenAddress common.Address
+	SourceState      *TokenRemoteState
+	// Source is the TokenHome's record of the source TokenRemote.
+	Source *RegisteredRemote
+	// Destination is the TokenHome's record of the destination TokenRemote. Nil for single-hop transfers.
+	Destination     *RegisteredRemote
+	DestinationKind TransferrerKind
+
+	// FirstHopRequiredGasLimit is the gas limit of the message to the TokenHome. For multi-hop
+	// transfers, this is set by the TokenRemote rather than by the input.
+	FirstHopRequiredGasLimit *big.Int
+	// PrimaryFeeEstimate and SecondaryFeeEstimate are nil if the fee was not estimated.
+	PrimaryFeeEstimate   *feeUtils.FeeEstimate
+	SecondaryFeeEstimate *feeUtils.FeeEstimate
+	// HomeFee is the secondary fee in the TokenHome's token scale, as deducted by the TokenHome.
+	HomeFee *big.Int
+
+	// HomeAmount is Amount in the TokenHome's token scale.
+	HomeAmount *big.Int
+	// DestinationAmount is the amount received by the recipient, in the destination's token scale.
+	DestinationAmount *big.Int
+	// SourceDust is the part of Amount, in the source's token scale, that is burned on the source
+	// chain but lost when scaling to the TokenHome's token.
+	SourceDust *big.Int
+	// DestinationDust is the part of HomeAmount less HomeFee, in the TokenHome's token scale, that
+	// is lost when scaling to the destination's token.
+	DestinationDust *big.Int
+}
+
+// RoutePlanner plans transfers from TokenRemote instances. The TokenHome is taken from the source
+// TokenRemote's settings, and the source and destination are checked against the TokenHome's
+// registered remotes.
+type RoutePlanner struct {
+	SourceBackend bind.ContractBackend
+	HomeBackend   bind.ContractBackend
+	// DestinationBackend is used to detect the kind of the destination TokenRemote for multi-hop
+	// transfers. If nil, the destination is assumed to be a NativeTokenRemote, which requires the
+	// higher gas limit.
+	DestinationBackend bind.ContractBackend
+	// PrimaryFeeEstimator estimates the fee for delivering the message to the TokenHome, and must
+	// read fee history from the TokenHome's chain. Its price oracle is queried with the TokenHome's
+	// blockchain ID and the primary fee token. If nil, the primary fee is zero.
+	PrimaryFeeEstimator *feeUtils.FeeEstimator
+	// SecondaryFeeEstimator estimates the fee for delivering the routed message to the destination,
+	// and must read fee history from the destination chain. Its price oracle is queried with the
+	// destination blockchain ID and the TokenHome's token. If nil, the secondary fee is zero.
+	SecondaryFeeEstimator *feeUtils.FeeEstimator
+	// NumSigners is the expected number of validator signatures on each Warp message.
+	NumSigners int
+	// FromBlock and MaxBlockRange are used to find the TokenHome's registered remotes. See
+	// GetRegisteredRemotes.
+	FromBlock     uint64
+	MaxBlockRange uint64
+}
+
+// NewRoutePlanner creates a RoutePlanner without fee estimation.
+func NewRoutePlanner(sourceBackend, homeBackend bind.ContractBackend, numSigners int) *RoutePlanner {
+	return &RoutePlanner{
+		SourceBackend: sourceBackend,
+		HomeBackend:   homeBackend,
+		NumSigners:    numSigners,
+	}
+}
+
+// Plan builds the SendTokensInput for [request]. The source TokenRemote and, for multi-hop transfers,
+// the destination TokenRemote must be registered and collateralized on the TokenHome, and the amount
+// must reach the recipient after token scaling and the secondary fee. Otherwise the transfer would
+// revert, or be returned to the multi-hop fallback, and Plan returns an error instead.
+func (p *RoutePlanner) Plan(ctx context.Context, request *RouteRequest) (*Route, error) {
+	if request.Recipient == (common.Address{}) {
+		return nil, errors.New("zero recipient address")
+	}
+	if request.Amount == nil || request.Amount.Sign() <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	source, err := InspectTokenRemote(ctx, p.SourceBackend, request.SourceAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to inspect source TokenRemote")
+	}
+	if !source.IsCollateralized {
+		return nil, errors.Errorf("source TokenRemote %s is not collateralized", request.SourceAddress.Hex())
+	}
+
+	home, err := tokenhome.NewTokenHome(source.TokenHomeAddress, p.HomeBackend)
+	if err != nil {
+		return nil, err
+	}
+	homeTokenAddress, err := home.GetTokenAddress(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TokenHome token address")
+	}
+	remotes, err := GetRegisteredRemotes(ctx, p.HomeBackend, source.TokenHomeAddress, p.FromBlock, p.MaxBlockRange)
+	if err != nil {
+		return nil, err
+	}
+	route := &Route{
+		Amount:           request.Amount,
+		MultiHop:         request.DestinationBlockchainID != source.TokenHomeBlockchainID,
+		HomeBlockchainID: source.TokenHomeBlockchainID,
+		HomeAddress:      source.TokenHomeAddress,
+		HomeTokenAddress: homeTokenAddress,
+		SourceState:      source,
+	}
+	route.Source = findRemote(remotes, source.BlockchainID, source.Address)
+	if route.Source == nil {
+		return nil, errors.Errorf("source TokenRemote %s on %s is not registered with TokenHome %s",
+			source.Address.Hex(), source.BlockchainID, source.TokenHomeAddress.Hex())
+	}
+	if route.Source.Settings.CollateralNeeded.Sign() > 0 {
+		return nil, errors.Errorf("TokenHome needs %s collateral for source TokenRemote %s",
+			route.Source.Settings.CollateralNeeded, source.Address.Hex())
+	}
+
+	destinationAddress := source.TokenHomeAddress
+	var destinationBackend bind.ContractBackend
+	if route.MultiHop {
+		route.Destination, err = selectDestination(remotes, request, source)
+		if err != nil {
+			return nil, err
+		}
+		destinationAddress = route.Destination.Address
+		destinationBackend = p.DestinationBackend
+	} else {
+		destinationBackend = p.HomeBackend
+	}
+	route.DestinationKind = NativeTokenRemoteKind
+	if destinationBackend != nil {
+		route.DestinationKind, err = DetectTransferrerKind(ctx, destinationBackend, destinationAddress)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to detect destination token transferrer")
+		}
+	}
+
+	limits := gasUtils.SendTokensGasLimits(route.DestinationKind.TransferrerType(), route.MultiHop)
+	route.FirstHopRequiredGasLimit = limits.RequiredGasLimit
+	if route.MultiHop {
+		route.FirstHopRequiredGasLimit = limits.FirstHopRequiredGasLimit
+	}
+	route.Input = tokenremote.SendTokensInput{
+		DestinationBlockchainID:            request.DestinationBlockchainID,
+		DestinationTokenTransferrerAddress: destinationAddress,
+		Recipient:                          request.Recipient,
+		PrimaryFeeTokenAddress:             request.PrimaryFeeTokenAddress,
+		PrimaryFee:                         new(big.Int),
+		SecondaryFee:                       new(big.Int),
+		RequiredGasLimit:                   limits.RequiredGasLimit,
+	}
+	if route.Input.PrimaryFeeTokenAddress == (common.Address{}) {
+		route.Input.PrimaryFeeTokenAddress = source.Address
+	}
+	route.HomeFee = new(big.Int)
+	if route.MultiHop {
+		route.Input.MultiHopFallback = request.MultiHopFallback
+		if route.Input.MultiHopFallback == (common.Address{}) {
+			route.Input.MultiHopFallback = request.Recipient
+		}
+		if request.SecondaryFee != nil {
+			route.Input.SecondaryFee = request.SecondaryFee
+		} else if err := p.estimateSecondaryFee(ctx, route); err != nil {
+			return nil, err
+		}
+	}
+	if request.PrimaryFee != nil {
+		route.Input.PrimaryFee = request.PrimaryFee
+	} else if err := p.estimatePrimaryFee(ctx, route); err != nil {
+		return nil, err
+	}
+	if err := checkRouteAmounts(route); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// estimateSecondaryFee sets the secondary fee of a multi-hop route to the estimated cost of
+// delivering the TokenHome's message to the destination, paid in the TokenHome's token.
+func (p *RoutePlanner) estimateSecondaryFee(ctx context.Context, route *Route) error {
+	if p.SecondaryFeeEstimator == nil {
+		return nil
+	}
+	message, err := itokentransferrer.PackTransferrerMessage(
+		itokentransferrer.SingleHopSend,
+		&itokentransferrer.SingleHopSendMessage{Recipient: route.Input.Recipient, Amount: route.Amount},
+	)
+	if err != nil {
+		return err
+	}
+	route.SecondaryFeeEstimate, err = p.SecondaryFeeEstimator.EstimateFee(
+		ctx,
+		route.Input.DestinationBlockchainID,
+		route.HomeTokenAddress,
+		feeUtils.DeliveryParams{
+			NumSigners:       p.NumSigners,
+			RequiredGasLimit: route.Input.RequiredGasLimit,
+			MessageSize:      len(message),
+			NumReceipts:      feeUtils.MaxReceiptsPerMessage,
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to estimate secondary fee")
+	}
+	route.Input.SecondaryFee, err = scaleFeeToRemote(route.Source.Settings, route.SecondaryFeeEstimate.FeeAmount)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// estimatePrimaryFee sets the primary fee to the estimated cost of delivering the source's
+// message to the TokenHome.
+func (p *RoutePlanner) estimatePrimaryFee(ctx context.Context, route *Route) error {
+	if p.PrimaryFeeEstimator == nil {
+		return nil
+	}
+	var (
+		message []byte
+		err     error
+	)
+	if route.MultiHop {
+		message, err = itokentransferrer.PackTransferrerMessage(
+			itokentransferrer.MultiHopSend,
+			&itokentransferrer.MultiHopSendMessage{
+				DestinationBlockchainID:            route.Input.DestinationBlockchainID,
+				DestinationTokenTransferrerAddress: route.Input.DestinationTokenTransferrerAddress,
+				Recipient:                          route.Input.Recipient,
+				Amount:                             route.Amount,
+				SecondaryFee:                       route.Input.SecondaryFee,
+				SecondaryGasLimit:                  route.Input.RequiredGasLimit,
+				MultiHopFallback:                   route.Input.MultiHopFallback,
+			},
+		)
+	} else {
+		message, err = itokentransferrer.PackTransferrerMessage(
+			itokentransferrer.SingleHopSend,
+			&itokentransferrer.SingleHopSendMessage{Recipient: route.Input.Recipient, Amount: route.Amount},
+		)
+	}
+	if err != nil {
+		return err
+	}
+	route.PrimaryFeeEstimate, err = p.PrimaryFeeEstimator.EstimateFee(
+		ctx,
+		route.HomeBlockchainID,
+		route.Input.PrimaryFeeTokenAddress,
+		feeUtils.DeliveryParams{
+			NumSigners:       p.NumSigners,
+			RequiredGasLimit: route.FirstHopRequiredGasLimit,
+			MessageSize:      len(message),
+			NumReceipts:      feeUtils.MaxReceiptsPerMessage,
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to estimate primary fee")
+	}
+	route.Input.PrimaryFee = route.PrimaryFeeEstimate.FeeAmount
+	return nil
+}
+
+// scaleFeeToRemote returns the smallest amount in the remote's token scale that the TokenHome
+// scales to at least [homeFee].
+func scaleFeeToRemote(settings tokenhome.RemoteTokenTransferrerSettings, homeFee *big.Int) (*big.Int, error) {
+	fee, err := tokenScalingUtils.ApplyTokenScale(settings.TokenMultiplier, settings.MultiplyOnRemote, homeFee)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scale secondary fee")
+	}
+	scaled, err := tokenScalingUtils.RemoveTokenScale(settings.TokenMultiplier, settings.MultiplyOnRemote, fee)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scale secondary fee")
+	}
+	if scaled.Cmp(homeFee) < 0 {
+		fee.Add(fee, common.Big1)
+	}
+	return fee, nil
+}
+
+// checkRouteAmounts computes the amounts of [route] at each hop, and checks them against the
+// TokenHome's requirements.
+func checkRouteAmounts(route *Route) error {
+	source := route.Source.Settings
+	if route.Source.TransferredBalance.Cmp(route.Amount) < 0 {
+		return errors.Errorf("amount %s exceeds the source TokenRemote's transferred balance of %s",
+			route.Amount, route.Source.TransferredBalance)
+	}
+	var err error
+	route.HomeAmount, err = tokenScalingUtils.RemoveTokenScale(
+		source.TokenMultiplier, source.MultiplyOnRemote, route.Amount,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to scale amount to the TokenHome")
+	}
+	if route.HomeAmount.Sign() == 0 {
+		return errors.Errorf("amount %s is zero in the TokenHome's token scale", route.Amount)
+	}
+	sourceAmount, err := tokenScalingUtils.ApplyTokenScale(
+		source.TokenMultiplier, source.MultiplyOnRemote, route.HomeAmount,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to scale amount to the source")
+	}
+	route.SourceDust = new(big.Int).Sub(route.Amount, sourceAmount)
+
+	if !route.MultiHop {
+		route.DestinationAmount = new(big.Int).Set(route.HomeAmount)
+		route.DestinationDust = new(big.Int)
+		return nil
+	}
+
+	route.HomeFee, err = tokenScalingUtils.RemoveTokenScale(
+		source.TokenMultiplier, source.MultiplyOnRemote, route.Input.SecondaryFee,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to scale secondary fee to the TokenHome")
+	}
+	if route.HomeAmount.Cmp(route.HomeFee) <= 0 {
+		return errors.Errorf("amount %s does not cover the secondary fee of %s in the TokenHome's token scale",
+			route.HomeAmount, route.HomeFee)
+	}
+	homeAmount := new(big.Int).Sub(route.HomeAmount, route.HomeFee)
+	destination := route.Destination.Settings
+	route.DestinationAmount, err = tokenScalingUtils.ApplyTokenScale(
+		destination.TokenMultiplier, destination.MultiplyOnRemote, homeAmount,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to scale amount to the destination")
+	}
+	// The TokenHome sends a zero scaled amount to the multi-hop fallback instead.
+	if route.DestinationAmount.Sign() == 0 {
+		return errors.Errorf("amount %s is zero in the destination's token scale after the secondary fee",
+			route.Amount)
+	}
+	routedAmount, err := tokenScalingUtils.RemoveTokenScale(
+		destination.TokenMultiplier, destination.MultiplyOnRemote, route.DestinationAmount,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to scale amount from the destination")
+	}
+	route.DestinationDust = new(big.Int).Sub(homeAmount, routedAmount)
+	return nil
+}
+
+// selectDestination returns the destination TokenRemote of a multi-hop transfer from the remotes
+// registered with the TokenHome.
+func selectDestination(
+	remotes []*RegisteredRemote,
+	request *RouteRequest,
+	source *TokenRemoteState,
+) (*RegisteredRemote, error) {
+	var candidates []*RegisteredRemote
+	for _, remote := range remotes {
+		if remote.BlockchainID != request.DestinationBlockchainID {
+			continue
+		}
+		if remote.BlockchainID == source.BlockchainID && remote.Address == source.Address {
+			continue
+		}
+		if request.DestinationAddress != (common.Address{}) && remote.Address != request.DestinationAddress {
+			continue
+		}
+		candidates = append(candidates, remote)
+	}
+	switch {
+	case len(candidates) == 0 && request.DestinationAddress != (common.Address{}):
+		return nil, errors.Errorf("destination TokenRemote %s on %s is not registered with TokenHome %s",
+			request.DestinationAddress.Hex(), request.DestinationBlockchainID, source.TokenHomeAddress.Hex())
+	case len(candidates) == 0:
+		return nil, errors.Errorf("no TokenRemote on %s is registered with TokenHome %s",
+			request.DestinationBlockchainID, source.TokenHomeAddress.Hex())
+	case len(candidates) > 1:
+		return nil, errors.Errorf("%d TokenRemote instances on %s are registered with TokenHome %s, "+
+			"a destination address is required", len(candidates), request.DestinationBlockchainID,
+			source.TokenHomeAddress.Hex())
+	}
+	destination := candidates[0]
+	if destination.Settings.CollateralNeeded.Sign() > 0 {
+		return nil, errors.Errorf("TokenHome needs %s collateral for destination TokenRemote %s",
+			destination.Settings.CollateralNeeded, destination.Address.Hex())
+	}
+	return destination, nil
+}
+
+func findRemote(remotes []*RegisteredRemote, blockchainID ids.ID, address common.Address) *RegisteredRemote {
+	for _, remote := range remotes {
+		if remote.BlockchainID == blockchainID && remote.Address == address {
+			return remote
+		}
+	}
+	return nil
+}
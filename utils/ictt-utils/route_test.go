@@ -0,0 +1,380 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	erc20tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/ERC20TokenHome"
+	nativetokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/NativeTokenHome"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	nativetokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemote"
+	tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/TokenRemote"
+	wrappednativetoken "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/WrappedNativeToken"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// transferrerTestEnv has one of each token transferrer deployed to a simulated chain. The remotes
+// are configured with a placeholder blockchain ID for [homeAddress], since every simulated chain
+// has the same blockchain ID.
+type transferrerTestEnv struct {
+	kit                 *receiverTestUtils.ReceiverTestKit
+	erc20HomeAddress    common.Address
+	nativeHomeAddress   common.Address
+	erc20RemoteAddress  common.Address
+	nativeRemoteAddress common.Address
+}
+
+func newTransferrerTestEnv(t *testing.T, homeID ids.ID, homeAddress common.Address) *transferrerTestEnv {
+	ctx := context.Background()
+	kit, err := receiverTestUtils.NewRegistryReceiverTestKit(ctx, 1)
+	require.NoError(t, err)
+	t.Cleanup(func() { kit.Close() })
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	env := &transferrerTestEnv{kit: kit}
+
+	tokenAddress, tx, _, err := exampleerc20.DeployExampleERC20(opts, kit.Client())
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	env.erc20HomeAddress, tx, _, err = erc20tokenhome.DeployERC20TokenHome(
+		opts, kit.Client(), kit.TeleporterRegistryAddress, kit.DeployerAddress, big.NewInt(1), tokenAddress, 18,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	wrappedAddress, tx, _, err := wrappednativetoken.DeployWrappedNativeToken(opts, kit.Client(), "WNTV")
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	env.nativeHomeAddress, tx, _, err = nativetokenhome.DeployNativeTokenHome(
+		opts, kit.Client(), kit.TeleporterRegistryAddress, kit.DeployerAddress, big.NewInt(1), wrappedAddress,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	settings := erc20tokenremote.TokenRemoteSettings{
+		TeleporterRegistryAddress: kit.TeleporterRegistryAddress,
+		TeleporterManager:         kit.DeployerAddress,
+		MinTeleporterVersion:      big.NewInt(1),
+		TokenHomeBlockchainID:     homeID,
+		TokenHomeAddress:          homeAddress,
+		TokenHomeDecimals:         18,
+	}
+	env.erc20RemoteAddress, tx, _, err = erc20tokenremote.DeployERC20TokenRemote(
+		opts, kit.Client(), settings, "Token", "TKN", 18,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	// A NativeTokenRemote with an initial reserve imbalance is not collateralized until it
+	// receives a message from its TokenHome.
+	env.nativeRemoteAddress, tx, _, err = nativetokenremote.DeployNativeTokenRemote(
+		opts, kit.Client(), nativetokenremote.TokenRemoteSettings(settings), "NTV", big.NewInt(1_000), big.NewInt(1),
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	return env
+}
+
+func TestDetectTransferrerKind(t *testing.T) {
+	ctx := context.Background()
+	env := newTransferrerTestEnv(t, ids.ID{9}, common.HexToAddress("0x09"))
+
+	tests := []struct {
+		address common.Address
+		kind    TransferrerKind
+		isHome  bool
+		typ     gasUtils.TransferrerType
+	}{
+		{env.erc20HomeAddress, ERC20TokenHomeKind, true, gasUtils.ERC20Transferrer},
+		{env.nativeHomeAddress, NativeTokenHomeKind, true, gasUtils.NativeTransferrer},
+		{env.erc20RemoteAddress, ERC20TokenRemoteKind, false, gasUtils.ERC20Transferrer},
+		{env.nativeRemoteAddress, NativeTokenRemoteKind, false, gasUtils.NativeTransferrer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind.String(), func(t *testing.T) {
+			kind, err := DetectTransferrerKind(ctx, env.kit.Client(), tt.address)
+			require.NoError(t, err)
+			require.Equal(t, tt.kind, kind)
+			require.Equal(t, tt.isHome, kind.IsHome())
+			require.Equal(t, tt.typ, kind.TransferrerType())
+		})
+	}
+
+	_, err := DetectTransferrerKind(ctx, env.kit.Client(), env.kit.DeployerAddress)
+	require.ErrorContains(t, err, "no token transferrer found")
+	_, err = DetectTransferrerKind(ctx, env.kit.Client(), env.kit.TeleporterRegistryAddress)
+	require.ErrorContains(t, err, "no token transferrer found")
+}
+
+func TestPlanRouteErrors(t *testing.T) {
+	ctx := context.Background()
+	home := receiverTestUtils.NewTokenHomeTestEnv(t, 18)
+	env := newTransferrerTestEnv(t, ids.ID{9}, home.HomeAddress)
+	// The TokenHome can not register a remote under the simulated chain's own blockchain ID, so
+	// the source is never registered here. Planning successful routes is covered by the tests below.
+	home.RegisterRemote(t, ids.ID{1}, env.erc20RemoteAddress, 18, big.NewInt(0))
+
+	planner := NewRoutePlanner(env.kit.Client(), home.Kit.Client(), 10)
+	recipient := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	tests := []struct {
+		name    string
+		request *RouteRequest
+		err     string
+	}{
+		{
+			name:    "zero recipient",
+			request: &RouteRequest{SourceAddress: env.erc20RemoteAddress, Amount: big.NewInt(1)},
+			err:     "zero recipient address",
+		},
+		{
+			name:    "zero amount",
+			request: &RouteRequest{SourceAddress: env.erc20RemoteAddress, Recipient: recipient, Amount: big.NewInt(0)},
+			err:     "amount must be positive",
+		},
+		{
+			name:    "not a TokenRemote",
+			request: &RouteRequest{SourceAddress: env.erc20HomeAddress, Recipient: recipient, Amount: big.NewInt(1)},
+			err:     "failed to inspect source TokenRemote",
+		},
+		{
+			name: "source not collateralized",
+			request: &RouteRequest{
+				SourceAddress: env.nativeRemoteAddress, Recipient: recipient, Amount: big.NewInt(1),
+			},
+			err: "is not collateralized",
+		},
+		{
+			name: "source not registered",
+			request: &RouteRequest{
+				SourceAddress: env.erc20RemoteAddress, Recipient: recipient, Amount: big.NewInt(1),
+			},
+			err: "is not registered with TokenHome",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := planner.Plan(ctx, tt.request)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestSelectDestination(t *testing.T) {
+	source := &TokenRemoteState{
+		Address:          common.HexToAddress("0x01"),
+		BlockchainID:     ids.ID{1},
+		TokenHomeAddress: common.HexToAddress("0x09"),
+	}
+	newRemote := func(blockchainID ids.ID, address common.Address, collateralNeeded int64) *RegisteredRemote {
+		return &RegisteredRemote{
+			BlockchainID: blockchainID,
+			Address:      address,
+			Settings: tokenhome.RemoteTokenTransferrerSettings{
+				Registered:       true,
+				CollateralNeeded: big.NewInt(collateralNeeded),
+			},
+		}
+	}
+	remotes := []*RegisteredRemote{
+		newRemote(ids.ID{1}, source.Address, 0),
+		newRemote(ids.ID{1}, common.HexToAddress("0x02"), 0),
+		newRemote(ids.ID{2}, common.HexToAddress("0x03"), 0),
+		newRemote(ids.ID{2}, common.HexToAddress("0x04"), 0),
+		newRemote(ids.ID{3}, common.HexToAddress("0x05"), 10),
+	}
+
+	tests := []struct {
+		name               string
+		blockchainID       ids.ID
+		destinationAddress common.Address
+		expected           common.Address
+		err                string
+	}{
+		{
+			// The source is excluded from the remotes on its own chain.
+			name:         "same chain",
+			blockchainID: ids.ID{1},
+			expected:     common.HexToAddress("0x02"),
+		},
+		{
+			name:               "explicit address",
+			blockchainID:       ids.ID{2},
+			destinationAddress: common.HexToAddress("0x04"),
+			expected:           common.HexToAddress("0x04"),
+		},
+		{
+			name:         "ambiguous",
+			blockchainID: ids.ID{2},
+			err:          "2 TokenRemote instances on",
+		},
+		{
+			name:               "unregistered address",
+			blockchainID:       ids.ID{2},
+			destinationAddress: common.HexToAddress("0x05"),
+			err:                "destination TokenRemote 0x0000000000000000000000000000000000000005 on",
+		},
+		{
+			name:         "unregistered chain",
+			blockchainID: ids.ID{4},
+			err:          "no TokenRemote on",
+		},
+		{
+			name:               "to itself",
+			blockchainID:       ids.ID{1},
+			destinationAddress: source.Address,
+			err:                "is not registered with TokenHome",
+		},
+		{
+			name:         "collateral needed",
+			blockchainID: ids.ID{3},
+			err:          "TokenHome needs 10 collateral for destination TokenRemote",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &RouteRequest{
+				DestinationBlockchainID: tt.blockchainID,
+				DestinationAddress:      tt.destinationAddress,
+			}
+			destination, err := selectDestination(remotes, request, source)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, destination.Address)
+		})
+	}
+}
+
+func TestCheckRouteAmounts(t *testing.T) {
+	settings := func(tokenMultiplier int64, multiplyOnRemote bool) tokenhome.RemoteTokenTransferrerSettings {
+		return tokenhome.RemoteTokenTransferrerSettings{
+			Registered:       true,
+			CollateralNeeded: big.NewInt(0),
+			TokenMultiplier:  big.NewInt(tokenMultiplier),
+			MultiplyOnRemote: multiplyOnRemote,
+		}
+	}
+	// The source token has two more decimals than the home token, and the destination token one less.
+	newRoute := func(multiHop bool, amount, secondaryFee int64) *Route {
+		route := &Route{
+			Amount:   big.NewInt(amount),
+			MultiHop: multiHop,
+			Input:    tokenremote.SendTokensInput{SecondaryFee: big.NewInt(secondaryFee)},
+			Source: &RegisteredRemote{
+				Settings:           settings(100, true),
+				TransferredBalance: big.NewInt(1_000_000),
+			},
+			HomeFee: new(big.Int),
+		}
+		if multiHop {
+			route.Destination = &RegisteredRemote{Settings: settings(10, false)}
+		}
+		return route
+	}
+
+	tests := []struct {
+		name              string
+		route             *Route
+		homeAmount        int64
+		homeFee           int64
+		destinationAmount int64
+		sourceDust        int64
+		destinationDust   int64
+		err               string
+	}{
+		{
+			name:              "single-hop",
+			route:             newRoute(false, 5_007, 0),
+			homeAmount:        50,
+			destinationAmount: 50,
+			sourceDust:        7,
+		},
+		{
+			name:  "exceeds transferred balance",
+			route: newRoute(false, 1_000_001, 0),
+			err:   "exceeds the source TokenRemote's transferred balance of 1000000",
+		},
+		{
+			name:  "zero home amount",
+			route: newRoute(false, 99, 0),
+			err:   "amount 99 is zero in the TokenHome's token scale",
+		},
+		{
+			name:              "multi-hop",
+			route:             newRoute(true, 10_550, 1_000),
+			homeAmount:        105,
+			homeFee:           10,
+			destinationAmount: 9,
+			sourceDust:        50,
+			destinationDust:   5,
+		},
+		{
+			name:  "secondary fee not covered",
+			route: newRoute(true, 10_550, 10_500),
+			err:   "does not cover the secondary fee of 105",
+		},
+		{
+			name:  "zero destination amount",
+			route: newRoute(true, 1_500, 1_000),
+			err:   "is zero in the destination's token scale",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRouteAmounts(tt.route)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, big.NewInt(tt.homeAmount), tt.route.HomeAmount)
+			require.Equal(t, big.NewInt(tt.homeFee), tt.route.HomeFee)
+			require.Equal(t, big.NewInt(tt.destinationAmount), tt.route.DestinationAmount)
+			require.Equal(t, big.NewInt(tt.sourceDust), tt.route.SourceDust)
+			require.Equal(t, big.NewInt(tt.destinationDust), tt.route.DestinationDust)
+		})
+	}
+}
+
+func TestScaleFeeToRemote(t *testing.T) {
+	tests := []struct {
+		name             string
+		tokenMultiplier  int64
+		multiplyOnRemote bool
+		homeFee          int64
+		expected         int64
+	}{
+		{"more remote decimals", 100, true, 25, 2_500},
+		{"fewer remote decimals, rounded up", 10, false, 25, 3},
+		{"fewer remote decimals, exact", 10, false, 30, 3},
+		{"zero fee", 10, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := tokenhome.RemoteTokenTransferrerSettings{
+				TokenMultiplier:  big.NewInt(tt.tokenMultiplier),
+				MultiplyOnRemote: tt.multiplyOnRemote,
+			}
+			fee, err := scaleFeeToRemote(settings, big.NewInt(tt.homeFee))
+			require.NoError(t, err)
+			require.Equal(t, big.NewInt(tt.expected), fee)
+		})
+	}
+}
@@ -0,0 +1,262 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	erc20tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/ERC20TokenHome"
+	nativetokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/NativeTokenHome"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	nativetokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemote"
+	tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/TokenRemote"
+	wrappednativetoken "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/WrappedNativeToken"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// TxWaiter waits for [tx] to be accepted and returns its receipt.
+type TxWaiter func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error)
+
+// TokenSender sends tokens from any of the four token transferrer contracts. The SendTokensInput
+// and SendAndCallInput types of each contract's bindings are identical, so inputs are given as the
+// TokenRemote bindings' types and converted.
+type TokenSender struct {
+	Backend bind.ContractBackend
+	Opts    *bind.TransactOpts
+	Wait    TxWaiter
+}
+
+// SendResult is a transfer sent by a TokenSender.
+type SendResult struct {
+	Kind                TransferrerKind
+	Receipt             *types.Receipt
+	TeleporterMessageID ids.ID
+	// Amount is the amount of the TokensSent or TokensAndCallSent event. For a TokenHome, it is in
+	// the destination's token scale.
+	Amount *big.Int
+}
+
+// NewTokenSender creates a TokenSender that signs transactions with [opts] and waits for them with [wait].
+func NewTokenSender(backend bind.ContractBackend, opts *bind.TransactOpts, wait TxWaiter) *TokenSender {
+	return &TokenSender{
+		Backend: backend,
+		Opts:    opts,
+		Wait:    wait,
+	}
+}
+
+// Send sends [amount] tokens from the token transferrer at [transferrerAddress] with [input].
+func (s *TokenSender) Send(
+	ctx context.Context,
+	transferrerAddress common.Address,
+	input tokenremote.SendTokensInput,
+	amount *big.Int,
+) (*SendResult, error) {
+	return s.send(ctx, transferrerAddress, amount, input.PrimaryFeeTokenAddress, input.PrimaryFee,
+		func(opts *bind.TransactOpts, kind TransferrerKind) (*types.Transaction, error) {
+			switch kind {
+			case ERC20TokenHomeKind:
+				home, err := erc20tokenhome.NewERC20TokenHome(transferrerAddress, s.Backend)
+				if err != nil {
+					return nil, err
+				}
+				return home.Send(opts, erc20tokenhome.SendTokensInput(input), amount)
+			case NativeTokenHomeKind:
+				home, err := nativetokenhome.NewNativeTokenHome(transferrerAddress, s.Backend)
+				if err != nil {
+					return nil, err
+				}
+				return home.Send(opts, nativetokenhome.SendTokensInput(input))
+			case ERC20TokenRemoteKind:
+				remote, err := erc20tokenremote.NewERC20TokenRemote(transferrerAddress, s.Backend)
+				if err != nil {
+					return nil, err
+				}
+				return remote.Send(opts, erc20tokenremote.SendTokensInput(input), amount)
+			default:
+				remote, err := nativetokenremote.NewNativeTokenRemote(transferrerAddress, s.Backend)
+				if err != nil {
+					return nil, err
+				}
+				return remote.Send(opts, nativetokenremote.SendTokensInput(input))
+			}
+		})
+}
+
+// SendAndCall sends [amount] tokens from the token transferrer at [transferrerAddress] to the
+// recipient contract of [input], and calls it with the recipient payload.
+func (s *TokenSender) SendAndCall(
+	ctx context.Context,
+	transferrerAddress common.Address,
+	input tokenremote.SendAndCallInput,
+	amount *big.Int,
+) (*SendResult, error) {
+	return s.send(ctx, transferrerAddress, amount, input.PrimaryFeeTokenAddress, input.PrimaryFee,
+		func(opts *bind.TransactOpts, kind TransferrerKind) (*types.Transaction, error) {
+			switch kind {
+			case ERC20TokenHomeKind:
+				home, err := erc20tokenhome.NewERC20TokenHome(transferrerAddress, s.Backend)
+				if err != nil {
+					return nil, err
+				}
+				return home.SendAndCall(opts, erc20tokenhome.SendAndCallInput(input), amount)
+			case NativeTokenHomeKind:
+				home, err := nativetokenhome.NewNativeTokenHome(transferrerAddress, s.Backend)
+				if err != nil {
+					return nil, err
+				}
+				return home.SendAndCall(opts, nativetokenhome.SendAndCallInput(input))
+			case ERC20TokenRemoteKind:
+				remote, err := erc20tokenremote.NewERC20TokenRemote(transferrerAddress, s.Backend)
+				if err != nil {
+					return nil, err
+				}
+				return remote.SendAndCall(opts, erc20tokenremote.SendAndCallInput(input), amount)
+			default:
+				remote, err := nativetokenremote.NewNativeTokenRemote(transferrerAddress, s.Backend)
+				if err != nil {
+					return nil, err
+				}
+				return remote.SendAndCall(opts, nativetokenremote.SendAndCallInput(input))
+			}
+		})
+}
+
+// send detects the kind of the token transferrer, provides it with the amount and primary fee,
+// and sends the transaction built by [call].
+func (s *TokenSender) send(
+	ctx context.Context,
+	transferrerAddress common.Address,
+	amount *big.Int,
+	feeTokenAddress common.Address,
+	fee *big.Int,
+	call func(opts *bind.TransactOpts, kind TransferrerKind) (*types.Transaction, error),
+) (*SendResult, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	if fee == nil {
+		fee = new(big.Int)
+	}
+	kind, err := DetectTransferrerKind(ctx, s.Backend, transferrerAddress)
+	if err != nil {
+		return nil, err
+	}
+	// A TokenRemote is the token it transfers. For a NativeTokenRemote, that is the wrapped native token.
+	tokenAddress := transferrerAddress
+	if kind.IsHome() {
+		home, err := tokenhome.NewTokenHome(transferrerAddress, s.Backend)
+		if err != nil {
+			return nil, err
+		}
+		if tokenAddress, err = home.GetTokenAddress(&bind.CallOpts{Context: ctx}); err != nil {
+			return nil, errors.Wrap(err, "failed to get TokenHome token address")
+		}
+	}
+	if err := s.provideFunds(ctx, kind, transferrerAddress, tokenAddress, amount, feeTokenAddress, fee); err != nil {
+		return nil, err
+	}
+
+	receipt, err := s.transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		if kind.TransferrerType() == gasUtils.NativeTransferrer {
+			opts.Value = amount
+		}
+		return call(opts, kind)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to send from %s", kind)
+	}
+	result := &SendResult{Kind: kind, Receipt: receipt}
+	if event, ok := findEvent(receipt, &transferrerAddress, tokenTransferrerFilterer.ParseTokensSent); ok {
+		result.TeleporterMessageID, result.Amount = event.TeleporterMessageID, event.Amount
+	} else if event, ok := findEvent(receipt, &transferrerAddress, tokenTransferrerFilterer.ParseTokensAndCallSent); ok {
+		result.TeleporterMessageID, result.Amount = event.TeleporterMessageID, event.Amount
+	} else {
+		return nil, errors.Errorf("no TokensSent or TokensAndCallSent event in transaction %s", receipt.TxHash.Hex())
+	}
+	return result, nil
+}
+
+// provideFunds approves the token transferrer to spend the ERC20 amount and the primary fee. A
+// primary fee paid in the token transferred by a NativeTokenHome or NativeTokenRemote is first
+// deposited as the wrapped native token.
+func (s *TokenSender) provideFunds(
+	ctx context.Context,
+	kind TransferrerKind,
+	transferrerAddress common.Address,
+	tokenAddress common.Address,
+	amount *big.Int,
+	feeTokenAddress common.Address,
+	fee *big.Int,
+) error {
+	feeApproved := fee.Sign() == 0
+	if kind.TransferrerType() == gasUtils.ERC20Transferrer {
+		approval := new(big.Int).Set(amount)
+		if !feeApproved && feeTokenAddress == tokenAddress {
+			approval.Add(approval, fee)
+			feeApproved = true
+		}
+		if err := s.approve(ctx, tokenAddress, transferrerAddress, approval); err != nil {
+			return err
+		}
+	}
+	if feeApproved {
+		return nil
+	}
+	if kind.TransferrerType() == gasUtils.NativeTransferrer && feeTokenAddress == tokenAddress {
+		wrappedToken, err := wrappednativetoken.NewWrappedNativeToken(tokenAddress, s.Backend)
+		if err != nil {
+			return err
+		}
+		_, err = s.transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			opts.Value = fee
+			return wrappedToken.Deposit(opts)
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to deposit the primary fee")
+		}
+	}
+	return s.approve(ctx, feeTokenAddress, transferrerAddress, fee)
+}
+
+func (s *TokenSender) approve(ctx context.Context, tokenAddress, spender common.Address, amount *big.Int) error {
+	token, err := exampleerc20.NewExampleERC20(tokenAddress, s.Backend)
+	if err != nil {
+		return err
+	}
+	_, err = s.transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return token.Approve(opts, spender, amount)
+	})
+	return errors.Wrapf(err, "failed to approve %s", tokenAddress.Hex())
+}
+
+// transact sends the transaction built by [build] with a copy of the sender's options, and waits
+// for it to succeed.
+func (s *TokenSender) transact(
+	ctx context.Context,
+	build func(opts *bind.TransactOpts) (*types.Transaction, error),
+) (*types.Receipt, error) {
+	opts := *s.Opts
+	opts.Context = ctx
+	tx, err := build(&opts)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := s.Wait(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, errors.Errorf("transaction %s reverted", tx.Hash().Hex())
+	}
+	return receipt, nil
+}
@@ -0,0 +1,259 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	nativeMinter "github.com/ava-labs/icm-contracts/abi-bindings/go/INativeMinter"
+	nativetokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/NativeTokenHome"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	nativetokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemote"
+	tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/TokenRemote"
+	wrappednativetoken "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/WrappedNativeToken"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/nativeminter"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenSender(t *testing.T) {
+	ctx := context.Background()
+	env := receiverTestUtils.NewTokenHomeTestEnv(t, 18)
+	kit := env.Kit
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+
+	// Every transferrer is deployed to the same chain, which sends through the real TeleporterMessenger.
+	// The remotes are configured with a placeholder TokenHome on another chain.
+	remoteID, remoteAddress := ids.ID{1}, common.HexToAddress("0x01")
+	homeID, homeAddress := ids.ID{9}, common.HexToAddress("0x09")
+	env.RegisterRemote(t, remoteID, remoteAddress, 18, big.NewInt(0))
+
+	wrappedAddress, tx, _, err := wrappednativetoken.DeployWrappedNativeToken(opts, kit.Client(), "WNTV")
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	nativeHomeAddress, tx, _, err := nativetokenhome.DeployNativeTokenHome(
+		opts, kit.Client(), env.RegistryAddress, kit.DeployerAddress, big.NewInt(1), wrappedAddress,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	message, err := itokentransferrer.PackTransferrerMessage(
+		itokentransferrer.RegisterRemote,
+		&itokentransferrer.RegisterRemoteMessage{
+			InitialReserveImbalance: big.NewInt(0),
+			HomeTokenDecimals:       18,
+			RemoteTokenDecimals:     18,
+		},
+	)
+	require.NoError(t, err)
+	result, err := kit.DeliverMessage(ctx, nativeHomeAddress, remoteID, remoteAddress, message, 500_000)
+	require.NoError(t, err)
+	receiverTestUtils.RequireDelivered(t, result)
+
+	settings := erc20tokenremote.TokenRemoteSettings{
+		TeleporterRegistryAddress: env.RegistryAddress,
+		TeleporterManager:         kit.DeployerAddress,
+		MinTeleporterVersion:      big.NewInt(1),
+		TokenHomeBlockchainID:     homeID,
+		TokenHomeAddress:          homeAddress,
+		TokenHomeDecimals:         18,
+	}
+	erc20RemoteAddress, tx, _, err := erc20tokenremote.DeployERC20TokenRemote(
+		opts, kit.Client(), settings, "Token", "TKN", 18,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	nativeRemoteAddress, tx, _, err := nativetokenremote.DeployNativeTokenRemote(
+		opts, kit.Client(), nativetokenremote.TokenRemoteSettings(settings), "NTV", big.NewInt(1_000), big.NewInt(1),
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	minter, err := nativeMinter.NewINativeMinter(nativeminter.ContractAddress, kit.Client())
+	require.NoError(t, err)
+	tx, err = minter.SetEnabled(opts, nativeRemoteAddress)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	// Tokens received from the TokenHome fund the ERC20TokenRemote sender, and collateralize the
+	// NativeTokenRemote.
+	for _, address := range []common.Address{erc20RemoteAddress, nativeRemoteAddress} {
+		message, err := itokentransferrer.PackTransferrerMessage(
+			itokentransferrer.SingleHopSend,
+			&itokentransferrer.SingleHopSendMessage{Recipient: kit.DeployerAddress, Amount: big.NewInt(1_000_000)},
+		)
+		require.NoError(t, err)
+		result, err := kit.DeliverMessage(ctx, address, homeID, homeAddress, message, 500_000)
+		require.NoError(t, err)
+		receiverTestUtils.RequireDelivered(t, result)
+	}
+
+	feeTokenAddress, tx, _, err := exampleerc20.DeployExampleERC20(opts, kit.Client())
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	homeTokenAddress, err := env.Home.GetTokenAddress(&bind.CallOpts{})
+	require.NoError(t, err)
+
+	recipient := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	toRemote := tokenremote.SendTokensInput{
+		DestinationBlockchainID:            remoteID,
+		DestinationTokenTransferrerAddress: remoteAddress,
+		Recipient:                          recipient,
+		PrimaryFee:                         big.NewInt(10),
+		SecondaryFee:                       big.NewInt(0),
+		RequiredGasLimit:                   big.NewInt(100_000),
+	}
+	toHome := tokenremote.SendTokensInput{
+		DestinationBlockchainID:            homeID,
+		DestinationTokenTransferrerAddress: homeAddress,
+		Recipient:                          recipient,
+		PrimaryFee:                         big.NewInt(10),
+		SecondaryFee:                       big.NewInt(0),
+		RequiredGasLimit:                   big.NewInt(100_000),
+	}
+	withFeeToken := func(input tokenremote.SendTokensInput, feeTokenAddress common.Address) tokenremote.SendTokensInput {
+		input.PrimaryFeeTokenAddress = feeTokenAddress
+		return input
+	}
+	multiHop := withFeeToken(toHome, erc20RemoteAddress)
+	multiHop.DestinationBlockchainID = ids.ID{2}
+	multiHop.DestinationTokenTransferrerAddress = common.HexToAddress("0x02")
+	multiHop.SecondaryFee = big.NewInt(5)
+	multiHop.MultiHopFallback = recipient
+
+	tests := []struct {
+		name               string
+		transferrerAddress common.Address
+		input              tokenremote.SendTokensInput
+		call               bool
+		kind               TransferrerKind
+		messageType        itokentransferrer.TransferrerMessageType
+	}{
+		{
+			name:               "ERC20TokenHome with fee in the transferred token",
+			transferrerAddress: env.HomeAddress,
+			input:              withFeeToken(toRemote, homeTokenAddress),
+			kind:               ERC20TokenHomeKind,
+			messageType:        itokentransferrer.SingleHopSend,
+		},
+		{
+			name:               "ERC20TokenHome sendAndCall with fee in another token",
+			transferrerAddress: env.HomeAddress,
+			input:              withFeeToken(toRemote, feeTokenAddress),
+			call:               true,
+			kind:               ERC20TokenHomeKind,
+			messageType:        itokentransferrer.SingleHopCall,
+		},
+		{
+			name:               "NativeTokenHome with fee in the wrapped token",
+			transferrerAddress: nativeHomeAddress,
+			input:              withFeeToken(toRemote, wrappedAddress),
+			kind:               NativeTokenHomeKind,
+			messageType:        itokentransferrer.SingleHopSend,
+		},
+		{
+			name:               "ERC20TokenRemote with fee in the transferred token",
+			transferrerAddress: erc20RemoteAddress,
+			input:              withFeeToken(toHome, erc20RemoteAddress),
+			kind:               ERC20TokenRemoteKind,
+			messageType:        itokentransferrer.SingleHopSend,
+		},
+		{
+			name:               "ERC20TokenRemote multi-hop",
+			transferrerAddress: erc20RemoteAddress,
+			input:              multiHop,
+			kind:               ERC20TokenRemoteKind,
+			messageType:        itokentransferrer.MultiHopSend,
+		},
+		{
+			name:               "NativeTokenRemote with fee in the wrapped token",
+			transferrerAddress: nativeRemoteAddress,
+			input:              withFeeToken(toHome, nativeRemoteAddress),
+			kind:               NativeTokenRemoteKind,
+			messageType:        itokentransferrer.SingleHopSend,
+		},
+		{
+			name:               "NativeTokenRemote sendAndCall with fee in another token",
+			transferrerAddress: nativeRemoteAddress,
+			input:              withFeeToken(toHome, feeTokenAddress),
+			call:               true,
+			kind:               NativeTokenRemoteKind,
+			messageType:        itokentransferrer.SingleHopCall,
+		},
+	}
+	sender := NewTokenSender(kit.Client(), opts, kit.Commit)
+	amount := big.NewInt(1_000)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feeToken, err := exampleerc20.NewExampleERC20(tt.input.PrimaryFeeTokenAddress, kit.Client())
+			require.NoError(t, err)
+			feesBefore, err := feeToken.BalanceOf(&bind.CallOpts{}, env.MessengerAddress)
+			require.NoError(t, err)
+
+			var result *SendResult
+			if tt.call {
+				result, err = sender.SendAndCall(ctx, tt.transferrerAddress, tokenremote.SendAndCallInput{
+					DestinationBlockchainID:            tt.input.DestinationBlockchainID,
+					DestinationTokenTransferrerAddress: tt.input.DestinationTokenTransferrerAddress,
+					RecipientContract:                  tt.input.Recipient,
+					RecipientPayload:                   []byte{1},
+					RequiredGasLimit:                   big.NewInt(200_000),
+					RecipientGasLimit:                  big.NewInt(50_000),
+					FallbackRecipient:                  tt.input.Recipient,
+					PrimaryFeeTokenAddress:             tt.input.PrimaryFeeTokenAddress,
+					PrimaryFee:                         tt.input.PrimaryFee,
+					SecondaryFee:                       tt.input.SecondaryFee,
+				}, amount)
+			} else {
+				result, err = sender.Send(ctx, tt.transferrerAddress, tt.input, amount)
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.kind, result.Kind)
+			require.Equal(t, amount, result.Amount)
+
+			hop, err := newTransferHop(result.Receipt, result.TeleporterMessageID, ids.Empty, tt.transferrerAddress)
+			require.NoError(t, err)
+			require.Equal(t, tt.messageType, hop.MessageType)
+			// A multi-hop transfer is first sent to the TokenHome.
+			if tt.messageType == itokentransferrer.MultiHopSend {
+				require.Equal(t, homeAddress, hop.DestinationAddress)
+			} else {
+				require.Equal(t, tt.input.DestinationTokenTransferrerAddress, hop.DestinationAddress)
+			}
+			calls := FindCallMessages(result.Receipt)
+			if tt.call {
+				require.Len(t, calls, 1)
+				require.Equal(t, result.TeleporterMessageID, calls[0].TeleporterMessageID)
+				require.Equal(t, hop.DestinationAddress, calls[0].DestinationAddress)
+				require.Equal(t, []byte{1}, calls[0].RecipientPayload)
+			} else {
+				require.Empty(t, calls)
+			}
+
+			// The primary fee is held by the TeleporterMessenger until the message is delivered.
+			feesAfter, err := feeToken.BalanceOf(&bind.CallOpts{}, env.MessengerAddress)
+			require.NoError(t, err)
+			require.Equal(t, tt.input.PrimaryFee, new(big.Int).Sub(feesAfter, feesBefore))
+		})
+	}
+
+	_, err = sender.Send(ctx, env.HomeAddress, toRemote, big.NewInt(0))
+	require.ErrorContains(t, err, "amount must be positive")
+	_, err = sender.Send(ctx, feeTokenAddress, toRemote, amount)
+	require.ErrorContains(t, err, "no token transferrer found")
+	// A TokenRemote only sends single-hop transfers to its TokenHome.
+	_, err = sender.Send(ctx, erc20RemoteAddress, withFeeToken(toRemote, erc20RemoteAddress), amount)
+	require.ErrorContains(t, err, "failed to send from ERC20TokenRemote")
+}
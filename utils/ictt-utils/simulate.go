@@ -0,0 +1,293 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/core"
+	"github.com/ava-labs/subnet-evm/rpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+const (
+	erc20ReceiveTokensSig  = "receiveTokens(bytes32,address,address,address,uint256,bytes)"
+	nativeReceiveTokensSig = "receiveTokens(bytes32,address,address,bytes)"
+)
+
+var (
+	// openZeppelinERC20StorageLocation is the ERC-7201 namespace of OpenZeppelin's ERC20Upgradeable,
+	// which ERC20TokenRemote and NativeTokenRemote inherit.
+	openZeppelinERC20StorageLocation = common.HexToHash(
+		"0x52c63247e1f47db19d5ce0460030c497f067ca4cebf71ba98eeadabe20bace00",
+	)
+	// probeValue is written to candidate storage slots to find the one a token reads a mapping from.
+	probeValue = common.HexToHash("0x1c7e0000000000000000000000000000000000000000000000000000000c0ffee")
+)
+
+// RPCCaller makes raw JSON-RPC calls. It is implemented by *rpc.Client.
+type RPCCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// RecipientCallSimulation describes the call a destination token transferrer makes to the recipient
+// contract of a sendAndCall transfer.
+type RecipientCallSimulation struct {
+	// RecipientABI is the ABI of the recipient contract. It must have the receiveTokens method of
+	// IERC20SendAndCallReceiver or INativeSendAndCallReceiver, matching DestinationKind.
+	RecipientABI *abi.ABI
+
+	DestinationKind    TransferrerKind
+	DestinationAddress common.Address
+	// TokenAddress is the ERC20 the destination transferrer provides to the recipient. It defaults to
+	// DestinationAddress, which is the token of an ERC20TokenRemote, and must be set for an ERC20TokenHome.
+	TokenAddress common.Address
+
+	SourceBlockchainID            ids.ID
+	OriginTokenTransferrerAddress common.Address
+	OriginSenderAddress           common.Address
+	RecipientContract             common.Address
+	RecipientPayload              []byte
+	RecipientGasLimit             uint64
+	// Amount is denominated in the destination's token.
+	Amount *big.Int
+}
+
+// RecipientCallResult is the outcome of a simulated call to a recipient contract.
+type RecipientCallResult struct {
+	Success bool
+	// RevertReason is the reason the call reverted with, or the execution error if it has none.
+	RevertReason string
+	// TokensProvided is false if the storage of the ERC20's balances or allowances could not be found,
+	// so the recipient was called without the tokens the transferrer would have provided.
+	TokensProvided bool
+	// Call is the recipient payload decoded with the method of the recipient ABI its selector matches,
+	// if any.
+	Call *RecipientCall
+}
+
+// SimulateRecipientCall simulates the receiveTokens call a destination token transferrer makes to the
+// recipient contract of a sendAndCall transfer, with eth_call on the destination chain. Like the
+// transferrer, the call is made from the transferrer address with exactly the recipient gas limit. The
+// tokens the transferrer provides first are provided with state overrides: a native transferrer is
+// given the amount it sends with the call, and an ERC20 transferrer is given the amount and approves
+// it for the recipient contract.
+func SimulateRecipientCall(
+	ctx context.Context,
+	caller RPCCaller,
+	sim *RecipientCallSimulation,
+) (*RecipientCallResult, error) {
+	if sim.RecipientABI == nil {
+		return nil, errors.New("recipient ABI is required")
+	}
+	if sim.Amount == nil || sim.Amount.Sign() <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	if sim.RecipientGasLimit == 0 {
+		return nil, errors.New("recipient gas limit must be positive")
+	}
+	method, ok := sim.RecipientABI.Methods["receiveTokens"]
+	expectedSig := erc20ReceiveTokensSig
+	if sim.DestinationKind.TransferrerType() == gasUtils.NativeTransferrer {
+		expectedSig = nativeReceiveTokensSig
+	}
+	if !ok || method.Sig != expectedSig {
+		return nil, errors.Errorf("recipient ABI has no %s method, which %s calls", expectedSig, sim.DestinationKind)
+	}
+
+	result := &RecipientCallResult{}
+	if call, err := DecodeRecipientPayload(sim.RecipientPayload, ABIMethods(sim.RecipientABI)...); err == nil {
+		result.Call = call
+	}
+
+	args := callArgs{
+		From: sim.DestinationAddress,
+		To:   sim.RecipientContract,
+	}
+	overrides := map[common.Address]overrideAccount{}
+	var err error
+	if sim.DestinationKind.TransferrerType() == gasUtils.NativeTransferrer {
+		args.Input, err = sim.RecipientABI.Pack(
+			"receiveTokens", sim.SourceBlockchainID, sim.OriginTokenTransferrerAddress, sim.OriginSenderAddress,
+			sim.RecipientPayload,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to pack receiveTokens call")
+		}
+		var balance hexutil.Big
+		if err := caller.CallContext(ctx, &balance, "eth_getBalance", sim.DestinationAddress, "latest"); err != nil {
+			return nil, errors.Wrap(err, "failed to get destination transferrer balance")
+		}
+		args.Value = (*hexutil.Big)(sim.Amount)
+		overrides[sim.DestinationAddress] = overrideAccount{
+			Balance: (*hexutil.Big)(new(big.Int).Add(balance.ToInt(), sim.Amount)),
+		}
+		result.TokensProvided = true
+	} else {
+		tokenAddress := sim.TokenAddress
+		if tokenAddress == (common.Address{}) {
+			tokenAddress = sim.DestinationAddress
+		}
+		args.Input, err = sim.RecipientABI.Pack(
+			"receiveTokens", sim.SourceBlockchainID, sim.OriginTokenTransferrerAddress, sim.OriginSenderAddress,
+			tokenAddress, sim.Amount, sim.RecipientPayload,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to pack receiveTokens call")
+		}
+		stateDiff, err := provideERC20(ctx, caller, tokenAddress, sim.DestinationAddress, sim.RecipientContract, sim.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if stateDiff != nil {
+			overrides[tokenAddress] = overrideAccount{StateDiff: stateDiff}
+			result.TokensProvided = true
+		}
+	}
+	intrinsicGas, err := core.IntrinsicGas(args.Input, nil, false, gasUtils.CallRules)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute intrinsic gas")
+	}
+	args.Gas = hexutil.Uint64(sim.RecipientGasLimit + intrinsicGas)
+
+	var returnData hexutil.Bytes
+	err = caller.CallContext(ctx, &returnData, "eth_call", args, "latest", overrides)
+	if err == nil {
+		result.Success = true
+		return result, nil
+	}
+	// Execution errors are returned as JSON-RPC errors, with the revert data if there is any.
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return nil, errors.Wrap(err, "failed to simulate recipient call")
+	}
+	result.RevertReason = err.Error()
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if data, ok := dataErr.ErrorData().(string); ok {
+			if revertData, err := hexutil.Decode(data); err == nil {
+				if reason, err := abi.UnpackRevert(revertData); err == nil {
+					result.RevertReason = reason
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+type callArgs struct {
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Gas   hexutil.Uint64 `json:"gas,omitempty"`
+	Value *hexutil.Big   `json:"value,omitempty"`
+	Input hexutil.Bytes  `json:"input"`
+}
+
+type overrideAccount struct {
+	Balance   *hexutil.Big                `json:"balance,omitempty"`
+	StateDiff map[common.Hash]common.Hash `json:"stateDiff,omitempty"`
+}
+
+// provideERC20 returns the storage overrides of [tokenAddress] that add [amount] to the balance of
+// [owner] and to its allowance for [spender]. It returns nil if the storage of either mapping is not
+// found. The mappings are looked for in the first storage slots, as laid out by a plain contract, and
+// in the OpenZeppelin ERC20Upgradeable namespace.
+func provideERC20(
+	ctx context.Context,
+	caller RPCCaller,
+	tokenAddress common.Address,
+	owner common.Address,
+	spender common.Address,
+	amount *big.Int,
+) (map[common.Hash]common.Hash, error) {
+	tokenABI, err := exampleerc20.ExampleERC20MetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	balanceOf, err := tokenABI.Pack("balanceOf", owner)
+	if err != nil {
+		return nil, err
+	}
+	allowance, err := tokenABI.Pack("allowance", owner, spender)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]common.Hash, 0, 12)
+	for slot := int64(0); slot < 10; slot++ {
+		candidates = append(candidates, common.BigToHash(big.NewInt(slot)))
+	}
+	namespace := openZeppelinERC20StorageLocation.Big()
+	candidates = append(candidates,
+		common.BigToHash(namespace), common.BigToHash(new(big.Int).Add(namespace, common.Big1)))
+
+	stateDiff := map[common.Hash]common.Hash{}
+	lookups := []struct {
+		call []byte
+		slot func(base common.Hash) common.Hash
+	}{
+		{balanceOf, func(base common.Hash) common.Hash { return mappingSlot(base, owner) }},
+		{allowance, func(base common.Hash) common.Hash { return mappingSlot(mappingSlot(base, owner), spender) }},
+	}
+	for _, lookup := range lookups {
+		current, err := callToken(ctx, caller, tokenAddress, lookup.call, nil)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, base := range candidates {
+			slot := lookup.slot(base)
+			probed, err := callToken(ctx, caller, tokenAddress, lookup.call, map[common.Hash]common.Hash{slot: probeValue})
+			if err != nil {
+				return nil, err
+			}
+			if probed == probeValue {
+				stateDiff[slot] = common.BigToHash(new(big.Int).Add(current.Big(), amount))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+	return stateDiff, nil
+}
+
+// callToken calls a view method of the token at [tokenAddress] returning a single word, with
+// [stateDiff] applied to the token's storage.
+func callToken(
+	ctx context.Context,
+	caller RPCCaller,
+	tokenAddress common.Address,
+	input []byte,
+	stateDiff map[common.Hash]common.Hash,
+) (common.Hash, error) {
+	var overrides map[common.Address]overrideAccount
+	if stateDiff != nil {
+		overrides = map[common.Address]overrideAccount{tokenAddress: {StateDiff: stateDiff}}
+	}
+	var returnData hexutil.Bytes
+	err := caller.CallContext(ctx, &returnData, "eth_call", callArgs{To: tokenAddress, Input: input}, "latest", overrides)
+	if err != nil {
+		return common.Hash{}, errors.Wrapf(err, "failed to call token %s", tokenAddress.Hex())
+	}
+	if len(returnData) != common.HashLength {
+		return common.Hash{}, errors.Errorf("token %s returned %d bytes", tokenAddress.Hex(), len(returnData))
+	}
+	return common.BytesToHash(returnData), nil
+}
+
+// mappingSlot returns the storage slot of [key] in the Solidity mapping at slot [base].
+func mappingSlot(base common.Hash, key common.Address) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(key.Bytes(), common.HashLength), base.Bytes())
+}
@@ -0,0 +1,186 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	mockERC20SACR "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/mocks/MockERC20SendAndCallReceiver"
+	mockNativeSACR "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/mocks/MockNativeSendAndCallReceiver"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	"github.com/ava-labs/subnet-evm/ethclient"
+	"github.com/ava-labs/subnet-evm/ethclient/simulated"
+	"github.com/ava-labs/subnet-evm/rpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// rpcClient returns the JSON-RPC client of [backend], for the eth_call with state overrides the typed
+// client does not expose. The backend's client embeds an ethclient.Client, whose own Client method is
+// shadowed by the name of the embedded field.
+func rpcClient(backend *simulated.Backend) *rpc.Client {
+	return reflect.ValueOf(backend.Client()).FieldByName("Client").Interface().(ethclient.Client).Client()
+}
+
+func TestSimulateRecipientCall(t *testing.T) {
+	ctx := context.Background()
+	env := newTransferrerTestEnv(t, ids.ID{9}, common.HexToAddress("0x09"))
+	opts, err := env.kit.DeployerTransactor()
+	require.NoError(t, err)
+	caller := rpcClient(env.kit.Backend)
+
+	erc20ReceiverAddress, tx, erc20Receiver, err := mockERC20SACR.DeployMockERC20SendAndCallReceiver(
+		opts, env.kit.Client(),
+	)
+	require.NoError(t, err)
+	_, err = env.kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	nativeReceiverAddress, tx, _, err := mockNativeSACR.DeployMockNativeSendAndCallReceiver(opts, env.kit.Client())
+	require.NoError(t, err)
+	_, err = env.kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	tokenAddress, tx, _, err := exampleerc20.DeployExampleERC20(opts, env.kit.Client())
+	require.NoError(t, err)
+	_, err = env.kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	blockedSender := common.HexToAddress("0xb10c")
+	tx, err = erc20Receiver.BlockSender(opts, ids.ID{1}, blockedSender)
+	require.NoError(t, err)
+	_, err = env.kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	erc20ABI, err := mockERC20SACR.MockERC20SendAndCallReceiverMetaData.GetAbi()
+	require.NoError(t, err)
+	nativeABI, err := mockNativeSACR.MockNativeSendAndCallReceiverMetaData.GetAbi()
+	require.NoError(t, err)
+	// The payload calls a method of the recipient ABI, so that it is decoded.
+	payload, err := EncodeRecipientPayload(
+		"blockSender(bytes32,address)",
+		[]string{"0x" + ids.ID{2}.Hex(), blockedSender.Hex()},
+	)
+	require.NoError(t, err)
+
+	simulation := func(
+		kind TransferrerKind,
+		destinationAddress common.Address,
+		recipientAddress common.Address,
+	) *RecipientCallSimulation {
+		recipientABI := erc20ABI
+		if kind == NativeTokenHomeKind || kind == NativeTokenRemoteKind {
+			recipientABI = nativeABI
+		}
+		return &RecipientCallSimulation{
+			RecipientABI:                  recipientABI,
+			DestinationKind:               kind,
+			DestinationAddress:            destinationAddress,
+			SourceBlockchainID:            ids.ID{1},
+			OriginTokenTransferrerAddress: common.HexToAddress("0x01"),
+			OriginSenderAddress:           common.HexToAddress("0x02"),
+			RecipientContract:             recipientAddress,
+			RecipientPayload:              payload,
+			RecipientGasLimit:             200_000,
+			Amount:                        big.NewInt(1_000),
+		}
+	}
+
+	tests := []struct {
+		name           string
+		sim            *RecipientCallSimulation
+		modify         func(sim *RecipientCallSimulation)
+		success        bool
+		revertReason   string
+		tokensProvided bool
+	}{
+		{
+			name: "ERC20TokenHome",
+			sim:  simulation(ERC20TokenHomeKind, env.erc20HomeAddress, erc20ReceiverAddress),
+			modify: func(sim *RecipientCallSimulation) {
+				sim.TokenAddress = tokenAddress
+			},
+			success:        true,
+			tokensProvided: true,
+		},
+		{
+			name:           "ERC20TokenRemote",
+			sim:            simulation(ERC20TokenRemoteKind, env.erc20RemoteAddress, erc20ReceiverAddress),
+			success:        true,
+			tokensProvided: true,
+		},
+		{
+			name:           "NativeTokenRemote",
+			sim:            simulation(NativeTokenRemoteKind, env.nativeRemoteAddress, nativeReceiverAddress),
+			success:        true,
+			tokensProvided: true,
+		},
+		{
+			name: "ERC20 blocked sender",
+			sim:  simulation(ERC20TokenRemoteKind, env.erc20RemoteAddress, erc20ReceiverAddress),
+			modify: func(sim *RecipientCallSimulation) {
+				sim.OriginSenderAddress = blockedSender
+			},
+			revertReason:   "MockERC20SendAndCallReceiver: sender blocked",
+			tokensProvided: true,
+		},
+		{
+			name: "native empty payload",
+			sim:  simulation(NativeTokenHomeKind, env.nativeHomeAddress, nativeReceiverAddress),
+			modify: func(sim *RecipientCallSimulation) {
+				sim.RecipientPayload = nil
+			},
+			revertReason:   "MockNativeSendAndCallReceiver: empty payload",
+			tokensProvided: true,
+		},
+		{
+			name: "out of gas",
+			sim:  simulation(ERC20TokenRemoteKind, env.erc20RemoteAddress, erc20ReceiverAddress),
+			modify: func(sim *RecipientCallSimulation) {
+				sim.RecipientGasLimit = 5_000
+			},
+			revertReason:   "out of gas",
+			tokensProvided: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.modify != nil {
+				tt.modify(tt.sim)
+			}
+			result, err := SimulateRecipientCall(ctx, caller, tt.sim)
+			require.NoError(t, err)
+			require.Equal(t, tt.success, result.Success, result.RevertReason)
+			require.Contains(t, result.RevertReason, tt.revertReason)
+			require.Equal(t, tt.tokensProvided, result.TokensProvided)
+			if tt.sim.RecipientPayload != nil {
+				require.NotNil(t, result.Call)
+				require.Equal(t, "blockSender", result.Call.Method.Name)
+			}
+		})
+	}
+
+	// The call is simulated without committing it, so the sender is not blocked.
+	blocked, err := erc20Receiver.BlockedSenders(nil, ids.ID{2}, blockedSender)
+	require.NoError(t, err)
+	require.False(t, blocked)
+
+	invalid := simulation(ERC20TokenRemoteKind, env.erc20RemoteAddress, erc20ReceiverAddress)
+	invalid.RecipientABI = nativeABI
+	_, err = SimulateRecipientCall(ctx, caller, invalid)
+	require.ErrorContains(t, err, "recipient ABI has no "+erc20ReceiveTokensSig+" method, which ERC20TokenRemote calls")
+	invalid = simulation(ERC20TokenHomeKind, env.erc20HomeAddress, erc20ReceiverAddress)
+	invalid.TokenAddress = env.erc20HomeAddress
+	_, err = SimulateRecipientCall(ctx, caller, invalid)
+	require.ErrorContains(t, err, "failed to call token")
+	invalid = simulation(NativeTokenRemoteKind, env.nativeRemoteAddress, nativeReceiverAddress)
+	invalid.Amount = big.NewInt(0)
+	_, err = SimulateRecipientCall(ctx, caller, invalid)
+	require.ErrorContains(t, err, "amount must be positive")
+	invalid.Amount, invalid.RecipientABI = big.NewInt(1), nil
+	_, err = SimulateRecipientCall(ctx, caller, invalid)
+	require.ErrorContains(t, err, "recipient ABI is required")
+}
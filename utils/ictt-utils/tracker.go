@@ -0,0 +1,439 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/TokenRemote"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	logUtils "github.com/ava-labs/icm-contracts/utils/log-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// TransferStatus is how far an ICTT transfer has progressed.
+type TransferStatus string
+
+const (
+	// TransferPending means the Teleporter message of the transfer's last hop has not been delivered.
+	TransferPending TransferStatus = "pending"
+	// TransferExecutionFailed means the Teleporter message of the transfer's last hop was delivered,
+	// but its execution failed. It can be retried with retryMessageExecution.
+	TransferExecutionFailed TransferStatus = "execution-failed"
+	// TransferWithdrawn means the tokens were withdrawn to the recipient.
+	TransferWithdrawn TransferStatus = "withdrawn"
+	// TransferCallSucceeded means the recipient contract of a sendAndCall transfer was called successfully.
+	TransferCallSucceeded TransferStatus = "call-succeeded"
+	// TransferCallFailed means the call to the recipient contract of a sendAndCall transfer failed,
+	// and the tokens were sent to the fallback recipient.
+	TransferCallFailed TransferStatus = "call-failed"
+	// TransferMultiHopFallback means the TokenHome could not route a multi-hop transfer to its
+	// destination, and withdrew the tokens to the multi-hop fallback address.
+	TransferMultiHopFallback TransferStatus = "multi-hop-fallback"
+)
+
+// TransferHop is one Teleporter message of an ICTT transfer.
+type TransferHop struct {
+	TeleporterMessageID     ids.ID                                   `json:"teleporterMessageID"`
+	SourceBlockchainID      ids.ID                                   `json:"sourceBlockchainID"`
+	SourceAddress           common.Address                           `json:"sourceAddress"`
+	DestinationBlockchainID ids.ID                                   `json:"destinationBlockchainID"`
+	DestinationAddress      common.Address                           `json:"destinationAddress"`
+	MessageType             itokentransferrer.TransferrerMessageType `json:"messageType"`
+	// Amount is the amount in the transferrer message, denominated in the destination's token.
+	Amount     *big.Int    `json:"amount"`
+	SendTxHash common.Hash `json:"sendTxHash"`
+	// ReceiveTxHash is set once the message is delivered, and ExecutionTxHash once it executes. They
+	// differ if the execution failed on delivery and was retried.
+	Delivered       bool        `json:"delivered"`
+	ReceiveTxHash   common.Hash `json:"receiveTxHash"`
+	Executed        bool        `json:"executed"`
+	ExecutionTxHash common.Hash `json:"executionTxHash"`
+
+	// fallbackRecipient receives the tokens if the call of a sendAndCall message fails.
+	fallbackRecipient common.Address
+	// sentAt is the timestamp of the block that sent the message.
+	sentAt uint64
+}
+
+// TransferTrace follows an ICTT transfer from the transaction that sent it.
+type TransferTrace struct {
+	Sender common.Address
+	// Hops has one entry for a single-hop transfer, and two for a multi-hop transfer once the TokenHome
+	// routes it.
+	Hops []*TransferHop
+	// SecondaryFee is the fee the TokenHome paid for the routed message of a multi-hop transfer, out of
+	// the transferred amount. It is nil until the transfer is routed.
+	SecondaryFee *big.Int
+	Status       TransferStatus
+	// Recipient and Amount are set once the transfer completes, and are the address that received the
+	// tokens and the amount it received. For TransferCallSucceeded, Recipient is the recipient contract.
+	Recipient common.Address
+	Amount    *big.Int
+}
+
+// Complete returns whether the transfer has reached its final recipient.
+func (t *TransferTrace) Complete() bool {
+	return t.Status != TransferPending && t.Status != TransferExecutionFailed
+}
+
+// StuckAt returns the hop the transfer is waiting on, or nil if it is complete.
+func (t *TransferTrace) StuckAt() *TransferHop {
+	if t.Complete() {
+		return nil
+	}
+	return t.Hops[len(t.Hops)-1]
+}
+
+func (t *TransferTrace) String() string {
+	if hop := t.StuckAt(); hop != nil {
+		return fmt.Sprintf(
+			"%s at hop %d: message %s from %s to %s",
+			t.Status, len(t.Hops), hop.TeleporterMessageID, hop.SourceBlockchainID, hop.DestinationBlockchainID,
+		)
+	}
+	return fmt.Sprintf("%s: %s received %s", t.Status, t.Recipient.Hex(), t.Amount)
+}
+
+// deliveryClockSkew is how far the clock of a message's destination chain may be behind its source
+// chain's. The delivery of a message is looked up from the first destination block this long before
+// the message was sent.
+const deliveryClockSkew = 5 * time.Minute
+
+// TrackerBackend is a chain that an ICTT transfer passes through.
+type TrackerBackend interface {
+	bind.ContractBackend
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+var (
+	tokenTransferrerFilterer *tokenhome.TokenHomeFilterer
+	teleporterFilterer       *teleportermessenger.TeleporterMessengerFilterer
+	receiveEventID           common.Hash
+	executedEventID          common.Hash
+)
+
+func init() {
+	var err error
+	// TokenHome and TokenRemote emit the same ITokenTransferrer events.
+	tokenTransferrerFilterer, err = tokenhome.NewTokenHomeFilterer(common.Address{}, nil)
+	if err != nil {
+		panic(err)
+	}
+	teleporterFilterer, err = teleportermessenger.NewTeleporterMessengerFilterer(common.Address{}, nil)
+	if err != nil {
+		panic(err)
+	}
+	teleporterABI, err := teleportermessenger.TeleporterMessengerMetaData.GetAbi()
+	if err != nil {
+		panic(err)
+	}
+	receiveEventID = teleporterABI.Events["ReceiveCrossChainMessage"].ID
+	executedEventID = teleporterABI.Events["MessageExecuted"].ID
+}
+
+// TrackTransfer follows the ICTT transfer sent by the transaction [txHash] on [sourceBackend], which
+// must have emitted a TokensSent or TokensAndCallSent event. Each Teleporter message of the transfer
+// is looked up on the backend in [backends] for its destination blockchain ID, and the transfer is
+// followed until it completes or a message has not been delivered or executed. Message deliveries
+// are found by scanning logs forwards from the destination block at the time the message was sent,
+// in ranges of at most [maxBlockRange] blocks if it is non-zero.
+func TrackTransfer(
+	ctx context.Context,
+	sourceBackend TrackerBackend,
+	txHash common.Hash,
+	backends map[ids.ID]TrackerBackend,
+	maxBlockRange uint64,
+) (*TransferTrace, error) {
+	receipt, err := sourceBackend.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get transaction receipt")
+	}
+	trace := &TransferTrace{}
+	var (
+		messageID          [32]byte
+		transferrerAddress common.Address
+	)
+	if event, ok := findEvent(receipt, nil, tokenTransferrerFilterer.ParseTokensSent); ok {
+		messageID, trace.Sender, transferrerAddress = event.TeleporterMessageID, event.Sender, event.Raw.Address
+	} else if event, ok := findEvent(receipt, nil, tokenTransferrerFilterer.ParseTokensAndCallSent); ok {
+		messageID, trace.Sender, transferrerAddress = event.TeleporterMessageID, event.Sender, event.Raw.Address
+	} else {
+		return nil, fmt.Errorf("no TokensSent or TokensAndCallSent event in transaction %s", txHash.Hex())
+	}
+	transferrer, err := tokenremote.NewTokenRemote(transferrerAddress, sourceBackend)
+	if err != nil {
+		return nil, err
+	}
+	sourceBlockchainID, err := transferrer.GetBlockchainID(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get source blockchain ID")
+	}
+
+	hop, err := newTransferHop(receipt, messageID, sourceBlockchainID, transferrerAddress)
+	if err != nil {
+		return nil, err
+	}
+	if hop.sentAt, err = blockTime(ctx, sourceBackend, receipt.BlockNumber); err != nil {
+		return nil, err
+	}
+	for hop != nil {
+		trace.Hops = append(trace.Hops, hop)
+		backend, ok := backends[hop.DestinationBlockchainID]
+		if !ok {
+			return nil, fmt.Errorf("no backend for blockchain %s", hop.DestinationBlockchainID)
+		}
+		skew := min(hop.sentAt, uint64(deliveryClockSkew.Seconds()))
+		fromBlock, err := firstBlockAt(ctx, backend, hop.sentAt-skew)
+		if err != nil {
+			return nil, err
+		}
+		if err := trackDelivery(ctx, backend, hop, fromBlock, maxBlockRange); err != nil {
+			return nil, err
+		}
+		if !hop.Delivered {
+			trace.Status = TransferPending
+			return trace, nil
+		}
+		if !hop.Executed {
+			trace.Status = TransferExecutionFailed
+			return trace, nil
+		}
+		receipt, err := backend.TransactionReceipt(ctx, hop.ExecutionTxHash)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get execution transaction receipt")
+		}
+		if hop, err = trace.followExecution(hop, receipt); err != nil {
+			return nil, err
+		}
+		if hop != nil {
+			if hop.sentAt, err = blockTime(ctx, backend, receipt.BlockNumber); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return trace, nil
+}
+
+// blockTime returns the timestamp of block [number] of [backend].
+func blockTime(ctx context.Context, backend bind.ContractBackend, number *big.Int) (uint64, error) {
+	header, err := backend.HeaderByNumber(ctx, number)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get block %s", number)
+	}
+	return header.Time, nil
+}
+
+// firstBlockAt returns the first block of [backend] with a timestamp of at least [timestamp], found
+// by a binary search of the block headers, or the block after the latest block if there is none.
+func firstBlockAt(ctx context.Context, backend bind.ContractBackend, timestamp uint64) (uint64, error) {
+	latest, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get latest block")
+	}
+	low, high := uint64(0), latest.Number.Uint64()+1
+	if latest.Time < timestamp {
+		return high, nil
+	}
+	for low < high {
+		mid := low + (high-low)/2
+		midTime, err := blockTime(ctx, backend, new(big.Int).SetUint64(mid))
+		if err != nil {
+			return 0, err
+		}
+		if midTime >= timestamp {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return low, nil
+}
+
+// newTransferHop returns the hop for the Teleporter message [messageID] sent by [sourceAddress]
+// in [receipt].
+func newTransferHop(
+	receipt *types.Receipt,
+	messageID [32]byte,
+	sourceBlockchainID ids.ID,
+	sourceAddress common.Address,
+) (*TransferHop, error) {
+	var sent *teleportermessenger.TeleporterMessengerSendCrossChainMessage
+	for _, log := range receipt.Logs {
+		event, err := teleporterFilterer.ParseSendCrossChainMessage(*log)
+		if err == nil && event.MessageID == messageID {
+			sent = event
+			break
+		}
+	}
+	if sent == nil {
+		return nil, fmt.Errorf("no SendCrossChainMessage event for message %s", ids.ID(messageID))
+	}
+
+	hop := &TransferHop{
+		TeleporterMessageID:     messageID,
+		SourceBlockchainID:      sourceBlockchainID,
+		SourceAddress:           sourceAddress,
+		DestinationBlockchainID: sent.DestinationBlockchainID,
+		DestinationAddress:      sent.Message.DestinationAddress,
+		SendTxHash:              receipt.TxHash,
+	}
+	var message itokentransferrer.TransferrerMessage
+	if err := message.Unpack(sent.Message.Message); err != nil {
+		return nil, err
+	}
+	hop.MessageType = itokentransferrer.TransferrerMessageType(message.MessageType)
+	switch hop.MessageType {
+	case itokentransferrer.SingleHopSend:
+		var payload itokentransferrer.SingleHopSendMessage
+		if err := payload.Unpack(message.Payload); err != nil {
+			return nil, err
+		}
+		hop.Amount = payload.Amount
+	case itokentransferrer.SingleHopCall:
+		var payload itokentransferrer.SingleHopCallMessage
+		if err := payload.Unpack(message.Payload); err != nil {
+			return nil, err
+		}
+		hop.Amount, hop.fallbackRecipient = payload.Amount, payload.FallbackRecipient
+	case itokentransferrer.MultiHopSend:
+		var payload itokentransferrer.MultiHopSendMessage
+		if err := payload.Unpack(message.Payload); err != nil {
+			return nil, err
+		}
+		hop.Amount = payload.Amount
+	case itokentransferrer.MultiHopCall:
+		var payload itokentransferrer.MultiHopCallMessage
+		if err := payload.Unpack(message.Payload); err != nil {
+			return nil, err
+		}
+		hop.Amount, hop.fallbackRecipient = payload.Amount, payload.FallbackRecipient
+	default:
+		return nil, fmt.Errorf("message %s is not a token transfer: %s", ids.ID(messageID), hop.MessageType)
+	}
+	return hop, nil
+}
+
+// trackDelivery looks up the delivery and execution of the hop's message on its destination chain,
+// from block [fromBlock] onwards. The TeleporterMessenger address is not filtered on, since the
+// message ID is unique across TeleporterMessenger deployments.
+func trackDelivery(
+	ctx context.Context,
+	backend TrackerBackend,
+	hop *TransferHop,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) error {
+	received, err := findLog(ctx, backend, receiveEventID, hop.TeleporterMessageID, fromBlock, maxBlockRange)
+	if err != nil {
+		return errors.Wrap(err, "failed to find ReceiveCrossChainMessage event")
+	}
+	if received == nil {
+		return nil
+	}
+	hop.Delivered, hop.ReceiveTxHash = true, received.TxHash
+
+	executed, err := findLog(
+		ctx, backend, executedEventID, hop.TeleporterMessageID, received.BlockNumber, maxBlockRange,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to find MessageExecuted event")
+	}
+	if executed != nil {
+		hop.Executed, hop.ExecutionTxHash = true, executed.TxHash
+	}
+	return nil
+}
+
+// followExecution records the outcome of the executed hop from the logs of the transaction that
+// executed it, and returns the next hop if the TokenHome routed the transfer.
+func (t *TransferTrace) followExecution(hop *TransferHop, receipt *types.Receipt) (*TransferHop, error) {
+	destination := &hop.DestinationAddress
+	if event, ok := findEvent(receipt, destination, tokenTransferrerFilterer.ParseTokensRouted); ok {
+		t.SecondaryFee = event.Input.PrimaryFee
+		return newTransferHop(receipt, event.TeleporterMessageID, hop.DestinationBlockchainID, hop.DestinationAddress)
+	}
+	if event, ok := findEvent(receipt, destination, tokenTransferrerFilterer.ParseTokensAndCallRouted); ok {
+		t.SecondaryFee = event.Input.PrimaryFee
+		return newTransferHop(receipt, event.TeleporterMessageID, hop.DestinationBlockchainID, hop.DestinationAddress)
+	}
+	if event, ok := findEvent(receipt, destination, tokenTransferrerFilterer.ParseCallSucceeded); ok {
+		t.Status, t.Recipient, t.Amount = TransferCallSucceeded, event.RecipientContract, event.Amount
+		return nil, nil
+	}
+	if event, ok := findEvent(receipt, destination, tokenTransferrerFilterer.ParseCallFailed); ok {
+		t.Status, t.Recipient, t.Amount = TransferCallFailed, hop.fallbackRecipient, event.Amount
+		return nil, nil
+	}
+	if event, ok := findEvent(receipt, destination, tokenTransferrerFilterer.ParseTokensWithdrawn); ok {
+		// A multi-hop message is only withdrawn on the TokenHome if it could not be routed.
+		t.Status = TransferWithdrawn
+		if hop.MessageType == itokentransferrer.MultiHopSend || hop.MessageType == itokentransferrer.MultiHopCall {
+			t.Status = TransferMultiHopFallback
+		}
+		t.Recipient, t.Amount = event.Recipient, event.Amount
+		return nil, nil
+	}
+	return nil, fmt.Errorf("no transfer outcome in transaction %s", receipt.TxHash.Hex())
+}
+
+// findEvent returns the first event in [receipt] that [parser] accepts, optionally only considering
+// logs emitted by [address].
+func findEvent[T any](
+	receipt *types.Receipt,
+	address *common.Address,
+	parser func(log types.Log) (*T, error),
+) (*T, bool) {
+	for _, log := range receipt.Logs {
+		if address != nil && log.Address != *address {
+			continue
+		}
+		if event, err := parser(*log); err == nil {
+			return event, true
+		}
+	}
+	return nil, false
+}
+
+// findLog returns the first log from block [fromBlock] onwards with the event ID [eventID] and first
+// indexed topic [topic], or nil if there is none. Blocks are scanned forwards up to the latest block,
+// in ranges of at most [maxBlockRange] blocks if it is non-zero.
+func findLog(
+	ctx context.Context,
+	backend bind.ContractBackend,
+	eventID common.Hash,
+	topic ids.ID,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) (*types.Log, error) {
+	var found *types.Log
+	err := logUtils.ForEachBlockRange(ctx, backend, fromBlock, maxBlockRange, func(start, end uint64) error {
+		if found != nil {
+			return nil
+		}
+		logs, err := backend.FilterLogs(ctx, interfaces.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Topics:    [][]common.Hash{{eventID}, {common.Hash(topic)}},
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to filter logs in blocks %d-%d", start, end)
+		}
+		if len(logs) > 0 {
+			found = &logs[0]
+		}
+		return nil
+	})
+	return found, err
+}
@@ -0,0 +1,220 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	mockERC20SACR "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/mocks/MockERC20SendAndCallReceiver"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackTransferPending(t *testing.T) {
+	ctx := context.Background()
+	env := receiverTestUtils.NewTokenHomeTestEnv(t, 18)
+	remoteID, remoteAddress := ids.ID{1}, common.HexToAddress("0x01")
+	env.RegisterRemote(t, remoteID, remoteAddress, 6, big.NewInt(0))
+	receipt := env.Send(t, remoteID, remoteAddress, big.NewInt(5e12))
+
+	// Nothing is delivered on the simulated backend through a real TeleporterMessenger, so it stands
+	// in for the remote's chain.
+	backends := map[ids.ID]TrackerBackend{remoteID: env.Kit.Client()}
+	trace, err := TrackTransfer(ctx, env.Kit.Client(), receipt.TxHash, backends, 0)
+	require.NoError(t, err)
+	require.Equal(t, TransferPending, trace.Status)
+	require.False(t, trace.Complete())
+	require.Equal(t, env.Kit.DeployerAddress, trace.Sender)
+	require.Nil(t, trace.SecondaryFee)
+	require.Len(t, trace.Hops, 1)
+
+	sent, err := receiverTestUtils.GetEventFromReceipt(receipt, env.Home.ParseTokensSent)
+	require.NoError(t, err)
+	homeBlockchainID, err := env.Home.GetBlockchainID(&bind.CallOpts{})
+	require.NoError(t, err)
+	hop := trace.StuckAt()
+	require.Equal(t, trace.Hops[0], hop)
+	require.Equal(t, ids.ID(sent.TeleporterMessageID), hop.TeleporterMessageID)
+	require.Equal(t, ids.ID(homeBlockchainID), hop.SourceBlockchainID)
+	require.Equal(t, env.HomeAddress, hop.SourceAddress)
+	require.Equal(t, remoteID, hop.DestinationBlockchainID)
+	require.Equal(t, remoteAddress, hop.DestinationAddress)
+	require.Equal(t, itokentransferrer.SingleHopSend, hop.MessageType)
+	require.Equal(t, big.NewInt(5), hop.Amount)
+	require.Equal(t, receipt.TxHash, hop.SendTxHash)
+	require.False(t, hop.Delivered)
+	require.Contains(t, trace.String(), "pending at hop 1")
+
+	// Deliveries are looked up from the first block at the time the message was sent.
+	sentAt, err := blockTime(ctx, env.Kit.Client(), receipt.BlockNumber)
+	require.NoError(t, err)
+	require.Equal(t, sentAt, hop.sentAt)
+	fromBlock, err := firstBlockAt(ctx, env.Kit.Client(), sentAt)
+	require.NoError(t, err)
+	require.Equal(t, receipt.BlockNumber.Uint64(), fromBlock)
+	fromBlock, err = firstBlockAt(ctx, env.Kit.Client(), sentAt+1)
+	require.NoError(t, err)
+	require.Equal(t, receipt.BlockNumber.Uint64()+1, fromBlock)
+
+	// A block range of one forces a query per block.
+	trace, err = TrackTransfer(ctx, env.Kit.Client(), receipt.TxHash, backends, 1)
+	require.NoError(t, err)
+	require.Equal(t, TransferPending, trace.Status)
+
+	_, err = TrackTransfer(ctx, env.Kit.Client(), receipt.TxHash, map[ids.ID]TrackerBackend{}, 0)
+	require.ErrorContains(t, err, "no backend for blockchain")
+
+	// Adding collateral is not a transfer.
+	imbalancedID, imbalancedAddress := ids.ID{2}, common.HexToAddress("0x02")
+	env.RegisterRemote(t, imbalancedID, imbalancedAddress, 18, big.NewInt(1_000))
+	opts, err := env.Kit.DeployerTransactor()
+	require.NoError(t, err)
+	tx, err := env.Home.AddCollateral(opts, imbalancedID, imbalancedAddress, big.NewInt(1_000))
+	require.NoError(t, err)
+	receipt, err = env.Kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	_, err = TrackTransfer(ctx, env.Kit.Client(), receipt.TxHash, backends, 0)
+	require.ErrorContains(t, err, "no TokensSent or TokensAndCallSent event")
+}
+
+func TestTrackTransferFollowExecution(t *testing.T) {
+	ctx := context.Background()
+	env := receiverTestUtils.NewTokenHomeTestEnv(t, 18)
+	homeBlockchainID, err := env.Home.GetBlockchainID(&bind.CallOpts{})
+	require.NoError(t, err)
+
+	sourceID, sourceAddress := ids.ID{1}, common.HexToAddress("0x01")
+	destinationID, destinationAddress := ids.ID{2}, common.HexToAddress("0x02")
+	env.RegisterRemote(t, sourceID, sourceAddress, 18, big.NewInt(0))
+	env.RegisterRemote(t, destinationID, destinationAddress, 18, big.NewInt(0))
+	env.Send(t, sourceID, sourceAddress, big.NewInt(10_000))
+
+	opts, err := env.Kit.DeployerTransactor()
+	require.NoError(t, err)
+	receiverAddress, tx, _, err := mockERC20SACR.DeployMockERC20SendAndCallReceiver(opts, env.Kit.Client())
+	require.NoError(t, err)
+	_, err = env.Kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	recipient := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	fallback := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	multiHopSend := func(destinationID ids.ID) *itokentransferrer.MultiHopSendMessage {
+		return &itokentransferrer.MultiHopSendMessage{
+			DestinationBlockchainID:            destinationID,
+			DestinationTokenTransferrerAddress: destinationAddress,
+			Recipient:                          recipient,
+			Amount:                             big.NewInt(600),
+			SecondaryFee:                       big.NewInt(100),
+			SecondaryGasLimit:                  big.NewInt(100_000),
+			MultiHopFallback:                   fallback,
+		}
+	}
+	singleHopCall := func(payload []byte) *itokentransferrer.SingleHopCallMessage {
+		return &itokentransferrer.SingleHopCallMessage{
+			SourceBlockchainID:            sourceID,
+			OriginTokenTransferrerAddress: sourceAddress,
+			OriginSenderAddress:           recipient,
+			RecipientContract:             receiverAddress,
+			Amount:                        big.NewInt(300),
+			RecipientPayload:              payload,
+			RecipientGasLimit:             big.NewInt(100_000),
+			FallbackRecipient:             fallback,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		messageType itokentransferrer.TransferrerMessageType
+		payload     itokentransferrer.Packer
+		status      TransferStatus
+		recipient   common.Address
+		amount      *big.Int
+	}{
+		{
+			name:        "single-hop send",
+			messageType: itokentransferrer.SingleHopSend,
+			payload:     &itokentransferrer.SingleHopSendMessage{Recipient: recipient, Amount: big.NewInt(200)},
+			status:      TransferWithdrawn,
+			recipient:   recipient,
+			amount:      big.NewInt(200),
+		},
+		{
+			name:        "call succeeded",
+			messageType: itokentransferrer.SingleHopCall,
+			payload:     singleHopCall([]byte{1}),
+			status:      TransferCallSucceeded,
+			recipient:   receiverAddress,
+			amount:      big.NewInt(300),
+		},
+		{
+			// The mock receiver reverts on an empty payload.
+			name:        "call failed",
+			messageType: itokentransferrer.SingleHopCall,
+			payload:     singleHopCall(nil),
+			status:      TransferCallFailed,
+			recipient:   fallback,
+			amount:      big.NewInt(300),
+		},
+		{
+			name:        "multi-hop fallback",
+			messageType: itokentransferrer.MultiHopSend,
+			payload:     multiHopSend(ids.ID{3}),
+			status:      TransferMultiHopFallback,
+			recipient:   fallback,
+			amount:      big.NewInt(600),
+		},
+		{
+			name:        "multi-hop routed",
+			messageType: itokentransferrer.MultiHopSend,
+			payload:     multiHopSend(destinationID),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := env.Deliver(t, sourceID, sourceAddress, tt.messageType, tt.payload)
+			receiverTestUtils.RequireDelivered(t, result)
+
+			trace := &TransferTrace{}
+			hop := &TransferHop{
+				DestinationBlockchainID: homeBlockchainID,
+				DestinationAddress:      env.HomeAddress,
+				MessageType:             tt.messageType,
+				fallbackRecipient:       fallback,
+			}
+			next, err := trace.followExecution(hop, result.Receipt)
+			require.NoError(t, err)
+			if tt.status != "" {
+				require.Nil(t, next)
+				require.Equal(t, tt.status, trace.Status)
+				require.True(t, trace.Complete())
+				require.Nil(t, trace.StuckAt())
+				require.Equal(t, tt.recipient, trace.Recipient)
+				require.Equal(t, tt.amount, trace.Amount)
+				return
+			}
+
+			// The TokenHome routes the transfer, less the secondary fee, in a second message.
+			require.NotNil(t, next)
+			require.Equal(t, big.NewInt(100), trace.SecondaryFee)
+			require.Equal(t, ids.ID(homeBlockchainID), next.SourceBlockchainID)
+			require.Equal(t, env.HomeAddress, next.SourceAddress)
+			require.Equal(t, destinationID, next.DestinationBlockchainID)
+			require.Equal(t, destinationAddress, next.DestinationAddress)
+			require.Equal(t, itokentransferrer.SingleHopSend, next.MessageType)
+			require.Equal(t, big.NewInt(500), next.Amount)
+			require.Equal(t, result.Receipt.TxHash, next.SendTxHash)
+		})
+	}
+
+	// A receipt without any of the transfer's outcomes is an error.
+	_, err = (&TransferTrace{}).followExecution(&TransferHop{DestinationAddress: env.HomeAddress}, &types.Receipt{})
+	require.Error(t, err)
+}
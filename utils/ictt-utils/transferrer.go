@@ -0,0 +1,115 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+
+	erc20tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/ERC20TokenHome"
+	nativetokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/NativeTokenHome"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	nativetokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/NativeTokenRemote"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// TransferrerKind identifies which of the four token transferrer contracts is deployed at an address.
+type TransferrerKind int
+
+const (
+	ERC20TokenHomeKind TransferrerKind = iota
+	NativeTokenHomeKind
+	ERC20TokenRemoteKind
+	NativeTokenRemoteKind
+)
+
+func (k TransferrerKind) String() string {
+	switch k {
+	case ERC20TokenHomeKind:
+		return "ERC20TokenHome"
+	case NativeTokenHomeKind:
+		return "NativeTokenHome"
+	case ERC20TokenRemoteKind:
+		return "ERC20TokenRemote"
+	case NativeTokenRemoteKind:
+		return "NativeTokenRemote"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the kind as its contract name.
+func (k TransferrerKind) MarshalText() ([]byte, error) {
+	if k < ERC20TokenHomeKind || k > NativeTokenRemoteKind {
+		return nil, errors.Errorf("invalid transferrer kind %d", int(k))
+	}
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a kind from its contract name.
+func (k *TransferrerKind) UnmarshalText(text []byte) error {
+	for kind := ERC20TokenHomeKind; kind <= NativeTokenRemoteKind; kind++ {
+		if string(text) == kind.String() {
+			*k = kind
+			return nil
+		}
+	}
+	return errors.Errorf("invalid transferrer kind %q", text)
+}
+
+// IsHome returns whether the transferrer is a TokenHome.
+func (k TransferrerKind) IsHome() bool {
+	return k == ERC20TokenHomeKind || k == NativeTokenHomeKind
+}
+
+// TransferrerType returns whether the transferrer holds an ERC20 or the native token.
+func (k TransferrerKind) TransferrerType() gasUtils.TransferrerType {
+	if k == NativeTokenHomeKind || k == NativeTokenRemoteKind {
+		return gasUtils.NativeTransferrer
+	}
+	return gasUtils.ERC20Transferrer
+}
+
+// DetectTransferrerKind returns the kind of token transferrer deployed at [address]. Each of the
+// four contracts, and their upgradeable versions, exposes the ERC-7201 storage location of its own
+// namespace, which none of the others implement.
+func DetectTransferrerKind(
+	ctx context.Context,
+	backend bind.ContractBackend,
+	address common.Address,
+) (TransferrerKind, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	nativeRemote, err := nativetokenremote.NewNativeTokenRemote(address, backend)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := nativeRemote.NATIVETOKENREMOTESTORAGELOCATION(opts); err == nil {
+		return NativeTokenRemoteKind, nil
+	}
+	erc20Remote, err := erc20tokenremote.NewERC20TokenRemote(address, backend)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := erc20Remote.ERC20TOKENREMOTESTORAGELOCATION(opts); err == nil {
+		return ERC20TokenRemoteKind, nil
+	}
+	nativeHome, err := nativetokenhome.NewNativeTokenHome(address, backend)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := nativeHome.NATIVETOKENHOMESTORAGELOCATION(opts); err == nil {
+		return NativeTokenHomeKind, nil
+	}
+	erc20Home, err := erc20tokenhome.NewERC20TokenHome(address, backend)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := erc20Home.ERC20TOKENHOMESTORAGELOCATION(opts); err == nil {
+		return ERC20TokenHomeKind, nil
+	}
+	return 0, errors.Errorf("no token transferrer found at %s", address.Hex())
+}
@@ -0,0 +1,77 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/pkg/errors"
+)
+
+// HeaderBackend is a chain whose latest block bounds a scan of its logs.
+type HeaderBackend interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// Backend is a chain whose logs are scanned.
+type Backend interface {
+	HeaderBackend
+	FilterLogs(ctx context.Context, query interfaces.FilterQuery) ([]types.Log, error)
+}
+
+// ForEachBlockRange calls [filter] with consecutive ranges of blocks, in ascending order, from
+// [fromBlock] to the latest block of [backend]. If [maxBlockRange] is non-zero, the ranges span at
+// most that many blocks, for RPC endpoints that limit eth_getLogs queries. Otherwise [filter] is
+// called once, with all the blocks.
+func ForEachBlockRange(
+	ctx context.Context,
+	backend HeaderBackend,
+	fromBlock uint64,
+	maxBlockRange uint64,
+	filter func(start, end uint64) error,
+) error {
+	latest, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to get latest block")
+	}
+	latestBlock := latest.Number.Uint64()
+	for start := fromBlock; start <= latestBlock; {
+		end := latestBlock
+		if maxBlockRange != 0 && latestBlock-start >= maxBlockRange {
+			end = start + maxBlockRange - 1
+		}
+		if err := filter(start, end); err != nil {
+			return err
+		}
+		start = end + 1
+	}
+	return nil
+}
+
+// FilterLogs returns the logs matching [query] from [fromBlock] to the latest block of [backend], in
+// the order they were emitted. The block range of [query] is ignored. See ForEachBlockRange for
+// [maxBlockRange].
+func FilterLogs(
+	ctx context.Context,
+	backend Backend,
+	query interfaces.FilterQuery,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) ([]types.Log, error) {
+	var logs []types.Log
+	err := ForEachBlockRange(ctx, backend, fromBlock, maxBlockRange, func(start, end uint64) error {
+		query.FromBlock = new(big.Int).SetUint64(start)
+		query.ToBlock = new(big.Int).SetUint64(end)
+		rangeLogs, err := backend.FilterLogs(ctx, query)
+		if err != nil {
+			return errors.Wrapf(err, "failed to filter logs in blocks %d-%d", start, end)
+		}
+		logs = append(logs, rangeLogs...)
+		return nil
+	})
+	return logs, err
+}
@@ -0,0 +1,87 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// rangeBackend serves a log in each block up to [latest], and records the block ranges queried.
+type rangeBackend struct {
+	latest  uint64
+	ranges  [][2]uint64
+	failing bool
+}
+
+func (b *rangeBackend) HeaderByNumber(context.Context, *big.Int) (*types.Header, error) {
+	return &types.Header{Number: new(big.Int).SetUint64(b.latest)}, nil
+}
+
+func (b *rangeBackend) FilterLogs(_ context.Context, query interfaces.FilterQuery) ([]types.Log, error) {
+	if b.failing {
+		return nil, fmt.Errorf("range too large")
+	}
+	start, end := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+	b.ranges = append(b.ranges, [2]uint64{start, end})
+	var logs []types.Log
+	for block := start; block <= end; block++ {
+		logs = append(logs, types.Log{Address: query.Addresses[0], BlockNumber: block})
+	}
+	return logs, nil
+}
+
+func TestFilterLogs(t *testing.T) {
+	ctx := context.Background()
+	query := interfaces.FilterQuery{Addresses: []common.Address{{1}}}
+	var tests = []struct {
+		name          string
+		fromBlock     uint64
+		maxBlockRange uint64
+		ranges        [][2]uint64
+	}{
+		{
+			name:   "single range",
+			ranges: [][2]uint64{{0, 10}},
+		},
+		{
+			name:          "bounded ranges",
+			fromBlock:     2,
+			maxBlockRange: 4,
+			ranges:        [][2]uint64{{2, 5}, {6, 9}, {10, 10}},
+		},
+		{
+			name:          "range larger than the chain",
+			fromBlock:     8,
+			maxBlockRange: 100,
+			ranges:        [][2]uint64{{8, 10}},
+		},
+		{
+			name:      "from block after the latest block",
+			fromBlock: 11,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &rangeBackend{latest: 10}
+			logs, err := FilterLogs(ctx, backend, query, tt.fromBlock, tt.maxBlockRange)
+			require.NoError(t, err)
+			require.Equal(t, tt.ranges, backend.ranges)
+			require.Len(t, logs, int(max(11, tt.fromBlock)-tt.fromBlock))
+			for i, log := range logs {
+				require.Equal(t, tt.fromBlock+uint64(i), log.BlockNumber)
+			}
+		})
+	}
+
+	_, err := FilterLogs(ctx, &rangeBackend{latest: 10, failing: true}, query, 0, 5)
+	require.ErrorContains(t, err, "failed to filter logs in blocks 0-4: range too large")
+}
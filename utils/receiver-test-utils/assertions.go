@@ -0,0 +1,37 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+// RequireDelivered fails the test if the delivery reverted.
+func RequireDelivered(t require.TestingT, result *DeliveryResult) {
+	require.True(t, result.Succeeded(), "message delivery reverted: %s", result.RevertReason)
+}
+
+// RequireDeliveryReverted fails the test if the delivery did not revert with a reason containing [reason].
+func RequireDeliveryReverted(t require.TestingT, result *DeliveryResult, reason string) {
+	require.False(t, result.Succeeded(), "expected message delivery to revert")
+	require.Contains(t, result.RevertReason, reason)
+}
+
+// RequireGasUsedAtMost fails the test if message execution used more than [requiredGasLimit] gas.
+func RequireGasUsedAtMost(t require.TestingT, result *DeliveryResult, requiredGasLimit uint64) {
+	require.LessOrEqual(t, result.ExecutionGasUsed, requiredGasLimit)
+}
+
+// RequireEvent fails the test if the delivery did not emit an event parsed by [parser], and returns the event.
+func RequireEvent[T any](t require.TestingT, result *DeliveryResult, parser func(log types.Log) (T, error)) T {
+	event, err := GetEventFromReceipt(result.Receipt, parser)
+	require.NoError(t, err)
+	return event
+}
+
+// RequireNoEvent fails the test if the delivery emitted an event parsed by [parser].
+func RequireNoEvent[T any](t require.TestingT, result *DeliveryResult, parser func(log types.Log) (T, error)) {
+	require.Empty(t, GetEventsFromReceipt(result.Receipt, parser))
+}
@@ -0,0 +1,292 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	teleporterUtils "github.com/ava-labs/icm-contracts/utils/teleporter-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/ethclient/simulated"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// ReceiverTestKit deploys Teleporter applications to a simulated backend and delivers crafted
+// messages to them by impersonating TeleporterMessenger. The impersonated messenger is an EOA
+// controlled by the kit, so applications see it as msg.sender exactly as they would see the real
+// TeleporterMessenger contract.
+//
+// Applications that take a TeleporterMessenger address directly should be deployed with
+// TeleporterMessengerAddress. Applications that extend TeleporterRegistryApp should be deployed
+// with TeleporterRegistryAddress, which resolves each registered version to its own impersonated messenger.
+type ReceiverTestKit struct {
+	Backend *simulated.Backend
+
+	// DeployerKey is funded at genesis and can be used to deploy and configure applications.
+	DeployerKey     *ecdsa.PrivateKey
+	DeployerAddress common.Address
+
+	// TeleporterRegistryAddress is the zero address unless the kit was created with NewRegistryReceiverTestKit.
+	TeleporterRegistryAddress common.Address
+	TeleporterRegistry        *teleporterregistry.TeleporterRegistry
+
+	messengerKeys      []*ecdsa.PrivateKey
+	messengerAddresses []common.Address
+}
+
+// DeliveryResult is the outcome of delivering a single message to an application.
+type DeliveryResult struct {
+	Receipt *types.Receipt
+	// ExecutionGasUsed is the gas used by receiveTeleporterMessage, excluding the intrinsic transaction gas.
+	// This is the value that should fit within a message's requiredGasLimit.
+	ExecutionGasUsed uint64
+	// RevertReason is populated with the decoded revert reason if the delivery failed.
+	RevertReason string
+}
+
+// Succeeded returns true if receiveTeleporterMessage executed without reverting.
+func (r *DeliveryResult) Succeeded() bool {
+	return r.Receipt.Status == types.ReceiptStatusSuccessful
+}
+
+// NewReceiverTestKit creates a kit with a single impersonated TeleporterMessenger.
+func NewReceiverTestKit() (*ReceiverTestKit, error) {
+	return newReceiverTestKit(1)
+}
+
+// NewRegistryReceiverTestKit creates a kit with a TeleporterRegistry that has [numVersions]
+// protocol versions registered. Version N resolves to an impersonated TeleporterMessenger, which
+// can be delivered from using DeliverMessageFromVersion.
+func NewRegistryReceiverTestKit(ctx context.Context, numVersions int) (*ReceiverTestKit, error) {
+	if numVersions < 1 {
+		return nil, errors.New("at least one Teleporter version is required")
+	}
+	kit, err := newReceiverTestKit(numVersions)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]teleporterregistry.ProtocolRegistryEntry, 0, numVersions)
+	for i, address := range kit.messengerAddresses {
+		entries = append(entries, teleporterregistry.ProtocolRegistryEntry{
+			Version:         big.NewInt(int64(i + 1)),
+			ProtocolAddress: address,
+		})
+	}
+	opts, err := kit.DeployerTransactor()
+	if err != nil {
+		return nil, err
+	}
+	registryAddress, tx, registry, err := teleporterregistry.DeployTeleporterRegistry(opts, kit.Client(), entries)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to deploy TeleporterRegistry")
+	}
+	if _, err := simulatedUtils.CommitAndCheckSuccess(ctx, kit.Backend, tx.Hash()); err != nil {
+		return nil, errors.Wrap(err, "failed to deploy TeleporterRegistry")
+	}
+	kit.TeleporterRegistryAddress = registryAddress
+	kit.TeleporterRegistry = registry
+	return kit, nil
+}
+
+func newReceiverTestKit(numMessengers int) (*ReceiverTestKit, error) {
+	deployerKey, deployerAddress, err := simulatedUtils.NewFundedKey()
+	if err != nil {
+		return nil, err
+	}
+	funded := []common.Address{deployerAddress}
+
+	kit := &ReceiverTestKit{
+		DeployerKey:     deployerKey,
+		DeployerAddress: deployerAddress,
+	}
+	for i := 0; i < numMessengers; i++ {
+		key, address, err := simulatedUtils.NewFundedKey()
+		if err != nil {
+			return nil, err
+		}
+		kit.messengerKeys = append(kit.messengerKeys, key)
+		kit.messengerAddresses = append(kit.messengerAddresses, address)
+		funded = append(funded, address)
+	}
+	kit.Backend = simulatedUtils.NewSimulatedBackend(funded...)
+	return kit, nil
+}
+
+// Close shuts down the simulated backend.
+func (k *ReceiverTestKit) Close() error {
+	return k.Backend.Close()
+}
+
+// Client returns a client of the simulated backend, suitable for use with generated contract bindings.
+func (k *ReceiverTestKit) Client() simulated.Client {
+	return k.Backend.Client()
+}
+
+// DeployerTransactor returns transaction options signed by the deployer key.
+func (k *ReceiverTestKit) DeployerTransactor() (*bind.TransactOpts, error) {
+	return simulatedUtils.NewTransactor(k.DeployerKey)
+}
+
+// Commit seals pending transactions, and returns an error if the given transaction reverted.
+// Use this after calling a generated Deploy or transact binding function.
+func (k *ReceiverTestKit) Commit(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	return simulatedUtils.CommitAndCheckSuccess(ctx, k.Backend, tx.Hash())
+}
+
+// TeleporterMessengerAddress returns the address of the impersonated TeleporterMessenger.
+// For kits created with NewRegistryReceiverTestKit, this is the address of the latest version.
+func (k *ReceiverTestKit) TeleporterMessengerAddress() common.Address {
+	return k.messengerAddresses[len(k.messengerAddresses)-1]
+}
+
+// TeleporterMessengerAddressForVersion returns the impersonated TeleporterMessenger registered at [version].
+func (k *ReceiverTestKit) TeleporterMessengerAddressForVersion(version uint64) (common.Address, error) {
+	if version == 0 || version > uint64(len(k.messengerAddresses)) {
+		return common.Address{}, fmt.Errorf("unknown Teleporter version %d", version)
+	}
+	return k.messengerAddresses[version-1], nil
+}
+
+// DeliverMessage calls receiveTeleporterMessage on [appAddress] from the latest impersonated
+// TeleporterMessenger. The call is given [requiredGasLimit] gas on top of the intrinsic transaction gas,
+// matching the gas that TeleporterMessenger forwards to the application.
+func (k *ReceiverTestKit) DeliverMessage(
+	ctx context.Context,
+	appAddress common.Address,
+	sourceBlockchainID ids.ID,
+	originSenderAddress common.Address,
+	message []byte,
+	requiredGasLimit uint64,
+) (*DeliveryResult, error) {
+	return k.DeliverMessageFromVersion(
+		ctx,
+		uint64(len(k.messengerAddresses)),
+		appAddress,
+		sourceBlockchainID,
+		originSenderAddress,
+		message,
+		requiredGasLimit,
+	)
+}
+
+// DeliverMessageFromVersion is the same as DeliverMessage, but delivers from the impersonated
+// TeleporterMessenger registered as [version] in the TeleporterRegistry.
+func (k *ReceiverTestKit) DeliverMessageFromVersion(
+	ctx context.Context,
+	version uint64,
+	appAddress common.Address,
+	sourceBlockchainID ids.ID,
+	originSenderAddress common.Address,
+	message []byte,
+	requiredGasLimit uint64,
+) (*DeliveryResult, error) {
+	messengerAddress, err := k.TeleporterMessengerAddressForVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	messengerKey := k.messengerKeys[version-1]
+
+	callData, err := teleporterUtils.PackReceiveTeleporterMessage(sourceBlockchainID, originSenderAddress, message)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack receiveTeleporterMessage call")
+	}
+	intrinsicGas, err := core.IntrinsicGas(callData, nil, false, simulatedUtils.ChainRules())
+	if err != nil {
+		return nil, err
+	}
+
+	client := k.Client()
+	nonce, err := client.NonceAt(ctx, messengerAddress, nil)
+	if err != nil {
+		return nil, err
+	}
+	gasTipCap, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	gasFeeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), gasTipCap)
+
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   simulatedUtils.SimulatedChainID,
+		Nonce:     nonce,
+		To:        &appAddress,
+		Gas:       intrinsicGas + requiredGasLimit,
+		GasFeeCap: gasFeeCap,
+		GasTipCap: gasTipCap,
+		Value:     common.Big0,
+		Data:      callData,
+	})
+	signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(simulatedUtils.SimulatedChainID), messengerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Simulate the call first to capture the revert reason, since receipts do not include it.
+	var revertReason string
+	_, callErr := client.CallContract(ctx, interfaces.CallMsg{
+		From: messengerAddress,
+		To:   &appAddress,
+		Gas:  requiredGasLimit + intrinsicGas,
+		Data: callData,
+	}, nil)
+	if callErr != nil {
+		revertReason = callErr.Error()
+	}
+
+	if err := client.SendTransaction(ctx, signedTx); err != nil {
+		return nil, errors.Wrap(err, "failed to send receiveTeleporterMessage transaction")
+	}
+	receipt, err := simulatedUtils.CommitAndGetReceipt(ctx, k.Backend, signedTx.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DeliveryResult{
+		Receipt:          receipt,
+		ExecutionGasUsed: receipt.GasUsed - intrinsicGas,
+	}
+	if !result.Succeeded() {
+		result.RevertReason = revertReason
+	}
+	return result, nil
+}
+
+// GetEventFromReceipt returns the first log in the receipt that is successfully parsed by [parser],
+// typically a generated binding's Parse<Event> method.
+func GetEventFromReceipt[T any](receipt *types.Receipt, parser func(log types.Log) (T, error)) (T, error) {
+	for _, log := range receipt.Logs {
+		event, err := parser(*log)
+		if err == nil {
+			return event, nil
+		}
+	}
+	return *new(T), fmt.Errorf("failed to find %T event in receipt logs", *new(T))
+}
+
+// GetEventsFromReceipt returns all logs in the receipt that are successfully parsed by [parser].
+func GetEventsFromReceipt[T any](receipt *types.Receipt, parser func(log types.Log) (T, error)) []T {
+	var events []T
+	for _, log := range receipt.Logs {
+		event, err := parser(*log)
+		if err == nil {
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,131 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	testmessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/tests/TestMessenger"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func packStringMessage(t *testing.T, message string) []byte {
+	stringTy, err := abi.NewType("string", "", nil)
+	require.NoError(t, err)
+	b, err := abi.Arguments{{Type: stringTy}}.Pack(message)
+	require.NoError(t, err)
+	return b
+}
+
+func deployTestMessenger(
+	t *testing.T,
+	kit *ReceiverTestKit,
+	minTeleporterVersion int64,
+) (common.Address, *testmessenger.TestMessenger) {
+	ctx := context.Background()
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	address, tx, messenger, err := testmessenger.DeployTestMessenger(
+		opts,
+		kit.Client(),
+		kit.TeleporterRegistryAddress,
+		kit.DeployerAddress,
+		big.NewInt(minTeleporterVersion),
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	return address, messenger
+}
+
+func TestDeliverMessage(t *testing.T) {
+	ctx := context.Background()
+	kit, err := NewRegistryReceiverTestKit(ctx, 2)
+	require.NoError(t, err)
+	defer kit.Close()
+
+	appAddress, app := deployTestMessenger(t, kit, 1)
+
+	sourceBlockchainID := ids.ID{1, 2, 3}
+	originSender := common.HexToAddress("0x0123456789abcdef0123456789abcdef01234567")
+	result, err := kit.DeliverMessage(
+		ctx,
+		appAddress,
+		sourceBlockchainID,
+		originSender,
+		packStringMessage(t, "hello"),
+		testmessenger.SendMessageRequiredGas.Uint64(),
+	)
+	require.NoError(t, err)
+	RequireDelivered(t, result)
+	RequireGasUsedAtMost(t, result, testmessenger.SendMessageRequiredGas.Uint64())
+
+	event := RequireEvent(t, result, app.ParseReceiveMessage)
+	require.Equal(t, sourceBlockchainID, ids.ID(event.SourceBlockchainID))
+	require.Equal(t, originSender, event.OriginSenderAddress)
+	require.Equal(t, "hello", event.Message)
+
+	sender, message, err := app.GetCurrentMessage(&bind.CallOpts{}, sourceBlockchainID)
+	require.NoError(t, err)
+	require.Equal(t, originSender, sender)
+	require.Equal(t, "hello", message)
+}
+
+func TestDeliverMessageInsufficientGas(t *testing.T) {
+	ctx := context.Background()
+	kit, err := NewRegistryReceiverTestKit(ctx, 1)
+	require.NoError(t, err)
+	defer kit.Close()
+
+	appAddress, app := deployTestMessenger(t, kit, 1)
+
+	result, err := kit.DeliverMessage(
+		ctx,
+		appAddress,
+		ids.ID{1},
+		common.Address{},
+		packStringMessage(t, "hello"),
+		5_000,
+	)
+	require.NoError(t, err)
+	require.False(t, result.Succeeded())
+	RequireNoEvent(t, result, app.ParseReceiveMessage)
+}
+
+func TestDeliverMessageRegistryChecks(t *testing.T) {
+	ctx := context.Background()
+	kit, err := NewRegistryReceiverTestKit(ctx, 2)
+	require.NoError(t, err)
+	defer kit.Close()
+
+	appAddress, app := deployTestMessenger(t, kit, 2)
+	message := packStringMessage(t, "hello")
+	gasLimit := testmessenger.SendMessageRequiredGas.Uint64()
+
+	// Version 1 is below the app's minimum Teleporter version.
+	result, err := kit.DeliverMessageFromVersion(ctx, 1, appAddress, ids.ID{1}, common.Address{}, message, gasLimit)
+	require.NoError(t, err)
+	RequireDeliveryReverted(t, result, "TeleporterRegistryApp: invalid Teleporter sender")
+
+	// Pausing the latest version blocks delivery from it.
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	tx, err := app.PauseTeleporterAddress(opts, kit.TeleporterMessengerAddress())
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	result, err = kit.DeliverMessage(ctx, appAddress, ids.ID{1}, common.Address{}, message, gasLimit)
+	require.NoError(t, err)
+	RequireDeliveryReverted(t, result, "TeleporterRegistryApp: Teleporter address paused")
+
+	_, err = kit.TeleporterMessengerAddressForVersion(3)
+	require.Error(t, err)
+}
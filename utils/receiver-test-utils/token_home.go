@@ -0,0 +1,146 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	erc20tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/ERC20TokenHome"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	exampleerc20decimals "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/mocks/ExampleERC20Decimals"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/stretchr/testify/require"
+)
+
+// TokenHomeTestEnv is an ERC20TokenHome on a simulated backend. Messages from TokenRemote instances
+// are delivered by the kit's impersonated TeleporterMessenger (version 1), and sends go through a
+// real TeleporterMessenger (version 2).
+type TokenHomeTestEnv struct {
+	Kit              *ReceiverTestKit
+	RegistryAddress  common.Address
+	MessengerAddress common.Address
+	Home             *erc20tokenhome.ERC20TokenHome
+	HomeAddress      common.Address
+	HomeDecimals     uint8
+}
+
+// NewTokenHomeTestEnv deploys an ERC20TokenHome of a token with [homeDecimals], which the kit's
+// deployer holds and has approved the TokenHome to spend. The backend is closed when the test ends.
+func NewTokenHomeTestEnv(t testing.TB, homeDecimals uint8) *TokenHomeTestEnv {
+	ctx := context.Background()
+	kit, err := NewReceiverTestKit()
+	require.NoError(t, err)
+	t.Cleanup(func() { kit.Close() })
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+
+	messengerAddress, tx, _, err := teleportermessenger.DeployTeleporterMessenger(opts, kit.Client())
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	registryAddress, tx, _, err := teleporterregistry.DeployTeleporterRegistry(
+		opts,
+		kit.Client(),
+		[]teleporterregistry.ProtocolRegistryEntry{
+			{Version: big.NewInt(1), ProtocolAddress: kit.TeleporterMessengerAddress()},
+			{Version: big.NewInt(2), ProtocolAddress: messengerAddress},
+		},
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	tokenAddress, tx, token, err := exampleerc20decimals.DeployExampleERC20Decimals(opts, kit.Client(), homeDecimals)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	homeAddress, tx, home, err := erc20tokenhome.DeployERC20TokenHome(
+		opts,
+		kit.Client(),
+		registryAddress,
+		kit.DeployerAddress,
+		big.NewInt(1),
+		tokenAddress,
+		homeDecimals,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	tx, err = token.Approve(opts, homeAddress, math.MaxBig256)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	return &TokenHomeTestEnv{
+		Kit:              kit,
+		RegistryAddress:  registryAddress,
+		MessengerAddress: messengerAddress,
+		Home:             home,
+		HomeAddress:      homeAddress,
+		HomeDecimals:     homeDecimals,
+	}
+}
+
+// Deliver delivers a transferrer message to the TokenHome from the TokenRemote at [remoteAddress].
+func (e *TokenHomeTestEnv) Deliver(
+	t require.TestingT,
+	remoteID ids.ID,
+	remoteAddress common.Address,
+	messageType itokentransferrer.TransferrerMessageType,
+	payload itokentransferrer.Packer,
+) *DeliveryResult {
+	message, err := itokentransferrer.PackTransferrerMessage(messageType, payload)
+	require.NoError(t, err)
+	result, err := e.Kit.DeliverMessage(context.Background(), e.HomeAddress, remoteID, remoteAddress, message, 500_000)
+	require.NoError(t, err)
+	return result
+}
+
+// RegisterRemote registers the TokenRemote at [remoteAddress] with the TokenHome.
+func (e *TokenHomeTestEnv) RegisterRemote(
+	t require.TestingT,
+	remoteID ids.ID,
+	remoteAddress common.Address,
+	remoteDecimals uint8,
+	initialReserveImbalance *big.Int,
+) {
+	result := e.Deliver(t, remoteID, remoteAddress, itokentransferrer.RegisterRemote,
+		&itokentransferrer.RegisterRemoteMessage{
+			InitialReserveImbalance: initialReserveImbalance,
+			HomeTokenDecimals:       e.HomeDecimals,
+			RemoteTokenDecimals:     remoteDecimals,
+		})
+	RequireDelivered(t, result)
+}
+
+// Send sends [amount] tokens from the kit's deployer to the deployer on the TokenRemote at
+// [remoteAddress], and returns the receipt of the send.
+func (e *TokenHomeTestEnv) Send(
+	t require.TestingT,
+	remoteID ids.ID,
+	remoteAddress common.Address,
+	amount *big.Int,
+) *types.Receipt {
+	opts, err := e.Kit.DeployerTransactor()
+	require.NoError(t, err)
+	tx, err := e.Home.Send(opts, erc20tokenhome.SendTokensInput{
+		DestinationBlockchainID:            remoteID,
+		DestinationTokenTransferrerAddress: remoteAddress,
+		Recipient:                          e.Kit.DeployerAddress,
+		PrimaryFee:                         big.NewInt(0),
+		SecondaryFee:                       big.NewInt(0),
+		RequiredGasLimit:                   big.NewInt(100_000),
+	}, amount)
+	require.NoError(t, err)
+	receipt, err := e.Kit.Commit(context.Background(), tx)
+	require.NoError(t, err)
+	return receipt
+}
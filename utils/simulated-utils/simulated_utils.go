@@ -0,0 +1,123 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/eth/ethconfig"
+	"github.com/ava-labs/subnet-evm/ethclient/simulated"
+	"github.com/ava-labs/subnet-evm/node"
+	"github.com/ava-labs/subnet-evm/params"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/nativeminter"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/warp"
+	subnetEvmUtils "github.com/ava-labs/subnet-evm/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SimulatedChainID is the EVM chain ID used by every simulated backend.
+var SimulatedChainID = big.NewInt(1337)
+
+// DefaultFundedBalance is the genesis balance allocated to each funded address (1,000,000 native tokens).
+var DefaultFundedBalance = new(big.Int).Mul(big.NewInt(1e18), big.NewInt(1_000_000))
+
+// NewSimulatedBackend creates an in-memory subnet-evm chain with all network upgrades active
+// at genesis and the Warp precompile enabled, so that the ICM contracts can be deployed to it.
+// Each of the provided addresses is funded with DefaultFundedBalance, and is an admin of the
+// NativeMinter precompile so that it can allow native token transferrers to mint.
+func NewSimulatedBackend(fundedAddresses ...common.Address) *simulated.Backend {
+	return NewSimulatedBackendWithAlloc(types.GenesisAlloc{}, fundedAddresses...)
+}
+
+// NewSimulatedBackendWithAlloc is the same as NewSimulatedBackend, but also allocates the accounts
+// of [alloc] at genesis, such as contracts with preset storage.
+func NewSimulatedBackendWithAlloc(alloc types.GenesisAlloc, fundedAddresses ...common.Address) *simulated.Backend {
+	for _, address := range fundedAddresses {
+		alloc[address] = types.Account{Balance: new(big.Int).Set(DefaultFundedBalance)}
+	}
+	return simulated.NewBackend(alloc, func(nodeConf *node.Config, ethConf *ethconfig.Config) {
+		withICMChainConfig(nodeConf, ethConf, fundedAddresses)
+	})
+}
+
+// The simulated backend starts its clock at the Unix epoch, so the default test chain
+// config would leave Durango (and therefore PUSH0) inactive. Activate all upgrades at genesis.
+func withICMChainConfig(_ *node.Config, ethConf *ethconfig.Config, nativeMinterAdmins []common.Address) {
+	chainConfig := ethConf.Genesis.Config
+	chainConfig.ShanghaiTime = subnetEvmUtils.NewUint64(0)
+	chainConfig.CancunTime = subnetEvmUtils.NewUint64(0)
+	chainConfig.DurangoTimestamp = subnetEvmUtils.NewUint64(0)
+	chainConfig.EtnaTimestamp = subnetEvmUtils.NewUint64(0)
+	// Use the transaction fee cap of Subnet-EVM nodes, which is above the fee of the keyless
+	// TeleporterMessenger deployment.
+	ethConf.RPCTxFeeCap = 100
+
+	// The genesis precompiles map is shared with the package level test config, so replace it
+	// rather than mutating it in place.
+	chainConfig.GenesisPrecompiles = params.Precompiles{
+		warp.ConfigKey:         warp.NewDefaultConfig(subnetEvmUtils.NewUint64(0)),
+		nativeminter.ConfigKey: nativeminter.NewConfig(subnetEvmUtils.NewUint64(0), nativeMinterAdmins, nil, nil, nil),
+	}
+}
+
+// NewFundedKey generates a new private key and returns it along with its address.
+// The address should be passed to NewSimulatedBackend to be funded at genesis.
+func NewFundedKey() (*ecdsa.PrivateKey, common.Address, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	return key, crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// NewTransactor returns transaction options signing with the given key for the simulated chain.
+func NewTransactor(key *ecdsa.PrivateKey) (*bind.TransactOpts, error) {
+	return bind.NewKeyedTransactorWithChainID(key, SimulatedChainID)
+}
+
+// CommitAndGetReceipt seals the pending transactions into an accepted block and
+// returns the receipt of the given transaction.
+func CommitAndGetReceipt(
+	ctx context.Context,
+	backend *simulated.Backend,
+	txHash common.Hash,
+) (*types.Receipt, error) {
+	backend.Commit(true)
+	receipt, err := backend.Client().TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipt for transaction %s: %w", txHash.Hex(), err)
+	}
+	return receipt, nil
+}
+
+// CommitAndCheckSuccess is the same as CommitAndGetReceipt, but returns an error
+// if the transaction reverted.
+func CommitAndCheckSuccess(
+	ctx context.Context,
+	backend *simulated.Backend,
+	txHash common.Hash,
+) (*types.Receipt, error) {
+	receipt, err := CommitAndGetReceipt(ctx, backend, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, fmt.Errorf("transaction %s reverted", txHash.Hex())
+	}
+	return receipt, nil
+}
+
+// ChainRules returns the EVM rules in effect on a simulated backend.
+func ChainRules() params.Rules {
+	chainConfig := *params.TestChainConfig
+	withICMChainConfig(nil, &ethconfig.Config{Genesis: &core.Genesis{Config: &chainConfig}}, nil)
+	return chainConfig.Rules(common.Big0, 0)
+}
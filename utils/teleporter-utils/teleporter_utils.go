@@ -4,7 +4,9 @@
 package utils
 
 import (
+	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/ava-labs/avalanchego/ids"
 	"github.com/ava-labs/subnet-evm/accounts/abi"
@@ -12,16 +14,39 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
+// ITeleporterReceiverABI is the ABI of the ITeleporterReceiver interface implemented by all Teleporter applications.
+const ITeleporterReceiverABI = `[{"type":"function","name":"receiveTeleporterMessage","stateMutability":"nonpayable",` +
+	`"inputs":[{"name":"sourceBlockchainID","type":"bytes32"},{"name":"originSenderAddress","type":"address"},` +
+	`{"name":"message","type":"bytes"}],"outputs":[]}]`
+
 var (
 	uint256Ty abi.Type
 	bytes32Ty abi.Type
 	addressTy abi.Type
+
+	teleporterReceiverABI abi.ABI
 )
 
 func init() {
 	uint256Ty, _ = abi.NewType("uint256", "uint256", nil)
 	bytes32Ty, _ = abi.NewType("bytes32", "bytes32", nil)
 	addressTy, _ = abi.NewType("address", "address", nil)
+
+	var err error
+	teleporterReceiverABI, err = abi.JSON(strings.NewReader(ITeleporterReceiverABI))
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse ITeleporterReceiver ABI: %v", err))
+	}
+}
+
+// PackReceiveTeleporterMessage packs the input to form a call to the receiveTeleporterMessage function
+// of an ITeleporterReceiver, as made by TeleporterMessenger when delivering a message.
+func PackReceiveTeleporterMessage(
+	sourceBlockchainID ids.ID,
+	originSenderAddress common.Address,
+	message []byte,
+) ([]byte, error) {
+	return teleporterReceiverABI.Pack("receiveTeleporterMessage", sourceBlockchainID, originSenderAddress, message)
 }
 
 func CalculateMessageID(
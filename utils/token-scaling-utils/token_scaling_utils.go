@@ -0,0 +1,116 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"errors"
+	"math/big"
+)
+
+// MaxTokenDecimals mirrors TokenScalingUtils.MAX_TOKEN_DECIMALS. Token transferrers reject tokens
+// with more decimals than this.
+const MaxTokenDecimals = 18
+
+var (
+	// ErrAmountOverflow is returned when a result does not fit in a uint256, in which case the
+	// equivalent Solidity operation reverts.
+	ErrAmountOverflow = errors.New("amount overflows uint256")
+	// ErrNegativeAmount is returned for negative inputs, which cannot be represented as a uint256.
+	ErrNegativeAmount = errors.New("amount is negative")
+	// ErrZeroTokenMultiplier is returned for a zero token multiplier, in which case the equivalent
+	// Solidity division reverts.
+	ErrZeroTokenMultiplier = errors.New("token multiplier is zero")
+
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+)
+
+// ApplyTokenScale scales [homeTokenAmount] to a TokenRemote instance's token scale, matching
+// TokenScalingUtils.applyTokenScale. Token scale is applied when sending tokens from the TokenHome
+// to a TokenRemote instance.
+func ApplyTokenScale(
+	tokenMultiplier *big.Int,
+	multiplyOnRemote bool,
+	homeTokenAmount *big.Int,
+) (*big.Int, error) {
+	return scaleTokens(tokenMultiplier, multiplyOnRemote, homeTokenAmount, true)
+}
+
+// RemoveTokenScale removes a TokenRemote instance's token scale from [remoteTokenAmount], and returns
+// the corresponding amount of home tokens, matching TokenScalingUtils.removeTokenScale. Token scale is
+// removed when sending tokens from a TokenRemote instance back to the TokenHome.
+func RemoveTokenScale(
+	tokenMultiplier *big.Int,
+	multiplyOnRemote bool,
+	remoteTokenAmount *big.Int,
+) (*big.Int, error) {
+	return scaleTokens(tokenMultiplier, multiplyOnRemote, remoteTokenAmount, false)
+}
+
+// DeriveTokenMultiplierValues returns the token multiplier and whether amounts are multiplied on the
+// remote for the given home and remote token decimals, matching TokenScalingUtils.deriveTokenMultiplierValues.
+// Amounts are multiplied on the remote if the remote token has more decimals than the home token.
+func DeriveTokenMultiplierValues(homeTokenDecimals uint8, remoteTokenDecimals uint8) (*big.Int, bool, error) {
+	multiplyOnRemote := remoteTokenDecimals > homeTokenDecimals
+	var exponent uint8
+	if multiplyOnRemote {
+		exponent = remoteTokenDecimals - homeTokenDecimals
+	} else {
+		exponent = homeTokenDecimals - remoteTokenDecimals
+	}
+	tokenMultiplier := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+	if tokenMultiplier.Cmp(maxUint256) > 0 {
+		return nil, false, ErrAmountOverflow
+	}
+	return tokenMultiplier, multiplyOnRemote, nil
+}
+
+// CollateralNeeded returns the amount of home tokens that must be added as collateral for a TokenRemote
+// instance with [initialReserveImbalance], matching TokenHome's handling of a RegisterRemoteMessage.
+// If amounts are multiplied on the remote, partial home token units are rounded up so that the full
+// imbalance is collateralized.
+func CollateralNeeded(
+	tokenMultiplier *big.Int,
+	multiplyOnRemote bool,
+	initialReserveImbalance *big.Int,
+) (*big.Int, error) {
+	collateralNeeded, err := RemoveTokenScale(tokenMultiplier, multiplyOnRemote, initialReserveImbalance)
+	if err != nil {
+		return nil, err
+	}
+	if multiplyOnRemote && new(big.Int).Mod(initialReserveImbalance, tokenMultiplier).Sign() != 0 {
+		collateralNeeded.Add(collateralNeeded, big.NewInt(1))
+	}
+	return checkUint256(collateralNeeded)
+}
+
+func scaleTokens(
+	tokenMultiplier *big.Int,
+	multiplyOnRemote bool,
+	amount *big.Int,
+	isSendToRemote bool,
+) (*big.Int, error) {
+	if amount.Sign() < 0 || tokenMultiplier.Sign() < 0 {
+		return nil, ErrNegativeAmount
+	}
+	if amount.Cmp(maxUint256) > 0 || tokenMultiplier.Cmp(maxUint256) > 0 {
+		return nil, ErrAmountOverflow
+	}
+	// Multiply when multiplyOnRemote and isSendToRemote are
+	// both true or both false.
+	if multiplyOnRemote == isSendToRemote {
+		return checkUint256(new(big.Int).Mul(amount, tokenMultiplier))
+	}
+	// Otherwise divide, rounding down.
+	if tokenMultiplier.Sign() == 0 {
+		return nil, ErrZeroTokenMultiplier
+	}
+	return new(big.Int).Div(amount, tokenMultiplier), nil
+}
+
+func checkUint256(amount *big.Int) (*big.Int, error) {
+	if amount.Cmp(maxUint256) > 0 {
+		return nil, ErrAmountOverflow
+	}
+	return amount, nil
+}
@@ -0,0 +1,269 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	erc20tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/ERC20TokenHome"
+	itokentransferrer "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/interfaces/ITokenTransferrer"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveTokenMultiplierValues(t *testing.T) {
+	testCases := []struct {
+		homeDecimals       uint8
+		remoteDecimals     uint8
+		expectedMultiplier *big.Int
+		multiplyOnRemote   bool
+	}{
+		{homeDecimals: 18, remoteDecimals: 18, expectedMultiplier: big.NewInt(1), multiplyOnRemote: false},
+		{homeDecimals: 6, remoteDecimals: 18, expectedMultiplier: big.NewInt(1e12), multiplyOnRemote: true},
+		{homeDecimals: 18, remoteDecimals: 6, expectedMultiplier: big.NewInt(1e12), multiplyOnRemote: false},
+		{homeDecimals: 0, remoteDecimals: 18, expectedMultiplier: big.NewInt(1e18), multiplyOnRemote: true},
+	}
+	for _, testCase := range testCases {
+		tokenMultiplier, multiplyOnRemote, err := DeriveTokenMultiplierValues(
+			testCase.homeDecimals,
+			testCase.remoteDecimals,
+		)
+		require.NoError(t, err)
+		require.Equal(t, testCase.expectedMultiplier, tokenMultiplier)
+		require.Equal(t, testCase.multiplyOnRemote, multiplyOnRemote)
+	}
+
+	// 10**78 does not fit in a uint256, so the contract reverts.
+	_, _, err := DeriveTokenMultiplierValues(0, 78)
+	require.ErrorIs(t, err, ErrAmountOverflow)
+}
+
+func TestScaleTokens(t *testing.T) {
+	multiplier := big.NewInt(100)
+
+	amount, err := ApplyTokenScale(multiplier, true, big.NewInt(5))
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(500), amount)
+	amount, err = RemoveTokenScale(multiplier, true, big.NewInt(599))
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(5), amount)
+
+	// Dividing rounds down, so amounts below the multiplier scale to zero.
+	amount, err = ApplyTokenScale(multiplier, false, big.NewInt(99))
+	require.NoError(t, err)
+	require.Zero(t, amount.Sign())
+	amount, err = RemoveTokenScale(multiplier, false, big.NewInt(5))
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(500), amount)
+
+	_, err = ApplyTokenScale(multiplier, true, maxUint256)
+	require.ErrorIs(t, err, ErrAmountOverflow)
+	_, err = ApplyTokenScale(multiplier, true, big.NewInt(-1))
+	require.ErrorIs(t, err, ErrNegativeAmount)
+	_, err = RemoveTokenScale(big.NewInt(0), true, big.NewInt(1))
+	require.ErrorIs(t, err, ErrZeroTokenMultiplier)
+}
+
+func TestCollateralNeeded(t *testing.T) {
+	// Home tokens are divided on the remote, so the imbalance is multiplied back.
+	collateral, err := CollateralNeeded(big.NewInt(100), false, big.NewInt(7))
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(700), collateral)
+
+	// Partial home token units are rounded up.
+	collateral, err = CollateralNeeded(big.NewInt(100), true, big.NewInt(701))
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(8), collateral)
+	collateral, err = CollateralNeeded(big.NewInt(100), true, big.NewInt(700))
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(7), collateral)
+}
+
+// FuzzTokenScaleRoundTrip checks that scaling an amount to the remote and back, in either direction,
+// never creates value, and that the amount lost to rounding is less than one unit of the coarser token.
+func FuzzTokenScaleRoundTrip(f *testing.F) {
+	f.Add(uint8(18), uint8(6), []byte{0x01})
+	f.Add(uint8(6), uint8(18), []byte{0xff, 0xff, 0xff})
+	f.Add(uint8(18), uint8(0), []byte{0x0d, 0xe0, 0xb6, 0xb3, 0xa7, 0x63, 0xff, 0xff})
+	f.Add(uint8(9), uint8(9), []byte{0x2a})
+	f.Fuzz(func(t *testing.T, homeDecimals uint8, remoteDecimals uint8, amountBytes []byte) {
+		if len(amountBytes) > 32 {
+			amountBytes = amountBytes[:32]
+		}
+		homeDecimals %= MaxTokenDecimals + 1
+		remoteDecimals %= MaxTokenDecimals + 1
+		amount := new(big.Int).SetBytes(amountBytes)
+
+		tokenMultiplier, multiplyOnRemote, err := DeriveTokenMultiplierValues(homeDecimals, remoteDecimals)
+		require.NoError(t, err)
+
+		// Home to remote and back. Any dust is the home amount below one remote token unit.
+		remoteAmount, err := ApplyTokenScale(tokenMultiplier, multiplyOnRemote, amount)
+		if err == nil {
+			homeAmount, err := RemoveTokenScale(tokenMultiplier, multiplyOnRemote, remoteAmount)
+			require.NoError(t, err)
+			require.LessOrEqual(t, homeAmount.Cmp(amount), 0)
+			dust := new(big.Int).Sub(amount, homeAmount)
+			if multiplyOnRemote {
+				require.Zero(t, dust.Sign())
+			} else {
+				require.Zero(t, new(big.Int).Mod(amount, tokenMultiplier).Cmp(dust))
+			}
+		} else {
+			require.ErrorIs(t, err, ErrAmountOverflow)
+			require.True(t, multiplyOnRemote)
+		}
+
+		// Remote to home and back. Any dust is the remote amount below one home token unit.
+		homeAmount, err := RemoveTokenScale(tokenMultiplier, multiplyOnRemote, amount)
+		if err == nil {
+			remoteAmount, err := ApplyTokenScale(tokenMultiplier, multiplyOnRemote, homeAmount)
+			require.NoError(t, err)
+			require.LessOrEqual(t, remoteAmount.Cmp(amount), 0)
+			dust := new(big.Int).Sub(amount, remoteAmount)
+			if multiplyOnRemote {
+				require.Zero(t, new(big.Int).Mod(amount, tokenMultiplier).Cmp(dust))
+			} else {
+				require.Zero(t, dust.Sign())
+			}
+		} else {
+			require.ErrorIs(t, err, ErrAmountOverflow)
+			require.False(t, multiplyOnRemote)
+		}
+
+		// The collateral needed always covers the initial reserve imbalance, by less than one home token unit.
+		collateral, err := CollateralNeeded(tokenMultiplier, multiplyOnRemote, amount)
+		if err != nil {
+			return
+		}
+		covered, err := ApplyTokenScale(tokenMultiplier, multiplyOnRemote, collateral)
+		if err != nil {
+			return
+		}
+		require.GreaterOrEqual(t, covered.Cmp(amount), 0)
+		if multiplyOnRemote {
+			require.Negative(t, new(big.Int).Sub(covered, amount).Cmp(tokenMultiplier))
+		}
+	})
+}
+
+// TestDifferentialTokenHome compares the Go scaling functions with the amounts computed by a
+// deployed ERC20TokenHome when registering remotes, sending tokens to them and receiving tokens back.
+func TestDifferentialTokenHome(t *testing.T) {
+	ctx := context.Background()
+	amounts := []*big.Int{
+		big.NewInt(1),
+		big.NewInt(999_999),
+		big.NewInt(1_000_000_000_007),
+		big.NewInt(123_456_789_012_345_678),
+	}
+	recipient := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	for _, homeDecimals := range []uint8{6, 18} {
+		env := receiverTestUtils.NewTokenHomeTestEnv(t, homeDecimals)
+		for i, remoteDecimals := range []uint8{0, 6, 12, 18} {
+			remoteID := ids.ID{byte(i + 1)}
+			tokenMultiplier, multiplyOnRemote, err := DeriveTokenMultiplierValues(homeDecimals, remoteDecimals)
+			require.NoError(t, err)
+
+			// Register a remote with an initial reserve imbalance to check the collateral calculation.
+			imbalanceRemote := common.BigToAddress(big.NewInt(int64(2*i + 1)))
+			imbalance := big.NewInt(1_234_567_890_123)
+			result := env.Deliver(t, remoteID, imbalanceRemote, itokentransferrer.RegisterRemote,
+				&itokentransferrer.RegisterRemoteMessage{
+					InitialReserveImbalance: imbalance,
+					HomeTokenDecimals:       homeDecimals,
+					RemoteTokenDecimals:     remoteDecimals,
+				})
+			receiverTestUtils.RequireDelivered(t, result)
+			settings, err := env.Home.GetRemoteTokenTransferrerSettings(&bind.CallOpts{}, remoteID, imbalanceRemote)
+			require.NoError(t, err)
+			require.Equal(t, tokenMultiplier, settings.TokenMultiplier)
+			require.Equal(t, multiplyOnRemote, settings.MultiplyOnRemote)
+			expectedCollateral, err := CollateralNeeded(tokenMultiplier, multiplyOnRemote, imbalance)
+			require.NoError(t, err)
+			require.Equal(t, expectedCollateral, settings.CollateralNeeded)
+
+			// Register a collateralized remote to send tokens to and receive tokens from.
+			remoteAddress := common.BigToAddress(big.NewInt(int64(2*i + 2)))
+			result = env.Deliver(t, remoteID, remoteAddress, itokentransferrer.RegisterRemote,
+				&itokentransferrer.RegisterRemoteMessage{
+					InitialReserveImbalance: big.NewInt(0),
+					HomeTokenDecimals:       homeDecimals,
+					RemoteTokenDecimals:     remoteDecimals,
+				})
+			receiverTestUtils.RequireDelivered(t, result)
+
+			for _, amount := range amounts {
+				expectedScaled, err := ApplyTokenScale(tokenMultiplier, multiplyOnRemote, amount)
+				require.NoError(t, err)
+
+				opts, err := env.Kit.DeployerTransactor()
+				require.NoError(t, err)
+				input := erc20tokenhome.SendTokensInput{
+					DestinationBlockchainID:            remoteID,
+					DestinationTokenTransferrerAddress: remoteAddress,
+					Recipient:                          recipient,
+					PrimaryFeeTokenAddress:             common.Address{},
+					PrimaryFee:                         big.NewInt(0),
+					SecondaryFee:                       big.NewInt(0),
+					RequiredGasLimit:                   big.NewInt(100_000),
+				}
+				tx, err := env.Home.Send(opts, input, amount)
+				if expectedScaled.Sign() == 0 {
+					// Amounts below one remote token unit are rejected rather than lost as dust.
+					require.ErrorContains(t, err, "zero scaled amount")
+					continue
+				}
+				require.NoError(t, err)
+				receipt, err := env.Kit.Commit(ctx, tx)
+				require.NoError(t, err)
+				sent, err := receiverTestUtils.GetEventFromReceipt(receipt, env.Home.ParseTokensSent)
+				require.NoError(t, err)
+				require.Equal(t, expectedScaled, sent.Amount)
+
+				// Send the scaled amount back from the remote.
+				expectedHome, err := RemoveTokenScale(tokenMultiplier, multiplyOnRemote, sent.Amount)
+				require.NoError(t, err)
+				result := env.Deliver(t, remoteID, remoteAddress, itokentransferrer.SingleHopSend,
+					&itokentransferrer.SingleHopSendMessage{Recipient: recipient, Amount: sent.Amount})
+				receiverTestUtils.RequireDelivered(t, result)
+				withdrawn := receiverTestUtils.RequireEvent(t, result, env.Home.ParseTokensWithdrawn)
+				require.Equal(t, expectedHome, withdrawn.Amount)
+				require.LessOrEqual(t, withdrawn.Amount.Cmp(amount), 0)
+			}
+
+			// Remote amounts below one home token unit cannot be sent back.
+			if multiplyOnRemote {
+				dustAmount := new(big.Int).Sub(tokenMultiplier, big.NewInt(1))
+				homeAmount, err := RemoveTokenScale(tokenMultiplier, multiplyOnRemote, dustAmount)
+				require.NoError(t, err)
+				require.Zero(t, homeAmount.Sign())
+
+				// Give the remote a transferred balance to draw from first.
+				opts, err := env.Kit.DeployerTransactor()
+				require.NoError(t, err)
+				tx, err := env.Home.Send(opts, erc20tokenhome.SendTokensInput{
+					DestinationBlockchainID:            remoteID,
+					DestinationTokenTransferrerAddress: remoteAddress,
+					Recipient:                          recipient,
+					PrimaryFee:                         big.NewInt(0),
+					SecondaryFee:                       big.NewInt(0),
+					RequiredGasLimit:                   big.NewInt(100_000),
+				}, big.NewInt(1))
+				require.NoError(t, err)
+				_, err = env.Kit.Commit(ctx, tx)
+				require.NoError(t, err)
+
+				result := env.Deliver(t, remoteID, remoteAddress, itokentransferrer.SingleHopSend,
+					&itokentransferrer.SingleHopSendMessage{Recipient: recipient, Amount: dustAmount})
+				receiverTestUtils.RequireDeliveryReverted(t, result, "zero token amount")
+			}
+		}
+	}
+}
@@ -0,0 +1,409 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ava-labs/avalanchego/ids"
+	tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/TokenHome"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	logUtils "github.com/ava-labs/icm-contracts/utils/log-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// registryAppABI is the ABI of TokenHome, which has the functions and events of TeleporterRegistryApp
+// that manage the Teleporter versions an app accepts.
+var registryAppABI abi.ABI
+
+func init() {
+	parsed, err := tokenhome.TokenHomeMetaData.GetAbi()
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse TokenHome ABI: %v", err))
+	}
+	registryAppABI = *parsed
+}
+
+// App is a TeleporterRegistryApp of a topology: an app of the spec, or a deployed TokenHome or
+// TokenRemote.
+type App struct {
+	// Resource identifies the app, as "app/NAME", "ictt/NAME/home" or "ictt/NAME/remote/CHAIN".
+	Resource string
+	Chain    string
+	Address  common.Address
+}
+
+// AppStatus is the Teleporter versions an app accepts messages from.
+type AppStatus struct {
+	*App
+	MinVersion uint64
+	// Paused is the sorted Teleporter addresses the app does not accept messages from.
+	Paused []common.Address
+}
+
+// InFlightMessage is a message sent to an app by a TeleporterMessenger version that has not
+// delivered it yet.
+type InFlightMessage struct {
+	App         *App
+	SourceChain string
+	Version     uint64
+	Messenger   common.Address
+	MessageID   ids.ID
+}
+
+// Apps returns the apps of the spec, then the TokenHome and TokenRemote instances of the spec that
+// are deployed, from the spec or [state].
+func (t *Topology) Apps(state *State) []*App {
+	state.init()
+	var apps []*App
+	for _, app := range t.Spec.Apps {
+		apps = append(apps, &App{Resource: "app/" + app.Name, Chain: app.Chain, Address: app.Address})
+	}
+	for _, ictt := range t.Spec.ICTT {
+		if address := t.homeAddress(ictt, state); address != (common.Address{}) {
+			apps = append(apps, &App{Resource: "ictt/" + ictt.Name + "/home", Chain: ictt.Home.Chain, Address: address})
+		}
+		for _, remote := range ictt.Remotes {
+			deployment := state.TokenRemotes[ictt.Name+"/"+remote.Chain]
+			if deployment == nil || deployment.RemoteAddress == (common.Address{}) {
+				continue
+			}
+			apps = append(apps, &App{
+				Resource: "ictt/" + ictt.Name + "/remote/" + remote.Chain,
+				Chain:    remote.Chain,
+				Address:  deployment.RemoteAddress,
+			})
+		}
+	}
+	return apps
+}
+
+// AppStatuses reads the minimum Teleporter version and the paused Teleporter addresses of [apps].
+// The addresses are those of TeleporterAddressPaused events that isTeleporterAddressPaused
+// confirms are still paused, scanned from [fromBlock]. See logUtils.ForEachBlockRange for
+// [maxBlockRange].
+func (t *Topology) AppStatuses(
+	ctx context.Context,
+	apps []*App,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) ([]*AppStatus, error) {
+	if err := t.checkChains(false); err != nil {
+		return nil, err
+	}
+	statuses := make([]*AppStatus, len(apps))
+	for i, app := range apps {
+		backend := t.Chains[app.Chain].Backend
+		status := &AppStatus{App: app}
+		minVersion, err := callRegistryApp(ctx, backend, app, "getMinTeleporterVersion")
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get minimum Teleporter version of %s", app.Resource)
+		}
+		status.MinVersion = minVersion.(*big.Int).Uint64()
+
+		logs, err := logUtils.FilterLogs(ctx, backend, interfaces.FilterQuery{
+			Addresses: []common.Address{app.Address},
+			Topics: [][]common.Hash{{
+				registryAppABI.Events["TeleporterAddressPaused"].ID,
+				registryAppABI.Events["TeleporterAddressUnpaused"].ID,
+			}},
+		}, fromBlock, maxBlockRange)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get paused Teleporter addresses of %s", app.Resource)
+		}
+		candidates := make(map[common.Address]bool)
+		for _, log := range logs {
+			if len(log.Topics) == 2 {
+				candidates[common.BytesToAddress(log.Topics[1].Bytes())] = true
+			}
+		}
+		for address := range candidates {
+			paused, err := callRegistryApp(ctx, backend, app, "isTeleporterAddressPaused", address)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to check if %s is paused by %s", address.Hex(), app.Resource)
+			}
+			if paused.(bool) {
+				status.Paused = append(status.Paused, address)
+			}
+		}
+		sort.Slice(status.Paused, func(i, j int) bool {
+			return strings.Compare(status.Paused[i].Hex(), status.Paused[j].Hex()) < 0
+		})
+		statuses[i] = status
+	}
+	return statuses, nil
+}
+
+// SetTeleporterAddressPaused pauses or unpauses [teleporterAddress] on every app of [apps] that does
+// not have it in that state yet, such as a compromised TeleporterMessenger across a fleet, and
+// returns the apps that were changed. Running it again after a failure resumes where it stopped.
+func (t *Topology) SetTeleporterAddressPaused(
+	ctx context.Context,
+	apps []*App,
+	teleporterAddress common.Address,
+	paused bool,
+) ([]*App, error) {
+	if err := t.checkChains(true); err != nil {
+		return nil, err
+	}
+	method, event := "pauseTeleporterAddress", "TeleporterAddressPaused"
+	if !paused {
+		method, event = "unpauseTeleporterAddress", "TeleporterAddressUnpaused"
+	}
+	var changed []*App
+	for _, app := range apps {
+		chain := t.Chains[app.Chain]
+		current, err := callRegistryApp(ctx, chain.Backend, app, "isTeleporterAddressPaused", teleporterAddress)
+		if err != nil {
+			return changed, errors.Wrapf(err, "failed to check if %s is paused by %s", teleporterAddress.Hex(), app.Resource)
+		}
+		if current.(bool) == paused {
+			continue
+		}
+		receipt, err := transactRegistryApp(ctx, chain, app, method, teleporterAddress)
+		if err != nil {
+			return changed, err
+		}
+		if !hasAppEvent(receipt, app, event, common.BytesToHash(teleporterAddress.Bytes())) {
+			return changed, errors.Errorf("%s of %s did not emit %s", method, app.Resource, event)
+		}
+		changed = append(changed, app)
+	}
+	return changed, nil
+}
+
+// InFlightMessages returns the messages sent to [apps] by the TeleporterMessenger versions below
+// [version] of every chain's registry, from the spec or [state], that the messenger of the same
+// version on the app's chain has not received. Raising the minimum Teleporter version of an app to
+// [version] would make it reject them. The messages are scanned from [fromBlock] on every chain. See
+// logUtils.ForEachBlockRange for [maxBlockRange].
+func (t *Topology) InFlightMessages(
+	ctx context.Context,
+	state *State,
+	apps []*App,
+	version uint64,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) ([]*InFlightMessage, error) {
+	if err := t.checkChains(false); err != nil {
+		return nil, err
+	}
+	state.init()
+	registries := make(map[string]map[uint64]common.Address)
+	for _, chain := range t.Spec.Chains {
+		address := t.registryAddress(chain.Name, state)
+		if address == (common.Address{}) {
+			continue
+		}
+		registry, err := readRegistry(ctx, t.Chains[chain.Name], address)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read TeleporterRegistry on chain %q", chain.Name)
+		}
+		registries[chain.Name] = registry
+	}
+	// Messages are found by the blockchain ID and address they are sent to.
+	destinations := make(map[ids.ID]map[common.Address]*App)
+	var blockchainIDs [][32]byte
+	for _, app := range apps {
+		blockchainID, err := t.blockchainID(ctx, app.Chain)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := destinations[blockchainID]; !ok {
+			destinations[blockchainID] = make(map[common.Address]*App)
+			blockchainIDs = append(blockchainIDs, blockchainID)
+		}
+		destinations[blockchainID][app.Address] = app
+	}
+	if len(apps) == 0 {
+		return nil, nil
+	}
+
+	var inFlight []*InFlightMessage
+	// Message IDs commit to the source blockchain ID, so a message is only found once on distinct
+	// chains, but chains may share a backend.
+	found := make(map[ids.ID]bool)
+	for _, chain := range t.Spec.Chains {
+		registry := registries[chain.Name]
+		for _, sourceVersion := range sortedVersions(versionSet(registry)) {
+			if sourceVersion >= version {
+				continue
+			}
+			messenger, err := teleportermessenger.NewTeleporterMessenger(registry[sourceVersion], t.Chains[chain.Name].Backend)
+			if err != nil {
+				return nil, err
+			}
+			backend := t.Chains[chain.Name].Backend
+			err = logUtils.ForEachBlockRange(ctx, backend, fromBlock, maxBlockRange, func(start, end uint64) error {
+				events, err := messenger.FilterSendCrossChainMessage(
+					&bind.FilterOpts{Start: start, End: &end, Context: ctx}, nil, blockchainIDs,
+				)
+				if err != nil {
+					return err
+				}
+				defer events.Close()
+				for events.Next() {
+					event := events.Event
+					app, ok := destinations[ids.ID(event.DestinationBlockchainID)][event.Message.DestinationAddress]
+					if !ok || found[event.MessageID] {
+						continue
+					}
+					found[event.MessageID] = true
+					received, err := t.messageReceived(ctx, app.Chain, registries[app.Chain], sourceVersion,
+						registry[sourceVersion], event.MessageID)
+					if err != nil {
+						return err
+					}
+					if !received {
+						inFlight = append(inFlight, &InFlightMessage{
+							App:         app,
+							SourceChain: chain.Name,
+							Version:     sourceVersion,
+							Messenger:   registry[sourceVersion],
+							MessageID:   ids.ID(event.MessageID),
+						})
+					}
+				}
+				return events.Error()
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get messages sent by version %d on chain %q",
+					sourceVersion, chain.Name)
+			}
+		}
+	}
+	return inFlight, nil
+}
+
+// messageReceived returns whether the messenger of [version] on [chain], from the chain's
+// [registry] or [sourceMessenger] if it has none, received the message [messageID].
+func (t *Topology) messageReceived(
+	ctx context.Context,
+	chain string,
+	registry map[uint64]common.Address,
+	version uint64,
+	sourceMessenger common.Address,
+	messageID [32]byte,
+) (bool, error) {
+	address, ok := registry[version]
+	if !ok {
+		address = sourceMessenger
+	}
+	deployed, err := hasCode(ctx, t.Chains[chain], address)
+	if err != nil || !deployed {
+		return false, err
+	}
+	messenger, err := teleportermessenger.NewTeleporterMessenger(address, t.Chains[chain].Backend)
+	if err != nil {
+		return false, err
+	}
+	received, err := messenger.MessageReceived(&bind.CallOpts{Context: ctx}, messageID)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to check if message %s was received on chain %q",
+			ids.ID(messageID), chain)
+	}
+	return received, nil
+}
+
+// UpdateMinTeleporterVersion raises the minimum Teleporter version of every app of [apps] below
+// [version], and returns the apps that were changed. Unless [force] is set, nothing is changed if
+// messages from lower versions are in flight to the apps, and those messages are returned with an
+// error. See AppStatuses and InFlightMessages for [fromBlock] and [maxBlockRange].
+func (t *Topology) UpdateMinTeleporterVersion(
+	ctx context.Context,
+	state *State,
+	apps []*App,
+	version uint64,
+	force bool,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) ([]*App, []*InFlightMessage, error) {
+	if err := t.checkChains(true); err != nil {
+		return nil, nil, err
+	}
+	statuses, err := t.AppStatuses(ctx, apps, fromBlock, maxBlockRange)
+	if err != nil {
+		return nil, nil, err
+	}
+	var raised []*App
+	for _, status := range statuses {
+		if status.MinVersion < version {
+			raised = append(raised, status.App)
+		}
+	}
+	inFlight, err := t.InFlightMessages(ctx, state, raised, version, fromBlock, maxBlockRange)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(inFlight) > 0 && !force {
+		return nil, inFlight, errors.Errorf("%d messages from Teleporter versions below %d are in flight",
+			len(inFlight), version)
+	}
+
+	var changed []*App
+	for _, app := range raised {
+		receipt, err := transactRegistryApp(ctx, t.Chains[app.Chain], app, "updateMinTeleporterVersion",
+			new(big.Int).SetUint64(version))
+		if err != nil {
+			return changed, inFlight, err
+		}
+		if !hasAppEvent(receipt, app, "MinTeleporterVersionUpdated", common.BigToHash(new(big.Int).SetUint64(version))) {
+			return changed, inFlight, errors.Errorf("updateMinTeleporterVersion of %s did not emit "+
+				"MinTeleporterVersionUpdated", app.Resource)
+		}
+		changed = append(changed, app)
+	}
+	return changed, inFlight, nil
+}
+
+func callRegistryApp(
+	ctx context.Context,
+	backend Backend,
+	app *App,
+	method string,
+	params ...interface{},
+) (interface{}, error) {
+	contract := bind.NewBoundContract(app.Address, registryAppABI, backend, backend, backend)
+	var results []interface{}
+	if err := contract.Call(&bind.CallOpts{Context: ctx}, &results, method, params...); err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+func transactRegistryApp(
+	ctx context.Context,
+	chain *Chain,
+	app *App,
+	method string,
+	params ...interface{},
+) (*types.Receipt, error) {
+	contract := bind.NewBoundContract(app.Address, registryAppABI, chain.Backend, chain.Backend, chain.Backend)
+	receipt, err := transact(ctx, chain, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.Transact(opts, method, params...)
+	})
+	return receipt, errors.Wrapf(err, "failed to %s on %s", method, app.Resource)
+}
+
+// hasAppEvent returns whether [receipt] has the event [name] of [app], whose last indexed argument
+// is [topic].
+func hasAppEvent(receipt *types.Receipt, app *App, name string, topic common.Hash) bool {
+	id := registryAppABI.Events[name].ID
+	for _, log := range receipt.Logs {
+		if log.Address == app.Address && len(log.Topics) > 1 && log.Topics[0] == id &&
+			log.Topics[len(log.Topics)-1] == topic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	testmessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/tests/TestMessenger"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyApps(t *testing.T) {
+	ctx := context.Background()
+	env := newTopologyTestEnv(t)
+	opts := env.chains["home"].Sender.Opts
+	commit := func(tx *types.Transaction, err error) {
+		require.NoError(t, err)
+		_, err = env.kit.Commit(ctx, tx)
+		require.NoError(t, err)
+	}
+
+	// The real messenger is version 1, whose messages the apps stop accepting at version 2.
+	spec := env.spec()
+	spec.Teleporter = nil
+	entries := []*RegistryEntrySpec{
+		{Version: 1, ProtocolAddress: env.messengerAddress},
+		{Version: 2, ProtocolAddress: env.kit.TeleporterMessengerAddress()},
+	}
+	spec.Registries = []*RegistrySpec{{Chain: "home", Entries: entries}, {Chain: "remote", Entries: entries}}
+	spec.ICTT, spec.ValidatorSetSigs, spec.ValidatorManagers = nil, nil, nil
+	topology := NewTopology(spec, env.chains)
+	state := NewState()
+	_, err := topology.Apply(ctx, state)
+	require.NoError(t, err)
+	for _, chain := range []string{"home", "remote"} {
+		address, tx, _, err := testmessenger.DeployTestMessenger(opts, env.kit.Client(), state.Registries[chain],
+			env.kit.DeployerAddress, big.NewInt(1))
+		commit(tx, err)
+		spec.Apps = append(spec.Apps, &AppSpec{Name: chain + "-app", Chain: chain, Address: address})
+	}
+	require.NoError(t, spec.Validate())
+	apps := topology.Apps(state)
+	require.Len(t, apps, 2)
+	require.Equal(t, "app/home-app", apps[0].Resource)
+
+	// A compromised messenger is paused across the fleet once.
+	compromised := env.kit.TeleporterMessengerAddress()
+	changed, err := topology.SetTeleporterAddressPaused(ctx, apps, compromised, true)
+	require.NoError(t, err)
+	require.Equal(t, apps, changed)
+	changed, err = topology.SetTeleporterAddressPaused(ctx, apps, compromised, true)
+	require.NoError(t, err)
+	require.Empty(t, changed)
+	statuses, err := topology.AppStatuses(ctx, apps, 0, 1)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		require.Equal(t, uint64(1), status.MinVersion)
+		require.Equal(t, []common.Address{compromised}, status.Paused)
+	}
+	// Pauses before the scanned blocks are not found.
+	latest, err := env.kit.Client().HeaderByNumber(ctx, nil)
+	require.NoError(t, err)
+	statuses, err = topology.AppStatuses(ctx, apps, latest.Number.Uint64()+1, 0)
+	require.NoError(t, err)
+	require.Empty(t, statuses[0].Paused)
+	changed, err = topology.SetTeleporterAddressPaused(ctx, apps[1:], compromised, false)
+	require.NoError(t, err)
+	require.Equal(t, apps[1:], changed)
+	statuses, err = topology.AppStatuses(ctx, apps, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{compromised}, statuses[0].Paused)
+	require.Empty(t, statuses[1].Paused)
+
+	// A message sent to the remote app by version 1 has not been delivered.
+	messenger, err := teleportermessenger.NewTeleporterMessenger(env.messengerAddress, env.kit.Client())
+	require.NoError(t, err)
+	commit(messenger.SendCrossChainMessage(opts, teleportermessenger.TeleporterMessageInput{
+		DestinationBlockchainID: ids.ID{8},
+		DestinationAddress:      apps[1].Address,
+		FeeInfo:                 teleportermessenger.TeleporterFeeInfo{Amount: big.NewInt(0)},
+		RequiredGasLimit:        big.NewInt(100_000),
+		AllowedRelayerAddresses: []common.Address{},
+		Message:                 []byte("in flight"),
+	}))
+	inFlight, err := topology.InFlightMessages(ctx, state, apps, 2, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, inFlight, 1)
+	require.Equal(t, apps[1], inFlight[0].App)
+	require.Equal(t, "home", inFlight[0].SourceChain)
+	require.Equal(t, uint64(1), inFlight[0].Version)
+	inFlight, err = topology.InFlightMessages(ctx, state, apps, 1, 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, inFlight)
+	latest, err = env.kit.Client().HeaderByNumber(ctx, nil)
+	require.NoError(t, err)
+	inFlight, err = topology.InFlightMessages(ctx, state, apps, 2, latest.Number.Uint64()+1, 0)
+	require.NoError(t, err)
+	require.Empty(t, inFlight)
+
+	// Raising the minimum version is refused while the message is in flight, unless forced.
+	changed, inFlight, err = topology.UpdateMinTeleporterVersion(ctx, state, apps, 2, false, 0, 0)
+	require.ErrorContains(t, err, "1 messages from Teleporter versions below 2 are in flight")
+	require.Empty(t, changed)
+	require.Len(t, inFlight, 1)
+	changed, _, err = topology.UpdateMinTeleporterVersion(ctx, state, apps, 2, true, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, apps, changed)
+	statuses, err = topology.AppStatuses(ctx, apps, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), statuses[1].MinVersion)
+
+	// Apps already at the version are skipped, so nothing is in flight to them.
+	changed, inFlight, err = topology.UpdateMinTeleporterVersion(ctx, state, apps, 2, false, 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, changed)
+	require.Empty(t, inFlight)
+
+	spec.Apps[0].Address = common.Address{}
+	require.ErrorContains(t, spec.Validate(), "app \"home-app\": address is required")
+}
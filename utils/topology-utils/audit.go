@@ -0,0 +1,298 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ava-labs/avalanchego/ids"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	logUtils "github.com/ava-labs/icm-contracts/utils/log-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// registryVersionNotFound is the revert reason of a TeleporterRegistry version that is not registered.
+const registryVersionNotFound = "version not found"
+
+// Drift is a check of Topology.Audit that failed on a chain.
+type Drift struct {
+	Chain    string
+	Check    string
+	Expected string
+	Actual   string
+}
+
+// Audit is the result of Topology.Audit. The expected TeleporterMessenger code and TeleporterRegistry
+// versions are those of most chains.
+type Audit struct {
+	CodeHash common.Hash
+	Registry map[uint64]common.Address
+	Drift    []*Drift
+}
+
+// chainAudit is what Audit reads from a chain.
+type chainAudit struct {
+	name            string
+	codeHash        common.Hash
+	registryAddress common.Address
+	// registry is nil if there is no TeleporterRegistry at registryAddress.
+	registry map[uint64]common.Address
+	drift    []*Drift
+}
+
+func (c *chainAudit) add(check, expected, actual string) {
+	c.drift = append(c.drift, &Drift{Chain: c.name, Check: check, Expected: expected, Actual: actual})
+}
+
+// Audit checks that every chain of the spec has the spec's TeleporterMessenger with the same code,
+// that the messenger's initializeBlockchainID was called with the blockchain ID of the chain's Warp
+// precompile, which emitted the same ID in BlockchainIDInitialized, and that the TeleporterRegistry
+// of every chain, from the spec or [state], maps the same versions to the same addresses. The
+// BlockchainIDInitialized events are scanned from [fromBlock] on every chain. See
+// logUtils.ForEachBlockRange for [maxBlockRange].
+func (t *Topology) Audit(ctx context.Context, state *State, fromBlock uint64, maxBlockRange uint64) (*Audit, error) {
+	if err := t.checkChains(false); err != nil {
+		return nil, err
+	}
+	if t.Spec.Teleporter == nil {
+		return nil, errors.New("spec has no teleporter to audit")
+	}
+	state.init()
+	messengerAddress := t.Spec.Teleporter.MessengerAddress
+
+	chains := make([]*chainAudit, len(t.Spec.Chains))
+	codeHashes := make([]string, len(t.Spec.Chains))
+	registries := make([]string, len(t.Spec.Chains))
+	for i, spec := range t.Spec.Chains {
+		chain := &chainAudit{name: spec.Name}
+		chains[i] = chain
+		code, err := t.Chains[spec.Name].Backend.CodeAt(ctx, messengerAddress, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get code of TeleporterMessenger on chain %q", spec.Name)
+		}
+		if len(code) > 0 {
+			chain.codeHash = crypto.Keccak256Hash(code)
+			codeHashes[i] = chain.codeHash.Hex()
+		}
+		chain.registryAddress = t.registryAddress(spec.Name, state)
+		if chain.registryAddress == (common.Address{}) {
+			continue
+		}
+		if chain.registry, err = readRegistry(ctx, t.Chains[spec.Name], chain.registryAddress); err != nil {
+			return nil, errors.Wrapf(err, "failed to read TeleporterRegistry on chain %q", spec.Name)
+		}
+		if chain.registry != nil {
+			registries[i] = formatRegistry(chain.registry)
+		}
+	}
+
+	audit := &Audit{}
+	if hash := majority(codeHashes); hash != "" {
+		audit.CodeHash = common.HexToHash(hash)
+	}
+	if registry := majority(registries); registry != "" {
+		for i := range registries {
+			if registries[i] == registry {
+				audit.Registry = chains[i].registry
+				break
+			}
+		}
+	}
+	for _, chain := range chains {
+		if err := t.auditMessenger(ctx, audit, chain, fromBlock, maxBlockRange); err != nil {
+			return nil, err
+		}
+		if audit.Registry != nil || chain.registryAddress != (common.Address{}) {
+			auditRegistry(audit, chain)
+		}
+		audit.Drift = append(audit.Drift, chain.drift...)
+	}
+	return audit, nil
+}
+
+// auditMessenger checks the TeleporterMessenger of [chain] has the expected code, and that its
+// blockchain ID was initialized to the chain's.
+func (t *Topology) auditMessenger(
+	ctx context.Context,
+	audit *Audit,
+	chain *chainAudit,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) error {
+	if chain.codeHash == (common.Hash{}) {
+		expected := "TeleporterMessenger"
+		if audit.CodeHash != (common.Hash{}) {
+			expected = audit.CodeHash.Hex()
+		}
+		chain.add("messenger code", expected, "no contract")
+		return nil
+	}
+	if chain.codeHash != audit.CodeHash {
+		// The blockchain ID of a different contract can't be checked.
+		chain.add("messenger code", audit.CodeHash.Hex(), chain.codeHash.Hex())
+		return nil
+	}
+
+	blockchainID, err := warpBlockchainID(ctx, t.Chains[chain.name], chain.name)
+	if err != nil {
+		return err
+	}
+	if specID := t.Spec.chain(chain.name).BlockchainID; specID != (ids.ID{}) && specID != blockchainID {
+		chain.add("spec blockchain ID", blockchainID.String(), specID.String())
+	}
+	messenger, err := teleportermessenger.NewTeleporterMessenger(t.Spec.Teleporter.MessengerAddress,
+		t.Chains[chain.name].Backend)
+	if err != nil {
+		return err
+	}
+	initializedID, err := messenger.BlockchainID(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get blockchain ID of TeleporterMessenger on chain %q", chain.name)
+	}
+	if initializedID == (ids.ID{}) {
+		chain.add("initializeBlockchainID", "called", "not called")
+		return nil
+	}
+	if initializedID != blockchainID {
+		chain.add("blockchainID()", blockchainID.String(), ids.ID(initializedID).String())
+	}
+
+	emitted := false
+	backend := t.Chains[chain.name].Backend
+	err = logUtils.ForEachBlockRange(ctx, backend, fromBlock, maxBlockRange, func(start, end uint64) error {
+		events, err := messenger.FilterBlockchainIDInitialized(
+			&bind.FilterOpts{Start: start, End: &end, Context: ctx}, nil,
+		)
+		if err != nil {
+			return err
+		}
+		defer events.Close()
+		for events.Next() {
+			emitted = true
+			if eventID := ids.ID(events.Event.BlockchainID); eventID != blockchainID {
+				chain.add("BlockchainIDInitialized", blockchainID.String(), eventID.String())
+			}
+		}
+		return events.Error()
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get BlockchainIDInitialized events on chain %q", chain.name)
+	}
+	if !emitted {
+		chain.add("BlockchainIDInitialized", blockchainID.String(), "no event")
+	}
+	return nil
+}
+
+// auditRegistry checks that the TeleporterRegistry of [chain] has the expected versions.
+func auditRegistry(audit *Audit, chain *chainAudit) {
+	if chain.registryAddress == (common.Address{}) {
+		chain.add("registry", "TeleporterRegistry", "none")
+		return
+	}
+	if chain.registry == nil {
+		chain.add("registry", "TeleporterRegistry at "+chain.registryAddress.Hex(), "no contract")
+		return
+	}
+	versions := make(map[uint64]bool)
+	for version := range audit.Registry {
+		versions[version] = true
+	}
+	for version := range chain.registry {
+		versions[version] = true
+	}
+	for _, version := range sortedVersions(versions) {
+		expected, actual := "none", "none"
+		if address, ok := audit.Registry[version]; ok {
+			expected = address.Hex()
+		}
+		if address, ok := chain.registry[version]; ok {
+			actual = address.Hex()
+		}
+		if expected != actual {
+			chain.add(fmt.Sprintf("registry version %d", version), expected, actual)
+		}
+	}
+}
+
+// readRegistry returns the addresses of the versions registered in the TeleporterRegistry at
+// [address], which is nil if there is no contract at [address].
+func readRegistry(ctx context.Context, chain *Chain, address common.Address) (map[uint64]common.Address, error) {
+	deployed, err := hasCode(ctx, chain, address)
+	if err != nil || !deployed {
+		return nil, err
+	}
+	registry, err := teleporterregistry.NewTeleporterRegistry(address, chain.Backend)
+	if err != nil {
+		return nil, err
+	}
+	callOpts := &bind.CallOpts{Context: ctx}
+	latest, err := registry.LatestVersion(callOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get latest version")
+	}
+	// Versions may be skipped, up to the registry's maximum version increment.
+	versions := make(map[uint64]common.Address)
+	for version := uint64(1); version <= latest.Uint64(); version++ {
+		protocolAddress, err := registry.GetAddressFromVersion(callOpts, new(big.Int).SetUint64(version))
+		if err != nil {
+			if strings.Contains(err.Error(), registryVersionNotFound) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to get address of version %d", version)
+		}
+		versions[version] = protocolAddress
+	}
+	return versions, nil
+}
+
+func formatRegistry(registry map[uint64]common.Address) string {
+	entries := make([]string, 0, len(registry))
+	for _, version := range sortedVersions(versionSet(registry)) {
+		entries = append(entries, fmt.Sprintf("%d=%s", version, registry[version].Hex()))
+	}
+	// An empty registry is still a registry.
+	return "registry:" + strings.Join(entries, ",")
+}
+
+func versionSet(registry map[uint64]common.Address) map[uint64]bool {
+	versions := make(map[uint64]bool)
+	for version := range registry {
+		versions[version] = true
+	}
+	return versions
+}
+
+func sortedVersions(versions map[uint64]bool) []uint64 {
+	sorted := make([]uint64, 0, len(versions))
+	for version := range versions {
+		sorted = append(sorted, version)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// majority returns the most common of the non-empty [values], preferring the first on a tie.
+func majority(values []string) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		counts[value]++
+		if best == "" || counts[value] > counts[best] {
+			best = value
+		}
+	}
+	return best
+}
@@ -0,0 +1,114 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyAudit(t *testing.T) {
+	ctx := context.Background()
+	key, address, err := simulatedUtils.NewFundedKey()
+	require.NoError(t, err)
+	opts, err := simulatedUtils.NewTransactor(key)
+	require.NoError(t, err)
+	messengerAddress := crypto.CreateAddress(address, 0)
+
+	// Each chain is a separate backend, on which the same key deploys the messenger first, so that
+	// it is at the same address on every chain.
+	chains := make(map[string]*Chain)
+	spec := &Spec{Teleporter: &TeleporterSpec{MessengerAddress: messengerAddress, Version: 1}}
+	type committer func(tx *types.Transaction, err error) common.Address
+	newChain := func(name string, deploy func(backend bind.ContractBackend, commit committer),
+		registryEntries ...teleporterregistry.ProtocolRegistryEntry) {
+		backend := simulatedUtils.NewSimulatedBackend(address)
+		t.Cleanup(func() { backend.Close() })
+		commit := func(tx *types.Transaction, err error) common.Address {
+			require.NoError(t, err)
+			receipt, err := simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+			require.NoError(t, err)
+			return receipt.ContractAddress
+		}
+		deploy(backend.Client(), commit)
+		registryAddress := commit(func() (*types.Transaction, error) {
+			_, tx, _, err := teleporterregistry.DeployTeleporterRegistry(opts, backend.Client(), registryEntries)
+			return tx, err
+		}())
+		chains[name] = &Chain{Backend: backend.Client()}
+		spec.Chains = append(spec.Chains, &ChainSpec{Name: name})
+		spec.Registries = append(spec.Registries, &RegistrySpec{Chain: name, Address: registryAddress})
+	}
+	deployMessenger := func(initialize bool) func(backend bind.ContractBackend, commit committer) {
+		return func(backend bind.ContractBackend, commit committer) {
+			_, tx, messenger, err := teleportermessenger.DeployTeleporterMessenger(opts, backend)
+			commit(tx, err)
+			if initialize {
+				commit(messenger.InitializeBlockchainID(opts))
+			}
+		}
+	}
+	version1 := teleporterregistry.ProtocolRegistryEntry{Version: big.NewInt(1), ProtocolAddress: messengerAddress}
+	newChain("a", deployMessenger(true), version1)
+	newChain("b", deployMessenger(false), version1)
+	newChain("c", func(backend bind.ContractBackend, commit committer) {
+		_, tx, _, err := exampleerc20.DeployExampleERC20(opts, backend)
+		commit(tx, err)
+	}, version1, teleporterregistry.ProtocolRegistryEntry{Version: big.NewInt(3), ProtocolAddress: common.Address{3}})
+	blockchainID, err := warpBlockchainID(ctx, chains["a"], "a")
+	require.NoError(t, err)
+	spec.Chains[0].BlockchainID = ids.ID{9}
+	require.NoError(t, spec.Validate())
+
+	audit, err := NewTopology(spec, chains).Audit(ctx, NewState(), 0, 1)
+	require.NoError(t, err)
+	code, err := chains["a"].Backend.CodeAt(ctx, messengerAddress, nil)
+	require.NoError(t, err)
+	require.Equal(t, crypto.Keccak256Hash(code), audit.CodeHash)
+	require.Equal(t, map[uint64]common.Address{1: messengerAddress}, audit.Registry)
+	tokenCode, err := chains["c"].Backend.CodeAt(ctx, messengerAddress, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*Drift{
+		{Chain: "a", Check: "spec blockchain ID", Expected: blockchainID.String(), Actual: ids.ID{9}.String()},
+		{Chain: "b", Check: "initializeBlockchainID", Expected: "called", Actual: "not called"},
+		{
+			Chain:    "c",
+			Check:    "messenger code",
+			Expected: audit.CodeHash.Hex(),
+			Actual:   crypto.Keccak256Hash(tokenCode).Hex(),
+		},
+		{Chain: "c", Check: "registry version 3", Expected: "none", Actual: common.Address{3}.Hex()},
+	}, audit.Drift)
+
+	// BlockchainIDInitialized is not found if it was emitted before the scanned blocks.
+	latest, err := chains["a"].Backend.HeaderByNumber(ctx, nil)
+	require.NoError(t, err)
+	audit, err = NewTopology(spec, chains).Audit(ctx, NewState(), latest.Number.Uint64()+1, 0)
+	require.NoError(t, err)
+	require.Contains(t, audit.Drift,
+		&Drift{Chain: "a", Check: "BlockchainIDInitialized", Expected: blockchainID.String(), Actual: "no event"})
+
+	// A chain without a registry drifts from the others.
+	spec.Registries = spec.Registries[:2]
+	audit, err = NewTopology(spec, chains).Audit(ctx, NewState(), 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, &Drift{Chain: "c", Check: "registry", Expected: "TeleporterRegistry", Actual: "none"},
+		audit.Drift[len(audit.Drift)-1])
+
+	spec.Teleporter = nil
+	_, err = NewTopology(spec, chains).Audit(ctx, NewState(), 0, 0)
+	require.ErrorContains(t, err, "spec has no teleporter to audit")
+}
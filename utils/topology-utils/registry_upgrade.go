@@ -0,0 +1,334 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	avalancheWarp "github.com/ava-labs/avalanchego/vms/platformvm/warp"
+	"github.com/ava-labs/avalanchego/vms/platformvm/warp/payload"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	gasUtils "github.com/ava-labs/icm-contracts/utils/gas-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/warp"
+	predicateutils "github.com/ava-labs/subnet-evm/predicate"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	// OffChainMessagesKey is the chain config key of the off-chain Warp messages a node serves and signs.
+	OffChainMessagesKey = "warp-off-chain-messages"
+	// DefaultRegistryQuorumNum is the percentage of the chain's stake that must sign a registry message.
+	DefaultRegistryQuorumNum uint64 = 67
+
+	addProtocolVersionGasLimit uint64 = 500_000
+)
+
+// WarpClient is the Warp API of a chain's node. subnet-evm's warp.Client implements it.
+type WarpClient interface {
+	GetMessage(ctx context.Context, messageID ids.ID) ([]byte, error)
+	GetMessageAggregateSignature(
+		ctx context.Context,
+		messageID ids.ID,
+		quorumNum uint64,
+		subnetIDStr string,
+	) ([]byte, error)
+}
+
+// RegistryMessage is the off-chain Warp message that adds a version to the TeleporterRegistry of a
+// chain. Its nodes serve and sign it once it is in the chain config under OffChainMessagesKey.
+type RegistryMessage struct {
+	Chain    string
+	Registry common.Address
+	Entry    *RegistryEntrySpec
+	Message  *avalancheWarp.UnsignedMessage
+	// Registered is whether the registry already maps the entry's version to its address.
+	Registered bool
+	// Live is whether the chain's node serves the message, as of the last CheckRegistryMessages.
+	Live bool
+}
+
+// NewRegistryMessage creates the off-chain Warp message of the chain [blockchainID] that adds [entry]
+// to the TeleporterRegistry at [registry]. Its source address is empty, as the registry requires.
+func NewRegistryMessage(
+	networkID uint32,
+	blockchainID ids.ID,
+	registry common.Address,
+	entry *RegistryEntrySpec,
+) (*avalancheWarp.UnsignedMessage, error) {
+	payloadBytes, err := teleporterregistry.PackTeleporterRegistryWarpPayload(
+		teleporterregistry.ProtocolRegistryEntry{
+			Version:         new(big.Int).SetUint64(entry.Version),
+			ProtocolAddress: entry.ProtocolAddress,
+		},
+		registry,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack registry payload")
+	}
+	addressedCall, err := payload.NewAddressedCall([]byte{}, payloadBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create addressed call")
+	}
+	return avalancheWarp.NewUnsignedMessage(networkID, blockchainID, addressedCall.Bytes())
+}
+
+// RegistryMessages returns a message for every entry of every registry of the spec, the registry
+// being from the spec or [state]. An entry whose version is registered with another address is an
+// error, since a registry version can't be changed.
+func (t *Topology) RegistryMessages(
+	ctx context.Context,
+	state *State,
+	networkID uint32,
+) ([]*RegistryMessage, error) {
+	if err := t.checkChains(false); err != nil {
+		return nil, err
+	}
+	state.init()
+	var messages []*RegistryMessage
+	for _, spec := range t.Spec.Registries {
+		address := t.registryAddress(spec.Chain, state)
+		if address == (common.Address{}) {
+			return nil, errors.Errorf("registry on chain %q is not deployed", spec.Chain)
+		}
+		registry, err := readRegistry(ctx, t.Chains[spec.Chain], address)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read TeleporterRegistry on chain %q", spec.Chain)
+		}
+		if registry == nil {
+			return nil, errors.Errorf("no TeleporterRegistry at %s on chain %q", address.Hex(), spec.Chain)
+		}
+		blockchainID, err := t.blockchainID(ctx, spec.Chain)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range t.Spec.registryEntries(spec) {
+			registered, ok := registry[entry.Version]
+			if ok && registered != entry.ProtocolAddress {
+				return nil, errors.Errorf("version %d of registry on chain %q is %s, not %s",
+					entry.Version, spec.Chain, registered.Hex(), entry.ProtocolAddress.Hex())
+			}
+			message, err := NewRegistryMessage(networkID, blockchainID, address, entry)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, &RegistryMessage{
+				Chain:      spec.Chain,
+				Registry:   address,
+				Entry:      entry,
+				Message:    message,
+				Registered: ok,
+			})
+		}
+	}
+	return messages, nil
+}
+
+// ChainConfigWithOffChainMessages adds [messages] to the off-chain messages of the chain config
+// [base], keeping its other fields and the messages it already has. An empty [base] is an empty
+// config.
+func ChainConfigWithOffChainMessages(base []byte, messages []*avalancheWarp.UnsignedMessage) ([]byte, error) {
+	config := make(map[string]interface{})
+	if len(bytes.TrimSpace(base)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(base))
+		// Numbers are kept as they are written, rather than rounded to float64.
+		decoder.UseNumber()
+		if err := decoder.Decode(&config); err != nil {
+			return nil, errors.Wrap(err, "failed to decode chain config")
+		}
+	}
+	var encoded []string
+	if existing, ok := config[OffChainMessagesKey]; ok {
+		list, ok := existing.([]interface{})
+		if !ok {
+			return nil, errors.Errorf("%s of chain config is not a list", OffChainMessagesKey)
+		}
+		for _, item := range list {
+			message, ok := item.(string)
+			if !ok {
+				return nil, errors.Errorf("%s of chain config has a message that is not a string", OffChainMessagesKey)
+			}
+			encoded = append(encoded, message)
+		}
+	}
+	for _, message := range messages {
+		hex := hexutil.Encode(message.Bytes())
+		found := false
+		for _, existing := range encoded {
+			if existing == hex {
+				found = true
+				break
+			}
+		}
+		if !found {
+			encoded = append(encoded, hex)
+		}
+	}
+	config[OffChainMessagesKey] = encoded
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// CheckRegistryMessages sets whether the node of each message's chain serves the message, which it
+// does once its chain config has the message and the node was restarted. Registered messages are
+// not checked.
+func (t *Topology) CheckRegistryMessages(ctx context.Context, messages []*RegistryMessage) error {
+	for _, message := range messages {
+		if message.Registered {
+			continue
+		}
+		client := t.Chains[message.Chain].Warp
+		if client == nil {
+			return errors.Errorf("no Warp client for chain %q", message.Chain)
+		}
+		// The node returns an error for a message it does not have.
+		served, err := client.GetMessage(ctx, message.Message.ID())
+		message.Live = err == nil && bytes.Equal(served, message.Message.Bytes())
+	}
+	return nil
+}
+
+// AddProtocolVersions registers the messages that are not registered yet. The aggregate signature
+// of each message is fetched from its chain's node, with [quorumNum] percent of the stake, and
+// passed to addProtocolVersion as the predicate of the transaction. The registry must emit
+// AddProtocolVersion, and LatestVersionUpdated if the version is above its latest version.
+func (t *Topology) AddProtocolVersions(
+	ctx context.Context,
+	messages []*RegistryMessage,
+	quorumNum uint64,
+) error {
+	if err := t.checkChains(true); err != nil {
+		return err
+	}
+	if err := t.CheckRegistryMessages(ctx, messages); err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if message.Registered {
+			continue
+		}
+		if !message.Live {
+			return errors.Errorf("the node of chain %q does not serve message %s of version %d",
+				message.Chain, message.Message.ID(), message.Entry.Version)
+		}
+		if err := t.addProtocolVersion(ctx, message, quorumNum); err != nil {
+			return errors.Wrapf(err, "failed to add version %d to registry on chain %q",
+				message.Entry.Version, message.Chain)
+		}
+		message.Registered = true
+	}
+	return nil
+}
+
+func (t *Topology) addProtocolVersion(ctx context.Context, message *RegistryMessage, quorumNum uint64) error {
+	chain := t.Chains[message.Chain]
+	signedBytes, err := chain.Warp.GetMessageAggregateSignature(ctx, message.Message.ID(), quorumNum, "")
+	if err != nil {
+		return errors.Wrap(err, "failed to get aggregate signature")
+	}
+	signed, err := avalancheWarp.ParseMessage(signedBytes)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse signed message")
+	}
+	if signed.UnsignedMessage.ID() != message.Message.ID() {
+		return errors.Errorf("the node signed message %s instead of %s",
+			signed.UnsignedMessage.ID(), message.Message.ID())
+	}
+
+	registry, err := teleporterregistry.NewTeleporterRegistry(message.Registry, chain.Backend)
+	if err != nil {
+		return err
+	}
+	previous, err := registry.LatestVersion(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return errors.Wrap(err, "failed to get latest version")
+	}
+	tx, err := newPredicateTx(ctx, chain, message.Registry, signed)
+	if err != nil {
+		return err
+	}
+	if err := chain.Backend.SendTransaction(ctx, tx); err != nil {
+		return errors.Wrap(err, "failed to send addProtocolVersion")
+	}
+	receipt, err := wait(ctx, chain, tx)
+	if err != nil {
+		return err
+	}
+
+	version := new(big.Int).SetUint64(message.Entry.Version)
+	added, updated := false, version.Cmp(previous) <= 0
+	for _, log := range receipt.Logs {
+		if event, err := registry.ParseAddProtocolVersion(*log); err == nil {
+			added = added || (event.Version.Cmp(version) == 0 && event.ProtocolAddress == message.Entry.ProtocolAddress)
+		}
+		if event, err := registry.ParseLatestVersionUpdated(*log); err == nil {
+			updated = updated || event.NewVersion.Cmp(version) == 0
+		}
+	}
+	if !added {
+		return errors.Errorf("transaction %s did not emit AddProtocolVersion", tx.Hash().Hex())
+	}
+	if !updated {
+		return errors.Errorf("transaction %s did not emit LatestVersionUpdated", tx.Hash().Hex())
+	}
+	return nil
+}
+
+// newPredicateTx creates the addProtocolVersion transaction of the sender of [chain], with [signed]
+// in its access list as the predicate of the Warp precompile.
+func newPredicateTx(
+	ctx context.Context,
+	chain *Chain,
+	registry common.Address,
+	signed *avalancheWarp.Message,
+) (*types.Transaction, error) {
+	opts := chain.Sender.Opts
+	callData, err := teleporterregistry.PackAddProtocolVersion(0)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := chain.Backend.ChainID(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get chain ID")
+	}
+	nonce, err := chain.Backend.NonceAt(ctx, opts.From, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get nonce")
+	}
+	gasTipCap := opts.GasTipCap
+	if gasTipCap == nil {
+		if gasTipCap, err = chain.Backend.SuggestGasTipCap(ctx); err != nil {
+			return nil, errors.Wrap(err, "failed to suggest gas tip cap")
+		}
+	}
+	gasFeeCap := opts.GasFeeCap
+	if gasFeeCap == nil {
+		head, err := chain.Backend.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get head")
+		}
+		gasFeeCap = new(big.Int).Mul(head.BaseFee, big.NewInt(gasUtils.BaseFeeFactor))
+		gasFeeCap.Add(gasFeeCap, big.NewInt(gasUtils.MaxPriorityFeePerGas))
+	}
+	tx := predicateutils.NewPredicateTx(
+		chainID,
+		nonce,
+		&registry,
+		addProtocolVersionGasLimit,
+		gasFeeCap,
+		gasTipCap,
+		big.NewInt(0),
+		callData,
+		types.AccessList{},
+		warp.ContractAddress,
+		signed.Bytes(),
+	)
+	return opts.Signer(opts.From, tx)
+}
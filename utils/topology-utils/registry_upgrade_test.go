@@ -0,0 +1,166 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	avalancheWarp "github.com/ava-labs/avalanchego/vms/platformvm/warp"
+	"github.com/ava-labs/avalanchego/vms/platformvm/warp/payload"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	icttUtils "github.com/ava-labs/icm-contracts/utils/ictt-utils"
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWarpClient serves the messages it has, and signs them with an empty signature.
+type fakeWarpClient struct {
+	messages map[ids.ID]*avalancheWarp.UnsignedMessage
+	// signed replaces the message that is signed, if it is not nil.
+	signed *avalancheWarp.UnsignedMessage
+}
+
+func (c *fakeWarpClient) GetMessage(_ context.Context, messageID ids.ID) ([]byte, error) {
+	message, ok := c.messages[messageID]
+	if !ok {
+		return nil, avalancheWarp.ErrWrongNetworkID
+	}
+	return message.Bytes(), nil
+}
+
+func (c *fakeWarpClient) GetMessageAggregateSignature(
+	_ context.Context,
+	messageID ids.ID,
+	_ uint64,
+	_ string,
+) ([]byte, error) {
+	message := c.messages[messageID]
+	if c.signed != nil {
+		message = c.signed
+	}
+	signed, err := avalancheWarp.NewMessage(message, &avalancheWarp.BitSetSignature{})
+	if err != nil {
+		return nil, err
+	}
+	return signed.Bytes(), nil
+}
+
+func TestRegistryMessages(t *testing.T) {
+	ctx := context.Background()
+	key, address, err := simulatedUtils.NewFundedKey()
+	require.NoError(t, err)
+	opts, err := simulatedUtils.NewTransactor(key)
+	require.NoError(t, err)
+	backend := simulatedUtils.NewSimulatedBackend(address)
+	defer backend.Close()
+	registryAddress, tx, _, err := teleporterregistry.DeployTeleporterRegistry(opts, backend.Client(),
+		[]teleporterregistry.ProtocolRegistryEntry{{Version: big.NewInt(1), ProtocolAddress: common.Address{1}}})
+	require.NoError(t, err)
+	_, err = simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+	require.NoError(t, err)
+
+	warpClient := &fakeWarpClient{messages: make(map[ids.ID]*avalancheWarp.UnsignedMessage)}
+	chain := &Chain{
+		Backend: backend.Client(),
+		Sender: icttUtils.NewTokenSender(backend.Client(), opts,
+			func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+				return simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+			}),
+		Warp: warpClient,
+	}
+	spec := &Spec{
+		Chains:     []*ChainSpec{{Name: "l1"}},
+		Teleporter: &TeleporterSpec{MessengerAddress: common.Address{2}, Version: 2},
+		Registries: []*RegistrySpec{{
+			Chain:   "l1",
+			Address: registryAddress,
+			Entries: []*RegistryEntrySpec{{Version: 1, ProtocolAddress: common.Address{1}}},
+		}},
+	}
+	require.NoError(t, spec.Validate())
+	topology := NewTopology(spec, map[string]*Chain{"l1": chain})
+	blockchainID, err := warpBlockchainID(ctx, chain, "l1")
+	require.NoError(t, err)
+
+	messages, err := topology.RegistryMessages(ctx, NewState(), 12345)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	require.True(t, messages[0].Registered)
+	require.False(t, messages[1].Registered)
+	message := messages[1].Message
+	require.Equal(t, uint32(12345), message.NetworkID)
+	require.Equal(t, blockchainID, message.SourceChainID)
+	addressedCall, err := payload.ParseAddressedCall(message.Payload)
+	require.NoError(t, err)
+	require.Empty(t, addressedCall.SourceAddress)
+	entry, destination, err := teleporterregistry.UnpackTeleporterRegistryWarpPayload(addressedCall.Payload)
+	require.NoError(t, err)
+	require.Equal(t, registryAddress, destination)
+	require.Equal(t, big.NewInt(2), entry.Version)
+	require.Equal(t, common.Address{2}, entry.ProtocolAddress)
+
+	// The message is not live until the node serves it.
+	require.NoError(t, topology.CheckRegistryMessages(ctx, messages))
+	require.False(t, messages[1].Live)
+	err = topology.AddProtocolVersions(ctx, messages, DefaultRegistryQuorumNum)
+	require.ErrorContains(t, err, "does not serve message "+message.ID().String())
+	warpClient.messages[message.ID()] = message
+	require.NoError(t, topology.CheckRegistryMessages(ctx, messages))
+	require.True(t, messages[1].Live)
+
+	// A signature of another message is rejected before it is sent.
+	other, err := NewRegistryMessage(12345, blockchainID, registryAddress, &RegistryEntrySpec{Version: 3})
+	require.NoError(t, err)
+	warpClient.signed = other
+	err = topology.AddProtocolVersions(ctx, messages, DefaultRegistryQuorumNum)
+	require.ErrorContains(t, err, "the node signed message "+other.ID().String())
+
+	// A message whose signature does not verify is sent, but its predicate keeps it out of blocks.
+	warpClient.signed = nil
+	err = topology.AddProtocolVersions(ctx, messages, DefaultRegistryQuorumNum)
+	require.ErrorContains(t, err, "failed to add version 2 to registry on chain \"l1\"")
+	require.False(t, messages[1].Registered)
+
+	// A version registered with another address can't be changed.
+	spec.Registries[0].Entries[0].ProtocolAddress = common.Address{3}
+	_, err = topology.RegistryMessages(ctx, NewState(), 12345)
+	require.ErrorContains(t, err, "version 1 of registry on chain \"l1\" is "+common.Address{1}.Hex())
+}
+
+func TestChainConfigWithOffChainMessages(t *testing.T) {
+	messages := make([]*avalancheWarp.UnsignedMessage, 2)
+	for i := range messages {
+		var err error
+		messages[i], err = NewRegistryMessage(1, ids.ID{1}, common.Address{1},
+			&RegistryEntrySpec{Version: uint64(i + 1), ProtocolAddress: common.Address{2}})
+		require.NoError(t, err)
+	}
+	first := hexutil.Encode(messages[0].Bytes())
+	second := hexutil.Encode(messages[1].Bytes())
+
+	config, err := ChainConfigWithOffChainMessages(nil, messages[:1])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"warp-off-chain-messages": ["`+first+`"]}`, string(config))
+
+	// Other fields are kept, and messages already in the config are not repeated.
+	base := `{"pruning-enabled": false, "state-sync-min-blocks": 300000000000000000001, ` +
+		`"warp-off-chain-messages": ["` + first + `"]}`
+	config, err = ChainConfigWithOffChainMessages([]byte(base), messages)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"pruning-enabled": false, "state-sync-min-blocks": 300000000000000000001, `+
+		`"warp-off-chain-messages": ["`+first+`", "`+second+`"]}`, string(config))
+	var decoded map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(config, &decoded))
+	require.Equal(t, "300000000000000000001", string(decoded["state-sync-min-blocks"]))
+
+	_, err = ChainConfigWithOffChainMessages([]byte(`{"warp-off-chain-messages": "0x00"}`), messages)
+	require.ErrorContains(t, err, "warp-off-chain-messages of chain config is not a list")
+}
@@ -0,0 +1,339 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ava-labs/avalanchego/ids"
+	icttUtils "github.com/ava-labs/icm-contracts/utils/ictt-utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// PoAValidatorManagerKind is the only validator manager kind that can be deployed from a spec. The
+// staking managers need a reward calculator and staking settings that are not part of a topology.
+const PoAValidatorManagerKind = "PoAValidatorManager"
+
+// Spec is a declarative description of the ICM contracts deployed across a set of chains. Contracts
+// are given an Address if they already exist, and are deployed by Topology.Apply otherwise. Chains
+// are referred to by name.
+type Spec struct {
+	Chains []*ChainSpec `json:"chains"`
+	// Teleporter is the TeleporterMessenger version expected on every chain, and registered in every
+	// TeleporterRegistry.
+	Teleporter        *TeleporterSpec         `json:"teleporter"`
+	Registries        []*RegistrySpec         `json:"registries"`
+	ICTT              []*ICTTSpec             `json:"ictt"`
+	ValidatorSetSigs  []*ValidatorSetSigSpec  `json:"validatorSetSigs"`
+	ValidatorManagers []*ValidatorManagerSpec `json:"validatorManagers"`
+	// Apps are deployed TeleporterRegistryApp contracts, which are managed along with the ICTT
+	// contracts of the spec.
+	Apps []*AppSpec `json:"apps"`
+}
+
+// ChainSpec is a chain of the topology.
+type ChainSpec struct {
+	Name string `json:"name"`
+	RPC  string `json:"rpc"`
+	// BlockchainID defaults to the blockchain ID the chain's Warp precompile returns.
+	BlockchainID ids.ID `json:"blockchainID"`
+}
+
+// TeleporterSpec is a TeleporterMessenger version. The messenger is deployed to the same address on
+// every chain with Nick's method, from the transaction that deployment-utils constructs from
+// BytecodeFile. Without BytecodeFile, a chain without the messenger can't be applied.
+type TeleporterSpec struct {
+	MessengerAddress common.Address `json:"messengerAddress"`
+	Version          uint64         `json:"version"`
+	BytecodeFile     string         `json:"bytecodeFile"`
+}
+
+// RegistrySpec is the TeleporterRegistry of a chain.
+type RegistrySpec struct {
+	Chain   string               `json:"chain"`
+	Address common.Address       `json:"address"`
+	Entries []*RegistryEntrySpec `json:"entries"`
+}
+
+// RegistryEntrySpec is a TeleporterMessenger version registered in a TeleporterRegistry.
+type RegistryEntrySpec struct {
+	Version         uint64         `json:"version"`
+	ProtocolAddress common.Address `json:"protocolAddress"`
+}
+
+// ICTTSpec is a TokenHome and the TokenRemote instances registered with it.
+type ICTTSpec struct {
+	Name    string             `json:"name"`
+	Home    *TokenHomeSpec     `json:"home"`
+	Remotes []*TokenRemoteSpec `json:"remotes"`
+}
+
+// TokenHomeSpec is an ERC20TokenHome or NativeTokenHome. Its TeleporterRegistry is the registry of
+// its chain.
+type TokenHomeSpec struct {
+	Chain   string                    `json:"chain"`
+	Kind    icttUtils.TransferrerKind `json:"kind"`
+	Address common.Address            `json:"address"`
+	// TokenAddress is the ERC20 token of an ERC20TokenHome with TokenDecimals decimals, or the wrapped
+	// native token of a NativeTokenHome.
+	TokenAddress  common.Address `json:"tokenAddress"`
+	TokenDecimals uint8          `json:"tokenDecimals"`
+	// TeleporterManager defaults to the deployer.
+	TeleporterManager common.Address `json:"teleporterManager"`
+	// MinTeleporterVersion defaults to the latest version of the chain's TeleporterRegistry.
+	MinTeleporterVersion *big.Int `json:"minTeleporterVersion"`
+}
+
+// TokenRemoteSpec is a TokenRemote on Chain. The TeleporterRegistry, TokenHome blockchain ID and
+// TokenHome address of the embedded RemoteSpec default to the chain's registry and the ICTT's home.
+// A remote given an Address already exists, and only its Kind, TokenHome and TokenDecimals are
+// checked.
+type TokenRemoteSpec struct {
+	Chain   string         `json:"chain"`
+	Address common.Address `json:"address"`
+	icttUtils.RemoteSpec
+}
+
+// ValidatorSetSigSpec is a ValidatorSetSig contract that verifies messages signed by the validators
+// of ValidatorBlockchainID.
+type ValidatorSetSigSpec struct {
+	Name                  string         `json:"name"`
+	Chain                 string         `json:"chain"`
+	Address               common.Address `json:"address"`
+	ValidatorBlockchainID ids.ID         `json:"validatorBlockchainID"`
+}
+
+// ValidatorManagerSpec is a validator manager of the L1 L1ID.
+type ValidatorManagerSpec struct {
+	Name                   string         `json:"name"`
+	Chain                  string         `json:"chain"`
+	Kind                   string         `json:"kind"`
+	Address                common.Address `json:"address"`
+	L1ID                   ids.ID         `json:"l1ID"`
+	ChurnPeriodSeconds     uint64         `json:"churnPeriodSeconds"`
+	MaximumChurnPercentage uint8          `json:"maximumChurnPercentage"`
+	// Owner defaults to the deployer, and is only checked for a PoAValidatorManager, since the staking
+	// managers have no owner.
+	Owner common.Address `json:"owner"`
+}
+
+// AppSpec is a contract that extends TeleporterRegistryApp, such as a TeleporterRegistryOwnableApp.
+type AppSpec struct {
+	Name    string         `json:"name"`
+	Chain   string         `json:"chain"`
+	Address common.Address `json:"address"`
+}
+
+// ReadSpec reads a spec from a YAML file if its extension is .yaml or .yml, and from a JSON file
+// otherwise. Unknown fields are an error.
+func ReadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read spec")
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if data, err = yaml.YAMLToJSON(data); err != nil {
+			return nil, errors.Wrap(err, "failed to convert spec from YAML")
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	spec := &Spec{}
+	if err := decoder.Decode(spec); err != nil {
+		return nil, errors.Wrap(err, "failed to decode spec")
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid spec")
+	}
+	return spec, nil
+}
+
+// Validate checks that names are unique, that every chain referred to is defined, and that each
+// contract is of a kind that can be deployed.
+func (s *Spec) Validate() error {
+	chains := make(map[string]bool)
+	for _, chain := range s.Chains {
+		if chain.Name == "" {
+			return errors.New("chain name is required")
+		}
+		if chains[chain.Name] {
+			return errors.Errorf("duplicate chain %q", chain.Name)
+		}
+		chains[chain.Name] = true
+	}
+	checkChain := func(resource, chain string) error {
+		if !chains[chain] {
+			return errors.Errorf("%s: unknown chain %q", resource, chain)
+		}
+		return nil
+	}
+	if s.Teleporter != nil && (s.Teleporter.MessengerAddress == (common.Address{}) || s.Teleporter.Version == 0) {
+		return errors.New("teleporter: messenger address and version are required")
+	}
+
+	registries := make(map[string]bool)
+	for _, registry := range s.Registries {
+		if err := checkChain("registry", registry.Chain); err != nil {
+			return err
+		}
+		if registries[registry.Chain] {
+			return errors.Errorf("duplicate registry on chain %q", registry.Chain)
+		}
+		registries[registry.Chain] = true
+		versions := make(map[uint64]bool)
+		for _, entry := range s.registryEntries(registry) {
+			if entry.Version == 0 || entry.ProtocolAddress == (common.Address{}) {
+				return errors.Errorf("registry on %q: entries need a version and a protocol address", registry.Chain)
+			}
+			if versions[entry.Version] {
+				return errors.Errorf("registry on %q: duplicate version %d", registry.Chain, entry.Version)
+			}
+			if s.Teleporter != nil && entry.Version == s.Teleporter.Version &&
+				entry.ProtocolAddress != s.Teleporter.MessengerAddress {
+				return errors.Errorf(
+					"registry on %q: version %d is not the teleporter messenger address", registry.Chain, entry.Version,
+				)
+			}
+			versions[entry.Version] = true
+		}
+	}
+
+	names := make(map[string]bool)
+	checkName := func(kind, name string) error {
+		if name == "" {
+			return errors.Errorf("%s name is required", kind)
+		}
+		if names[name] {
+			return errors.Errorf("duplicate name %q", name)
+		}
+		names[name] = true
+		return nil
+	}
+	for _, ictt := range s.ICTT {
+		if err := checkName("ictt", ictt.Name); err != nil {
+			return err
+		}
+		home := ictt.Home
+		if home == nil {
+			return errors.Errorf("ictt %q: home is required", ictt.Name)
+		}
+		if err := checkChain("ictt "+ictt.Name, home.Chain); err != nil {
+			return err
+		}
+		if !home.Kind.IsHome() {
+			return errors.Errorf("ictt %q: %s is not a TokenHome", ictt.Name, home.Kind)
+		}
+		if home.TokenAddress == (common.Address{}) {
+			return errors.Errorf("ictt %q: home token address is required", ictt.Name)
+		}
+		if home.Address == (common.Address{}) && !registries[home.Chain] {
+			return errors.Errorf("ictt %q: no registry on chain %q to deploy the home with", ictt.Name, home.Chain)
+		}
+		remoteChains := make(map[string]bool)
+		for _, remote := range ictt.Remotes {
+			if err := checkChain("ictt "+ictt.Name, remote.Chain); err != nil {
+				return err
+			}
+			if remoteChains[remote.Chain] {
+				return errors.Errorf("ictt %q: duplicate remote on chain %q", ictt.Name, remote.Chain)
+			}
+			remoteChains[remote.Chain] = true
+			if remote.Address != (common.Address{}) {
+				if remote.Kind.IsHome() {
+					return errors.Errorf("ictt %q: %s is not a TokenRemote", ictt.Name, remote.Kind)
+				}
+				continue
+			}
+			if remote.TeleporterRegistryAddress == (common.Address{}) && !registries[remote.Chain] {
+				return errors.Errorf("ictt %q: no registry on chain %q to deploy the remote with", ictt.Name, remote.Chain)
+			}
+			// The TokenHome and registry are filled in when the remote is deployed.
+			validated := remote.RemoteSpec
+			validated.TeleporterRegistryAddress = common.Address{1}
+			validated.TokenHomeAddress = common.Address{1}
+			if err := validated.Validate(); err != nil {
+				return errors.Wrapf(err, "ictt %q: remote on %q", ictt.Name, remote.Chain)
+			}
+		}
+	}
+	for _, sig := range s.ValidatorSetSigs {
+		if err := checkName("validator set sig", sig.Name); err != nil {
+			return err
+		}
+		if err := checkChain("validator set sig "+sig.Name, sig.Chain); err != nil {
+			return err
+		}
+	}
+	for _, manager := range s.ValidatorManagers {
+		if err := checkName("validator manager", manager.Name); err != nil {
+			return err
+		}
+		if err := checkChain("validator manager "+manager.Name, manager.Chain); err != nil {
+			return err
+		}
+		if manager.Address == (common.Address{}) && manager.Kind != PoAValidatorManagerKind {
+			return errors.Errorf(
+				"validator manager %q: only a %s can be deployed, got %q", manager.Name, PoAValidatorManagerKind, manager.Kind,
+			)
+		}
+	}
+	for _, app := range s.Apps {
+		if err := checkName("app", app.Name); err != nil {
+			return err
+		}
+		if err := checkChain("app "+app.Name, app.Chain); err != nil {
+			return err
+		}
+		if app.Address == (common.Address{}) {
+			return errors.Errorf("app %q: address is required", app.Name)
+		}
+	}
+	return nil
+}
+
+// registryEntries returns the entries of [registry], with the Teleporter version added if the
+// registry does not list it.
+func (s *Spec) registryEntries(registry *RegistrySpec) []*RegistryEntrySpec {
+	if s.Teleporter == nil {
+		return registry.Entries
+	}
+	for _, entry := range registry.Entries {
+		if entry.Version == s.Teleporter.Version {
+			return registry.Entries
+		}
+	}
+	entries := append([]*RegistryEntrySpec{}, registry.Entries...)
+	return append(entries, &RegistryEntrySpec{
+		Version:         s.Teleporter.Version,
+		ProtocolAddress: s.Teleporter.MessengerAddress,
+	})
+}
+
+// chain returns the spec of the chain named [name].
+func (s *Spec) chain(name string) *ChainSpec {
+	for _, chain := range s.Chains {
+		if chain.Name == name {
+			return chain
+		}
+	}
+	return nil
+}
+
+// registry returns the spec of the registry on the chain named [chain], or nil if there is none.
+func (s *Spec) registry(chain string) *RegistrySpec {
+	for _, registry := range s.Registries {
+		if registry.Chain == chain {
+			return registry
+		}
+	}
+	return nil
+}
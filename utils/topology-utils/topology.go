@@ -0,0 +1,1038 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	transparentupgradeableproxy "github.com/ava-labs/icm-contracts/abi-bindings/go/TransparentUpgradeableProxy"
+	validatorsetsig "github.com/ava-labs/icm-contracts/abi-bindings/go/governance/ValidatorSetSig"
+	erc20tokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/ERC20TokenHome"
+	nativetokenhome "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenHome/NativeTokenHome"
+	erc20tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/ERC20TokenRemote"
+	tokenremote "github.com/ava-labs/icm-contracts/abi-bindings/go/ictt/TokenRemote/TokenRemote"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	poavalidatormanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/PoAValidatorManager"
+	deploymentUtils "github.com/ava-labs/icm-contracts/utils/deployment-utils"
+	icttUtils "github.com/ava-labs/icm-contracts/utils/ictt-utils"
+	validatorManagerUtils "github.com/ava-labs/icm-contracts/utils/validator-manager-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ava-labs/subnet-evm/precompile/contracts/warp"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// icmInitializableDisallowed is ICMInitializable.Disallowed, which disables the initializers of a
+// validator manager implementation so that it can only be initialized through a proxy.
+const icmInitializableDisallowed uint8 = 1
+
+// Backend is a chain of a topology.
+type Backend interface {
+	icttUtils.TrackerBackend
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+	ChainID(ctx context.Context) (*big.Int, error)
+}
+
+// Chain is a chain of a topology. Sender signs the transactions of Topology.Apply, and may be nil
+// if the topology is only planned. Warp is only needed to add TeleporterRegistry versions.
+type Chain struct {
+	Backend Backend
+	Sender  *icttUtils.TokenSender
+	Warp    WarpClient
+}
+
+// State is the contracts that Topology.Apply deployed, keyed by the chain of a registry, and by
+// name otherwise. TokenRemotes are keyed by ICTT name and chain, as "name/chain". It is saved after
+// every deployment, and passing it back to Apply resumes where it stopped.
+type State struct {
+	Registries        map[string]common.Address              `json:"registries"`
+	TokenHomes        map[string]common.Address              `json:"tokenHomes"`
+	TokenRemotes      map[string]*icttUtils.RemoteDeployment `json:"tokenRemotes"`
+	ValidatorSetSigs  map[string]common.Address              `json:"validatorSetSigs"`
+	ValidatorManagers map[string]common.Address              `json:"validatorManagers"`
+}
+
+// NewState creates the state of a topology that has not been applied.
+func NewState() *State {
+	state := &State{}
+	state.init()
+	return state
+}
+
+// init makes the maps of a state decoded without them.
+func (s *State) init() {
+	if s.Registries == nil {
+		s.Registries = make(map[string]common.Address)
+	}
+	if s.TokenHomes == nil {
+		s.TokenHomes = make(map[string]common.Address)
+	}
+	if s.TokenRemotes == nil {
+		s.TokenRemotes = make(map[string]*icttUtils.RemoteDeployment)
+	}
+	if s.ValidatorSetSigs == nil {
+		s.ValidatorSetSigs = make(map[string]common.Address)
+	}
+	if s.ValidatorManagers == nil {
+		s.ValidatorManagers = make(map[string]common.Address)
+	}
+}
+
+// ActionKind is what Topology.Apply does to bring a contract in line with the spec.
+type ActionKind string
+
+const (
+	// ActionNone means the contract matches the spec.
+	ActionNone ActionKind = "none"
+	// ActionDeploy means the contract is deployed.
+	ActionDeploy ActionKind = "deploy"
+	// ActionConfigure means the contract is deployed, but is initialized, registered or
+	// collateralized.
+	ActionConfigure ActionKind = "configure"
+	// ActionManual means the contract differs from the spec in a way Apply can't change, such as a
+	// missing TeleporterRegistry version, which needs a message signed by the chain's validators.
+	ActionManual ActionKind = "manual"
+)
+
+// Action is the difference between a contract and its spec.
+type Action struct {
+	Kind ActionKind
+	// Resource identifies the contract, as "teleporter/CHAIN", "registry/CHAIN", "ictt/NAME/home",
+	// "ictt/NAME/remote/CHAIN", "validator-set-sig/NAME" or "validator-manager/NAME".
+	Resource string
+	Chain    string
+	// Address is zero for a contract that is not deployed.
+	Address common.Address
+	Detail  string
+
+	apply func(ctx context.Context) error
+}
+
+func (a *Action) String() string {
+	s := fmt.Sprintf("%s %s on %s", a.Kind, a.Resource, a.Chain)
+	if a.Address != (common.Address{}) {
+		s += " at " + a.Address.Hex()
+	}
+	if a.Detail != "" {
+		s += ": " + a.Detail
+	}
+	return s
+}
+
+// Plan is an action for every contract of a spec, in the order they are applied.
+type Plan struct {
+	Actions []*Action
+}
+
+// Changes returns the actions other than ActionNone.
+func (p *Plan) Changes() []*Action {
+	var changes []*Action
+	for _, action := range p.Actions {
+		if action.Kind != ActionNone {
+			changes = append(changes, action)
+		}
+	}
+	return changes
+}
+
+// Topology plans and applies a spec across its chains.
+type Topology struct {
+	Spec   *Spec
+	Chains map[string]*Chain
+	// Relay delivers the registration messages of TokenRemote instances. If it is nil, Apply waits for
+	// a relayer to deliver them, checking every PollInterval.
+	Relay        icttUtils.MessageRelayer
+	PollInterval time.Duration
+	// Save is called with the state whenever Apply changes it, if it is not nil.
+	Save func(state *State) error
+
+	blockchainIDs map[string]ids.ID
+}
+
+// NewTopology creates a Topology for [spec], whose chains are given by name in [chains].
+func NewTopology(spec *Spec, chains map[string]*Chain) *Topology {
+	return &Topology{
+		Spec:          spec,
+		Chains:        chains,
+		PollInterval:  icttUtils.DefaultRegistrationPollInterval,
+		blockchainIDs: make(map[string]ids.ID),
+	}
+}
+
+type checker func(ctx context.Context, state *State) (*Action, error)
+
+// Plan reads the contracts of the spec from the chains and [state], and returns the actions Apply
+// would take.
+func (t *Topology) Plan(ctx context.Context, state *State) (*Plan, error) {
+	if err := t.checkChains(false); err != nil {
+		return nil, err
+	}
+	state.init()
+	plan := &Plan{}
+	for _, check := range t.checkers() {
+		action, err := check(ctx, state)
+		if err != nil {
+			return nil, err
+		}
+		plan.Actions = append(plan.Actions, action)
+	}
+	return plan, nil
+}
+
+// Apply deploys and configures the contracts of the spec that are missing from the chains, in
+// dependency order: TeleporterMessenger instances, registries, validator set sigs, validator managers,
+// TokenHome instances, and then TokenRemote instances. Actions that must be taken manually are
+// skipped. [state] is updated as contracts are deployed, and the plan of the applied topology is
+// returned.
+func (t *Topology) Apply(ctx context.Context, state *State) (*Plan, error) {
+	if err := t.checkChains(true); err != nil {
+		return nil, err
+	}
+	state.init()
+	for _, check := range t.checkers() {
+		action, err := check(ctx, state)
+		if err != nil {
+			return nil, err
+		}
+		if action.apply == nil {
+			continue
+		}
+		if err := action.apply(ctx); err != nil {
+			return nil, errors.Wrapf(err, "failed to %s %s", action.Kind, action.Resource)
+		}
+	}
+	return t.Plan(ctx, state)
+}
+
+func (t *Topology) checkChains(send bool) error {
+	for _, spec := range t.Spec.Chains {
+		chain, ok := t.Chains[spec.Name]
+		if !ok || chain.Backend == nil {
+			return errors.Errorf("no backend for chain %q", spec.Name)
+		}
+		if send && chain.Sender == nil {
+			return errors.Errorf("no sender for chain %q", spec.Name)
+		}
+	}
+	return nil
+}
+
+// checkers returns the check of every contract of the spec, in dependency order.
+func (t *Topology) checkers() []checker {
+	var checkers []checker
+	if t.Spec.Teleporter != nil {
+		for _, chain := range t.Spec.Chains {
+			checkers = append(checkers, t.teleporterChecker(chain.Name))
+		}
+	}
+	for _, registry := range t.Spec.Registries {
+		checkers = append(checkers, t.registryChecker(registry))
+	}
+	for _, sig := range t.Spec.ValidatorSetSigs {
+		checkers = append(checkers, t.validatorSetSigChecker(sig))
+	}
+	for _, manager := range t.Spec.ValidatorManagers {
+		checkers = append(checkers, t.validatorManagerChecker(manager))
+	}
+	for _, ictt := range t.Spec.ICTT {
+		checkers = append(checkers, t.homeChecker(ictt))
+	}
+	for _, ictt := range t.Spec.ICTT {
+		for _, remote := range ictt.Remotes {
+			checkers = append(checkers, t.remoteChecker(ictt, remote))
+		}
+	}
+	return checkers
+}
+
+func (t *Topology) teleporterChecker(chainName string) checker {
+	return func(ctx context.Context, _ *State) (*Action, error) {
+		spec := t.Spec.Teleporter
+		chain := t.Chains[chainName]
+		action := &Action{Kind: ActionNone, Resource: "teleporter/" + chainName, Chain: chainName}
+		deployed, err := hasCode(ctx, chain, spec.MessengerAddress)
+		if err != nil {
+			return nil, err
+		}
+		if deployed {
+			action.Address = spec.MessengerAddress
+			return action, nil
+		}
+		if spec.BytecodeFile == "" {
+			action.Kind = ActionManual
+			action.Detail = "TeleporterMessenger " + spec.MessengerAddress.Hex() +
+				" is not deployed, and there is no bytecode file to deploy it from"
+			return action, nil
+		}
+		action.Kind = ActionDeploy
+		action.Detail = "deploy TeleporterMessenger " + spec.MessengerAddress.Hex() + " with Nick's method"
+		action.apply = func(ctx context.Context) error {
+			return t.deployTeleporter(ctx, chain)
+		}
+		return action, nil
+	}
+}
+
+// deployTeleporter funds the keyless deployer of the TeleporterMessenger and sends its transaction.
+func (t *Topology) deployTeleporter(ctx context.Context, chain *Chain) error {
+	spec := t.Spec.Teleporter
+	txBytes, _, deployerAddress, messengerAddress, err := deploymentUtils.ConstructKeylessTransaction(
+		spec.BytecodeFile, false, deploymentUtils.GetDefaultContractCreationGasPrice(),
+	)
+	if err != nil {
+		return err
+	}
+	if messengerAddress != spec.MessengerAddress {
+		return errors.Errorf("bytecode file deploys TeleporterMessenger to %s, not %s",
+			messengerAddress.Hex(), spec.MessengerAddress.Hex())
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(txBytes); err != nil {
+		return errors.Wrap(err, "failed to decode keyless transaction")
+	}
+
+	err = deploymentUtils.FundKeylessSigner(
+		ctx, chain.Backend, chain.Sender.Opts, deploymentUtils.TxWaiter(chain.Sender.Wait), deployerAddress, tx,
+	)
+	if err != nil {
+		return err
+	}
+	if err := chain.Backend.SendTransaction(ctx, tx); err != nil {
+		return errors.Wrap(err, "failed to send keyless transaction")
+	}
+	_, err = wait(ctx, chain, tx)
+	return err
+}
+
+func (t *Topology) registryChecker(spec *RegistrySpec) checker {
+	return func(ctx context.Context, state *State) (*Action, error) {
+		chain := t.Chains[spec.Chain]
+		action := &Action{Kind: ActionNone, Resource: "registry/" + spec.Chain, Chain: spec.Chain}
+		entries := t.Spec.registryEntries(spec)
+		deployed, err := t.locate(ctx, action, chain, spec.Address, state.Registries[spec.Chain])
+		if err != nil || action.Kind == ActionManual {
+			return action, err
+		}
+		if !deployed {
+			versions := make([]string, len(entries))
+			for i, entry := range entries {
+				versions[i] = fmt.Sprint(entry.Version)
+			}
+			action.Kind = ActionDeploy
+			action.Detail = "deploy TeleporterRegistry with versions " + strings.Join(versions, ", ")
+			action.apply = func(ctx context.Context) error {
+				return t.deploy(ctx, chain, state, state.Registries, spec.Chain,
+					func(opts *bind.TransactOpts) (common.Address, *types.Transaction, error) {
+						initialEntries := make([]teleporterregistry.ProtocolRegistryEntry, len(entries))
+						for i, entry := range entries {
+							initialEntries[i] = teleporterregistry.ProtocolRegistryEntry{
+								Version:         new(big.Int).SetUint64(entry.Version),
+								ProtocolAddress: entry.ProtocolAddress,
+							}
+						}
+						address, tx, _, err := teleporterregistry.DeployTeleporterRegistry(
+							opts, chain.Backend, initialEntries,
+						)
+						return address, tx, err
+					})
+			}
+			return action, nil
+		}
+
+		registry, err := teleporterregistry.NewTeleporterRegistry(action.Address, chain.Backend)
+		if err != nil {
+			return nil, err
+		}
+		callOpts := &bind.CallOpts{Context: ctx}
+		latest, err := registry.LatestVersion(callOpts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get latest version of registry %s", action.Address.Hex())
+		}
+		var problems []string
+		for _, entry := range entries {
+			version := new(big.Int).SetUint64(entry.Version)
+			if version.Cmp(latest) > 0 {
+				problems = append(problems, fmt.Sprintf("version %d is not registered", entry.Version))
+				continue
+			}
+			address, err := registry.GetAddressFromVersion(callOpts, version)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get address of version %d", entry.Version)
+			}
+			if address != entry.ProtocolAddress {
+				problems = append(problems, fmt.Sprintf("version %d is %s, not %s",
+					entry.Version, address.Hex(), entry.ProtocolAddress.Hex()))
+			}
+		}
+		if len(problems) > 0 {
+			action.Kind = ActionManual
+			action.Detail = strings.Join(problems, "; ") +
+				"; versions are added with an addProtocolVersion message signed by the chain's validators"
+		}
+		return action, nil
+	}
+}
+
+func (t *Topology) validatorSetSigChecker(spec *ValidatorSetSigSpec) checker {
+	return func(ctx context.Context, state *State) (*Action, error) {
+		chain := t.Chains[spec.Chain]
+		action := &Action{Kind: ActionNone, Resource: "validator-set-sig/" + spec.Name, Chain: spec.Chain}
+		deployed, err := t.locate(ctx, action, chain, spec.Address, state.ValidatorSetSigs[spec.Name])
+		if err != nil || action.Kind == ActionManual {
+			return action, err
+		}
+		if !deployed {
+			action.Kind = ActionDeploy
+			action.Detail = "deploy ValidatorSetSig for validators of " + spec.ValidatorBlockchainID.String()
+			action.apply = func(ctx context.Context) error {
+				return t.deploy(ctx, chain, state, state.ValidatorSetSigs, spec.Name,
+					func(opts *bind.TransactOpts) (common.Address, *types.Transaction, error) {
+						address, tx, _, err := validatorsetsig.DeployValidatorSetSig(
+							opts, chain.Backend, spec.ValidatorBlockchainID,
+						)
+						return address, tx, err
+					})
+			}
+			return action, nil
+		}
+
+		sig, err := validatorsetsig.NewValidatorSetSig(action.Address, chain.Backend)
+		if err != nil {
+			return nil, err
+		}
+		validatorBlockchainID, err := sig.ValidatorBlockchainID(&bind.CallOpts{Context: ctx})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get validator blockchain ID of %s", action.Address.Hex())
+		}
+		if ids.ID(validatorBlockchainID) != spec.ValidatorBlockchainID {
+			action.Kind = ActionManual
+			action.Detail = fmt.Sprintf("validator blockchain ID is %s, not %s",
+				ids.ID(validatorBlockchainID), spec.ValidatorBlockchainID)
+		}
+		return action, nil
+	}
+}
+
+func (t *Topology) validatorManagerChecker(spec *ValidatorManagerSpec) checker {
+	return func(ctx context.Context, state *State) (*Action, error) {
+		chain := t.Chains[spec.Chain]
+		action := &Action{Kind: ActionNone, Resource: "validator-manager/" + spec.Name, Chain: spec.Chain}
+		deployed, err := t.locate(ctx, action, chain, spec.Address, state.ValidatorManagers[spec.Name])
+		if err != nil || action.Kind == ActionManual {
+			return action, err
+		}
+		settings := poavalidatormanager.ValidatorManagerSettings{
+			L1ID:                   spec.L1ID,
+			ChurnPeriodSeconds:     spec.ChurnPeriodSeconds,
+			MaximumChurnPercentage: spec.MaximumChurnPercentage,
+		}
+		wantOwner := spec.Owner
+		if wantOwner == (common.Address{}) && chain.Sender != nil {
+			wantOwner = chain.Sender.Opts.From
+		}
+		initialize := func(ctx context.Context, address common.Address) error {
+			manager, err := poavalidatormanager.NewPoAValidatorManager(address, chain.Backend)
+			if err != nil {
+				return err
+			}
+			_, err = transact(ctx, chain, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+				return manager.Initialize(opts, settings, wantOwner)
+			})
+			return errors.Wrap(err, "failed to initialize validator manager")
+		}
+		if !deployed {
+			action.Kind = ActionDeploy
+			action.Detail = fmt.Sprintf("deploy %s behind a TransparentUpgradeableProxy for L1 %s",
+				PoAValidatorManagerKind, spec.L1ID)
+			action.apply = func(ctx context.Context) error {
+				return t.deployValidatorManager(ctx, chain, state, spec.Name, settings, wantOwner)
+			}
+			return action, nil
+		}
+
+		kind, err := validatorManagerUtils.DetectManagerKind(ctx, chain.Backend, action.Address)
+		if err != nil {
+			return nil, err
+		}
+		if kind.String() != spec.Kind {
+			action.Kind = ActionManual
+			action.Detail = fmt.Sprintf("contract is a %s, not a %s", kind, spec.Kind)
+			return action, nil
+		}
+		// The staking managers share the ValidatorManagerStorage of the PoAValidatorManager, but have
+		// no owner.
+		manager, err := poavalidatormanager.NewPoAValidatorManager(action.Address, chain.Backend)
+		if err != nil {
+			return nil, err
+		}
+		actual, err := readValidatorManagerSettings(ctx, chain.Backend, manager, action.Address)
+		if err != nil {
+			return nil, err
+		}
+		var problems []string
+		if kind == validatorManagerUtils.PoAValidatorManagerKind {
+			owner, err := manager.Owner(&bind.CallOpts{Context: ctx})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get owner of %s", action.Address.Hex())
+			}
+			if owner == (common.Address{}) {
+				action.Kind = ActionConfigure
+				action.Detail = fmt.Sprintf("initialize %s for L1 %s", PoAValidatorManagerKind, spec.L1ID)
+				address := action.Address
+				action.apply = func(ctx context.Context) error {
+					return initialize(ctx, address)
+				}
+				return action, nil
+			}
+			if wantOwner != (common.Address{}) && owner != wantOwner {
+				problems = append(problems, fmt.Sprintf("owner is %s, not %s", owner.Hex(), wantOwner.Hex()))
+			}
+		} else if actual.L1ID == ([32]byte{}) {
+			// A staking manager is initialized with staking settings that are not part of the spec.
+			action.Kind = ActionManual
+			action.Detail = "validator manager is not initialized"
+			return action, nil
+		}
+		if actual.L1ID != settings.L1ID {
+			problems = append(problems, fmt.Sprintf("L1 ID is %s, not %s", ids.ID(actual.L1ID), spec.L1ID))
+		}
+		if actual.ChurnPeriodSeconds != settings.ChurnPeriodSeconds {
+			problems = append(problems, fmt.Sprintf("churn period is %ds, not %ds",
+				actual.ChurnPeriodSeconds, settings.ChurnPeriodSeconds))
+		}
+		if actual.MaximumChurnPercentage != settings.MaximumChurnPercentage {
+			problems = append(problems, fmt.Sprintf("maximum churn percentage is %d, not %d",
+				actual.MaximumChurnPercentage, settings.MaximumChurnPercentage))
+		}
+		if len(problems) > 0 {
+			action.Kind = ActionManual
+			action.Detail = strings.Join(problems, "; ")
+		}
+		return action, nil
+	}
+}
+
+// readValidatorManagerSettings reads the settings a validator manager was initialized with from
+// the start of its ValidatorManagerStorage, since they have no getters. The churn period and
+// maximum churn percentage are packed in the second slot.
+func readValidatorManagerSettings(
+	ctx context.Context,
+	backend Backend,
+	manager *poavalidatormanager.PoAValidatorManager,
+	address common.Address,
+) (*poavalidatormanager.ValidatorManagerSettings, error) {
+	location, err := manager.VALIDATORMANAGERSTORAGELOCATION(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get validator manager storage location")
+	}
+	slot := new(big.Int).SetBytes(location[:])
+	l1ID, err := backend.StorageAt(ctx, address, common.BigToHash(slot), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read L1 ID")
+	}
+	churn, err := backend.StorageAt(ctx, address, common.BigToHash(slot.Add(slot, big.NewInt(1))), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read churn settings")
+	}
+	churnSlot := common.BytesToHash(churn)
+	return &poavalidatormanager.ValidatorManagerSettings{
+		L1ID:                   common.BytesToHash(l1ID),
+		ChurnPeriodSeconds:     new(big.Int).SetBytes(churnSlot[24:]).Uint64(),
+		MaximumChurnPercentage: churnSlot[23],
+	}, nil
+}
+
+func (t *Topology) homeChecker(ictt *ICTTSpec) checker {
+	return func(ctx context.Context, state *State) (*Action, error) {
+		spec := ictt.Home
+		chain := t.Chains[spec.Chain]
+		action := &Action{Kind: ActionNone, Resource: "ictt/" + ictt.Name + "/home", Chain: spec.Chain}
+		deployed, err := t.locate(ctx, action, chain, spec.Address, state.TokenHomes[ictt.Name])
+		if err != nil || action.Kind == ActionManual {
+			return action, err
+		}
+		if !deployed {
+			action.Kind = ActionDeploy
+			action.Detail = "deploy " + spec.Kind.String() + " for token " + spec.TokenAddress.Hex()
+			action.apply = func(ctx context.Context) error {
+				return t.deploy(ctx, chain, state, state.TokenHomes, ictt.Name,
+					func(opts *bind.TransactOpts) (common.Address, *types.Transaction, error) {
+						return t.deployHome(ctx, opts, chain, state, spec)
+					})
+			}
+			return action, nil
+		}
+
+		kind, err := icttUtils.DetectTransferrerKind(ctx, chain.Backend, action.Address)
+		if err != nil {
+			return nil, err
+		}
+		if kind != spec.Kind {
+			action.Kind = ActionManual
+			action.Detail = fmt.Sprintf("contract is a %s, not a %s", kind, spec.Kind)
+			return action, nil
+		}
+		// The ERC20TokenHome and NativeTokenHome share getTokenAddress.
+		home, err := erc20tokenhome.NewERC20TokenHome(action.Address, chain.Backend)
+		if err != nil {
+			return nil, err
+		}
+		tokenAddress, err := home.GetTokenAddress(&bind.CallOpts{Context: ctx})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get token address of %s", action.Address.Hex())
+		}
+		if tokenAddress != spec.TokenAddress {
+			action.Kind = ActionManual
+			action.Detail = fmt.Sprintf("token is %s, not %s", tokenAddress.Hex(), spec.TokenAddress.Hex())
+			return action, nil
+		}
+		if spec.Kind == icttUtils.ERC20TokenHomeKind {
+			token, err := exampleerc20.NewExampleERC20(tokenAddress, chain.Backend)
+			if err != nil {
+				return nil, err
+			}
+			decimals, err := token.Decimals(&bind.CallOpts{Context: ctx})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get decimals of token %s", tokenAddress.Hex())
+			}
+			if decimals != spec.TokenDecimals {
+				action.Kind = ActionManual
+				action.Detail = fmt.Sprintf("token decimals are %d, not %d", decimals, spec.TokenDecimals)
+			}
+		}
+		return action, nil
+	}
+}
+
+func (t *Topology) deployHome(
+	ctx context.Context,
+	opts *bind.TransactOpts,
+	chain *Chain,
+	state *State,
+	spec *TokenHomeSpec,
+) (common.Address, *types.Transaction, error) {
+	registryAddress := t.registryAddress(spec.Chain, state)
+	if registryAddress == (common.Address{}) {
+		return common.Address{}, nil, errors.Errorf("no TeleporterRegistry on chain %q", spec.Chain)
+	}
+	manager := spec.TeleporterManager
+	if manager == (common.Address{}) {
+		manager = opts.From
+	}
+	minVersion := spec.MinTeleporterVersion
+	if minVersion == nil {
+		registry, err := teleporterregistry.NewTeleporterRegistry(registryAddress, chain.Backend)
+		if err != nil {
+			return common.Address{}, nil, err
+		}
+		if minVersion, err = registry.LatestVersion(&bind.CallOpts{Context: ctx}); err != nil {
+			return common.Address{}, nil, errors.Wrap(err, "failed to get latest Teleporter version")
+		}
+	}
+	if spec.Kind == icttUtils.NativeTokenHomeKind {
+		address, tx, _, err := nativetokenhome.DeployNativeTokenHome(
+			opts, chain.Backend, registryAddress, manager, minVersion, spec.TokenAddress,
+		)
+		return address, tx, err
+	}
+	address, tx, _, err := erc20tokenhome.DeployERC20TokenHome(
+		opts, chain.Backend, registryAddress, manager, minVersion, spec.TokenAddress, spec.TokenDecimals,
+	)
+	return address, tx, err
+}
+
+func (t *Topology) remoteChecker(ictt *ICTTSpec, spec *TokenRemoteSpec) checker {
+	return func(ctx context.Context, state *State) (*Action, error) {
+		key := ictt.Name + "/" + spec.Chain
+		action := &Action{Kind: ActionNone, Resource: "ictt/" + ictt.Name + "/remote/" + spec.Chain, Chain: spec.Chain}
+		// The remote is registered with the TokenHome under the blockchain ID of its chain, unless it
+		// was deployed under another one.
+		registrationID := t.Spec.chain(spec.Chain).BlockchainID
+		if spec.Address != (common.Address{}) {
+			deployed, err := t.locate(ctx, action, t.Chains[spec.Chain], spec.Address, common.Address{})
+			if err != nil || !deployed {
+				return action, err
+			}
+		} else {
+			deployment := state.TokenRemotes[key]
+			apply := func(ctx context.Context) error {
+				return t.deployRemote(ctx, state, ictt, spec, key)
+			}
+			if deployment == nil || deployment.RemoteAddress == (common.Address{}) {
+				action.Kind = ActionDeploy
+				action.Detail = "deploy " + spec.Kind.String() + " and register it with the TokenHome"
+				action.apply = apply
+				return action, nil
+			}
+			action.Address = deployment.RemoteAddress
+			if !deployment.Done() {
+				action.Kind = ActionConfigure
+				action.Detail = "finish registering the TokenRemote with the TokenHome and collateralizing it"
+				action.apply = apply
+				return action, nil
+			}
+			registrationID = deployment.RemoteBlockchainID
+		}
+
+		problems, err := t.checkRemote(ctx, state, ictt, spec, action.Address, registrationID)
+		if err != nil {
+			return nil, err
+		}
+		if len(problems) > 0 {
+			action.Kind = ActionManual
+			action.Detail = strings.Join(problems, "; ")
+		}
+		return action, nil
+	}
+}
+
+// checkRemote returns how the TokenRemote at [address] differs from [spec]: its kind, TokenHome and
+// decimals, and the TokenHome's registration of it under [registrationID], which defaults to the
+// blockchain ID the remote reports.
+func (t *Topology) checkRemote(
+	ctx context.Context,
+	state *State,
+	ictt *ICTTSpec,
+	spec *TokenRemoteSpec,
+	address common.Address,
+	registrationID ids.ID,
+) ([]string, error) {
+	backend := t.Chains[spec.Chain].Backend
+	kind, err := icttUtils.DetectTransferrerKind(ctx, backend, address)
+	if err != nil {
+		return nil, err
+	}
+	if kind != spec.Kind {
+		return []string{fmt.Sprintf("contract is a %s, not a %s", kind, spec.Kind)}, nil
+	}
+	remote, err := tokenremote.NewTokenRemote(address, backend)
+	if err != nil {
+		return nil, err
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	var problems []string
+
+	homeAddress := spec.TokenHomeAddress
+	if homeAddress == (common.Address{}) {
+		homeAddress = t.homeAddress(ictt, state)
+	}
+	remoteHomeAddress, err := remote.GetTokenHomeAddress(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get TokenHome address of %s", address.Hex())
+	}
+	if homeAddress != (common.Address{}) && remoteHomeAddress != homeAddress {
+		problems = append(problems, fmt.Sprintf("TokenHome is %s, not %s", remoteHomeAddress.Hex(), homeAddress.Hex()))
+	}
+	homeBlockchainID := spec.TokenHomeBlockchainID
+	if homeBlockchainID == (ids.ID{}) {
+		if homeBlockchainID, err = t.blockchainID(ctx, ictt.Home.Chain); err != nil {
+			return nil, err
+		}
+	}
+	remoteHomeBlockchainID, err := remote.GetTokenHomeBlockchainID(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get TokenHome blockchain ID of %s", address.Hex())
+	}
+	if ids.ID(remoteHomeBlockchainID) != homeBlockchainID {
+		problems = append(problems, fmt.Sprintf("TokenHome blockchain ID is %s, not %s",
+			ids.ID(remoteHomeBlockchainID), homeBlockchainID))
+	}
+	if spec.Kind == icttUtils.ERC20TokenRemoteKind {
+		token, err := erc20tokenremote.NewERC20TokenRemote(address, backend)
+		if err != nil {
+			return nil, err
+		}
+		decimals, err := token.Decimals(opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get decimals of %s", address.Hex())
+		}
+		if decimals != spec.TokenDecimals {
+			problems = append(problems, fmt.Sprintf("token decimals are %d, not %d", decimals, spec.TokenDecimals))
+		}
+	}
+
+	if homeAddress == (common.Address{}) {
+		return append(problems, "the TokenHome the remote is registered with is not deployed"), nil
+	}
+	if registrationID == (ids.ID{}) {
+		if registrationID, err = remote.GetBlockchainID(opts); err != nil {
+			return nil, errors.Wrapf(err, "failed to get blockchain ID of %s", address.Hex())
+		}
+	}
+	home, err := erc20tokenhome.NewERC20TokenHome(homeAddress, t.Chains[ictt.Home.Chain].Backend)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := home.GetRemoteTokenTransferrerSettings(opts, registrationID, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get remote settings from the TokenHome")
+	}
+	if !settings.Registered {
+		return append(problems, "the TokenHome "+homeAddress.Hex()+" has no registration of the remote"), nil
+	}
+	// The TokenHome scales amounts by the multiplier the remote derived from the decimals when it
+	// registered.
+	multiplier, err := remote.GetTokenMultiplier(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get token multiplier of %s", address.Hex())
+	}
+	multiplyOnRemote, err := remote.GetMultiplyOnRemote(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get multiply on remote of %s", address.Hex())
+	}
+	if settings.TokenMultiplier.Cmp(multiplier) != 0 || settings.MultiplyOnRemote != multiplyOnRemote {
+		problems = append(problems, fmt.Sprintf(
+			"the TokenHome registered a token multiplier of %s (multiply on remote: %t), not %s (%t)",
+			settings.TokenMultiplier, settings.MultiplyOnRemote, multiplier, multiplyOnRemote))
+	}
+	return problems, nil
+}
+
+// deployRemote deploys, registers and collateralizes the remote with a RemoteDeployer, whose
+// deployment is saved in [state].
+func (t *Topology) deployRemote(
+	ctx context.Context,
+	state *State,
+	ictt *ICTTSpec,
+	spec *TokenRemoteSpec,
+	key string,
+) error {
+	remoteSpec := spec.RemoteSpec
+	if remoteSpec.TeleporterRegistryAddress == (common.Address{}) {
+		remoteSpec.TeleporterRegistryAddress = t.registryAddress(spec.Chain, state)
+		if remoteSpec.TeleporterRegistryAddress == (common.Address{}) {
+			return errors.Errorf("no TeleporterRegistry on chain %q", spec.Chain)
+		}
+	}
+	if remoteSpec.TokenHomeAddress == (common.Address{}) {
+		remoteSpec.TokenHomeAddress = t.homeAddress(ictt, state)
+		if remoteSpec.TokenHomeAddress == (common.Address{}) {
+			return errors.Errorf("TokenHome of %q is not deployed", ictt.Name)
+		}
+	}
+	var err error
+	if remoteSpec.TokenHomeBlockchainID == (ids.ID{}) {
+		if remoteSpec.TokenHomeBlockchainID, err = t.blockchainID(ctx, ictt.Home.Chain); err != nil {
+			return err
+		}
+	}
+	deployment := state.TokenRemotes[key]
+	if deployment == nil {
+		deployment = &icttUtils.RemoteDeployment{}
+		state.TokenRemotes[key] = deployment
+	}
+	if deployment.RemoteBlockchainID == (ids.ID{}) {
+		if deployment.RemoteBlockchainID, err = t.blockchainID(ctx, spec.Chain); err != nil {
+			return err
+		}
+	}
+
+	deployer := icttUtils.NewRemoteDeployer(t.Chains[spec.Chain].Sender, t.Chains[ictt.Home.Chain].Sender)
+	deployer.Relay = t.Relay
+	deployer.PollInterval = t.PollInterval
+	deployer.Save = func(*icttUtils.RemoteDeployment) error {
+		return t.save(state)
+	}
+	return deployer.Deploy(ctx, &remoteSpec, deployment)
+}
+
+// locate sets the action's address to the contract given by the spec, or recorded in the state,
+// and returns whether the contract is deployed. A spec address without code is a manual action,
+// while a state address without code was never accepted, and is deployed again.
+func (t *Topology) locate(
+	ctx context.Context,
+	action *Action,
+	chain *Chain,
+	specAddress common.Address,
+	stateAddress common.Address,
+) (bool, error) {
+	address := specAddress
+	if address == (common.Address{}) {
+		address = stateAddress
+	}
+	if address == (common.Address{}) {
+		return false, nil
+	}
+	deployed, err := hasCode(ctx, chain, address)
+	if err != nil {
+		return false, err
+	}
+	if !deployed && specAddress != (common.Address{}) {
+		action.Kind = ActionManual
+		action.Address = address
+		action.Detail = "no contract at " + address.Hex()
+	}
+	if deployed {
+		action.Address = address
+	}
+	return deployed, nil
+}
+
+// deployValidatorManager deploys a PoAValidatorManager implementation and a TransparentUpgradeableProxy
+// to it, whose ProxyAdmin is owned by [owner]. The proxy is initialized in its constructor, so that the
+// validator manager can't be initialized by anyone else first.
+func (t *Topology) deployValidatorManager(
+	ctx context.Context,
+	chain *Chain,
+	state *State,
+	name string,
+	settings poavalidatormanager.ValidatorManagerSettings,
+	owner common.Address,
+) error {
+	managerABI, err := poavalidatormanager.PoAValidatorManagerMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+	initialize, err := managerABI.Pack("initialize", settings, owner)
+	if err != nil {
+		return errors.Wrap(err, "failed to pack initialize call")
+	}
+	var implementationAddress common.Address
+	_, err = transact(ctx, chain, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		address, tx, _, err := poavalidatormanager.DeployPoAValidatorManager(
+			opts, chain.Backend, icmInitializableDisallowed,
+		)
+		implementationAddress = address
+		return tx, err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to deploy validator manager implementation")
+	}
+	return t.deploy(ctx, chain, state, state.ValidatorManagers, name,
+		func(opts *bind.TransactOpts) (common.Address, *types.Transaction, error) {
+			address, tx, _, err := transparentupgradeableproxy.DeployTransparentUpgradeableProxy(
+				opts, chain.Backend, implementationAddress, owner, initialize,
+			)
+			return address, tx, err
+		})
+}
+
+// deploy deploys a contract with [build], records its address in [addresses] under [key], and
+// saves [state].
+func (t *Topology) deploy(
+	ctx context.Context,
+	chain *Chain,
+	state *State,
+	addresses map[string]common.Address,
+	key string,
+	build func(opts *bind.TransactOpts) (common.Address, *types.Transaction, error),
+) error {
+	var address common.Address
+	_, err := transact(ctx, chain, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		var (
+			tx  *types.Transaction
+			err error
+		)
+		address, tx, err = build(opts)
+		return tx, err
+	})
+	if err != nil {
+		return err
+	}
+	addresses[key] = address
+	return t.save(state)
+}
+
+func (t *Topology) save(state *State) error {
+	if t.Save == nil {
+		return nil
+	}
+	return errors.Wrap(t.Save(state), "failed to save state")
+}
+
+// registryAddress returns the TeleporterRegistry of the chain named [chain], or the zero address
+// if there is none.
+func (t *Topology) registryAddress(chain string, state *State) common.Address {
+	if spec := t.Spec.registry(chain); spec != nil && spec.Address != (common.Address{}) {
+		return spec.Address
+	}
+	return state.Registries[chain]
+}
+
+// homeAddress returns the TokenHome of [ictt], or the zero address if it is not deployed.
+func (t *Topology) homeAddress(ictt *ICTTSpec, state *State) common.Address {
+	if ictt.Home.Address != (common.Address{}) {
+		return ictt.Home.Address
+	}
+	return state.TokenHomes[ictt.Name]
+}
+
+// blockchainID returns the blockchain ID of the chain named [name], from its spec or its Warp precompile.
+func (t *Topology) blockchainID(ctx context.Context, name string) (ids.ID, error) {
+	if blockchainID := t.Spec.chain(name).BlockchainID; blockchainID != (ids.ID{}) {
+		return blockchainID, nil
+	}
+	if blockchainID, ok := t.blockchainIDs[name]; ok {
+		return blockchainID, nil
+	}
+	blockchainID, err := warpBlockchainID(ctx, t.Chains[name], name)
+	if err != nil {
+		return ids.ID{}, err
+	}
+	t.blockchainIDs[name] = blockchainID
+	return blockchainID, nil
+}
+
+// warpBlockchainID returns the blockchain ID the Warp precompile of the chain named [name] returns.
+func warpBlockchainID(ctx context.Context, chain *Chain, name string) (ids.ID, error) {
+	input, err := warp.PackGetBlockchainID()
+	if err != nil {
+		return ids.ID{}, err
+	}
+	output, err := chain.Backend.CallContract(ctx, interfaces.CallMsg{
+		To:   &warp.ContractAddress,
+		Data: input,
+	}, nil)
+	if err != nil {
+		return ids.ID{}, errors.Wrapf(err, "failed to get blockchain ID of chain %q", name)
+	}
+	if len(output) != common.HashLength {
+		return ids.ID{}, errors.Errorf("invalid blockchain ID of chain %q: %x", name, output)
+	}
+	return ids.ID(common.BytesToHash(output)), nil
+}
+
+func hasCode(ctx context.Context, chain *Chain, address common.Address) (bool, error) {
+	code, err := chain.Backend.CodeAt(ctx, address, nil)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get code at %s", address.Hex())
+	}
+	return len(code) > 0, nil
+}
+
+// transact sends the transaction built by [build] with a copy of the chain sender's options, and
+// waits for it to succeed.
+func transact(
+	ctx context.Context,
+	chain *Chain,
+	build func(opts *bind.TransactOpts) (*types.Transaction, error),
+) (*types.Receipt, error) {
+	opts := *chain.Sender.Opts
+	opts.Context = ctx
+	tx, err := build(&opts)
+	if err != nil {
+		return nil, err
+	}
+	return wait(ctx, chain, tx)
+}
+
+func wait(ctx context.Context, chain *Chain, tx *types.Transaction) (*types.Receipt, error) {
+	receipt, err := chain.Sender.Wait(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, errors.Errorf("transaction %s reverted", tx.Hash().Hex())
+	}
+	return receipt, nil
+}
@@ -0,0 +1,569 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	teleportermessenger "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/TeleporterMessenger"
+	teleporterregistry "github.com/ava-labs/icm-contracts/abi-bindings/go/teleporter/registry/TeleporterRegistry"
+	nativetokenstakingmanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/NativeTokenStakingManager"
+	poavalidatormanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/PoAValidatorManager"
+	deploymentUtils "github.com/ava-labs/icm-contracts/utils/deployment-utils"
+	icttUtils "github.com/ava-labs/icm-contracts/utils/ictt-utils"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	upgradeUtils "github.com/ava-labs/icm-contracts/utils/upgrade-utils"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// icmInitializableAllowed is ICMInitializable.Allowed, which lets a validator manager deployed
+// without a proxy be initialized directly.
+const icmInitializableAllowed uint8 = 0
+
+// topologyTestEnv is a topology of two chains on one simulated backend, told apart by placeholder
+// blockchain IDs. Messages are delivered by the receiver test kit's impersonated TeleporterMessenger,
+// which is version 1 of every registry, and sent through a real TeleporterMessenger, which is the
+// spec's version 2.
+type topologyTestEnv struct {
+	kit              *receiverTestUtils.ReceiverTestKit
+	messengerAddress common.Address
+	tokenAddress     common.Address
+	chains           map[string]*Chain
+}
+
+func newTopologyTestEnv(t *testing.T) *topologyTestEnv {
+	ctx := context.Background()
+	kit, err := receiverTestUtils.NewReceiverTestKit()
+	require.NoError(t, err)
+	t.Cleanup(func() { kit.Close() })
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+
+	messengerAddress, tx, _, err := teleportermessenger.DeployTeleporterMessenger(opts, kit.Client())
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	tokenAddress, tx, _, err := exampleerc20.DeployExampleERC20(opts, kit.Client())
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	chain := &Chain{Backend: kit.Client(), Sender: icttUtils.NewTokenSender(kit.Client(), opts, kit.Commit)}
+	return &topologyTestEnv{
+		kit:              kit,
+		messengerAddress: messengerAddress,
+		tokenAddress:     tokenAddress,
+		chains:           map[string]*Chain{"home": chain, "remote": chain},
+	}
+}
+
+func (e *topologyTestEnv) spec() *Spec {
+	entries := []*RegistryEntrySpec{{Version: 1, ProtocolAddress: e.kit.TeleporterMessengerAddress()}}
+	return &Spec{
+		Chains: []*ChainSpec{
+			{Name: "home", BlockchainID: ids.ID{9}},
+			{Name: "remote", BlockchainID: ids.ID{8}},
+		},
+		Teleporter: &TeleporterSpec{MessengerAddress: e.messengerAddress, Version: 2},
+		Registries: []*RegistrySpec{
+			{Chain: "home", Entries: entries},
+			{Chain: "remote", Entries: entries},
+		},
+		ICTT: []*ICTTSpec{{
+			Name: "example",
+			Home: &TokenHomeSpec{
+				Chain:         "home",
+				Kind:          icttUtils.ERC20TokenHomeKind,
+				TokenAddress:  e.tokenAddress,
+				TokenDecimals: 18,
+				// Deliveries come from the impersonated messenger.
+				MinTeleporterVersion: big.NewInt(1),
+			},
+			Remotes: []*TokenRemoteSpec{{
+				Chain: "remote",
+				RemoteSpec: icttUtils.RemoteSpec{
+					Kind:          icttUtils.ERC20TokenRemoteKind,
+					TokenName:     "Example",
+					TokenSymbol:   "EXMPL",
+					TokenDecimals: 18,
+				},
+			}},
+		}},
+		ValidatorSetSigs: []*ValidatorSetSigSpec{
+			{Name: "governor", Chain: "home", ValidatorBlockchainID: ids.ID{8}},
+		},
+		ValidatorManagers: []*ValidatorManagerSpec{{
+			Name:                   "poa",
+			Chain:                  "remote",
+			Kind:                   PoAValidatorManagerKind,
+			L1ID:                   ids.ID{7},
+			ChurnPeriodSeconds:     3600,
+			MaximumChurnPercentage: 20,
+		}},
+	}
+}
+
+// relay delivers the registration messages of TokenRemote instances from the "remote" chain.
+func (e *topologyTestEnv) relay(t *testing.T) icttUtils.MessageRelayer {
+	return func(ctx context.Context, receipt *types.Receipt) error {
+		filterer, err := teleportermessenger.NewTeleporterMessengerFilterer(common.Address{}, nil)
+		require.NoError(t, err)
+		event, err := receiverTestUtils.GetEventFromReceipt(receipt, filterer.ParseSendCrossChainMessage)
+		require.NoError(t, err)
+		result, err := e.kit.DeliverMessage(ctx, event.Message.DestinationAddress, ids.ID{8},
+			event.Message.OriginSenderAddress, event.Message.Message, event.Message.RequiredGasLimit.Uint64())
+		require.NoError(t, err)
+		receiverTestUtils.RequireDelivered(t, result)
+		return nil
+	}
+}
+
+func resources(actions []*Action) map[string]ActionKind {
+	kinds := make(map[string]ActionKind)
+	for _, action := range actions {
+		kinds[action.Resource] = action.Kind
+	}
+	return kinds
+}
+
+func TestTopologyApply(t *testing.T) {
+	ctx := context.Background()
+	env := newTopologyTestEnv(t)
+	spec := env.spec()
+	require.NoError(t, spec.Validate())
+
+	topology := NewTopology(spec, env.chains)
+	state := NewState()
+	plan, err := topology.Plan(ctx, state)
+	require.NoError(t, err)
+	require.Equal(t, map[string]ActionKind{
+		"teleporter/home":            ActionNone,
+		"teleporter/remote":          ActionNone,
+		"registry/home":              ActionDeploy,
+		"registry/remote":            ActionDeploy,
+		"validator-set-sig/governor": ActionDeploy,
+		"validator-manager/poa":      ActionDeploy,
+		"ictt/example/home":          ActionDeploy,
+		"ictt/example/remote/remote": ActionDeploy,
+	}, resources(plan.Actions))
+	require.Len(t, plan.Changes(), 6)
+
+	topology.Relay = env.relay(t)
+	saves := 0
+	topology.Save = func(saved *State) error {
+		require.Same(t, state, saved)
+		saves++
+		return nil
+	}
+	plan, err = topology.Apply(ctx, state)
+	require.NoError(t, err)
+	require.Empty(t, plan.Changes())
+	require.Positive(t, saves)
+
+	// The registries were deployed with the spec's entries and the Teleporter version.
+	registry, err := teleporterregistry.NewTeleporterRegistry(state.Registries["remote"], env.kit.Client())
+	require.NoError(t, err)
+	latest, err := registry.LatestVersion(nil)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(2), latest)
+	address, err := registry.GetAddressFromVersion(nil, latest)
+	require.NoError(t, err)
+	require.Equal(t, env.messengerAddress, address)
+	require.NotEqual(t, state.Registries["home"], state.Registries["remote"])
+
+	require.NotEqual(t, common.Address{}, state.TokenHomes["example"])
+	remote := state.TokenRemotes["example/remote"]
+	require.True(t, remote.Done())
+	require.Equal(t, ids.ID{8}, remote.RemoteBlockchainID)
+	require.NotEqual(t, common.Address{}, state.ValidatorSetSigs["governor"])
+
+	manager, err := poavalidatormanager.NewPoAValidatorManager(state.ValidatorManagers["poa"], env.kit.Client())
+	require.NoError(t, err)
+	owner, err := manager.Owner(nil)
+	require.NoError(t, err)
+	require.Equal(t, env.kit.DeployerAddress, owner)
+
+	// The manager is a proxy that was initialized on deployment, and its implementation can't be
+	// initialized.
+	slot, err := env.kit.Client().StorageAt(ctx, state.ValidatorManagers["poa"], upgradeUtils.ImplementationSlot, nil)
+	require.NoError(t, err)
+	implementation, err := poavalidatormanager.NewPoAValidatorManager(common.BytesToAddress(slot), env.kit.Client())
+	require.NoError(t, err)
+	opts, err := env.kit.DeployerTransactor()
+	require.NoError(t, err)
+	_, err = implementation.Initialize(opts, poavalidatormanager.ValidatorManagerSettings{}, env.kit.DeployerAddress)
+	require.Error(t, err)
+
+	// Applying again changes nothing.
+	saves = 0
+	plan, err = topology.Apply(ctx, state)
+	require.NoError(t, err)
+	require.Empty(t, plan.Changes())
+	require.Zero(t, saves)
+
+	// Changes that Apply can't make are left to be taken manually.
+	spec.Registries[0].Entries = append(spec.Registries[0].Entries,
+		&RegistryEntrySpec{Version: 3, ProtocolAddress: common.Address{3}})
+	spec.ValidatorManagers[0].ChurnPeriodSeconds = 60
+	spec.ValidatorSetSigs[0].Address = common.Address{4}
+	plan, err = topology.Apply(ctx, state)
+	require.NoError(t, err)
+	changes := plan.Changes()
+	require.Equal(t, map[string]ActionKind{
+		"registry/home":              ActionManual,
+		"validator-set-sig/governor": ActionManual,
+		"validator-manager/poa":      ActionManual,
+	}, resources(changes))
+	require.Contains(t, changes[0].Detail, "version 3 is not registered")
+	require.Contains(t, changes[1].Detail, "no contract at "+common.Address{4}.Hex())
+	require.Contains(t, changes[2].Detail, "churn period is 3600s, not 60s")
+}
+
+func TestTopologyExistingRemote(t *testing.T) {
+	ctx := context.Background()
+	env := newTopologyTestEnv(t)
+	topology := NewTopology(env.spec(), env.chains)
+	topology.Relay = env.relay(t)
+	deployed := NewState()
+	_, err := topology.Apply(ctx, deployed)
+	require.NoError(t, err)
+
+	// A spec can declare the home and remote it already has, which are checked against the chains
+	// without any state.
+	spec := env.spec()
+	spec.ICTT[0].Home.Address = deployed.TokenHomes["example"]
+	remoteSpec := spec.ICTT[0].Remotes[0]
+	remoteSpec.Address = deployed.TokenRemotes["example/remote"].RemoteAddress
+	remoteSpec.TokenName, remoteSpec.TokenSymbol = "", ""
+	require.NoError(t, spec.Validate())
+	topology = NewTopology(spec, env.chains)
+	plan, err := topology.Plan(ctx, NewState())
+	require.NoError(t, err)
+	kinds := resources(plan.Actions)
+	require.Equal(t, ActionNone, kinds["ictt/example/home"])
+	require.Equal(t, ActionNone, kinds["ictt/example/remote/remote"])
+
+	remoteAction := func() *Action {
+		plan, err := topology.Plan(ctx, NewState())
+		require.NoError(t, err)
+		return plan.Actions[len(plan.Actions)-1]
+	}
+	remoteSpec.TokenDecimals = 6
+	remoteSpec.TokenHomeBlockchainID = ids.ID{7}
+	action := remoteAction()
+	require.Equal(t, "ictt/example/remote/remote", action.Resource)
+	require.Equal(t, ActionManual, action.Kind)
+	require.Equal(t, "TokenHome blockchain ID is "+ids.ID{9}.String()+", not "+ids.ID{7}.String()+
+		"; token decimals are 18, not 6", action.Detail)
+
+	// The TokenHome registered the remote under the blockchain ID of its chain.
+	remoteSpec.TokenDecimals = 18
+	remoteSpec.TokenHomeBlockchainID = ids.ID{}
+	spec.Chains[1].BlockchainID = ids.ID{6}
+	topology = NewTopology(spec, env.chains)
+	action = remoteAction()
+	require.Equal(t, ActionManual, action.Kind)
+	require.Contains(t, action.Detail, "has no registration of the remote")
+
+	remoteSpec.Address = common.Address{5}
+	action = remoteAction()
+	require.Equal(t, ActionManual, action.Kind)
+	require.Equal(t, "no contract at "+common.Address{5}.Hex(), action.Detail)
+
+	spec.Chains[1].BlockchainID = ids.ID{8}
+	spec.ICTT[0].Home.TokenDecimals = 6
+	plan, err = topology.Plan(ctx, NewState())
+	require.NoError(t, err)
+	for _, action := range plan.Actions {
+		if action.Resource == "ictt/example/home" {
+			require.Equal(t, ActionManual, action.Kind)
+			require.Equal(t, "token decimals are 18, not 6", action.Detail)
+		}
+	}
+}
+
+func TestTopologyConfigure(t *testing.T) {
+	ctx := context.Background()
+	env := newTopologyTestEnv(t)
+	spec := env.spec()
+	spec.ICTT = nil
+
+	// A validator manager deployed without being initialized is initialized.
+	opts := env.chains["remote"].Sender.Opts
+	managerAddress, tx, _, err := poavalidatormanager.DeployPoAValidatorManager(
+		opts, env.kit.Client(), icmInitializableAllowed,
+	)
+	require.NoError(t, err)
+	_, err = env.kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	spec.ValidatorManagers[0].Address = managerAddress
+
+	topology := NewTopology(spec, env.chains)
+	state := NewState()
+	plan, err := topology.Plan(ctx, state)
+	require.NoError(t, err)
+	require.Equal(t, ActionConfigure, resources(plan.Actions)["validator-manager/poa"])
+
+	plan, err = topology.Apply(ctx, state)
+	require.NoError(t, err)
+	require.Empty(t, plan.Changes())
+	require.Empty(t, state.ValidatorManagers)
+
+	// A Teleporter version that isn't deployed can only be deployed from a bytecode file.
+	spec.Teleporter.MessengerAddress = common.Address{5}
+	spec.Registries = nil
+	plan, err = topology.Plan(ctx, state)
+	require.NoError(t, err)
+	teleporter := plan.Actions[0]
+	require.Equal(t, ActionManual, teleporter.Kind)
+	require.Contains(t, teleporter.Detail, "no bytecode file")
+
+	// Apply needs a sender for every chain.
+	_, err = NewTopology(spec, map[string]*Chain{
+		"home":   env.chains["home"],
+		"remote": {Backend: env.kit.Client()},
+	}).Apply(ctx, state)
+	require.ErrorContains(t, err, `no sender for chain "remote"`)
+	_, err = NewTopology(spec, map[string]*Chain{"home": env.chains["home"]}).Plan(ctx, state)
+	require.ErrorContains(t, err, `no backend for chain "remote"`)
+}
+
+func TestTopologyStakingManager(t *testing.T) {
+	ctx := context.Background()
+	env := newTopologyTestEnv(t)
+	spec := env.spec()
+	spec.ICTT = nil
+
+	// A staking manager has no owner, and is only checked once it is initialized.
+	opts := env.chains["remote"].Sender.Opts
+	managerAddress, tx, manager, err := nativetokenstakingmanager.DeployNativeTokenStakingManager(
+		opts, env.kit.Client(), icmInitializableAllowed,
+	)
+	require.NoError(t, err)
+	_, err = env.kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	managerSpec := spec.ValidatorManagers[0]
+	managerSpec.Name = "staking"
+	managerSpec.Kind = "NativeTokenStakingManager"
+	managerSpec.Address = managerAddress
+	require.NoError(t, spec.Validate())
+	topology := NewTopology(spec, env.chains)
+	state := NewState()
+	plan, err := topology.Plan(ctx, state)
+	require.NoError(t, err)
+	action := plan.Actions[len(plan.Actions)-1]
+	require.Equal(t, ActionManual, action.Kind)
+	require.Equal(t, "validator manager is not initialized", action.Detail)
+
+	tx, err = manager.Initialize(opts, nativetokenstakingmanager.PoSValidatorManagerSettings{
+		BaseSettings: nativetokenstakingmanager.ValidatorManagerSettings{
+			L1ID:                   managerSpec.L1ID,
+			ChurnPeriodSeconds:     managerSpec.ChurnPeriodSeconds,
+			MaximumChurnPercentage: managerSpec.MaximumChurnPercentage,
+		},
+		MinimumStakeAmount:       big.NewInt(1),
+		MaximumStakeAmount:       big.NewInt(1e18),
+		MinimumStakeDuration:     managerSpec.ChurnPeriodSeconds,
+		MinimumDelegationFeeBips: 1,
+		MaximumStakeMultiplier:   1,
+		WeightToValueFactor:      big.NewInt(1),
+		RewardCalculator:         common.Address{1},
+		UptimeBlockchainID:       ids.ID{2},
+	})
+	require.NoError(t, err)
+	_, err = env.kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	plan, err = topology.Plan(ctx, state)
+	require.NoError(t, err)
+	require.Equal(t, ActionNone, plan.Actions[len(plan.Actions)-1].Kind)
+
+	managerSpec.MaximumChurnPercentage = 30
+	plan, err = topology.Plan(ctx, state)
+	require.NoError(t, err)
+	action = plan.Actions[len(plan.Actions)-1]
+	require.Equal(t, ActionManual, action.Kind)
+	require.Equal(t, "maximum churn percentage is 20, not 30", action.Detail)
+
+	managerSpec.Kind = "ERC20TokenStakingManager"
+	plan, err = topology.Plan(ctx, state)
+	require.NoError(t, err)
+	action = plan.Actions[len(plan.Actions)-1]
+	require.Equal(t, ActionManual, action.Kind)
+	require.Equal(t, "contract is a NativeTokenStakingManager, not a ERC20TokenStakingManager", action.Detail)
+}
+
+func TestTopologyDeployTeleporter(t *testing.T) {
+	ctx := context.Background()
+	env := newTopologyTestEnv(t)
+	bytecodeFile := filepath.Join(t.TempDir(), "TeleporterMessenger.json")
+	data, err := json.Marshal(map[string]map[string]string{
+		"bytecode": {"object": teleportermessenger.TeleporterMessengerMetaData.Bin},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(bytecodeFile, data, 0o600))
+	_, _, deployerAddress, messengerAddress, err := deploymentUtils.ConstructKeylessTransaction(
+		bytecodeFile, false, deploymentUtils.GetDefaultContractCreationGasPrice(),
+	)
+	require.NoError(t, err)
+
+	// The messenger is only deployed from the bytecode file, by a keyless deployer without funds.
+	spec := &Spec{
+		Chains:     []*ChainSpec{{Name: "home", BlockchainID: ids.ID{9}}},
+		Teleporter: &TeleporterSpec{MessengerAddress: messengerAddress, Version: 1, BytecodeFile: bytecodeFile},
+		Registries: []*RegistrySpec{{Chain: "home"}},
+	}
+	require.NoError(t, spec.Validate())
+	topology := NewTopology(spec, map[string]*Chain{"home": env.chains["home"]})
+	state := NewState()
+	plan, err := topology.Plan(ctx, state)
+	require.NoError(t, err)
+	require.Equal(t, map[string]ActionKind{
+		"teleporter/home": ActionDeploy,
+		"registry/home":   ActionDeploy,
+	}, resources(plan.Actions))
+
+	plan, err = topology.Apply(ctx, state)
+	require.NoError(t, err)
+	require.Empty(t, plan.Changes())
+	code, err := env.kit.Client().CodeAt(ctx, messengerAddress, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, code)
+	nonce, err := env.kit.Client().NonceAt(ctx, deployerAddress, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), nonce)
+
+	// The registry was deployed with the messenger as its latest version.
+	registry, err := teleporterregistry.NewTeleporterRegistry(state.Registries["home"], env.kit.Client())
+	require.NoError(t, err)
+	address, err := registry.GetAddressFromVersion(nil, big.NewInt(1))
+	require.NoError(t, err)
+	require.Equal(t, messengerAddress, address)
+
+	// A bytecode file that deploys the messenger elsewhere is rejected.
+	spec.Teleporter.MessengerAddress = common.Address{5}
+	spec.Registries = nil
+	_, err = topology.Apply(ctx, NewState())
+	require.ErrorContains(t, err, "bytecode file deploys TeleporterMessenger to "+messengerAddress.Hex())
+}
+
+func TestReadSpec(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	spec, err := ReadSpec(write("topology.yaml", `
+chains:
+  - name: c
+    rpc: http://localhost:9650/ext/bc/C/rpc
+  - name: l1
+    rpc: http://localhost:9650/ext/bc/l1/rpc
+teleporter:
+  messengerAddress: "0x253b2784c75e510dD0fF1da844684a1aC0aa5fcf"
+  version: 1
+registries:
+  - chain: c
+  - chain: l1
+ictt:
+  - name: usdc
+    home:
+      chain: c
+      kind: ERC20TokenHome
+      tokenAddress: "0x0000000000000000000000000000000000000001"
+      tokenDecimals: 6
+    remotes:
+      - chain: l1
+        kind: NativeTokenRemote
+        nativeAssetSymbol: USDC
+        initialReserveImbalance: 1000000000000000000
+validatorManagers:
+  - name: poa
+    chain: l1
+    kind: PoAValidatorManager
+    l1ID: 2oYMBNV4eNHyqk2fjjV5nVQLDbtmNJzq5s3qs3Lo6ftnC6FByM
+    churnPeriodSeconds: 3600
+    maximumChurnPercentage: 20
+`))
+	require.NoError(t, err)
+	require.Len(t, spec.Chains, 2)
+	require.Equal(t, icttUtils.NativeTokenRemoteKind, spec.ICTT[0].Remotes[0].Kind)
+	require.Equal(t, "1000000000000000000", spec.ICTT[0].Remotes[0].InitialReserveImbalance.String())
+	require.Equal(t, []*RegistryEntrySpec{{
+		Version:         1,
+		ProtocolAddress: common.HexToAddress("0x253b2784c75e510dD0fF1da844684a1aC0aa5fcf"),
+	}}, spec.registryEntries(spec.Registries[0]))
+
+	_, err = ReadSpec(write("unknown.json", `{"chains": [], "bridges": []}`))
+	require.ErrorContains(t, err, `unknown field "bridges"`)
+	_, err = ReadSpec(filepath.Join(dir, "missing.json"))
+	require.ErrorContains(t, err, "failed to read spec")
+
+	tests := []struct {
+		name   string
+		modify func(spec *Spec)
+		err    string
+	}{
+		{
+			name:   "duplicate chain",
+			modify: func(spec *Spec) { spec.Chains = append(spec.Chains, &ChainSpec{Name: "c"}) },
+			err:    `duplicate chain "c"`,
+		},
+		{
+			name:   "unknown chain",
+			modify: func(spec *Spec) { spec.Registries[0].Chain = "x" },
+			err:    `registry: unknown chain "x"`,
+		},
+		{
+			name: "conflicting teleporter entry",
+			modify: func(spec *Spec) {
+				spec.Registries[0].Entries = []*RegistryEntrySpec{{Version: 1, ProtocolAddress: common.Address{1}}}
+			},
+			err: `registry on "c": version 1 is not the teleporter messenger address`,
+		},
+		{
+			name:   "duplicate name",
+			modify: func(spec *Spec) { spec.ValidatorManagers[0].Name = "usdc" },
+			err:    `duplicate name "usdc"`,
+		},
+		{
+			name:   "remote kind as home",
+			modify: func(spec *Spec) { spec.ICTT[0].Home.Kind = icttUtils.ERC20TokenRemoteKind },
+			err:    "ERC20TokenRemote is not a TokenHome",
+		},
+		{
+			name:   "home without registry",
+			modify: func(spec *Spec) { spec.Registries = spec.Registries[1:] },
+			err:    `no registry on chain "c" to deploy the home with`,
+		},
+		{
+			name:   "invalid remote",
+			modify: func(spec *Spec) { spec.ICTT[0].Remotes[0].NativeAssetSymbol = "" },
+			err:    `ictt "usdc": remote on "l1"`,
+		},
+		{
+			name:   "staking manager",
+			modify: func(spec *Spec) { spec.ValidatorManagers[0].Kind = "NativeTokenStakingManager" },
+			err:    `only a PoAValidatorManager can be deployed`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := ReadSpec(filepath.Join(dir, "topology.yaml"))
+			require.NoError(t, err)
+			test.modify(spec)
+			require.ErrorContains(t, spec.Validate(), test.err)
+		})
+	}
+}
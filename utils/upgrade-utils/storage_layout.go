@@ -0,0 +1,245 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// RootLayout is the name CompareStorageLayouts reports the storage variables of a contract under,
+// as opposed to its ERC-7201 namespaces.
+const RootLayout = "storage"
+
+// StorageLayout is the storage layout solc outputs for a contract, as forge writes it to the
+// "storageLayout" of an artifact built with extra_output = ["storageLayout"]. Solc leaves out the
+// ERC-7201 namespaced structs that upgradeable contracts keep their state in, so their layouts are
+// kept in Namespaces, keyed by "erc7201:ID". Namespace slots are relative to the namespace's location.
+type StorageLayout struct {
+	Storage    []*StorageItem            `json:"storage"`
+	Types      map[string]*StorageType   `json:"types"`
+	Namespaces map[string][]*StorageItem `json:"namespaces"`
+}
+
+// StorageItem is a storage variable or struct member.
+type StorageItem struct {
+	Label  string `json:"label"`
+	Offset uint64 `json:"offset"`
+	Slot   string `json:"slot"`
+	// Type is a key of StorageLayout.Types.
+	Type string `json:"type"`
+}
+
+// StorageType is a type of a StorageLayout. Encoding is "inplace", "mapping", "dynamic_array" or
+// "bytes". Members are set for structs, Key and Value for mappings, and Base for arrays.
+type StorageType struct {
+	Encoding      string         `json:"encoding"`
+	Label         string         `json:"label"`
+	NumberOfBytes string         `json:"numberOfBytes"`
+	Members       []*StorageItem `json:"members"`
+	Key           string         `json:"key"`
+	Value         string         `json:"value"`
+	Base          string         `json:"base"`
+}
+
+// StorageLayoutError is an incompatibility between the storage layouts of two implementations.
+type StorageLayoutError struct {
+	// Layout is RootLayout or the ID of an ERC-7201 namespace.
+	Layout string
+	// Label is the path of the variable in the layout, such as "remoteSettings.registered".
+	Label   string
+	Message string
+}
+
+func (e *StorageLayoutError) String() string {
+	if e.Label == "" {
+		return fmt.Sprintf("%s: %s", e.Layout, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Layout, e.Label, e.Message)
+}
+
+// ReadStorageLayout reads the storage layout of a forge artifact, or a storage layout file. If the
+// artifact was built with --ast, the layouts of the ERC-7201 namespaces of the contract and its base
+// contracts are built from their struct definitions annotated with @custom:storage-location, using
+// the other artifacts of the build in the same output directory. A storage layout file may give the
+// namespaces under "namespaces", as OpenZeppelin's upgrades-core extracts them.
+func ReadStorageLayout(path string) (*StorageLayout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read storage layout")
+	}
+	var artifact struct {
+		StorageLayout *StorageLayout `json:"storageLayout"`
+		AST           *astNode       `json:"ast"`
+	}
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, errors.Wrap(err, "failed to decode storage layout")
+	}
+	if artifact.StorageLayout != nil {
+		if artifact.AST != nil && artifact.StorageLayout.Namespaces == nil {
+			// Forge names artifacts after their contract, as CONTRACT.json or CONTRACT.VERSION.json.
+			contractName, _, _ := strings.Cut(filepath.Base(path), ".")
+			outDir := filepath.Dir(filepath.Dir(path))
+			if err := readNamespaces(outDir, contractName, artifact.AST, artifact.StorageLayout); err != nil {
+				return nil, errors.Wrap(err, "failed to read ERC-7201 namespaces")
+			}
+		}
+		return artifact.StorageLayout, nil
+	}
+	layout := &StorageLayout{}
+	if err := json.Unmarshal(data, layout); err != nil {
+		return nil, errors.Wrap(err, "failed to decode storage layout")
+	}
+	if layout.Storage == nil && layout.Namespaces == nil {
+		return nil, errors.Errorf("%s has no storage layout", path)
+	}
+	return layout, nil
+}
+
+// ERC7201Location returns the storage location of the ERC-7201 namespace [id], without the
+// "erc7201:" prefix: keccak256(abi.encode(uint256(keccak256(id)) - 1)) & ~bytes32(uint256(0xff)).
+func ERC7201Location(id string) common.Hash {
+	hash := crypto.Keccak256Hash([]byte(id)).Big()
+	location := crypto.Keccak256Hash(common.BigToHash(hash.Sub(hash, common.Big1)).Bytes())
+	location[common.HashLength-1] = 0
+	return location
+}
+
+// CompareStorageLayouts returns the ways in which the storage layout [next] of a new implementation
+// would corrupt the state written with the layout [prev]. Variables and struct members may only
+// be added after the existing ones, and existing ones must keep their slot, offset and type. A
+// struct may only grow if it is the last variable of its layout or the value of a mapping, since
+// growing it would otherwise move the variables after it. Renaming a variable, or removing an
+// ERC-7201 namespace, is an error too. An empty [prev] is an error, since it would pass any layout,
+// and usually means the artifact was built without --ast.
+func CompareStorageLayouts(prev, next *StorageLayout) []*StorageLayoutError {
+	c := &layoutComparer{prev: prev, next: next}
+	if len(prev.Storage) == 0 && len(prev.Namespaces) == 0 {
+		c.report(RootLayout, "", "the current layout has no variables or namespaces to check")
+		return c.errs
+	}
+	c.compareItems(RootLayout, "", prev.Storage, next.Storage, true)
+	namespaces := make([]string, 0, len(prev.Namespaces))
+	for namespace := range prev.Namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		nextItems, ok := next.Namespaces[namespace]
+		if !ok {
+			c.report(namespace, "", "namespace was removed")
+			continue
+		}
+		c.compareItems(namespace, "", prev.Namespaces[namespace], nextItems, true)
+	}
+	return c.errs
+}
+
+type layoutComparer struct {
+	prev, next *StorageLayout
+	errs       []*StorageLayoutError
+}
+
+func (c *layoutComparer) report(layout, label, format string, args ...interface{}) {
+	c.errs = append(c.errs, &StorageLayoutError{Layout: layout, Label: label, Message: fmt.Sprintf(format, args...)})
+}
+
+// compareItems compares the variables or struct members [prev] and [next] in order. The last of
+// them may grow if [growable].
+func (c *layoutComparer) compareItems(layout, path string, prev, next []*StorageItem, growable bool) {
+	for i, prevItem := range prev {
+		label := joinLabel(path, prevItem.Label)
+		if i >= len(next) {
+			c.report(layout, label, "was removed")
+			continue
+		}
+		nextItem := next[i]
+		if nextItem.Label != prevItem.Label {
+			c.report(layout, label, "was replaced by %s", nextItem.Label)
+			continue
+		}
+		if nextItem.Slot != prevItem.Slot || nextItem.Offset != prevItem.Offset {
+			c.report(layout, label, "moved from slot %s offset %d to slot %s offset %d",
+				prevItem.Slot, prevItem.Offset, nextItem.Slot, nextItem.Offset)
+			continue
+		}
+		c.compareTypes(layout, label, prevItem.Type, nextItem.Type, growable && i == len(prev)-1)
+	}
+}
+
+// compareTypes compares the types [prev] and [next] of the variable [label]. The size of the type
+// may grow if [growable].
+func (c *layoutComparer) compareTypes(layout, label, prev, next string, growable bool) {
+	prevType, nextType := c.prev.Types[prev], c.next.Types[next]
+	if prevType == nil || nextType == nil {
+		if prev != next {
+			c.report(layout, label, "type changed from %s to %s", prev, next)
+		}
+		return
+	}
+	if prevType.Encoding != nextType.Encoding {
+		c.report(layout, label, "type changed from %s to %s", prevType.Label, nextType.Label)
+		return
+	}
+	switch {
+	case prevType.Encoding == "mapping":
+		c.compareTypes(layout, label+"[key]", prevType.Key, nextType.Key, false)
+		c.compareTypes(layout, label+"[value]", prevType.Value, nextType.Value, true)
+		return
+	case prevType.Encoding == "dynamic_array":
+		// Elements are contiguous, so they can't grow.
+		c.compareTypes(layout, label+"[]", prevType.Base, nextType.Base, false)
+		return
+	case prevType.Members != nil || nextType.Members != nil:
+		if prevType.Members == nil || nextType.Members == nil {
+			c.report(layout, label, "type changed from %s to %s", prevType.Label, nextType.Label)
+			return
+		}
+		c.compareItems(layout, label, prevType.Members, nextType.Members, growable)
+		if len(nextType.Members) > len(prevType.Members) && !growable {
+			c.report(layout, label, "members were added to %s, which moves the variables after it",
+				nextType.Label)
+		}
+		return
+	case prevType.Base != "":
+		c.compareTypes(layout, label+"[]", prevType.Base, nextType.Base, false)
+	case !compatibleLabels(prevType.Label, nextType.Label):
+		c.report(layout, label, "type changed from %s to %s", prevType.Label, nextType.Label)
+		return
+	}
+	if prevType.NumberOfBytes != nextType.NumberOfBytes && !growable {
+		c.report(layout, label, "size changed from %s to %s bytes", prevType.NumberOfBytes, nextType.NumberOfBytes)
+	}
+}
+
+// compatibleLabels returns whether values of the types labeled [prev] and [next] are stored the same
+// way. Contracts are stored as addresses, and enums as their index, so enums may be renamed or get
+// new values as long as their size does not change.
+func compatibleLabels(prev, next string) bool {
+	if prev == next {
+		return true
+	}
+	isAddress := func(label string) bool {
+		return label == "address" || label == "address payable" || strings.HasPrefix(label, "contract ")
+	}
+	if isAddress(prev) && isAddress(next) {
+		return true
+	}
+	return strings.HasPrefix(prev, "enum ") && strings.HasPrefix(next, "enum ")
+}
+
+func joinLabel(path, label string) string {
+	if path == "" {
+		return label
+	}
+	return path + "." + label
+}
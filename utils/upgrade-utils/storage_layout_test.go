@@ -0,0 +1,404 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+const tokenHomeNamespace = "erc7201:avalanche-ictt.storage.TokenHome"
+
+// testArtifact is a forge artifact with a storage layout shaped like TokenHome's, whose state is
+// in an ERC-7201 namespace.
+const testArtifact = `{
+  "abi": [],
+  "storageLayout": {
+    "storage": [],
+    "types": {
+      "t_address": {"encoding": "inplace", "label": "address", "numberOfBytes": "20"},
+      "t_bool": {"encoding": "inplace", "label": "bool", "numberOfBytes": "1"},
+      "t_bytes32": {"encoding": "inplace", "label": "bytes32", "numberOfBytes": "32"},
+      "t_uint8": {"encoding": "inplace", "label": "uint8", "numberOfBytes": "1"},
+      "t_uint256": {"encoding": "inplace", "label": "uint256", "numberOfBytes": "32"},
+      "t_contract(IERC20)10": {"encoding": "inplace", "label": "contract IERC20", "numberOfBytes": "20"},
+      "t_struct(Settings)20_storage": {
+        "encoding": "inplace",
+        "label": "struct TokenHome.Settings",
+        "numberOfBytes": "64",
+        "members": [
+          {"label": "registered", "offset": 0, "slot": "0", "type": "t_bool"},
+          {"label": "collateralNeeded", "offset": 0, "slot": "1", "type": "t_uint256"}
+        ]
+      },
+      "t_mapping(t_bytes32,t_struct(Settings)20_storage)": {
+        "encoding": "mapping",
+        "key": "t_bytes32",
+        "label": "mapping(bytes32 => struct TokenHome.Settings)",
+        "numberOfBytes": "32",
+        "value": "t_struct(Settings)20_storage"
+      },
+      "t_array(t_uint256)dyn_storage": {
+        "base": "t_uint256",
+        "encoding": "dynamic_array",
+        "label": "uint256[]",
+        "numberOfBytes": "32"
+      }
+    },
+    "namespaces": {
+      "erc7201:avalanche-ictt.storage.TokenHome": [
+        {"label": "_token", "offset": 0, "slot": "0", "type": "t_contract(IERC20)10"},
+        {"label": "_decimals", "offset": 20, "slot": "0", "type": "t_uint8"},
+        {"label": "_settings", "offset": 0, "slot": "1", "type": "t_mapping(t_bytes32,t_struct(Settings)20_storage)"},
+        {"label": "_fixed", "offset": 0, "slot": "2", "type": "t_struct(Settings)20_storage"},
+        {"label": "_amounts", "offset": 0, "slot": "4", "type": "t_array(t_uint256)dyn_storage"}
+      ]
+    }
+  }
+}`
+
+func TestReadStorageLayout(t *testing.T) {
+	dir := t.TempDir()
+	artifactPath := filepath.Join(dir, "TokenHome.json")
+	require.NoError(t, os.WriteFile(artifactPath, []byte(testArtifact), 0o600))
+	layout, err := ReadStorageLayout(artifactPath)
+	require.NoError(t, err)
+	require.Len(t, layout.Namespaces[tokenHomeNamespace], 5)
+	require.Equal(t, "mapping", layout.Types["t_mapping(t_bytes32,t_struct(Settings)20_storage)"].Encoding)
+
+	// A bare storage layout, as "forge inspect CONTRACT storageLayout" prints it.
+	data, err := json.Marshal(layout)
+	require.NoError(t, err)
+	layoutPath := filepath.Join(dir, "layout.json")
+	require.NoError(t, os.WriteFile(layoutPath, data, 0o600))
+	read, err := ReadStorageLayout(layoutPath)
+	require.NoError(t, err)
+	require.Equal(t, layout, read)
+
+	abiPath := filepath.Join(dir, "abi.json")
+	require.NoError(t, os.WriteFile(abiPath, []byte(`{"abi": []}`), 0o600))
+	_, err = ReadStorageLayout(abiPath)
+	require.ErrorContains(t, err, "has no storage layout")
+	_, err = ReadStorageLayout(filepath.Join(dir, "missing.json"))
+	require.ErrorContains(t, err, "failed to read storage layout")
+}
+
+// TestReadStorageLayoutFromAST reads the namespaces of the artifacts in testdata/out, which are laid
+// out as forge writes them with --ast, trimmed to the nodes of ERC20TokenHomeUpgradeable and its bases
+// that declare storage.
+func TestReadStorageLayoutFromAST(t *testing.T) {
+	layout, err := ReadStorageLayout(
+		filepath.Join("testdata", "out", "ERC20TokenHomeUpgradeable.sol", "ERC20TokenHomeUpgradeable.json"),
+	)
+	require.NoError(t, err)
+	require.Empty(t, layout.Storage)
+	item := func(label string, offset uint64, slot, typ string) *StorageItem {
+		return &StorageItem{Label: label, Offset: offset, Slot: slot, Type: typ}
+	}
+	settingsType := "t_struct(RemoteTokenTransferrerSettings)_storage"
+	require.Equal(t, map[string][]*StorageItem{
+		"erc7201:avalanche-ictt.storage.ERC20TokenHome": {
+			item("_token", 0, "0", "t_contract(IERC20)"),
+		},
+		tokenHomeNamespace: {
+			item("_blockchainID", 0, "0", "t_bytes32"),
+			item("_tokenAddress", 0, "1", "t_address"),
+			item("_tokenDecimals", 20, "1", "t_uint8"),
+			item("_registeredRemotes", 0, "2", "t_mapping(t_bytes32,t_mapping(t_address,"+settingsType+"))"),
+			item("_transferredBalances", 0, "3", "t_mapping(t_bytes32,t_mapping(t_address,t_uint256))"),
+		},
+		"erc7201:avalanche-ictt.storage.SendReentrancyGuard": {
+			item("_sendEntered", 0, "0", "t_uint256"),
+		},
+	}, layout.Namespaces)
+	// The struct declared in an imported source is laid out from its definition.
+	settings := layout.Types[settingsType]
+	require.Equal(t, "128", settings.NumberOfBytes)
+	require.Equal(t, []*StorageItem{
+		item("registered", 0, "0", "t_bool"),
+		item("collateralNeeded", 0, "1", "t_uint256"),
+		item("tokenMultiplier", 0, "2", "t_uint256"),
+		item("multiplyOnRemote", 0, "3", "t_bool"),
+	}, settings.Members)
+
+	require.Empty(t, CompareStorageLayouts(layout, layout))
+	next, err := ReadStorageLayout(
+		filepath.Join("testdata", "out", "ERC20TokenHomeUpgradeable.sol", "ERC20TokenHomeUpgradeable.json"),
+	)
+	require.NoError(t, err)
+	next.Types[settingsType].Members[3].Label = "paused"
+	delete(next.Namespaces, "erc7201:avalanche-ictt.storage.SendReentrancyGuard")
+	errs := make([]string, 0)
+	for _, err := range CompareStorageLayouts(layout, next) {
+		errs = append(errs, err.String())
+	}
+	require.Equal(t, []string{
+		"erc7201:avalanche-ictt.storage.SendReentrancyGuard: namespace was removed",
+		tokenHomeNamespace + ": _registeredRemotes[value][value].multiplyOnRemote: was replaced by paused",
+	}, errs)
+
+	// The contract is found by the artifact's name.
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", "out", "TokenHome.sol", "TokenHome.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "TokenHome.sol"), 0o700))
+	renamed := filepath.Join(dir, "TokenHome.sol", "Other.json")
+	require.NoError(t, os.WriteFile(renamed, data, 0o600))
+	_, err = ReadStorageLayout(renamed)
+	require.ErrorContains(t, err, "no contract Other in the AST of contracts/ictt/TokenHome/TokenHome.sol")
+	// The artifacts of the base contracts must be in the same output directory.
+	base := filepath.Join(dir, "TokenHome.sol", "TokenHome.json")
+	require.NoError(t, os.WriteFile(base, data, 0o600))
+	_, err = ReadStorageLayout(base)
+	require.ErrorContains(t, err, "base contract 60 of TokenHome is not in the artifacts in "+dir)
+}
+
+// TestReadStorageLayoutWithoutStructDeclaration reads the namespaces with the struct that the
+// TokenHome's remotes map to removed from the AST of ITokenHome, as if it were declared in a source
+// without an artifact.
+func TestReadStorageLayoutWithoutStructDeclaration(t *testing.T) {
+	dir := t.TempDir()
+	sources := []string{"ERC20TokenHomeUpgradeable", "ITokenHome", "SendReentrancyGuardUpgradeable", "TokenHome"}
+	for _, source := range sources {
+		data, err := os.ReadFile(filepath.Join("testdata", "out", source+".sol", source+".json"))
+		require.NoError(t, err)
+		if source == "ITokenHome" {
+			var artifact struct {
+				AST *astNode `json:"ast"`
+			}
+			require.NoError(t, json.Unmarshal(data, &artifact))
+			nodes := artifact.AST.Nodes[:0]
+			for _, node := range artifact.AST.Nodes {
+				if node.NodeType != "StructDefinition" {
+					nodes = append(nodes, node)
+				}
+			}
+			artifact.AST.Nodes = nodes
+			data, err = json.Marshal(artifact)
+			require.NoError(t, err)
+		}
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, source+".sol"), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, source+".sol", source+".json"), data, 0o600))
+	}
+	partial, err := ReadStorageLayout(
+		filepath.Join(dir, "ERC20TokenHomeUpgradeable.sol", "ERC20TokenHomeUpgradeable.json"),
+	)
+	require.NoError(t, err)
+	settingsType := "t_struct(RemoteTokenTransferrerSettings)_storage"
+	require.NotContains(t, partial.Types, settingsType)
+	require.Equal(t, "t_mapping(t_bytes32,t_mapping(t_address,"+settingsType+"))",
+		partial.Namespaces[tokenHomeNamespace][3].Type)
+
+	// The struct is only compared by name with its layout from the full build.
+	full, err := ReadStorageLayout(
+		filepath.Join("testdata", "out", "ERC20TokenHomeUpgradeable.sol", "ERC20TokenHomeUpgradeable.json"),
+	)
+	require.NoError(t, err)
+	require.Empty(t, CompareStorageLayouts(full, partial))
+	require.Empty(t, CompareStorageLayouts(partial, full))
+}
+
+func TestNamespaceBuilderStructs(t *testing.T) {
+	member := func(name, typ string) *astNode {
+		node := &astNode{Name: name, TypeName: &astNode{NodeType: "ElementaryTypeName"}}
+		node.TypeName.TypeDescriptions.TypeString = typ
+		return node
+	}
+	structName := func(name string, id int64) *astNode {
+		node := &astNode{NodeType: "UserDefinedTypeName", ReferencedDeclaration: id}
+		node.TypeDescriptions.TypeString = "struct " + name + " storage ref"
+		return node
+	}
+	b := &namespaceBuilder{
+		declarations: map[int64]*astNode{
+			1: {NodeType: "StructDefinition", ID: 1, Members: []*astNode{member("a", "uint128"), member("b", "bool")}},
+			2: {NodeType: "StructDefinition", ID: 2, Members: []*astNode{member("a", "uint128"), member("b", "bool")}},
+			3: {NodeType: "StructDefinition", ID: 3, Members: []*astNode{member("a", "uint128"), member("b", "uint256")}},
+			4: {NodeType: "StructDefinition", ID: 4, Members: []*astNode{member("b", "uint128"), member("a", "bool")}},
+		},
+		types:   make(map[string]*StorageType),
+		structs: make(map[string]int64),
+	}
+	key, err := b.storageType(structName("Settings", 1))
+	require.NoError(t, err)
+	require.Equal(t, "32", b.types[key].NumberOfBytes)
+	// Another declaration of the same name must have the same member labels, types and offsets.
+	_, err = b.storageType(structName("Settings", 2))
+	require.NoError(t, err)
+	_, err = b.storageType(structName("Settings", 3))
+	require.ErrorContains(t, err, "struct Settings is declared more than once with different members")
+	_, err = b.storageType(structName("Settings", 4))
+	require.ErrorContains(t, err, "struct Settings is declared more than once with different members")
+
+	// A struct without a declaration has an unknown size, so nothing can be laid out after it.
+	_, _, _, err = b.layoutMembers([]*astNode{{Name: "settings", TypeName: structName("Unknown", 5)}, member("c", "bool")})
+	require.ErrorContains(t, err, "size of struct Unknown of settings is unknown, so c can't be laid out")
+	items, _, sized, err := b.layoutMembers(
+		[]*astNode{member("c", "bool"), {Name: "settings", TypeName: structName("Unknown", 5)}},
+	)
+	require.NoError(t, err)
+	require.False(t, sized)
+	require.Equal(t, &StorageItem{Label: "settings", Slot: "1", Type: "t_struct(Unknown)_storage"}, items[1])
+}
+
+func TestERC7201Location(t *testing.T) {
+	require.Equal(t,
+		common.HexToHash("0x9316912b5a9db88acbe872c934fdd0a46c436c6dcba332d649c4d57c7bc9e600"),
+		ERC7201Location("avalanche-ictt.storage.TokenHome"),
+	)
+	require.Equal(t,
+		common.HexToHash("0xe92546d698950ddd38910d2e15ed1d923cd0a7b3dde9e2a6a3f380565559cb00"),
+		ERC7201Location("avalanche-icm.storage.ValidatorManager"),
+	)
+}
+
+func TestCompareStorageLayouts(t *testing.T) {
+	newLayout := func() *StorageLayout {
+		var artifact struct {
+			StorageLayout *StorageLayout `json:"storageLayout"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(testArtifact), &artifact))
+		return artifact.StorageLayout
+	}
+	item := func(label string, offset uint64, slot, typ string) *StorageItem {
+		return &StorageItem{Label: label, Offset: offset, Slot: slot, Type: typ}
+	}
+	addMember := func(layout *StorageLayout) {
+		settings := layout.Types["t_struct(Settings)20_storage"]
+		settings.Members = append(settings.Members, item("paused", 0, "2", "t_bool"))
+		settings.NumberOfBytes = "96"
+	}
+
+	tests := []struct {
+		name   string
+		modify func(layout *StorageLayout)
+		errs   []string
+	}{
+		{
+			name:   "unchanged",
+			modify: func(*StorageLayout) {},
+		},
+		{
+			name: "variable appended",
+			modify: func(layout *StorageLayout) {
+				layout.Namespaces[tokenHomeNamespace] = append(layout.Namespaces[tokenHomeNamespace],
+					item("_paused", 0, "5", "t_bool"))
+			},
+		},
+		{
+			name: "namespace added",
+			modify: func(layout *StorageLayout) {
+				layout.Namespaces["erc7201:avalanche-ictt.storage.Pausable"] = []*StorageItem{
+					item("_paused", 0, "0", "t_bool"),
+				}
+			},
+		},
+		{
+			name: "contract stored as address",
+			modify: func(layout *StorageLayout) {
+				layout.Namespaces[tokenHomeNamespace][0].Type = "t_address"
+			},
+		},
+		{
+			name: "ast IDs changed",
+			modify: func(layout *StorageLayout) {
+				layout.Types["t_contract(IERC20)99"] = layout.Types["t_contract(IERC20)10"]
+				layout.Namespaces[tokenHomeNamespace][0].Type = "t_contract(IERC20)99"
+			},
+		},
+		{
+			name: "struct member added in mapping and inline",
+			modify: func(layout *StorageLayout) {
+				// The same struct type grows in the mapping, where it is safe, and inline before
+				// _amounts, which it would overwrite.
+				addMember(layout)
+			},
+			errs: []string{
+				tokenHomeNamespace + ": _fixed: members were added to struct TokenHome.Settings, " +
+					"which moves the variables after it",
+			},
+		},
+		{
+			name: "variable inserted",
+			modify: func(layout *StorageLayout) {
+				items := layout.Namespaces[tokenHomeNamespace]
+				layout.Namespaces[tokenHomeNamespace] = append([]*StorageItem{
+					item("_owner", 0, "0", "t_address"),
+				}, items...)
+			},
+			errs: []string{
+				tokenHomeNamespace + ": _token: was replaced by _owner",
+				tokenHomeNamespace + ": _decimals: was replaced by _token",
+				tokenHomeNamespace + ": _settings: was replaced by _decimals",
+				tokenHomeNamespace + ": _fixed: was replaced by _settings",
+				tokenHomeNamespace + ": _amounts: was replaced by _fixed",
+			},
+		},
+		{
+			name: "variable removed",
+			modify: func(layout *StorageLayout) {
+				items := layout.Namespaces[tokenHomeNamespace]
+				layout.Namespaces[tokenHomeNamespace] = items[:len(items)-1]
+			},
+			errs: []string{tokenHomeNamespace + ": _amounts: was removed"},
+		},
+		{
+			name: "variable moved",
+			modify: func(layout *StorageLayout) {
+				layout.Namespaces[tokenHomeNamespace][1].Offset = 0
+				layout.Namespaces[tokenHomeNamespace][1].Slot = "1"
+			},
+			errs: []string{tokenHomeNamespace + ": _decimals: moved from slot 0 offset 20 to slot 1 offset 0"},
+		},
+		{
+			name: "type changed",
+			modify: func(layout *StorageLayout) {
+				layout.Namespaces[tokenHomeNamespace][1].Type = "t_bool"
+				layout.Types["t_array(t_uint256)dyn_storage"].Base = "t_bytes32"
+			},
+			errs: []string{
+				tokenHomeNamespace + ": _decimals: type changed from uint8 to bool",
+				tokenHomeNamespace + ": _amounts[]: type changed from uint256 to bytes32",
+			},
+		},
+		{
+			name: "mapping value member changed",
+			modify: func(layout *StorageLayout) {
+				settings := layout.Types["t_struct(Settings)20_storage"]
+				settings.Members[1].Type = "t_address"
+			},
+			errs: []string{
+				tokenHomeNamespace + ": _settings[value].collateralNeeded: type changed from uint256 to address",
+				tokenHomeNamespace + ": _fixed.collateralNeeded: type changed from uint256 to address",
+			},
+		},
+		{
+			name: "namespace removed",
+			modify: func(layout *StorageLayout) {
+				delete(layout.Namespaces, tokenHomeNamespace)
+			},
+			errs: []string{tokenHomeNamespace + ": namespace was removed"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next := newLayout()
+			test.modify(next)
+			var errs []string
+			for _, err := range CompareStorageLayouts(newLayout(), next) {
+				errs = append(errs, err.String())
+			}
+			require.Equal(t, test.errs, errs)
+		})
+	}
+
+	errs := CompareStorageLayouts(&StorageLayout{}, newLayout())
+	require.Len(t, errs, 1)
+	require.Equal(t, "storage: the current layout has no variables or namespaces to check", errs[0].String())
+}
@@ -0,0 +1,430 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	storageLocationPattern = regexp.MustCompile(`@custom:storage-location\s+erc7201:(\S+)`)
+	arrayLengthPattern     = regexp.MustCompile(`\[(\d*)\]$`)
+)
+
+// astNode is a node of the solc AST that forge writes to the "ast" of an artifact built with --ast,
+// with only the fields that namespace layouts are built from.
+type astNode struct {
+	NodeType                string          `json:"nodeType"`
+	ID                      int64           `json:"id"`
+	Name                    string          `json:"name"`
+	AbsolutePath            string          `json:"absolutePath"`
+	Nodes                   []*astNode      `json:"nodes"`
+	Members                 []*astNode      `json:"members"`
+	Documentation           json.RawMessage `json:"documentation"`
+	LinearizedBaseContracts []int64         `json:"linearizedBaseContracts"`
+	TypeName                *astNode        `json:"typeName"`
+	KeyType                 *astNode        `json:"keyType"`
+	ValueType               *astNode        `json:"valueType"`
+	BaseType                *astNode        `json:"baseType"`
+	UnderlyingType          *astNode        `json:"underlyingType"`
+	ReferencedDeclaration   int64           `json:"referencedDeclaration"`
+	Visibility              string          `json:"visibility"`
+	TypeDescriptions        struct {
+		TypeString string `json:"typeString"`
+	} `json:"typeDescriptions"`
+}
+
+// storageLocation returns the ID of the ERC-7201 namespace that a struct definition is annotated
+// with, or "" if it is not a namespace.
+func (n *astNode) storageLocation() string {
+	var documentation struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(n.Documentation, &documentation); err != nil {
+		// Older compilers output documentation as a string.
+		if err := json.Unmarshal(n.Documentation, &documentation.Text); err != nil {
+			return ""
+		}
+	}
+	match := storageLocationPattern.FindStringSubmatch(documentation.Text)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// typeLabel returns the type of the node as solc labels it in storage layouts.
+func (n *astNode) typeLabel() string {
+	label := n.TypeDescriptions.TypeString
+	for _, suffix := range []string{" storage ref", " storage pointer"} {
+		label = strings.TrimSuffix(label, suffix)
+	}
+	return label
+}
+
+// namespaceBuilder lays out ERC-7201 namespaces from the declarations of the ASTs of a build.
+type namespaceBuilder struct {
+	declarations map[int64]*astNode
+	types        map[string]*StorageType
+	// structs are the IDs of the declarations the struct types were laid out from.
+	structs map[string]int64
+}
+
+// readNamespaces adds the layouts of the ERC-7201 namespaces of the contract [contractName] and its
+// base contracts to [layout]. They are built from the struct definitions annotated with
+// @custom:storage-location in [ast], the AST of the contract's source, and the ASTs of the sources
+// it imports, which are read from the artifacts forge wrote to [outDir] in the same build. Struct
+// types declared in a source that has no artifact are not laid out, so they are only compared by
+// name, and since their size is unknown, nothing may follow them in a namespace or struct.
+func readNamespaces(outDir, contractName string, ast *astNode, layout *StorageLayout) error {
+	sources := map[string]*astNode{ast.AbsolutePath: ast}
+	pending := []*astNode{ast}
+	for len(pending) > 0 {
+		source := pending[0]
+		pending = pending[1:]
+		for _, node := range source.Nodes {
+			if node.NodeType != "ImportDirective" || sources[node.AbsolutePath] != nil {
+				continue
+			}
+			imported, err := readSourceAST(outDir, node.AbsolutePath)
+			if err != nil {
+				return err
+			}
+			if imported == nil {
+				continue
+			}
+			sources[node.AbsolutePath] = imported
+			pending = append(pending, imported)
+		}
+	}
+
+	b := &namespaceBuilder{
+		declarations: make(map[int64]*astNode),
+		types:        layout.Types,
+		structs:      make(map[string]int64),
+	}
+	if b.types == nil {
+		b.types = make(map[string]*StorageType)
+	}
+	for _, source := range sources {
+		b.index(source)
+	}
+	var contract *astNode
+	for _, node := range ast.Nodes {
+		if node.NodeType == "ContractDefinition" && node.Name == contractName {
+			contract = node
+		}
+	}
+	if contract == nil {
+		return errors.Errorf("no contract %s in the AST of %s", contractName, ast.AbsolutePath)
+	}
+
+	namespaces := make(map[string][]*StorageItem)
+	for _, id := range contract.LinearizedBaseContracts {
+		base := b.declarations[id]
+		if base == nil {
+			return errors.Errorf("base contract %d of %s is not in the artifacts in %s", id, contractName, outDir)
+		}
+		for _, node := range base.Nodes {
+			if node.NodeType != "StructDefinition" {
+				continue
+			}
+			location := node.storageLocation()
+			if location == "" {
+				continue
+			}
+			items, _, _, err := b.layoutMembers(node.Members)
+			if err != nil {
+				return errors.Wrapf(err, "failed to lay out namespace %s", location)
+			}
+			namespaces["erc7201:"+location] = items
+		}
+	}
+	layout.Types = b.types
+	layout.Namespaces = namespaces
+	return nil
+}
+
+// readSourceAST returns the AST of the source [absolutePath] from one of its artifacts in [outDir],
+// which forge writes to a directory named after the source file. It returns nil if the source has
+// no artifact, which is the case for sources without contracts.
+func readSourceAST(outDir, absolutePath string) (*astNode, error) {
+	paths, err := filepath.Glob(filepath.Join(outDir, filepath.Base(absolutePath), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read artifact")
+		}
+		var artifact struct {
+			AST *astNode `json:"ast"`
+		}
+		if err := json.Unmarshal(data, &artifact); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode artifact %s", path)
+		}
+		if artifact.AST != nil && artifact.AST.AbsolutePath == absolutePath {
+			return artifact.AST, nil
+		}
+	}
+	return nil, nil
+}
+
+// index records the contract, struct, enum and user-defined value type declarations in [node].
+func (b *namespaceBuilder) index(node *astNode) {
+	switch node.NodeType {
+	case "ContractDefinition", "StructDefinition", "EnumDefinition", "UserDefinedValueTypeDefinition":
+		b.declarations[node.ID] = node
+	}
+	for _, child := range node.Nodes {
+		b.index(child)
+	}
+}
+
+// layoutMembers lays out the variables [members] from slot 0, packing consecutive value types into
+// a slot as solc does, and returns them and the number of slots they take, unless the last of them
+// is a struct of unknown size.
+func (b *namespaceBuilder) layoutMembers(members []*astNode) ([]*StorageItem, uint64, bool, error) {
+	items := make([]*StorageItem, 0, len(members))
+	var slot, offset uint64
+	for i, member := range members {
+		key, err := b.storageType(member.TypeName)
+		if err != nil {
+			return nil, 0, false, errors.Wrapf(err, "failed to get type of %s", member.Name)
+		}
+		typ := b.types[key]
+		if typ == nil {
+			// The struct is declared in a source without an artifact, and starts a new slot.
+			if i < len(members)-1 {
+				return nil, 0, false, errors.Errorf("size of %s of %s is unknown, so %s can't be laid out",
+					member.TypeName.typeLabel(), member.Name, members[i+1].Name)
+			}
+			if offset > 0 {
+				slot++
+			}
+			items = append(items, &StorageItem{Label: member.Name, Slot: strconv.FormatUint(slot, 10), Type: key})
+			return items, 0, false, nil
+		}
+		size, err := strconv.ParseUint(typ.NumberOfBytes, 10, 64)
+		if err != nil {
+			return nil, 0, false, errors.Errorf("size of %s of %s is unknown", typ.Label, member.Name)
+		}
+		// Structs, arrays, mappings and byte arrays start a new slot, and so does what follows them.
+		aligned := typ.Encoding != "inplace" || typ.Members != nil || typ.Base != ""
+		if offset > 0 && (aligned || offset+size > 32) {
+			slot, offset = slot+1, 0
+		}
+		items = append(items, &StorageItem{
+			Label:  member.Name,
+			Offset: offset,
+			Slot:   strconv.FormatUint(slot, 10),
+			Type:   key,
+		})
+		if aligned {
+			slot += (size + 31) / 32
+		} else {
+			offset += size
+		}
+	}
+	if offset > 0 {
+		slot++
+	}
+	return items, slot, true, nil
+}
+
+// storageType adds the type of the type name [node] to the builder's types, and returns its key.
+// Keys follow solc's, without AST IDs so that they are the same across builds.
+func (b *namespaceBuilder) storageType(node *astNode) (string, error) {
+	if node == nil {
+		return "", errors.New("missing type name")
+	}
+	label := node.typeLabel()
+	switch node.NodeType {
+	case "ElementaryTypeName":
+		return b.elementaryType(label)
+	case "UserDefinedTypeName":
+		return b.userDefinedType(node, label)
+	case "Mapping":
+		keyType, err := b.storageType(node.KeyType)
+		if err != nil {
+			return "", err
+		}
+		valueType, err := b.storageType(node.ValueType)
+		if err != nil {
+			return "", err
+		}
+		key := "t_mapping(" + keyType + "," + valueType + ")"
+		b.types[key] = &StorageType{
+			Encoding: "mapping", Label: label, NumberOfBytes: "32", Key: keyType, Value: valueType,
+		}
+		return key, nil
+	case "ArrayTypeName":
+		baseType, err := b.storageType(node.BaseType)
+		if err != nil {
+			return "", err
+		}
+		match := arrayLengthPattern.FindStringSubmatch(label)
+		if match == nil {
+			return "", errors.Errorf("unsupported array type %s", label)
+		}
+		if match[1] == "" {
+			key := "t_array(" + baseType + ")dyn_storage"
+			b.types[key] = &StorageType{Encoding: "dynamic_array", Label: label, NumberOfBytes: "32", Base: baseType}
+			return key, nil
+		}
+		length, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return "", err
+		}
+		if b.types[baseType] == nil {
+			return "", errors.Errorf("size of %s is unknown", node.BaseType.typeLabel())
+		}
+		baseSize, err := strconv.ParseUint(b.types[baseType].NumberOfBytes, 10, 64)
+		if err != nil {
+			return "", errors.Errorf("size of %s is unknown", b.types[baseType].Label)
+		}
+		// Elements of at most 16 bytes are packed into slots, and larger ones take whole slots.
+		var slots uint64
+		if baseSize <= 16 {
+			perSlot := 32 / baseSize
+			slots = (length + perSlot - 1) / perSlot
+		} else {
+			slots = length * ((baseSize + 31) / 32)
+		}
+		key := "t_array(" + baseType + ")" + match[1] + "_storage"
+		b.types[key] = &StorageType{
+			Encoding: "inplace", Label: label, NumberOfBytes: strconv.FormatUint(slots*32, 10), Base: baseType,
+		}
+		return key, nil
+	case "FunctionTypeName":
+		size := "8"
+		if node.Visibility == "external" {
+			size = "24"
+		}
+		key := "t_function_" + node.Visibility
+		b.types[key] = &StorageType{Encoding: "inplace", Label: label, NumberOfBytes: size}
+		return key, nil
+	default:
+		return "", errors.Errorf("unsupported type name %s", node.NodeType)
+	}
+}
+
+func (b *namespaceBuilder) elementaryType(label string) (string, error) {
+	var size uint64
+	switch {
+	case label == "bool":
+		size = 1
+	case label == "address" || label == "address payable":
+		size = 20
+	case label == "string" || label == "bytes":
+		key := "t_" + label + "_storage"
+		b.types[key] = &StorageType{Encoding: "bytes", Label: label, NumberOfBytes: "32"}
+		return key, nil
+	case strings.HasPrefix(label, "uint") || strings.HasPrefix(label, "int"):
+		bits, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(label, "u"), "int"), 10, 64)
+		if err != nil {
+			return "", errors.Errorf("unsupported type %s", label)
+		}
+		size = bits / 8
+	case strings.HasPrefix(label, "bytes"):
+		n, err := strconv.ParseUint(strings.TrimPrefix(label, "bytes"), 10, 64)
+		if err != nil {
+			return "", errors.Errorf("unsupported type %s", label)
+		}
+		size = n
+	default:
+		return "", errors.Errorf("unsupported type %s", label)
+	}
+	key := "t_" + strings.ReplaceAll(label, " ", "_")
+	b.types[key] = &StorageType{Encoding: "inplace", Label: label, NumberOfBytes: strconv.FormatUint(size, 10)}
+	return key, nil
+}
+
+func (b *namespaceBuilder) userDefinedType(node *astNode, label string) (string, error) {
+	kind, name, _ := strings.Cut(label, " ")
+	declaration := b.declarations[node.ReferencedDeclaration]
+	switch {
+	case kind == "contract" || kind == "interface":
+		key := "t_contract(" + name + ")"
+		b.types[key] = &StorageType{Encoding: "inplace", Label: label, NumberOfBytes: "20"}
+		return key, nil
+	case kind == "enum":
+		// Enums of up to 256 values are stored in a byte.
+		size := "1"
+		if declaration != nil && len(declaration.Members) > 256 {
+			size = "2"
+		}
+		key := "t_enum(" + name + ")"
+		b.types[key] = &StorageType{Encoding: "inplace", Label: label, NumberOfBytes: size}
+		return key, nil
+	case kind == "struct":
+		key := "t_struct(" + name + ")_storage"
+		if declaration == nil {
+			// Left out of the types, so that the struct is compared by its key.
+			return key, nil
+		}
+		if typ := b.types[key]; typ != nil {
+			// Members are only unset while the struct is being laid out, when a member refers to it.
+			if b.structs[key] == declaration.ID || typ.Members == nil {
+				return key, nil
+			}
+			// Structs of the same name declared in different sources share the key, so they must be
+			// laid out the same.
+			members, _, _, err := b.layoutMembers(declaration.Members)
+			if err != nil {
+				return "", err
+			}
+			if !sameItems(typ.Members, members) {
+				return "", errors.Errorf("%s is declared more than once with different members", label)
+			}
+			return key, nil
+		}
+		typ := &StorageType{Encoding: "inplace", Label: label}
+		// Registered before the members are laid out, since they may refer to the struct.
+		b.types[key] = typ
+		b.structs[key] = declaration.ID
+		members, slots, sized, err := b.layoutMembers(declaration.Members)
+		if err != nil {
+			return "", err
+		}
+		typ.Members = members
+		if sized {
+			typ.NumberOfBytes = strconv.FormatUint(slots*32, 10)
+		}
+		return key, nil
+	case declaration != nil && declaration.NodeType == "UserDefinedValueTypeDefinition":
+		underlying, err := b.storageType(declaration.UnderlyingType)
+		if err != nil {
+			return "", err
+		}
+		key := "t_userDefinedValueType(" + label + ")"
+		b.types[key] = &StorageType{
+			Encoding: "inplace", Label: label, NumberOfBytes: b.types[underlying].NumberOfBytes,
+		}
+		return key, nil
+	default:
+		return "", errors.Errorf("unsupported type %s", label)
+	}
+}
+
+// sameItems returns whether [a] and [b] have the same labels, types, slots and offsets.
+func sameItems(a, b []*StorageItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if *a[i] != *b[i] {
+			return false
+		}
+	}
+	return true
+}
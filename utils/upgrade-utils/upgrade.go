@@ -0,0 +1,150 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+
+	proxyadmin "github.com/ava-labs/icm-contracts/abi-bindings/go/ProxyAdmin"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ImplementationSlot is the EIP-1967 slot a proxy stores its implementation in,
+	// bytes32(uint256(keccak256("eip1967.proxy.implementation")) - 1).
+	ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	// AdminSlot is the EIP-1967 slot a proxy stores its admin in, which is the ProxyAdmin of a
+	// TransparentUpgradeableProxy, bytes32(uint256(keccak256("eip1967.proxy.admin")) - 1).
+	AdminSlot = common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103")
+)
+
+// Backend is a chain with TransparentUpgradeableProxy contracts to upgrade.
+type Backend interface {
+	bind.ContractBackend
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+}
+
+// TxWaiter waits for a transaction to be accepted, and returns its receipt.
+type TxWaiter func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error)
+
+// Upgrader upgrades TransparentUpgradeableProxy contracts through their ProxyAdmin, with
+// transactions signed by Opts, which must be the ProxyAdmin's owner.
+type Upgrader struct {
+	Backend Backend
+	Opts    *bind.TransactOpts
+	Wait    TxWaiter
+}
+
+// Upgrade is an upgrade made by an Upgrader.
+type Upgrade struct {
+	ProxyAdmin             common.Address
+	PreviousImplementation common.Address
+	Receipt                *types.Receipt
+}
+
+// NewUpgrader creates an Upgrader that signs transactions with [opts] and waits for them with [wait].
+func NewUpgrader(backend Backend, opts *bind.TransactOpts, wait TxWaiter) *Upgrader {
+	return &Upgrader{
+		Backend: backend,
+		Opts:    opts,
+		Wait:    wait,
+	}
+}
+
+// GetImplementation returns the implementation of the proxy at [proxyAddress], from its EIP-1967 slot.
+func GetImplementation(ctx context.Context, backend Backend, proxyAddress common.Address) (common.Address, error) {
+	return readAddressSlot(ctx, backend, proxyAddress, ImplementationSlot, "implementation")
+}
+
+// GetProxyAdmin returns the admin of the proxy at [proxyAddress], from its EIP-1967 slot.
+func GetProxyAdmin(ctx context.Context, backend Backend, proxyAddress common.Address) (common.Address, error) {
+	return readAddressSlot(ctx, backend, proxyAddress, AdminSlot, "admin")
+}
+
+func readAddressSlot(
+	ctx context.Context,
+	backend Backend,
+	proxyAddress common.Address,
+	slot common.Hash,
+	name string,
+) (common.Address, error) {
+	value, err := backend.StorageAt(ctx, proxyAddress, slot, nil)
+	if err != nil {
+		return common.Address{}, errors.Wrapf(err, "failed to read %s slot of %s", name, proxyAddress.Hex())
+	}
+	address := common.BytesToAddress(value)
+	if address == (common.Address{}) {
+		return common.Address{}, errors.Errorf("%s has no %s, so it is not a TransparentUpgradeableProxy",
+			proxyAddress.Hex(), name)
+	}
+	return address, nil
+}
+
+// Upgrade calls upgradeAndCall on the ProxyAdmin of the proxy at [proxyAddress], which upgrades it
+// to [implementationAddress] and, unless [data] is empty, calls it with [data]. It checks that the
+// implementation has code and that the upgrader owns the ProxyAdmin first, and that the proxy's
+// implementation changed after.
+func (u *Upgrader) Upgrade(
+	ctx context.Context,
+	proxyAddress common.Address,
+	implementationAddress common.Address,
+	data []byte,
+) (*Upgrade, error) {
+	upgrade := &Upgrade{}
+	var err error
+	if upgrade.PreviousImplementation, err = GetImplementation(ctx, u.Backend, proxyAddress); err != nil {
+		return nil, err
+	}
+	if upgrade.ProxyAdmin, err = GetProxyAdmin(ctx, u.Backend, proxyAddress); err != nil {
+		return nil, err
+	}
+	if implementationAddress == upgrade.PreviousImplementation {
+		return nil, errors.Errorf("%s is already the implementation", implementationAddress.Hex())
+	}
+	code, err := u.Backend.CodeAt(ctx, implementationAddress, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get code at %s", implementationAddress.Hex())
+	}
+	if len(code) == 0 {
+		return nil, errors.Errorf("no contract at implementation %s", implementationAddress.Hex())
+	}
+
+	admin, err := proxyadmin.NewProxyAdmin(upgrade.ProxyAdmin, u.Backend)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := admin.Owner(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get owner of ProxyAdmin %s", upgrade.ProxyAdmin.Hex())
+	}
+	if owner != u.Opts.From {
+		return nil, errors.Errorf("ProxyAdmin %s is owned by %s, not %s",
+			upgrade.ProxyAdmin.Hex(), owner.Hex(), u.Opts.From.Hex())
+	}
+
+	opts := *u.Opts
+	opts.Context = ctx
+	tx, err := admin.UpgradeAndCall(&opts, proxyAddress, implementationAddress, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call upgradeAndCall")
+	}
+	if upgrade.Receipt, err = u.Wait(ctx, tx); err != nil {
+		return nil, err
+	}
+	if upgrade.Receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, errors.Errorf("upgradeAndCall transaction %s reverted", tx.Hash().Hex())
+	}
+	implementation, err := GetImplementation(ctx, u.Backend, proxyAddress)
+	if err != nil {
+		return nil, err
+	}
+	if implementation != implementationAddress {
+		return nil, errors.Errorf("implementation is %s after the upgrade", implementation.Hex())
+	}
+	return upgrade, nil
+}
@@ -0,0 +1,80 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	transparentupgradeableproxy "github.com/ava-labs/icm-contracts/abi-bindings/go/TransparentUpgradeableProxy"
+	exampleerc20 "github.com/ava-labs/icm-contracts/abi-bindings/go/mocks/ExampleERC20"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgrade(t *testing.T) {
+	ctx := context.Background()
+	kit, err := receiverTestUtils.NewReceiverTestKit()
+	require.NoError(t, err)
+	defer kit.Close()
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	deploy := func() common.Address {
+		address, tx, _, err := exampleerc20.DeployExampleERC20(opts, kit.Client())
+		require.NoError(t, err)
+		_, err = kit.Commit(ctx, tx)
+		require.NoError(t, err)
+		return address
+	}
+	previous, next := deploy(), deploy()
+	proxyAddress, tx, _, err := transparentupgradeableproxy.DeployTransparentUpgradeableProxy(
+		opts, kit.Client(), previous, kit.DeployerAddress, nil,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+
+	implementation, err := GetImplementation(ctx, kit.Client(), proxyAddress)
+	require.NoError(t, err)
+	require.Equal(t, previous, implementation)
+	proxyAdmin, err := GetProxyAdmin(ctx, kit.Client(), proxyAddress)
+	require.NoError(t, err)
+	_, err = GetImplementation(ctx, kit.Client(), previous)
+	require.ErrorContains(t, err, "has no implementation, so it is not a TransparentUpgradeableProxy")
+
+	upgrader := NewUpgrader(kit.Client(), opts, kit.Commit)
+	_, err = upgrader.Upgrade(ctx, proxyAddress, previous, nil)
+	require.ErrorContains(t, err, "is already the implementation")
+	_, err = upgrader.Upgrade(ctx, proxyAddress, common.Address{1}, nil)
+	require.ErrorContains(t, err, "no contract at implementation")
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	otherOpts, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	require.NoError(t, err)
+	_, err = NewUpgrader(kit.Client(), otherOpts, kit.Commit).Upgrade(ctx, proxyAddress, next, nil)
+	require.ErrorContains(t, err, "is owned by "+kit.DeployerAddress.Hex())
+
+	// The proxy is called with the upgrade, so the new implementation can be initialized.
+	token, err := exampleerc20.NewExampleERC20(proxyAddress, kit.Client())
+	require.NoError(t, err)
+	data, err := exampleerc20.ExampleERC20MetaData.GetAbi()
+	require.NoError(t, err)
+	call, err := data.Pack("approve", common.Address{2}, big.NewInt(3))
+	require.NoError(t, err)
+	upgrade, err := upgrader.Upgrade(ctx, proxyAddress, next, call)
+	require.NoError(t, err)
+	require.Equal(t, previous, upgrade.PreviousImplementation)
+	require.Equal(t, proxyAdmin, upgrade.ProxyAdmin)
+	implementation, err = GetImplementation(ctx, kit.Client(), proxyAddress)
+	require.NoError(t, err)
+	require.Equal(t, next, implementation)
+	allowance, err := token.Allowance(nil, proxyAdmin, common.Address{2})
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(3), allowance)
+}
@@ -0,0 +1,192 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+
+	iposvalidatormanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/interfaces/IPoSValidatorManager"
+	logUtils "github.com/ava-labs/icm-contracts/utils/log-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// eventParsers parse the logs of the validator manager events by topic. IPoSValidatorManager
+// declares the events of the PoA and PoS validator managers.
+var eventParsers map[common.Hash]func(log types.Log) (*Event, error)
+
+func init() {
+	managerABI, err := iposvalidatormanager.IPoSValidatorManagerMetaData.GetAbi()
+	if err != nil {
+		panic(errors.Errorf("failed to parse IPoSValidatorManager ABI: %v", err))
+	}
+	filterer, err := iposvalidatormanager.NewIPoSValidatorManagerFilterer(common.Address{}, nil)
+	if err != nil {
+		panic(errors.Errorf("failed to create IPoSValidatorManager filterer: %v", err))
+	}
+	parsers := map[EventKind]func(log types.Log) (*Event, error){
+		EventInitialValidatorCreated: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseInitialValidatorCreated(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, Weight: e.Weight}, nil
+		},
+		EventValidationPeriodCreated: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseValidationPeriodCreated(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, Weight: e.Weight}, nil
+		},
+		EventValidationPeriodRegistered: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseValidationPeriodRegistered(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, Weight: e.Weight}, nil
+		},
+		EventValidatorWeightUpdate: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseValidatorWeightUpdate(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, Weight: e.Weight, Nonce: e.Nonce}, nil
+		},
+		EventValidatorRemovalInitialized: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseValidatorRemovalInitialized(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, Weight: e.Weight}, nil
+		},
+		EventValidationPeriodEnded: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseValidationPeriodEnded(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, Status: ValidatorStatus(e.Status)}, nil
+		},
+		EventUptimeUpdated: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseUptimeUpdated(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, Uptime: e.Uptime}, nil
+		},
+		EventDelegatorAdded: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseDelegatorAdded(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{
+				ValidationID:    e.ValidationID,
+				DelegationID:    e.DelegationID,
+				Weight:          e.DelegatorWeight,
+				ValidatorWeight: e.ValidatorWeight,
+				Nonce:           e.Nonce,
+				Delegator:       e.DelegatorAddress,
+			}, nil
+		},
+		EventDelegatorRegistered: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseDelegatorRegistered(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, DelegationID: e.DelegationID}, nil
+		},
+		EventDelegatorRemovalInitialized: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseDelegatorRemovalInitialized(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, DelegationID: e.DelegationID}, nil
+		},
+		EventDelegationEnded: func(log types.Log) (*Event, error) {
+			e, err := filterer.ParseDelegationEnded(log)
+			if err != nil {
+				return nil, err
+			}
+			return &Event{ValidationID: e.ValidationID, DelegationID: e.DelegationID}, nil
+		},
+	}
+	eventParsers = make(map[common.Hash]func(log types.Log) (*Event, error))
+	for kind, parse := range parsers {
+		event, ok := managerABI.Events[string(kind)]
+		if !ok {
+			panic(errors.Errorf("IPoSValidatorManager ABI has no %s event", kind))
+		}
+		eventParsers[event.ID] = func(log types.Log) (*Event, error) {
+			parsed, err := parse(log)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s log", kind)
+			}
+			parsed.Kind = kind
+			parsed.Log = &log
+			return parsed, nil
+		}
+	}
+}
+
+// ParseEvent parses a log of a validator manager. Logs that are not of an Event kind, such as
+// Initialized, are parsed as nil.
+func ParseEvent(log types.Log) (*Event, error) {
+	if len(log.Topics) == 0 {
+		return nil, nil
+	}
+	parse, ok := eventParsers[log.Topics[0]]
+	if !ok {
+		return nil, nil
+	}
+	return parse(log)
+}
+
+// FilterEvents returns the events of the validator manager at [manager], in the order they were
+// emitted, scanning its logs from [fromBlock] to the latest block. See logUtils.ForEachBlockRange
+// for [maxBlockRange].
+func FilterEvents(
+	ctx context.Context,
+	backend bind.ContractBackend,
+	manager common.Address,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) ([]*Event, error) {
+	logs, err := logUtils.FilterLogs(
+		ctx, backend, interfaces.FilterQuery{Addresses: []common.Address{manager}}, fromBlock, maxBlockRange,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to filter logs of validator manager %s", manager.Hex())
+	}
+	var events []*Event
+	for _, log := range logs {
+		event, err := ParseEvent(log)
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// Rebuild replays the events of the validator manager at [manager] into a new model, and returns it
+// with the events that were illegal. See FilterEvents for [fromBlock] and [maxBlockRange].
+func Rebuild(
+	ctx context.Context,
+	backend bind.ContractBackend,
+	manager common.Address,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) (*Model, []*TransitionError, error) {
+	events, err := FilterEvents(ctx, backend, manager, fromBlock, maxBlockRange)
+	if err != nil {
+		return nil, nil, err
+	}
+	model := NewModel()
+	return model, model.Replay(events), nil
+}
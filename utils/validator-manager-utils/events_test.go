@@ -0,0 +1,133 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	iposvalidatormanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/interfaces/IPoSValidatorManager"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// logsBackend serves its logs, in blocks up to the block of its last log. Its other methods are
+// not implemented.
+type logsBackend struct {
+	bind.ContractBackend
+	logs []types.Log
+}
+
+func (b *logsBackend) HeaderByNumber(context.Context, *big.Int) (*types.Header, error) {
+	return &types.Header{Number: new(big.Int).SetUint64(b.logs[len(b.logs)-1].BlockNumber)}, nil
+}
+
+func (b *logsBackend) FilterLogs(_ context.Context, query interfaces.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, log := range b.logs {
+		if log.BlockNumber < query.FromBlock.Uint64() || log.BlockNumber > query.ToBlock.Uint64() {
+			continue
+		}
+		for _, address := range query.Addresses {
+			if log.Address == address {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// newManagerLog packs a log of a validator manager event, with the indexed values as topics.
+func newManagerLog(
+	t *testing.T,
+	manager common.Address,
+	name string,
+	topics []common.Hash,
+	data ...interface{},
+) types.Log {
+	managerABI, err := iposvalidatormanager.IPoSValidatorManagerMetaData.GetAbi()
+	require.NoError(t, err)
+	event := managerABI.Events[name]
+	packed, err := event.Inputs.NonIndexed().Pack(data...)
+	require.NoError(t, err)
+	return types.Log{Address: manager, Topics: append([]common.Hash{event.ID}, topics...), Data: packed}
+}
+
+func TestRebuild(t *testing.T) {
+	manager := common.Address{1}
+	validationID := ids.ID{2}
+	delegationID := ids.ID{3}
+	delegator := common.Address{4}
+	nodeID := crypto.Keccak256Hash([]byte("node"))
+	validation := common.Hash(validationID)
+	delegation := common.Hash(delegationID)
+	logs := []types.Log{
+		newManagerLog(t, manager, "ValidationPeriodCreated", []common.Hash{validation, nodeID, {5}},
+			uint64(20), uint64(1000)),
+		newManagerLog(t, manager, "ValidationPeriodRegistered", []common.Hash{validation},
+			uint64(20), big.NewInt(100)),
+		newManagerLog(t, manager, "UptimeUpdated", []common.Hash{validation}, uint64(60)),
+		newManagerLog(t, manager, "ValidatorWeightUpdate",
+			[]common.Hash{validation, common.BigToHash(big.NewInt(1))}, uint64(25), [32]byte{6}),
+		newManagerLog(t, manager, "DelegatorAdded",
+			[]common.Hash{delegation, validation, common.BytesToHash(delegator[:])},
+			uint64(1), uint64(25), uint64(5), [32]byte{6}),
+		newManagerLog(t, manager, "DelegatorRegistered", []common.Hash{delegation, validation}, big.NewInt(110)),
+		// A delegation can't end while it is active, so the event is illegal.
+		newManagerLog(t, manager, "DelegationEnded", []common.Hash{delegation, validation},
+			big.NewInt(0), big.NewInt(0)),
+		// Logs of other managers are not filtered.
+		newManagerLog(t, common.Address{7}, "ValidationPeriodRegistered", []common.Hash{validation},
+			uint64(20), big.NewInt(100)),
+	}
+	// Logs of other events are skipped.
+	logs = append(logs, types.Log{
+		Address: manager,
+		Topics:  []common.Hash{crypto.Keccak256Hash([]byte("Initialized(uint64)"))},
+		Data:    common.BigToHash(big.NewInt(1)).Bytes(),
+	})
+	for i := range logs {
+		logs[i].BlockNumber = uint64(i + 1)
+	}
+
+	ctx := context.Background()
+	for _, maxBlockRange := range []uint64{0, 1} {
+		events, err := FilterEvents(ctx, &logsBackend{logs: logs}, manager, 0, maxBlockRange)
+		require.NoError(t, err)
+		require.Len(t, events, 7)
+		require.Equal(t, &Event{
+			Kind:            EventDelegatorAdded,
+			ValidationID:    validationID,
+			DelegationID:    delegationID,
+			Weight:          5,
+			ValidatorWeight: 25,
+			Nonce:           1,
+			Delegator:       delegator,
+			Log:             &logs[4],
+		}, events[4])
+	}
+	events, err := FilterEvents(ctx, &logsBackend{logs: logs}, manager, 3, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 5)
+
+	model, illegal, err := Rebuild(ctx, &logsBackend{logs: logs}, manager, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, illegal, 1)
+	require.Equal(t, EventDelegationEnded, illegal[0].Event.Kind)
+	require.Equal(t, ValidatorActive, model.Validations[validationID].Status)
+	require.Equal(t, uint64(60), model.Validations[validationID].Uptime)
+	require.Equal(t, uint64(25), model.Validations[validationID].Weight)
+	require.Equal(t, DelegatorActive, model.Delegations[delegationID].Status)
+
+	// Logs of an event with missing topics are rejected.
+	logs[1].Topics = logs[1].Topics[:1]
+	_, err = FilterEvents(ctx, &logsBackend{logs: logs}, manager, 0, 0)
+	require.ErrorContains(t, err, "failed to parse ValidationPeriodRegistered log")
+}
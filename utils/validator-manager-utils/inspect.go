@@ -0,0 +1,277 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ava-labs/avalanchego/ids"
+	erc20tokenstakingmanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/ERC20TokenStakingManager"
+	nativetokenstakingmanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/NativeTokenStakingManager"
+	poavalidatormanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/PoAValidatorManager"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// ManagerKind identifies which of the validator manager contracts is deployed at an address.
+type ManagerKind int
+
+const (
+	PoAValidatorManagerKind ManagerKind = iota
+	NativeTokenStakingManagerKind
+	ERC20TokenStakingManagerKind
+)
+
+func (k ManagerKind) String() string {
+	switch k {
+	case PoAValidatorManagerKind:
+		return "PoAValidatorManager"
+	case NativeTokenStakingManagerKind:
+		return "NativeTokenStakingManager"
+	case ERC20TokenStakingManagerKind:
+		return "ERC20TokenStakingManager"
+	default:
+		return "unknown"
+	}
+}
+
+// IsPoS returns whether the validator manager is a PoS validator manager.
+func (k ManagerKind) IsPoS() bool {
+	return k == NativeTokenStakingManagerKind || k == ERC20TokenStakingManagerKind
+}
+
+// Slots of the fields of PoSValidatorManagerStorage, relative to its ERC-7201 storage location.
+// The PoS validator managers have no getters for them, so they are read from storage.
+const (
+	posValidatorInfoSlot = 6
+	delegatorStakesSlot  = 7
+	rewardRecipientsSlot = 11
+)
+
+// Backend is a client of the chain of a validator manager, which can read its storage.
+type Backend interface {
+	bind.ContractBackend
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+}
+
+// PoSValidatorInfo is the PoS information of a validation.
+type PoSValidatorInfo struct {
+	Owner             common.Address
+	DelegationFeeBips uint16
+	MinStakeDuration  uint64
+	UptimeSeconds     uint64
+	// RewardRecipient is the zero address until it is changed or the validation ends, when it
+	// defaults to the owner.
+	RewardRecipient common.Address
+}
+
+// DelegatorState is a delegation of a validation that has not ended.
+type DelegatorState struct {
+	DelegationID  ids.ID
+	Status        DelegatorStatus
+	Owner         common.Address
+	Weight        uint64
+	StartedAt     uint64
+	StartingNonce uint64
+	EndingNonce   uint64
+}
+
+// ValidationState is a validation of a validator manager.
+type ValidationState struct {
+	ValidationID ids.ID
+	// Validator is the validation returned by getValidator.
+	Validator poavalidatormanager.Validator
+	// PoS is nil if the validator manager is not a PoS validator manager, or the validation is an
+	// initial validator, which has no PoS information.
+	PoS         *PoSValidatorInfo
+	Delegations []*DelegatorState
+}
+
+// ManagerState is a snapshot of a validator manager and its validations.
+type ManagerState struct {
+	Address common.Address
+	Kind    ManagerKind
+	// Validations are in the order they were created.
+	Validations []*ValidationState
+	// Illegal are the events that do not follow the state transitions of the validator manager.
+	Illegal []*TransitionError
+}
+
+// DetectManagerKind returns the kind of validator manager deployed at [address], from the ERC-7201
+// storage locations each contract exposes.
+func DetectManagerKind(
+	ctx context.Context,
+	backend bind.ContractBackend,
+	address common.Address,
+) (ManagerKind, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	erc20Manager, err := erc20tokenstakingmanager.NewERC20TokenStakingManager(address, backend)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := erc20Manager.ERC20STAKINGMANAGERSTORAGELOCATION(opts); err == nil {
+		return ERC20TokenStakingManagerKind, nil
+	}
+	nativeManager, err := nativetokenstakingmanager.NewNativeTokenStakingManager(address, backend)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := nativeManager.POSVALIDATORMANAGERSTORAGELOCATION(opts); err == nil {
+		return NativeTokenStakingManagerKind, nil
+	}
+	poaManager, err := poavalidatormanager.NewPoAValidatorManager(address, backend)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := poaManager.VALIDATORMANAGERSTORAGELOCATION(opts); err == nil {
+		return PoAValidatorManagerKind, nil
+	}
+	return 0, errors.Errorf("no validator manager found at %s", address.Hex())
+}
+
+// InspectValidators returns the state of the validator manager at [address], and of every
+// validation created by its InitialValidatorCreated and ValidationPeriodCreated events, with the
+// delegations that have not ended. See FilterEvents for [fromBlock] and [maxBlockRange].
+func InspectValidators(
+	ctx context.Context,
+	backend Backend,
+	address common.Address,
+	fromBlock uint64,
+	maxBlockRange uint64,
+) (*ManagerState, error) {
+	kind, err := DetectManagerKind(ctx, backend, address)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := poavalidatormanager.NewPoAValidatorManager(address, backend)
+	if err != nil {
+		return nil, err
+	}
+	events, err := FilterEvents(ctx, backend, address, fromBlock, maxBlockRange)
+	if err != nil {
+		return nil, err
+	}
+	model := NewModel()
+	state := &ManagerState{Address: address, Kind: kind, Illegal: model.Replay(events)}
+
+	var posLocation common.Hash
+	if kind.IsPoS() {
+		nativeManager, err := nativetokenstakingmanager.NewNativeTokenStakingManager(address, backend)
+		if err != nil {
+			return nil, err
+		}
+		posLocation, err = nativeManager.POSVALIDATORMANAGERSTORAGELOCATION(&bind.CallOpts{Context: ctx})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get PoS validator manager storage location")
+		}
+	}
+	storage := &managerStorage{ctx: ctx, backend: backend, address: address}
+
+	for _, event := range events {
+		if event.Kind != EventInitialValidatorCreated && event.Kind != EventValidationPeriodCreated {
+			continue
+		}
+		validation := &ValidationState{ValidationID: event.ValidationID}
+		validation.Validator, err = manager.GetValidator(&bind.CallOpts{Context: ctx}, event.ValidationID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get validator %s", event.ValidationID)
+		}
+		state.Validations = append(state.Validations, validation)
+		if !kind.IsPoS() {
+			continue
+		}
+
+		validation.PoS, err = storage.posValidatorInfo(posLocation, event.ValidationID)
+		if err != nil {
+			return nil, err
+		}
+		for _, delegationID := range model.Validations[event.ValidationID].Delegations {
+			if model.Delegations[delegationID].Status == DelegatorCompleted {
+				continue
+			}
+			delegation, err := storage.delegator(posLocation, delegationID)
+			if err != nil {
+				return nil, err
+			}
+			validation.Delegations = append(validation.Delegations, delegation)
+		}
+	}
+	return state, nil
+}
+
+// managerStorage reads the storage of a validator manager.
+type managerStorage struct {
+	ctx     context.Context
+	backend Backend
+	address common.Address
+}
+
+// mappingSlot returns the slot of the value of [key] in the mapping at [slot] of the storage at
+// [location].
+func mappingSlot(location common.Hash, slot int64, key ids.ID) common.Hash {
+	mapping := common.BigToHash(new(big.Int).Add(location.Big(), big.NewInt(slot)))
+	return crypto.Keccak256Hash(key[:], mapping[:])
+}
+
+// words returns [count] consecutive words of storage from [slot].
+func (s *managerStorage) words(slot common.Hash, count int) ([][]byte, error) {
+	words := make([][]byte, count)
+	for i := range words {
+		key := common.BigToHash(new(big.Int).Add(slot.Big(), big.NewInt(int64(i))))
+		word, err := s.backend.StorageAt(s.ctx, s.address, key, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read storage slot %s of %s", key.Hex(), s.address.Hex())
+		}
+		words[i] = common.LeftPadBytes(word, common.HashLength)
+	}
+	return words, nil
+}
+
+// field returns the [size] bytes at [offset] bytes from the right of a storage word, where Solidity
+// packs the fields of a struct that share a slot.
+func field(word []byte, offset int, size int) *big.Int {
+	return new(big.Int).SetBytes(word[common.HashLength-offset-size : common.HashLength-offset])
+}
+
+func (s *managerStorage) posValidatorInfo(location common.Hash, validationID ids.ID) (*PoSValidatorInfo, error) {
+	words, err := s.words(mappingSlot(location, posValidatorInfoSlot, validationID), 2)
+	if err != nil {
+		return nil, err
+	}
+	info := &PoSValidatorInfo{
+		Owner:             common.BytesToAddress(field(words[0], 0, common.AddressLength).Bytes()),
+		DelegationFeeBips: uint16(field(words[0], 20, 2).Uint64()),
+		MinStakeDuration:  field(words[0], 22, 8).Uint64(),
+		UptimeSeconds:     field(words[1], 0, 8).Uint64(),
+	}
+	if info.Owner == (common.Address{}) {
+		return nil, nil
+	}
+	recipient, err := s.words(mappingSlot(location, rewardRecipientsSlot, validationID), 1)
+	if err != nil {
+		return nil, err
+	}
+	info.RewardRecipient = common.BytesToAddress(field(recipient[0], 0, common.AddressLength).Bytes())
+	return info, nil
+}
+
+func (s *managerStorage) delegator(location common.Hash, delegationID ids.ID) (*DelegatorState, error) {
+	words, err := s.words(mappingSlot(location, delegatorStakesSlot, delegationID), 3)
+	if err != nil {
+		return nil, err
+	}
+	return &DelegatorState{
+		DelegationID:  delegationID,
+		Status:        DelegatorStatus(field(words[0], 0, 1).Uint64()),
+		Owner:         common.BytesToAddress(field(words[0], 1, common.AddressLength).Bytes()),
+		Weight:        field(words[2], 0, 8).Uint64(),
+		StartedAt:     field(words[2], 8, 8).Uint64(),
+		StartingNonce: field(words[2], 16, 8).Uint64(),
+		EndingNonce:   field(words[2], 24, 8).Uint64(),
+	}, nil
+}
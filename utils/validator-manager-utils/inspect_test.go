@@ -0,0 +1,240 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	erc20tokenstakingmanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/ERC20TokenStakingManager"
+	nativetokenstakingmanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/NativeTokenStakingManager"
+	poavalidatormanager "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/PoAValidatorManager"
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ava-labs/subnet-evm/ethclient/simulated"
+	"github.com/ava-labs/subnet-evm/interfaces"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// validatorManagerStorageLocation is VALIDATOR_MANAGER_STORAGE_LOCATION, and validationPeriodsSlot
+// the slot of _validationPeriods in ValidatorManagerStorage.
+var validatorManagerStorageLocation = common.HexToHash(
+	"0xe92546d698950ddd38910d2e15ed1d923cd0a7b3dde9e2a6a3f380565559cb00")
+
+const validationPeriodsSlot = 5
+
+// eventsClient serves the logs of its events on top of a simulated chain.
+type eventsClient struct {
+	simulated.Client
+	logs []types.Log
+}
+
+func (c *eventsClient) FilterLogs(_ context.Context, query interfaces.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, log := range c.logs {
+		if log.Address == query.Addresses[0] {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+// packWord packs values into a storage word, each at its offset in bytes from the right.
+func packWord(values map[int]*big.Int) common.Hash {
+	word := new(big.Int)
+	for offset, value := range values {
+		word.Or(word, new(big.Int).Lsh(value, uint(offset*8)))
+	}
+	return common.BigToHash(word)
+}
+
+func uint64Value(value uint64) *big.Int {
+	return new(big.Int).SetUint64(value)
+}
+
+// deployedCode deploys a contract on a scratch chain, and returns its runtime code.
+func deployedCode(
+	t *testing.T,
+	deploy func(*bind.TransactOpts, bind.ContractBackend) (common.Address, *types.Transaction, error),
+) []byte {
+	ctx := context.Background()
+	key, address, err := simulatedUtils.NewFundedKey()
+	require.NoError(t, err)
+	opts, err := simulatedUtils.NewTransactor(key)
+	require.NoError(t, err)
+	backend := simulatedUtils.NewSimulatedBackend(address)
+	defer backend.Close()
+	contractAddress, tx, err := deploy(opts, backend.Client())
+	require.NoError(t, err)
+	_, err = simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+	require.NoError(t, err)
+	code, err := backend.Client().CodeAt(ctx, contractAddress, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, code)
+	return code
+}
+
+func TestInspectValidators(t *testing.T) {
+	ctx := context.Background()
+	key, owner, err := simulatedUtils.NewFundedKey()
+	require.NoError(t, err)
+	opts, err := simulatedUtils.NewTransactor(key)
+	require.NoError(t, err)
+
+	// The managers can only get validators with Warp messages from the P-Chain, so the state of
+	// a NativeTokenStakingManager is set at genesis, and its events are served separately.
+	nativeCode := deployedCode(t, func(opts *bind.TransactOpts, backend bind.ContractBackend) (
+		common.Address, *types.Transaction, error,
+	) {
+		address, tx, _, err := nativetokenstakingmanager.DeployNativeTokenStakingManager(opts, backend, 0)
+		return address, tx, err
+	})
+	erc20Code := deployedCode(t, func(opts *bind.TransactOpts, backend bind.ContractBackend) (
+		common.Address, *types.Transaction, error,
+	) {
+		address, tx, _, err := erc20tokenstakingmanager.DeployERC20TokenStakingManager(opts, backend, 0)
+		return address, tx, err
+	})
+	poaCode := deployedCode(t, func(opts *bind.TransactOpts, backend bind.ContractBackend) (
+		common.Address, *types.Transaction, error,
+	) {
+		address, tx, _, err := poavalidatormanager.DeployPoAValidatorManager(opts, backend, 0)
+		return address, tx, err
+	})
+
+	nativeAddress, erc20Address, poaAddress := common.Address{1}, common.Address{2}, common.Address{3}
+	validationID, initialValidationID := ids.ID{4}, ids.ID{5}
+	delegationID, endedDelegationID := ids.ID{6}, ids.ID{7}
+	nodeID := make([]byte, 20)
+	nodeID[0] = 8
+	posLocation := common.HexToHash("0x4317713f7ecbdddd4bc99e95d903adedaa883b2e7c2551610bd13e2c7e473d00")
+
+	storage := make(map[common.Hash]common.Hash)
+	setWords := func(slot common.Hash, words ...common.Hash) {
+		for i, word := range words {
+			storage[common.BigToHash(new(big.Int).Add(slot.Big(), big.NewInt(int64(i))))] = word
+		}
+	}
+	// The node ID is shorter than a word, so it is stored with its length times 2 in its last byte.
+	nodeIDWord := common.BytesToHash(append(common.RightPadBytes(nodeID, 31), byte(len(nodeID)*2)))
+	setWords(mappingSlot(validatorManagerStorageLocation, validationPeriodsSlot, validationID),
+		packWord(map[int]*big.Int{0: big.NewInt(int64(ValidatorActive))}),
+		nodeIDWord,
+		packWord(map[int]*big.Int{0: uint64Value(20), 8: uint64Value(2), 16: uint64Value(25), 24: uint64Value(100)}),
+		common.Hash{},
+	)
+	setWords(mappingSlot(validatorManagerStorageLocation, validationPeriodsSlot, initialValidationID),
+		packWord(map[int]*big.Int{0: big.NewInt(int64(ValidatorActive))}),
+		nodeIDWord,
+		packWord(map[int]*big.Int{0: uint64Value(100), 16: uint64Value(100)}),
+		common.Hash{},
+	)
+	setWords(mappingSlot(posLocation, posValidatorInfoSlot, validationID),
+		packWord(map[int]*big.Int{0: owner.Big(), 20: big.NewInt(150), 22: uint64Value(3600)}),
+		packWord(map[int]*big.Int{0: uint64Value(60)}),
+	)
+	setWords(mappingSlot(posLocation, delegatorStakesSlot, delegationID),
+		packWord(map[int]*big.Int{0: big.NewInt(int64(DelegatorActive)), 1: owner.Big()}),
+		common.Hash(validationID),
+		packWord(map[int]*big.Int{0: uint64Value(5), 8: uint64Value(110), 16: uint64Value(1), 24: uint64Value(0)}),
+	)
+	backend := simulatedUtils.NewSimulatedBackendWithAlloc(types.GenesisAlloc{
+		nativeAddress: {Code: nativeCode, Storage: storage, Balance: big.NewInt(0)},
+		erc20Address:  {Code: erc20Code, Balance: big.NewInt(0)},
+		poaAddress:    {Code: poaCode, Balance: big.NewInt(0)},
+	}, owner)
+	defer backend.Close()
+
+	nodeIDHash := common.BytesToHash(nodeID)
+	validation := common.Hash(validationID)
+	delegation := common.Hash(delegationID)
+	endedDelegation := common.Hash(endedDelegationID)
+	client := &eventsClient{Client: backend.Client(), logs: []types.Log{
+		newManagerLog(t, nativeAddress, "InitialValidatorCreated",
+			[]common.Hash{common.Hash(initialValidationID), nodeIDHash}, uint64(100)),
+		newManagerLog(t, nativeAddress, "ValidationPeriodCreated", []common.Hash{validation, nodeIDHash, {9}},
+			uint64(20), uint64(1000)),
+		newManagerLog(t, nativeAddress, "ValidationPeriodRegistered", []common.Hash{validation},
+			uint64(20), big.NewInt(100)),
+		newManagerLog(t, nativeAddress, "DelegatorAdded",
+			[]common.Hash{delegation, validation, common.BytesToHash(owner[:])},
+			uint64(1), uint64(25), uint64(5), [32]byte{10}),
+		newManagerLog(t, nativeAddress, "DelegatorAdded",
+			[]common.Hash{endedDelegation, validation, common.BytesToHash(owner[:])},
+			uint64(2), uint64(30), uint64(5), [32]byte{11}),
+		newManagerLog(t, nativeAddress, "DelegatorRegistered", []common.Hash{delegation, validation}, big.NewInt(110)),
+		newManagerLog(t, nativeAddress, "DelegatorRegistered", []common.Hash{endedDelegation, validation},
+			big.NewInt(110)),
+		newManagerLog(t, nativeAddress, "DelegatorRemovalInitialized", []common.Hash{endedDelegation, validation}),
+		newManagerLog(t, nativeAddress, "DelegationEnded", []common.Hash{endedDelegation, validation},
+			big.NewInt(0), big.NewInt(0)),
+		newManagerLog(t, poaAddress, "ValidationPeriodCreated", []common.Hash{validation, nodeIDHash, {9}},
+			uint64(20), uint64(1000)),
+	}}
+
+	// The manager only lets the owner in its storage change reward recipients, which checks the
+	// storage layout the inspector reads.
+	manager, err := nativetokenstakingmanager.NewNativeTokenStakingManager(nativeAddress, client)
+	require.NoError(t, err)
+	tx, err := manager.ChangeValidatorRewardRecipient(opts, validationID, common.Address{12})
+	require.NoError(t, err)
+	_, err = simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+	require.NoError(t, err)
+	tx, err = manager.ChangeDelegatorRewardRecipient(opts, delegationID, common.Address{13})
+	require.NoError(t, err)
+	_, err = simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+	require.NoError(t, err)
+
+	state, err := InspectValidators(ctx, client, nativeAddress, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, NativeTokenStakingManagerKind, state.Kind)
+	require.Empty(t, state.Illegal)
+	require.Len(t, state.Validations, 2)
+	initial := state.Validations[0]
+	require.Equal(t, initialValidationID, initial.ValidationID)
+	require.Equal(t, uint8(ValidatorActive), initial.Validator.Status)
+	require.Nil(t, initial.PoS)
+	require.Empty(t, initial.Delegations)
+	created := state.Validations[1]
+	require.Equal(t, poavalidatormanager.Validator{
+		Status:         uint8(ValidatorActive),
+		NodeID:         nodeID,
+		StartingWeight: 20,
+		MessageNonce:   2,
+		Weight:         25,
+		StartedAt:      100,
+	}, created.Validator)
+	require.Equal(t, &PoSValidatorInfo{
+		Owner:             owner,
+		DelegationFeeBips: 150,
+		MinStakeDuration:  3600,
+		UptimeSeconds:     60,
+		RewardRecipient:   common.Address{12},
+	}, created.PoS)
+	require.Equal(t, []*DelegatorState{{
+		DelegationID:  delegationID,
+		Status:        DelegatorActive,
+		Owner:         owner,
+		Weight:        5,
+		StartedAt:     110,
+		StartingNonce: 1,
+	}}, created.Delegations)
+
+	state, err = InspectValidators(ctx, client, poaAddress, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, PoAValidatorManagerKind, state.Kind)
+	require.Len(t, state.Validations, 1)
+	require.Equal(t, uint8(ValidatorUnknown), state.Validations[0].Validator.Status)
+	require.Nil(t, state.Validations[0].PoS)
+
+	kind, err := DetectManagerKind(ctx, client, erc20Address)
+	require.NoError(t, err)
+	require.Equal(t, ERC20TokenStakingManagerKind, kind)
+	_, err = DetectManagerKind(ctx, client, owner)
+	require.ErrorContains(t, err, "no validator manager found at "+owner.Hex())
+}
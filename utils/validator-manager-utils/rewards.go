@@ -0,0 +1,141 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// Constants of ExampleRewardCalculator and PoSValidatorManager.
+const (
+	SecondsInYear                    = 31536000
+	UptimeRewardsThresholdPercentage = 80
+	BipsConversionFactor             = 10000
+)
+
+var maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// CalculateReward is a Go port of ExampleRewardCalculator.calculateReward for a calculator deployed
+// with [rewardBasisPoints]. It returns an error where the contract's checked arithmetic would revert.
+func CalculateReward(
+	rewardBasisPoints uint64,
+	stakeAmount *big.Int,
+	validatorStartTime uint64,
+	stakingStartTime uint64,
+	stakingEndTime uint64,
+	uptimeSeconds uint64,
+) (*big.Int, error) {
+	if stakeAmount.Sign() < 0 || stakeAmount.Cmp(maxUint256) > 0 {
+		return nil, errors.Errorf("stake amount %s is not a uint256", stakeAmount)
+	}
+	// The uptime check is evaluated in uint64, as in the contract.
+	if uptimeSeconds > math.MaxUint64/100 {
+		return nil, errors.Errorf("uptime of %d seconds overflows", uptimeSeconds)
+	}
+	if stakingEndTime < validatorStartTime {
+		return nil, errors.Errorf("staking end time %d is before validator start time %d",
+			stakingEndTime, validatorStartTime)
+	}
+	validationDuration := stakingEndTime - validatorStartTime
+	if validationDuration > math.MaxUint64/UptimeRewardsThresholdPercentage {
+		return nil, errors.Errorf("validation duration of %d seconds overflows", validationDuration)
+	}
+	if uptimeSeconds*100 < validationDuration*UptimeRewardsThresholdPercentage {
+		return new(big.Int), nil
+	}
+
+	if stakingEndTime < stakingStartTime {
+		return nil, errors.Errorf("staking end time %d is before staking start time %d",
+			stakingEndTime, stakingStartTime)
+	}
+	reward := new(big.Int).Mul(stakeAmount, new(big.Int).SetUint64(rewardBasisPoints))
+	if reward.Cmp(maxUint256) > 0 {
+		return nil, errors.Errorf("stake amount %s times %d reward basis points overflows", stakeAmount,
+			rewardBasisPoints)
+	}
+	reward.Mul(reward, new(big.Int).SetUint64(stakingEndTime-stakingStartTime))
+	if reward.Cmp(maxUint256) > 0 {
+		return nil, errors.Errorf("reward of stake amount %s over %d seconds overflows", stakeAmount,
+			stakingEndTime-stakingStartTime)
+	}
+	reward.Div(reward, big.NewInt(SecondsInYear))
+	return reward.Div(reward, big.NewInt(BipsConversionFactor)), nil
+}
+
+// RewardEstimateInput describes a validation that ends at ValidatorEndTime, and optionally a
+// delegation to it. The delegation ends at DelegationEndTime, or with the validation if it is zero
+// or later.
+type RewardEstimateInput struct {
+	RewardBasisPoints  uint64
+	ValidatorStake     *big.Int
+	ValidatorStartTime uint64
+	ValidatorEndTime   uint64
+	UptimeSeconds      uint64
+	DelegationFeeBips  uint16
+	// DelegatorStake is nil if there is no delegation.
+	DelegatorStake      *big.Int
+	DelegationStartTime uint64
+	DelegationEndTime   uint64
+}
+
+// RewardEstimate is the projected reward of a validation and its delegation.
+type RewardEstimate struct {
+	// ValidatorReward is the reward of the validator's own stake.
+	ValidatorReward *big.Int
+	// DelegationReward is the reward of the delegation, which is split into the DelegationFee paid
+	// to the validator and the DelegatorReward paid to the delegator.
+	DelegationReward *big.Int
+	DelegationFee    *big.Int
+	DelegatorReward  *big.Int
+}
+
+// EstimateRewards projects the rewards a PoS validator manager pays when the validation of [input]
+// ends, as it computes them with an ExampleRewardCalculator. The delegation is rewarded up to its
+// end, capped at the end of the validation, and nothing if it started after it. The uptime of both
+// is UptimeSeconds, as the contract reads the uptime last recorded for the validation.
+func EstimateRewards(input *RewardEstimateInput) (*RewardEstimate, error) {
+	validatorReward, err := CalculateReward(
+		input.RewardBasisPoints,
+		input.ValidatorStake,
+		input.ValidatorStartTime,
+		input.ValidatorStartTime,
+		input.ValidatorEndTime,
+		input.UptimeSeconds,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate validator reward")
+	}
+	estimate := &RewardEstimate{
+		ValidatorReward:  validatorReward,
+		DelegationReward: new(big.Int),
+		DelegationFee:    new(big.Int),
+		DelegatorReward:  new(big.Int),
+	}
+	delegationEndTime := input.ValidatorEndTime
+	if input.DelegationEndTime != 0 && input.DelegationEndTime < delegationEndTime {
+		delegationEndTime = input.DelegationEndTime
+	}
+	if input.DelegatorStake == nil || delegationEndTime <= input.DelegationStartTime {
+		return estimate, nil
+	}
+
+	estimate.DelegationReward, err = CalculateReward(
+		input.RewardBasisPoints,
+		input.DelegatorStake,
+		input.ValidatorStartTime,
+		input.DelegationStartTime,
+		delegationEndTime,
+		input.UptimeSeconds,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate delegation reward")
+	}
+	estimate.DelegationFee.Mul(estimate.DelegationReward, big.NewInt(int64(input.DelegationFeeBips)))
+	estimate.DelegationFee.Div(estimate.DelegationFee, big.NewInt(BipsConversionFactor))
+	estimate.DelegatorReward.Sub(estimate.DelegationReward, estimate.DelegationFee)
+	return estimate, nil
+}
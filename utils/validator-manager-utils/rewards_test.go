@@ -0,0 +1,148 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	examplerewardcalculator "github.com/ava-labs/icm-contracts/abi-bindings/go/validator-manager/ExampleRewardCalculator"
+	simulatedUtils "github.com/ava-labs/icm-contracts/utils/simulated-utils"
+	"github.com/ava-labs/subnet-evm/accounts/abi/bind"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateRewardMatchesContract(t *testing.T) {
+	ctx := context.Background()
+	key, address, err := simulatedUtils.NewFundedKey()
+	require.NoError(t, err)
+	opts, err := simulatedUtils.NewTransactor(key)
+	require.NoError(t, err)
+	backend := simulatedUtils.NewSimulatedBackend(address)
+	defer backend.Close()
+
+	const rewardBasisPoints = 42
+	_, tx, calculator, err := examplerewardcalculator.DeployExampleRewardCalculator(
+		opts, backend.Client(), rewardBasisPoints)
+	require.NoError(t, err)
+	_, err = simulatedUtils.CommitAndCheckSuccess(ctx, backend, tx.Hash())
+	require.NoError(t, err)
+
+	type rewardCase struct {
+		stakeAmount        *big.Int
+		validatorStartTime uint64
+		stakingStartTime   uint64
+		stakingEndTime     uint64
+		uptimeSeconds      uint64
+	}
+	cases := []rewardCase{
+		// A year of full uptime.
+		{big.NewInt(1e18), 1000, 1000, 1000 + SecondsInYear, SecondsInYear},
+		// Exactly the uptime threshold, and just below it.
+		{big.NewInt(1e18), 0, 0, 100, 80},
+		{big.NewInt(1e18), 0, 0, 100, 79},
+		// A delegation that started after the validation.
+		{big.NewInt(5e17), 100, 150, 200, 100},
+		// Rounded down to zero.
+		{big.NewInt(1), 0, 0, 100, 100},
+		// The staking end time is before the start times, which reverts, unless it is only before the
+		// staking start time and the uptime is below the threshold.
+		{big.NewInt(1e18), 100, 100, 50, 0},
+		{big.NewInt(1e18), 0, 100, 50, 50},
+		{big.NewInt(1e18), 0, 100, 50, 0},
+		// Overflows.
+		{big.NewInt(1e18), 0, 0, 100, math.MaxUint64/100 + 1},
+		{big.NewInt(1e18), 0, 0, math.MaxUint64/UptimeRewardsThresholdPercentage + 1, math.MaxUint64 / 100},
+		{maxUint256, 0, 0, 0, 0},
+		{new(big.Int).Div(maxUint256, big.NewInt(rewardBasisPoints)), 0, 0, 2, 2},
+	}
+	rng := rand.New(rand.NewSource(1)) //nolint:gosec
+	for i := 0; i < 100; i++ {
+		validatorStartTime := rng.Uint64() % 1e9
+		stakingStartTime := validatorStartTime + rng.Uint64()%1e8
+		stakingEndTime := stakingStartTime + rng.Uint64()%1e8
+		cases = append(cases, rewardCase{
+			stakeAmount:        new(big.Int).Rand(rng, new(big.Int).Lsh(big.NewInt(1), uint(rng.Intn(128)))),
+			validatorStartTime: validatorStartTime,
+			stakingStartTime:   stakingStartTime,
+			stakingEndTime:     stakingEndTime,
+			// Around the uptime threshold.
+			uptimeSeconds: (stakingEndTime - validatorStartTime) * uint64(70+rng.Intn(31)) / 100,
+		})
+	}
+
+	for _, c := range cases {
+		expected, callErr := calculator.CalculateReward(&bind.CallOpts{Context: ctx}, c.stakeAmount,
+			c.validatorStartTime, c.stakingStartTime, c.stakingEndTime, c.uptimeSeconds)
+		reward, err := CalculateReward(rewardBasisPoints, c.stakeAmount, c.validatorStartTime,
+			c.stakingStartTime, c.stakingEndTime, c.uptimeSeconds)
+		if callErr != nil {
+			require.Error(t, err, "%+v", c)
+			continue
+		}
+		require.NoError(t, err, "%+v", c)
+		require.Zero(t, expected.Cmp(reward), "%+v: expected %s, got %s", c, expected, reward)
+	}
+}
+
+func TestEstimateRewards(t *testing.T) {
+	input := &RewardEstimateInput{
+		RewardBasisPoints:   1000,
+		ValidatorStake:      big.NewInt(2e18),
+		ValidatorStartTime:  0,
+		ValidatorEndTime:    SecondsInYear,
+		UptimeSeconds:       SecondsInYear,
+		DelegationFeeBips:   250,
+		DelegatorStake:      big.NewInt(1e18),
+		DelegationStartTime: SecondsInYear / 2,
+	}
+	estimate, err := EstimateRewards(input)
+	require.NoError(t, err)
+	require.Equal(t, &RewardEstimate{
+		ValidatorReward:  big.NewInt(2e17),
+		DelegationReward: big.NewInt(5e16),
+		DelegationFee:    big.NewInt(125e13),
+		DelegatorReward:  big.NewInt(4875e13),
+	}, estimate)
+
+	// A delegation that ends before the validation is rewarded until it ends.
+	input.DelegationEndTime = SecondsInYear / 4 * 3
+	estimate, err = EstimateRewards(input)
+	require.NoError(t, err)
+	require.Equal(t, &RewardEstimate{
+		ValidatorReward:  big.NewInt(2e17),
+		DelegationReward: big.NewInt(25e15),
+		DelegationFee:    big.NewInt(625e12),
+		DelegatorReward:  big.NewInt(24375e12),
+	}, estimate)
+
+	// A delegation end after the validation's is capped at it.
+	input.DelegationEndTime = 2 * SecondsInYear
+	estimate, err = EstimateRewards(input)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(5e16), estimate.DelegationReward)
+	input.DelegationEndTime = 0
+
+	// A delegation that starts after the validation ends is not rewarded.
+	input.DelegationStartTime = SecondsInYear
+	estimate, err = EstimateRewards(input)
+	require.NoError(t, err)
+	require.Zero(t, estimate.DelegationReward.Sign())
+	require.Zero(t, estimate.DelegatorReward.Sign())
+
+	// Below the uptime threshold, nothing is rewarded.
+	input.DelegationStartTime = 0
+	input.UptimeSeconds = SecondsInYear / 2
+	estimate, err = EstimateRewards(input)
+	require.NoError(t, err)
+	require.Zero(t, estimate.ValidatorReward.Sign())
+	require.Zero(t, estimate.DelegationReward.Sign())
+
+	input.ValidatorStartTime = SecondsInYear + 1
+	_, err = EstimateRewards(input)
+	require.ErrorContains(t, err, "failed to calculate validator reward")
+}
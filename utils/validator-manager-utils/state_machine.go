@@ -0,0 +1,297 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/subnet-evm/core/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ValidatorStatus mirrors the ValidatorStatus enum of the validator manager contracts.
+type ValidatorStatus uint8
+
+const (
+	ValidatorUnknown ValidatorStatus = iota
+	ValidatorPendingAdded
+	ValidatorActive
+	ValidatorPendingRemoved
+	ValidatorCompleted
+	ValidatorInvalidated
+)
+
+var validatorStatusNames = []string{"Unknown", "PendingAdded", "Active", "PendingRemoved", "Completed", "Invalidated"}
+
+func (s ValidatorStatus) String() string {
+	if int(s) < len(validatorStatusNames) {
+		return validatorStatusNames[s]
+	}
+	return fmt.Sprintf("ValidatorStatus(%d)", uint8(s))
+}
+
+// DelegatorStatus mirrors the DelegatorStatus enum of the PoS validator manager contracts, with the
+// addition of DelegatorCompleted. The contracts delete a delegation once it ends, so its status
+// reads as DelegatorUnknown, while the model keeps it as DelegatorCompleted.
+type DelegatorStatus uint8
+
+const (
+	DelegatorUnknown DelegatorStatus = iota
+	DelegatorPendingAdded
+	DelegatorActive
+	DelegatorPendingRemoved
+	DelegatorCompleted
+)
+
+var delegatorStatusNames = []string{"Unknown", "PendingAdded", "Active", "PendingRemoved", "Completed"}
+
+func (s DelegatorStatus) String() string {
+	if int(s) < len(delegatorStatusNames) {
+		return delegatorStatusNames[s]
+	}
+	return fmt.Sprintf("DelegatorStatus(%d)", uint8(s))
+}
+
+// EventKind is the name of a validator manager event.
+type EventKind string
+
+const (
+	EventInitialValidatorCreated     EventKind = "InitialValidatorCreated"
+	EventValidationPeriodCreated     EventKind = "ValidationPeriodCreated"
+	EventValidationPeriodRegistered  EventKind = "ValidationPeriodRegistered"
+	EventValidatorWeightUpdate       EventKind = "ValidatorWeightUpdate"
+	EventValidatorRemovalInitialized EventKind = "ValidatorRemovalInitialized"
+	EventValidationPeriodEnded       EventKind = "ValidationPeriodEnded"
+	EventUptimeUpdated               EventKind = "UptimeUpdated"
+	EventDelegatorAdded              EventKind = "DelegatorAdded"
+	EventDelegatorRegistered         EventKind = "DelegatorRegistered"
+	EventDelegatorRemovalInitialized EventKind = "DelegatorRemovalInitialized"
+	EventDelegationEnded             EventKind = "DelegationEnded"
+)
+
+// Event is a validator manager event that changes the state of a validation or delegation. Only
+// the fields of its kind are set.
+type Event struct {
+	Kind         EventKind
+	ValidationID ids.ID
+	// DelegationID is set for the delegation events.
+	DelegationID ids.ID
+	// Weight is the validator weight of the validation events and ValidatorWeightUpdate, and the
+	// delegator weight of DelegatorAdded.
+	Weight uint64
+	// ValidatorWeight is the validator weight after DelegatorAdded.
+	ValidatorWeight uint64
+	// Nonce is the weight message nonce of ValidatorWeightUpdate and DelegatorAdded.
+	Nonce uint64
+	// Delegator is the delegator address of DelegatorAdded.
+	Delegator common.Address
+	// Uptime is the uptime in seconds of UptimeUpdated.
+	Uptime uint64
+	// Status is the final status of ValidationPeriodEnded.
+	Status ValidatorStatus
+	// Log is the log the event was parsed from, if it was.
+	Log *types.Log
+}
+
+func (e *Event) String() string {
+	s := fmt.Sprintf("%s of validation %s", e.Kind, e.ValidationID)
+	if e.DelegationID != ids.Empty {
+		s = fmt.Sprintf("%s of delegation %s to validation %s", e.Kind, e.DelegationID, e.ValidationID)
+	}
+	if e.Log != nil {
+		s += fmt.Sprintf(" in block %d tx %s", e.Log.BlockNumber, e.Log.TxHash.Hex())
+	}
+	return s
+}
+
+// Validation is the state of a validation rebuilt from its events.
+type Validation struct {
+	ValidationID ids.ID
+	Status       ValidatorStatus
+	Weight       uint64
+	// Nonce is the highest weight message nonce of the validation.
+	Nonce  uint64
+	Uptime uint64
+	// Delegations are the IDs of the validation's delegations, in the order they were added.
+	Delegations []ids.ID
+}
+
+// Delegation is the state of a delegation rebuilt from its events.
+type Delegation struct {
+	DelegationID ids.ID
+	ValidationID ids.ID
+	Status       DelegatorStatus
+	Weight       uint64
+	Delegator    common.Address
+}
+
+// TransitionError is returned for an event that the validator manager can't emit in the state of
+// its validation or delegation.
+type TransitionError struct {
+	Event  *Event
+	Reason string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("illegal %s: %s", e.Event, e.Reason)
+}
+
+// Model rebuilds the state of the validations and delegations of a validator manager from its
+// events, following the state transitions of contracts/validator-manager/StateTransition.md.
+type Model struct {
+	Validations map[ids.ID]*Validation
+	Delegations map[ids.ID]*Delegation
+}
+
+func NewModel() *Model {
+	return &Model{
+		Validations: make(map[ids.ID]*Validation),
+		Delegations: make(map[ids.ID]*Delegation),
+	}
+}
+
+// Replay applies the events in the order the validator manager emitted them, and returns the
+// errors of the events that were illegal, which are skipped.
+func (m *Model) Replay(events []*Event) []*TransitionError {
+	var illegal []*TransitionError
+	for _, event := range events {
+		if err := m.Apply(event); err != nil {
+			illegal = append(illegal, err)
+		}
+	}
+	return illegal
+}
+
+// Apply applies the event to the state of its validation or delegation. If the validator manager
+// can't emit the event in that state, the state is not changed and a TransitionError is returned.
+func (m *Model) Apply(event *Event) *TransitionError {
+	illegal := func(format string, args ...interface{}) *TransitionError {
+		return &TransitionError{Event: event, Reason: fmt.Sprintf(format, args...)}
+	}
+	validation, ok := m.Validations[event.ValidationID]
+	if !ok {
+		validation = &Validation{ValidationID: event.ValidationID}
+	}
+	status := validation.Status
+
+	switch event.Kind {
+	case EventInitialValidatorCreated, EventValidationPeriodCreated:
+		if status != ValidatorUnknown {
+			return illegal("validation is %s", status)
+		}
+		validation.Status = ValidatorPendingAdded
+		if event.Kind == EventInitialValidatorCreated {
+			validation.Status = ValidatorActive
+		}
+		validation.Weight = event.Weight
+		m.Validations[event.ValidationID] = validation
+		return nil
+	case EventValidationPeriodRegistered:
+		if status != ValidatorPendingAdded {
+			return illegal("validation is %s", status)
+		}
+		validation.Status = ValidatorActive
+		return nil
+	case EventValidatorWeightUpdate:
+		if status != ValidatorActive {
+			return illegal("validation is %s", status)
+		}
+		if event.Nonce <= validation.Nonce {
+			return illegal("nonce %d is not above nonce %d", event.Nonce, validation.Nonce)
+		}
+		validation.Nonce = event.Nonce
+		validation.Weight = event.Weight
+		return nil
+	case EventValidatorRemovalInitialized:
+		if status != ValidatorActive {
+			return illegal("validation is %s", status)
+		}
+		validation.Status = ValidatorPendingRemoved
+		return nil
+	case EventValidationPeriodEnded:
+		switch {
+		case status == ValidatorPendingRemoved && event.Status == ValidatorCompleted:
+		case status == ValidatorPendingAdded && event.Status == ValidatorInvalidated:
+		default:
+			return illegal("validation is %s and ends as %s", status, event.Status)
+		}
+		validation.Status = event.Status
+		return nil
+	case EventUptimeUpdated:
+		// Uptime proofs are submitted while the validation is active, or when its removal is
+		// initialized.
+		if status != ValidatorActive && status != ValidatorPendingRemoved {
+			return illegal("validation is %s", status)
+		}
+		if event.Uptime <= validation.Uptime {
+			return illegal("uptime %d is not above uptime %d", event.Uptime, validation.Uptime)
+		}
+		validation.Uptime = event.Uptime
+		return nil
+	}
+
+	delegation, ok := m.Delegations[event.DelegationID]
+	if event.Kind == EventDelegatorAdded {
+		if ok {
+			return illegal("delegation is %s", delegation.Status)
+		}
+		if status != ValidatorActive {
+			return illegal("validation is %s", status)
+		}
+		if event.Nonce < validation.Nonce {
+			return illegal("nonce %d is below nonce %d", event.Nonce, validation.Nonce)
+		}
+		validation.Nonce = event.Nonce
+		validation.Weight = event.ValidatorWeight
+		validation.Delegations = append(validation.Delegations, event.DelegationID)
+		m.Delegations[event.DelegationID] = &Delegation{
+			DelegationID: event.DelegationID,
+			ValidationID: event.ValidationID,
+			Status:       DelegatorPendingAdded,
+			Weight:       event.Weight,
+			Delegator:    event.Delegator,
+		}
+		return nil
+	}
+	if !ok {
+		if event.Kind == EventDelegatorRegistered || event.Kind == EventDelegatorRemovalInitialized ||
+			event.Kind == EventDelegationEnded {
+			return illegal("delegation is %s", DelegatorUnknown)
+		}
+		return illegal("unknown event")
+	}
+	if delegation.ValidationID != event.ValidationID {
+		return illegal("delegation is to validation %s", delegation.ValidationID)
+	}
+
+	switch event.Kind {
+	case EventDelegatorRegistered:
+		// A delegation registered after its validator's removal is initialized stays active until
+		// the validation is completed.
+		if delegation.Status != DelegatorPendingAdded ||
+			(status != ValidatorActive && status != ValidatorPendingRemoved) {
+			return illegal("delegation is %s and validation is %s", delegation.Status, status)
+		}
+		delegation.Status = DelegatorActive
+	case EventDelegatorRemovalInitialized:
+		if delegation.Status != DelegatorActive || status != ValidatorActive {
+			return illegal("delegation is %s and validation is %s", delegation.Status, status)
+		}
+		delegation.Status = DelegatorPendingRemoved
+	case EventDelegationEnded:
+		// Once the validation is completed, delegations that are pending or active end directly.
+		switch {
+		case delegation.Status == DelegatorPendingRemoved:
+		case status == ValidatorCompleted &&
+			(delegation.Status == DelegatorPendingAdded || delegation.Status == DelegatorActive):
+		default:
+			return illegal("delegation is %s and validation is %s", delegation.Status, status)
+		}
+		delegation.Status = DelegatorCompleted
+	default:
+		return illegal("unknown event")
+	}
+	return nil
+}
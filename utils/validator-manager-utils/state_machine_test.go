@@ -0,0 +1,312 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	stateTransitionPath = "../../contracts/validator-manager/StateTransition.md"
+	diagramTransitions  = 20
+)
+
+// diagramEvent is an event the random walks emit, named after its kind, and its final status for
+// ValidationPeriodEnded.
+type diagramEvent string
+
+const (
+	walkCreated         diagramEvent = "ValidationPeriodCreated"
+	walkRegistered      diagramEvent = "ValidationPeriodRegistered"
+	walkInvalidated     diagramEvent = "ValidationPeriodEnded(Invalidated)"
+	walkRemovalInit     diagramEvent = "ValidatorRemovalInitialized"
+	walkCompleted       diagramEvent = "ValidationPeriodEnded(Completed)"
+	walkDelAdded        diagramEvent = "DelegatorAdded"
+	walkDelRegistered   diagramEvent = "DelegatorRegistered"
+	walkDelRemovalInit  diagramEvent = "DelegatorRemovalInitialized"
+	walkDelegationEnded diagramEvent = "DelegationEnded"
+)
+
+var walkEvents = []diagramEvent{
+	walkCreated, walkRegistered, walkInvalidated, walkRemovalInit, walkCompleted,
+	walkDelAdded, walkDelRegistered, walkDelRemovalInit, walkDelegationEnded,
+}
+
+// diagramEdgeEvent is the event emitted by the function of a diagram edge. Delegation functions
+// that complete the delegation emit DelegationEnded, which the edge shows by dropping D.
+func diagramEdgeEvent(t *testing.T, action string, target string) diagramEvent {
+	ended := !strings.Contains(target, "D.")
+	switch action {
+	case "initVdrReg":
+		return walkCreated
+	case "completeVdrReg":
+		return walkRegistered
+	case "completeVdrReg (expiry passed)":
+		return walkInvalidated
+	case "initEndVdr":
+		return walkRemovalInit
+	case "completeEndVdr":
+		return walkCompleted
+	case "initDelReg":
+		return walkDelAdded
+	case "completeDelReg":
+		if ended {
+			return walkDelegationEnded
+		}
+		return walkDelRegistered
+	case "initEndDel":
+		if ended {
+			return walkDelegationEnded
+		}
+		return walkDelRemovalInit
+	case "completeEndDel":
+		return walkDelegationEnded
+	}
+	require.FailNow(t, "unknown diagram action", action)
+	return ""
+}
+
+// readDiagram returns the transitions of the StateTransition.md diagram, by source state and event.
+func readDiagram(t *testing.T) map[string]map[diagramEvent]string {
+	contents, err := os.ReadFile(stateTransitionPath)
+	require.NoError(t, err)
+	edge := regexp.MustCompile(`^\s*(\S+)\s*-->\s*([^\s:]+)\s*:\s*(.+?)\s*$`)
+	transitions := make(map[string]map[diagramEvent]string)
+	edges := 0
+	for _, line := range strings.Split(string(contents), "\n") {
+		match := edge.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		source, target := match[1], match[2]
+		event := diagramEdgeEvent(t, match[3], target)
+		if transitions[source] == nil {
+			transitions[source] = make(map[diagramEvent]string)
+		}
+		// The events must determine the state.
+		_, ok := transitions[source][event]
+		require.False(t, ok, "%s has two %s transitions", source, event)
+		transitions[source][event] = target
+		edges++
+	}
+	require.Equal(t, diagramTransitions, edges)
+	return transitions
+}
+
+// diagramState returns the diagram state of a validation and its delegation. The diagram has no
+// Invalidated status, and shows invalidated validations as completed.
+func diagramState(model *Model, validationID ids.ID, delegationID ids.ID) string {
+	validation, ok := model.Validations[validationID]
+	if !ok {
+		return "[*]"
+	}
+	status := validation.Status
+	if status == ValidatorInvalidated {
+		status = ValidatorCompleted
+	}
+	state := "V." + status.String()
+	if delegation, ok := model.Delegations[delegationID]; ok && delegation.Status != DelegatorCompleted {
+		state += ",D." + delegation.Status.String()
+	}
+	return state
+}
+
+// TestModelFollowsDiagram walks the model with random events, and checks that it accepts exactly
+// the events of the diagram's transitions, and reaches their target states. It fails when
+// StateTransition.md changes without the model, so both must be updated together.
+func TestModelFollowsDiagram(t *testing.T) {
+	transitions := readDiagram(t)
+	taken := make(map[string]bool)
+	for seed := int64(0); seed < 200; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		model := NewModel()
+		validationID := ids.GenerateTestID()
+		delegationID := ids.Empty
+		nonce := uint64(0)
+		for step := 0; step < 40; step++ {
+			walkEvent := walkEvents[random.Intn(len(walkEvents))]
+			source := diagramState(model, validationID, delegationID)
+			target, legal := transitions[source][walkEvent]
+
+			event := &Event{ValidationID: validationID, DelegationID: delegationID}
+			switch walkEvent {
+			case walkInvalidated:
+				event.Kind, event.Status = EventValidationPeriodEnded, ValidatorInvalidated
+			case walkCompleted:
+				event.Kind, event.Status = EventValidationPeriodEnded, ValidatorCompleted
+			case walkDelAdded:
+				// The diagram has a single delegation, so a new one is only added once the last
+				// one is completed.
+				event.Kind = EventDelegatorAdded
+				if delegation, ok := model.Delegations[delegationID]; !ok || delegation.Status == DelegatorCompleted {
+					event.DelegationID = ids.GenerateTestID()
+				}
+				nonce++
+				event.Nonce = nonce
+			default:
+				event.Kind = EventKind(walkEvent)
+			}
+
+			err := model.Apply(event)
+			if !legal {
+				require.NotNil(t, err, "seed %d: %s accepted in %s", seed, walkEvent, source)
+				require.Equal(t, source, diagramState(model, validationID, delegationID))
+				continue
+			}
+			require.Nil(t, err, "seed %d: %s rejected in %s", seed, walkEvent, source)
+			delegationID = event.DelegationID
+			require.Equal(t, target, diagramState(model, validationID, delegationID),
+				"seed %d: %s from %s", seed, walkEvent, source)
+			taken[source+" "+string(walkEvent)] = true
+		}
+	}
+	require.Len(t, taken, diagramTransitions, "the walks must take every transition of the diagram")
+}
+
+func TestModelIllegalSequences(t *testing.T) {
+	validationID := ids.ID{1}
+	delegationID := ids.ID{2}
+	created := &Event{Kind: EventValidationPeriodCreated, ValidationID: validationID, Weight: 20}
+	registered := &Event{Kind: EventValidationPeriodRegistered, ValidationID: validationID, Weight: 20}
+	weightUpdate := &Event{Kind: EventValidatorWeightUpdate, ValidationID: validationID, Nonce: 1, Weight: 25}
+	delegatorAdded := &Event{
+		Kind:            EventDelegatorAdded,
+		ValidationID:    validationID,
+		DelegationID:    delegationID,
+		Nonce:           1,
+		Weight:          5,
+		ValidatorWeight: 25,
+	}
+	removalInit := &Event{Kind: EventValidatorRemovalInitialized, ValidationID: validationID}
+
+	testCases := []struct {
+		name   string
+		events []*Event
+		reason string
+	}{
+		{
+			name:   "registered before created",
+			events: []*Event{registered},
+			reason: "validation is Unknown",
+		},
+		{
+			name:   "created twice",
+			events: []*Event{created, created},
+			reason: "validation is PendingAdded",
+		},
+		{
+			name: "completed while pending added",
+			events: []*Event{
+				created,
+				{Kind: EventValidationPeriodEnded, ValidationID: validationID, Status: ValidatorCompleted},
+			},
+			reason: "validation is PendingAdded and ends as Completed",
+		},
+		{
+			name:   "weight nonce replayed",
+			events: []*Event{created, registered, weightUpdate, weightUpdate},
+			reason: "nonce 1 is not above nonce 1",
+		},
+		{
+			name:   "delegator added to pending validation",
+			events: []*Event{created, delegatorAdded},
+			reason: "validation is PendingAdded",
+		},
+		{
+			name: "delegation ended while active",
+			events: []*Event{
+				created, registered, weightUpdate, delegatorAdded,
+				{Kind: EventDelegatorRegistered, ValidationID: validationID, DelegationID: delegationID},
+				{Kind: EventDelegationEnded, ValidationID: validationID, DelegationID: delegationID},
+			},
+			reason: "delegation is Active and validation is Active",
+		},
+		{
+			name: "delegator removal initialized after validator removal",
+			events: []*Event{
+				created, registered, weightUpdate, delegatorAdded,
+				{Kind: EventDelegatorRegistered, ValidationID: validationID, DelegationID: delegationID},
+				removalInit,
+				{Kind: EventDelegatorRemovalInitialized, ValidationID: validationID, DelegationID: delegationID},
+			},
+			reason: "delegation is Active and validation is PendingRemoved",
+		},
+		{
+			name: "delegation of another validation",
+			events: []*Event{
+				created, registered, delegatorAdded,
+				{Kind: EventDelegatorRegistered, ValidationID: ids.ID{3}, DelegationID: delegationID},
+			},
+			reason: "delegation is to validation " + validationID.String(),
+		},
+		{
+			name: "uptime after invalidation",
+			events: []*Event{
+				created,
+				{Kind: EventValidationPeriodEnded, ValidationID: validationID, Status: ValidatorInvalidated},
+				{Kind: EventUptimeUpdated, ValidationID: validationID, Uptime: 1},
+			},
+			reason: "validation is Invalidated",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			model := NewModel()
+			illegal := model.Replay(test.events)
+			require.Len(t, illegal, 1)
+			require.Equal(t, test.events[len(test.events)-1], illegal[0].Event)
+			require.Equal(t, test.reason, illegal[0].Reason)
+		})
+	}
+}
+
+func TestModelState(t *testing.T) {
+	validationID := ids.ID{1}
+	delegationID := ids.ID{2}
+	model := NewModel()
+	events := []*Event{
+		{Kind: EventInitialValidatorCreated, ValidationID: ids.ID{3}, Weight: 100},
+		{Kind: EventValidationPeriodCreated, ValidationID: validationID, Weight: 20},
+		{Kind: EventValidationPeriodRegistered, ValidationID: validationID, Weight: 20},
+		{Kind: EventUptimeUpdated, ValidationID: validationID, Uptime: 60},
+		{Kind: EventValidatorWeightUpdate, ValidationID: validationID, Nonce: 1, Weight: 25},
+		{
+			Kind:            EventDelegatorAdded,
+			ValidationID:    validationID,
+			DelegationID:    delegationID,
+			Nonce:           1,
+			Weight:          5,
+			ValidatorWeight: 25,
+		},
+		{Kind: EventDelegatorRegistered, ValidationID: validationID, DelegationID: delegationID},
+		{Kind: EventValidatorWeightUpdate, ValidationID: validationID, Nonce: 2, Weight: 0},
+		{Kind: EventValidatorRemovalInitialized, ValidationID: validationID},
+		{Kind: EventUptimeUpdated, ValidationID: validationID, Uptime: 90},
+		{Kind: EventValidationPeriodEnded, ValidationID: validationID, Status: ValidatorCompleted},
+		{Kind: EventDelegationEnded, ValidationID: validationID, DelegationID: delegationID},
+	}
+	require.Empty(t, model.Replay(events))
+	require.Equal(t, &Validation{
+		ValidationID: validationID,
+		Status:       ValidatorCompleted,
+		Weight:       0,
+		Nonce:        2,
+		Uptime:       90,
+		Delegations:  []ids.ID{delegationID},
+	}, model.Validations[validationID])
+	require.Equal(t, &Delegation{
+		DelegationID: delegationID,
+		ValidationID: validationID,
+		Status:       DelegatorCompleted,
+		Weight:       5,
+	}, model.Delegations[delegationID])
+	require.Equal(t, ValidatorActive, model.Validations[ids.ID{3}].Status)
+}
@@ -0,0 +1,275 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	upgradeUtils "github.com/ava-labs/icm-contracts/utils/upgrade-utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// linkPlaceholder matches the placeholder of a library address in unlinked bytecode.
+var linkPlaceholder = regexp.MustCompile(`__\$[0-9a-fA-F]{34}\$__`)
+
+var (
+	// solidityVersionAssignment matches the assignment of SOLIDITY_VERSION in a versions script.
+	solidityVersionAssignment = regexp.MustCompile(`(?m)^\s*(?:export\s+)?SOLIDITY_VERSION=(.*)$`)
+	// solidityVersionLiteral matches an assigned value that is a version, quoted or not.
+	solidityVersionLiteral = regexp.MustCompile(`^["']?(\d+\.\d+\.\d+)["']?\s*(?:#.*)?$`)
+	// solcVersionSetting matches the solc_version setting of foundry.toml.
+	solcVersionSetting = regexp.MustCompile(`(?m)^\s*solc_version\s*=\s*["'](\d+\.\d+\.\d+)["']`)
+)
+
+// Backend is a chain with contracts to verify.
+type Backend interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+}
+
+// Range is a range of bytes in a contract's code.
+type Range struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// Artifact is the deployed bytecode of a contract in a release, from a forge artifact.
+type Artifact struct {
+	Release string
+	Path    string
+	// DeployedBytecode is the runtime code of the contract, with unlinked library addresses zeroed.
+	DeployedBytecode []byte
+	// Masked are the ranges of the code that differ between deployments of the contract: the values
+	// of immutable variables and the addresses of linked libraries.
+	Masked []Range
+	// CompilerVersion is the version of solc the contract was compiled with, if the artifact has
+	// its metadata.
+	CompilerVersion string
+}
+
+type artifactFile struct {
+	DeployedBytecode struct {
+		Object              string                        `json:"object"`
+		LinkReferences      map[string]map[string][]Range `json:"linkReferences"`
+		ImmutableReferences map[string][]Range            `json:"immutableReferences"`
+	} `json:"deployedBytecode"`
+	Metadata struct {
+		Compiler struct {
+			Version string `json:"version"`
+		} `json:"compiler"`
+	} `json:"metadata"`
+}
+
+// ReadArtifact reads the deployed bytecode of a contract of [release] from the forge artifact [path].
+// If [path] is a directory, such as forge's out directory, the artifact of [contract] is read from it.
+func ReadArtifact(release, path, contract string) (*Artifact, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read artifact of release %s", release)
+	}
+	if info.IsDir() {
+		if contract == "" {
+			return nil, errors.Errorf("a contract name is needed to find its artifact in %s", path)
+		}
+		path = filepath.Join(path, contract+".sol", contract+".json")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read artifact of release %s", release)
+	}
+	var file artifactFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse artifact %s", path)
+	}
+	object := strings.TrimPrefix(file.DeployedBytecode.Object, "0x")
+	if object == "" {
+		return nil, errors.Errorf("artifact %s has no deployed bytecode", path)
+	}
+	object = linkPlaceholder.ReplaceAllString(object, strings.Repeat("0", 40))
+	code, err := hex.DecodeString(object)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode deployed bytecode of %s", path)
+	}
+
+	artifact := &Artifact{
+		Release:          release,
+		Path:             path,
+		DeployedBytecode: code,
+		CompilerVersion:  file.Metadata.Compiler.Version,
+	}
+	for _, references := range file.DeployedBytecode.ImmutableReferences {
+		artifact.Masked = append(artifact.Masked, references...)
+	}
+	for _, libraries := range file.DeployedBytecode.LinkReferences {
+		for _, references := range libraries {
+			artifact.Masked = append(artifact.Masked, references...)
+		}
+	}
+	for _, r := range artifact.Masked {
+		if r.Start < 0 || r.Length < 0 || r.Start+r.Length > len(code) {
+			return nil, errors.Errorf("artifact %s references bytes %d to %d outside of its bytecode",
+				path, r.Start, r.Start+r.Length)
+		}
+	}
+	return artifact, nil
+}
+
+// ReadSolidityVersion returns the SOLIDITY_VERSION set by the versions script at [path], such as
+// scripts/versions.sh, which is the solc version the repository's contracts are built with.
+// The script is parsed rather than run. If it doesn't assign a version literally, as
+// scripts/versions.sh doesn't, the version is the solc_version of the foundry.toml it reads,
+// the one at the root of the repository containing the script's directory.
+func ReadSolidityVersion(path string) (string, error) {
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read versions script %s", path)
+	}
+	assignment := solidityVersionAssignment.FindSubmatch(script)
+	if assignment == nil {
+		return "", errors.Errorf("versions script %s sets no SOLIDITY_VERSION", path)
+	}
+	value := strings.TrimSpace(string(assignment[1]))
+	if literal := solidityVersionLiteral.FindStringSubmatch(value); literal != nil {
+		return literal[1], nil
+	}
+	if !strings.Contains(value, "foundry.toml") {
+		return "", errors.Errorf("versions script %s sets SOLIDITY_VERSION to %s, which isn't a version",
+			path, value)
+	}
+	foundryPath := filepath.Join(filepath.Dir(path), "..", "foundry.toml")
+	foundry, err := os.ReadFile(foundryPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s for the SOLIDITY_VERSION of %s", foundryPath, path)
+	}
+	setting := solcVersionSetting.FindSubmatch(foundry)
+	if setting == nil {
+		return "", errors.Errorf("%s sets no solc_version", foundryPath)
+	}
+	return string(setting[1]), nil
+}
+
+// CompilerMismatch compares the version of solc the artifact was compiled with to [version].
+// It returns an empty string if they match, and why they don't otherwise.
+func (a *Artifact) CompilerMismatch(version string) string {
+	if a.CompilerVersion == "" {
+		return "artifact has no compiler version in its metadata"
+	}
+	// solc versions in metadata carry the build, such as 0.8.25+commit.b61c2a91.
+	compiled, _, _ := strings.Cut(a.CompilerVersion, "+")
+	if compiled != version {
+		return fmt.Sprintf("compiled with solc %s, not %s", compiled, version)
+	}
+	return ""
+}
+
+// Match compares [code] with the artifact's deployed bytecode, ignoring the masked ranges and the
+// CBOR encoded metadata solc appends, which holds a hash of the sources and the compiler version.
+// It returns an empty string if they match, and why they don't otherwise.
+func (a *Artifact) Match(code []byte) string {
+	if len(code) != len(a.DeployedBytecode) {
+		return fmt.Sprintf("code is %d bytes, not %d", len(code), len(a.DeployedBytecode))
+	}
+	expected := a.mask(a.DeployedBytecode)
+	actual := a.mask(code)
+	expectedLength, actualLength := codeLength(expected), codeLength(actual)
+	if expectedLength != actualLength {
+		return fmt.Sprintf("metadata is %d bytes, not %d", len(actual)-actualLength, len(expected)-expectedLength)
+	}
+	for i := 0; i < expectedLength; i++ {
+		if expected[i] != actual[i] {
+			return fmt.Sprintf("code differs at byte %d", i)
+		}
+	}
+	return ""
+}
+
+// mask returns a copy of [code] with the masked ranges zeroed.
+func (a *Artifact) mask(code []byte) []byte {
+	masked := common.CopyBytes(code)
+	for _, r := range a.Masked {
+		clear(masked[r.Start : r.Start+r.Length])
+	}
+	return masked
+}
+
+// codeLength returns the length of [code] without the CBOR encoded metadata solc appends to it, whose
+// length is in the last two bytes. The metadata is a CBOR map, so it starts with a map header.
+func codeLength(code []byte) int {
+	if len(code) < 2 {
+		return len(code)
+	}
+	metadataLength := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	start := len(code) - 2 - metadataLength
+	if metadataLength == 0 || start < 0 || code[start]&0xe0 != 0xa0 {
+		return len(code)
+	}
+	return start
+}
+
+// Result is how the code of a contract compares with an artifact.
+type Result struct {
+	Release string
+	// Mismatch is why the code doesn't match the artifact, and empty if it does.
+	Mismatch string
+}
+
+// Report is how the code at an address compares with the artifacts of each release.
+type Report struct {
+	Address common.Address
+	// Implementation is the implementation of an EIP-1967 proxy at Address, whose code is the one
+	// compared, and the zero address if Address is not a proxy.
+	Implementation common.Address
+	CodeHash       common.Hash
+	Results        []Result
+}
+
+// Matches returns the releases the code matches.
+func (r *Report) Matches() []string {
+	var releases []string
+	for _, result := range r.Results {
+		if result.Mismatch == "" {
+			releases = append(releases, result.Release)
+		}
+	}
+	return releases
+}
+
+// Verify compares the code at [address] with [artifacts]. If [address] is an EIP-1967 proxy, the code
+// of its implementation is compared instead.
+func Verify(ctx context.Context, backend Backend, address common.Address, artifacts []*Artifact) (*Report, error) {
+	report := &Report{Address: address}
+	slot, err := backend.StorageAt(ctx, address, upgradeUtils.ImplementationSlot, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read implementation slot of %s", address.Hex())
+	}
+	codeAddress := address
+	if report.Implementation = common.BytesToAddress(slot); report.Implementation != (common.Address{}) {
+		codeAddress = report.Implementation
+	}
+	code, err := backend.CodeAt(ctx, codeAddress, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get code at %s", codeAddress.Hex())
+	}
+	if len(code) == 0 {
+		return nil, errors.Errorf("no contract at %s", codeAddress.Hex())
+	}
+	report.CodeHash = crypto.Keccak256Hash(code)
+	for _, artifact := range artifacts {
+		report.Results = append(report.Results, Result{
+			Release:  artifact.Release,
+			Mismatch: artifact.Match(code),
+		})
+	}
+	return report, nil
+}
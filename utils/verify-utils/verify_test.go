@@ -0,0 +1,177 @@
+// (c) 2024, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	transparentupgradeableproxy "github.com/ava-labs/icm-contracts/abi-bindings/go/TransparentUpgradeableProxy"
+	validatorsetsig "github.com/ava-labs/icm-contracts/abi-bindings/go/governance/ValidatorSetSig"
+	receiverTestUtils "github.com/ava-labs/icm-contracts/utils/receiver-test-utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+// writeArtifact writes a forge artifact of [code] to [dir]/ValidatorSetSig.sol/ValidatorSetSig.json,
+// with the occurrences of [immutable] as immutable references.
+func writeArtifact(t *testing.T, dir string, code []byte, immutable []byte) string {
+	references := []Range{}
+	for offset := 0; ; {
+		i := bytes.Index(code[offset:], immutable)
+		if i < 0 {
+			break
+		}
+		references = append(references, Range{Start: offset + i, Length: len(immutable)})
+		offset += i + len(immutable)
+	}
+	require.NotEmpty(t, references)
+
+	var file artifactFile
+	file.DeployedBytecode.Object = hexutil.Encode(code)
+	file.DeployedBytecode.ImmutableReferences = map[string][]Range{"54": references}
+	file.Metadata.Compiler.Version = "0.8.25+commit.b61c2a91"
+	data, err := json.Marshal(file)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "ValidatorSetSig.sol", "ValidatorSetSig.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	kit, err := receiverTestUtils.NewReceiverTestKit()
+	require.NoError(t, err)
+	defer kit.Close()
+	opts, err := kit.DeployerTransactor()
+	require.NoError(t, err)
+	deploy := func(blockchainID common.Hash) (common.Address, []byte) {
+		address, tx, _, err := validatorsetsig.DeployValidatorSetSig(opts, kit.Client(), blockchainID)
+		require.NoError(t, err)
+		_, err = kit.Commit(ctx, tx)
+		require.NoError(t, err)
+		code, err := kit.Client().CodeAt(ctx, address, nil)
+		require.NoError(t, err)
+		return address, code
+	}
+
+	// The release's artifact was built for another chain, so its immutable differs.
+	releaseID := bytes.Repeat([]byte{0xaa}, 32)
+	_, releaseCode := deploy(common.BytesToHash(releaseID))
+	dir := t.TempDir()
+	writeArtifact(t, dir, releaseCode, releaseID)
+	release, err := ReadArtifact("v1.0.0", dir, "ValidatorSetSig")
+	require.NoError(t, err)
+	require.Equal(t, "0.8.25+commit.b61c2a91", release.CompilerVersion)
+
+	// A later release whose metadata differs matches too, but not one whose code differs.
+	metadataCode := common.CopyBytes(releaseCode)
+	metadataCode[codeLength(metadataCode)+1] ^= 0xff
+	metadata, err := ReadArtifact("v1.1.0", writeArtifact(t, t.TempDir(), metadataCode, releaseID), "")
+	require.NoError(t, err)
+	changedCode := common.CopyBytes(releaseCode)
+	changedCode[10] ^= 0xff
+	changed, err := ReadArtifact("v2.0.0", writeArtifact(t, t.TempDir(), changedCode, releaseID), "")
+	require.NoError(t, err)
+	artifacts := []*Artifact{release, metadata, changed}
+
+	address, code := deploy(common.Hash{1})
+	require.NotEqual(t, releaseCode, code)
+	report, err := Verify(ctx, kit.Client(), address, artifacts)
+	require.NoError(t, err)
+	require.Equal(t, common.Address{}, report.Implementation)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, report.Matches())
+	require.Equal(t, "code differs at byte 10", report.Results[2].Mismatch)
+
+	// A proxy is followed to its implementation.
+	proxyAddress, tx, _, err := transparentupgradeableproxy.DeployTransparentUpgradeableProxy(
+		opts, kit.Client(), address, kit.DeployerAddress, nil,
+	)
+	require.NoError(t, err)
+	_, err = kit.Commit(ctx, tx)
+	require.NoError(t, err)
+	report, err = Verify(ctx, kit.Client(), proxyAddress, artifacts)
+	require.NoError(t, err)
+	require.Equal(t, address, report.Implementation)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, report.Matches())
+
+	_, err = Verify(ctx, kit.Client(), common.Address{1}, artifacts)
+	require.ErrorContains(t, err, "no contract at")
+	_, err = ReadArtifact("v1.0.0", dir, "")
+	require.ErrorContains(t, err, "a contract name is needed")
+}
+
+func TestArtifactMatch(t *testing.T) {
+	// PUSH1 0 PUSH1 0 followed by metadata {"solc": 0x000819}.
+	metadata := common.FromHex("0xa164736f6c6343000819000a")
+	artifact := &Artifact{DeployedBytecode: append(common.FromHex("0x60006000"), metadata...)}
+	require.Equal(t, 4, codeLength(artifact.DeployedBytecode))
+	require.Empty(t, artifact.Match(artifact.DeployedBytecode))
+	require.Equal(t, "code is 4 bytes, not 16", artifact.Match(common.FromHex("0x60006000")))
+
+	// Code without metadata is compared in full.
+	artifact = &Artifact{DeployedBytecode: common.FromHex("0x60006001")}
+	require.Equal(t, 4, codeLength(artifact.DeployedBytecode))
+	require.Equal(t, "code differs at byte 3", artifact.Match(common.FromHex("0x60006000")))
+	artifact.Masked = []Range{{Start: 3, Length: 1}}
+	require.Empty(t, artifact.Match(common.FromHex("0x60006000")))
+
+	// Unlinked libraries are masked.
+	path := filepath.Join(t.TempDir(), "Linked.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"deployedBytecode": {
+		"object": "0x73__$0123456789abcdef0123456789abcdef01$__60",
+		"linkReferences": {"Lib.sol": {"Lib": [{"start": 1, "length": 20}]}}
+	}}`), 0o600))
+	artifact, err := ReadArtifact("v1.0.0", path, "")
+	require.NoError(t, err)
+	linked := append(append([]byte{0x73}, common.Address{1}.Bytes()...), 0x60)
+	require.Empty(t, artifact.Match(linked))
+}
+
+func TestArtifactCompilerMismatch(t *testing.T) {
+	artifact := &Artifact{CompilerVersion: "0.8.25+commit.b61c2a91"}
+	require.Empty(t, artifact.CompilerMismatch("0.8.25"))
+	require.Equal(t, "compiled with solc 0.8.25, not 0.8.18", artifact.CompilerMismatch("0.8.18"))
+	artifact.CompilerVersion = ""
+	require.Equal(t, "artifact has no compiler version in its metadata", artifact.CompilerMismatch("0.8.25"))
+}
+
+func TestReadSolidityVersion(t *testing.T) {
+	version, err := ReadSolidityVersion(filepath.Join("..", "..", "scripts", "versions.sh"))
+	require.NoError(t, err)
+	require.Regexp(t, `^\d+\.\d+\.\d+$`, version)
+
+	path := filepath.Join(t.TempDir(), "versions.sh")
+	require.NoError(t, os.WriteFile(path, []byte("GOLANGCI_LINT_VERSION=v1.60\n"), 0o600))
+	_, err = ReadSolidityVersion(path)
+	require.ErrorContains(t, err, "sets no SOLIDITY_VERSION")
+	_, err = ReadSolidityVersion(filepath.Join(t.TempDir(), "missing.sh"))
+	require.ErrorContains(t, err, "failed to read versions script")
+
+	// The script is parsed, not run.
+	require.NoError(t, os.WriteFile(path, []byte("exit 1\nexport SOLIDITY_VERSION='0.8.18'\n"), 0o600))
+	version, err = ReadSolidityVersion(path)
+	require.NoError(t, err)
+	require.Equal(t, "0.8.18", version)
+
+	// A version read from foundry.toml is read from the repository root.
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "scripts"), 0o700))
+	path = filepath.Join(root, "scripts", "versions.sh")
+	require.NoError(t, os.WriteFile(path,
+		[]byte(`SOLIDITY_VERSION=$(awk -F"'" '/^solc_version/ {print $2}' $ROOT/foundry.toml)`+"\n"), 0o600))
+	_, err = ReadSolidityVersion(path)
+	require.ErrorContains(t, err, "failed to read")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foundry.toml"),
+		[]byte("[profile.default]\nsolc_version = '0.8.20'\n"), 0o600))
+	version, err = ReadSolidityVersion(path)
+	require.NoError(t, err)
+	require.Equal(t, "0.8.20", version)
+}